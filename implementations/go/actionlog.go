@@ -0,0 +1,668 @@
+package grith
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// ActionLogGenesisHash is the previousHash of the first entry in an
+// action log.
+const ActionLogGenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// ActionOutcome records what happened to a logged action.
+type ActionOutcome string
+
+const (
+	OutcomeExecuted   ActionOutcome = "EXECUTED"
+	OutcomeDenied     ActionOutcome = "DENIED"
+	OutcomeImpossible ActionOutcome = "IMPOSSIBLE"
+)
+
+// ActionLogEntry is one action taken under a covenant. Entries are
+// hash-chained through PreviousHash and signed by the agent (the
+// covenant's beneficiary), so any edit, reordering, or deletion within
+// a log is detectable.
+type ActionLogEntry struct {
+	Index      int64  `json:"index"`
+	CovenantID string `json:"covenantId"`
+	Action     string `json:"action"`
+	Resource   string `json:"resource"`
+	// ContextHash is the SHA-256 of the canonical evaluation context, so
+	// the log commits to the context without disclosing it.
+	ContextHash  string        `json:"contextHash"`
+	Outcome      ActionOutcome `json:"outcome"`
+	Timestamp    string        `json:"timestamp"`
+	PreviousHash string        `json:"previousHash"`
+	Hash         string        `json:"hash"`
+	Signature    string        `json:"signature"`
+}
+
+// LogCheckpoint is a signed commitment to the first Size entries of a
+// covenant's action log: the hash of the last entry, and the RFC 6962
+// Merkle root over all entry hashes. Witnesses may cosign it; see
+// CosignCheckpoint.
+type LogCheckpoint struct {
+	CovenantID      string `json:"covenantId"`
+	Size            int64  `json:"size"`
+	HeadHash        string `json:"headHash"`
+	Root            string `json:"root"`
+	Timestamp       string `json:"timestamp"`
+	SignerPublicKey string `json:"signerPublicKey"`
+	Signature       string `json:"signature"`
+
+	Cosignatures []CheckpointCosignature `json:"cosignatures,omitempty"`
+	// Anchors are external existence proofs for the checkpoint; see
+	// AnchorCheckpoint.
+	Anchors []AnchorProof `json:"anchors,omitempty"`
+}
+
+// HashActionContext returns the SHA-256 of the canonical JSON form of an
+// evaluation context. A nil context hashes as an empty object.
+func HashActionContext(context map[string]interface{}) (string, error) {
+	if context == nil {
+		context = map[string]interface{}{}
+	}
+	return SHA256Object(context)
+}
+
+// ComputeEntryHash returns the hash of entry's content, excluding its
+// hash and signature.
+func ComputeEntryHash(entry *ActionLogEntry) (string, error) {
+	m, err := objectToMap(entry)
+	if err != nil {
+		return "", errorf(ErrCodeCanonicalization, "grith: failed to convert entry to map: %w", err)
+	}
+	delete(m, "hash")
+	delete(m, "signature")
+	return SHA256Object(m)
+}
+
+// SignActionLogEntry sets entry's hash and signs it with the agent's
+// private key.
+func SignActionLogEntry(entry *ActionLogEntry, privateKey ed25519.PrivateKey) error {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return errorf(ErrCodeInvalidPrivateKey, "grith: privateKey must be %d bytes", ed25519.PrivateKeySize)
+	}
+	hash, err := ComputeEntryHash(entry)
+	if err != nil {
+		return err
+	}
+	sig, err := Sign([]byte(hash), privateKey)
+	if err != nil {
+		return errorf(ErrCodeCrypto, "grith: failed to sign log entry: %w", err)
+	}
+	entry.Hash = hash
+	entry.Signature = ToHex(sig)
+	return nil
+}
+
+// VerifyActionLogSegment checks a contiguous run of entries: indices are
+// consecutive, each entry chains to its predecessor (the first to
+// previousHash), hashes match content, and every entry is signed by
+// publicKey. Pass ActionLogGenesisHash as previousHash for a segment
+// starting at index 0.
+func VerifyActionLogSegment(entries []ActionLogEntry, publicKey ed25519.PublicKey, previousHash string) error {
+	prev := previousHash
+	for i := range entries {
+		e := &entries[i]
+		if i > 0 && e.Index != entries[i-1].Index+1 {
+			return errorf(ErrCodeActionLog, "grith: log entry %d follows entry %d", e.Index, entries[i-1].Index)
+		}
+		if e.PreviousHash != prev {
+			return errorf(ErrCodeActionLog, "grith: log entry %d does not chain to its predecessor", e.Index)
+		}
+		hash, err := ComputeEntryHash(e)
+		if err != nil {
+			return err
+		}
+		if hash != e.Hash {
+			return errorf(ErrCodeActionLog, "grith: log entry %d hash mismatch", e.Index)
+		}
+		sig, err := FromHex(e.Signature)
+		if err != nil || !Verify([]byte(e.Hash), sig, publicKey) {
+			return errorf(ErrCodeActionLog, "grith: log entry %d has an invalid signature", e.Index)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// CreateLogCheckpoint signs a checkpoint over entries, which must be a
+// complete log starting at index 0.
+func CreateLogCheckpoint(entries []ActionLogEntry, kp *KeyPair) (*LogCheckpoint, error) {
+	if len(entries) == 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: cannot checkpoint an empty log")
+	}
+	if entries[0].Index != 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: checkpoint requires the log from index 0")
+	}
+	root, err := actionLogRoot(entries)
+	if err != nil {
+		return nil, err
+	}
+	last := entries[len(entries)-1]
+	return signLogCheckpoint(last.CovenantID, int64(len(entries)), last.Hash, root, kp)
+}
+
+// signLogCheckpoint signs a checkpoint over a log prefix of the given
+// size, head hash, and Merkle root.
+func signLogCheckpoint(covenantID string, size int64, head, root string, kp *KeyPair) (*LogCheckpoint, error) {
+	cp := &LogCheckpoint{
+		CovenantID:      covenantID,
+		Size:            size,
+		HeadHash:        head,
+		Root:            root,
+		Timestamp:       Timestamp(),
+		SignerPublicKey: kp.PublicKeyHex,
+	}
+	payload, err := checkpointSigningPayload(cp)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := Sign([]byte(payload), kp.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign checkpoint: %w", err)
+	}
+	cp.Signature = ToHex(sig)
+	return cp, nil
+}
+
+// VerifyLogCheckpoint checks cp's signature against its signer key.
+func VerifyLogCheckpoint(cp *LogCheckpoint) error {
+	payload, err := checkpointSigningPayload(cp)
+	if err != nil {
+		return err
+	}
+	pub, err := FromHex(cp.SignerPublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errorf(ErrCodeActionLog, "grith: checkpoint signer key is invalid")
+	}
+	sig, err := FromHex(cp.Signature)
+	if err != nil || !Verify([]byte(payload), sig, ed25519.PublicKey(pub)) {
+		return errorf(ErrCodeActionLog, "grith: checkpoint at size %d has an invalid signature", cp.Size)
+	}
+	return nil
+}
+
+// actionLogRoot computes the Merkle root over entry hashes.
+func actionLogRoot(entries []ActionLogEntry) (string, error) {
+	return MerkleRoot(actionLogLeaves(entries))
+}
+
+// actionLogLeaves returns the Merkle leaf hashes of entries.
+func actionLogLeaves(entries []ActionLogEntry) []string {
+	leaves := make([]string, len(entries))
+	for i := range entries {
+		leaves[i] = MerkleLeafHash([]byte(entries[i].Hash))
+	}
+	return leaves
+}
+
+func checkpointSigningPayload(cp *LogCheckpoint) (string, error) {
+	m, err := objectToMap(cp)
+	if err != nil {
+		return "", errorf(ErrCodeCanonicalization, "grith: failed to convert checkpoint to map: %w", err)
+	}
+	delete(m, "signature")
+	delete(m, "cosignatures")
+	delete(m, "anchors")
+	return CanonicalizeJSON(m)
+}
+
+// LogConsistencyProof shows that the first OldSize entries of a
+// covenant's action log are a prefix of its first NewSize entries.
+type LogConsistencyProof struct {
+	CovenantID string   `json:"covenantId"`
+	OldSize    int64    `json:"oldSize"`
+	NewSize    int64    `json:"newSize"`
+	Hashes     []string `json:"hashes"`
+}
+
+// VerifyLogConsistency checks that the newer checkpoint is an append-only
+// extension of the older one: both are validly signed by the same key for
+// the same covenant, and proof links their Merkle roots. A rewritten
+// history cannot produce a valid proof.
+func VerifyLogConsistency(older, newer *LogCheckpoint, proof *LogConsistencyProof) error {
+	if older == nil || newer == nil || proof == nil {
+		return errorf(ErrCodeMissingField, "grith: consistency check requires two checkpoints and a proof")
+	}
+	if older.CovenantID != newer.CovenantID || proof.CovenantID != older.CovenantID {
+		return errorf(ErrCodeActionLog, "grith: checkpoints and proof belong to different covenants")
+	}
+	if older.SignerPublicKey != newer.SignerPublicKey {
+		return errorf(ErrCodeActionLog, "grith: checkpoints are signed by different keys")
+	}
+	if proof.OldSize != older.Size || proof.NewSize != newer.Size {
+		return errorf(ErrCodeActionLog, "grith: proof covers sizes %d to %d, checkpoints are at %d and %d", proof.OldSize, proof.NewSize, older.Size, newer.Size)
+	}
+	for _, cp := range []*LogCheckpoint{older, newer} {
+		if err := VerifyLogCheckpoint(cp); err != nil {
+			return err
+		}
+	}
+	if !VerifyMerkleConsistency(older.Size, newer.Size, older.Root, newer.Root, proof.Hashes) {
+		return errorf(ErrCodeActionLog, "grith: log at size %d is not an extension of the log at size %d", newer.Size, older.Size)
+	}
+	return nil
+}
+
+// checkpointCoversSegment checks cp against a verified segment that
+// contains entry cp.Size-1. The head hash must match, and when the
+// segment is the whole prefix the Merkle root is recomputed too.
+func checkpointCoversSegment(cp *LogCheckpoint, entries []ActionLogEntry) error {
+	if len(entries) == 0 {
+		return errorf(ErrCodeActionLog, "grith: checkpoint at size %d has no log entries to check against", cp.Size)
+	}
+	first := entries[0].Index
+	last := entries[len(entries)-1].Index
+	if cp.Size-1 < first || cp.Size-1 > last {
+		return errorf(ErrCodeActionLog, "grith: checkpoint at size %d is outside the log segment [%d, %d]", cp.Size, first, last)
+	}
+	if entries[cp.Size-1-first].Hash != cp.HeadHash {
+		return errorf(ErrCodeActionLog, "grith: checkpoint at size %d does not match the log head", cp.Size)
+	}
+	if first == 0 {
+		root, err := actionLogRoot(entries[:cp.Size])
+		if err != nil {
+			return err
+		}
+		if root != cp.Root {
+			return errorf(ErrCodeActionLog, "grith: checkpoint at size %d root mismatch", cp.Size)
+		}
+	}
+	return nil
+}
+
+// ActionLogOptions configure NewActionLog.
+type ActionLogOptions struct {
+	Covenant *CovenantDocument
+	// Agent is the key pair of the covenant's beneficiary. Every entry is
+	// signed with it.
+	Agent *KeyPair
+	// DIDResolver resolves a beneficiary identified by a DID.
+	DIDResolver DIDResolver
+	// Entries resumes a log previously obtained from Entries or
+	// ParseActionLog. They are verified before the log accepts appends.
+	Entries []ActionLogEntry
+}
+
+// ActionLog is an append-only, tamper-evident record of the actions an
+// agent takes under one covenant. It is safe for concurrent use.
+type ActionLog struct {
+	mu      sync.Mutex
+	doc     *CovenantDocument
+	agent   *KeyPair
+	entries []ActionLogEntry
+}
+
+// NewActionLog starts or resumes the action log of opts.Covenant. The
+// agent key must be the covenant beneficiary's key.
+func NewActionLog(opts *ActionLogOptions) (*ActionLog, error) {
+	if opts == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: action log requires a covenant")
+	}
+	if err := checkLogAgent(opts.Covenant, opts.Agent, opts.DIDResolver); err != nil {
+		return nil, err
+	}
+
+	l := &ActionLog{doc: opts.Covenant, agent: opts.Agent}
+	if len(opts.Entries) > 0 {
+		if opts.Entries[0].Index != 0 {
+			return nil, errorf(ErrCodeActionLog, "grith: resumed log must start at index 0")
+		}
+		for _, e := range opts.Entries {
+			if e.CovenantID != opts.Covenant.ID {
+				return nil, errorf(ErrCodeActionLog, "grith: log entry %d belongs to covenant %s", e.Index, shortID(e.CovenantID))
+			}
+		}
+		if err := VerifyActionLogSegment(opts.Entries, opts.Agent.PublicKey, ActionLogGenesisHash); err != nil {
+			return nil, err
+		}
+		l.entries = append([]ActionLogEntry(nil), opts.Entries...)
+	}
+	return l, nil
+}
+
+// checkLogAgent checks that agent holds the covenant beneficiary's key.
+func checkLogAgent(doc *CovenantDocument, agent *KeyPair, resolver DIDResolver) error {
+	if doc == nil || doc.ID == "" {
+		return errorf(ErrCodeMissingField, "grith: action log requires a covenant")
+	}
+	if agent == nil || len(agent.PrivateKey) != ed25519.PrivateKeySize {
+		return errorf(ErrCodeInvalidPrivateKey, "grith: action log requires the agent's key pair")
+	}
+	beneficiary, err := resolvePartyKey(doc.Beneficiary, resolver)
+	if err != nil {
+		return err
+	}
+	if !beneficiary.Equal(agent.PublicKey) {
+		return errorf(ErrCodeInvalidParty, "grith: agent key is not the covenant beneficiary's key")
+	}
+	return nil
+}
+
+// Append records an action, chaining it to the current head and signing
+// it with the agent key. The context is committed to by hash only.
+func (l *ActionLog) Append(action, resource string, context map[string]interface{}, outcome ActionOutcome) (ActionLogEntry, error) {
+	e, err := newActionEntry(l.doc.ID, action, resource, context, outcome)
+	if err != nil {
+		return ActionLogEntry{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Index = int64(len(l.entries))
+	e.PreviousHash = ActionLogGenesisHash
+	if n := len(l.entries); n > 0 {
+		e.PreviousHash = l.entries[n-1].Hash
+	}
+	if err := SignActionLogEntry(&e, l.agent.PrivateKey); err != nil {
+		return ActionLogEntry{}, err
+	}
+	l.entries = append(l.entries, e)
+	if m := currentMetrics(); m != nil {
+		m.ObserveLogAppend()
+	}
+	return e, nil
+}
+
+// newActionEntry validates an action and returns its entry, timestamped
+// now. The caller sets the index and previous hash, then signs it.
+func newActionEntry(covenantID, action, resource string, context map[string]interface{}, outcome ActionOutcome) (ActionLogEntry, error) {
+	if action == "" {
+		return ActionLogEntry{}, errorf(ErrCodeMissingField, "grith: action is required")
+	}
+	switch outcome {
+	case OutcomeExecuted, OutcomeDenied, OutcomeImpossible:
+	default:
+		return ActionLogEntry{}, errorf(ErrCodeInvalidInput, "grith: unknown action outcome %q", outcome)
+	}
+	ctxHash, err := HashActionContext(context)
+	if err != nil {
+		return ActionLogEntry{}, err
+	}
+	return ActionLogEntry{
+		CovenantID:  covenantID,
+		Action:      action,
+		Resource:    resource,
+		ContextHash: ctxHash,
+		Outcome:     outcome,
+		Timestamp:   Timestamp(),
+	}, nil
+}
+
+// Len returns the number of entries in the log.
+func (l *ActionLog) Len() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(len(l.entries))
+}
+
+// Head returns the hash of the latest entry, or ActionLogGenesisHash for
+// an empty log.
+func (l *ActionLog) Head() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n := len(l.entries); n > 0 {
+		return l.entries[n-1].Hash
+	}
+	return ActionLogGenesisHash
+}
+
+// Entries returns a copy of the log's entries.
+func (l *ActionLog) Entries() []ActionLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]ActionLogEntry(nil), l.entries...)
+}
+
+// VerifyChain re-verifies every entry's hash, chain link, and signature.
+func (l *ActionLog) VerifyChain() error {
+	entries := l.Entries()
+	return VerifyActionLogSegment(entries, l.agent.PublicKey, ActionLogGenesisHash)
+}
+
+// Checkpoint signs a checkpoint over the whole log.
+func (l *ActionLog) Checkpoint() (*LogCheckpoint, error) {
+	return CreateLogCheckpoint(l.Entries(), l.agent)
+}
+
+// ConsistencyProof proves that the log's first oldSize entries are a
+// prefix of its first newSize entries, so a holder of a checkpoint at
+// oldSize can confirm a later checkpoint at newSize with
+// VerifyLogConsistency.
+func (l *ActionLog) ConsistencyProof(oldSize, newSize int64) (*LogConsistencyProof, error) {
+	entries := l.Entries()
+	if oldSize < 1 || oldSize > newSize || newSize > int64(len(entries)) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: consistency proof sizes %d to %d out of range for log of size %d", oldSize, newSize, len(entries))
+	}
+	hashes, err := MerkleConsistencyProof(actionLogLeaves(entries[:newSize]), int(oldSize))
+	if err != nil {
+		return nil, err
+	}
+	return &LogConsistencyProof{
+		CovenantID: l.doc.ID,
+		OldSize:    oldSize,
+		NewSize:    newSize,
+		Hashes:     hashes,
+	}, nil
+}
+
+// Export serializes the log's entries as a JSON array, suitable for
+// ParseActionLog, NewActionLog, and ExportBundle.
+func (l *ActionLog) Export() ([]byte, error) {
+	entries := l.Entries()
+	if entries == nil {
+		entries = []ActionLogEntry{}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "grith: failed to serialize action log: %w", err)
+	}
+	return data, nil
+}
+
+// WriteJSONL writes the log's entries to w as JSON Lines, one entry per
+// line, for ReadJSONL.
+func (l *ActionLog) WriteJSONL(w io.Writer) error {
+	return writeJSONL(w, l.Entries())
+}
+
+func writeJSONL(w io.Writer, entries []ActionLogEntry) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			return errorf(ErrCodeSerialization, "grith: failed to write log entry %d: %w", entries[i].Index, err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to write action log: %w", err)
+	}
+	return nil
+}
+
+// ReadJSONLOptions configure ReadJSONL.
+type ReadJSONLOptions struct {
+	// PublicKey is the agent key every entry must be signed with.
+	PublicKey ed25519.PublicKey
+	// CovenantID, if set, is the covenant every entry must belong to.
+	// Otherwise all entries must belong to the first entry's covenant.
+	CovenantID string
+	// PreviousHash is the hash preceding the first entry. It defaults to
+	// ActionLogGenesisHash, in which case the stream must start at index 0.
+	PreviousHash string
+	// Checkpoints are verified against the stream as it passes their
+	// size; a checkpoint beyond the end of the stream means the log was
+	// truncated. Roots are only checked for streams starting at index 0.
+	Checkpoints []LogCheckpoint
+	// Witnesses, if it sets a quorum, must be met by every checkpoint.
+	Witnesses *WitnessPolicy
+}
+
+// JSONLReadResult summarizes a stream read by ReadJSONL.
+type JSONLReadResult struct {
+	CovenantID string `json:"covenantId"`
+	Entries    int64  `json:"entries"`
+	FirstIndex int64  `json:"firstIndex"`
+	HeadHash   string `json:"headHash"`
+	// Root is the Merkle root over the entries, set for streams starting
+	// at index 0; it matches a checkpoint at the stream's size.
+	Root string `json:"root,omitempty"`
+}
+
+// ReadJSONL reads a JSON Lines action log from r, verifying each entry's
+// index, chain link, hash, and signature as it arrives, and calls fn, if
+// non-nil, with every verified entry. Memory use is independent of the
+// log's length. Reading stops at the first invalid entry or fn error.
+func ReadJSONL(r io.Reader, opts *ReadJSONLOptions, fn func(ActionLogEntry) error) (*JSONLReadResult, error) {
+	if opts == nil || len(opts.PublicKey) != ed25519.PublicKeySize {
+		return nil, errorf(ErrCodeMissingField, "grith: reading an action log requires the agent's public key")
+	}
+	prev := opts.PreviousHash
+	if prev == "" {
+		prev = ActionLogGenesisHash
+	}
+	checkpoints := make(map[int64]*LogCheckpoint, len(opts.Checkpoints))
+	for i := range opts.Checkpoints {
+		cp := &opts.Checkpoints[i]
+		if cp.SignerPublicKey != ToHex(opts.PublicKey) {
+			return nil, errorf(ErrCodeActionLog, "grith: checkpoint at size %d is not signed by the agent", cp.Size)
+		}
+		if err := VerifyLogCheckpoint(cp); err != nil {
+			return nil, err
+		}
+		if err := VerifyCheckpointWitnesses(cp, opts.Witnesses); err != nil {
+			return nil, err
+		}
+		checkpoints[cp.Size] = cp
+	}
+
+	result := &JSONLReadResult{CovenantID: opts.CovenantID, HeadHash: prev}
+	var tree *merkleAccumulator
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), MaxDocumentSize)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e ActionLogEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, errorf(ErrCodeInvalidJSON, "grith: invalid log entry on line %d: %w", line, err)
+		}
+		if result.Entries == 0 {
+			if prev == ActionLogGenesisHash && e.Index != 0 {
+				return nil, errorf(ErrCodeActionLog, "grith: log starting at the genesis hash must start at index 0, got %d", e.Index)
+			}
+			result.FirstIndex = e.Index
+			if result.CovenantID == "" {
+				result.CovenantID = e.CovenantID
+			}
+			if e.Index == 0 {
+				tree = &merkleAccumulator{}
+			}
+		} else if e.Index != result.FirstIndex+result.Entries {
+			return nil, errorf(ErrCodeActionLog, "grith: log entry %d on line %d follows entry %d", e.Index, line, result.FirstIndex+result.Entries-1)
+		}
+		if e.CovenantID != result.CovenantID {
+			return nil, errorf(ErrCodeActionLog, "grith: log entry %d belongs to covenant %s", e.Index, shortID(e.CovenantID))
+		}
+		if err := VerifyActionLogSegment([]ActionLogEntry{e}, opts.PublicKey, prev); err != nil {
+			return nil, err
+		}
+		prev = e.Hash
+		result.Entries++
+		result.HeadHash = e.Hash
+
+		size := e.Index + 1
+		if tree != nil {
+			tree.add(merkleLeaf([]byte(e.Hash)))
+		}
+		if cp := checkpoints[size]; cp != nil {
+			if cp.CovenantID != e.CovenantID || cp.HeadHash != e.Hash {
+				return nil, errorf(ErrCodeActionLog, "grith: checkpoint at size %d does not match the log head", size)
+			}
+			if tree != nil && cp.Root != hex.EncodeToString(tree.root()) {
+				return nil, errorf(ErrCodeActionLog, "grith: checkpoint at size %d root mismatch", size)
+			}
+		}
+		if fn != nil {
+			if err := fn(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to read action log: %w", err)
+	}
+	for size := range checkpoints {
+		if size > result.FirstIndex+result.Entries {
+			return nil, errorf(ErrCodeActionLog, "grith: log ends at size %d but a checkpoint covers size %d", result.FirstIndex+result.Entries, size)
+		}
+	}
+	if tree != nil {
+		result.Root = hex.EncodeToString(tree.root())
+	}
+	return result, nil
+}
+
+// ParseActionLog decodes entries serialized by ActionLog.Export. The
+// entries are not verified; use VerifyActionLogSegment or NewActionLog.
+func ParseActionLog(data []byte) ([]ActionLogEntry, error) {
+	var entries []ActionLogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "grith: invalid action log JSON: %w", err)
+	}
+	return entries, nil
+}
+
+// ReadActionLog decodes entries serialized by ActionLog.Export from r,
+// streaming them one at a time rather than buffering the export. At most
+// maxBytes bytes are read: a larger export fails with
+// ErrCodeDocumentTooLarge as soon as it passes the limit. Like
+// ParseActionLog, it does not verify the entries; to verify a log of any
+// length in constant memory, export it as JSON Lines and use ReadJSONL.
+func ReadActionLog(r io.Reader, maxBytes int64) ([]ActionLogEntry, error) {
+	if maxBytes <= 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: action log size limit must be positive")
+	}
+	dec := json.NewDecoder(&sizeLimitedReader{r: r, n: maxBytes})
+	fail := func(err error) ([]ActionLogEntry, error) {
+		return nil, jsonReadError(err, maxBytes, "action log")
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return fail(err)
+	}
+	var entries []ActionLogEntry
+	switch tok {
+	case nil:
+	case json.Delim('['):
+		entries = []ActionLogEntry{}
+		for dec.More() {
+			var e ActionLogEntry
+			if err := dec.Decode(&e); err != nil {
+				return fail(err)
+			}
+			entries = append(entries, e)
+		}
+		if _, err := dec.Token(); err != nil {
+			return fail(err)
+		}
+	default:
+		return nil, errorf(ErrCodeInvalidJSON, "grith: invalid action log JSON: not an array")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errTrailingData
+		}
+		return fail(err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,229 @@
+package grith
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Anchor is an independent existence proof service, such as a timestamp
+// authority or a blockchain. An anchor commits to a 32-byte digest: a
+// covenant ID or the root of a batch built with AnchorBatch.
+type Anchor interface {
+	// Type names the anchor, e.g. "opentimestamps". It is recorded in
+	// each AnchorProof to select the anchor at verification time.
+	Type() string
+	// Stamp submits digest and returns an anchor-specific proof, which
+	// may be incomplete until upgraded.
+	Stamp(digest []byte) ([]byte, error)
+	// Upgrade attempts to complete a pending proof. It returns the proof
+	// unchanged if nothing new is available.
+	Upgrade(digest, proof []byte) ([]byte, error)
+	// Verify checks proof against digest.
+	Verify(digest, proof []byte) (*AnchorAttestation, error)
+}
+
+// AnchorAttestation is the outcome of verifying an anchor proof.
+type AnchorAttestation struct {
+	Type string
+	// Complete is true when the proof is attested by the anchor's
+	// underlying trust root (e.g. a Bitcoin block header).
+	Complete bool
+	// Time is the attested existence time; it is only meaningful when
+	// Complete is true.
+	Time time.Time
+	// Detail describes the attestation, e.g. a block height or the
+	// calendars a pending proof is waiting on.
+	Detail string
+}
+
+// AnchorProof records an anchor's proof for a covenant. Anchor proofs are
+// added after signing -- they commit to the covenant ID -- so they are
+// kept in the document's anchors field, outside the canonical form.
+type AnchorProof struct {
+	Type string `json:"type"`
+	// Digest is the hex digest that was stamped: the covenant ID, or the
+	// batch root when Batch is set.
+	Digest string `json:"digest"`
+	// Proof is the base64-encoded anchor-specific proof.
+	Proof string `json:"proof"`
+	// Batch, if set, proves the covenant's inclusion under Digest.
+	Batch *BatchProof `json:"batch,omitempty"`
+}
+
+// AnchorCovenant stamps doc's ID with anchor and returns a copy of doc
+// with the proof attached.
+func AnchorCovenant(doc *CovenantDocument, anchor Anchor) (*CovenantDocument, error) {
+	digest, err := anchorDigest(doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := anchor.Stamp(digest)
+	if err != nil {
+		return nil, err
+	}
+	return withAnchorProof(doc, AnchorProof{
+		Type:   anchor.Type(),
+		Digest: doc.ID,
+		Proof:  base64.StdEncoding.EncodeToString(proof),
+	}), nil
+}
+
+// AnchorCovenantBatch builds a batch over docs with AnchorBatch, stamps
+// its root once with anchor, and returns copies of docs each carrying the
+// shared proof plus its own batch inclusion proof.
+func AnchorCovenantBatch(docs []*CovenantDocument, anchor Anchor) ([]*CovenantDocument, *BatchAnchor, error) {
+	batch, err := AnchorBatch(docs)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest, err := anchorDigest(batch.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof, err := anchor.Stamp(digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(proof)
+
+	out := make([]*CovenantDocument, len(docs))
+	for i, doc := range docs {
+		out[i] = withAnchorProof(doc, AnchorProof{
+			Type:   anchor.Type(),
+			Digest: batch.Root,
+			Proof:  encoded,
+			Batch:  batch.Proofs[doc.ID],
+		})
+	}
+	return out, batch, nil
+}
+
+// UpgradeAnchorProofs asks anchor to complete each of doc's proofs of the
+// anchor's type and returns a copy of doc with the upgraded proofs.
+func UpgradeAnchorProofs(doc *CovenantDocument, anchor Anchor) (*CovenantDocument, error) {
+	newDoc := *doc
+	newDoc.Anchors = append([]AnchorProof(nil), doc.Anchors...)
+	for i, ap := range newDoc.Anchors {
+		if ap.Type != anchor.Type() {
+			continue
+		}
+		digest, proof, err := decodeAnchorProof(ap)
+		if err != nil {
+			return nil, err
+		}
+		upgraded, err := anchor.Upgrade(digest, proof)
+		if err != nil {
+			return nil, err
+		}
+		newDoc.Anchors[i].Proof = base64.StdEncoding.EncodeToString(upgraded)
+	}
+	return &newDoc, nil
+}
+
+// VerifyAnchorProofs verifies each of doc's anchor proofs with the anchor
+// of matching type and returns the resulting attestations. Proofs whose
+// type has no anchor are skipped. A proof that does not commit to the
+// document, or that its anchor rejects, is an error.
+func VerifyAnchorProofs(doc *CovenantDocument, anchors ...Anchor) ([]*AnchorAttestation, error) {
+	id, err := ComputeID(doc)
+	if err != nil {
+		return nil, err
+	}
+	if id != doc.ID {
+		return nil, errorf(ErrCodeAnchor, "grith: document ID does not match its canonical form")
+	}
+
+	return verifyAnchorList(id, doc.Anchors, anchors)
+}
+
+// verifyAnchorList verifies proofs committing to the hex digest id with
+// the anchors of matching type, skipping proofs of other types.
+func verifyAnchorList(id string, proofs []AnchorProof, anchors []Anchor) ([]*AnchorAttestation, error) {
+	byType := make(map[string]Anchor, len(anchors))
+	for _, a := range anchors {
+		byType[a.Type()] = a
+	}
+	var out []*AnchorAttestation
+	for i, ap := range proofs {
+		a, ok := byType[ap.Type]
+		if !ok {
+			continue
+		}
+		if ap.Batch != nil {
+			if ap.Batch.Root != ap.Digest || !VerifyBatchProof(id, ap.Batch) {
+				return nil, errorf(ErrCodeAnchor, "grith: anchor proof %d: batch proof does not include the document", i)
+			}
+		} else if ap.Digest != id {
+			return nil, errorf(ErrCodeAnchor, "grith: anchor proof %d does not commit to the document", i)
+		}
+		digest, proof, err := decodeAnchorProof(ap)
+		if err != nil {
+			return nil, err
+		}
+		att, err := a.Verify(digest, proof)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, att)
+	}
+	return out, nil
+}
+
+// checkAnchored passes when at least one anchor proof is complete.
+func checkAnchored(doc *CovenantDocument, anchors []Anchor) VerificationCheck {
+	check := VerificationCheck{Name: "anchored", Code: CheckAnchored}
+	atts, err := VerifyAnchorProofs(doc, anchors...)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	var earliest time.Time
+	var pending []string
+	for _, att := range atts {
+		if !att.Complete {
+			pending = append(pending, att.Detail)
+			continue
+		}
+		if earliest.IsZero() || att.Time.Before(earliest) {
+			earliest = att.Time
+		}
+	}
+	switch {
+	case !earliest.IsZero():
+		check.Passed = true
+		check.Message = fmt.Sprintf("Anchored no later than %s", earliest.UTC().Format(time.RFC3339))
+	case len(pending) > 0:
+		check.Message = "Anchor proofs are pending: " + strings.Join(pending, "; ")
+	default:
+		check.Message = "No verifiable anchor proof"
+	}
+	return check
+}
+
+func withAnchorProof(doc *CovenantDocument, ap AnchorProof) *CovenantDocument {
+	newDoc := *doc
+	newDoc.Anchors = append(append([]AnchorProof(nil), doc.Anchors...), ap)
+	return &newDoc
+}
+
+func anchorDigest(hexDigest string) ([]byte, error) {
+	if !isHexDigest(hexDigest) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: anchor digest must be a 64-char hex SHA-256 digest")
+	}
+	return FromHex(hexDigest)
+}
+
+func decodeAnchorProof(ap AnchorProof) (digest, proof []byte, err error) {
+	digest, err = anchorDigest(ap.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof, err = base64.StdEncoding.DecodeString(ap.Proof)
+	if err != nil {
+		return nil, nil, errorf(ErrCodeAnchor, "grith: invalid anchor proof encoding: %w", err)
+	}
+	return digest, proof, nil
+}
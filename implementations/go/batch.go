@@ -0,0 +1,100 @@
+package grith
+
+// BatchProof proves that a covenant ID is a leaf of a batch Merkle tree.
+// It is self-contained: the root it commits to is included so the proof
+// can be checked against an externally anchored root.
+type BatchProof struct {
+	CovenantID string   `json:"covenantId"`
+	Root       string   `json:"root"`
+	LeafIndex  int64    `json:"leafIndex"`
+	TreeSize   int64    `json:"treeSize"`
+	Hashes     []string `json:"hashes"`
+}
+
+// BatchAnchor is the result of AnchorBatch: a single Merkle root covering
+// every covenant in the batch, plus an inclusion proof per covenant.
+type BatchAnchor struct {
+	Root     string                 `json:"root"`
+	TreeSize int64                  `json:"treeSize"`
+	Proofs   map[string]*BatchProof `json:"proofs"`
+}
+
+// AnchorBatch builds an RFC 6962 Merkle tree over the IDs of docs, in the
+// order given, and returns its root with a per-document inclusion proof.
+// Anchoring the root once (with a timestamp authority, a blockchain, or
+// an Anchor) then anchors every covenant in the batch.
+//
+// Each document's ID must match its canonical form, and IDs must be
+// unique within the batch.
+func AnchorBatch(docs []*CovenantDocument) (*BatchAnchor, error) {
+	if len(docs) == 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: cannot anchor an empty batch")
+	}
+
+	leaves := make([]string, len(docs))
+	seen := make(map[string]bool, len(docs))
+	for i, doc := range docs {
+		if doc == nil {
+			return nil, errorf(ErrCodeInvalidInput, "grith: batch document %d is nil", i)
+		}
+		id, err := ComputeID(doc)
+		if err != nil {
+			return nil, err
+		}
+		if id != doc.ID {
+			return nil, errorf(ErrCodeInvalidInput, "grith: batch document %d ID does not match its canonical form", i)
+		}
+		if seen[id] {
+			return nil, errorf(ErrCodeInvalidInput, "grith: duplicate covenant %s in batch", id)
+		}
+		seen[id] = true
+		leaves[i] = MerkleLeafHash([]byte(id))
+	}
+
+	root, err := MerkleRoot(leaves)
+	if err != nil {
+		return nil, err
+	}
+	anchor := &BatchAnchor{
+		Root:     root,
+		TreeSize: int64(len(leaves)),
+		Proofs:   make(map[string]*BatchProof, len(leaves)),
+	}
+	for i, doc := range docs {
+		hashes, err := MerkleInclusionProof(leaves, i)
+		if err != nil {
+			return nil, err
+		}
+		anchor.Proofs[doc.ID] = &BatchProof{
+			CovenantID: doc.ID,
+			Root:       root,
+			LeafIndex:  int64(i),
+			TreeSize:   anchor.TreeSize,
+			Hashes:     hashes,
+		}
+	}
+	return anchor, nil
+}
+
+// VerifyBatchProof reports whether proof shows that the covenant ID is
+// included under proof.Root.
+func VerifyBatchProof(covenantID string, proof *BatchProof) bool {
+	if proof == nil || proof.CovenantID != covenantID {
+		return false
+	}
+	return VerifyMerkleInclusion(MerkleLeafHash([]byte(covenantID)), proof.LeafIndex, proof.TreeSize, proof.Hashes, proof.Root)
+}
+
+// VerifyDocumentBatchProof reports whether proof shows that doc is
+// included under root. The document ID is recomputed from its canonical
+// form, so a proof for a tampered document never verifies.
+func VerifyDocumentBatchProof(doc *CovenantDocument, proof *BatchProof, root string) bool {
+	if doc == nil || proof == nil || proof.Root != root {
+		return false
+	}
+	id, err := ComputeID(doc)
+	if err != nil || id != doc.ID {
+		return false
+	}
+	return VerifyBatchProof(id, proof)
+}
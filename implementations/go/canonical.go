@@ -0,0 +1,228 @@
+package grith
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxPooledBuffer bounds the capacity of buffers returned to
+// canonicalBuffers, so one large document does not pin its buffer.
+const maxPooledBuffer = 64 << 10
+
+// canonicalBuffers holds reusable encoding buffers for canonical JSON.
+var canonicalBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 2048)
+		return &b
+	},
+}
+
+func getCanonicalBuffer() *[]byte {
+	return canonicalBuffers.Get().(*[]byte)
+}
+
+func putCanonicalBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	canonicalBuffers.Put(b)
+}
+
+// canonicalCovenant encodes the canonical form of doc into a pooled
+// buffer, which the caller returns with putCanonicalBuffer.
+func canonicalCovenant(doc *CovenantDocument) (*[]byte, error) {
+	buf := getCanonicalBuffer()
+	b, err := appendCanonicalCovenant((*buf)[:0], doc)
+	if err != nil {
+		putCanonicalBuffer(buf)
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to canonicalize document: %w", err)
+	}
+	*buf = b
+	return buf, nil
+}
+
+// canonicalCovenantID returns the SHA-256 document ID of doc.
+func canonicalCovenantID(doc *CovenantDocument) (string, error) {
+	buf, err := canonicalCovenant(doc)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(*buf)
+	putCanonicalBuffer(buf)
+	var id [2 * sha256.Size]byte
+	hex.Encode(id[:], sum[:])
+	return string(id[:]), nil
+}
+
+// appendCanonicalCovenant appends the canonical form of doc to b: its
+// JSON object without the id, signature, countersignatures,
+// transparency, and anchors fields, with keys sorted. It writes the
+// fields directly, in sorted order, rather than building the object as
+// a map; only metadata and extension values are converted first, as
+// they may hold any Go value.
+func appendCanonicalCovenant(b []byte, doc *CovenantDocument) ([]byte, error) {
+	if doc == nil {
+		return append(b, "null"...), nil
+	}
+	b = append(b, '{')
+	if doc.ActivatesAt != "" {
+		b = appendCanonicalKey(b, "activatesAt", true)
+		b = appendJSONString(b, doc.ActivatesAt)
+	}
+	b = appendCanonicalKey(b, "beneficiary", doc.ActivatesAt == "")
+	b = appendCanonicalParty(b, doc.Beneficiary)
+	if c := doc.Chain; c != nil {
+		b = appendCanonicalKey(b, "chain", false)
+		b = append(b, `{"depth":`...)
+		b = appendJSONInt(b, int64(c.Depth))
+		b = append(b, `,"parentId":`...)
+		b = appendJSONString(b, c.ParentID)
+		b = append(b, `,"relation":`...)
+		b = appendJSONString(b, c.Relation)
+		b = append(b, '}')
+	}
+	b = appendCanonicalKey(b, "constraints", false)
+	b = appendJSONString(b, doc.Constraints)
+	if ref := doc.ConstraintsRef; ref != nil {
+		b = appendCanonicalKey(b, "constraintsRef", false)
+		b = append(b, `{"hash":`...)
+		b = appendJSONString(b, ref.Hash)
+		if ref.URI != "" {
+			b = append(b, `,"uri":`...)
+			b = appendJSONString(b, ref.URI)
+		}
+		b = append(b, '}')
+	}
+	b = appendCanonicalKey(b, "createdAt", false)
+	b = appendJSONString(b, doc.CreatedAt)
+	if doc.ExpiresAt != "" {
+		b = appendCanonicalKey(b, "expiresAt", false)
+		b = appendJSONString(b, doc.ExpiresAt)
+	}
+	if len(doc.Extensions) > 0 {
+		b = appendCanonicalKey(b, "extensions", false)
+		names := make([]string, 0, len(doc.Extensions))
+		for name := range doc.Extensions {
+			names = append(names, name)
+		}
+		// Names are sorted as the encoded keys will be, after invalid
+		// UTF-8 is replaced.
+		sort.Slice(names, func(i, j int) bool { return validJSONString(names[i]) < validJSONString(names[j]) })
+		b = append(b, '{')
+		for i, name := range names {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = append(appendJSONString(b, name), `:{"critical":`...)
+			ext := doc.Extensions[name]
+			if ext.Critical {
+				b = append(b, "true"...)
+			} else {
+				b = append(b, "false"...)
+			}
+			if ext.Value != nil {
+				b = append(b, `,"value":`...)
+				var err error
+				if b, err = appendCanonicalValue(b, ext.Value); err != nil {
+					return nil, err
+				}
+			}
+			b = append(b, '}')
+		}
+		b = append(b, '}')
+	}
+	if doc.GracePeriod != 0 {
+		b = appendCanonicalKey(b, "gracePeriod", false)
+		b = appendJSONInt(b, doc.GracePeriod)
+	}
+	b = appendCanonicalKey(b, "issuer", false)
+	b = appendCanonicalParty(b, doc.Issuer)
+	var err error
+	if len(doc.Metadata) > 0 {
+		b = appendCanonicalKey(b, "metadata", false)
+		if b, err = appendCanonicalValue(b, doc.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	if len(doc.MetadataSchema) > 0 {
+		b = appendCanonicalKey(b, "metadataSchema", false)
+		if b, err = appendCanonicalValue(b, doc.MetadataSchema); err != nil {
+			return nil, err
+		}
+	}
+	b = appendCanonicalKey(b, "nonce", false)
+	b = appendJSONString(b, doc.Nonce)
+	b = appendCanonicalKey(b, "version", false)
+	b = appendJSONString(b, doc.Version)
+	return append(b, '}'), nil
+}
+
+func appendCanonicalKey(b []byte, key string, first bool) []byte {
+	if !first {
+		b = append(b, ',')
+	}
+	b = append(b, '"')
+	b = append(b, key...)
+	return append(b, '"', ':')
+}
+
+func appendCanonicalParty(b []byte, p Party) []byte {
+	b = append(b, `{"id":`...)
+	b = appendJSONString(b, p.ID)
+	b = append(b, `,"publicKey":`...)
+	b = appendJSONString(b, p.PublicKey)
+	b = append(b, `,"role":`...)
+	b = appendJSONString(b, p.Role)
+	return append(b, '}')
+}
+
+// appendCanonicalValue appends the canonical form of a metadata or
+// extension value. Values already in decoded JSON form are encoded
+// directly; others are converted first, so that, for example, an int64
+// is encoded as the float64 it decodes to.
+func appendCanonicalValue(b []byte, v interface{}) ([]byte, error) {
+	if !isDecodedJSON(v) {
+		var err error
+		if v, err = jsonValue(v); err != nil {
+			return nil, err
+		}
+	}
+	return appendCanonicalJSON(b, v)
+}
+
+// isDecodedJSON reports whether v holds only the types a JSON decode
+// produces into an interface{}, with valid UTF-8 strings.
+func isDecodedJSON(v interface{}) bool {
+	switch v := v.(type) {
+	case nil, bool, float64:
+		return true
+	case string:
+		return utf8.ValidString(v)
+	case map[string]interface{}:
+		for k, e := range v {
+			if !utf8.ValidString(k) || !isDecodedJSON(e) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		for _, e := range v {
+			if !isDecodedJSON(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// appendJSONInt appends n as the float64 it decodes to, as the map form
+// of a document holds it.
+func appendJSONInt(b []byte, n int64) []byte {
+	b, _ = appendJSONFloat(b, float64(n), 64)
+	return b
+}
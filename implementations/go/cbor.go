@@ -0,0 +1,255 @@
+package grith
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A minimal CBOR (RFC 8949) codec for attestation documents. Decoding
+// supports definite-length items only and produces uint64, int64,
+// []byte, string, []interface{}, map[interface{}]interface{}, bool, nil,
+// and float64 values; tags are stripped.
+
+// maxCBORDepth bounds nesting when decoding untrusted input.
+const maxCBORDepth = 16
+
+func cborDecode(data []byte) (interface{}, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("cbor: %d trailing bytes", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) head() (major byte, arg uint64, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, fmt.Errorf("cbor: unexpected end of input")
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info := b>>5, b&0x1f
+	var n int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	default:
+		return 0, 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+	if len(d.data)-d.pos < n {
+		return 0, 0, fmt.Errorf("cbor: unexpected end of input")
+	}
+	for _, c := range d.data[d.pos : d.pos+n] {
+		arg = arg<<8 | uint64(c)
+	}
+	d.pos += n
+	return major, arg, nil
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("cbor: nesting too deep")
+	}
+	start := d.pos
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		return arg, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: negative integer out of range")
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("cbor: string length %d exceeds input", arg)
+		}
+		b := d.data[d.pos : d.pos+int(arg)]
+		d.pos += int(arg)
+		if major == 3 {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case 4:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("cbor: array length %d exceeds input", arg)
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case 5:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("cbor: map length %d exceeds input", arg)
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case uint64, int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key type %T", k)
+			}
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case 6:
+		return d.decode(depth + 1)
+	default:
+		info := d.data[start] & 0x1f
+		switch {
+		case info == 20:
+			return false, nil
+		case info == 21:
+			return true, nil
+		case info == 22 || info == 23:
+			return nil, nil
+		case info == 25:
+			return nil, fmt.Errorf("cbor: half-precision floats are not supported")
+		case info == 26:
+			return float64(math.Float32frombits(uint32(arg))), nil
+		case info == 27:
+			return math.Float64frombits(arg), nil
+		}
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+}
+
+// cborEncode encodes v, which may hold the types cborDecode produces as
+// well as int, map[string]interface{}, and map[int]interface{}. Map keys
+// are written in the canonical order of RFC 8949 section 4.2.1.
+func cborEncode(v interface{}) ([]byte, error) {
+	var out []byte
+	if err := cborAppend(&out, v); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func cborAppendHead(out *[]byte, major byte, arg uint64) {
+	m := major << 5
+	switch {
+	case arg < 24:
+		*out = append(*out, m|byte(arg))
+	case arg <= math.MaxUint8:
+		*out = append(*out, m|24, byte(arg))
+	case arg <= math.MaxUint16:
+		*out = append(*out, m|25)
+		*out = binary.BigEndian.AppendUint16(*out, uint16(arg))
+	case arg <= math.MaxUint32:
+		*out = append(*out, m|26)
+		*out = binary.BigEndian.AppendUint32(*out, uint32(arg))
+	default:
+		*out = append(*out, m|27)
+		*out = binary.BigEndian.AppendUint64(*out, arg)
+	}
+}
+
+func cborAppend(out *[]byte, v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		*out = append(*out, 0xf6)
+	case bool:
+		if x {
+			*out = append(*out, 0xf5)
+		} else {
+			*out = append(*out, 0xf4)
+		}
+	case uint64:
+		cborAppendHead(out, 0, x)
+	case int:
+		return cborAppend(out, int64(x))
+	case int64:
+		if x >= 0 {
+			cborAppendHead(out, 0, uint64(x))
+		} else {
+			cborAppendHead(out, 1, uint64(-1-x))
+		}
+	case []byte:
+		cborAppendHead(out, 2, uint64(len(x)))
+		*out = append(*out, x...)
+	case string:
+		cborAppendHead(out, 3, uint64(len(x)))
+		*out = append(*out, x...)
+	case []interface{}:
+		cborAppendHead(out, 4, uint64(len(x)))
+		for _, item := range x {
+			if err := cborAppend(out, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(x))
+		for k, val := range x {
+			m[k] = val
+		}
+		return cborAppend(out, m)
+	case map[int]interface{}:
+		m := make(map[interface{}]interface{}, len(x))
+		for k, val := range x {
+			m[int64(k)] = val
+		}
+		return cborAppend(out, m)
+	case map[interface{}]interface{}:
+		type pair struct{ key, value []byte }
+		pairs := make([]pair, 0, len(x))
+		for k, val := range x {
+			var kb, vb []byte
+			if err := cborAppend(&kb, k); err != nil {
+				return err
+			}
+			if err := cborAppend(&vb, val); err != nil {
+				return err
+			}
+			pairs = append(pairs, pair{kb, vb})
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			a, b := pairs[i].key, pairs[j].key
+			if len(a) != len(b) {
+				return len(a) < len(b)
+			}
+			return string(a) < string(b)
+		})
+		cborAppendHead(out, 5, uint64(len(pairs)))
+		for _, p := range pairs {
+			*out = append(*out, p.key...)
+			*out = append(*out, p.value...)
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported type %T", v)
+	}
+	return nil
+}
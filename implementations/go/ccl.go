@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 // StatementType represents the four CCL statement types.
@@ -24,6 +28,9 @@ type Condition struct {
 	Field    string
 	Operator string
 	Value    string
+	// Quoted reports whether Value is a string rather than a number or
+	// boolean, so Serialize writes it back in quotes.
+	Quoted bool
 }
 
 // Statement represents a single CCL statement.
@@ -106,235 +113,191 @@ const (
 	tokDot
 )
 
+// token is a lexical token. Its position is the byte offset of its
+// first character in the source.
 type token struct {
 	typ    tokenType
 	value  string
-	line   int
-	column int
+	offset int
 }
 
-func tokenize(source string) []token {
-	var tokens []token
-	runes := []rune(source)
-	pos := 0
-	line := 1
-	col := 1
-
-	peek := func() rune {
-		if pos < len(runes) {
-			return runes[pos]
-		}
-		return 0
-	}
+// CCLSyntaxError is a CCL parse error at a position in the source. Parse
+// returns it, possibly wrapped; use errors.As to recover the position.
+type CCLSyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
 
-	peekAt := func(offset int) rune {
-		idx := pos + offset
-		if idx < len(runes) {
-			return runes[idx]
-		}
-		return 0
-	}
+func (e *CCLSyntaxError) Error() string {
+	return fmt.Sprintf("CCL parse error at line %d, col %d: %s", e.Line, e.Column, e.Message)
+}
 
-	advance := func() rune {
-		ch := runes[pos]
-		pos++
-		col++
-		return ch
-	}
+// syntaxError returns a CCLSyntaxError at tok.
+func (p *parser) syntaxError(tok token, format string, args ...interface{}) error {
+	line, column := p.position(tok.offset)
+	return &CCLSyntaxError{Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
 
-	addToken := func(t tokenType, val string, ln, c int) {
-		tokens = append(tokens, token{typ: t, value: val, line: ln, column: c})
-	}
+// keywords maps the lowercase CCL keywords to their token types.
+var keywords = []struct {
+	word string
+	typ  tokenType
+}{
+	{"permit", tokPermit},
+	{"deny", tokDeny},
+	{"require", tokRequire},
+	{"limit", tokLimitKw},
+	{"on", tokOn},
+	{"when", tokWhen},
+	{"per", tokPer},
+	{"seconds", tokTimeUnit}, {"second", tokTimeUnit},
+	{"minutes", tokTimeUnit}, {"minute", tokTimeUnit},
+	{"hours", tokTimeUnit}, {"hour", tokTimeUnit},
+	{"days", tokTimeUnit}, {"day", tokTimeUnit},
+}
 
-	// Time unit keywords
-	timeUnits := map[string]bool{
-		"seconds": true, "second": true,
-		"minutes": true, "minute": true,
-		"hours": true, "hour": true,
-		"days": true, "day": true,
+// wordType returns the token type of an identifier-like word. Keywords
+// are matched case-insensitively.
+func wordType(word string) tokenType {
+	for _, kw := range keywords {
+		if len(kw.word) == len(word) && strings.EqualFold(kw.word, word) {
+			return kw.typ
+		}
 	}
+	return tokIdentifier
+}
 
-	keywords := map[string]tokenType{
-		"permit":  tokPermit,
-		"deny":    tokDeny,
-		"require": tokRequire,
-		"limit":   tokLimitKw,
-		"on":      tokOn,
-		"when":    tokWhen,
-		"per":     tokPer,
-	}
+// scanner tokenizes CCL source in place: token values are substrings of
+// the source, and positions are byte offsets, resolved to lines and
+// columns only when a syntax error is reported.
+type scanner struct {
+	src    string
+	pos    int
+	tokens []token
+}
 
-	for pos < len(runes) {
-		ch := peek()
+func tokenize(source string) []token {
+	s := &scanner{src: source, tokens: make([]token, 0, len(source)/4+1)}
+	s.scan()
+	return s.tokens
+}
 
-		// Skip spaces and tabs
-		if ch == ' ' || ch == '\t' || ch == '\r' {
-			advance()
-			continue
-		}
+func (s *scanner) add(t tokenType, value string, offset int) {
+	s.tokens = append(s.tokens, token{typ: t, value: value, offset: offset})
+}
 
-		// Newlines
-		if ch == '\n' {
-			startLine := line
-			startCol := col
-			advance()
-			line++
-			col = 1
-			if len(tokens) > 0 && tokens[len(tokens)-1].typ != tokNewline {
-				addToken(tokNewline, "\n", startLine, startCol)
-			}
-			continue
-		}
+// peekAt returns the byte offset bytes ahead, or 0 past the end.
+func (s *scanner) peekAt(offset int) byte {
+	if i := s.pos + offset; i < len(s.src) {
+		return s.src[i]
+	}
+	return 0
+}
 
-		// Comments
-		if ch == '#' {
-			startLine := line
-			startCol := col
-			var comment strings.Builder
-			for pos < len(runes) && peek() != '\n' {
-				comment.WriteRune(advance())
+// runeAt decodes the rune at the current position.
+func (s *scanner) runeAt() (rune, int) {
+	if c := s.src[s.pos]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+	return utf8.DecodeRuneInString(s.src[s.pos:])
+}
+
+func (s *scanner) scan() {
+	src := s.src
+	for s.pos < len(src) {
+		start := s.pos
+		switch ch := src[start]; {
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			s.pos++
+
+		case ch == '\n':
+			s.pos++
+			if n := len(s.tokens); n > 0 && s.tokens[n-1].typ != tokNewline {
+				s.add(tokNewline, "\n", start)
 			}
-			addToken(tokComment, comment.String(), startLine, startCol)
-			continue
-		}
 
-		// Single-quoted strings
-		if ch == '\'' {
-			startLine := line
-			startCol := col
-			advance() // consume opening quote
-			var str strings.Builder
-			for pos < len(runes) && peek() != '\'' {
-				if peek() == '\n' {
-					line++
-					col = 0
-				}
-				str.WriteRune(advance())
+		case ch == '#':
+			end := strings.IndexByte(src[start:], '\n')
+			if end < 0 {
+				end = len(src) - start
 			}
-			if pos < len(runes) {
-				advance() // consume closing quote
+			s.pos = start + end
+			s.add(tokComment, validJSONString(src[start:s.pos]), start)
+
+		case ch == '\'':
+			// Single-quoted strings run to the closing quote, across
+			// newlines, or to the end of the source.
+			end := strings.IndexByte(src[start+1:], '\'')
+			if end < 0 {
+				s.pos = len(src)
+				s.add(tokString, validJSONString(src[start+1:]), start)
+			} else {
+				s.pos = start + 1 + end + 1
+				s.add(tokString, validJSONString(src[start+1:start+1+end]), start)
 			}
-			addToken(tokString, str.String(), startLine, startCol)
-			continue
-		}
 
-		// Operators: !=, <=, >=, <, >, =
-		if ch == '!' && peekAt(1) == '=' {
-			startCol := col
-			advance()
-			advance()
-			addToken(tokOperator, "!=", line, startCol)
-			continue
-		}
-		if ch == '<' && peekAt(1) == '=' {
-			startCol := col
-			advance()
-			advance()
-			addToken(tokOperator, "<=", line, startCol)
-			continue
-		}
-		if ch == '>' && peekAt(1) == '=' {
-			startCol := col
-			advance()
-			advance()
-			addToken(tokOperator, ">=", line, startCol)
-			continue
-		}
-		if ch == '<' {
-			addToken(tokOperator, "<", line, col)
-			advance()
-			continue
-		}
-		if ch == '>' {
-			addToken(tokOperator, ">", line, col)
-			advance()
-			continue
-		}
-		if ch == '=' {
-			addToken(tokOperator, "=", line, col)
-			advance()
-			continue
-		}
+		case (ch == '!' || ch == '<' || ch == '>') && s.peekAt(1) == '=':
+			s.pos += 2
+			s.add(tokOperator, src[start:s.pos], start)
+
+		case ch == '<' || ch == '>' || ch == '=':
+			s.pos++
+			s.add(tokOperator, src[start:s.pos], start)
 
-		// Wildcards: ** and *
-		if ch == '*' {
-			startLine := line
-			startCol := col
-			advance()
-			if pos < len(runes) && peek() == '*' {
-				advance()
-				addToken(tokDoubleWildcard, "**", startLine, startCol)
+		case ch == '*':
+			if s.peekAt(1) == '*' {
+				s.pos += 2
+				s.add(tokDoubleWildcard, "**", start)
 			} else {
-				addToken(tokWildcard, "*", startLine, startCol)
+				s.pos++
+				s.add(tokWildcard, "*", start)
 			}
-			continue
-		}
 
-		// Numbers
-		if ch >= '0' && ch <= '9' {
-			startLine := line
-			startCol := col
-			var num strings.Builder
-			for pos < len(runes) && peek() >= '0' && peek() <= '9' {
-				num.WriteRune(advance())
-			}
-			// Check for decimal numbers
-			if pos < len(runes) && peek() == '.' {
-				num.WriteRune(advance())
-				for pos < len(runes) && peek() >= '0' && peek() <= '9' {
-					num.WriteRune(advance())
-				}
+		case ch >= '0' && ch <= '9':
+			s.pos = skipDigits(src, start)
+			if s.pos < len(src) && src[s.pos] == '.' {
+				s.pos = skipDigits(src, s.pos+1)
 			}
-			addToken(tokNumber, num.String(), startLine, startCol)
-			continue
-		}
+			s.add(tokNumber, src[start:s.pos], start)
 
-		// Identifiers and keywords
-		if isIdentStart(ch) {
-			startLine := line
-			startCol := col
-			var ident strings.Builder
-			for pos < len(runes) && isIdentPart(peek()) {
-				ident.WriteRune(advance())
-			}
-			word := ident.String()
-			lower := strings.ToLower(word)
+		case ch == '.':
+			s.pos++
+			s.add(tokDot, ".", start)
 
-			if kwType, ok := keywords[lower]; ok {
-				addToken(kwType, word, startLine, startCol)
-			} else if timeUnits[lower] {
-				addToken(tokTimeUnit, word, startLine, startCol)
-			} else {
-				addToken(tokIdentifier, word, startLine, startCol)
+		case ch == '/':
+			// Resource paths run to the next whitespace.
+			for s.pos < len(src) && !isWhitespace(rune(src[s.pos])) {
+				s.pos++
 			}
-			continue
-		}
-
-		// Dot
-		if ch == '.' {
-			addToken(tokDot, ".", line, col)
-			advance()
-			continue
-		}
+			s.add(tokString, validJSONString(src[start:s.pos]), start)
 
-		// Forward slash: collect as resource path
-		if ch == '/' {
-			startLine := line
-			startCol := col
-			var path strings.Builder
-			for pos < len(runes) && !isWhitespace(peek()) && peek() != '\n' {
-				path.WriteRune(advance())
+		default:
+			r, size := s.runeAt()
+			if !isIdentStart(r) {
+				// Unknown character: skip
+				s.pos += size
+				continue
 			}
-			addToken(tokString, path.String(), startLine, startCol)
-			continue
+			for s.pos < len(src) {
+				r, size := s.runeAt()
+				if !isIdentPart(r) {
+					break
+				}
+				s.pos += size
+			}
+			word := src[start:s.pos]
+			s.add(wordType(word), word, start)
 		}
-
-		// Unknown character: skip
-		advance()
 	}
+	s.add(tokEOF, "", len(src))
+}
 
-	addToken(tokEOF, "", line, col)
-	return tokens
+func skipDigits(src string, i int) int {
+	for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+		i++
+	}
+	return i
 }
 
 func isIdentStart(ch rune) bool {
@@ -354,12 +317,36 @@ func isWhitespace(ch rune) bool {
 // ----------------------------------------------------------------------------
 
 type parser struct {
+	src    string
 	tokens []token
 	pos    int
+	// lines holds the byte offsets at which the source's lines start.
+	// It is computed on the first syntax error.
+	lines []int
+	// parts holds the parts of the dotted name being parsed, which span
+	// partsStart to partsEnd in the source; see startParts.
+	parts                []string
+	partsStart, partsEnd int
+	partsContiguous      bool
 }
 
-func newParser(tokens []token) *parser {
-	return &parser{tokens: tokens, pos: 0}
+func newParser(src string, tokens []token) *parser {
+	return &parser{src: src, tokens: tokens, pos: 0}
+}
+
+// position returns the 1-based line and column, counted in runes, of a
+// byte offset in the source.
+func (p *parser) position(offset int) (line, column int) {
+	if p.lines == nil {
+		p.lines = []int{0}
+		for i := 0; i < len(p.src); i++ {
+			if p.src[i] == '\n' {
+				p.lines = append(p.lines, i+1)
+			}
+		}
+	}
+	line = sort.SearchInts(p.lines, offset+1)
+	return line, utf8.RuneCountInString(p.src[p.lines[line-1]:offset]) + 1
 }
 
 func (p *parser) current() token {
@@ -384,7 +371,7 @@ func (p *parser) check(t tokenType) bool {
 func (p *parser) expect(t tokenType, msg string) (token, error) {
 	tok := p.current()
 	if tok.typ != t {
-		return tok, fmt.Errorf("CCL parse error at line %d, col %d: %s, got '%s'", tok.line, tok.column, msg, tok.value)
+		return tok, p.syntaxError(tok, "%s, got '%s'", msg, tok.value)
 	}
 	return p.advance(), nil
 }
@@ -400,10 +387,47 @@ func (p *parser) skipNewlinesAndComments() {
 }
 
 // Parse parses a CCL source string into a CCLDocument.
+//
+// Parse reuses its token buffers across calls. Nothing it returns shares
+// them, so documents need no releasing.
 func Parse(source string) (*CCLDocument, error) {
-	tokens := tokenize(source)
-	p := newParser(tokens)
-	return p.parse()
+	st := parseStates.Get().(*parseState)
+	defer st.release()
+	st.scanner = scanner{src: source, tokens: st.scanner.tokens[:0]}
+	if need := len(source)/4 + 1; cap(st.scanner.tokens) < need {
+		st.scanner.tokens = make([]token, 0, need)
+	}
+	st.scan()
+	st.parser = parser{src: source, tokens: st.scanner.tokens, parts: st.parser.parts[:0]}
+	return st.parser.parse()
+}
+
+// maxPooledTokens bounds the token buffers kept for reuse, so one large
+// source does not pin its buffer.
+const maxPooledTokens = 1 << 14
+
+// parseState is the reusable state of a Parse call.
+type parseState struct {
+	scanner
+	parser
+}
+
+var parseStates = sync.Pool{
+	New: func() interface{} { return new(parseState) },
+}
+
+// release returns st to parseStates, dropping its references to the
+// source.
+func (st *parseState) release() {
+	tokens := st.scanner.tokens
+	if cap(tokens) > maxPooledTokens {
+		return
+	}
+	parts := st.parser.parts
+	clear(tokens)
+	clear(parts)
+	*st = parseState{scanner: scanner{tokens: tokens[:0]}, parser: parser{parts: parts[:0]}}
+	parseStates.Put(st)
 }
 
 func (p *parser) parse() (*CCLDocument, error) {
@@ -448,7 +472,7 @@ func (p *parser) parseStatement() (Statement, error) {
 	case tokLimitKw:
 		return p.parseLimitStmt()
 	default:
-		return Statement{}, fmt.Errorf("CCL parse error at line %d, col %d: expected statement keyword (permit, deny, require, limit), got '%s'", tok.line, tok.column, tok.value)
+		return Statement{}, p.syntaxError(tok, "expected statement keyword (permit, deny, require, limit), got '%s'", tok.value)
 	}
 }
 
@@ -537,11 +561,11 @@ func (p *parser) parseLimitStmt() (Statement, error) {
 	// Parse count
 	countTok := p.current()
 	if countTok.typ != tokNumber {
-		return Statement{}, fmt.Errorf("CCL parse error at line %d, col %d: expected count number after action in limit statement, got '%s'", countTok.line, countTok.column, countTok.value)
+		return Statement{}, p.syntaxError(countTok, "expected count number after action in limit statement, got '%s'", countTok.value)
 	}
 	count, err := strconv.ParseFloat(countTok.value, 64)
 	if err != nil {
-		return Statement{}, fmt.Errorf("CCL parse error: invalid count number '%s'", countTok.value)
+		return Statement{}, p.syntaxError(countTok, "invalid count number '%s'", countTok.value)
 	}
 	p.advance()
 
@@ -553,18 +577,18 @@ func (p *parser) parseLimitStmt() (Statement, error) {
 	// Parse period number
 	periodTok := p.current()
 	if periodTok.typ != tokNumber {
-		return Statement{}, fmt.Errorf("CCL parse error at line %d, col %d: expected period number after 'per', got '%s'", periodTok.line, periodTok.column, periodTok.value)
+		return Statement{}, p.syntaxError(periodTok, "expected period number after 'per', got '%s'", periodTok.value)
 	}
 	rawPeriod, err := strconv.ParseFloat(periodTok.value, 64)
 	if err != nil {
-		return Statement{}, fmt.Errorf("CCL parse error: invalid period number '%s'", periodTok.value)
+		return Statement{}, p.syntaxError(periodTok, "invalid period number '%s'", periodTok.value)
 	}
 	p.advance()
 
 	// Parse time unit
 	unitTok := p.current()
 	if unitTok.typ != tokTimeUnit {
-		return Statement{}, fmt.Errorf("CCL parse error at line %d, col %d: expected time unit (seconds, minutes, hours, days), got '%s'", unitTok.line, unitTok.column, unitTok.value)
+		return Statement{}, p.syntaxError(unitTok, "expected time unit (seconds, minutes, hours, days), got '%s'", unitTok.value)
 	}
 	timeUnit := unitTok.value
 	multiplier := timeUnitToMs(timeUnit)
@@ -605,36 +629,47 @@ func (p *parser) parseAction() (string, error) {
 		return "**", nil
 	}
 
-	var parts []string
-
-	if tok.typ == tokWildcard {
-		parts = append(parts, "*")
-		p.advance()
-	} else if tok.typ == tokIdentifier {
-		parts = append(parts, tok.value)
-		p.advance()
-	} else {
-		return "", fmt.Errorf("CCL parse error at line %d, col %d: expected action identifier, got '%s'", tok.line, tok.column, tok.value)
+	if tok.typ != tokWildcard && tok.typ != tokIdentifier {
+		return "", p.syntaxError(tok, "expected action identifier, got '%s'", tok.value)
 	}
+	p.startParts(p.advance())
 
 	for p.check(tokDot) {
-		p.advance() // consume dot
+		dot := p.advance() // consume dot
 		next := p.current()
-		if next.typ == tokIdentifier {
-			parts = append(parts, next.value)
-			p.advance()
-		} else if next.typ == tokWildcard {
-			parts = append(parts, "*")
-			p.advance()
-		} else if next.typ == tokDoubleWildcard {
-			parts = append(parts, "**")
-			p.advance()
-		} else {
-			return "", fmt.Errorf("CCL parse error at line %d, col %d: expected identifier or wildcard after dot, got '%s'", next.line, next.column, next.value)
+		switch next.typ {
+		case tokIdentifier, tokWildcard, tokDoubleWildcard:
+			p.addPart(dot, p.advance())
+		default:
+			return "", p.syntaxError(next, "expected identifier or wildcard after dot, got '%s'", next.value)
 		}
 	}
 
-	return strings.Join(parts, "."), nil
+	return p.joinParts(), nil
+}
+
+// startParts starts collecting the dot-separated parts of a name, such
+// as an action or a condition field, with tok.
+func (p *parser) startParts(tok token) {
+	p.parts = append(p.parts[:0], tok.value)
+	p.partsStart, p.partsEnd = tok.offset, tok.offset+len(tok.value)
+	p.partsContiguous = true
+}
+
+// addPart adds tok, which follows dot, to the parts of a name.
+func (p *parser) addPart(dot, tok token) {
+	p.parts = append(p.parts, tok.value)
+	p.partsContiguous = p.partsContiguous && dot.offset == p.partsEnd && tok.offset == dot.offset+1
+	p.partsEnd = tok.offset + len(tok.value)
+}
+
+// joinParts returns the name made of the collected parts. A name written
+// without spaces is a substring of the source, so it needs no copying.
+func (p *parser) joinParts() string {
+	if p.partsContiguous {
+		return p.src[p.partsStart:p.partsEnd]
+	}
+	return strings.Join(p.parts, ".")
 }
 
 func (p *parser) parseResource() (string, error) {
@@ -657,33 +692,32 @@ func (p *parser) parseResource() (string, error) {
 		return tok.value, nil
 	}
 
-	return "", fmt.Errorf("CCL parse error at line %d, col %d: expected resource, got '%s'", tok.line, tok.column, tok.value)
+	return "", p.syntaxError(tok, "expected resource, got '%s'", tok.value)
 }
 
 func (p *parser) parseCondition() (*Condition, error) {
 	// Parse field
 	fieldTok := p.current()
 	if fieldTok.typ != tokIdentifier {
-		return nil, fmt.Errorf("CCL parse error at line %d, col %d: expected field identifier in condition, got '%s'", fieldTok.line, fieldTok.column, fieldTok.value)
+		return nil, p.syntaxError(fieldTok, "expected field identifier in condition, got '%s'", fieldTok.value)
 	}
-	field := fieldTok.value
-	p.advance()
+	p.startParts(p.advance())
 
 	// Handle dotted field names
 	for p.check(tokDot) {
-		p.advance()
+		dot := p.advance()
 		next := p.current()
 		if next.typ != tokIdentifier {
-			return nil, fmt.Errorf("CCL parse error at line %d, col %d: expected identifier after dot in field, got '%s'", next.line, next.column, next.value)
+			return nil, p.syntaxError(next, "expected identifier after dot in field, got '%s'", next.value)
 		}
-		field += "." + next.value
-		p.advance()
+		p.addPart(dot, p.advance())
 	}
+	field := p.joinParts()
 
 	// Parse operator
 	opTok := p.current()
 	if opTok.typ != tokOperator {
-		return nil, fmt.Errorf("CCL parse error at line %d, col %d: expected operator, got '%s'", opTok.line, opTok.column, opTok.value)
+		return nil, p.syntaxError(opTok, "expected operator, got '%s'", opTok.value)
 	}
 	op := opTok.value
 	p.advance()
@@ -691,24 +725,28 @@ func (p *parser) parseCondition() (*Condition, error) {
 	// Parse value
 	valTok := p.current()
 	var value string
+	quoted := false
 	switch valTok.typ {
 	case tokString:
 		value = valTok.value
+		quoted = true
 		p.advance()
 	case tokNumber:
 		value = valTok.value
 		p.advance()
 	case tokIdentifier:
 		value = valTok.value
+		quoted = value != "true" && value != "false"
 		p.advance()
 	default:
-		return nil, fmt.Errorf("CCL parse error at line %d, col %d: expected value, got '%s'", valTok.line, valTok.column, valTok.value)
+		return nil, p.syntaxError(valTok, "expected value, got '%s'", valTok.value)
 	}
 
 	return &Condition{
 		Field:    field,
 		Operator: op,
 		Value:    value,
+		Quoted:   quoted,
 	}, nil
 }
 
@@ -737,44 +775,42 @@ func buildCCLDocument(statements []Statement) *CCLDocument {
 
 // MatchAction tests whether a concrete action matches a dot-separated pattern.
 // Wildcards: * matches one segment, ** matches zero or more segments.
+// The pattern is compiled once and cached; see CompilePattern.
 func MatchAction(pattern, action string) bool {
-	patternParts := strings.Split(pattern, ".")
-	actionParts := strings.Split(action, ".")
-	return matchSegments(patternParts, 0, actionParts, 0)
+	return matchAction(pattern, action, nil)
+}
+
+func matchAction(pattern, action string, b *evalBudget) bool {
+	return cachedPattern(pattern, ActionPattern).match(action, b)
 }
 
 // MatchResource tests whether a concrete resource matches a slash-separated pattern.
 // Leading and trailing slashes are normalized. Wildcards: * matches one segment,
-// ** matches zero or more segments.
+// ** matches zero or more segments. The pattern is compiled once and
+// cached; see CompilePattern.
 func MatchResource(pattern, resource string) bool {
-	normPattern := strings.Trim(pattern, "/")
-	normResource := strings.Trim(resource, "/")
-
-	if normPattern == "" && normResource == "" {
-		return true
-	}
-	if normPattern == "**" {
-		return true
-	}
-	if normPattern == "*" && !strings.Contains(normResource, "/") {
-		return true
-	}
+	return matchResource(pattern, resource, nil)
+}
 
-	patternParts := strings.Split(normPattern, "/")
-	resourceParts := strings.Split(normResource, "/")
-	return matchSegments(patternParts, 0, resourceParts, 0)
+func matchResource(pattern, resource string, b *evalBudget) bool {
+	return cachedPattern(pattern, ResourcePattern).match(resource, b)
 }
 
-func matchSegments(pattern []string, pi int, target []string, ti int) bool {
+// matchSegments matches target[ti:] against pattern[pi:]. depth is the
+// recursion depth, charged against b if it is not nil.
+func matchSegments(pattern []string, pi int, target []string, ti int, b *evalBudget, depth int) bool {
+	if b != nil && !b.step(depth) {
+		return false
+	}
 	for pi < len(pattern) && ti < len(target) {
 		p := pattern[pi]
 
 		if p == "**" {
 			// ** can match zero or more segments
-			if matchSegments(pattern, pi+1, target, ti) {
+			if matchSegments(pattern, pi+1, target, ti, b, depth+1) {
 				return true
 			}
-			return matchSegments(pattern, pi, target, ti+1)
+			return matchSegments(pattern, pi, target, ti+1, b, depth+1)
 		}
 
 		if p == "*" {
@@ -802,34 +838,7 @@ func matchSegments(pattern []string, pi int, target []string, ti int) bool {
 // specificity computes a specificity score for a pattern pair.
 // Literal segments score 2, * scores 1, ** scores 0.
 func specificity(actionPattern, resourcePattern string) int {
-	score := 0
-
-	for _, part := range strings.Split(actionPattern, ".") {
-		switch part {
-		case "**":
-			score += 0
-		case "*":
-			score += 1
-		default:
-			score += 2
-		}
-	}
-
-	normResource := strings.Trim(resourcePattern, "/")
-	if normResource != "" {
-		for _, part := range strings.Split(normResource, "/") {
-			switch part {
-			case "**":
-				score += 0
-			case "*":
-				score += 1
-			default:
-				score += 2
-			}
-		}
-	}
-
-	return score
+	return cachedPattern(actionPattern, ActionPattern).spec + cachedPattern(resourcePattern, ResourcePattern).spec
 }
 
 // evaluateCondition checks whether a simple condition is satisfied by the context.
@@ -848,9 +857,9 @@ func evaluateCondition(cond *Condition, context map[string]interface{}) bool {
 
 	switch op {
 	case "=":
-		return fmt.Sprintf("%v", fieldValue) == condVal
+		return conditionString(fieldValue) == condVal
 	case "!=":
-		return fmt.Sprintf("%v", fieldValue) != condVal
+		return conditionString(fieldValue) != condVal
 	case "<":
 		fv, fvOk := toFloat(fieldValue)
 		cv, cvOk := parseFloat(condVal)
@@ -873,10 +882,11 @@ func evaluateCondition(cond *Condition, context map[string]interface{}) bool {
 }
 
 func resolveField(context map[string]interface{}, field string) interface{} {
-	parts := strings.Split(field, ".")
 	var current interface{} = context
 
-	for _, part := range parts {
+	for more := true; more; {
+		var part string
+		part, field, more = strings.Cut(field, ".")
 		if current == nil {
 			return nil
 		}
@@ -890,6 +900,15 @@ func resolveField(context map[string]interface{}, field string) interface{} {
 	return current
 }
 
+// conditionString formats a context value for comparison with a
+// condition value, as fmt's %v verb does.
+func conditionString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
 func toFloat(v interface{}) (float64, bool) {
 	switch n := v.(type) {
 	case float64:
@@ -920,21 +939,61 @@ func parseFloat(s string) (float64, bool) {
 // When multiple rules match, specificity determines the winner, with deny
 // winning over permit at equal specificity.
 func Evaluate(doc *CCLDocument, action, resource string, context map[string]interface{}) *EvaluationResult {
-	if context == nil {
-		context = make(map[string]interface{})
+	result, _ := evaluate(doc, action, resource, context, nil)
+	return result
+}
+
+// evaluate implements Evaluate, charging its work against b if it is not
+// nil, and reports it to the installed Metrics. It fails only if b is
+// exhausted.
+func evaluate(doc *CCLDocument, action, resource string, context map[string]interface{}, b *evalBudget) (*EvaluationResult, error) {
+	m := currentMetrics()
+	if m == nil {
+		return evaluateStatements(doc, action, resource, context, b)
+	}
+	start := time.Now()
+	result, err := evaluateStatements(doc, action, resource, context, b)
+	outcome := EvaluationDenied
+	switch {
+	case err != nil:
+		outcome = EvaluationError
+	case result.Permitted:
+		outcome = EvaluationPermitted
+	}
+	m.ObserveEvaluation(outcome, time.Since(start))
+	return result, err
+}
+
+// matchedPD is a permit or deny statement matching an evaluation.
+type matchedPD struct {
+	stmt Statement
+	spec int
+}
+
+// matchBuffers holds the per-evaluation buffers of matched statements.
+var matchBuffers = sync.Pool{
+	New: func() interface{} { return new([]matchedPD) },
+}
+
+// evaluateStatements matches the action against doc's statements.
+func evaluateStatements(doc *CCLDocument, action, resource string, context map[string]interface{}, b *evalBudget) (*EvaluationResult, error) {
+	if err := b.start(doc, context); err != nil {
+		return nil, err
 	}
 
 	var allMatches []Statement
 
-	type matchedPD struct {
-		stmt Statement
-		spec int
-	}
-	var matchedPermitDeny []matchedPD
+	buf := matchBuffers.Get().(*[]matchedPD)
+	matchedPermitDeny := (*buf)[:0]
+	defer func() {
+		clear(matchedPermitDeny)
+		*buf = matchedPermitDeny[:0]
+		matchBuffers.Put(buf)
+	}()
 
 	// Check permits
 	for _, stmt := range doc.Permits {
-		if MatchAction(stmt.Action, action) && MatchResource(stmt.Resource, resource) {
+		if matchAction(stmt.Action, action, b) && matchResource(stmt.Resource, resource, b) {
 			if evaluateCondition(stmt.Condition, context) {
 				matchedPermitDeny = append(matchedPermitDeny, matchedPD{stmt: stmt, spec: specificity(stmt.Action, stmt.Resource)})
 				allMatches = append(allMatches, stmt)
@@ -944,7 +1003,7 @@ func Evaluate(doc *CCLDocument, action, resource string, context map[string]inte
 
 	// Check denies
 	for _, stmt := range doc.Denies {
-		if MatchAction(stmt.Action, action) && MatchResource(stmt.Resource, resource) {
+		if matchAction(stmt.Action, action, b) && matchResource(stmt.Resource, resource, b) {
 			if evaluateCondition(stmt.Condition, context) {
 				matchedPermitDeny = append(matchedPermitDeny, matchedPD{stmt: stmt, spec: specificity(stmt.Action, stmt.Resource)})
 				allMatches = append(allMatches, stmt)
@@ -954,20 +1013,24 @@ func Evaluate(doc *CCLDocument, action, resource string, context map[string]inte
 
 	// Check obligations (they contribute to allMatches but not to permit/deny decisions)
 	for _, stmt := range doc.Obligations {
-		if MatchAction(stmt.Action, action) && MatchResource(stmt.Resource, resource) {
+		if matchAction(stmt.Action, action, b) && matchResource(stmt.Resource, resource, b) {
 			if evaluateCondition(stmt.Condition, context) {
 				allMatches = append(allMatches, stmt)
 			}
 		}
 	}
 
+	if err := b.exhausted(); err != nil {
+		return nil, err
+	}
+
 	// No matching permit/deny: default deny
 	if len(matchedPermitDeny) == 0 {
 		return &EvaluationResult{
 			Permitted:  false,
 			AllMatches: allMatches,
 			Reason:     "No matching rules found; default deny",
-		}
+		}, nil
 	}
 
 	// Sort by specificity descending; at equal specificity, deny wins
@@ -996,7 +1059,7 @@ func Evaluate(doc *CCLDocument, action, resource string, context map[string]inte
 		MatchedRule: &winner,
 		AllMatches:  allMatches,
 		Reason:      fmt.Sprintf("Matched %s rule for %s on %s", winner.Type, winner.Action, winner.Resource),
-	}
+	}, nil
 }
 
 // CheckRateLimit checks whether an action has exceeded its rate limit.
@@ -1248,13 +1311,13 @@ func serializeStatement(stmt Statement) string {
 	case StatementPermit, StatementDeny:
 		line := fmt.Sprintf("%s %s on '%s'", stmt.Type, stmt.Action, stmt.Resource)
 		if stmt.Condition != nil {
-			line += fmt.Sprintf(" when %s %s %s", stmt.Condition.Field, stmt.Condition.Operator, stmt.Condition.Value)
+			line += " when " + serializeCondition(stmt.Condition)
 		}
 		return line
 	case StatementRequire:
 		line := fmt.Sprintf("require %s on '%s'", stmt.Action, stmt.Resource)
 		if stmt.Condition != nil {
-			line += fmt.Sprintf(" when %s %s %s", stmt.Condition.Field, stmt.Condition.Operator, stmt.Condition.Value)
+			line += " when " + serializeCondition(stmt.Condition)
 		}
 		return line
 	case StatementLimit:
@@ -1265,6 +1328,13 @@ func serializeStatement(stmt Statement) string {
 	}
 }
 
+func serializeCondition(cond *Condition) string {
+	if cond.Quoted {
+		return fmt.Sprintf("%s %s '%s'", cond.Field, cond.Operator, cond.Value)
+	}
+	return fmt.Sprintf("%s %s %s", cond.Field, cond.Operator, cond.Value)
+}
+
 func bestTimeUnit(periodMs float64) (float64, string) {
 	const msPerDay = 86_400_000
 	const msPerHour = 3_600_000
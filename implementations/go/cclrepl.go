@@ -0,0 +1,446 @@
+package grith
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// CCLREPLOptions configure NewCCLREPL.
+type CCLREPLOptions struct {
+	// Policy is the CCL source to start with; it may be empty and
+	// loaded later with :load or :add.
+	Policy string
+	// Context is the session context, merged under the context given
+	// with each evaluation.
+	Context map[string]interface{}
+	// Now returns the current time for rate-limit windows. Defaults to
+	// time.Now; :advance moves the session clock ahead of it.
+	Now func() time.Time
+	// ReadFile reads policy files for :load. Defaults to os.ReadFile.
+	ReadFile func(name string) ([]byte, error)
+}
+
+// CCLREPL is an interactive playground for CCL policies. Each input line
+// is either a command, starting with a colon, or an evaluation:
+//
+//	ACTION [RESOURCE] [KEY=VALUE ...]
+//
+// An evaluation prints the decision, a trace of how each statement of
+// the policy did or did not match, and the state of the rate limit on
+// the action. Permitted evaluations count against the limit, so repeated
+// evaluations show it being exhausted. Values are JSON literals, or
+// strings if they do not parse as one; dotted keys set nested fields, as
+// in user.role=admin. Run :help for the commands. A CCLREPL is not safe
+// for concurrent use.
+type CCLREPL struct {
+	doc      *CCLDocument
+	context  map[string]interface{}
+	windows  map[string]*replWindow
+	now      func() time.Time
+	offset   time.Duration
+	readFile func(string) ([]byte, error)
+}
+
+// replWindow is the rate-limit window of a limit statement.
+type replWindow struct {
+	start time.Time
+	count int
+}
+
+// NewCCLREPL creates a REPL for the policy in opts, which may be nil.
+func NewCCLREPL(opts *CCLREPLOptions) (*CCLREPL, error) {
+	if opts == nil {
+		opts = &CCLREPLOptions{}
+	}
+	r := &CCLREPL{
+		doc:      &CCLDocument{},
+		context:  make(map[string]interface{}),
+		windows:  make(map[string]*replWindow),
+		now:      opts.Now,
+		readFile: opts.ReadFile,
+	}
+	if r.now == nil {
+		r.now = time.Now
+	}
+	if r.readFile == nil {
+		r.readFile = os.ReadFile
+	}
+	for k, v := range opts.Context {
+		r.context[k] = v
+	}
+	if strings.TrimSpace(opts.Policy) != "" {
+		doc, err := Parse(opts.Policy)
+		if err != nil {
+			return nil, err
+		}
+		r.doc = doc
+	}
+	return r, nil
+}
+
+// Policy returns the current policy.
+func (r *CCLREPL) Policy() *CCLDocument {
+	return r.doc
+}
+
+// Run reads lines from in until it ends or a line is :quit, writing a
+// prompt before each and the output of each to out. Errors in lines are
+// written to out and do not stop the session.
+func (r *CCLREPL) Run(in io.Reader, out io.Writer) error {
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "ccl> ")
+		if !sc.Scan() {
+			fmt.Fprintln(out)
+			return sc.Err()
+		}
+		line := strings.TrimSpace(sc.Text())
+		if line == ":quit" || line == ":q" {
+			return nil
+		}
+		if err := r.Exec(line, out); err != nil {
+			fmt.Fprintf(out, "error: %s\n", strings.TrimPrefix(err.Error(), "grith: "))
+		}
+	}
+}
+
+// Exec runs one line of input, writing its output to out.
+func (r *CCLREPL) Exec(line string, out io.Writer) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	if !strings.HasPrefix(line, ":") {
+		return r.evaluate(line, out)
+	}
+	cmd, arg, _ := strings.Cut(line[1:], " ")
+	arg = strings.TrimSpace(arg)
+	switch cmd {
+	case "help", "h", "?":
+		fmt.Fprint(out, cclREPLHelp)
+	case "policy", "p":
+		if len(r.doc.Statements) == 0 {
+			fmt.Fprintln(out, "(empty policy: every action is denied)")
+			return nil
+		}
+		for i, stmt := range r.doc.Statements {
+			fmt.Fprintf(out, "%3d  %s\n", i+1, serializeStatement(stmt))
+		}
+	case "load":
+		if arg == "" {
+			return errorf(ErrCodeInvalidInput, "grith: usage: :load FILE")
+		}
+		data, err := r.readFile(arg)
+		if err != nil {
+			return errorf(ErrCodeStorage, "grith: failed to read policy: %w", err)
+		}
+		return r.setPolicy(string(data), out)
+	case "add":
+		if arg == "" {
+			return errorf(ErrCodeInvalidInput, "grith: usage: :add STATEMENT")
+		}
+		return r.setPolicy(Serialize(r.doc)+"\n"+arg, out)
+	case "clear":
+		r.doc = &CCLDocument{}
+		r.windows = make(map[string]*replWindow)
+		fmt.Fprintln(out, "policy cleared")
+	case "set":
+		pairs, rest, err := splitREPLArgs(arg)
+		if err != nil {
+			return err
+		}
+		if len(rest) > 0 || len(pairs) == 0 {
+			return errorf(ErrCodeInvalidInput, "grith: usage: :set KEY=VALUE ...")
+		}
+		for _, p := range pairs {
+			setContextPath(r.context, p[0], parseREPLValue(p[1]))
+		}
+	case "unset":
+		if arg == "" {
+			return errorf(ErrCodeInvalidInput, "grith: usage: :unset KEY ...")
+		}
+		for _, key := range strings.Fields(arg) {
+			deleteContextPath(r.context, key)
+		}
+	case "context", "c":
+		data, err := json.MarshalIndent(r.context, "", "  ")
+		if err != nil {
+			return errorf(ErrCodeSerialization, "grith: failed to print context: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+	case "limits", "l":
+		r.writeLimits(out)
+	case "reset":
+		r.windows = make(map[string]*replWindow)
+		fmt.Fprintln(out, "rate limits reset")
+	case "advance":
+		d, err := time.ParseDuration(arg)
+		if err != nil || d < 0 {
+			return errorf(ErrCodeInvalidInput, "grith: usage: :advance DURATION, as in :advance 90s")
+		}
+		r.offset += d
+		fmt.Fprintf(out, "clock advanced %s\n", d)
+	default:
+		return errorf(ErrCodeInvalidInput, "grith: unknown command :%s; run :help for the commands", cmd)
+	}
+	return nil
+}
+
+const cclREPLHelp = `Evaluate:
+  ACTION [RESOURCE] [KEY=VALUE ...]   evaluate an action, as in: read /data/a user.role="admin"
+Commands:
+  :policy              print the policy
+  :load FILE           replace the policy with the CCL in FILE
+  :add STATEMENT       add a statement to the policy
+  :clear               remove every statement
+  :set KEY=VALUE ...   set session context values
+  :unset KEY ...       remove session context values
+  :context             print the session context
+  :limits              print the rate-limit state
+  :reset               reset the rate-limit state
+  :advance DURATION    move the clock ahead, as in :advance 1h
+  :quit                leave
+`
+
+// setPolicy replaces the policy with source, keeping the rate-limit
+// state of limits that remain.
+func (r *CCLREPL) setPolicy(source string, out io.Writer) error {
+	doc, err := Parse(source)
+	if err != nil {
+		return err
+	}
+	r.doc = doc
+	kept := make(map[string]*replWindow)
+	for _, limit := range doc.Limits {
+		key := serializeStatement(limit)
+		if w := r.windows[key]; w != nil {
+			kept[key] = w
+		}
+	}
+	r.windows = kept
+	fmt.Fprintf(out, "policy has %d statements\n", len(doc.Statements))
+	return nil
+}
+
+func (r *CCLREPL) clock() time.Time {
+	return r.now().Add(r.offset)
+}
+
+// evaluate evaluates an ACTION [RESOURCE] [KEY=VALUE ...] line.
+func (r *CCLREPL) evaluate(line string, out io.Writer) error {
+	pairs, words, err := splitREPLArgs(line)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 || len(words) > 2 {
+		return errorf(ErrCodeInvalidInput, "grith: expected ACTION [RESOURCE] [KEY=VALUE ...]")
+	}
+	action, resource := words[0], ""
+	if len(words) == 2 {
+		resource = words[1]
+	}
+	ctx := cloneJSONObject(r.context)
+	for _, p := range pairs {
+		setContextPath(ctx, p[0], parseREPLValue(p[1]))
+	}
+
+	result := Evaluate(r.doc, action, resource, ctx)
+	permitted := result.Permitted
+	reason := result.Reason
+	limit, window := r.limitFor(action)
+	now := r.clock()
+	if limit != nil {
+		if window == nil || float64(now.Sub(window.start).Milliseconds()) > limit.Period {
+			window = &replWindow{start: now}
+			r.windows[serializeStatement(*limit)] = window
+		}
+		if permitted {
+			rl := CheckRateLimit(r.doc, action, window.count, window.start.UnixMilli(), now.UnixMilli())
+			if rl.Exceeded {
+				permitted = false
+				reason = fmt.Sprintf("Rate limit of %d exceeded", rl.Limit)
+			} else {
+				window.count++
+			}
+		}
+	}
+
+	decision := "DENIED"
+	if permitted {
+		decision = "PERMITTED"
+	}
+	fmt.Fprintf(out, "%s  %s\n", decision, reason)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, stmt := range r.doc.Statements {
+		fmt.Fprintf(tw, "  %s\t%s\n", serializeStatement(stmt), traceStatement(stmt, action, resource, ctx, result))
+	}
+	tw.Flush()
+	if limit != nil {
+		fmt.Fprintf(out, "  rate limit: %s\n", describeWindow(limit, window, now))
+	}
+	return nil
+}
+
+// traceStatement explains how stmt matched an evaluation.
+func traceStatement(stmt Statement, action, resource string, ctx map[string]interface{}, result *EvaluationResult) string {
+	if stmt.Type == StatementLimit {
+		if MatchAction(stmt.Action, action) || MatchAction(stmt.Metric, action) {
+			return "limit applies to the action"
+		}
+		return "-"
+	}
+	switch {
+	case !MatchAction(stmt.Action, action):
+		return "action does not match"
+	case !MatchResource(stmt.Resource, resource):
+		return "resource does not match"
+	case !evaluateCondition(stmt.Condition, ctx):
+		c := stmt.Condition
+		got := resolveField(ctx, c.Field)
+		if got == nil {
+			return fmt.Sprintf("condition not met: %s is not set", c.Field)
+		}
+		return fmt.Sprintf("condition not met: %s is %v", c.Field, got)
+	}
+	if stmt.Type == StatementRequire {
+		return "MATCH (obligation)"
+	}
+	if m := result.MatchedRule; m != nil && serializeStatement(*m) == serializeStatement(stmt) {
+		return fmt.Sprintf("MATCH, decides (specificity %d)", specificity(stmt.Action, stmt.Resource))
+	}
+	return fmt.Sprintf("MATCH, outranked (specificity %d)", specificity(stmt.Action, stmt.Resource))
+}
+
+// limitFor returns the limit statement CheckRateLimit would apply to
+// action, and its window.
+func (r *CCLREPL) limitFor(action string) (*Statement, *replWindow) {
+	var matched *Statement
+	best := -1
+	for i := range r.doc.Limits {
+		limit := &r.doc.Limits[i]
+		if MatchAction(limit.Action, action) || MatchAction(limit.Metric, action) {
+			if spec := specificity(limit.Action, ""); spec > best {
+				best, matched = spec, limit
+			}
+		}
+	}
+	if matched == nil {
+		return nil, nil
+	}
+	return matched, r.windows[serializeStatement(*matched)]
+}
+
+func describeWindow(limit *Statement, w *replWindow, now time.Time) string {
+	if w == nil || float64(now.Sub(w.start).Milliseconds()) > limit.Period {
+		return fmt.Sprintf("0/%.0f used (%s)", limit.Limit, serializeStatement(*limit))
+	}
+	resets := w.start.Add(time.Duration(limit.Period) * time.Millisecond).Sub(now).Round(time.Second)
+	return fmt.Sprintf("%d/%.0f used, window resets in %s (%s)", w.count, limit.Limit, resets, serializeStatement(*limit))
+}
+
+func (r *CCLREPL) writeLimits(out io.Writer) {
+	if len(r.doc.Limits) == 0 {
+		fmt.Fprintln(out, "no limit statements")
+		return
+	}
+	now := r.clock()
+	for i := range r.doc.Limits {
+		limit := &r.doc.Limits[i]
+		fmt.Fprintf(out, "  %s\n", describeWindow(limit, r.windows[serializeStatement(*limit)], now))
+	}
+}
+
+// splitREPLArgs splits a line into words and KEY=VALUE pairs. Words and
+// values may be quoted with single or double quotes; double-quoted values
+// keep their quotes, so they parse as JSON strings.
+func splitREPLArgs(line string) (pairs [][2]string, words []string, err error) {
+	var tokens []string
+	var cur strings.Builder
+	var quote byte
+	inToken := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+				if c == '"' {
+					cur.WriteByte(c)
+				}
+			} else {
+				cur.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inToken = c, true
+			if c == '"' {
+				cur.WriteByte(c)
+			}
+		case c == ' ' || c == '\t':
+			if inToken {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+				inToken = false
+			}
+		default:
+			cur.WriteByte(c)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, nil, errorf(ErrCodeInvalidInput, "grith: unterminated %c quote", quote)
+	}
+	if inToken {
+		tokens = append(tokens, cur.String())
+	}
+	for _, tok := range tokens {
+		if key, value, ok := strings.Cut(tok, "="); ok && key != "" && !strings.HasPrefix(key, `"`) {
+			pairs = append(pairs, [2]string{key, value})
+		} else {
+			words = append(words, strings.Trim(tok, `"`))
+		}
+	}
+	return pairs, words, nil
+}
+
+// parseREPLValue parses a value as a JSON literal, or returns it as a
+// string.
+func parseREPLValue(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err == nil {
+		return v
+	}
+	return s
+}
+
+// setContextPath sets the dotted path key in ctx, creating nested maps.
+func setContextPath(ctx map[string]interface{}, key string, value interface{}) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := ctx[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			ctx[part] = next
+		}
+		ctx = next
+	}
+	ctx[parts[len(parts)-1]] = value
+}
+
+// deleteContextPath removes the dotted path key from ctx.
+func deleteContextPath(ctx map[string]interface{}, key string) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := ctx[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		ctx = next
+	}
+	delete(ctx, parts[len(parts)-1])
+}
@@ -0,0 +1,119 @@
+package grith
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// CheckFunc is a custom verification check. It receives the document and
+// the options verification was called with (never nil) and returns the
+// check outcome. Name and Code may be left empty; they are filled in from
+// the registration.
+type CheckFunc func(doc *CovenantDocument, opts *VerifyOptions) VerificationCheck
+
+type registeredCheck struct {
+	name string
+	fn   CheckFunc
+}
+
+var (
+	checksMu     sync.RWMutex
+	customChecks []registeredCheck
+)
+
+// builtinCheckNames are reserved and cannot be registered.
+var builtinCheckNames = map[string]bool{
+	"id_match": true, "signature_valid": true, "not_expired": true,
+	"active": true, "ccl_parses": true, "enforcement_valid": true,
+	"proof_valid": true, "chain_depth": true, "document_size": true,
+	"countersignatures": true, "nonce_present": true, "nonce_unique": true,
+	"did_binding": true, "extensions": true, "metadata_schema": true,
+	"transparency": true, "anchored": true, "version_supported": true,
+	"not_revoked": true, "issuer_identity": true,
+}
+
+// RegisterCheck adds a custom check that runs, in registration order,
+// after all built-in checks of every subsequent verification. A failing
+// check invalidates the document unless it sets a warning or info
+// Severity.
+//
+// Names must be lowercase snake_case and unique. The check's code, if
+// not set by fn, is CHECK_ followed by the upper-cased name. A check
+// that panics is reported as failed.
+func RegisterCheck(name string, fn CheckFunc) error {
+	if fn == nil {
+		return errorf(ErrCodeMissingField, "grith: check %q requires a function", name)
+	}
+	if !isCheckName(name) {
+		return errorf(ErrCodeInvalidInput, "grith: invalid check name %q: must be lowercase snake_case", name)
+	}
+	if builtinCheckNames[name] {
+		return errorf(ErrCodeInvalidInput, "grith: check name %q is reserved for a built-in check", name)
+	}
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	for _, c := range customChecks {
+		if c.name == name {
+			return errorf(ErrCodeInvalidInput, "grith: check %q is already registered", name)
+		}
+	}
+	customChecks = append(customChecks, registeredCheck{name: name, fn: fn})
+	return nil
+}
+
+// UnregisterCheck removes a custom check. It reports whether the check
+// was registered.
+func UnregisterCheck(name string) bool {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	for i, c := range customChecks {
+		if c.name == name {
+			customChecks = append(customChecks[:i:i], customChecks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// runCustomChecks runs every registered check against doc that the
+// profile does not skip.
+func runCustomChecks(doc *CovenantDocument, opts *VerifyOptions, profile *VerificationProfile) []VerificationCheck {
+	checksMu.RLock()
+	registered := append([]registeredCheck(nil), customChecks...)
+	checksMu.RUnlock()
+
+	var out []VerificationCheck
+	for _, c := range registered {
+		if profile.skips(c.name) {
+			continue
+		}
+		out = append(out, runCustomCheck(c, doc, opts))
+	}
+	return out
+}
+
+func runCustomCheck(c registeredCheck, doc *CovenantDocument, opts *VerifyOptions) (check VerificationCheck) {
+	defer func() {
+		if r := recover(); r != nil {
+			check = VerificationCheck{Message: fmt.Sprintf("Check panicked: %v", r)}
+		}
+		check.Name = c.name
+		if check.Code == "" {
+			check.Code = CheckCode("CHECK_" + strings.ToUpper(c.name))
+		}
+	}()
+	return c.fn(doc, opts)
+}
+
+func isCheckName(name string) bool {
+	if name == "" || name[0] == '_' || name[len(name)-1] == '_' {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
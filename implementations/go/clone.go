@@ -0,0 +1,130 @@
+package grith
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// Clone returns a deep copy of the document, sharing no mutable state
+// with it. Metadata and extension values of the types JSON decodes to are
+// copied directly; any other value is copied through a JSON round trip,
+// as the document would be when stored, and is shared if it cannot be
+// serialized.
+func (doc *CovenantDocument) Clone() *CovenantDocument {
+	if doc == nil {
+		return nil
+	}
+	c := *doc
+	if doc.ConstraintsRef != nil {
+		ref := *doc.ConstraintsRef
+		c.ConstraintsRef = &ref
+	}
+	if doc.Chain != nil {
+		chain := *doc.Chain
+		c.Chain = &chain
+	}
+	c.Metadata = cloneJSONObject(doc.Metadata)
+	c.MetadataSchema = cloneJSONObject(doc.MetadataSchema)
+	if doc.Extensions != nil {
+		c.Extensions = make(map[string]Extension, len(doc.Extensions))
+		for name, ext := range doc.Extensions {
+			c.Extensions[name] = ext.Clone()
+		}
+	}
+	c.Countersignatures = slices.Clone(doc.Countersignatures)
+	if doc.Transparency != nil {
+		c.Transparency = make([]TransparencyReceipt, len(doc.Transparency))
+		for i := range doc.Transparency {
+			c.Transparency[i] = doc.Transparency[i].Clone()
+		}
+	}
+	if doc.Anchors != nil {
+		c.Anchors = make([]AnchorProof, len(doc.Anchors))
+		for i := range doc.Anchors {
+			c.Anchors[i] = doc.Anchors[i].Clone()
+		}
+	}
+	return &c
+}
+
+// Clone returns a deep copy of the extension. See CovenantDocument.Clone.
+func (e Extension) Clone() Extension {
+	e.Value = cloneJSONValue(e.Value)
+	return e
+}
+
+// Clone returns a deep copy of the receipt.
+func (r TransparencyReceipt) Clone() TransparencyReceipt {
+	if r.Proof != nil {
+		r.Proof = r.Proof.Clone()
+	}
+	if r.TreeHead != nil {
+		head := *r.TreeHead
+		r.TreeHead = &head
+	}
+	return r
+}
+
+// Clone returns a deep copy of the proof.
+func (p *InclusionProof) Clone() *InclusionProof {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	c.Hashes = slices.Clone(p.Hashes)
+	return &c
+}
+
+// Clone returns a deep copy of the anchor proof.
+func (p AnchorProof) Clone() AnchorProof {
+	p.Batch = p.Batch.Clone()
+	return p
+}
+
+// Clone returns a deep copy of the batch proof.
+func (p *BatchProof) Clone() *BatchProof {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	c.Hashes = slices.Clone(p.Hashes)
+	return &c
+}
+
+func cloneJSONObject(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = cloneJSONValue(v)
+	}
+	return c
+}
+
+// cloneJSONValue deep-copies a value held in an interface{} field.
+func cloneJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, bool, float64, string, json.Number,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32:
+		return v
+	case map[string]interface{}:
+		return cloneJSONObject(v)
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = cloneJSONValue(e)
+		}
+		return c
+	case []string:
+		return slices.Clone(v)
+	}
+	c, err := jsonValue(v)
+	if err != nil {
+		return v
+	}
+	return c
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	grith "github.com/agbusiness195/grith/implementations/go"
+)
+
+// cclStatement is the JSON form of a CCL statement.
+type cclStatement struct {
+	Type      grith.StatementType `json:"type"`
+	Rule      string              `json:"rule"`
+	Action    string              `json:"action"`
+	Resource  string              `json:"resource,omitempty"`
+	Condition *cclCondition       `json:"condition,omitempty"`
+	Limit     float64             `json:"limit,omitempty"`
+	PeriodMs  float64             `json:"periodMs,omitempty"`
+}
+
+type cclCondition struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+func toCCLStatement(stmt grith.Statement) cclStatement {
+	out := cclStatement{Type: stmt.Type, Rule: rule(stmt), Action: stmt.Action, Resource: stmt.Resource}
+	if stmt.Condition != nil {
+		out.Condition = &cclCondition{Field: stmt.Condition.Field, Operator: stmt.Condition.Operator, Value: stmt.Condition.Value}
+	}
+	if stmt.Type == grith.StatementLimit {
+		out.Limit, out.PeriodMs = stmt.Limit, stmt.Period
+	}
+	return out
+}
+
+// rule returns the CCL source of a statement.
+func rule(stmt grith.Statement) string {
+	return grith.Serialize(&grith.CCLDocument{Statements: []grith.Statement{stmt}})
+}
+
+// loadCCL reads CCL source or, if the file holds a JSON object, the
+// constraints of a covenant.
+func (c *cli) loadCCL(name string) (*grith.CCLDocument, error) {
+	data, err := c.read(name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		doc, err := grith.DeserializeCovenant(string(data))
+		if err != nil {
+			return nil, err
+		}
+		return grith.ParseCovenantConstraints(doc, nil)
+	}
+	return grith.Parse(string(data))
+}
+
+func cmdCCLParse(c *cli, args []string) error {
+	fs := c.flags("ccl parse", "[file]")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	doc, err := c.loadCCL(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	out := struct {
+		Statements []cclStatement `json:"statements"`
+	}{Statements: []cclStatement{}}
+	for _, stmt := range doc.Statements {
+		out.Statements = append(out.Statements, toCCLStatement(stmt))
+	}
+	return c.writeJSON("", out)
+}
+
+// lintFinding is a problem found by ccl lint.
+type lintFinding struct {
+	Severity string `json:"severity"`
+	Rule     string `json:"rule,omitempty"`
+	Message  string `json:"message"`
+}
+
+// lintCCL reports likely mistakes in a parsed CCL document.
+func lintCCL(doc *grith.CCLDocument) []lintFinding {
+	var findings []lintFinding
+	warn := func(stmt grith.Statement, format string, args ...interface{}) {
+		findings = append(findings, lintFinding{Severity: "warning", Rule: rule(stmt), Message: fmt.Sprintf(format, args...)})
+	}
+	if len(doc.Statements) > grith.MaxConstraints {
+		findings = append(findings, lintFinding{Severity: "error", Message: fmt.Sprintf("%d statements exceed the maximum of %d per covenant", len(doc.Statements), grith.MaxConstraints)})
+	}
+
+	seen := make(map[string]bool)
+	for _, stmt := range doc.Statements {
+		r := rule(stmt)
+		if seen[r] {
+			warn(stmt, "duplicate statement")
+		}
+		seen[r] = true
+		for _, p := range []struct{ pattern, sep string }{{stmt.Action, "."}, {strings.Trim(stmt.Resource, "/"), "/"}} {
+			wildcards := strings.Count(p.sep+p.pattern+p.sep, p.sep+"**"+p.sep)
+			switch {
+			case strings.Contains(p.pattern, "**"+p.sep+"**"):
+				warn(stmt, "consecutive ** segments in %q are redundant", p.pattern)
+			case wildcards > 2:
+				warn(stmt, "%d ** segments in %q make matching expensive", wildcards, p.pattern)
+			}
+		}
+	}
+
+	for _, permit := range doc.Permits {
+		for _, deny := range doc.Denies {
+			if deny.Condition == nil && deny.Action == permit.Action && deny.Resource == permit.Resource {
+				warn(permit, "never applies: %s takes precedence", rule(deny))
+			}
+		}
+	}
+	permitted := func(action string) bool {
+		for _, permit := range doc.Permits {
+			if grith.MatchAction(permit.Action, action) || grith.MatchAction(action, permit.Action) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, limit := range doc.Limits {
+		if !permitted(limit.Action) {
+			warn(limit, "limits an action no statement permits")
+		}
+	}
+	for _, ob := range doc.Obligations {
+		if !permitted(ob.Action) {
+			warn(ob, "can never be fulfilled: no statement permits %s", ob.Action)
+		}
+	}
+	if len(doc.Permits) == 0 {
+		findings = append(findings, lintFinding{Severity: "warning", Message: "no permit statements: every action is denied"})
+	}
+	return findings
+}
+
+func cmdCCLLint(c *cli, args []string) error {
+	fs := c.flags("ccl lint", "[file]")
+	asJSON := fs.Bool("json", false, "print the findings as JSON")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	findings := []lintFinding{}
+	doc, err := c.loadCCL(fs.Arg(0))
+	if err != nil {
+		findings = append(findings, lintFinding{Severity: "error", Message: strings.TrimPrefix(err.Error(), "grith: ")})
+	} else {
+		findings = append(findings, lintCCL(doc)...)
+	}
+	if *asJSON {
+		if err := c.writeJSON("", findings); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			if f.Rule != "" {
+				fmt.Fprintf(c.stdout, "%s: %s: %s\n", f.Severity, f.Rule, f.Message)
+			} else {
+				fmt.Fprintf(c.stdout, "%s: %s\n", f.Severity, f.Message)
+			}
+		}
+	}
+	for _, f := range findings {
+		if f.Severity == "error" {
+			return errInvalid
+		}
+	}
+	return nil
+}
+
+func cmdCCLEval(c *cli, args []string) error {
+	fs := c.flags("ccl eval", "[file]")
+	action := fs.String("action", "", "`action` to evaluate")
+	resource := fs.String("resource", "", "`resource` the action is on")
+	evalContext := fs.String("context", "", "evaluation context as a JSON `object`")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	if *action == "" {
+		return c.missing(fs, "action")
+	}
+	var ctx map[string]interface{}
+	if *evalContext != "" {
+		if err := json.Unmarshal([]byte(*evalContext), &ctx); err != nil {
+			return fmt.Errorf("invalid -context: %w", err)
+		}
+	}
+	doc, err := c.loadCCL(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	result := grith.Evaluate(doc, *action, *resource, ctx)
+	out := struct {
+		Permitted   bool           `json:"permitted"`
+		Reason      string         `json:"reason"`
+		MatchedRule string         `json:"matchedRule,omitempty"`
+		Matches     []cclStatement `json:"matches"`
+	}{Permitted: result.Permitted, Reason: result.Reason, Matches: []cclStatement{}}
+	if result.MatchedRule != nil {
+		out.MatchedRule = rule(*result.MatchedRule)
+	}
+	for _, stmt := range result.AllMatches {
+		out.Matches = append(out.Matches, toCCLStatement(stmt))
+	}
+	return c.writeJSON("", out)
+}
+
+func cmdCCLRepl(c *cli, args []string) error {
+	fs := c.flags("ccl repl", "[file]")
+	evalContext := fs.String("context", "", "session context as a JSON `object`")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	opts := &grith.CCLREPLOptions{}
+	if *evalContext != "" {
+		if err := json.Unmarshal([]byte(*evalContext), &opts.Context); err != nil {
+			return fmt.Errorf("invalid -context: %w", err)
+		}
+	}
+	// Standard input carries the session, so the policy must be a file.
+	if name := fs.Arg(0); name != "" && name != "-" {
+		doc, err := c.loadCCL(name)
+		if err != nil {
+			return err
+		}
+		opts.Policy = grith.Serialize(doc)
+	}
+	repl, err := grith.NewCCLREPL(opts)
+	if err != nil {
+		return err
+	}
+	return repl.Run(c.stdin, c.stdout)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	grith "github.com/agbusiness195/grith/implementations/go"
+)
+
+func cmdCovenantBuild(c *cli, args []string) error {
+	fs := c.flags("covenant build", "")
+	key := fs.String("key", "", "issuer key `file`")
+	issuer := fs.String("issuer", "", "issuer `id`")
+	beneficiary := fs.String("beneficiary", "", "beneficiary `id`")
+	beneficiaryKey := fs.String("beneficiary-key", "", "beneficiary hex public key, or key `file`")
+	constraints := fs.String("constraints", "", "CCL constraints")
+	constraintsFile := fs.String("constraints-file", "", "read the CCL constraints from `file`")
+	parent := fs.String("parent", "", "delegate from the parent covenant in `file`")
+	relation := fs.String("relation", "delegates", "`relation` to the parent covenant")
+	activates := fs.String("activates", "", "activation `time` (RFC 3339)")
+	expires := fs.String("expires", "", "expiry `time` (RFC 3339)")
+	grace := fs.Duration("grace", 0, "grace `period` after expiry")
+	out := fs.String("o", "", "write the covenant to `file` instead of standard output")
+	if err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *key == "" || *issuer == "" || *beneficiary == "" || *beneficiaryKey == "" {
+		return c.missing(fs, "key", "issuer", "beneficiary", "beneficiary-key")
+	}
+	if (*constraints == "") == (*constraintsFile == "") {
+		fmt.Fprintln(c.stderr, "grith covenant build: exactly one of -constraints and -constraints-file is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	kp, err := c.loadKeyPair(*key)
+	if err != nil {
+		return err
+	}
+	benKey, err := c.publicKey(*beneficiaryKey)
+	if err != nil {
+		return err
+	}
+	source := *constraints
+	if *constraintsFile != "" {
+		data, err := c.read(*constraintsFile)
+		if err != nil {
+			return err
+		}
+		source = string(data)
+	}
+	opts := &grith.CovenantBuilderOptions{
+		Issuer:      grith.Party{ID: *issuer, PublicKey: kp.PublicKeyHex, Role: "issuer"},
+		Beneficiary: grith.Party{ID: *beneficiary, PublicKey: benKey, Role: "beneficiary"},
+		Constraints: source,
+		PrivateKey:  kp.PrivateKey,
+		GracePeriod: *grace,
+	}
+	if opts.ActivatesAt, err = timestampFlag("activates", *activates); err != nil {
+		return err
+	}
+	if opts.ExpiresAt, err = timestampFlag("expires", *expires); err != nil {
+		return err
+	}
+	if *parent != "" {
+		p, err := c.loadCovenant(*parent)
+		if err != nil {
+			return err
+		}
+		depth := 1
+		if p.Chain != nil {
+			depth = p.Chain.Depth + 1
+		}
+		opts.Chain = &grith.ChainReference{ParentID: p.ID, Relation: *relation, Depth: depth}
+	}
+	doc, err := grith.BuildCovenant(opts)
+	if err != nil {
+		return err
+	}
+	return c.writeCovenant(*out, doc)
+}
+
+// timestampFlag converts an RFC 3339 time flag to a protocol timestamp.
+func timestampFlag(name, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", fmt.Errorf("invalid -%s time: %w", name, err)
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.000Z"), nil
+}
+
+func cmdCovenantVerify(c *cli, args []string) error {
+	fs := c.flags("covenant verify", "[file]")
+	asJSON := fs.Bool("json", false, "print the verification result as JSON")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	doc, err := c.loadCovenant(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	result, err := grith.VerifyCovenant(doc)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if err := c.writeJSON("", result); err != nil {
+			return err
+		}
+	} else {
+		c.printChecks(result.Valid, result.Checks, result.Warnings)
+	}
+	if !result.Valid {
+		return errInvalid
+	}
+	return nil
+}
+
+func cmdCovenantCountersign(c *cli, args []string) error {
+	fs := c.flags("covenant countersign", "[file]")
+	key := fs.String("key", "", "countersigner key `file`")
+	role := fs.String("role", "auditor", "countersigner `role`")
+	out := fs.String("o", "", "write the covenant to `file` instead of standard output")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	if *key == "" {
+		return c.missing(fs, "key")
+	}
+	kp, err := c.loadKeyPair(*key)
+	if err != nil {
+		return err
+	}
+	doc, err := c.loadCovenant(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	signed, err := grith.CountersignCovenant(doc, kp, *role)
+	if err != nil {
+		return err
+	}
+	return c.writeCovenant(*out, signed)
+}
+
+func cmdCovenantInspect(c *cli, args []string) error {
+	fs := c.flags("covenant inspect", "[file]")
+	asJSON := fs.Bool("json", false, "print the summary as JSON")
+	format := fs.String("format", "", "print the structured inspection as `text`, json, or yaml instead of the summary")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	doc, err := c.loadCovenant(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *format != "" {
+		out, err := grith.Inspect(doc).Render(grith.InspectionFormat(*format))
+		if err != nil {
+			return err
+		}
+		_, err = c.stdout.Write(out)
+		return err
+	}
+	s := grith.Summarize(doc)
+	if *asJSON {
+		return c.writeJSON("", s)
+	}
+	fmt.Fprintf(c.stdout, "Covenant %s\n%s\n", doc.ID, s.Headline)
+	for _, section := range []struct {
+		title string
+		lines []string
+	}{
+		{"Parties", s.Parties},
+		{"Validity", s.Validity},
+		{"Permits", s.Permits},
+		{"Denies", s.Denies},
+		{"Limits", s.Limits},
+		{"Obligations", s.Obligations},
+		{"Notes", s.Notes},
+	} {
+		if len(section.lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(c.stdout, "\n%s:\n  %s\n", section.title, strings.Join(section.lines, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	grith "github.com/agbusiness195/grith/implementations/go"
+)
+
+// capabilitiesFlag parses a comma-separated capability list; nil if the
+// flag is empty.
+func capabilitiesFlag(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var caps []string
+	for _, c := range strings.Split(value, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+// modelFlags registers the flags of a model attestation.
+func modelFlags(fs *flag.FlagSet) (provider, id, version *string) {
+	provider = fs.String("model-provider", "", "model `provider`")
+	id = fs.String("model-id", "", "model `id`")
+	version = fs.String("model-version", "", "model `version`")
+	return provider, id, version
+}
+
+func cmdIdentityCreate(c *cli, args []string) error {
+	fs := c.flags("identity create", "")
+	key := fs.String("key", "", "operator key `file`")
+	operator := fs.String("operator", "", "operator `identifier`")
+	provider, modelID, modelVersion := modelFlags(fs)
+	capabilities := fs.String("capabilities", "", "comma-separated `capabilities`")
+	runtime := fs.String("runtime", string(grith.RuntimeProcess), "deployment `runtime`")
+	region := fs.String("region", "", "deployment `region`")
+	out := fs.String("o", "", "write the identity to `file` instead of standard output")
+	if err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *key == "" || *provider == "" || *modelID == "" {
+		return c.missing(fs, "key", "model-provider", "model-id")
+	}
+	kp, err := c.loadKeyPair(*key)
+	if err != nil {
+		return err
+	}
+	identity, err := grith.CreateIdentity(&grith.CreateIdentityOptions{
+		OperatorKeyPair:    kp,
+		OperatorIdentifier: *operator,
+		Model:              grith.ModelAttestation{Provider: *provider, ModelID: *modelID, ModelVersion: *modelVersion},
+		Capabilities:       capabilitiesFlag(*capabilities),
+		Deployment:         grith.DeploymentContext{Runtime: grith.RuntimeType(*runtime), Region: *region},
+	})
+	if err != nil {
+		return err
+	}
+	return c.writeJSON(*out, identity)
+}
+
+func cmdIdentityEvolve(c *cli, args []string) error {
+	fs := c.flags("identity evolve", "[file]")
+	key := fs.String("key", "", "operator key `file`")
+	changeType := fs.String("change-type", "", "change `type`, e.g. model_update or capability_expansion")
+	description := fs.String("description", "", "`description` of the change")
+	provider, modelID, modelVersion := modelFlags(fs)
+	capabilities := fs.String("capabilities", "", "new comma-separated `capabilities`")
+	out := fs.String("o", "", "write the identity to `file` instead of standard output")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	if *key == "" || *description == "" {
+		return c.missing(fs, "key", "description")
+	}
+	kp, err := c.loadKeyPair(*key)
+	if err != nil {
+		return err
+	}
+	current, err := c.loadIdentity(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	opts := &grith.EvolveIdentityOptions{
+		OperatorKeyPair: kp,
+		ChangeType:      *changeType,
+		Description:     *description,
+		Capabilities:    capabilitiesFlag(*capabilities),
+	}
+	if *provider != "" || *modelID != "" || *modelVersion != "" {
+		model := current.Model
+		if *provider != "" {
+			model.Provider = *provider
+		}
+		if *modelID != "" {
+			model.ModelID = *modelID
+		}
+		if *modelVersion != "" {
+			model.ModelVersion = *modelVersion
+		}
+		opts.Model = &model
+	}
+	evolved, err := grith.EvolveIdentity(current, opts)
+	if err != nil {
+		return err
+	}
+	return c.writeJSON(*out, evolved)
+}
+
+func cmdIdentityVerify(c *cli, args []string) error {
+	fs := c.flags("identity verify", "[file]")
+	asJSON := fs.Bool("json", false, "print the verification result as JSON")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	identity, err := c.loadIdentity(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	result, err := grith.VerifyIdentity(identity)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if err := c.writeJSON("", result); err != nil {
+			return err
+		}
+	} else {
+		c.printChecks(result.Valid, result.Checks, nil)
+	}
+	if !result.Valid {
+		return errInvalid
+	}
+	return nil
+}
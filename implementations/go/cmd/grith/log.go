@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	grith "github.com/agbusiness195/grith/implementations/go"
+)
+
+// logFlags registers the flags shared by the log commands.
+func logFlags(fs *flag.FlagSet) (covenant, publicKey *string) {
+	covenant = fs.String("covenant", "", "`file` of the covenant the log was kept under")
+	publicKey = fs.String("public-key", "", "agent hex public `key`; defaults to the covenant beneficiary's")
+	return covenant, publicKey
+}
+
+// readLog reads and verifies an action log, either JSON Lines as kept by
+// a FileLog or a JSON array as written by ActionLog.Export, calling fn
+// with every verified entry.
+func (c *cli) readLog(name string, doc *grith.CovenantDocument, publicKey string, fn func(grith.ActionLogEntry) error) (*grith.JSONLReadResult, error) {
+	if publicKey == "" {
+		publicKey = doc.Beneficiary.PublicKey
+	}
+	key, err := grith.FromHex(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid agent public key %q", publicKey)
+	}
+	data, err := c.read(name)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		entries, err := grith.ParseActionLog(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		var lines bytes.Buffer
+		enc := json.NewEncoder(&lines)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return nil, err
+			}
+		}
+		data = lines.Bytes()
+	}
+	return grith.ReadJSONL(bytes.NewReader(data), &grith.ReadJSONLOptions{PublicKey: ed25519.PublicKey(key), CovenantID: doc.ID}, fn)
+}
+
+func cmdLogVerify(c *cli, args []string) error {
+	fs := c.flags("log verify", "[log]")
+	covenant, publicKey := logFlags(fs)
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	if *covenant == "" {
+		return c.missing(fs, "covenant")
+	}
+	doc, err := c.loadCovenant(*covenant)
+	if err != nil {
+		return err
+	}
+	result, err := c.readLog(fs.Arg(0), doc, *publicKey, nil)
+	if err != nil {
+		return err
+	}
+	return c.writeJSON("", result)
+}
+
+func cmdLogReplay(c *cli, args []string) error {
+	fs := c.flags("log replay", "[log]")
+	covenant, publicKey := logFlags(fs)
+	window := fs.Duration("window", 0, "obligation `window`; without it, fulfilment at any later point suffices")
+	contexts := fs.String("contexts", "", "`file` holding a JSON array of the logged actions' evaluation contexts")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	if *covenant == "" {
+		return c.missing(fs, "covenant")
+	}
+	doc, err := c.loadCovenant(*covenant)
+	if err != nil {
+		return err
+	}
+	opts := &grith.ReplayOptions{ObligationWindow: *window}
+	if *contexts != "" {
+		if err := c.readJSON(*contexts, &opts.Contexts); err != nil {
+			return err
+		}
+	}
+	var entries []grith.ActionLogEntry
+	if _, err := c.readLog(fs.Arg(0), doc, *publicKey, func(e grith.ActionLogEntry) error {
+		entries = append(entries, e)
+		return nil
+	}); err != nil {
+		return err
+	}
+	report := grith.ReplayComplianceWithOptions(doc, entries, opts)
+	if err := c.writeJSON("", report); err != nil {
+		return err
+	}
+	if !report.Compliant {
+		return errInvalid
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+// Command grith builds, verifies, and inspects Grith covenants, CCL
+// constraints, agent identities, action logs, and covenant stores from the
+// command line. It reads and writes the JSON formats of the grith package,
+// so its output can be consumed by any implementation.
+//
+// Usage:
+//
+//	grith keygen [-o key.json]
+//	grith covenant build|verify|countersign|inspect [flags] [file]
+//	grith ccl parse|lint|eval|repl [flags] [file]
+//	grith identity create|evolve|verify [flags] [file]
+//	grith log verify|replay -covenant file [flags] [log]
+//	grith store import|export -dir dir [flags] [file]
+//	grith version
+//
+// Files default to standard input and output. Flags must precede
+// arguments; run a command with -h for its flags. Key files hold a JSON
+// object with hex publicKey and privateKey fields, as written by keygen.
+//
+// The exit status is 0 on success, 1 if the command fails or what it
+// verifies is invalid, and 2 on a usage error.
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	grith "github.com/agbusiness195/grith/implementations/go"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// cli holds the standard streams of one invocation.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is a command or subcommand: either run or subcommands is set.
+type command struct {
+	summary     string
+	run         func(c *cli, args []string) error
+	subcommands map[string]*command
+}
+
+var commands = map[string]*command{
+	"keygen": {summary: "generate an Ed25519 key pair", run: cmdKeygen},
+	"covenant": {summary: "build, verify, countersign, and inspect covenants", subcommands: map[string]*command{
+		"build":       {summary: "build and sign a covenant", run: cmdCovenantBuild},
+		"verify":      {summary: "verify a covenant", run: cmdCovenantVerify},
+		"countersign": {summary: "add a countersignature to a covenant", run: cmdCovenantCountersign},
+		"inspect":     {summary: "describe a covenant in plain English", run: cmdCovenantInspect},
+	}},
+	"ccl": {summary: "parse, lint, and evaluate CCL", subcommands: map[string]*command{
+		"parse": {summary: "parse CCL into JSON statements", run: cmdCCLParse},
+		"lint":  {summary: "report errors and likely mistakes in CCL", run: cmdCCLLint},
+		"eval":  {summary: "evaluate an action against CCL or a covenant", run: cmdCCLEval},
+		"repl":  {summary: "evaluate actions interactively against CCL", run: cmdCCLRepl},
+	}},
+	"identity": {summary: "create, evolve, and verify agent identities", subcommands: map[string]*command{
+		"create": {summary: "create an agent identity", run: cmdIdentityCreate},
+		"evolve": {summary: "evolve an agent identity", run: cmdIdentityEvolve},
+		"verify": {summary: "verify an agent identity", run: cmdIdentityVerify},
+	}},
+	"log": {summary: "verify and replay action logs", subcommands: map[string]*command{
+		"verify": {summary: "verify an action log's integrity", run: cmdLogVerify},
+		"replay": {summary: "replay an action log against its covenant", run: cmdLogReplay},
+	}},
+	"store": {summary: "import and export covenant stores", subcommands: map[string]*command{
+		"import": {summary: "import a snapshot into a file store", run: cmdStoreImport},
+		"export": {summary: "export a file store as a snapshot", run: cmdStoreExport},
+	}},
+	"version": {summary: "print the protocol version", run: cmdVersion},
+}
+
+// errUsage is a usage error; the usage has already been printed.
+var errUsage = errors.New("usage")
+
+// errInvalid reports that the verified input is invalid; the result has
+// already been printed.
+var errInvalid = errors.New("invalid")
+
+// run runs the command line args and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+	cmds, path := commands, "grith"
+	for {
+		if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			c.usage(path, cmds)
+			if len(args) == 0 {
+				return 2
+			}
+			return 0
+		}
+		cmd, ok := cmds[args[0]]
+		if !ok {
+			fmt.Fprintf(stderr, "%s: unknown command %q\n", path, args[0])
+			c.usage(path, cmds)
+			return 2
+		}
+		path += " " + args[0]
+		args = args[1:]
+		if cmd.run == nil {
+			cmds = cmd.subcommands
+			continue
+		}
+		err := cmd.run(c, args)
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		case errors.Is(err, errInvalid):
+			return 1
+		default:
+			fmt.Fprintf(stderr, "%s: %s\n", path, strings.TrimPrefix(err.Error(), "grith: "))
+			return 1
+		}
+	}
+}
+
+// usage lists the commands under path.
+func (c *cli) usage(path string, cmds map[string]*command) {
+	fmt.Fprintf(c.stderr, "usage: %s <command> [flags] [args]\n\ncommands:\n", path)
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(c.stderr, "  %-12s %s\n", name, cmds[name].summary)
+	}
+}
+
+// flags returns a flag set for the command name that writes its usage,
+// including the arguments described by usage, to stderr.
+func (c *cli) flags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: %s\n", strings.TrimSpace("grith "+name+" [flags] "+usage))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses args with fs and checks that at most max arguments remain.
+func (c *cli) parse(fs *flag.FlagSet, args []string, max int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() > max {
+		fmt.Fprintf(c.stderr, "grith %s: too many arguments\n", fs.Name())
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// missing reports that the named flags are required.
+func (c *cli) missing(fs *flag.FlagSet, names ...string) error {
+	switch len(names) {
+	case 1:
+		fmt.Fprintf(c.stderr, "grith %s: -%s is required\n", fs.Name(), names[0])
+	case 2:
+		fmt.Fprintf(c.stderr, "grith %s: -%s and -%s are required\n", fs.Name(), names[0], names[1])
+	default:
+		fmt.Fprintf(c.stderr, "grith %s: -%s, and -%s are required\n", fs.Name(), strings.Join(names[:len(names)-1], ", -"), names[len(names)-1])
+	}
+	fs.Usage()
+	return errUsage
+}
+
+// read reads the file name, or standard input if name is "" or "-".
+func (c *cli) read(name string) ([]byte, error) {
+	if name == "" || name == "-" {
+		return io.ReadAll(c.stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// open opens the file name, or standard input if name is "" or "-".
+func (c *cli) open(name string) (io.ReadCloser, error) {
+	if name == "" || name == "-" {
+		return io.NopCloser(c.stdin), nil
+	}
+	return os.Open(name)
+}
+
+// write writes data to the file name, or standard output if name is "" or
+// "-".
+func (c *cli) write(name string, data []byte) error {
+	if name == "" || name == "-" {
+		_, err := c.stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(name, data, 0o644)
+}
+
+// writeJSON writes v as indented JSON to the file name, or standard output.
+func (c *cli) writeJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return c.write(name, append(data, '\n'))
+}
+
+// readJSON decodes the JSON file name, or standard input, into v.
+func (c *cli) readJSON(name string, v interface{}) error {
+	data, err := c.read(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: invalid JSON: %w", displayName(name), err)
+	}
+	return nil
+}
+
+func displayName(name string) string {
+	if name == "" || name == "-" {
+		return "standard input"
+	}
+	return name
+}
+
+// keyFile is the JSON form of a key pair.
+type keyFile struct {
+	PublicKey  string `json:"publicKey"`
+	PrivateKey string `json:"privateKey,omitempty"`
+}
+
+// loadKeyPair reads a key file. The private key may be a 32-byte seed or
+// a 64-byte Ed25519 private key.
+func (c *cli) loadKeyPair(name string) (*grith.KeyPair, error) {
+	var kf keyFile
+	if err := c.readJSON(name, &kf); err != nil {
+		return nil, err
+	}
+	priv, err := grith.FromHex(kf.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid private key: %w", name, err)
+	}
+	switch len(priv) {
+	case ed25519.SeedSize:
+		priv = ed25519.NewKeyFromSeed(priv)
+	case ed25519.PrivateKeySize:
+	default:
+		return nil, fmt.Errorf("%s: private key must be %d or %d bytes", name, ed25519.SeedSize, ed25519.PrivateKeySize)
+	}
+	kp, err := grith.KeyPairFromPrivateKey(ed25519.PrivateKey(priv))
+	if err != nil {
+		return nil, err
+	}
+	if kf.PublicKey != "" && !strings.EqualFold(kf.PublicKey, kp.PublicKeyHex) {
+		return nil, fmt.Errorf("%s: public key does not match private key", name)
+	}
+	return kp, nil
+}
+
+// publicKey returns the hex public key given directly or in a key file.
+func (c *cli) publicKey(keyOrFile string) (string, error) {
+	if b, err := grith.FromHex(keyOrFile); err == nil && len(b) == ed25519.PublicKeySize {
+		return strings.ToLower(keyOrFile), nil
+	}
+	var kf keyFile
+	if err := c.readJSON(keyOrFile, &kf); err != nil {
+		return "", err
+	}
+	if b, err := grith.FromHex(kf.PublicKey); err != nil || len(b) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("%s: invalid public key", keyOrFile)
+	}
+	return strings.ToLower(kf.PublicKey), nil
+}
+
+// loadCovenant reads a covenant document.
+func (c *cli) loadCovenant(name string) (*grith.CovenantDocument, error) {
+	f, err := c.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return grith.ReadCovenant(f)
+}
+
+// loadIdentity reads an agent identity.
+func (c *cli) loadIdentity(name string) (*grith.AgentIdentity, error) {
+	f, err := c.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return grith.ReadIdentity(f)
+}
+
+// writeCovenant writes a covenant document in its serialized form.
+func (c *cli) writeCovenant(name string, doc *grith.CovenantDocument) error {
+	out, err := grith.SerializeCovenant(doc)
+	if err != nil {
+		return err
+	}
+	return c.write(name, []byte(out+"\n"))
+}
+
+// printChecks prints verification checks, one per line.
+func (c *cli) printChecks(valid bool, checks, warnings []grith.VerificationCheck) {
+	for _, check := range checks {
+		status := "ok  "
+		if !check.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(c.stdout, "%s %s: %s\n", status, check.Name, check.Message)
+	}
+	for _, check := range warnings {
+		fmt.Fprintf(c.stdout, "warn %s: %s\n", check.Name, check.Message)
+	}
+	if valid {
+		fmt.Fprintln(c.stdout, "valid")
+	} else {
+		fmt.Fprintln(c.stdout, "INVALID")
+	}
+}
+
+func cmdKeygen(c *cli, args []string) error {
+	fs := c.flags("keygen", "")
+	out := fs.String("o", "", "write the key pair to `file` instead of standard output")
+	if err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	kp, err := grith.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(keyFile{PublicKey: kp.PublicKeyHex, PrivateKey: grith.ToHex(kp.PrivateKey)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *out == "" || *out == "-" {
+		return c.write("", data)
+	}
+	// The key file holds the private key.
+	return os.WriteFile(*out, data, 0o600)
+}
+
+func cmdVersion(c *cli, args []string) error {
+	fs := c.flags("version", "")
+	if err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "grith protocol %s\n", grith.ProtocolVersion)
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	grith "github.com/agbusiness195/grith/implementations/go"
+)
+
+// runCLI runs the command line args with stdin and returns its output and
+// exit status.
+func runCLI(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func TestCLI(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	mustRun := func(stdin string, args ...string) string {
+		t.Helper()
+		stdout, stderr, code := runCLI(t, stdin, args...)
+		if code != 0 {
+			t.Fatalf("grith %s: exit %d: %s", strings.Join(args, " "), code, stderr)
+		}
+		return stdout
+	}
+
+	if _, _, code := runCLI(t, ""); code != 2 {
+		t.Errorf("no command: exit %d, want 2", code)
+	}
+	if _, stderr, code := runCLI(t, "", "covenant", "sign"); code != 2 || !strings.Contains(stderr, `unknown command "sign"`) {
+		t.Errorf("unknown subcommand: exit %d: %s", code, stderr)
+	}
+	if _, stderr, code := runCLI(t, "", "covenant", "build", "-issuer", "alice"); code != 2 || !strings.Contains(stderr, "are required") {
+		t.Errorf("missing flags: exit %d: %s", code, stderr)
+	}
+
+	mustRun("", "keygen", "-o", path("alice.json"))
+	mustRun("", "keygen", "-o", path("agent.json"))
+	if info, err := os.Stat(path("alice.json")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, %v", info.Mode(), err)
+	}
+	var agentKey keyFile
+	data, _ := os.ReadFile(path("agent.json"))
+	if err := json.Unmarshal(data, &agentKey); err != nil || len(agentKey.PublicKey) != 64 || len(agentKey.PrivateKey) != 128 {
+		t.Fatalf("key file = %s", data)
+	}
+
+	// Covenants.
+	mustRun("", "covenant", "build", "-key", path("alice.json"), "-issuer", "alice",
+		"-beneficiary", "agent", "-beneficiary-key", agentKey.PublicKey,
+		"-constraints", "permit read on '/data/**'\npermit audit.log on '/data/**'\nrequire audit.log on '/data/secret/**'",
+		"-o", path("covenant.json"))
+	if out := mustRun("", "covenant", "verify", path("covenant.json")); !strings.HasSuffix(out, "valid\n") {
+		t.Errorf("verify output = %q", out)
+	}
+	doc, err := grith.DeserializeCovenant(readFile(t, path("covenant.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(readFile(t, path("covenant.json")), "/data/", "/", 1)
+	if out, _, code := runCLI(t, tampered, "covenant", "verify", "-json"); code != 1 || !strings.Contains(out, `"valid": false`) {
+		t.Errorf("tampered covenant: exit %d: %s", code, out)
+	}
+	signed := mustRun("", "covenant", "countersign", "-key", path("agent.json"), "-role", "beneficiary", path("covenant.json"))
+	if countersigned, err := grith.DeserializeCovenant(signed); err != nil || len(countersigned.Countersignatures) != 1 {
+		t.Errorf("countersigned covenant: %v", err)
+	}
+	var summary grith.CovenantSummary
+	if err := json.Unmarshal([]byte(mustRun(signed, "covenant", "inspect", "-json")), &summary); err != nil || len(summary.Permits) != 2 {
+		t.Errorf("inspect -json = %+v, %v", summary, err)
+	}
+	var inspection grith.Inspection
+	if err := json.Unmarshal([]byte(mustRun(signed, "covenant", "inspect", "-format", "json")), &inspection); err != nil || len(inspection.Countersignatures) != 1 || !inspection.Countersignatures[0].Valid {
+		t.Errorf("inspect -format json = %+v, %v", inspection, err)
+	}
+	if out := mustRun(signed, "covenant", "inspect", "-format", "yaml"); !strings.Contains(out, "    valid: true\n") {
+		t.Errorf("inspect -format yaml = %s", out)
+	}
+	if _, _, code := runCLI(t, signed, "covenant", "inspect", "-format", "xml"); code != 1 {
+		t.Errorf("inspect -format xml: exit %d", code)
+	}
+	mustRun("", "covenant", "build", "-key", path("alice.json"), "-issuer", "alice",
+		"-beneficiary", "agent", "-beneficiary-key", path("agent.json"),
+		"-constraints", "permit read on '/data/public/**'", "-parent", path("covenant.json"), "-o", path("child.json"))
+	if child, err := grith.DeserializeCovenant(readFile(t, path("child.json"))); err != nil || child.Chain == nil || child.Chain.ParentID != doc.ID || child.Chain.Depth != 1 {
+		t.Errorf("child covenant chain: %v", err)
+	}
+
+	// CCL.
+	var parsed struct{ Statements []cclStatement }
+	if err := json.Unmarshal([]byte(mustRun("limit read 10 per 1 minutes", "ccl", "parse")), &parsed); err != nil || len(parsed.Statements) != 1 || parsed.Statements[0].Limit != 10 || parsed.Statements[0].PeriodMs != 60000 {
+		t.Errorf("ccl parse = %+v, %v", parsed, err)
+	}
+	if out := mustRun("", "ccl", "lint", path("covenant.json")); out != "" {
+		t.Errorf("lint of a clean covenant = %q", out)
+	}
+	out, _, code := runCLI(t, "permit read on '/a/**/**'\npermit read on '/a/**/**'\ndeny read on '/a/**/**'\nrequire notify on '/a'", "ccl", "lint")
+	if code != 0 || strings.Count(out, "warning:") != 7 || !strings.Contains(out, "duplicate statement") || !strings.Contains(out, "never applies") || !strings.Contains(out, "can never be fulfilled") {
+		t.Errorf("lint warnings: exit %d:\n%s", code, out)
+	}
+	if out, _, code := runCLI(t, "permit read", "ccl", "lint"); code != 1 || !strings.HasPrefix(out, "error: ") {
+		t.Errorf("lint of invalid CCL: exit %d: %s", code, out)
+	}
+	var eval struct {
+		Permitted   bool
+		MatchedRule string
+	}
+	if err := json.Unmarshal([]byte(mustRun("", "ccl", "eval", "-action", "read", "-resource", "/data/x", path("covenant.json"))), &eval); err != nil || !eval.Permitted || eval.MatchedRule != "permit read on '/data/**'" {
+		t.Errorf("ccl eval = %+v, %v", eval, err)
+	}
+	if err := json.Unmarshal([]byte(mustRun("permit read on '/**' when risk < 3", "ccl", "eval", "-action", "read", "-resource", "/x", "-context", `{"risk": 5}`)), &eval); err != nil || eval.Permitted {
+		t.Errorf("ccl eval with context = %+v, %v", eval, err)
+	}
+	if out := mustRun("read /data/x\nread /data/x risk=5\n:quit\n", "ccl", "repl", "-context", `{"risk": 1}`, path("covenant.json")); !strings.Contains(out, "ccl> PERMITTED") || strings.Count(out, "PERMITTED") != 2 {
+		t.Errorf("ccl repl = %q", out)
+	}
+
+	// Identities.
+	mustRun("", "identity", "create", "-key", path("alice.json"), "-operator", "alice", "-model-provider", "acme", "-model-id", "m1", "-capabilities", "read, audit.log", "-o", path("identity.json"))
+	evolved := mustRun("", "identity", "evolve", "-key", path("alice.json"), "-change-type", "model_update", "-description", "upgrade", "-model-version", "2", path("identity.json"))
+	var identity grith.AgentIdentity
+	if err := json.Unmarshal([]byte(evolved), &identity); err != nil || identity.Version != 2 || identity.Model.ModelVersion != "2" || identity.Model.ModelID != "m1" || len(identity.Capabilities) != 2 {
+		t.Errorf("evolved identity = %+v, %v", identity, err)
+	}
+	mustRun(evolved, "identity", "verify")
+	if _, _, code := runCLI(t, strings.Replace(evolved, `"m1"`, `"m2"`, 1), "identity", "verify"); code != 1 {
+		t.Errorf("tampered identity: exit %d, want 1", code)
+	}
+
+	// Action logs, in both formats.
+	agent, err := (&cli{}).loadKeyPair(path("agent.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := grith.NewActionLog(&grith.ActionLogOptions{Covenant: doc, Agent: agent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Append("read", "/data/secret/a", nil, grith.OutcomeExecuted)
+	exported, err := log.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result grith.JSONLReadResult
+	if err := json.Unmarshal([]byte(mustRun(string(exported), "log", "verify", "-covenant", path("covenant.json"))), &result); err != nil || result.Entries != 1 {
+		t.Errorf("log verify = %+v, %v", result, err)
+	}
+	if out, _, code := runCLI(t, string(exported), "log", "replay", "-covenant", path("covenant.json")); code != 1 || !strings.Contains(out, `"compliant": false`) {
+		t.Errorf("replay with an unfulfilled obligation: exit %d: %s", code, out)
+	}
+	log.Append("audit.log", "/data/secret/a", nil, grith.OutcomeExecuted)
+	var lines bytes.Buffer
+	for _, e := range log.Entries() {
+		json.NewEncoder(&lines).Encode(e)
+	}
+	mustRun(lines.String(), "log", "replay", "-covenant", path("covenant.json"))
+	forged := strings.Replace(lines.String(), "/data/secret/a", "/data/secret/b", 1)
+	if _, stderr, code := runCLI(t, forged, "log", "verify", "-covenant", path("covenant.json")); code != 1 || stderr == "" {
+		t.Errorf("forged log: exit %d", code)
+	}
+
+	// Stores.
+	store, err := grith.OpenFileStore(path("store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put(doc.ID, doc)
+	mustRun("", "store", "export", "-dir", path("store"), "-key", path("alice.json"), "-o", path("snapshot.json"))
+	alice, _ := (&cli{}).loadKeyPair(path("alice.json"))
+	if out := mustRun("", "store", "import", "-dir", path("copy"), "-signer", alice.PublicKeyHex, path("snapshot.json")); out != "imported 1 documents\n" {
+		t.Errorf("store import = %q", out)
+	}
+	if copied, err := grith.OpenFileStore(path("copy")); err != nil {
+		t.Fatal(err)
+	} else if got, err := copied.Get(doc.ID); err != nil || got == nil {
+		t.Errorf("imported document missing: %v", err)
+	}
+	if _, _, code := runCLI(t, "", "store", "import", "-dir", path("copy"), "-signer", agentKey.PublicKey, path("snapshot.json")); code != 1 {
+		t.Errorf("import with the wrong signer: exit %d, want 1", code)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	grith "github.com/agbusiness195/grith/implementations/go"
+)
+
+func cmdStoreExport(c *cli, args []string) error {
+	fs := c.flags("store export", "")
+	dir := fs.String("dir", "", "file store `directory`")
+	key := fs.String("key", "", "sign the snapshot manifest with the key in `file`")
+	out := fs.String("o", "", "write the snapshot to `file` instead of standard output")
+	if err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return c.missing(fs, "dir")
+	}
+	store, err := grith.OpenFileStore(*dir)
+	if err != nil {
+		return err
+	}
+	opts := &grith.ExportSnapshotOptions{}
+	if *key != "" {
+		if opts.KeyPair, err = c.loadKeyPair(*key); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	manifest, err := grith.ExportSnapshot(&buf, store, opts)
+	if err != nil {
+		return err
+	}
+	if err := c.write(*out, buf.Bytes()); err != nil {
+		return err
+	}
+	if *out != "" && *out != "-" {
+		fmt.Fprintf(c.stdout, "exported %d documents\n", len(manifest.Documents))
+	}
+	return nil
+}
+
+func cmdStoreImport(c *cli, args []string) error {
+	fs := c.flags("store import", "[snapshot]")
+	dir := fs.String("dir", "", "file store `directory`")
+	signer := fs.String("signer", "", "require the snapshot to be signed by this hex public `key`")
+	if err := c.parse(fs, args, 1); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return c.missing(fs, "dir")
+	}
+	store, err := grith.OpenFileStore(*dir)
+	if err != nil {
+		return err
+	}
+	data, err := c.read(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	manifest, err := grith.ImportSnapshot(bytes.NewReader(data), store, &grith.ImportSnapshotOptions{SignerPublicKey: *signer})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "imported %d documents\n", len(manifest.Documents))
+	return nil
+}
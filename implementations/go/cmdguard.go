@@ -0,0 +1,189 @@
+package grith
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ActionProcessExec is the CCL action of a command run through a
+// CommandGuard.
+const ActionProcessExec = "process.exec"
+
+// CommandGuardOptions configure NewCommandGuard.
+type CommandGuardOptions struct {
+	// Enforcer checks and logs every command. Required.
+	Enforcer *Enforcer
+}
+
+// CommandGuard runs commands only when the covenant permits them. Each
+// command is checked as a process.exec action on /bin/<name>, where name
+// is the base name of the executable, with an evaluation context derived
+// from its arguments:
+//
+//   - command: the base name of the executable
+//   - path: the executable's path, as resolved by os/exec
+//   - dir: the working directory, empty for the current one
+//   - argc: the number of arguments, excluding the command
+//   - args: the arguments joined by spaces
+//   - arg1, arg2, ...: each argument
+//   - flag.<name>: true for each flag before any "--" argument, so "-rf"
+//     sets flag.r and flag.f and "--no-verify" sets flag.no_verify
+//
+// Since only the base name is in the resource, constraints on commands
+// that could be shadowed by another executable of the same name should
+// also test path. It is safe for concurrent use.
+type CommandGuard struct {
+	enforcer *Enforcer
+}
+
+// NewCommandGuard creates a CommandGuard.
+func NewCommandGuard(opts *CommandGuardOptions) (*CommandGuard, error) {
+	if opts == nil || opts.Enforcer == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: command guard requires an enforcer")
+	}
+	return &CommandGuard{enforcer: opts.Enforcer}, nil
+}
+
+// GuardedCmd is an exec.Cmd whose Start, Run, Output, and CombinedOutput
+// first check the command with its CommandGuard. The check, and its log
+// entry, happen before the process is spawned, using the command's Path,
+// Args, and Dir at that time. A denied command returns an error with code
+// ErrCodeUnauthorized and is never spawned.
+type GuardedCmd struct {
+	*exec.Cmd
+
+	guard    *CommandGuard
+	ctx      context.Context
+	decision *EnforcementDecision
+}
+
+// Command returns a GuardedCmd to run name with the given arguments, as
+// exec.Command does.
+func (g *CommandGuard) Command(name string, arg ...string) *GuardedCmd {
+	return &GuardedCmd{Cmd: exec.Command(name, arg...), guard: g, ctx: context.Background()}
+}
+
+// CommandContext returns a GuardedCmd as exec.CommandContext does. ctx
+// also bounds the check.
+func (g *CommandGuard) CommandContext(ctx context.Context, name string, arg ...string) *GuardedCmd {
+	return &GuardedCmd{Cmd: exec.CommandContext(ctx, name, arg...), guard: g, ctx: ctx}
+}
+
+// Decision returns the decision on the command, or nil if it has not
+// been checked.
+func (c *GuardedCmd) Decision() *EnforcementDecision {
+	return c.decision
+}
+
+// check checks the command once.
+func (c *GuardedCmd) check() error {
+	if c.decision != nil {
+		if !c.decision.Permitted {
+			return c.denied()
+		}
+		return nil
+	}
+	if c.Err != nil {
+		return c.Err
+	}
+	name := filepath.Base(c.Path)
+	d, err := c.guard.enforcer.Check(c.ctx, ActionProcessExec, "/bin/"+name, commandContext(name, c.Path, c.Dir, c.Args))
+	if err != nil {
+		return err
+	}
+	c.decision = d
+	if !d.Permitted {
+		return c.denied()
+	}
+	return nil
+}
+
+func (c *GuardedCmd) denied() error {
+	return errorf(ErrCodeUnauthorized, "grith: command %s denied: %s", filepath.Base(c.Path), c.decision.Reason)
+}
+
+// Start checks the command and, if permitted, starts it.
+func (c *GuardedCmd) Start() error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.Cmd.Start()
+}
+
+// Run checks the command and, if permitted, runs it to completion.
+func (c *GuardedCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output checks the command and, if permitted, runs it and returns its
+// standard output, as exec.Cmd.Output does.
+func (c *GuardedCmd) Output() ([]byte, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return c.Cmd.Output()
+}
+
+// CombinedOutput checks the command and, if permitted, runs it and
+// returns its combined standard output and standard error.
+func (c *GuardedCmd) CombinedOutput() ([]byte, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return c.Cmd.CombinedOutput()
+}
+
+// commandContext returns the evaluation context of a command. args
+// includes the command itself, as in exec.Cmd.Args.
+func commandContext(name, path, dir string, args []string) map[string]interface{} {
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	ctx := map[string]interface{}{
+		"command": name,
+		"path":    path,
+		"dir":     dir,
+		"argc":    len(args),
+		"args":    strings.Join(args, " "),
+	}
+	flags := make(map[string]interface{})
+	operands := false // set after a "--" argument
+	for i, a := range args {
+		ctx["arg"+strconv.Itoa(i+1)] = a
+		switch {
+		case operands || a == "-":
+		case a == "--":
+			operands = true
+		case strings.HasPrefix(a, "--"):
+			if f := flagName(strings.SplitN(a[2:], "=", 2)[0]); f != "" {
+				flags[f] = true
+			}
+		case strings.HasPrefix(a, "-"):
+			for _, r := range a[1:] {
+				if f := flagName(string(r)); f != "" {
+					flags[f] = true
+				}
+			}
+		}
+	}
+	ctx["flag"] = flags
+	return ctx
+}
+
+// flagName returns s as a CCL identifier, with hyphens as underscores, or
+// "" if it is not one.
+func flagName(s string) string {
+	s = strings.ReplaceAll(s, "-", "_")
+	for i, r := range s {
+		if !isIdentPart(r) || i == 0 && !isIdentStart(r) {
+			return ""
+		}
+	}
+	return s
+}
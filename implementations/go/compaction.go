@@ -0,0 +1,357 @@
+package grith
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ChangeCompacted is the lineage change type of a compaction summary.
+const ChangeCompacted = "compacted"
+
+// LineageSummary stands in for the lineage entries pruned by
+// CompactLineage. It commits to them by a Merkle root, so any pruned
+// entry, or the whole pruned history, can still be proven against the
+// compacted identity.
+type LineageSummary struct {
+	// Count is the number of pruned entries, the leaves of MerkleRoot.
+	Count int `json:"count"`
+	// Length is the number of lineage entries the pruned entries stand
+	// for: an earlier summary among them counts as itself and the
+	// entries it replaced.
+	Length int `json:"length"`
+	// CarryForward is the product of the pruned entries' carry-forward
+	// rates.
+	CarryForward float64 `json:"carryForward"`
+	// MerkleRoot is the root of the Merkle tree over the canonical JSON
+	// of the pruned entries, in lineage order.
+	MerkleRoot string `json:"merkleRoot"`
+	// RootHash is the hash of the agent's creation entry, which all its
+	// versions share.
+	RootHash string `json:"rootHash"`
+	// OperatorKey and Operators are the operator key and set in force
+	// after the last pruned entry; they sign the summary.
+	OperatorKey string       `json:"operatorKey"`
+	Operators   *OperatorSet `json:"operators,omitempty"`
+	// RotatedKeys are the keys involved in the pruned entries' operator
+	// key rotations and recoveries.
+	RotatedKeys []string `json:"rotatedKeys,omitempty"`
+	// NextKeyCommitment and Recovery are the pre-rotation key commitment
+	// and recovery set in force after the last pruned entry.
+	NextKeyCommitment string       `json:"nextKeyCommitment,omitempty"`
+	Recovery          *OperatorSet `json:"recovery,omitempty"`
+}
+
+// CompactLineageOptions are the options for CompactLineage.
+type CompactLineageOptions struct {
+	// OperatorKeyPair signs for a single-operator identity;
+	// OperatorKeyPairs sign for an organizational one.
+	OperatorKeyPair  *KeyPair
+	OperatorKeyPairs []*KeyPair
+	// Keep is the number of latest lineage entries to keep. At least two
+	// entries must be pruned.
+	Keep int
+}
+
+// CompactLineage returns a new version of identity whose lineage
+// replaces all but the latest opts.Keep entries with a signed summary
+// entry, along with the pruned entries. The summary entry takes the
+// last pruned entry's identity hash, so the kept entries still link to
+// it, and its carry-forward is the pruned entries' product, so the
+// identity's effective carry-forward is unchanged. Kept entries may not
+// change operators. Keep the pruned entries to prove them later with
+// ProveLineageEntry or VerifyPrunedLineage.
+func CompactLineage(identity *AgentIdentity, opts *CompactLineageOptions) (*AgentIdentity, []LineageEntry, error) {
+	if identity == nil || len(identity.Lineage) == 0 {
+		return nil, nil, errorf(ErrCodeMissingField, "grith: identity with a lineage is required")
+	}
+	if opts == nil {
+		return nil, nil, errorf(ErrCodeMissingField, "grith: compaction options are required")
+	}
+	if opts.Keep < 0 || len(identity.Lineage)-opts.Keep < 2 {
+		return nil, nil, errorf(ErrCodeInvalidInput, "grith: compaction must prune at least two of %s", plural(len(identity.Lineage), "lineage entry", "lineage entries"))
+	}
+	if result, err := VerifyIdentity(identity); err != nil || !result.Valid {
+		return nil, nil, errorf(ErrCodeInvalidInput, "grith: identity %s failed verification", shortID(identity.ID))
+	}
+	if identity.Operators == nil && opts.OperatorKeyPair != nil && opts.OperatorKeyPair.PublicKeyHex != identity.OperatorPublicKey {
+		return nil, nil, errorf(ErrCodeInvalidInput, "grith: operator key pair is not the identity's operator key")
+	}
+
+	split := len(identity.Lineage) - opts.Keep
+	pruned := append([]LineageEntry(nil), identity.Lineage[:split]...)
+	kept := identity.Lineage[split:]
+	for _, e := range kept {
+		if e.ChangeType == ChangeOperatorKeyRotation || e.ChangeType == ChangeOperatorKeyRecovery || e.ChangeType == "operator_transfer" || e.Operators != nil {
+			return nil, nil, errorf(ErrCodeInvalidInput, "grith: lineage entries kept by a compaction cannot change operators")
+		}
+	}
+
+	summary := &LineageSummary{
+		Count:        len(pruned),
+		CarryForward: 1,
+		RootHash:     lineageRoot(identity),
+		OperatorKey:  identity.OperatorPublicKey,
+		Operators:    copyOperatorSet(identity.Operators),
+	}
+	rotated := make(map[string]bool)
+	for _, e := range pruned {
+		summary.CarryForward *= e.ReputationCarryForward
+		summary.Length += entryLength(&e)
+		if e.Summary != nil {
+			for _, k := range e.Summary.RotatedKeys {
+				rotated[k] = true
+			}
+		}
+		if e.ChangeType == ChangeOperatorKeyRotation || e.ChangeType == ChangeOperatorKeyRecovery {
+			rotated[e.PreviousOperatorKey] = true
+			rotated[e.NewOperatorKey] = true
+		}
+	}
+	for k := range rotated {
+		summary.RotatedKeys = append(summary.RotatedKeys, k)
+	}
+	sort.Strings(summary.RotatedKeys)
+	summary.NextKeyCommitment = keyCommitmentAfter(pruned)
+	summary.Recovery = recoverySetAfter(pruned)
+	leaves, err := lineageLeafHashes(pruned)
+	if err != nil {
+		return nil, nil, err
+	}
+	if summary.MerkleRoot, err = MerkleRoot(leaves); err != nil {
+		return nil, nil, errorf(ErrCodeCrypto, "grith: failed to compute pruned lineage root: %w", err)
+	}
+
+	now := Timestamp()
+	last := pruned[len(pruned)-1]
+	entry := LineageEntry{
+		IdentityHash:           last.IdentityHash,
+		ChangeType:             ChangeCompacted,
+		Description:            fmt.Sprintf("Compacted %s", plural(summary.Length, "lineage entry", "lineage entries")),
+		Timestamp:              now,
+		ReputationCarryForward: summary.CarryForward,
+		PolicyHash:             last.PolicyHash,
+		Fork:                   pruned[0].Fork,
+		Summary:                summary,
+		Capabilities:           capabilitiesAfter(pruned),
+		EvolutionPolicy:        policyAfter(pruned),
+	}
+	lineagePayload, err := lineageSigningPayload(&entry)
+	if err != nil {
+		return nil, nil, errorf(ErrCodeCanonicalization, "grith: failed to compute lineage signing payload: %w", err)
+	}
+	entry.Signature, entry.Signatures, err = signAsOperators([]byte(lineagePayload), opts.OperatorKeyPair, opts.OperatorKeyPairs, identity.Operators)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	compacted, err := deepCopyIdentity(identity)
+	if err != nil {
+		return nil, nil, errorf(ErrCodeSerialization, "grith: failed to copy identity: %w", err)
+	}
+	compacted.Lineage = append([]LineageEntry{entry}, kept...)
+	compacted.Version = identity.Version + 1
+	compacted.UpdatedAt = now
+	compacted.Signature, compacted.Signatures = "", nil
+	if compacted.ID, err = computeIdentityHash(compacted); err != nil {
+		return nil, nil, errorf(ErrCodeCanonicalization, "grith: failed to compute identity hash: %w", err)
+	}
+	payload, err := identitySigningPayload(compacted)
+	if err != nil {
+		return nil, nil, errorf(ErrCodeCanonicalization, "grith: failed to compute identity signing payload: %w", err)
+	}
+	compacted.Signature, compacted.Signatures, err = signAsOperators([]byte(payload), opts.OperatorKeyPair, opts.OperatorKeyPairs, compacted.Operators)
+	if err != nil {
+		return nil, nil, err
+	}
+	return compacted, pruned, nil
+}
+
+// LineageEntryProof proves that one pruned lineage entry is committed to
+// by a compacted identity's summary.
+type LineageEntryProof struct {
+	Index int      `json:"index"`
+	Proof []string `json:"proof"`
+}
+
+// ProveLineageEntry builds an inclusion proof for pruned[index], where
+// pruned are the entries CompactLineage returned.
+func ProveLineageEntry(pruned []LineageEntry, index int) (*LineageEntryProof, error) {
+	if index < 0 || index >= len(pruned) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: lineage entry index %d out of range", index)
+	}
+	leaves, err := lineageLeafHashes(pruned)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := MerkleInclusionProof(leaves, index)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to build lineage entry proof: %w", err)
+	}
+	return &LineageEntryProof{Index: index, Proof: proof}, nil
+}
+
+// VerifyLineageEntryProof checks that entry is the pruned entry at
+// proof.Index of identity's compaction summary.
+func VerifyLineageEntryProof(identity *AgentIdentity, entry *LineageEntry, proof *LineageEntryProof) error {
+	if entry == nil || proof == nil {
+		return errorf(ErrCodeMissingField, "grith: lineage entry and proof are required")
+	}
+	summary := compactionSummary(identity)
+	if summary == nil {
+		return errorf(ErrCodeInvalidInput, "grith: identity has no compacted lineage")
+	}
+	leaves, err := lineageLeafHashes([]LineageEntry{*entry})
+	if err != nil {
+		return err
+	}
+	if !VerifyMerkleInclusion(leaves[0], int64(proof.Index), int64(summary.Count), proof.Proof, summary.MerkleRoot) {
+		return errorf(ErrCodeCrypto, "grith: lineage entry is not in the compacted lineage at index %d", proof.Index)
+	}
+	return nil
+}
+
+// VerifyPrunedLineage checks that pruned is the full history behind
+// identity's compaction summary: the entries the summary commits to,
+// linked in order from the agent's creation to the summary, with the
+// summary's length and carry-forward.
+func VerifyPrunedLineage(identity *AgentIdentity, pruned []LineageEntry) error {
+	summary := compactionSummary(identity)
+	if summary == nil {
+		return errorf(ErrCodeInvalidInput, "grith: identity has no compacted lineage")
+	}
+	if len(pruned) != summary.Count {
+		return errorf(ErrCodeInvalidInput, "grith: summary commits to %s, not %d", plural(summary.Count, "entry", "entries"), len(pruned))
+	}
+	leaves, err := lineageLeafHashes(pruned)
+	if err != nil {
+		return err
+	}
+	if root, err := MerkleRoot(leaves); err != nil || root != summary.MerkleRoot {
+		return errorf(ErrCodeCrypto, "grith: pruned entries do not match the summary's Merkle root")
+	}
+	rate, length := 1.0, 0
+	for i, e := range pruned {
+		if i == 0 && e.ParentHash != nil {
+			return errorf(ErrCodeInvalidInput, "grith: first pruned entry has a parent hash")
+		}
+		if i > 0 && (e.ParentHash == nil || *e.ParentHash != pruned[i-1].IdentityHash) {
+			return errorf(ErrCodeInvalidInput, "grith: pruned entry %d does not link to the entry before it", i)
+		}
+		if e.Summary != nil && i > 0 {
+			return errorf(ErrCodeInvalidInput, "grith: pruned entry %d has a misplaced compaction summary", i)
+		}
+		rate *= e.ReputationCarryForward
+		length += entryLength(&e)
+	}
+	first := pruned[0].IdentityHash
+	if pruned[0].Summary != nil {
+		first = pruned[0].Summary.RootHash
+	}
+	switch {
+	case first != summary.RootHash:
+		return errorf(ErrCodeInvalidInput, "grith: pruned entries do not start at the agent's creation")
+	case pruned[len(pruned)-1].IdentityHash != identity.Lineage[0].IdentityHash:
+		return errorf(ErrCodeInvalidInput, "grith: pruned entries do not end at the summary")
+	case rate != summary.CarryForward || length != summary.Length:
+		return errorf(ErrCodeInvalidInput, "grith: pruned entries do not match the summary's carry-forward and length")
+	case !summaryKeysMatch(summary, pruned):
+		return errorf(ErrCodeInvalidInput, "grith: pruned entries do not match the summary's key commitment and recovery keys")
+	case !sameEvolutionPolicy(policyAfter(pruned), identity.Lineage[0].EvolutionPolicy):
+		return errorf(ErrCodeInvalidInput, "grith: pruned entries do not match the summary's evolution policy")
+	}
+	// The pruned entries must earn their carry-forward and end at the
+	// capabilities the summary records.
+	if problem := checkCarryForward(&AgentIdentity{Lineage: pruned, Capabilities: identity.Lineage[0].Capabilities}); problem != "" {
+		return errorf(ErrCodeInvalidInput, "grith: pruned entries: %s", problem)
+	}
+	return nil
+}
+
+// summaryKeysMatch reports whether the key commitment and recovery set
+// summary records are those in force after pruned.
+func summaryKeysMatch(summary *LineageSummary, pruned []LineageEntry) bool {
+	return keyCommitmentAfter(pruned) == summary.NextKeyCommitment && sameOperatorSet(recoverySetAfter(pruned), summary.Recovery)
+}
+
+// sameEvolutionPolicy reports whether a and b are the same policy, nil
+// meaning the default.
+func sameEvolutionPolicy(a, b *EvolutionPolicy) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// verifyLineageSummary checks a compaction summary entry's own fields
+// and, for a single-operator summary, its signature. Threshold
+// signatures are checked with the rest of the operator lineage.
+func verifyLineageSummary(entry *LineageEntry) error {
+	s := entry.Summary
+	switch {
+	case s.Count < 2 || s.Length < s.Count || s.MerkleRoot == "" || s.RootHash == "":
+		return errorf(ErrCodeInvalidInput, "grith: compaction summary is incomplete")
+	case s.CarryForward != entry.ReputationCarryForward:
+		return errorf(ErrCodeInvalidInput, "grith: compaction summary carry-forward does not match its entry")
+	}
+	if s.Operators != nil {
+		if validateOperatorSet(s.Operators) != nil || s.Operators.Keys[0] != s.OperatorKey {
+			return errorf(ErrCodeInvalidInput, "grith: compaction summary has an invalid operator set")
+		}
+		return nil
+	}
+	if !lineageSignedBy(entry, s.OperatorKey) {
+		return errorf(ErrCodeCrypto, "grith: compaction summary is not signed by its operator key")
+	}
+	return nil
+}
+
+// compactionSummary returns identity's compaction summary, or nil if its
+// lineage is not compacted.
+func compactionSummary(identity *AgentIdentity) *LineageSummary {
+	if identity == nil || len(identity.Lineage) == 0 {
+		return nil
+	}
+	return identity.Lineage[0].Summary
+}
+
+// lineageRoot returns the hash of the creation entry of identity's
+// agent, which a compacted lineage records in its summary.
+func lineageRoot(identity *AgentIdentity) string {
+	if s := compactionSummary(identity); s != nil {
+		return s.RootHash
+	}
+	return identity.Lineage[0].IdentityHash
+}
+
+// lineageLength returns the number of entries identity's lineage would
+// have without compaction, counting each compaction as an entry.
+func lineageLength(identity *AgentIdentity) int {
+	n := 0
+	for i := range identity.Lineage {
+		n += entryLength(&identity.Lineage[i])
+	}
+	return n
+}
+
+func entryLength(e *LineageEntry) int {
+	if e.Summary != nil {
+		return e.Summary.Length + 1
+	}
+	return 1
+}
+
+func lineageLeafHashes(entries []LineageEntry) ([]string, error) {
+	leaves := make([]string, len(entries))
+	for i := range entries {
+		m, err := objectToMap(&entries[i])
+		if err != nil {
+			return nil, errorf(ErrCodeCanonicalization, "grith: failed to convert lineage entry to map: %w", err)
+		}
+		canonical, err := CanonicalizeJSON(m)
+		if err != nil {
+			return nil, errorf(ErrCodeCanonicalization, "grith: failed to canonicalize lineage entry: %w", err)
+		}
+		leaves[i] = MerkleLeafHash([]byte(canonical))
+	}
+	return leaves, nil
+}
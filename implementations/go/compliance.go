@@ -0,0 +1,474 @@
+package grith
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ViolationKind classifies a compliance violation.
+type ViolationKind string
+
+const (
+	// ViolationUnpermitted is an executed action the covenant does not permit.
+	ViolationUnpermitted ViolationKind = "unpermitted"
+	// ViolationRateLimit is an executed action beyond a limit statement.
+	ViolationRateLimit ViolationKind = "rate_limit"
+	// ViolationObligation is a triggered require statement that was never
+	// fulfilled.
+	ViolationObligation ViolationKind = "obligation"
+	// ViolationInvalidEntry is a log entry that cannot be replayed, e.g.
+	// because it belongs to another covenant or has a bad timestamp.
+	ViolationInvalidEntry ViolationKind = "invalid_entry"
+)
+
+// ComplianceViolation is one breach found by ReplayCompliance.
+type ComplianceViolation struct {
+	// Index is the log index of the offending entry; for obligations,
+	// the entry that triggered it.
+	Index   int64         `json:"index"`
+	Kind    ViolationKind `json:"kind"`
+	Rule    string        `json:"rule,omitempty"`
+	Message string        `json:"message"`
+	// Deadline is when a windowed obligation fell due.
+	Deadline string `json:"deadline,omitempty"`
+}
+
+// OpenObligation is a triggered obligation whose deadline had not passed
+// by the end of the replay. It is not a violation.
+type OpenObligation struct {
+	// Index is the log index of the entry that triggered the obligation.
+	Index    int64  `json:"index"`
+	Rule     string `json:"rule"`
+	Deadline string `json:"deadline"`
+}
+
+// ComplianceReport is the outcome of replaying an action log against a
+// covenant.
+type ComplianceReport struct {
+	CovenantID string                `json:"covenantId"`
+	Entries    int                   `json:"entries"`
+	Compliant  bool                  `json:"compliant"`
+	Violations []ComplianceViolation `json:"violations"`
+	// Unevaluated lists entries whose outcome depends on a when-condition
+	// but whose context was not supplied.
+	Unevaluated []int64 `json:"unevaluated,omitempty"`
+	// OpenObligations lists obligations still within their window.
+	OpenObligations []OpenObligation `json:"openObligations,omitempty"`
+	// Omitted counts violations and unevaluated entries left out of the
+	// report beyond ReplayOptions.MaxFindings.
+	Omitted int `json:"omitted,omitempty"`
+	// Error is set when the covenant's constraints could not be loaded;
+	// no entries are replayed and the report is not compliant.
+	Error string `json:"error,omitempty"`
+}
+
+// ReplayOptions configure ReplayComplianceWithOptions.
+type ReplayOptions struct {
+	// ConstraintResolver resolves constraints stored by reference.
+	ConstraintResolver ConstraintResolver
+	// Contexts are the evaluation contexts of logged actions, matched to
+	// entries by hash. Entries only commit to a hash of their context, so
+	// when-conditions cannot be evaluated without them.
+	Contexts []map[string]interface{}
+	// ObligationWindow, if set, is how long after a triggering action a
+	// require obligation must be fulfilled. Without it, fulfilment at any
+	// later point in the log suffices.
+	ObligationWindow time.Duration
+	// Now is the time of the audit. Windowed obligations whose deadline
+	// is after it are reported as open rather than violated. Defaults to
+	// the time of the last entry.
+	Now time.Time
+	// MaxFindings, if set, bounds the number of violations and unevaluated
+	// entries recorded; further findings are only counted. It bounds the
+	// report's size when replaying very large logs.
+	MaxFindings int
+}
+
+// ReplayCompliance re-evaluates every action in log against the
+// covenant's constraints and reports each breach with its log index.
+func ReplayCompliance(covenant *CovenantDocument, log *ActionLog) ComplianceReport {
+	return ReplayComplianceWithOptions(covenant, log.Entries(), nil)
+}
+
+// ReplayComplianceWithOptions replays entries, a log starting at any
+// index, against the covenant's constraints:
+//
+//   - executed actions must be permitted (denied and impossible actions
+//     were blocked and are not breaches)
+//   - executed actions matching a limit statement must not exceed it in
+//     any window of its period ending at that action
+//   - an executed action on a resource covered by a require statement
+//     must be followed by an executed action fulfilling it, within
+//     opts.ObligationWindow if set
+//
+// The log's integrity is not checked; verify it first.
+func ReplayComplianceWithOptions(covenant *CovenantDocument, entries []ActionLogEntry, opts *ReplayOptions) ComplianceReport {
+	r := newReplay(covenant, opts)
+	if r.report.Error == "" {
+		for i := range entries {
+			r.step(&entries[i])
+		}
+		r.finish()
+	}
+	return *r.report
+}
+
+// newReplay prepares a replay of covenant's log. If the constraints
+// cannot be loaded, err and the report's Error are set and nothing can be
+// replayed.
+func newReplay(covenant *CovenantDocument, opts *ReplayOptions) *replay {
+	if opts == nil {
+		opts = &ReplayOptions{}
+	}
+	r := &replay{
+		covenant:    covenant,
+		window:      opts.ObligationWindow,
+		now:         opts.Now,
+		maxFindings: opts.MaxFindings,
+		report:      &ComplianceReport{CovenantID: covenant.ID, Violations: []ComplianceViolation{}},
+	}
+	source, err := ResolveCovenantConstraints(covenant, opts.ConstraintResolver)
+	if err != nil {
+		r.err = err
+		r.report.Error = err.Error()
+		return r
+	}
+	r.ccl, err = parsedConstraints(source)
+	if err != nil {
+		r.err = errorf(ErrCodeCCLParse, "grith: invalid CCL constraints: %w", err)
+		r.report.Error = fmt.Sprintf("invalid CCL constraints: %v", err)
+		return r
+	}
+	r.contexts = make(map[string]map[string]interface{}, len(opts.Contexts))
+	for _, c := range opts.Contexts {
+		if h, err := HashActionContext(c); err == nil {
+			r.contexts[h] = c
+		}
+	}
+	return r
+}
+
+// replay holds the state of a compliance replay.
+type replay struct {
+	covenant    *CovenantDocument
+	ccl         *CCLDocument
+	contexts    map[string]map[string]interface{}
+	window      time.Duration
+	now         time.Time
+	maxFindings int
+	report      *ComplianceReport
+	err         error
+	// last is the time of the latest replayed entry.
+	last time.Time
+
+	// executed holds the times of executed actions, per limit statement.
+	executed map[int][]time.Time
+	// pending holds the unfulfilled obligations per require statement.
+	pending map[int][]pendingObligation
+}
+
+// pendingObligation is an obligation triggered by a log entry. The
+// deadline is zero without an obligation window.
+type pendingObligation struct {
+	index    int64
+	trigger  string
+	deadline time.Time
+}
+
+// full reports whether the report holds as many findings as allowed,
+// counting the finding that would have been added.
+func (r *replay) full() bool {
+	if r.maxFindings > 0 && len(r.report.Violations)+len(r.report.Unevaluated) >= r.maxFindings {
+		r.report.Omitted++
+		return true
+	}
+	return false
+}
+
+// violation records a violation and returns it, or returns nil if the
+// report is full.
+func (r *replay) violation(index int64, kind ViolationKind, rule *Statement, format string, args ...interface{}) *ComplianceViolation {
+	if r.full() {
+		return nil
+	}
+	v := ComplianceViolation{Index: index, Kind: kind, Message: fmt.Sprintf(format, args...)}
+	if rule != nil {
+		v.Rule = serializeStatement(*rule)
+	}
+	r.report.Violations = append(r.report.Violations, v)
+	return &r.report.Violations[len(r.report.Violations)-1]
+}
+
+func (r *replay) step(e *ActionLogEntry) {
+	r.report.Entries++
+	if e.CovenantID != r.covenant.ID {
+		r.violation(e.Index, ViolationInvalidEntry, nil, "Entry belongs to covenant %s", shortID(e.CovenantID))
+		return
+	}
+	at, err := parseTimestamp(e.Timestamp)
+	if err != nil {
+		r.violation(e.Index, ViolationInvalidEntry, nil, "Entry has an invalid timestamp %q", e.Timestamp)
+		return
+	}
+	if at.After(r.last) {
+		r.last = at
+	}
+	r.expireObligations(at)
+	if e.Outcome != OutcomeExecuted {
+		return
+	}
+
+	context, known := r.contexts[e.ContextHash]
+	if !known && r.conditional(e.Action, e.Resource) {
+		if !r.full() {
+			r.report.Unevaluated = append(r.report.Unevaluated, e.Index)
+		}
+		return
+	}
+
+	if result := Evaluate(r.ccl, e.Action, e.Resource, context); !result.Permitted {
+		r.violation(e.Index, ViolationUnpermitted, result.MatchedRule, "Executed %s on %s is not permitted: %s", e.Action, e.Resource, result.Reason)
+	}
+	r.checkLimit(e, at)
+	r.trackObligations(e, at, context)
+}
+
+// conditional reports whether any rule matching action and resource has
+// a when-condition.
+func (r *replay) conditional(action, resource string) bool {
+	for _, group := range [][]Statement{r.ccl.Permits, r.ccl.Denies, r.ccl.Obligations} {
+		for _, s := range group {
+			if s.Condition != nil && MatchAction(s.Action, action) && MatchResource(s.Resource, resource) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkLimit applies the most specific limit matching the entry's action,
+// as CheckRateLimit does, over the window of its period ending at the
+// entry.
+func (r *replay) checkLimit(e *ActionLogEntry, at time.Time) {
+	idx := matchingLimit(r.ccl, e.Action)
+	if idx < 0 {
+		return
+	}
+	limit := &r.ccl.Limits[idx]
+	if r.executed == nil {
+		r.executed = make(map[int][]time.Time)
+	}
+	period := time.Duration(limit.Period * float64(time.Millisecond))
+	times := append(r.executed[idx], at)
+	start := 0
+	for start < len(times) && !times[start].After(at.Add(-period)) {
+		start++
+	}
+	times = times[start:]
+	r.executed[idx] = times
+	if float64(len(times)) > limit.Limit {
+		r.violation(e.Index, ViolationRateLimit, limit, "%s executed %d times within %s, limit is %.0f", e.Action, len(times), period, limit.Limit)
+	}
+}
+
+// trackObligations fulfils pending obligations the entry satisfies, then
+// records the obligations it triggers. An action on a resource covered by
+// "require A on R" triggers it unless the action is itself A.
+func (r *replay) trackObligations(e *ActionLogEntry, at time.Time, context map[string]interface{}) {
+	if r.pending == nil {
+		r.pending = make(map[int][]pendingObligation)
+	}
+	for i, ob := range r.ccl.Obligations {
+		if !MatchResource(ob.Resource, e.Resource) {
+			continue
+		}
+		if MatchAction(ob.Action, e.Action) {
+			delete(r.pending, i)
+			continue
+		}
+		if evaluateCondition(ob.Condition, context) {
+			p := pendingObligation{index: e.Index, trigger: fmt.Sprintf("%s on %s", e.Action, e.Resource)}
+			if r.window > 0 {
+				p.deadline = at.Add(r.window)
+			}
+			r.pending[i] = append(r.pending[i], p)
+		}
+	}
+}
+
+// expireObligations reports windowed obligations whose deadline passed
+// before at.
+func (r *replay) expireObligations(at time.Time) {
+	for i := range r.ccl.Obligations {
+		pending := r.pending[i]
+		if len(pending) == 0 {
+			continue
+		}
+		kept := pending[:0]
+		for _, p := range pending {
+			if !p.deadline.IsZero() && p.deadline.Before(at) {
+				r.overdue(i, p)
+				continue
+			}
+			kept = append(kept, p)
+		}
+		r.pending[i] = kept
+	}
+}
+
+func (r *replay) overdue(i int, p pendingObligation) {
+	ob := &r.ccl.Obligations[i]
+	if p.deadline.IsZero() {
+		r.violation(p.index, ViolationObligation, ob, "Obligation %s on %s triggered by %s was never fulfilled", ob.Action, ob.Resource, p.trigger)
+		return
+	}
+	deadline := p.deadline.UTC().Format("2006-01-02T15:04:05.000Z")
+	if v := r.violation(p.index, ViolationObligation, ob, "Obligation %s on %s triggered by %s was not fulfilled by %s", ob.Action, ob.Resource, p.trigger, deadline); v != nil {
+		v.Deadline = deadline
+	}
+}
+
+// finish reports obligations still pending at the end of the log: open if
+// their deadline is after the audit time, violated otherwise. It then
+// settles whether the log was compliant.
+func (r *replay) finish() {
+	now := r.now
+	if now.IsZero() {
+		now = r.last
+	}
+	for i := range r.ccl.Obligations {
+		for _, p := range r.pending[i] {
+			if !p.deadline.IsZero() && !p.deadline.Before(now) {
+				r.report.OpenObligations = append(r.report.OpenObligations, OpenObligation{
+					Index:    p.index,
+					Rule:     serializeStatement(r.ccl.Obligations[i]),
+					Deadline: p.deadline.UTC().Format("2006-01-02T15:04:05.000Z"),
+				})
+				continue
+			}
+			r.overdue(i, p)
+		}
+	}
+	// Keep violations in log order; obligations are only known later.
+	sort.SliceStable(r.report.Violations, func(i, j int) bool {
+		return r.report.Violations[i].Index < r.report.Violations[j].Index
+	})
+	sort.SliceStable(r.report.OpenObligations, func(i, j int) bool {
+		return r.report.OpenObligations[i].Index < r.report.OpenObligations[j].Index
+	})
+	r.report.Compliant = len(r.report.Violations) == 0 && len(r.report.Unevaluated) == 0 && r.report.Omitted == 0
+}
+
+// matchingLimit returns the index of the most specific limit statement
+// matching action, or -1.
+func matchingLimit(ccl *CCLDocument, action string) int {
+	idx, best := -1, -1
+	for i, l := range ccl.Limits {
+		if MatchAction(l.Action, action) {
+			if spec := specificity(l.Action, ""); spec > best {
+				idx, best = i, spec
+			}
+		}
+	}
+	return idx
+}
+
+// RateLimitExcess is an interval during which a limit statement was
+// exceeded: every window of the limit's period ending within it held more
+// executed actions than allowed.
+type RateLimitExcess struct {
+	Rule string `json:"rule"`
+	// Start is the time of the first action in the earliest offending
+	// window, End the time of the last offending action.
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// MaxCount is the largest number of actions in one window.
+	MaxCount int     `json:"maxCount"`
+	Limit    float64 `json:"limit"`
+	// Indices are the log indices of the actions in the interval.
+	Indices []int64 `json:"indices"`
+}
+
+// AuditRateLimits reconstructs rate-limit windows from the timestamps of
+// the executed actions in log and reports every interval in which a limit
+// statement was exceeded.
+func AuditRateLimits(covenant *CovenantDocument, log *ActionLog) ([]RateLimitExcess, error) {
+	return AuditRateLimitsWithOptions(covenant, log.Entries(), nil)
+}
+
+// AuditRateLimitsWithOptions is AuditRateLimits over a log segment. Only
+// opts.ConstraintResolver is used. Each action counts against the most
+// specific matching limit, as in CheckRateLimit; entries with invalid
+// timestamps are ignored.
+func AuditRateLimitsWithOptions(covenant *CovenantDocument, entries []ActionLogEntry, opts *ReplayOptions) ([]RateLimitExcess, error) {
+	if opts == nil {
+		opts = &ReplayOptions{}
+	}
+	source, err := ResolveCovenantConstraints(covenant, opts.ConstraintResolver)
+	if err != nil {
+		return nil, err
+	}
+	ccl, err := parsedConstraints(source)
+	if err != nil {
+		return nil, errorf(ErrCodeCCLParse, "grith: invalid CCL constraints: %w", err)
+	}
+
+	type action struct {
+		index int64
+		at    time.Time
+	}
+	byLimit := make([][]action, len(ccl.Limits))
+	for _, e := range entries {
+		if e.Outcome != OutcomeExecuted || e.CovenantID != covenant.ID {
+			continue
+		}
+		at, err := parseTimestamp(e.Timestamp)
+		if err != nil {
+			continue
+		}
+		if idx := matchingLimit(ccl, e.Action); idx >= 0 {
+			byLimit[idx] = append(byLimit[idx], action{e.Index, at})
+		}
+	}
+
+	out := []RateLimitExcess{}
+	for i, actions := range byLimit {
+		limit := ccl.Limits[i]
+		period := time.Duration(limit.Period * float64(time.Millisecond))
+		sort.SliceStable(actions, func(a, b int) bool { return actions[a].at.Before(actions[b].at) })
+
+		var cur *RateLimitExcess
+		var curEnd int // index in actions of the last action in cur
+		start := 0
+		for j, a := range actions {
+			for !actions[start].at.After(a.at.Add(-period)) {
+				start++
+			}
+			count := j - start + 1
+			if float64(count) <= limit.Limit {
+				continue
+			}
+			// Offending windows that share actions form one interval.
+			from := curEnd + 1
+			if cur == nil || start > curEnd {
+				out = append(out, RateLimitExcess{
+					Rule:  serializeStatement(limit),
+					Start: actions[start].at.UTC().Format("2006-01-02T15:04:05.000Z"),
+					Limit: limit.Limit,
+				})
+				cur = &out[len(out)-1]
+				from = start
+			}
+			for _, w := range actions[from : j+1] {
+				cur.Indices = append(cur.Indices, w.index)
+			}
+			cur.End = a.at.UTC().Format("2006-01-02T15:04:05.000Z")
+			if count > cur.MaxCount {
+				cur.MaxCount = count
+			}
+			curEnd = j
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,160 @@
+package grith
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+)
+
+// EncodingGzip is the built-in gzip content encoding.
+const EncodingGzip = "gzip"
+
+// MaxCompressionRatio bounds how many times larger a decompressed
+// covenant may be than its compressed payload, guarding against
+// decompression bombs.
+const MaxCompressionRatio = 100
+
+// ContentCodec compresses and decompresses serialized covenants.
+// Encodings not provided by this package, such as zstd, can be plugged
+// in with RegisterContentEncoding.
+type ContentCodec interface {
+	Compress(data []byte) ([]byte, error)
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+// SerializeOptions configure SerializeCovenantWithOptions.
+type SerializeOptions struct {
+	// ContentEncoding compresses the document with the named encoding.
+	// Empty serializes plain JSON.
+	ContentEncoding string
+	// MinSize leaves documents smaller than this many bytes uncompressed.
+	MinSize int
+}
+
+// compressedEnvelope wraps a compressed covenant. The encoding marker
+// lives outside the document, so compression never affects the signed
+// canonical form or the document ID.
+type compressedEnvelope struct {
+	ContentEncoding string `json:"contentEncoding"`
+	Payload         string `json:"payload"`
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]ContentCodec{EncodingGzip: gzipCodec{}}
+)
+
+// RegisterContentEncoding makes a content encoding available to
+// SerializeCovenantWithOptions and DeserializeCovenant. The built-in gzip
+// encoding cannot be replaced.
+func RegisterContentEncoding(name string, codec ContentCodec) error {
+	if codec == nil {
+		return errorf(ErrCodeMissingField, "grith: content encoding %q requires a codec", name)
+	}
+	if name == "" || strings.ToLower(name) != name {
+		return errorf(ErrCodeInvalidInput, "grith: invalid content encoding name %q: must be lowercase", name)
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, ok := codecs[name]; ok {
+		return errorf(ErrCodeInvalidInput, "grith: content encoding %q is already registered", name)
+	}
+	codecs[name] = codec
+	return nil
+}
+
+func codecFor(name string) (ContentCodec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// SerializeCovenantWithOptions serializes a covenant document, optionally
+// compressing it into an envelope of the form
+// {"contentEncoding":"gzip","payload":"<base64>"}. DeserializeCovenant
+// recognizes the envelope and decompresses it transparently.
+func SerializeCovenantWithOptions(doc *CovenantDocument, opts *SerializeOptions) (string, error) {
+	plain, err := SerializeCovenant(doc)
+	if err != nil {
+		return "", err
+	}
+	if opts == nil || opts.ContentEncoding == "" || len(plain) < opts.MinSize {
+		return plain, nil
+	}
+	codec, ok := codecFor(opts.ContentEncoding)
+	if !ok {
+		return "", errorf(ErrCodeInvalidInput, "grith: unsupported content encoding: %q", opts.ContentEncoding)
+	}
+	compressed, err := codec.Compress([]byte(plain))
+	if err != nil {
+		return "", errorf(ErrCodeCompression, "grith: failed to compress covenant: %w", err)
+	}
+	b, err := json.Marshal(compressedEnvelope{
+		ContentEncoding: opts.ContentEncoding,
+		Payload:         base64.StdEncoding.EncodeToString(compressed),
+	})
+	if err != nil {
+		return "", errorf(ErrCodeSerialization, "grith: failed to serialize covenant: %w", err)
+	}
+	return string(b), nil
+}
+
+// decompressCovenant returns the covenant JSON carried by a compressed
+// envelope. The decompressed form is limited to MaxDocumentSize bytes and
+// to MaxCompressionRatio times the compressed size.
+func decompressCovenant(env *compressedEnvelope) ([]byte, error) {
+	codec, ok := codecFor(env.ContentEncoding)
+	if !ok {
+		return nil, errorf(ErrCodeCompression, "grith: unsupported content encoding: %q", env.ContentEncoding)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, errorf(ErrCodeCompression, "grith: invalid compressed payload: %w", err)
+	}
+	r, err := codec.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, errorf(ErrCodeCompression, "grith: invalid %s payload: %w", env.ContentEncoding, err)
+	}
+
+	limit := int64(MaxCompressionRatio) * int64(len(compressed))
+	if limit > MaxDocumentSize {
+		limit = MaxDocumentSize
+	}
+	plain, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, errorf(ErrCodeCompression, "grith: failed to decompress %s payload: %w", env.ContentEncoding, err)
+	}
+	if int64(len(plain)) > limit {
+		if limit == MaxDocumentSize {
+			return nil, errorf(ErrCodeDocumentTooLarge, "grith: decompressed document exceeds maximum of %d bytes", MaxDocumentSize)
+		}
+		return nil, errorf(ErrCodeCompression, "grith: compressed payload expands more than %dx", MaxCompressionRatio)
+	}
+	return plain, nil
+}
@@ -0,0 +1,145 @@
+// Package conformance runs the shared Grith protocol fixtures against this
+// implementation as Go table tests, so it and the TypeScript
+// implementation are validated against the same corpus.
+//
+// The corpus lives in the repository's test-vectors directory. Its files
+// hold vectors grouped by category: crypto (JCS canonicalization, hashing,
+// and signatures), ccl (parsing, evaluation, and serialization), covenant
+// (signed documents and their expected check outcomes), identity, and
+// chain. A typical test is:
+//
+//	func TestConformance(t *testing.T) {
+//		set, err := conformance.Load("testdata/vectors")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		conformance.Run(t, set, nil)
+//	}
+package conformance
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	grith "github.com/agbusiness195/grith/implementations/go"
+)
+
+// Load reads fixture files and merges their vectors into one set. Each
+// path is a vector file or a directory whose *.json files are read in
+// name order. Vectors are keyed by category and name, which must be
+// unique across the files. The merged metadata is that of the first file,
+// with the totals recounted.
+func Load(paths ...string) (*grith.TestVectorSet, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errorf(grith.ErrCodeStorage, "grith: failed to read test vectors: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, errorf(grith.ErrCodeStorage, "grith: failed to list test vectors: %w", err)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, errorf(grith.ErrCodeMissingField, "grith: no test vector files")
+	}
+
+	merged := &grith.TestVectorSet{Vectors: make(map[string][]grith.TestVector)}
+	seen := make(map[string]string)
+	for i, file := range files {
+		set, err := grith.LoadTestVectors(file)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			merged.Meta = set.Meta
+		}
+		for category, vectors := range set.Vectors {
+			for _, v := range vectors {
+				key := category + "/" + v.Name
+				if prev, ok := seen[key]; ok {
+					return nil, errorf(grith.ErrCodeInvalidInput, "grith: test vector %s in %s duplicates one in %s", key, file, prev)
+				}
+				seen[key] = file
+				merged.Vectors[category] = append(merged.Vectors[category], v)
+			}
+		}
+	}
+	merged.Meta.TotalVectors = 0
+	merged.Meta.CategoryCounts = make(map[string]int, len(merged.Vectors))
+	for category, vectors := range merged.Vectors {
+		merged.Meta.CategoryCounts[category] = len(vectors)
+		merged.Meta.TotalVectors += len(vectors)
+		if !contains(merged.Meta.Categories, category) {
+			merged.Meta.Categories = append(merged.Meta.Categories, category)
+		}
+	}
+	return merged, nil
+}
+
+// errorf returns an error with a grith error code.
+func errorf(code grith.ErrorCode, format string, args ...interface{}) error {
+	return &grith.Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Options configure Run.
+type Options struct {
+	// Known maps "category/name" keys of vectors expected to fail to the
+	// reason, such as a fixture that predates a protocol change. A known
+	// failure is skipped; a known failure that passes fails, so the entry
+	// is removed once the divergence is fixed.
+	Known map[string]string
+	// AllowSkipped, if set, skips vectors this implementation does not
+	// recognize instead of failing them.
+	AllowSkipped bool
+}
+
+// Run checks every vector in set against this implementation, reporting
+// each as a subtest named "category/name". Vectors run in file order
+// because later vectors may refer to documents built by earlier ones.
+func Run(t *testing.T, set *grith.TestVectorSet, opts *Options) {
+	t.Helper()
+	if opts == nil {
+		opts = &Options{}
+	}
+	results := grith.RunTestVectors(set)
+	if len(results) == 0 {
+		t.Fatal("conformance: no test vectors")
+	}
+	for _, r := range results {
+		r := r
+		key := r.Category + "/" + r.Name
+		t.Run(key, func(t *testing.T) {
+			reason, known := opts.Known[key]
+			switch {
+			case known && r.Passed:
+				t.Errorf("known failure now passes (%s); remove it from Known", reason)
+			case known:
+				t.Skipf("known failure: %s: %s", reason, r.Message)
+			case r.Skipped && opts.AllowSkipped:
+				t.Skip(r.Message)
+			case !r.Passed:
+				t.Error(r.Message)
+			}
+		})
+	}
+}
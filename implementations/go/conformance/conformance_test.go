@@ -0,0 +1,80 @@
+package conformance
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	grith "github.com/agbusiness195/grith/implementations/go"
+)
+
+// corpus is the shared fixture directory.
+const corpus = "../../../test-vectors"
+
+func TestConformance(t *testing.T) {
+	set, err := Load(corpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Run(t, set, nil)
+}
+
+func TestGeneratedConformance(t *testing.T) {
+	set, err := grith.GenerateTestVectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Run(t, set, nil)
+}
+
+func TestLoad(t *testing.T) {
+	set, err := grith.GenerateTestVectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Split the generated set across two files of a directory.
+	dir := t.TempDir()
+	first := &grith.TestVectorSet{Meta: set.Meta, Vectors: map[string][]grith.TestVector{"crypto": set.Vectors["crypto"]}}
+	rest := &grith.TestVectorSet{Vectors: make(map[string][]grith.TestVector)}
+	for category, vectors := range set.Vectors {
+		if category != "crypto" {
+			rest.Vectors[category] = vectors
+		}
+	}
+	write := func(name string, s *grith.TestVectorSet) {
+		var buf bytes.Buffer
+		if err := grith.WriteTestVectors(&buf, s); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.json", first)
+	write("b.json", rest)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a vector file"), 0o644)
+
+	merged, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Meta.TotalVectors != set.Meta.TotalVectors || len(merged.Meta.Categories) != len(set.Meta.Categories) {
+		t.Errorf("merged meta = %+v, want %d vectors", merged.Meta, set.Meta.TotalVectors)
+	}
+	for category, vectors := range set.Vectors {
+		if merged.Meta.CategoryCounts[category] != len(vectors) {
+			t.Errorf("%s count = %d, want %d", category, merged.Meta.CategoryCounts[category], len(vectors))
+		}
+	}
+
+	if _, err := Load(dir, filepath.Join(dir, "a.json")); grith.CodeOf(err) != grith.ErrCodeInvalidInput {
+		t.Errorf("duplicate vectors: got %v", err)
+	}
+	if _, err := Load(t.TempDir()); grith.CodeOf(err) != grith.ErrCodeMissingField {
+		t.Errorf("empty directory: got %v", err)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.json")); grith.CodeOf(err) != grith.ErrCodeStorage {
+		t.Errorf("missing file: got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package grith
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// maxCachedConstraints bounds the number of parsed constraint blocks
+	// kept by parsedConstraints.
+	maxCachedConstraints = 1024
+	// maxCachedConstraintBytes bounds the total source size of the
+	// parsed constraint blocks kept by parsedConstraints.
+	maxCachedConstraintBytes = 16 << 20
+)
+
+// constraintCache is an LRU cache of parsed CCL keyed by source text.
+// Covenant constraints are immutable once signed, and a covenant is
+// typically verified, enforced, and replayed many times, so the parse is
+// done once per distinct source rather than once per use. Parse errors
+// are cached too.
+//
+// Cached documents are shared, so only code that never modifies them or
+// hands them to callers may use the cache. Public functions returning a
+// *CCLDocument, such as Parse and ParseCovenantConstraints, parse afresh.
+type constraintCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+	bytes   int
+}
+
+type cachedConstraints struct {
+	source string
+	doc    *CCLDocument
+	err    error
+}
+
+var parsedConstraintCache = &constraintCache{entries: make(map[string]*list.Element), order: list.New()}
+
+// parsedConstraints returns the parse of source, shared with other
+// callers; the caller must not modify it.
+func parsedConstraints(source string) (*CCLDocument, error) {
+	return parsedConstraintCache.parse(source)
+}
+
+func (c *constraintCache) parse(source string) (*CCLDocument, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[source]; ok {
+		c.order.MoveToFront(el)
+		e := el.Value.(*cachedConstraints)
+		c.mu.Unlock()
+		return e.doc, e.err
+	}
+	c.mu.Unlock()
+
+	// Parse outside the lock; concurrent misses on one source may each
+	// parse it, and the last stored wins.
+	doc, err := Parse(source)
+	if len(source) > maxCachedConstraintBytes/4 {
+		return doc, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[source]; ok {
+		c.order.MoveToFront(el)
+		e := el.Value.(*cachedConstraints)
+		return e.doc, e.err
+	}
+	c.entries[source] = c.order.PushFront(&cachedConstraints{source: source, doc: doc, err: err})
+	c.bytes += len(source)
+	for c.order.Len() > maxCachedConstraints || c.bytes > maxCachedConstraintBytes {
+		oldest := c.order.Back()
+		e := oldest.Value.(*cachedConstraints)
+		c.order.Remove(oldest)
+		delete(c.entries, e.source)
+		c.bytes -= len(e.source)
+	}
+	return doc, err
+}
+
+// parsedCovenantConstraints resolves and parses the CCL governing a
+// covenant through the cache. It is ParseCovenantConstraints for callers
+// that do not modify or expose the result.
+func parsedCovenantConstraints(doc *CovenantDocument, resolver ConstraintResolver) (*CCLDocument, error) {
+	source, err := ResolveCovenantConstraints(doc, resolver)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parsedConstraints(source)
+	if err != nil {
+		return nil, errorf(ErrCodeCCLParse, "grith: invalid CCL constraints: %w", err)
+	}
+	return parsed, nil
+}
+
+// clone returns a copy of s that shares nothing with it, for rules
+// taken from a cached document and handed to callers.
+func (s *Statement) clone() *Statement {
+	c := *s
+	if s.Condition != nil {
+		cond := *s.Condition
+		c.Condition = &cond
+	}
+	return &c
+}
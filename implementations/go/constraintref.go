@@ -0,0 +1,111 @@
+package grith
+
+import (
+	"sync"
+)
+
+// ConstraintsRef points to CCL constraints stored outside the covenant.
+// Hash is the SHA-256 hex digest of the CCL source text; URI is an
+// optional retrieval hint for resolvers.
+type ConstraintsRef struct {
+	Hash string `json:"hash"`
+	URI  string `json:"uri,omitempty"`
+}
+
+// ConstraintResolver fetches CCL source text for a ConstraintsRef.
+// Implementations need not check the hash; callers verify it.
+type ConstraintResolver interface {
+	ResolveConstraints(ref ConstraintsRef) (string, error)
+}
+
+// ConstraintResolverFunc adapts a function to the ConstraintResolver
+// interface.
+type ConstraintResolverFunc func(ref ConstraintsRef) (string, error)
+
+// ResolveConstraints calls f(ref).
+func (f ConstraintResolverFunc) ResolveConstraints(ref ConstraintsRef) (string, error) {
+	return f(ref)
+}
+
+// MemoryConstraintResolver is an in-memory ConstraintResolver keyed by
+// content hash. It is safe for concurrent use.
+type MemoryConstraintResolver struct {
+	mu      sync.RWMutex
+	sources map[string]string
+}
+
+// NewMemoryConstraintResolver creates a new, empty MemoryConstraintResolver.
+func NewMemoryConstraintResolver() *MemoryConstraintResolver {
+	return &MemoryConstraintResolver{
+		sources: make(map[string]string),
+	}
+}
+
+// Add stores CCL source text and returns a reference to it.
+func (r *MemoryConstraintResolver) Add(source, uri string) ConstraintsRef {
+	hash := SHA256String(source)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources[hash] = source
+	return ConstraintsRef{Hash: hash, URI: uri}
+}
+
+// ResolveConstraints returns the source text stored under ref.Hash.
+func (r *MemoryConstraintResolver) ResolveConstraints(ref ConstraintsRef) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	source, ok := r.sources[ref.Hash]
+	if !ok {
+		return "", errorf(ErrCodeConstraintUnavailable, "grith: constraints not found for hash %s", ref.Hash)
+	}
+	return source, nil
+}
+
+// NewConstraintsRef computes a reference to the given CCL source text.
+func NewConstraintsRef(source, uri string) ConstraintsRef {
+	return ConstraintsRef{Hash: SHA256String(source), URI: uri}
+}
+
+// ResolveCovenantConstraints returns the CCL source text governing a
+// covenant. Inline constraints are returned directly; referenced
+// constraints are fetched through resolver and checked against the
+// reference hash.
+func ResolveCovenantConstraints(doc *CovenantDocument, resolver ConstraintResolver) (string, error) {
+	if doc.ConstraintsRef == nil {
+		return doc.Constraints, nil
+	}
+	return resolveConstraintsRef(*doc.ConstraintsRef, resolver)
+}
+
+// ParseCovenantConstraints resolves and parses the CCL governing a covenant.
+func ParseCovenantConstraints(doc *CovenantDocument, resolver ConstraintResolver) (*CCLDocument, error) {
+	source, err := ResolveCovenantConstraints(doc, resolver)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := Parse(source)
+	if err != nil {
+		return nil, errorf(ErrCodeCCLParse, "grith: invalid CCL constraints: %w", err)
+	}
+	return parsed, nil
+}
+
+func resolveConstraintsRef(ref ConstraintsRef, resolver ConstraintResolver) (string, error) {
+	if !isHexDigest(ref.Hash) {
+		return "", errorf(ErrCodeInvalidInput, "grith: constraintsRef.hash must be a 64-char hex SHA-256 digest")
+	}
+	if resolver == nil {
+		return "", errorf(ErrCodeConstraintUnavailable, "grith: constraints by reference require a resolver")
+	}
+	source, err := resolver.ResolveConstraints(ref)
+	if err != nil {
+		if CodeOf(err) != "" {
+			return "", err
+		}
+		return "", errorf(ErrCodeConstraintUnavailable, "grith: failed to resolve constraints %s: %w", ref.Hash, err)
+	}
+	if got := SHA256String(source); got != ref.Hash {
+		return "", errorf(ErrCodeConstraintHashMismatch, "grith: resolved constraints hash %s does not match reference %s", got, ref.Hash)
+	}
+	return source, nil
+}
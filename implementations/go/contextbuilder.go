@@ -0,0 +1,68 @@
+package grith
+
+// ContextBuilder converts typed Go values into the evaluation contexts
+// taken by Evaluate and Enforcer.Check, so callers need not hand-build
+// maps. Values are converted as a JSON round trip would: struct fields
+// are named by their json tags, nested structs become nested maps, and
+// every number becomes a float64, so a field declared as an int32 or a
+// float32 compares against CCL conditions exactly as the number would in
+// a document decoded from JSON. Numbers beyond 2^53 lose precision.
+//
+// Configure a builder with With before use; Build is then safe for
+// concurrent use.
+type ContextBuilder[T any] struct {
+	base map[string]interface{}
+	err  error
+}
+
+// NewContextBuilder creates a builder for contexts of type T.
+func NewContextBuilder[T any]() *ContextBuilder[T] {
+	return &ContextBuilder[T]{base: make(map[string]interface{})}
+}
+
+// With adds an entry, converted like a field of T, to every context the
+// builder builds, such as the deployment environment. A field of the
+// built value with the same name takes precedence. It returns b.
+func (b *ContextBuilder[T]) With(key string, value interface{}) *ContextBuilder[T] {
+	if b.err != nil {
+		return b
+	}
+	v, err := jsonValue(value)
+	if err != nil {
+		b.err = errorf(ErrCodeSerialization, "grith: context entry %q: %w", key, err)
+		return b
+	}
+	b.base[key] = v
+	return b
+}
+
+// Build converts v into a context holding the builder's entries and the
+// fields of v. v must be a struct, a map with string keys, or a pointer
+// to one; a nil pointer yields only the builder's entries.
+func (b *ContextBuilder[T]) Build(v T) (map[string]interface{}, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	converted, err := jsonValue(v)
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "grith: failed to convert context: %w", err)
+	}
+	fields, ok := converted.(map[string]interface{})
+	if !ok && converted != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: context of type %T is not a struct or map", v)
+	}
+	ctx := make(map[string]interface{}, len(b.base)+len(fields))
+	for k, val := range b.base {
+		ctx[k] = val
+	}
+	for k, val := range fields {
+		ctx[k] = val
+	}
+	return ctx, nil
+}
+
+// ToContext converts v into an evaluation context, as a ContextBuilder
+// without entries of its own would.
+func ToContext[T any](v T) (map[string]interface{}, error) {
+	return NewContextBuilder[T]().Build(v)
+}
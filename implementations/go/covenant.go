@@ -1,11 +1,13 @@
 package grith
 
 import (
+	"context"
 	"crypto/ed25519"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"regexp"
+	"io"
+	"log/slog"
 	"strings"
 	"time"
 )
@@ -47,27 +49,59 @@ type CovenantDocument struct {
 	Issuer            Party                  `json:"issuer"`
 	Beneficiary       Party                  `json:"beneficiary"`
 	Constraints       string                 `json:"constraints"`
+	ConstraintsRef    *ConstraintsRef        `json:"constraintsRef,omitempty"`
 	Nonce             string                 `json:"nonce"`
 	CreatedAt         string                 `json:"createdAt"`
 	Signature         string                 `json:"signature"`
 	Chain             *ChainReference        `json:"chain,omitempty"`
 	ExpiresAt         string                 `json:"expiresAt,omitempty"`
 	ActivatesAt       string                 `json:"activatesAt,omitempty"`
+	GracePeriod       int64                  `json:"gracePeriod,omitempty"`
 	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+	MetadataSchema    map[string]interface{} `json:"metadataSchema,omitempty"`
+	Extensions        map[string]Extension   `json:"extensions,omitempty"`
 	Countersignatures []Countersignature     `json:"countersignatures,omitempty"`
+	// Transparency holds receipts from transparency logs. Like
+	// countersignatures, receipts are added after signing and are
+	// excluded from the canonical form.
+	Transparency []TransparencyReceipt `json:"transparency,omitempty"`
+	// Anchors holds existence proofs from external anchors. They commit
+	// to the document ID, so they too are excluded from the canonical form.
+	Anchors []AnchorProof `json:"anchors,omitempty"`
 }
 
+// CheckSeverity qualifies the outcome of a verification check. Only
+// fatal checks affect VerificationResult.Valid; an empty severity is
+// fatal.
+type CheckSeverity string
+
+const (
+	// SeverityFatal marks a check whose failure invalidates the document.
+	SeverityFatal CheckSeverity = "fatal"
+	// SeverityWarning marks a check that needs attention without
+	// invalidating the document, such as an expired document still within
+	// its grace period.
+	SeverityWarning CheckSeverity = "warning"
+	// SeverityInfo marks a purely informational check.
+	SeverityInfo CheckSeverity = "info"
+)
+
 // VerificationCheck is the result of a single verification check.
 type VerificationCheck struct {
-	Name    string `json:"name"`
-	Passed  bool   `json:"passed"`
-	Message string `json:"message"`
+	Name     string        `json:"name"`
+	Code     CheckCode     `json:"code"`
+	Passed   bool          `json:"passed"`
+	Message  string        `json:"message"`
+	Severity CheckSeverity `json:"severity,omitempty"`
 }
 
 // VerificationResult is the complete result of verifying a covenant document.
+// Valid is false only if a fatal check failed; Warnings lists every check
+// with warning severity, so a document can be "valid but expiring soon".
 type VerificationResult struct {
 	Valid    bool                `json:"valid"`
 	Checks  []VerificationCheck `json:"checks"`
+	Warnings []VerificationCheck `json:"warnings,omitempty"`
 	Document *CovenantDocument  `json:"document"`
 }
 
@@ -76,106 +110,161 @@ type CovenantBuilderOptions struct {
 	Issuer      Party
 	Beneficiary Party
 	Constraints string
+	// ConstraintsRef references constraints stored outside the document
+	// instead of inlining them. It is mutually exclusive with Constraints
+	// and requires ConstraintResolver.
+	ConstraintsRef     *ConstraintsRef
+	ConstraintResolver ConstraintResolver
 	PrivateKey  ed25519.PrivateKey
 	Chain       *ChainReference
 	ExpiresAt   string
 	ActivatesAt string
+	// GracePeriod is how long after ExpiresAt verification still passes
+	// with a warning. It is stored in the document in milliseconds.
+	GracePeriod time.Duration
 	Metadata    map[string]interface{}
+	// MetadataSchema, if set, is a JSON Schema that Metadata must satisfy.
+	// It is embedded in the signed document and enforced at verification.
+	MetadataSchema map[string]interface{}
+	// Extensions attach deployment-specific data. Each is signed with the
+	// document; verifiers reject unknown extensions marked critical.
+	Extensions map[string]Extension
 }
 
 // CanonicalForm computes the canonical form of a covenant document.
-// It strips the id, signature, and countersignatures fields, then
-// produces deterministic JSON via JCS (RFC 8785) canonicalization.
+// It strips the id, signature, countersignatures, transparency, and
+// anchors fields, then produces deterministic JSON via JCS (RFC 8785)
+// canonicalization.
 func CanonicalForm(doc *CovenantDocument) (string, error) {
-	// Convert to map, then strip the three mutable fields
-	m, err := objectToMap(doc)
-	if err != nil {
-		return "", fmt.Errorf("grith: failed to convert document to map: %w", err)
-	}
-
-	delete(m, "id")
-	delete(m, "signature")
-	delete(m, "countersignatures")
-
-	canonical, err := CanonicalizeJSON(m)
+	buf, err := canonicalCovenant(doc)
 	if err != nil {
-		return "", fmt.Errorf("grith: failed to canonicalize document: %w", err)
+		return "", err
 	}
-
-	return canonical, nil
+	defer putCanonicalBuffer(buf)
+	return string(*buf), nil
 }
 
 // ComputeID computes the SHA-256 document ID from the canonical form.
 func ComputeID(doc *CovenantDocument) (string, error) {
-	canonical, err := CanonicalForm(doc)
-	if err != nil {
-		return "", err
-	}
-	return SHA256String(canonical), nil
+	return canonicalCovenantID(doc)
 }
 
 // BuildCovenant constructs, signs, and returns a new CovenantDocument.
 // It validates all inputs, parses CCL constraints, generates a nonce,
 // signs the canonical form, and computes the document ID.
 func BuildCovenant(opts *CovenantBuilderOptions) (*CovenantDocument, error) {
+	return BuildCovenantContext(context.Background(), opts)
+}
+
+// BuildCovenantDeterministic is BuildCovenant with a caller-supplied nonce
+// (64 hex characters) and creation time instead of random and wall-clock
+// values. Ed25519 signatures are deterministic, so the same inputs always
+// produce a byte-identical document, ID, and signature. It is meant for
+// golden files and cross-implementation fixtures; production documents
+// should use BuildCovenant so every nonce is fresh.
+func BuildCovenantDeterministic(opts *CovenantBuilderOptions, nonce string, createdAt time.Time) (*CovenantDocument, error) {
+	if !nonceHexValid(nonce) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: nonce must be a 64-char hex string")
+	}
+	if createdAt.IsZero() {
+		return nil, errorf(ErrCodeMissingField, "grith: createdAt is required")
+	}
+	doc, err := buildCovenant(opts, strings.ToLower(nonce), createdAt.UTC().Format("2006-01-02T15:04:05.000Z"))
+	logError(slog.LevelDebug, "covenant build failed", err)
+	return doc, err
+}
+
+// buildCovenant implements BuildCovenant. A non-empty nonce or createdAt
+// is used as-is instead of generating a fresh value.
+func buildCovenant(opts *CovenantBuilderOptions, nonce, createdAt string) (*CovenantDocument, error) {
 	// Validate required inputs
 	if opts.Issuer.ID == "" {
-		return nil, fmt.Errorf("grith: issuer.id is required")
+		return nil, errorf(ErrCodeMissingField, "grith: issuer.id is required")
 	}
 	if opts.Issuer.PublicKey == "" {
-		return nil, fmt.Errorf("grith: issuer.publicKey is required")
+		return nil, errorf(ErrCodeMissingField, "grith: issuer.publicKey is required")
 	}
 	if opts.Issuer.Role != "issuer" {
-		return nil, fmt.Errorf("grith: issuer.role must be 'issuer'")
+		return nil, errorf(ErrCodeInvalidRole, "grith: issuer.role must be 'issuer'")
 	}
 	if opts.Beneficiary.ID == "" {
-		return nil, fmt.Errorf("grith: beneficiary.id is required")
+		return nil, errorf(ErrCodeMissingField, "grith: beneficiary.id is required")
 	}
 	if opts.Beneficiary.PublicKey == "" {
-		return nil, fmt.Errorf("grith: beneficiary.publicKey is required")
+		return nil, errorf(ErrCodeMissingField, "grith: beneficiary.publicKey is required")
 	}
 	if opts.Beneficiary.Role != "beneficiary" {
-		return nil, fmt.Errorf("grith: beneficiary.role must be 'beneficiary'")
+		return nil, errorf(ErrCodeInvalidRole, "grith: beneficiary.role must be 'beneficiary'")
+	}
+	if opts.ConstraintsRef != nil && opts.Constraints != "" {
+		return nil, errorf(ErrCodeInvalidInput, "grith: constraints and constraintsRef are mutually exclusive")
 	}
-	if strings.TrimSpace(opts.Constraints) == "" {
-		return nil, fmt.Errorf("grith: constraints is required")
+	if opts.ConstraintsRef == nil && strings.TrimSpace(opts.Constraints) == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: constraints is required")
 	}
 	if len(opts.PrivateKey) != ed25519.PrivateKeySize {
-		return nil, fmt.Errorf("grith: privateKey must be %d bytes", ed25519.PrivateKeySize)
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: privateKey must be %d bytes", ed25519.PrivateKeySize)
+	}
+
+	// Resolve referenced constraints so they can be validated
+	source := opts.Constraints
+	if opts.ConstraintsRef != nil {
+		resolved, err := resolveConstraintsRef(*opts.ConstraintsRef, opts.ConstraintResolver)
+		if err != nil {
+			return nil, err
+		}
+		source = resolved
 	}
 
 	// Parse CCL to verify syntax and check constraint count
-	parsedCCL, err := Parse(opts.Constraints)
+	parsedCCL, err := parsedConstraints(source)
 	if err != nil {
-		return nil, fmt.Errorf("grith: invalid CCL constraints: %w", err)
+		return nil, errorf(ErrCodeCCLParse, "grith: invalid CCL constraints: %w", err)
 	}
 	if len(parsedCCL.Statements) > MaxConstraints {
-		return nil, fmt.Errorf("grith: constraints exceed maximum of %d statements (got %d)", MaxConstraints, len(parsedCCL.Statements))
+		return nil, errorf(ErrCodeTooManyConstraints, "grith: constraints exceed maximum of %d statements (got %d)", MaxConstraints, len(parsedCCL.Statements))
+	}
+
+	if err := validateExtensionNames(opts.Extensions); err != nil {
+		return nil, err
+	}
+	if err := ValidateMetadata(opts.MetadataSchema, opts.Metadata); err != nil {
+		return nil, err
 	}
 
 	// Validate chain reference
 	if opts.Chain != nil {
 		if opts.Chain.ParentID == "" {
-			return nil, fmt.Errorf("grith: chain.parentId is required")
+			return nil, errorf(ErrCodeInvalidChain, "grith: chain.parentId is required")
 		}
 		if opts.Chain.Relation == "" {
-			return nil, fmt.Errorf("grith: chain.relation is required")
+			return nil, errorf(ErrCodeInvalidChain, "grith: chain.relation is required")
 		}
 		if opts.Chain.Depth < 1 {
-			return nil, fmt.Errorf("grith: chain.depth must be a positive integer")
+			return nil, errorf(ErrCodeInvalidChain, "grith: chain.depth must be a positive integer")
 		}
 		if opts.Chain.Depth > MaxChainDepth {
-			return nil, fmt.Errorf("grith: chain.depth exceeds maximum of %d (got %d)", MaxChainDepth, opts.Chain.Depth)
+			return nil, errorf(ErrCodeChainDepthExceeded, "grith: chain.depth exceeds maximum of %d (got %d)", MaxChainDepth, opts.Chain.Depth)
 		}
 	}
+	if opts.GracePeriod < 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: gracePeriod must not be negative")
+	}
+	if opts.GracePeriod > 0 && opts.ExpiresAt == "" {
+		return nil, errorf(ErrCodeInvalidInput, "grith: gracePeriod requires expiresAt")
+	}
 
 	// Generate nonce and timestamp
-	nonceBytes, err := GenerateNonce()
-	if err != nil {
-		return nil, err
+	if nonce == "" {
+		nonceBytes, err := GenerateNonce()
+		if err != nil {
+			return nil, err
+		}
+		nonce = ToHex(nonceBytes)
+	}
+	if createdAt == "" {
+		createdAt = Timestamp()
 	}
-	nonce := ToHex(nonceBytes)
-	createdAt := Timestamp()
 
 	// Construct the document
 	doc := &CovenantDocument{
@@ -189,6 +278,10 @@ func BuildCovenant(opts *CovenantBuilderOptions) (*CovenantDocument, error) {
 		Signature:   "",
 	}
 
+	if opts.ConstraintsRef != nil {
+		ref := *opts.ConstraintsRef
+		doc.ConstraintsRef = &ref
+	}
 	if opts.Chain != nil {
 		doc.Chain = opts.Chain
 	}
@@ -198,9 +291,18 @@ func BuildCovenant(opts *CovenantBuilderOptions) (*CovenantDocument, error) {
 	if opts.ActivatesAt != "" {
 		doc.ActivatesAt = opts.ActivatesAt
 	}
+	if opts.GracePeriod > 0 {
+		doc.GracePeriod = opts.GracePeriod.Milliseconds()
+	}
 	if opts.Metadata != nil {
 		doc.Metadata = opts.Metadata
 	}
+	if opts.MetadataSchema != nil {
+		doc.MetadataSchema = opts.MetadataSchema
+	}
+	if len(opts.Extensions) > 0 {
+		doc.Extensions = opts.Extensions
+	}
 
 	// Compute canonical form, sign, and derive ID
 	canonical, err := CanonicalForm(doc)
@@ -210,57 +312,164 @@ func BuildCovenant(opts *CovenantBuilderOptions) (*CovenantDocument, error) {
 
 	sigBytes, err := Sign([]byte(canonical), opts.PrivateKey)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to sign covenant: %w", err)
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign covenant: %w", err)
 	}
 	doc.Signature = ToHex(sigBytes)
 	doc.ID = SHA256String(canonical)
 
 	// Validate serialized size
-	serialized, err := json.Marshal(doc)
+	size, err := documentSize(doc)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to serialize covenant: %w", err)
+		return nil, errorf(ErrCodeSerialization, "grith: failed to serialize covenant: %w", err)
 	}
-	if len(serialized) > MaxDocumentSize {
-		return nil, fmt.Errorf("grith: serialized document exceeds maximum size of %d bytes", MaxDocumentSize)
+	if size > MaxDocumentSize {
+		return nil, errorf(ErrCodeDocumentTooLarge, "grith: serialized document exceeds maximum size of %d bytes", MaxDocumentSize)
 	}
 
 	return doc, nil
 }
 
-// VerifyCovenant runs all 11 specification checks on a covenant document.
+// VerifyOptions configure VerifyCovenantWithOptions. The zero value
+// verifies exactly as VerifyCovenant does.
+type VerifyOptions struct {
+	// ConstraintResolver resolves constraints stored by reference. Without
+	// one, the ccl_parses check fails for documents using constraintsRef.
+	ConstraintResolver ConstraintResolver
+
+	// NonceRegistry, if set, adds a nonce_unique check that records the
+	// issuer's nonce and fails if it was already used by a different
+	// document. Nonces are only recorded for correctly signed documents.
+	NonceRegistry NonceRegistry
+
+	// ExpiryWarning, if set, gives not_expired a warning severity when the
+	// document expires within this window.
+	ExpiryWarning time.Duration
+
+	// WarnUncountersigned gives the countersignatures check a warning
+	// severity when the document has no countersignatures.
+	WarnUncountersigned bool
+
+	// Now, if set, is the instant at which the not_expired and active
+	// checks are evaluated, e.g. the time of a logged action. Defaults to
+	// the current time.
+	Now time.Time
+
+	// DIDResolver resolves parties identified by DIDs. Without one, only
+	// did:key identifiers can be resolved.
+	DIDResolver DIDResolver
+
+	// Extensions lists the extensions this verifier understands. A nil
+	// handler accepts the extension without inspecting its value.
+	// Documents carrying a critical extension not listed here fail the
+	// extensions check.
+	Extensions map[string]ExtensionHandler
+
+	// MetadataSchema, if set, is a JSON Schema from the issuer's profile
+	// that the document's metadata must satisfy, in addition to any schema
+	// embedded in the document itself.
+	MetadataSchema map[string]interface{}
+
+	// TransparencyLogs, if set, adds a transparency check requiring at
+	// least one valid receipt from one of these logs.
+	TransparencyLogs []TrustedLog
+
+	// Anchors, if set, adds an anchored check requiring at least one
+	// complete anchor proof verified by one of these anchors.
+	Anchors []Anchor
+
+	// Revocations, if set, adds a not_revoked check failing documents
+	// whose issuer key was revoked as compromised at or before Now.
+	Revocations []IdentityRevocation
+
+	// IdentityRegistry, if set, adds an issuer_identity check resolving
+	// the issuer's Party.ID to its latest registered identity, which must
+	// be held under the issuer's key and not be revoked.
+	IdentityRegistry *IdentityRegistry
+
+	// Profile names a verification profile (see RegisterProfile) that
+	// selects which checks run and how strictly they are judged. Empty
+	// runs every check with its own severity.
+	Profile string
+}
+
+// VerifyCovenant runs all 11 specification checks on a covenant document
+// using default options.
+func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
+	return VerifyCovenantWithOptions(doc, nil)
+}
+
+// VerifyCovenantWithOptions runs all 11 specification checks on a covenant
+// document.
 //
 // Checks:
 //  1. id_match          - Document ID matches SHA-256 of canonical form
 //  2. signature_valid   - Issuer's Ed25519 signature is valid
-//  3. not_expired       - Current time is before expiresAt (if set)
+//  3. not_expired       - Current time is before expiresAt (if set); passes
+//     with a warning severity while within the grace period
 //  4. active            - Current time is after activatesAt (if set)
-//  5. ccl_parses        - Constraints parse as valid CCL
+//  5. ccl_parses        - Constraints (inline or resolved by reference) parse as valid CCL
 //  6. enforcement_valid - Enforcement config is valid (always passes without enforcement)
 //  7. proof_valid       - Proof config is valid (always passes without proof)
 //  8. chain_depth       - Chain depth does not exceed MaxChainDepth
 //  9. document_size     - Serialized size does not exceed MaxDocumentSize
 //  10. countersignatures - All countersignatures are valid
 //  11. nonce_present     - Nonce is present and valid (64-char hex)
-func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
+//
+// Additional checks are appended only when relevant:
+//   - nonce_unique      - opts.NonceRegistry is set
+//   - did_binding       - a party is identified by a DID
+//   - extensions        - the document carries extensions
+//   - metadata_schema   - the document or opts declares a metadata schema
+//   - transparency      - opts.TransparencyLogs is set
+//   - anchored          - opts.Anchors is set
+//   - not_revoked       - opts.Revocations is set
+//   - issuer_identity   - opts.IdentityRegistry is set
+//   - version_supported - fails when the version is not a supported 1.x revision
+//
+// Checks registered with RegisterCheck follow the built-in checks. A
+// profile selected by opts.Profile may skip checks or adjust their
+// severities; an unknown profile is an error.
+func VerifyCovenantWithOptions(doc *CovenantDocument, opts *VerifyOptions) (*VerificationResult, error) {
+	return VerifyCovenantContext(context.Background(), doc, opts)
+}
+
+// verifyCovenant runs the verification checks against a precomputed
+// canonical form.
+func verifyCovenant(doc *CovenantDocument, canonical string, canonErr error, opts *VerifyOptions) (*VerificationResult, error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	profile, err := resolveProfile(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
 	var checks []VerificationCheck
 	now := time.Now().UTC()
+	if !opts.Now.IsZero() {
+		now = opts.Now.UTC()
+	}
+	resolver := newMemoResolver(opts.DIDResolver)
 
 	// 1. ID match
-	expectedID, err := ComputeID(doc)
+	err = canonErr
+	expectedID := SHA256String(canonical)
+	idMatch := false
 	if err != nil {
 		checks = append(checks, VerificationCheck{
 			Name:    "id_match",
+			Code:    CheckIDMatch,
 			Passed:  false,
 			Message: fmt.Sprintf("Failed to compute ID: %v", err),
 		})
 	} else {
-		idMatch := doc.ID == expectedID
+		idMatch = doc.ID == expectedID
 		msg := "Document ID matches canonical hash"
 		if !idMatch {
 			msg = fmt.Sprintf("ID mismatch: expected %s, got %s", expectedID, doc.ID)
 		}
 		checks = append(checks, VerificationCheck{
 			Name:    "id_match",
+			Code:    CheckIDMatch,
 			Passed:  idMatch,
 			Message: msg,
 		})
@@ -268,6 +477,9 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 
 	// 2. Signature valid
 	sigValid := false
+	// issuerKey is the issuer's key in hex, whether it is given as hex
+	// or as a DID, so both forms share a nonce namespace.
+	issuerKey := doc.Issuer.PublicKey
 	func() {
 		defer func() {
 			if r := recover(); r != nil {
@@ -275,19 +487,19 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 			}
 		}()
 
-		canonical, cerr := CanonicalForm(doc)
-		if cerr != nil {
+		if canonErr != nil {
 			return
 		}
-		sigBytes, herr := FromHex(doc.Signature)
-		if herr != nil {
+		pubKey, perr := resolvePartyKey(doc.Issuer, resolver)
+		if perr != nil {
 			return
 		}
-		pubKeyBytes, perr := FromHex(doc.Issuer.PublicKey)
-		if perr != nil {
+		issuerKey = ToHex(pubKey)
+		sigBytes, herr := FromHex(doc.Signature)
+		if herr != nil {
 			return
 		}
-		sigValid = Verify([]byte(canonical), sigBytes, ed25519.PublicKey(pubKeyBytes))
+		sigValid = Verify([]byte(canonical), sigBytes, pubKey)
 	}()
 
 	sigMsg := "Issuer signature is valid"
@@ -296,30 +508,43 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 	}
 	checks = append(checks, VerificationCheck{
 		Name:    "signature_valid",
+		Code:    CheckSignatureValid,
 		Passed:  sigValid,
 		Message: sigMsg,
 	})
 
 	// 3. Not expired
 	if doc.ExpiresAt != "" {
-		expires, perr := time.Parse(time.RFC3339Nano, doc.ExpiresAt)
-		if perr != nil {
-			// Try other formats
-			expires, perr = time.Parse("2006-01-02T15:04:05.000Z", doc.ExpiresAt)
-		}
+		expires, perr := parseTimestamp(doc.ExpiresAt)
 		notExpired := perr == nil && now.Before(expires)
 		msg := "Document has not expired"
+		var severity CheckSeverity
+		if notExpired && opts.ExpiryWarning > 0 && expires.Sub(now) <= opts.ExpiryWarning {
+			severity = SeverityWarning
+			msg = fmt.Sprintf("Document expires at %s, in %s", doc.ExpiresAt, expires.Sub(now).Round(time.Second))
+		}
 		if !notExpired {
 			msg = fmt.Sprintf("Document expired at %s", doc.ExpiresAt)
+			if perr == nil && doc.GracePeriod > 0 {
+				graceEnd := expires.Add(doc.GracePeriodDuration())
+				if now.Before(graceEnd) {
+					notExpired = true
+					severity = SeverityWarning
+					msg = fmt.Sprintf("Document expired at %s; within grace period until %s", doc.ExpiresAt, graceEnd.Format(time.RFC3339Nano))
+				}
+			}
 		}
 		checks = append(checks, VerificationCheck{
-			Name:    "not_expired",
-			Passed:  notExpired,
-			Message: msg,
+			Name:     "not_expired",
+			Code:     CheckNotExpired,
+			Passed:   notExpired,
+			Message:  msg,
+			Severity: severity,
 		})
 	} else {
 		checks = append(checks, VerificationCheck{
 			Name:    "not_expired",
+			Code:    CheckNotExpired,
 			Passed:  true,
 			Message: "No expiry set",
 		})
@@ -327,10 +552,7 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 
 	// 4. Active
 	if doc.ActivatesAt != "" {
-		activates, perr := time.Parse(time.RFC3339Nano, doc.ActivatesAt)
-		if perr != nil {
-			activates, perr = time.Parse("2006-01-02T15:04:05.000Z", doc.ActivatesAt)
-		}
+		activates, perr := parseTimestamp(doc.ActivatesAt)
 		isActive := perr == nil && !now.Before(activates)
 		msg := "Document is active"
 		if !isActive {
@@ -338,12 +560,14 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 		}
 		checks = append(checks, VerificationCheck{
 			Name:    "active",
+			Code:    CheckActive,
 			Passed:  isActive,
 			Message: msg,
 		})
 	} else {
 		checks = append(checks, VerificationCheck{
 			Name:    "active",
+			Code:    CheckActive,
 			Passed:  true,
 			Message: "No activation time set",
 		})
@@ -352,8 +576,11 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 	// 5. CCL parses
 	cclParses := false
 	cclMsg := ""
-	parsed, cerr := Parse(doc.Constraints)
-	if cerr != nil {
+	source, rerr := ResolveCovenantConstraints(doc, opts.ConstraintResolver)
+	parsed, cerr := parsedConstraints(source)
+	if rerr != nil {
+		cclMsg = fmt.Sprintf("Constraints unavailable: %v", rerr)
+	} else if cerr != nil {
 		cclMsg = fmt.Sprintf("CCL parse error: %v", cerr)
 	} else if len(parsed.Statements) > MaxConstraints {
 		cclMsg = fmt.Sprintf("Constraints exceed maximum of %d statements", MaxConstraints)
@@ -363,6 +590,7 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 	}
 	checks = append(checks, VerificationCheck{
 		Name:    "ccl_parses",
+		Code:    CheckCCLParses,
 		Passed:  cclParses,
 		Message: cclMsg,
 	})
@@ -370,6 +598,7 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 	// 6. Enforcement valid (always passes when no enforcement config)
 	checks = append(checks, VerificationCheck{
 		Name:    "enforcement_valid",
+		Code:    CheckEnforcementValid,
 		Passed:  true,
 		Message: "No enforcement config present",
 	})
@@ -377,6 +606,7 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 	// 7. Proof valid (always passes when no proof config)
 	checks = append(checks, VerificationCheck{
 		Name:    "proof_valid",
+		Code:    CheckProofValid,
 		Passed:  true,
 		Message: "No proof config present",
 	})
@@ -390,58 +620,42 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 		}
 		checks = append(checks, VerificationCheck{
 			Name:    "chain_depth",
+			Code:    CheckChainDepth,
 			Passed:  depthOk,
 			Message: msg,
 		})
 	} else {
 		checks = append(checks, VerificationCheck{
 			Name:    "chain_depth",
+			Code:    CheckChainDepth,
 			Passed:  true,
 			Message: "No chain reference present",
 		})
 	}
 
 	// 9. Document size
-	serialized, serErr := json.Marshal(doc)
-	sizeOk := serErr == nil && len(serialized) <= MaxDocumentSize
-	sizeMsg := fmt.Sprintf("Document size %d bytes is within limit", len(serialized))
+	size, serErr := documentSize(doc)
+	sizeOk := serErr == nil && size <= MaxDocumentSize
+	sizeMsg := fmt.Sprintf("Document size %d bytes is within limit", size)
 	if !sizeOk {
-		sizeMsg = fmt.Sprintf("Document size %d bytes exceeds maximum of %d", len(serialized), MaxDocumentSize)
+		sizeMsg = fmt.Sprintf("Document size %d bytes exceeds maximum of %d", size, MaxDocumentSize)
 	}
 	checks = append(checks, VerificationCheck{
 		Name:    "document_size",
+		Code:    CheckDocumentSize,
 		Passed:  sizeOk,
 		Message: sizeMsg,
 	})
 
 	// 10. Countersignatures
-	if len(doc.Countersignatures) > 0 {
+	if profile.skips("countersignatures") {
+		// Not verified under this profile
+	} else if len(doc.Countersignatures) > 0 {
 		allCSValid := true
 		var failedSigners []string
 
 		for _, cs := range doc.Countersignatures {
-			csValid := false
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						csValid = false
-					}
-				}()
-
-				canonical, cerr := CanonicalForm(doc)
-				if cerr != nil {
-					return
-				}
-				csSigBytes, herr := FromHex(cs.Signature)
-				if herr != nil {
-					return
-				}
-				csPubKeyBytes, perr := FromHex(cs.SignerPublicKey)
-				if perr != nil {
-					return
-				}
-				csValid = Verify([]byte(canonical), csSigBytes, ed25519.PublicKey(csPubKeyBytes))
-			}()
+			csValid := canonErr == nil && verifyCountersignature(canonical, cs)
 
 			if !csValid {
 				allCSValid = false
@@ -459,20 +673,26 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 		}
 		checks = append(checks, VerificationCheck{
 			Name:    "countersignatures",
+			Code:    CheckCountersignatures,
 			Passed:  allCSValid,
 			Message: csMsg,
 		})
 	} else {
+		var severity CheckSeverity
+		if opts.WarnUncountersigned {
+			severity = SeverityWarning
+		}
 		checks = append(checks, VerificationCheck{
-			Name:    "countersignatures",
-			Passed:  true,
-			Message: "No countersignatures present",
+			Name:     "countersignatures",
+			Code:     CheckCountersignatures,
+			Passed:   true,
+			Message:  "No countersignatures present",
+			Severity: severity,
 		})
 	}
 
 	// 11. Nonce present
-	nonceHexRegex := regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
-	nonceOk := nonceHexRegex.MatchString(doc.Nonce)
+	nonceOk := nonceHexValid(doc.Nonce)
 	nonceMsg := "Nonce is present and valid (64-char hex)"
 	if !nonceOk {
 		if doc.Nonce == "" {
@@ -483,26 +703,98 @@ func VerifyCovenant(doc *CovenantDocument) (*VerificationResult, error) {
 	}
 	checks = append(checks, VerificationCheck{
 		Name:    "nonce_present",
+		Code:    CheckNoncePresent,
 		Passed:  nonceOk,
 		Message: nonceMsg,
 	})
 
-	// Aggregate
-	valid := true
-	for _, c := range checks {
-		if !c.Passed {
-			valid = false
-			break
-		}
+	// Optional: nonce replay detection
+	if opts.NonceRegistry != nil && !profile.skips("nonce_unique") {
+		// The ID is not covered by the signature, so a nonce is recorded
+		// only for a document whose ID also checks out; otherwise a signed
+		// document replayed under a forged ID would claim its nonce.
+		checks = append(checks, checkNonceUnique(doc, issuerKey, opts.NonceRegistry, nonceOk && sigValid && idMatch))
+	}
+
+	// DIDs: party keys must resolve and be bound to their DIDs
+	if usesDIDs(doc) && !profile.skips("did_binding") {
+		checks = append(checks, checkDIDBinding(doc, resolver))
+	}
+
+	// Extensions: unknown critical extensions fail verification
+	if len(doc.Extensions) > 0 && !profile.skips("extensions") {
+		checks = append(checks, checkExtensions(doc, opts.Extensions))
+	}
+
+	// Metadata schema: embedded and/or supplied by the verifier
+	if (doc.MetadataSchema != nil || opts.MetadataSchema != nil) && !profile.skips("metadata_schema") {
+		checks = append(checks, checkMetadataSchema(doc, opts.MetadataSchema))
+	}
+
+	// Transparency: receipts from trusted logs
+	if len(opts.TransparencyLogs) > 0 && !profile.skips("transparency") {
+		checks = append(checks, checkTransparency(doc, opts.TransparencyLogs))
 	}
 
+	// Anchored: an existence proof from an external anchor
+	if len(opts.Anchors) > 0 && !profile.skips("anchored") {
+		checks = append(checks, checkAnchored(doc, opts.Anchors))
+	}
+
+	// Revocation: the issuer key must not have been compromised
+	if len(opts.Revocations) > 0 && !profile.skips("not_revoked") {
+		checks = append(checks, checkIssuerNotRevoked(doc, opts.Revocations, resolver, now))
+	}
+
+	// Issuer identity: the issuer must be a registered agent identity
+	if opts.IdentityRegistry != nil && !profile.skips("issuer_identity") {
+		checks = append(checks, checkIssuerIdentity(doc, opts.IdentityRegistry, resolver, opts.Revocations, now))
+	}
+
+	// Documents from an unsupported protocol version cannot be verified
+	if !IsSupportedVersion(doc.Version) {
+		checks = append(checks, VerificationCheck{
+			Name:    "version_supported",
+			Code:    CheckVersionSupported,
+			Passed:  false,
+			Message: fmt.Sprintf("Unsupported protocol version: %q", doc.Version),
+		})
+	}
+
+	// Custom checks registered with RegisterCheck run last
+	checks = append(checks, runCustomChecks(doc, opts, profile)...)
+	checks = profile.apply(checks)
+	observeCheckFailures(checks)
+	logCheckFailures(doc, checks)
+
+	valid, warnings := aggregateChecks(checks)
 	return &VerificationResult{
 		Valid:    valid,
-		Checks:  checks,
+		Checks:   checks,
+		Warnings: warnings,
 		Document: doc,
 	}, nil
 }
 
+// aggregateChecks reports whether no fatal check failed, and collects
+// the checks with warning severity.
+func aggregateChecks(checks []VerificationCheck) (bool, []VerificationCheck) {
+	valid := true
+	var warnings []VerificationCheck
+	for _, c := range checks {
+		switch c.Severity {
+		case SeverityWarning:
+			warnings = append(warnings, c)
+		case SeverityInfo:
+		default:
+			if !c.Passed {
+				valid = false
+			}
+		}
+	}
+	return valid, warnings
+}
+
 // CountersignCovenant adds a countersignature from a third party.
 // The countersigner signs the canonical form (which excludes existing
 // countersignatures), so each countersignature is independent.
@@ -512,10 +804,14 @@ func CountersignCovenant(doc *CovenantDocument, kp *KeyPair, role string) (*Cove
 	if err != nil {
 		return nil, err
 	}
+	return countersign(doc, canonical, kp, role)
+}
 
+// countersign appends a countersignature over a precomputed canonical form.
+func countersign(doc *CovenantDocument, canonical string, kp *KeyPair, role string) (*CovenantDocument, error) {
 	sigBytes, err := Sign([]byte(canonical), kp.PrivateKey)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to countersign: %w", err)
+		return nil, errorf(ErrCodeCrypto, "grith: failed to countersign: %w", err)
 	}
 
 	cs := Countersignature{
@@ -534,84 +830,238 @@ func CountersignCovenant(doc *CovenantDocument, kp *KeyPair, role string) (*Cove
 	return &newDoc, nil
 }
 
+// verifyCountersignature reports whether cs is a valid signature over
+// the canonical form.
+func verifyCountersignature(canonical string, cs Countersignature) bool {
+	sig, err := FromHex(cs.Signature)
+	if err != nil {
+		return false
+	}
+	pub, err := FromHex(cs.SignerPublicKey)
+	if err != nil {
+		return false
+	}
+	return Verify([]byte(canonical), sig, ed25519.PublicKey(pub))
+}
+
+// ResignCovenant re-signs a covenant document with a fresh nonce, for
+// example after MigrateDocument. Existing countersignatures, transparency
+// receipts, and anchor proofs are dropped because the new ID invalidates
+// them. Returns a new
+// document; the original is not mutated.
+func ResignCovenant(doc *CovenantDocument, privateKey ed25519.PrivateKey) (*CovenantDocument, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: privateKey must be %d bytes", ed25519.PrivateKeySize)
+	}
+	nonceBytes, err := GenerateNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	newDoc := doc.Clone()
+	newDoc.Nonce = ToHex(nonceBytes)
+	newDoc.Countersignatures = nil
+	newDoc.Transparency = nil
+	newDoc.Anchors = nil
+
+	canonical, err := CanonicalForm(newDoc)
+	if err != nil {
+		return nil, err
+	}
+	sigBytes, err := Sign([]byte(canonical), privateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign covenant: %w", err)
+	}
+	newDoc.Signature = ToHex(sigBytes)
+	newDoc.ID = SHA256String(canonical)
+	return newDoc, nil
+}
+
+// documentSize returns the length of doc's canonical JSON, computed
+// without reflection. It has the members of doc's serialization, escaped
+// and formatted the same way, so the lengths agree except where metadata
+// holds json.Number literals, which canonicalization normalizes.
+func documentSize(doc *CovenantDocument) (int, error) {
+	canonical, err := CanonicalizeJSON(doc)
+	return len(canonical), err
+}
+
 // SerializeCovenant serializes a covenant document to a JSON string.
 func SerializeCovenant(doc *CovenantDocument) (string, error) {
 	b, err := json.Marshal(doc)
 	if err != nil {
-		return "", fmt.Errorf("grith: failed to serialize covenant: %w", err)
+		return "", errorf(ErrCodeSerialization, "grith: failed to serialize covenant: %w", err)
 	}
 	return string(b), nil
 }
 
 // DeserializeCovenant parses a JSON string into a CovenantDocument.
 // It performs structural validation to ensure all required fields are present.
+// Compressed envelopes produced by SerializeCovenantWithOptions are
+// decompressed first; the size limit applies to the decompressed form.
 func DeserializeCovenant(jsonStr string) (*CovenantDocument, error) {
-	var doc CovenantDocument
-	if err := json.Unmarshal([]byte(jsonStr), &doc); err != nil {
-		return nil, fmt.Errorf("grith: invalid JSON: %w", err)
+	return ReadCovenant(strings.NewReader(jsonStr))
+}
+
+// ReadCovenant decodes a covenant document from r as DeserializeCovenant
+// does, streaming the JSON into the document rather than buffering it.
+// At most MaxDocumentSize bytes are read: a larger payload fails with
+// ErrCodeDocumentTooLarge as soon as it passes the limit.
+func ReadCovenant(r io.Reader) (*CovenantDocument, error) {
+	var wire struct {
+		CovenantDocument
+		compressedEnvelope
+	}
+	if err := decodeJSONLimited(r, MaxDocumentSize, "document", &wire); err != nil {
+		return nil, err
+	}
+	doc := &wire.CovenantDocument
+	if wire.ContentEncoding != "" {
+		plain, err := decompressCovenant(&wire.compressedEnvelope)
+		if err != nil {
+			return nil, err
+		}
+		doc = &CovenantDocument{}
+		if err := json.Unmarshal(plain, doc); err != nil {
+			return nil, errorf(ErrCodeInvalidJSON, "grith: invalid JSON: %w", err)
+		}
 	}
 
 	// Validate required fields
 	if doc.ID == "" {
-		return nil, fmt.Errorf("grith: missing required field: id")
+		return nil, errorf(ErrCodeMissingField, "grith: missing required field: id")
 	}
 	if doc.Version == "" {
-		return nil, fmt.Errorf("grith: missing required field: version")
+		return nil, errorf(ErrCodeMissingField, "grith: missing required field: version")
+	}
+	h, ok := handlerFor(doc.Version)
+	if !ok {
+		return nil, errorf(ErrCodeUnsupportedVersion, "grith: unsupported protocol version: %s (supported: 1.x)", doc.Version)
 	}
-	if doc.Version != ProtocolVersion {
-		return nil, fmt.Errorf("grith: unsupported protocol version: %s (expected %s)", doc.Version, ProtocolVersion)
+	if err := h.validate(doc); err != nil {
+		return nil, err
 	}
+	return doc, nil
+}
+
+// validateV1Document performs structural validation of a protocol 1.x
+// document.
+func validateV1Document(doc *CovenantDocument) error {
 	if doc.Issuer.ID == "" || doc.Issuer.PublicKey == "" || doc.Issuer.Role != "issuer" {
-		return nil, fmt.Errorf("grith: invalid issuer: must have id, publicKey, and role='issuer'")
+		return errorf(ErrCodeInvalidParty, "grith: invalid issuer: must have id, publicKey, and role='issuer'")
 	}
 	if doc.Beneficiary.ID == "" || doc.Beneficiary.PublicKey == "" || doc.Beneficiary.Role != "beneficiary" {
-		return nil, fmt.Errorf("grith: invalid beneficiary: must have id, publicKey, and role='beneficiary'")
+		return errorf(ErrCodeInvalidParty, "grith: invalid beneficiary: must have id, publicKey, and role='beneficiary'")
 	}
-	if doc.Constraints == "" {
-		return nil, fmt.Errorf("grith: missing required field: constraints")
+	if doc.Constraints == "" && doc.ConstraintsRef == nil {
+		return errorf(ErrCodeMissingField, "grith: missing required field: constraints")
 	}
 	if doc.Nonce == "" {
-		return nil, fmt.Errorf("grith: missing required field: nonce")
+		return errorf(ErrCodeMissingField, "grith: missing required field: nonce")
 	}
 	if doc.CreatedAt == "" {
-		return nil, fmt.Errorf("grith: missing required field: createdAt")
+		return errorf(ErrCodeMissingField, "grith: missing required field: createdAt")
 	}
 	if doc.Signature == "" {
-		return nil, fmt.Errorf("grith: missing required field: signature")
+		return errorf(ErrCodeMissingField, "grith: missing required field: signature")
+	}
+
+	if err := validateExtensionNames(doc.Extensions); err != nil {
+		return err
 	}
 
 	// Validate chain if present
 	if doc.Chain != nil {
 		if doc.Chain.ParentID == "" {
-			return nil, fmt.Errorf("grith: invalid chain.parentId: must be a string")
+			return errorf(ErrCodeInvalidChain, "grith: invalid chain.parentId: must be a string")
 		}
 		if doc.Chain.Relation == "" {
-			return nil, fmt.Errorf("grith: invalid chain.relation: must be a string")
+			return errorf(ErrCodeInvalidChain, "grith: invalid chain.relation: must be a string")
 		}
 	}
-
-	// Validate document size
-	if len(jsonStr) > MaxDocumentSize {
-		return nil, fmt.Errorf("grith: document size %d bytes exceeds maximum of %d bytes", len(jsonStr), MaxDocumentSize)
-	}
-
-	return &doc, nil
+	return nil
 }
 
 // ValidateChainNarrowing validates that a child covenant only narrows
-// the constraints of its parent.
-func ValidateChainNarrowing(child, parent *CovenantDocument) (*NarrowingResult, error) {
-	parentCCL, err := Parse(parent.Constraints)
+// the constraints of its parent. Constraints stored by reference are
+// fetched through resolver, which may be nil if neither covenant uses
+// ConstraintsRef.
+func ValidateChainNarrowing(child, parent *CovenantDocument, resolver ConstraintResolver) (*NarrowingResult, error) {
+	parentCCL, err := ParseCovenantConstraints(parent, resolver)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to parse parent constraints: %w", err)
+		return nil, err
 	}
-	childCCL, err := Parse(child.Constraints)
+	childCCL, err := ParseCovenantConstraints(child, resolver)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to parse child constraints: %w", err)
+		return nil, err
 	}
 	return ValidateNarrowing(parentCCL, childCCL), nil
 }
 
+// checkMetadataSchema validates the document's metadata against its
+// embedded schema and the verifier-supplied schema, if any.
+func checkMetadataSchema(doc *CovenantDocument, profileSchema map[string]interface{}) VerificationCheck {
+	check := VerificationCheck{Name: "metadata_schema", Code: CheckMetadataSchema, Passed: true, Message: "Metadata matches schema"}
+	for _, schema := range []map[string]interface{}{doc.MetadataSchema, profileSchema} {
+		if err := ValidateMetadata(schema, doc.Metadata); err != nil {
+			check.Passed = false
+			check.Message = err.Error()
+			break
+		}
+	}
+	return check
+}
+
+// checkNonceUnique records the document's nonce in registry under the
+// issuer's hex key and reports whether the issuer previously used it for
+// a different document. When record is false the registry is only
+// consulted, never updated.
+func checkNonceUnique(doc *CovenantDocument, issuerKey string, registry NonceRegistry, record bool) VerificationCheck {
+	check := VerificationCheck{Name: "nonce_unique", Code: CheckNonceUnique}
+
+	var firstID string
+	var replayed bool
+	var err error
+	if record {
+		firstID, replayed, err = registry.Record(issuerKey, doc.Nonce, doc.ID)
+	} else {
+		var ok bool
+		firstID, ok, err = registry.Lookup(issuerKey, doc.Nonce)
+		replayed = ok && firstID != doc.ID
+	}
+
+	switch {
+	case err != nil:
+		check.Message = fmt.Sprintf("Nonce registry error: %v", err)
+	case replayed:
+		check.Message = fmt.Sprintf("Nonce was already used by issuer in document %s", firstID)
+	default:
+		check.Passed = true
+		check.Message = "Nonce has not been used in another document by this issuer"
+	}
+	return check
+}
+
+// GracePeriodDuration returns the document's grace period as a
+// time.Duration. Negative values are treated as zero.
+func (doc *CovenantDocument) GracePeriodDuration() time.Duration {
+	if doc.GracePeriod <= 0 {
+		return 0
+	}
+	return time.Duration(doc.GracePeriod) * time.Millisecond
+}
+
+// parseTimestamp parses an ISO 8601 timestamp as produced by Timestamp,
+// falling back to the fixed millisecond layout.
+func parseTimestamp(ts string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		// Try other formats
+		t, err = time.Parse("2006-01-02T15:04:05.000Z", ts)
+	}
+	return t, err
+}
+
 // nonceHexValid checks if a nonce is a valid 64-character hex string.
 func nonceHexValid(nonce string) bool {
 	if len(nonce) != 64 {
@@ -6,10 +6,6 @@ import (
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
-	"encoding/json"
-	"fmt"
-	"sort"
-	"strings"
 	"time"
 )
 
@@ -25,7 +21,7 @@ type KeyPair struct {
 func GenerateKeyPair() (*KeyPair, error) {
 	pub, priv, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to generate Ed25519 key pair: %w", err)
+		return nil, errorf(ErrCodeCrypto, "grith: failed to generate Ed25519 key pair: %w", err)
 	}
 	return &KeyPair{
 		PrivateKey:   priv,
@@ -39,7 +35,7 @@ func GenerateKeyPair() (*KeyPair, error) {
 // format which includes the public key suffix).
 func KeyPairFromPrivateKey(privateKey ed25519.PrivateKey) (*KeyPair, error) {
 	if len(privateKey) != ed25519.PrivateKeySize {
-		return nil, fmt.Errorf("grith: private key must be %d bytes, got %d", ed25519.PrivateKeySize, len(privateKey))
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: private key must be %d bytes, got %d", ed25519.PrivateKeySize, len(privateKey))
 	}
 	pub := privateKey.Public().(ed25519.PublicKey)
 	keyCopy := make(ed25519.PrivateKey, len(privateKey))
@@ -55,7 +51,7 @@ func KeyPairFromPrivateKey(privateKey ed25519.PrivateKey) (*KeyPair, error) {
 // the 64-byte signature.
 func Sign(message []byte, privateKey ed25519.PrivateKey) ([]byte, error) {
 	if len(privateKey) != ed25519.PrivateKeySize {
-		return nil, fmt.Errorf("grith: private key must be %d bytes, got %d", ed25519.PrivateKeySize, len(privateKey))
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: private key must be %d bytes, got %d", ed25519.PrivateKeySize, len(privateKey))
 	}
 	sig := ed25519.Sign(privateKey, message)
 	return sig, nil
@@ -101,91 +97,16 @@ func SHA256Object(obj interface{}) (string, error) {
 // nesting level. The output is identical regardless of the original
 // key insertion order.
 func CanonicalizeJSON(obj interface{}) (string, error) {
-	sorted := sortKeys(obj)
-	b, err := json.Marshal(sorted)
+	buf := getCanonicalBuffer()
+	defer putCanonicalBuffer(buf)
+	b, err := appendCanonicalJSON((*buf)[:0], obj)
 	if err != nil {
-		return "", fmt.Errorf("grith: failed to marshal canonical JSON: %w", err)
+		return "", errorf(ErrCodeCanonicalization, "grith: failed to marshal canonical JSON: %w", err)
 	}
+	*buf = b
 	return string(b), nil
 }
 
-// sortKeys recursively sorts map keys and processes all nested structures.
-func sortKeys(value interface{}) interface{} {
-	if value == nil {
-		return nil
-	}
-
-	switch v := value.(type) {
-	case map[string]interface{}:
-		keys := make([]string, 0, len(v))
-		for k := range v {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		ordered := &orderedMap{keys: keys, values: make(map[string]interface{}, len(v))}
-		for _, k := range keys {
-			child := v[k]
-			if child == nil {
-				// Preserve explicit null values
-				ordered.values[k] = nil
-				ordered.hasNil = append(ordered.hasNil, k)
-			} else {
-				ordered.values[k] = sortKeys(child)
-			}
-		}
-		return ordered
-	case []interface{}:
-		result := make([]interface{}, len(v))
-		for i, item := range v {
-			result[i] = sortKeys(item)
-		}
-		return result
-	default:
-		return value
-	}
-}
-
-// orderedMap preserves key order during JSON marshaling.
-type orderedMap struct {
-	keys   []string
-	values map[string]interface{}
-	hasNil []string // keys that have explicit nil values
-}
-
-func (o *orderedMap) MarshalJSON() ([]byte, error) {
-	var buf strings.Builder
-	buf.WriteByte('{')
-	nilSet := make(map[string]bool, len(o.hasNil))
-	for _, k := range o.hasNil {
-		nilSet[k] = true
-	}
-	for i, k := range o.keys {
-		if i > 0 {
-			buf.WriteByte(',')
-		}
-		keyBytes, err := json.Marshal(k)
-		if err != nil {
-			return nil, err
-		}
-		buf.Write(keyBytes)
-		buf.WriteByte(':')
-		v := o.values[k]
-		if v == nil && nilSet[k] {
-			buf.WriteString("null")
-		} else if v == nil {
-			buf.WriteString("null")
-		} else {
-			valBytes, err := json.Marshal(v)
-			if err != nil {
-				return nil, err
-			}
-			buf.Write(valBytes)
-		}
-	}
-	buf.WriteByte('}')
-	return []byte(buf.String()), nil
-}
-
 // ToHex encodes a byte slice to a lowercase hex string.
 func ToHex(data []byte) string {
 	return hex.EncodeToString(data)
@@ -195,17 +116,26 @@ func ToHex(data []byte) string {
 func FromHex(hexStr string) ([]byte, error) {
 	b, err := hex.DecodeString(hexStr)
 	if err != nil {
-		return nil, fmt.Errorf("grith: invalid hex string: %w", err)
+		return nil, errorf(ErrCodeInvalidHex, "grith: invalid hex string: %w", err)
 	}
 	return b, nil
 }
 
+// isHexDigest reports whether s is a 64-character hex SHA-256 digest.
+func isHexDigest(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
 // GenerateNonce generates 32 cryptographically secure random bytes.
 func GenerateNonce() ([]byte, error) {
 	nonce := make([]byte, 32)
 	_, err := rand.Read(nonce)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to generate nonce: %w", err)
+		return nil, errorf(ErrCodeCrypto, "grith: failed to generate nonce: %w", err)
 	}
 	return nonce, nil
 }
@@ -221,18 +151,3 @@ func ConstantTimeEqual(a, b []byte) bool {
 func Timestamp() string {
 	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
 }
-
-// objectToMap converts any Go value to a map[string]interface{} via
-// JSON round-trip. This is used internally to canonicalize arbitrary
-// struct types.
-func objectToMap(obj interface{}) (map[string]interface{}, error) {
-	b, err := json.Marshal(obj)
-	if err != nil {
-		return nil, err
-	}
-	var m map[string]interface{}
-	if err := json.Unmarshal(b, &m); err != nil {
-		return nil, err
-	}
-	return m, nil
-}
@@ -0,0 +1,161 @@
+package grith
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DecisionCacheOptions configure NewDecisionCache.
+type DecisionCacheOptions struct {
+	// Size is the maximum number of cached decisions. Required.
+	Size int
+	// TTL, if set, is how long a decision stays cached.
+	TTL time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// DecisionCache is an LRU cache of CCL evaluations, keyed by the covenant
+// chain's IDs, the action, the resource, and the hash of the evaluation
+// context. Enforcers given the cache in EnforcerOptions consult it before
+// evaluating a chain's constraints, so repeated identical checks skip
+// evaluation. Only the evaluation is cached: lifecycle states, rate
+// limits, and obligations are still checked on every call.
+//
+// Covenant IDs are content hashes, so a changed covenant or chain never
+// hits the decisions of its predecessor. Invalidate drops a covenant's
+// decisions early, e.g. when it is revoked. A cache may be shared by many
+// enforcers and is safe for concurrent use.
+type DecisionCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[decisionKey]*list.Element
+	order   *list.List // front is most recently used
+	hits    int64
+	misses  int64
+}
+
+// decisionKey identifies a cached evaluation. chain is the chain's
+// covenant IDs, from the enforced covenant to its root, joined by commas.
+type decisionKey struct {
+	chain       string
+	action      string
+	resource    string
+	contextHash string
+}
+
+// cachedDecision is the evaluation of a chain: whether it permits the
+// action and, if not, which covenant denied it.
+type cachedDecision struct {
+	key        decisionKey
+	permitted  bool
+	covenantID string
+	rule       *Statement
+	reason     string
+	expires    time.Time // zero without a TTL
+}
+
+// NewDecisionCache returns an empty DecisionCache.
+func NewDecisionCache(opts *DecisionCacheOptions) (*DecisionCache, error) {
+	if opts == nil {
+		opts = &DecisionCacheOptions{}
+	}
+	if opts.Size < 1 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: decision cache size must be positive, got %d", opts.Size)
+	}
+	if opts.TTL < 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: decision cache TTL must not be negative")
+	}
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &DecisionCache{size: opts.Size, ttl: opts.TTL, now: now, entries: make(map[decisionKey]*list.Element), order: list.New()}, nil
+}
+
+// get returns the cached evaluation under key, if any and unexpired.
+func (c *DecisionCache) get(key decisionKey) (cachedDecision, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if ok {
+		d := el.Value.(*cachedDecision)
+		if d.expires.IsZero() || c.now().Before(d.expires) {
+			c.order.MoveToFront(el)
+			c.hits++
+			return *d, true
+		}
+		c.remove(el)
+	}
+	c.misses++
+	return cachedDecision{}, false
+}
+
+// put caches d, evicting the least recently used evaluation if the cache
+// is full.
+func (c *DecisionCache) put(d cachedDecision) {
+	if c.ttl > 0 {
+		d.expires = c.now().Add(c.ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[d.key]; ok {
+		*el.Value.(*cachedDecision) = d
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[d.key] = c.order.PushFront(&d)
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove drops el from the cache. The caller holds the lock.
+func (c *DecisionCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*cachedDecision).key)
+}
+
+// Invalidate drops every cached evaluation of a chain that includes the
+// covenant with the given ID.
+func (c *DecisionCache) Invalidate(covenantID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.entries {
+		for _, id := range strings.Split(key.chain, ",") {
+			if id == covenantID {
+				c.remove(el)
+				break
+			}
+		}
+	}
+}
+
+// Purge drops every cached evaluation.
+func (c *DecisionCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[decisionKey]*list.Element)
+	c.order.Init()
+}
+
+// Len returns the number of cached evaluations, including expired ones
+// not yet dropped.
+func (c *DecisionCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Stats returns the number of lookups answered from the cache and the
+// number that were not.
+func (c *DecisionCache) Stats() (hits, misses int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
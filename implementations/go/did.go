@@ -0,0 +1,594 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Parties may be identified by DIDs instead of raw keys. Party.ID may be
+// a DID, and Party.PublicKey may be either a hex Ed25519 key or a DID URL
+// naming a verification method (e.g. "did:web:example.com#key-1"). A bare
+// did:key is also accepted as a public key since it encodes the key
+// itself.
+//
+// During verification, keys given as DIDs are resolved with
+// VerifyOptions.DIDResolver, and a party whose ID is a DID must sign with
+// one of that DID's assertion methods.
+
+// DIDResolver resolves a DID to its DID document.
+type DIDResolver interface {
+	Resolve(did string) (*DIDDocument, error)
+}
+
+// DIDVerificationMethod is a verification method in a DID document. Only
+// Ed25519 keys are supported, given as publicKeyMultibase, publicKeyBase58,
+// or an OKP publicKeyJwk.
+type DIDVerificationMethod struct {
+	ID                 string            `json:"id"`
+	Type               string            `json:"type"`
+	Controller         string            `json:"controller"`
+	PublicKeyMultibase string            `json:"publicKeyMultibase,omitempty"`
+	PublicKeyBase58    string            `json:"publicKeyBase58,omitempty"`
+	PublicKeyJwk       map[string]string `json:"publicKeyJwk,omitempty"`
+}
+
+// DIDDocument is the subset of a W3C DID document used for key checks.
+// The verification relationships hold verification method IDs; methods
+// embedded in a relationship are moved into VerificationMethod when the
+// document is decoded.
+type DIDDocument struct {
+	Context              []string                `json:"@context,omitempty"`
+	ID                   string                  `json:"id"`
+	AlsoKnownAs          []string                `json:"alsoKnownAs,omitempty"`
+	Controller           string                  `json:"controller,omitempty"`
+	VerificationMethod   []DIDVerificationMethod `json:"verificationMethod,omitempty"`
+	Authentication       []string                `json:"authentication,omitempty"`
+	AssertionMethod      []string                `json:"assertionMethod,omitempty"`
+	CapabilityInvocation []string                `json:"capabilityInvocation,omitempty"`
+	CapabilityDelegation []string                `json:"capabilityDelegation,omitempty"`
+}
+
+// UnmarshalJSON decodes a DID document, accepting verification methods
+// given either by reference or embedded, and a context given either as a
+// string or a list.
+func (d *DIDDocument) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Context              json.RawMessage         `json:"@context"`
+		ID                   string                  `json:"id"`
+		AlsoKnownAs          []string                `json:"alsoKnownAs"`
+		Controller           json.RawMessage         `json:"controller"`
+		VerificationMethod   []DIDVerificationMethod `json:"verificationMethod"`
+		Authentication       []json.RawMessage       `json:"authentication"`
+		AssertionMethod      []json.RawMessage       `json:"assertionMethod"`
+		CapabilityInvocation []json.RawMessage       `json:"capabilityInvocation"`
+		CapabilityDelegation []json.RawMessage       `json:"capabilityDelegation"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*d = DIDDocument{
+		ID:                 raw.ID,
+		AlsoKnownAs:        raw.AlsoKnownAs,
+		VerificationMethod: raw.VerificationMethod,
+	}
+	// Contexts may also be objects, which are not kept.
+	var context string
+	if json.Unmarshal(raw.Context, &context) == nil {
+		d.Context = []string{context}
+	} else {
+		var contexts []json.RawMessage
+		json.Unmarshal(raw.Context, &contexts)
+		for _, c := range contexts {
+			if json.Unmarshal(c, &context) == nil {
+				d.Context = append(d.Context, context)
+			}
+		}
+	}
+	// A list of controllers is not kept.
+	json.Unmarshal(raw.Controller, &d.Controller)
+
+	for _, rel := range []struct {
+		name    string
+		entries []json.RawMessage
+		ids     *[]string
+	}{
+		{"authentication", raw.Authentication, &d.Authentication},
+		{"assertionMethod", raw.AssertionMethod, &d.AssertionMethod},
+		{"capabilityInvocation", raw.CapabilityInvocation, &d.CapabilityInvocation},
+		{"capabilityDelegation", raw.CapabilityDelegation, &d.CapabilityDelegation},
+	} {
+		for _, entry := range rel.entries {
+			var ref string
+			if err := json.Unmarshal(entry, &ref); err == nil {
+				*rel.ids = append(*rel.ids, d.absoluteID(ref))
+				continue
+			}
+			var vm DIDVerificationMethod
+			if err := json.Unmarshal(entry, &vm); err != nil {
+				return fmt.Errorf("invalid %s entry: %w", rel.name, err)
+			}
+			d.VerificationMethod = append(d.VerificationMethod, vm)
+			*rel.ids = append(*rel.ids, d.absoluteID(vm.ID))
+		}
+	}
+	for i := range d.VerificationMethod {
+		d.VerificationMethod[i].ID = d.absoluteID(d.VerificationMethod[i].ID)
+	}
+	return nil
+}
+
+// AssertionKey returns the Ed25519 key of the assertion method with the
+// given ID, which may be relative ("#key-1") or absolute.
+func (d *DIDDocument) AssertionKey(methodID string) (ed25519.PublicKey, error) {
+	methodID = d.absoluteID(methodID)
+	listed := false
+	for _, am := range d.AssertionMethod {
+		if am == methodID {
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		return nil, errorf(ErrCodeDIDResolution, "grith: %s is not an assertion method of %s", methodID, d.ID)
+	}
+	for _, vm := range d.VerificationMethod {
+		if vm.ID == methodID {
+			return vm.PublicKey()
+		}
+	}
+	return nil, errorf(ErrCodeDIDResolution, "grith: verification method %s not found in %s", methodID, d.ID)
+}
+
+// AssertionKeys returns every Ed25519 key usable for assertions.
+// Methods with unsupported key types are skipped.
+func (d *DIDDocument) AssertionKeys() []ed25519.PublicKey {
+	var keys []ed25519.PublicKey
+	for _, id := range d.AssertionMethod {
+		if key, err := d.AssertionKey(id); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (d *DIDDocument) absoluteID(id string) string {
+	if strings.HasPrefix(id, "#") {
+		return d.ID + id
+	}
+	return id
+}
+
+// PublicKey decodes the method's Ed25519 public key.
+func (vm DIDVerificationMethod) PublicKey() (ed25519.PublicKey, error) {
+	var key []byte
+	var err error
+	switch {
+	case vm.PublicKeyMultibase != "":
+		key, err = decodeMultibaseEd25519(vm.PublicKeyMultibase)
+	case vm.PublicKeyBase58 != "":
+		key, err = base58Decode(vm.PublicKeyBase58)
+	case vm.PublicKeyJwk != nil:
+		if vm.PublicKeyJwk["kty"] != "OKP" || vm.PublicKeyJwk["crv"] != "Ed25519" {
+			return nil, errorf(ErrCodeDIDResolution, "grith: verification method %s is not an Ed25519 key", vm.ID)
+		}
+		key, err = base64.RawURLEncoding.DecodeString(vm.PublicKeyJwk["x"])
+	default:
+		return nil, errorf(ErrCodeDIDResolution, "grith: verification method %s has no supported public key", vm.ID)
+	}
+	if err != nil {
+		return nil, errorf(ErrCodeDIDResolution, "grith: invalid key in verification method %s: %w", vm.ID, err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errorf(ErrCodeDIDResolution, "grith: verification method %s key must be %d bytes", vm.ID, ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// IsDID reports whether s is a DID or DID URL.
+func IsDID(s string) bool {
+	return strings.HasPrefix(s, "did:")
+}
+
+// DIDKeyFromPublicKey returns the did:key identifier for an Ed25519
+// public key.
+func DIDKeyFromPublicKey(pub ed25519.PublicKey) string {
+	return "did:key:" + encodeMultibaseEd25519(pub)
+}
+
+// DIDResolverOptions configure NewDIDResolver.
+type DIDResolverOptions struct {
+	// HTTPClient fetches did:web documents. Defaults to a client with a
+	// 10 second timeout.
+	HTTPClient *http.Client
+	// CacheTTL caches resolved did:web documents. Zero disables caching.
+	CacheTTL time.Duration
+}
+
+// NewDIDResolver returns a resolver for did:key, resolved locally, and
+// did:web, fetched over HTTPS.
+func NewDIDResolver(opts *DIDResolverOptions) DIDResolver {
+	r := &didResolver{cache: make(map[string]cachedDIDDocument)}
+	if opts != nil {
+		r.client = opts.HTTPClient
+		r.ttl = opts.CacheTTL
+	}
+	if r.client == nil {
+		r.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return r
+}
+
+type cachedDIDDocument struct {
+	doc     *DIDDocument
+	expires time.Time
+}
+
+type didResolver struct {
+	client *http.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedDIDDocument
+}
+
+func (r *didResolver) Resolve(did string) (*DIDDocument, error) {
+	switch {
+	case strings.HasPrefix(did, "did:key:"):
+		return resolveDIDKey(did)
+	case strings.HasPrefix(did, "did:web:"):
+		return r.resolveDIDWeb(did)
+	}
+	return nil, errorf(ErrCodeDIDResolution, "grith: unsupported DID method: %s", did)
+}
+
+func (r *didResolver) resolveDIDWeb(did string) (*DIDDocument, error) {
+	if r.ttl > 0 {
+		r.mu.Lock()
+		c, ok := r.cache[did]
+		r.mu.Unlock()
+		if ok && time.Now().Before(c.expires) {
+			return c.doc, nil
+		}
+	}
+
+	docURL, err := didWebURL(did)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Get(docURL)
+	if err != nil {
+		return nil, errorf(ErrCodeDIDResolution, "grith: failed to fetch %s: %w", did, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorf(ErrCodeDIDResolution, "grith: failed to fetch %s: HTTP %d", did, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxDocumentSize))
+	if err != nil {
+		return nil, errorf(ErrCodeDIDResolution, "grith: failed to read %s: %w", did, err)
+	}
+	var doc DIDDocument
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, errorf(ErrCodeDIDResolution, "grith: invalid DID document for %s: %w", did, err)
+	}
+	if doc.ID != did {
+		return nil, errorf(ErrCodeDIDResolution, "grith: DID document id %q does not match %s", doc.ID, did)
+	}
+
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.cache[did] = cachedDIDDocument{doc: &doc, expires: time.Now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+	return &doc, nil
+}
+
+// didWebURL maps a did:web identifier to its document URL per the
+// did:web method specification.
+func didWebURL(did string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(did, "did:web:"), ":")
+	for i, p := range parts {
+		decoded, err := url.PathUnescape(p)
+		if err != nil || decoded == "" {
+			return "", errorf(ErrCodeDIDResolution, "grith: invalid did:web identifier: %s", did)
+		}
+		parts[i] = decoded
+	}
+	if len(parts) == 1 {
+		return "https://" + parts[0] + "/.well-known/did.json", nil
+	}
+	return "https://" + strings.Join(parts, "/") + "/did.json", nil
+}
+
+// resolveDIDKey expands a did:key into its implied DID document.
+func resolveDIDKey(did string) (*DIDDocument, error) {
+	fingerprint := strings.TrimPrefix(did, "did:key:")
+	key, err := decodeMultibaseEd25519(fingerprint)
+	if err != nil {
+		return nil, errorf(ErrCodeDIDResolution, "grith: invalid did:key %s: %w", did, err)
+	}
+	return ed25519DIDDocument(did, key), nil
+}
+
+// ed25519DIDDocument builds a document for did with key as its single
+// verification method, usable for every verification relationship, as
+// the did:key method specifies. The method's fragment is the key's
+// multibase fingerprint.
+func ed25519DIDDocument(did string, key ed25519.PublicKey) *DIDDocument {
+	fingerprint := encodeMultibaseEd25519(key)
+	methodID := did + "#" + fingerprint
+	return &DIDDocument{
+		Context: []string{
+			"https://www.w3.org/ns/did/v1",
+			"https://w3id.org/security/suites/ed25519-2020/v1",
+		},
+		ID: did,
+		VerificationMethod: []DIDVerificationMethod{{
+			ID:                 methodID,
+			Type:               "Ed25519VerificationKey2020",
+			Controller:         did,
+			PublicKeyMultibase: fingerprint,
+		}},
+		Authentication:       []string{methodID},
+		AssertionMethod:      []string{methodID},
+		CapabilityInvocation: []string{methodID},
+		CapabilityDelegation: []string{methodID},
+	}
+}
+
+// DIDDocumentOptions configure AgentIdentity.DIDDocumentWithOptions.
+type DIDDocumentOptions struct {
+	// WebDID, if set, is a did:web identifier to publish the document
+	// under instead of the operator key's did:key, which is then listed
+	// in alsoKnownAs. The document must be served at the did:web URL.
+	WebDID string
+}
+
+// DIDDocument returns a did:key DID document for the identity's operator
+// key, so that covenants can name the identity's operator by DID.
+func (a *AgentIdentity) DIDDocument() (*DIDDocument, error) {
+	return a.DIDDocumentWithOptions(nil)
+}
+
+// DIDDocumentWithOptions returns a DID document for the identity's
+// operator key. Its single verification method, derived from the key, is
+// used for authentication, assertions (signing covenants), and capability
+// invocation and delegation.
+func (a *AgentIdentity) DIDDocumentWithOptions(opts *DIDDocumentOptions) (*DIDDocument, error) {
+	key, err := FromHex(a.OperatorPublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errorf(ErrCodeInvalidInput, "grith: identity operator key is not a hex Ed25519 key")
+	}
+	pub := ed25519.PublicKey(key)
+	if opts == nil || opts.WebDID == "" {
+		return ed25519DIDDocument(DIDKeyFromPublicKey(pub), pub), nil
+	}
+	if !strings.HasPrefix(opts.WebDID, "did:web:") || strings.Contains(opts.WebDID, "#") {
+		return nil, errorf(ErrCodeInvalidInput, "grith: %q is not a did:web identifier", opts.WebDID)
+	}
+	if _, err := didWebURL(opts.WebDID); err != nil {
+		return nil, err
+	}
+	doc := ed25519DIDDocument(opts.WebDID, pub)
+	doc.AlsoKnownAs = []string{DIDKeyFromPublicKey(pub)}
+	return doc, nil
+}
+
+// resolvePartyKey returns the Ed25519 key a party signs with. A did:key
+// needs no resolver; other DIDs require one.
+func resolvePartyKey(p Party, resolver DIDResolver) (ed25519.PublicKey, error) {
+	if !IsDID(p.PublicKey) {
+		key, err := FromHex(p.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, errorf(ErrCodeInvalidParty, "grith: %s publicKey is not a hex Ed25519 key or DID", p.Role)
+		}
+		return ed25519.PublicKey(key), nil
+	}
+
+	did, fragment := p.PublicKey, ""
+	if i := strings.IndexByte(did, '#'); i >= 0 {
+		did, fragment = did[:i], did[i:]
+	}
+	doc, err := resolveDID(did, resolver)
+	if err != nil {
+		return nil, err
+	}
+	if fragment == "" {
+		keys := doc.AssertionKeys()
+		if len(keys) != 1 {
+			return nil, errorf(ErrCodeDIDResolution, "grith: %s publicKey %s must name one of its %d assertion methods", p.Role, did, len(keys))
+		}
+		return keys[0], nil
+	}
+	return doc.AssertionKey(did + fragment)
+}
+
+func resolveDID(did string, resolver DIDResolver) (*DIDDocument, error) {
+	if resolver == nil {
+		if strings.HasPrefix(did, "did:key:") {
+			return resolveDIDKey(did)
+		}
+		return nil, errorf(ErrCodeDIDResolution, "grith: no DIDResolver configured to resolve %s", did)
+	}
+	doc, err := resolver.Resolve(did)
+	if err != nil {
+		if CodeOf(err) == "" {
+			return nil, errorf(ErrCodeDIDResolution, "grith: failed to resolve %s: %w", did, err)
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+// usesDIDs reports whether either party is identified by a DID.
+func usesDIDs(doc *CovenantDocument) bool {
+	return IsDID(doc.Issuer.ID) || IsDID(doc.Issuer.PublicKey) ||
+		IsDID(doc.Beneficiary.ID) || IsDID(doc.Beneficiary.PublicKey)
+}
+
+// checkDIDBinding resolves each party's key and, for parties identified
+// by a DID, checks that the key is one of the DID's assertion methods.
+func checkDIDBinding(doc *CovenantDocument, resolver DIDResolver) VerificationCheck {
+	check := VerificationCheck{Name: "did_binding", Code: CheckDIDBinding}
+	for _, p := range []Party{doc.Issuer, doc.Beneficiary} {
+		key, err := resolvePartyKey(p, resolver)
+		if err != nil {
+			check.Message = fmt.Sprintf("Cannot resolve %s key: %v", p.Role, err)
+			return check
+		}
+		if !IsDID(p.ID) {
+			continue
+		}
+		didDoc, err := resolveDID(p.ID, resolver)
+		if err != nil {
+			check.Message = fmt.Sprintf("Cannot resolve %s DID: %v", p.Role, err)
+			return check
+		}
+		bound := false
+		for _, k := range didDoc.AssertionKeys() {
+			if ConstantTimeEqual(k, key) {
+				bound = true
+				break
+			}
+		}
+		if !bound {
+			check.Message = fmt.Sprintf("%s key is not an assertion method of %s", p.Role, p.ID)
+			return check
+		}
+	}
+	check.Passed = true
+	check.Message = "Party DIDs resolve and bind their keys"
+	return check
+}
+
+// memoResolver caches resolutions for the duration of one verification.
+type memoResolver struct {
+	resolver DIDResolver
+	docs     map[string]*DIDDocument
+	errs     map[string]error
+}
+
+func newMemoResolver(r DIDResolver) DIDResolver {
+	if r == nil {
+		return nil
+	}
+	return &memoResolver{resolver: r, docs: make(map[string]*DIDDocument), errs: make(map[string]error)}
+}
+
+func (m *memoResolver) Resolve(did string) (*DIDDocument, error) {
+	if doc, ok := m.docs[did]; ok {
+		return doc, nil
+	}
+	if err, ok := m.errs[did]; ok {
+		return nil, err
+	}
+	doc, err := m.resolver.Resolve(did)
+	if err != nil {
+		m.errs[did] = err
+		return nil, err
+	}
+	m.docs[did] = doc
+	return doc, nil
+}
+
+// ----------------------------------------------------------------------------
+// Multibase / base58btc
+// ----------------------------------------------------------------------------
+
+// ed25519MulticodecPrefix is the varint multicodec code for ed25519-pub.
+var ed25519MulticodecPrefix = []byte{0xed, 0x01}
+
+func encodeMultibaseEd25519(pub ed25519.PublicKey) string {
+	return "z" + base58Encode(append(append([]byte(nil), ed25519MulticodecPrefix...), pub...))
+}
+
+// maxMultibaseEd25519Len bounds the length of a multibase Ed25519 key:
+// "z" and at most 47 base58 digits for the 34-byte multicodec key. Longer
+// input is rejected before base58Decode, whose running time grows with
+// the square of its input.
+const maxMultibaseEd25519Len = 1 + (2+ed25519.PublicKeySize)*138/100 + 1
+
+func decodeMultibaseEd25519(s string) (ed25519.PublicKey, error) {
+	if !strings.HasPrefix(s, "z") {
+		return nil, fmt.Errorf("unsupported multibase encoding")
+	}
+	if len(s) > maxMultibaseEd25519Len {
+		return nil, fmt.Errorf("multibase key is %d characters, longer than an Ed25519 key", len(s))
+	}
+	b, err := base58Decode(s[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != len(ed25519MulticodecPrefix)+ed25519.PublicKeySize ||
+		b[0] != ed25519MulticodecPrefix[0] || b[1] != ed25519MulticodecPrefix[1] {
+		return nil, fmt.Errorf("not an Ed25519 multicodec key")
+	}
+	return ed25519.PublicKey(b[len(ed25519MulticodecPrefix):]), nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58Encode(data []byte) string {
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+	// Repeated division of the big-endian number by 58
+	digits := make([]byte, 0, len(data)*138/100+1)
+	for _, b := range data[zeros:] {
+		carry := int(b)
+		for i := range digits {
+			carry += int(digits[i]) << 8
+			digits[i] = byte(carry % 58)
+			carry /= 58
+		}
+		for carry > 0 {
+			digits = append(digits, byte(carry%58))
+			carry /= 58
+		}
+	}
+	out := make([]byte, zeros+len(digits))
+	for i := 0; i < zeros; i++ {
+		out[i] = '1'
+	}
+	for i, d := range digits {
+		out[len(out)-1-i] = base58Alphabet[d]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	bytesLE := make([]byte, 0, len(s)*733/1000+1)
+	for i := zeros; i < len(s); i++ {
+		carry := strings.IndexByte(base58Alphabet, s[i])
+		if carry < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", s[i])
+		}
+		for j := range bytesLE {
+			carry += int(bytesLE[j]) * 58
+			bytesLE[j] = byte(carry)
+			carry >>= 8
+		}
+		for carry > 0 {
+			bytesLE = append(bytesLE, byte(carry))
+			carry >>= 8
+		}
+	}
+	out := make([]byte, zeros+len(bytesLE))
+	for i, b := range bytesLE {
+		out[len(out)-1-i] = b
+	}
+	return out, nil
+}
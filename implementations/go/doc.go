@@ -22,7 +22,9 @@
 //
 // # Protocol Version
 //
-// This implementation targets Grith protocol version 1.0.
+// This implementation targets Grith protocol version 1.0 and accepts
+// documents from any 1.x revision. MigrateDocument converts a document
+// between versions; the result must be re-signed with ResignCovenant.
 //
 // # CCL Grammar
 //
@@ -48,4 +50,35 @@
 // Covenant verification performs 11 checks: id_match, signature_valid,
 // not_expired, active, ccl_parses, enforcement_valid, proof_valid,
 // chain_depth, document_size, countersignatures, and nonce_present.
+// Each check carries a stable CheckCode (e.g. CHECK_SIGNATURE_VALID).
+// Checks also carry a severity: only failed fatal checks make a document
+// invalid, while warning checks (such as a document expiring within
+// VerifyOptions.ExpiryWarning) are collected in VerificationResult.Warnings.
+// A named profile (VerifyOptions.Profile) can skip checks or change their
+// severities, e.g. "ingest" skips countersignature verification and
+// "full-audit" treats warnings as failures.
+// Documents carrying extensions also run an extensions check, which
+// fails on any critical extension the verifier does not understand.
+// Documents whose parties are identified by DIDs run a did_binding check
+// that resolves each party's key through VerifyOptions.DIDResolver.
+//
+// # WebAssembly
+//
+// The package builds for js/wasm and wasip1/wasm. Covenant documents,
+// identities and their lineage, action logs, checkpoints, receipts,
+// revocations, and suspensions, as well as decoded JSON values and Go
+// numbers, convert to their JSON form without reflection. Building,
+// verification, CCL evaluation, enforcement, and log replay therefore
+// run where reflection is limited; CI runs the test suite as js/wasm
+// built with grith_noreflect. Other values, such as compliance reports,
+// policy bundles, and typed contexts, fall back to encoding/json; the
+// grith_noreflect build tag turns that fallback into an
+// ErrCodeSerialization error, so a build for a reflection-limited runtime
+// fails loudly instead.
+//
+// # Errors
+//
+// Errors returned by builders, deserializers, and crypto helpers are
+// *Error values carrying a stable ErrorCode (e.g. ERR_CHAIN_DEPTH_EXCEEDED).
+// Use CodeOf or errors.Is to match on codes rather than on messages.
 package grith
@@ -0,0 +1,112 @@
+package grith
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ExportChainDOT renders the delegation tree rooted at rootID as a
+// Graphviz DOT digraph. Nodes are covenants in store; edges run from each
+// parent to the covenants that reference it in their chain, labelled with
+// the relation and coloured by narrowing status:
+//
+//   - green:  the child only narrows the parent's constraints
+//   - red:    the child broadens the parent (violations are listed)
+//   - grey, dashed: narrowing could not be checked, e.g. for constraints
+//     stored by reference
+//
+// Children are discovered by scanning store, so the output reflects every
+// stored descendant of rootID. Render it with `dot -Tsvg`.
+func ExportChainDOT(store Store, rootID string) (string, error) {
+	root, err := store.Get(rootID)
+	if err != nil {
+		return "", err
+	}
+	if root == nil {
+		return "", errorf(ErrCodeNotFound, "grith: covenant not found: %s", rootID)
+	}
+
+	docs, err := store.List()
+	if err != nil {
+		return "", err
+	}
+	children := make(map[string][]*CovenantDocument)
+	for _, doc := range docs {
+		if doc.Chain != nil {
+			children[doc.Chain.ParentID] = append(children[doc.Chain.ParentID], doc)
+		}
+	}
+	for _, kids := range children {
+		sort.Slice(kids, func(i, j int) bool {
+			if kids[i].CreatedAt != kids[j].CreatedAt {
+				return kids[i].CreatedAt < kids[j].CreatedAt
+			}
+			return kids[i].ID < kids[j].ID
+		})
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph covenants {\n")
+	b.WriteString("  rankdir=TB;\n")
+	b.WriteString("  node [shape=box, fontname=\"Helvetica\"];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\"];\n")
+
+	// Breadth-first so the output lists covenants level by level. The
+	// visited set guards against malformed chains that form cycles.
+	visited := map[string]bool{root.ID: true}
+	writeDOTNode(&b, root)
+	queue := []*CovenantDocument{root}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range children[parent.ID] {
+			writeDOTEdge(&b, parent, child)
+			if visited[child.ID] {
+				continue
+			}
+			visited[child.ID] = true
+			writeDOTNode(&b, child)
+			queue = append(queue, child)
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+func writeDOTNode(b *strings.Builder, doc *CovenantDocument) {
+	label := fmt.Sprintf("%s\n%s -> %s", shortID(doc.ID), doc.Issuer.ID, doc.Beneficiary.ID)
+	if doc.Chain != nil {
+		label += fmt.Sprintf("\ndepth %d", doc.Chain.Depth)
+	}
+	if doc.ExpiresAt != "" {
+		label += "\nexpires " + doc.ExpiresAt
+	}
+	fmt.Fprintf(b, "  %s [label=%s];\n", dotQuote(doc.ID), dotQuote(label))
+}
+
+func writeDOTEdge(b *strings.Builder, parent, child *CovenantDocument) {
+	label := child.Chain.Relation
+	attrs := "color=\"#2e7d32\""
+	if result, err := ValidateChainNarrowing(child, parent, nil); err != nil {
+		label += "\nnarrowing unchecked"
+		attrs = "color=\"#9e9e9e\", style=dashed"
+	} else if !result.Valid {
+		label += fmt.Sprintf("\n%d narrowing violation(s)", len(result.Violations))
+		var msgs []string
+		for _, v := range result.Violations {
+			msgs = append(msgs, v.Message)
+		}
+		attrs = fmt.Sprintf("color=\"#c62828\", penwidth=2, tooltip=%s", dotQuote(strings.Join(msgs, "\n")))
+	} else {
+		label += "\nnarrows"
+	}
+	fmt.Fprintf(b, "  %s -> %s [label=%s, %s];\n", dotQuote(parent.ID), dotQuote(child.ID), dotQuote(label), attrs)
+}
+
+// dotQuote returns s as a DOT double-quoted string.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,92 @@
+package grith
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// EgressGuardOptions configure NewEgressGuard.
+type EgressGuardOptions struct {
+	// Enforcer checks and logs every request. Required.
+	Enforcer *Enforcer
+	// Transport sends permitted requests. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// EgressGuard is an http.RoundTripper that sends an outgoing request only
+// if the covenant permits it. A request is checked as a
+// network.http.<method> action, with the method in lower case, on the
+// resource /<host>/<path>, where host is the lower-case host name without
+// its port and path is the cleaned URL path. The evaluation context holds
+// the request's scheme, host, port, method, path, and query, and its
+// content_length if known.
+//
+// So "permit network.http.get on '/api.example.com/**'" allowlists a
+// domain, and "limit network.http.** 100 per 1 hours" bounds the request
+// rate. Every request, permitted or denied, is logged by the enforcer. A
+// denied request fails with an error with code ErrCodeUnauthorized and is
+// never sent. It is safe for concurrent use if Transport is.
+type EgressGuard struct {
+	enforcer  *Enforcer
+	transport http.RoundTripper
+}
+
+// NewEgressGuard creates an EgressGuard. Use it as an http.Client's
+// Transport.
+func NewEgressGuard(opts *EgressGuardOptions) (*EgressGuard, error) {
+	if opts == nil || opts.Enforcer == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: egress guard requires an enforcer")
+	}
+	transport := opts.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &EgressGuard{enforcer: opts.Enforcer, transport: transport}, nil
+}
+
+// RoundTrip checks req and, if permitted, sends it with the underlying
+// transport.
+func (g *EgressGuard) RoundTrip(req *http.Request) (*http.Response, error) {
+	action, resource, evalContext := egressAction(req)
+	d, err := g.enforcer.Check(req.Context(), action, resource, evalContext)
+	if err == nil && !d.Permitted {
+		err = errorf(ErrCodeUnauthorized, "grith: request to %s denied: %s", req.URL.Host, d.Reason)
+	}
+	if err != nil {
+		// A RoundTripper must close the body, even on errors.
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return g.transport.RoundTrip(req)
+}
+
+// egressAction maps a request to its action, resource, and evaluation
+// context.
+func egressAction(req *http.Request) (string, string, map[string]interface{}) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	host := strings.ToLower(req.URL.Hostname())
+	urlPath := path.Clean("/" + req.URL.Path)
+	evalContext := map[string]interface{}{
+		"scheme": req.URL.Scheme,
+		"host":   host,
+		"port":   req.URL.Port(),
+		"method": method,
+		"path":   urlPath,
+		"query":  req.URL.RawQuery,
+	}
+	if req.ContentLength >= 0 && req.Body != nil {
+		evalContext["content_length"] = req.ContentLength
+	}
+	resource := "/" + host
+	if urlPath != "/" {
+		resource += urlPath
+	}
+	return "network.http." + strings.ToLower(method), resource, evalContext
+}
@@ -0,0 +1,669 @@
+package grith
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnforcerOptions configure NewEnforcer.
+type EnforcerOptions struct {
+	// Covenant is the covenant to enforce. Required.
+	Covenant *CovenantDocument
+	// Ancestors are the covenants Covenant is delegated from, starting
+	// with its parent and ending at the root of its chain. An action must
+	// be permitted by every covenant in the chain and counts against each
+	// one's limits.
+	Ancestors []*CovenantDocument
+	// ConstraintResolver resolves constraints stored by reference.
+	ConstraintResolver ConstraintResolver
+	// Log, if set, records every checked action: executed if permitted
+	// and denied otherwise. It must be Covenant's ActionLog or FileLog.
+	Log ActionRecorder
+	// ObligationWindow, if set, is how long after a triggering action a
+	// require obligation must be fulfilled, as in ReplayOptions.
+	ObligationWindow time.Duration
+	// ObligationHandlers register obligation handlers by action, as
+	// Enforcer.OnObligation does.
+	ObligationHandlers map[string]ObligationHandler
+	// Cache, if set, caches the evaluation of the chain's constraints. See
+	// DecisionCache.
+	Cache *DecisionCache
+	// OnViolation, if set, is invoked synchronously for every violation.
+	OnViolation func(Violation)
+	// Violations, if set, receives every violation. Sends block until
+	// received or the context of the check is done.
+	Violations chan<- Violation
+	// Webhooks, if set, is notified of every violation and suspension.
+	Webhooks *WebhookDispatcher
+	// KillSwitch, if set, suspends the covenant after repeated violations.
+	// See KillSwitchOptions.
+	KillSwitch *KillSwitchOptions
+	// Budget, if set, bounds the evaluation of each covenant's
+	// constraints. See EvaluationBudget.
+	Budget *EvaluationBudget
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// ActionRecorder appends actions to a covenant's action log. ActionLog and
+// FileLog implement it.
+type ActionRecorder interface {
+	Append(action, resource string, context map[string]interface{}, outcome ActionOutcome) (ActionLogEntry, error)
+}
+
+// ObligationHandler performs an obligation, such as shipping an audit
+// record for an audit.log obligation. It must not call its Enforcer.
+type ObligationHandler func(ctx context.Context, ob EnforcedObligation) error
+
+// HandledObligation is the outcome of running an obligation handler.
+type HandledObligation struct {
+	Obligation EnforcedObligation
+	// Action is the action the handler was registered for.
+	Action string
+	// Fulfillment is the decision on the fulfilling action, or nil if the
+	// handler failed.
+	Fulfillment *EnforcementDecision
+	// Err is the handler's error, or the reason the fulfilling action
+	// could not be recorded. The obligation is then still pending.
+	Err error
+}
+
+// Violation is a breach of the covenant detected by an Enforcer, for
+// alerting: a denied action (ViolationUnpermitted), an action denied by a
+// limit statement (ViolationRateLimit), or an obligation not fulfilled by
+// its deadline (ViolationObligation).
+type Violation struct {
+	Kind ViolationKind `json:"kind"`
+	// CovenantID is the covenant in the chain that was breached.
+	CovenantID string `json:"covenantId"`
+	// Rule is the breached CCL statement, if any.
+	Rule string `json:"rule,omitempty"`
+	// Action and Resource are those of the denied action or, for
+	// obligations, the required action and the triggering resource.
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+	Message  string `json:"message"`
+	// LogIndex is the index of the log entry of the denied action or of
+	// the action that triggered the obligation, or -1 if the enforcer has
+	// no log.
+	LogIndex int64 `json:"logIndex"`
+	// At is when the action was denied or the obligation fell due.
+	At time.Time `json:"at"`
+}
+
+// EnforcedObligation is a require statement triggered by a permitted
+// action and not yet fulfilled.
+type EnforcedObligation struct {
+	// CovenantID is the covenant in the chain the statement belongs to.
+	CovenantID string
+	Rule       string
+	Action     string
+	Resource   string
+	// Trigger describes the action that triggered the obligation, and
+	// TriggerResource is its resource.
+	Trigger         string
+	TriggerResource string
+	// TriggerIndex is the log index of the triggering action, or -1 if
+	// the enforcer has no log.
+	TriggerIndex int64
+	// Deadline is when the obligation falls due; zero without an
+	// obligation window.
+	Deadline time.Time
+}
+
+// EnforcementDecision is the outcome of Enforcer.Check.
+type EnforcementDecision struct {
+	Permitted bool
+	Reason    string
+	// CovenantID is the covenant that denied the action, or the enforced
+	// covenant if it was permitted.
+	CovenantID  string
+	MatchedRule *Statement
+	// RateLimit is the tightest limit the action counts against, after
+	// counting it, or nil if no limit matches.
+	RateLimit *RateLimitResult
+	// Obligations are the obligations the action triggered.
+	Obligations []EnforcedObligation
+	// Fulfilled are the pending obligations the action fulfilled.
+	Fulfilled []EnforcedObligation
+	// Handled are the outcomes of the obligation handlers run for
+	// Obligations.
+	Handled []HandledObligation
+	// Entry is the action's log entry, if the enforcer has a log.
+	Entry *ActionLogEntry
+	// Violations are the violations detected by the check: the denial of
+	// the action, if it was denied, and obligations found overdue.
+	Violations []Violation
+	// Suspension is the record of the suspension the violations tripped,
+	// if any.
+	Suspension *SuspensionRecord
+}
+
+// Enforcer enforces a covenant, or a delegation chain, at runtime: it
+// evaluates each action against the constraints, counts actions against
+// limit statements, tracks the obligations actions trigger, and records
+// every action in the action log. With the default clock, its decisions
+// agree with ReplayComplianceWithOptions over the log it keeps. It is
+// safe for concurrent use.
+type Enforcer struct {
+	covenant *CovenantDocument
+	chain    []enforcedCovenant
+	log      ActionRecorder
+	window   time.Duration
+	cache    *DecisionCache
+	chainKey string // the chain's IDs, as in decisionKey
+	now      func() time.Time
+
+	onViolation func(Violation)
+	violations  chan<- Violation
+	webhooks    *WebhookDispatcher
+	kill        *KillSwitchOptions
+	budget      *EvaluationBudget
+
+	mu         sync.Mutex
+	handlers   map[string]ObligationHandler
+	strikes    []Violation // violations counted against the kill switch
+	suspension *SuspensionRecord
+}
+
+// enforcedCovenant is the state of one covenant of an Enforcer's chain.
+type enforcedCovenant struct {
+	doc *CovenantDocument
+	ccl *CCLDocument
+	// executed holds the times of permitted actions, per limit statement,
+	// within the statement's period.
+	executed map[int][]time.Time
+	// pending holds the unfulfilled obligations per require statement.
+	pending map[int][]EnforcedObligation
+	// overdue counts the pending obligations per require statement already
+	// reported as violations.
+	overdue map[int]int
+}
+
+// NewEnforcer creates an Enforcer for opts.Covenant. Its constraints, and
+// those of its ancestors, are resolved and parsed once, and the ancestors
+// must form the covenant's chain.
+func NewEnforcer(opts *EnforcerOptions) (*Enforcer, error) {
+	if opts == nil || opts.Covenant == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: enforcer requires a covenant")
+	}
+	if doc := recorderCovenant(opts.Log); doc != nil && doc.ID != opts.Covenant.ID {
+		return nil, errorf(ErrCodeActionLog, "grith: enforcer log belongs to covenant %s", shortID(doc.ID))
+	}
+	e := &Enforcer{covenant: opts.Covenant, log: opts.Log, window: opts.ObligationWindow, cache: opts.Cache, now: opts.Now, handlers: make(map[string]ObligationHandler)}
+	e.onViolation, e.violations, e.webhooks, e.budget = opts.OnViolation, opts.Violations, opts.Webhooks, opts.Budget
+	if opts.KillSwitch != nil {
+		if err := validateKillSwitch(opts.KillSwitch); err != nil {
+			return nil, err
+		}
+		kill := *opts.KillSwitch
+		e.kill = &kill
+		e.suspension = kill.Suspension
+	}
+	if e.now == nil {
+		e.now = time.Now
+	}
+	child := opts.Covenant
+	for i, doc := range append([]*CovenantDocument{opts.Covenant}, opts.Ancestors...) {
+		if i > 0 {
+			if doc == nil || child.Chain == nil || child.Chain.ParentID != doc.ID {
+				return nil, errorf(ErrCodeInvalidChain, "grith: enforcer ancestor %d is not the parent of covenant %s", i-1, shortID(child.ID))
+			}
+			child = doc
+		}
+		ccl, err := parsedCovenantConstraints(doc, opts.ConstraintResolver)
+		if err != nil {
+			return nil, err
+		}
+		e.chain = append(e.chain, enforcedCovenant{
+			doc:      doc,
+			ccl:      ccl,
+			executed: make(map[int][]time.Time),
+			pending:  make(map[int][]EnforcedObligation),
+			overdue:  make(map[int]int),
+		})
+	}
+	ids := make([]string, len(e.chain))
+	for i, c := range e.chain {
+		ids[i] = c.doc.ID
+	}
+	e.chainKey = strings.Join(ids, ",")
+	for action, h := range opts.ObligationHandlers {
+		e.OnObligation(action, h)
+	}
+	return e, nil
+}
+
+// OnObligation registers h as the handler of obligations that action
+// fulfils, replacing any previous one; a nil h removes it. When a
+// permitted action triggers such an obligation, Check runs h and then
+// checks and logs action on the triggering resource, with the
+// obligation's rule as obligation in the evaluation context, fulfilling
+// the obligation if the covenant permits it.
+func (e *Enforcer) OnObligation(action string, h ObligationHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if h == nil {
+		delete(e.handlers, action)
+		return
+	}
+	e.handlers[action] = h
+}
+
+// storeAncestors loads the ancestors of doc from store, from its parent
+// to the root of its chain.
+func storeAncestors(store Store, doc *CovenantDocument) ([]*CovenantDocument, error) {
+	var ancestors []*CovenantDocument
+	for child := doc; child.Chain != nil; {
+		if len(ancestors) == MaxChainDepth {
+			return nil, errorf(ErrCodeChainDepthExceeded, "grith: chain of covenant %s exceeds maximum depth of %d", shortID(doc.ID), MaxChainDepth)
+		}
+		parent, err := store.Get(child.Chain.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, errorf(ErrCodeInvalidChain, "grith: parent %s of covenant %s not found", shortID(child.Chain.ParentID), shortID(child.ID))
+		}
+		ancestors = append(ancestors, parent)
+		child = parent
+	}
+	return ancestors, nil
+}
+
+// recorderCovenant returns the covenant of a built-in action log.
+func recorderCovenant(log ActionRecorder) *CovenantDocument {
+	switch l := log.(type) {
+	case *ActionLog:
+		return l.doc
+	case *FileLog:
+		return l.doc
+	}
+	return nil
+}
+
+// Check decides whether action on resource is permitted, given the
+// evaluation context evalContext. The action is denied if the covenant is
+// not yet active or has expired past its grace period, if any covenant in
+// the chain does not permit it, if it would exceed a limit statement, or
+// if the kill switch suspended the covenant and the action is not
+// safe-listed. The action is logged with its outcome and, if permitted,
+// counted against its limits and fulfils or triggers obligations.
+//
+// Handlers registered for the obligations the action triggers are then
+// run, in the order of Obligations, and their outcomes are in Handled.
+// Finally, the violations of the check and of the fulfilling actions are
+// reported to OnViolation and Violations, and any suspension they tripped
+// to the kill switch's OnSuspend.
+//
+// An error means the action could not be checked or logged, and must not
+// be taken. If evaluating the constraints exceeds the enforcer's budget,
+// or ctx is done first, the error has code ErrCodeBudgetExceeded.
+func (e *Enforcer) Check(ctx context.Context, action, resource string, evalContext map[string]interface{}) (*EnforcementDecision, error) {
+	ctx, span := startSpan(ctx, SpanEnforcerCheck, TraceAttribute{"grith.action", action}, TraceAttribute{"grith.resource", resource})
+	d, err := e.check(ctx, action, resource, evalContext)
+	if err != nil {
+		logError(slog.LevelError, "enforcement check failed", err, slog.String("covenant_id", e.covenant.ID), slog.String("action", action), slog.String("resource", resource))
+		endSpan(span, err)
+		return nil, err
+	}
+	span.SetAttributes(TraceAttribute{"grith.covenant_id", d.CovenantID}, TraceAttribute{"grith.permitted", d.Permitted})
+	defer span.End()
+	violations := d.Violations
+	suspension := d.Suspension
+	var done []EnforcedObligation
+	for _, ob := range d.Obligations {
+		if slices.Contains(done, ob) {
+			continue
+		}
+		action, h := e.handlerFor(ob)
+		if h == nil {
+			continue
+		}
+		r := HandledObligation{Obligation: ob, Action: action}
+		if r.Err = h(ctx, ob); r.Err == nil {
+			r.Fulfillment, r.Err = e.check(ctx, action, ob.TriggerResource, map[string]interface{}{"obligation": ob.Rule})
+			if r.Err == nil && !r.Fulfillment.Permitted {
+				r.Err = errorf(ErrCodeUnauthorized, "grith: obligation %s on %s not recorded: %s", action, ob.TriggerResource, r.Fulfillment.Reason)
+			}
+			if r.Fulfillment != nil {
+				violations = append(violations, r.Fulfillment.Violations...)
+				if r.Fulfillment.Suspension != nil {
+					suspension = r.Fulfillment.Suspension
+				}
+			}
+			if r.Err == nil {
+				done = append(done, r.Fulfillment.Fulfilled...)
+			}
+		}
+		d.Handled = append(d.Handled, r)
+	}
+	e.report(ctx, violations, suspension)
+	return d, nil
+}
+
+// CheckObligations reports obligations that fell due since they were last
+// checked as violations, returning them. Check does so too, but an
+// enforcer that sees no actions must be checked periodically for
+// obligations to be reported. Obligations triggered without an obligation
+// window never fall due. They count against the kill switch, if any.
+func (e *Enforcer) CheckObligations(ctx context.Context) ([]Violation, error) {
+	e.mu.Lock()
+	now := e.now().Truncate(time.Millisecond)
+	var violations []Violation
+	for i := range e.chain {
+		violations = append(violations, e.chain[i].overdueObligations(now)...)
+	}
+	suspension, err := e.strike(violations, now)
+	e.mu.Unlock()
+	e.report(ctx, violations, suspension)
+	return violations, err
+}
+
+// report delivers violations to OnViolation, Violations, and Webhooks,
+// and a suspension to OnSuspend and Webhooks.
+func (e *Enforcer) report(ctx context.Context, violations []Violation, suspension *SuspensionRecord) {
+	if suspension != nil {
+		logEvent(slog.LevelError, "covenant suspended", slog.String("covenant_id", suspension.CovenantID), slog.String("reason", suspension.Reason))
+		if e.kill.OnSuspend != nil {
+			e.kill.OnSuspend(suspension)
+		}
+		if e.webhooks != nil {
+			e.webhooks.suspension(suspension)
+		}
+	}
+	for _, v := range violations {
+		logEvent(slog.LevelWarn, "covenant violation", slog.String("covenant_id", v.CovenantID), slog.String("kind", string(v.Kind)),
+			slog.String("action", v.Action), slog.String("resource", v.Resource), slog.String("rule", v.Rule), slog.String("message", v.Message))
+		if e.onViolation != nil {
+			e.onViolation(v)
+		}
+		if e.webhooks != nil {
+			e.webhooks.violation(v)
+		}
+		if e.violations != nil {
+			select {
+			case e.violations <- v:
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// handlerFor returns the handler of the first action, in sorted order,
+// that fulfils ob.
+func (e *Enforcer) handlerFor(ob EnforcedObligation) (string, ObligationHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	actions := make([]string, 0, len(e.handlers))
+	for action := range e.handlers {
+		if MatchAction(ob.Action, action) {
+			actions = append(actions, action)
+		}
+	}
+	if len(actions) == 0 {
+		return "", nil
+	}
+	slices.Sort(actions)
+	return actions[0], e.handlers[actions[0]]
+}
+
+// check checks, counts, and logs an action. See Check.
+func (e *Enforcer) check(ctx context.Context, action, resource string, evalContext map[string]interface{}) (*EnforcementDecision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if action == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: action is required")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// Log timestamps have millisecond precision.
+	now := e.now().Truncate(time.Millisecond)
+
+	d, err := e.decide(ctx, action, resource, evalContext, now)
+	if err != nil {
+		return nil, err
+	}
+	// Denials of a suspension are not violations of the covenant.
+	suspended := d.Permitted && e.suspended(action)
+	if suspended {
+		d = &EnforcementDecision{CovenantID: e.covenant.ID, Reason: fmt.Sprintf("Covenant %s is suspended after %s", shortID(e.covenant.ID), e.suspension.Reason)}
+	}
+	index := int64(-1)
+	if e.log != nil {
+		outcome := OutcomeDenied
+		if d.Permitted {
+			outcome = OutcomeExecuted
+		}
+		_, span := startSpan(ctx, SpanLogAppend, TraceAttribute{"grith.outcome", string(outcome)})
+		entry, err := e.log.Append(action, resource, evalContext, outcome)
+		endSpan(span, err)
+		if err != nil {
+			return nil, err
+		}
+		d.Entry = &entry
+		index = entry.Index
+	}
+
+	if d.Permitted {
+		for i := range e.chain {
+			e.chain[i].count(action, now)
+		}
+		for i := range e.chain {
+			triggered, fulfilled := e.chain[i].trackObligations(action, resource, evalContext, now, e.window, index)
+			d.Obligations = append(d.Obligations, triggered...)
+			d.Fulfilled = append(d.Fulfilled, fulfilled...)
+		}
+	} else if !suspended {
+		v := Violation{Kind: ViolationUnpermitted, CovenantID: d.CovenantID, Action: action, Resource: resource, Message: d.Reason, LogIndex: index, At: now}
+		if d.RateLimit != nil && d.RateLimit.Exceeded {
+			v.Kind = ViolationRateLimit
+		}
+		if d.MatchedRule != nil {
+			v.Rule = serializeStatement(*d.MatchedRule)
+		}
+		d.Violations = append(d.Violations, v)
+	}
+	for i := range e.chain {
+		d.Violations = append(d.Violations, e.chain[i].overdueObligations(now)...)
+	}
+	suspension, err := e.strike(d.Violations, now)
+	if err != nil {
+		return nil, err
+	}
+	d.Suspension = suspension
+	return d, nil
+}
+
+// decide evaluates the action against the chain without counting it.
+func (e *Enforcer) decide(ctx context.Context, action, resource string, evalContext map[string]interface{}, now time.Time) (*EnforcementDecision, error) {
+	for _, c := range e.chain {
+		switch state := c.doc.StateAt(now); state {
+		case CovenantPending, CovenantExpired:
+			return &EnforcementDecision{CovenantID: c.doc.ID, Reason: fmt.Sprintf("Covenant %s is %s", shortID(c.doc.ID), state)}, nil
+		}
+	}
+
+	eval, err := e.evaluate(ctx, action, resource, evalContext)
+	if err != nil {
+		return nil, err
+	}
+	d := &EnforcementDecision{Permitted: eval.permitted, CovenantID: eval.covenantID, Reason: eval.reason}
+	if eval.rule != nil {
+		d.MatchedRule = eval.rule.clone()
+	}
+	if !d.Permitted {
+		return d, nil
+	}
+
+	for _, c := range e.chain {
+		idx := matchingLimit(c.ccl, action)
+		if idx < 0 {
+			continue
+		}
+		limit := &c.ccl.Limits[idx]
+		count := len(c.window(idx, now))
+		rl := &RateLimitResult{Exceeded: float64(count) >= limit.Limit, Limit: int(limit.Limit), Remaining: max(int(limit.Limit)-count-1, 0)}
+		if rl.Exceeded {
+			if m := currentMetrics(); m != nil {
+				m.ObserveRateLimitRejection(action)
+			}
+			return &EnforcementDecision{
+				CovenantID:  c.doc.ID,
+				MatchedRule: limit.clone(),
+				RateLimit:   rl,
+				Reason:      fmt.Sprintf("%s executed %d times within %s, limit is %.0f", action, count, limitPeriod(limit), limit.Limit),
+			}, nil
+		}
+		if d.RateLimit == nil || rl.Remaining < d.RateLimit.Remaining {
+			d.RateLimit = rl
+		}
+	}
+	return d, nil
+}
+
+// evaluate evaluates the action against the constraints of every
+// covenant in the chain, within the enforcer's budget, or returns the
+// cached evaluation.
+func (e *Enforcer) evaluate(ctx context.Context, action, resource string, evalContext map[string]interface{}) (cachedDecision, error) {
+	var key decisionKey
+	cacheable := false
+	if e.cache != nil {
+		if h, err := HashActionContext(evalContext); err == nil {
+			key = decisionKey{chain: e.chainKey, action: action, resource: resource, contextHash: h}
+			if d, ok := e.cache.get(key); ok {
+				return d, nil
+			}
+			cacheable = true
+		}
+	}
+	d := cachedDecision{key: key, permitted: true, covenantID: e.covenant.ID}
+	for _, c := range e.chain {
+		result, err := EvaluateWithBudget(ctx, c.ccl, action, resource, evalContext, e.budget)
+		if err != nil {
+			return cachedDecision{}, err
+		}
+		if !result.Permitted {
+			d = cachedDecision{key: key, covenantID: c.doc.ID, rule: result.MatchedRule, reason: result.Reason}
+			break
+		}
+		if c.doc == e.covenant {
+			d.rule, d.reason = result.MatchedRule, result.Reason
+		}
+	}
+	if cacheable {
+		e.cache.put(d)
+	}
+	return d, nil
+}
+
+func limitPeriod(limit *Statement) time.Duration {
+	return time.Duration(limit.Period * float64(time.Millisecond))
+}
+
+// window drops the times of the limit's actions that fell out of its
+// period before now and returns the rest.
+func (c *enforcedCovenant) window(idx int, now time.Time) []time.Time {
+	times := c.executed[idx]
+	start := 0
+	for start < len(times) && !times[start].After(now.Add(-limitPeriod(&c.ccl.Limits[idx]))) {
+		start++
+	}
+	c.executed[idx] = times[start:]
+	return c.executed[idx]
+}
+
+// count records a permitted action against its most specific limit.
+func (c *enforcedCovenant) count(action string, now time.Time) {
+	if idx := matchingLimit(c.ccl, action); idx >= 0 {
+		c.executed[idx] = append(c.window(idx, now), now)
+	}
+}
+
+// trackObligations fulfils pending obligations the action satisfies, then
+// records the obligations it triggers, as ReplayComplianceWithOptions
+// does.
+func (c *enforcedCovenant) trackObligations(action, resource string, evalContext map[string]interface{}, now time.Time, window time.Duration, index int64) (triggered, fulfilled []EnforcedObligation) {
+	for i := range c.ccl.Obligations {
+		ob := &c.ccl.Obligations[i]
+		if !MatchResource(ob.Resource, resource) {
+			continue
+		}
+		if MatchAction(ob.Action, action) {
+			fulfilled = append(fulfilled, c.pending[i]...)
+			delete(c.pending, i)
+			delete(c.overdue, i)
+			continue
+		}
+		if evaluateCondition(ob.Condition, evalContext) {
+			p := EnforcedObligation{
+				CovenantID:      c.doc.ID,
+				Rule:            serializeStatement(*ob),
+				Action:          ob.Action,
+				Resource:        ob.Resource,
+				Trigger:         fmt.Sprintf("%s on %s", action, resource),
+				TriggerResource: resource,
+				TriggerIndex:    index,
+			}
+			if window > 0 {
+				p.Deadline = now.Add(window)
+			}
+			c.pending[i] = append(c.pending[i], p)
+			triggered = append(triggered, p)
+		}
+	}
+	return triggered, fulfilled
+}
+
+// overdueObligations returns violations for the pending obligations whose
+// deadline passed before now and that were not reported yet.
+func (c *enforcedCovenant) overdueObligations(now time.Time) []Violation {
+	var violations []Violation
+	for i := range c.ccl.Obligations {
+		pending := c.pending[i]
+		for c.overdue[i] < len(pending) {
+			p := pending[c.overdue[i]]
+			if p.Deadline.IsZero() || !p.Deadline.Before(now) {
+				break
+			}
+			violations = append(violations, Violation{
+				Kind:       ViolationObligation,
+				CovenantID: c.doc.ID,
+				Rule:       p.Rule,
+				Action:     p.Action,
+				Resource:   p.TriggerResource,
+				Message:    fmt.Sprintf("Obligation %s on %s triggered by %s was not fulfilled by %s", p.Action, p.Resource, p.Trigger, p.Deadline.UTC().Format("2006-01-02T15:04:05.000Z")),
+				LogIndex:   p.TriggerIndex,
+				At:         p.Deadline,
+			})
+			c.overdue[i]++
+		}
+	}
+	return violations
+}
+
+// Obligations returns the obligations triggered by permitted actions and
+// not yet fulfilled, including overdue ones, in the order triggered per
+// statement.
+func (e *Enforcer) Obligations() []EnforcedObligation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []EnforcedObligation
+	for _, c := range e.chain {
+		for i := range c.ccl.Obligations {
+			out = append(out, c.pending[i]...)
+		}
+	}
+	return out
+}
+
+// Log returns the enforcer's action log, or nil.
+func (e *Enforcer) Log() ActionRecorder {
+	return e.log
+}
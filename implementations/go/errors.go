@@ -0,0 +1,135 @@
+package grith
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode is a stable, machine-readable identifier for a class of error.
+// Codes never change once published, so downstream systems should match
+// on them rather than on human-readable messages.
+type ErrorCode string
+
+// Error codes returned by builder, deserializer, and crypto operations.
+const (
+	ErrCodeMissingField       ErrorCode = "ERR_MISSING_FIELD"
+	ErrCodeInvalidRole        ErrorCode = "ERR_INVALID_ROLE"
+	ErrCodeInvalidParty       ErrorCode = "ERR_INVALID_PARTY"
+	ErrCodeInvalidPrivateKey  ErrorCode = "ERR_INVALID_PRIVATE_KEY"
+	ErrCodeInvalidHex         ErrorCode = "ERR_INVALID_HEX"
+	ErrCodeCCLParse           ErrorCode = "ERR_CCL_PARSE"
+	ErrCodeTooManyConstraints ErrorCode = "ERR_TOO_MANY_CONSTRAINTS"
+	ErrCodeInvalidChain       ErrorCode = "ERR_INVALID_CHAIN"
+	ErrCodeChainDepthExceeded ErrorCode = "ERR_CHAIN_DEPTH_EXCEEDED"
+	ErrCodeDocumentTooLarge   ErrorCode = "ERR_DOCUMENT_TOO_LARGE"
+	ErrCodeInvalidJSON        ErrorCode = "ERR_INVALID_JSON"
+	ErrCodeUnsupportedVersion ErrorCode = "ERR_UNSUPPORTED_VERSION"
+	ErrCodeSerialization      ErrorCode = "ERR_SERIALIZATION"
+	ErrCodeCanonicalization   ErrorCode = "ERR_CANONICALIZATION"
+	ErrCodeCrypto             ErrorCode = "ERR_CRYPTO"
+	ErrCodeNotFound           ErrorCode = "ERR_NOT_FOUND"
+	ErrCodeInvalidInput       ErrorCode = "ERR_INVALID_INPUT"
+	ErrCodeStorage            ErrorCode = "ERR_STORAGE"
+
+	ErrCodeConstraintUnavailable  ErrorCode = "ERR_CONSTRAINT_UNAVAILABLE"
+	ErrCodeConstraintHashMismatch ErrorCode = "ERR_CONSTRAINT_HASH_MISMATCH"
+	ErrCodeSchemaViolation        ErrorCode = "ERR_SCHEMA_VIOLATION"
+	ErrCodeTransparency           ErrorCode = "ERR_TRANSPARENCY"
+	ErrCodeAnchor                 ErrorCode = "ERR_ANCHOR"
+	ErrCodeDIDResolution          ErrorCode = "ERR_DID_RESOLUTION"
+	ErrCodeActionLog              ErrorCode = "ERR_ACTION_LOG"
+	ErrCodeCompression            ErrorCode = "ERR_COMPRESSION"
+	ErrCodeUnauthorized           ErrorCode = "ERR_UNAUTHORIZED"
+	ErrCodeConflict               ErrorCode = "ERR_CONFLICT"
+	ErrCodeBudgetExceeded         ErrorCode = "ERR_BUDGET_EXCEEDED"
+	ErrCodeWebhook                ErrorCode = "ERR_WEBHOOK"
+)
+
+// CheckCode is a stable, machine-readable identifier for a verification
+// check. It is exposed on VerificationCheck alongside the check name.
+type CheckCode string
+
+// Check codes for the built-in verification checks.
+const (
+	CheckIDMatch           CheckCode = "CHECK_ID_MATCH"
+	CheckSignatureValid    CheckCode = "CHECK_SIGNATURE_VALID"
+	CheckNotExpired        CheckCode = "CHECK_NOT_EXPIRED"
+	CheckActive            CheckCode = "CHECK_ACTIVE"
+	CheckCCLParses         CheckCode = "CHECK_CCL_PARSES"
+	CheckEnforcementValid  CheckCode = "CHECK_ENFORCEMENT_VALID"
+	CheckProofValid        CheckCode = "CHECK_PROOF_VALID"
+	CheckChainDepth        CheckCode = "CHECK_CHAIN_DEPTH"
+	CheckDocumentSize      CheckCode = "CHECK_DOCUMENT_SIZE"
+	CheckCountersignatures CheckCode = "CHECK_COUNTERSIGNATURES"
+	CheckNoncePresent      CheckCode = "CHECK_NONCE_PRESENT"
+	CheckNonceUnique       CheckCode = "CHECK_NONCE_UNIQUE"
+	CheckVersionSupported  CheckCode = "CHECK_VERSION_SUPPORTED"
+	CheckExtensions        CheckCode = "CHECK_EXTENSIONS"
+	CheckMetadataSchema    CheckCode = "CHECK_METADATA_SCHEMA"
+	CheckTransparency      CheckCode = "CHECK_TRANSPARENCY"
+	CheckAnchored          CheckCode = "CHECK_ANCHORED"
+	CheckDIDBinding        CheckCode = "CHECK_DID_BINDING"
+	CheckBundleCovenant    CheckCode = "CHECK_BUNDLE_COVENANT"
+	CheckBundleIdentity    CheckCode = "CHECK_BUNDLE_IDENTITY"
+	CheckBundleActionLog   CheckCode = "CHECK_BUNDLE_ACTION_LOG"
+	CheckBundleCheckpoints CheckCode = "CHECK_BUNDLE_CHECKPOINTS"
+	CheckBundleWitnesses   CheckCode = "CHECK_BUNDLE_WITNESSES"
+	CheckBundleAnchoring   CheckCode = "CHECK_BUNDLE_ANCHORING"
+	CheckCompliance        CheckCode = "CHECK_COMPLIANCE"
+	CheckNotRevoked        CheckCode = "CHECK_NOT_REVOKED"
+	CheckIssuerIdentity    CheckCode = "CHECK_ISSUER_IDENTITY"
+	CheckTEEAttestation    CheckCode = "CHECK_TEE_ATTESTATION"
+	CheckModelAttestation  CheckCode = "CHECK_MODEL_ATTESTATION"
+	CheckCapabilityHash    CheckCode = "CHECK_CAPABILITY_HASH"
+	CheckLineageIntegrity  CheckCode = "CHECK_LINEAGE_INTEGRITY"
+	CheckParentBinding     CheckCode = "CHECK_PARENT_BINDING"
+
+	CheckPolicyBundleID        CheckCode = "CHECK_POLICY_BUNDLE_ID"
+	CheckPolicyBundleSignature CheckCode = "CHECK_POLICY_BUNDLE_SIGNATURE"
+	CheckPolicyBundleSigner    CheckCode = "CHECK_POLICY_BUNDLE_SIGNER"
+	CheckPolicyBundlePinned    CheckCode = "CHECK_POLICY_BUNDLE_PINNED"
+	CheckPolicyBundleManifest  CheckCode = "CHECK_POLICY_BUNDLE_MANIFEST"
+	CheckPolicyBundleCovenants CheckCode = "CHECK_POLICY_BUNDLE_COVENANTS"
+	CheckPolicyBundleChain     CheckCode = "CHECK_POLICY_BUNDLE_CHAIN"
+)
+
+// Error is an error carrying a stable ErrorCode. The message of the
+// underlying error is returned unchanged by Error, so wrapping an error
+// with a code never alters its human-readable text.
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+// Error returns the human-readable message of the underlying error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an *Error with the same code. This allows
+// errors.Is(err, &grith.Error{Code: grith.ErrCodeChainDepthExceeded}).
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Err == nil && t.Code == e.Code
+}
+
+// CodeOf returns the ErrorCode of the first *Error in err's chain, or the
+// empty string if err carries no code.
+func CodeOf(err error) ErrorCode {
+	var ge *Error
+	if errors.As(err, &ge) {
+		return ge.Code
+	}
+	return ""
+}
+
+// errorf formats an error message and attaches a stable code. The format
+// string may use %w to wrap an underlying error.
+func errorf(code ErrorCode, format string, args ...interface{}) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
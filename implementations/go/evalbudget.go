@@ -0,0 +1,133 @@
+package grith
+
+import "context"
+
+// EvaluationBudget bounds the work of evaluating a CCL document, so a
+// covenant with pathological patterns, such as many ** segments, or an
+// oversized evaluation context cannot stall the evaluator. Zero fields are
+// unlimited.
+type EvaluationBudget struct {
+	// MaxStatements is the maximum number of statements a document may
+	// have for its permit, deny, and require statements to be considered.
+	MaxStatements int
+	// MaxMatchDepth is the maximum recursion depth of matching a pattern.
+	MaxMatchDepth int
+	// MaxMatchSteps is the maximum number of pattern matching steps over
+	// the whole evaluation.
+	MaxMatchSteps int
+	// MaxContextSize is the maximum number of values in the evaluation
+	// context, counting the values nested in maps and slices.
+	MaxContextSize int
+}
+
+// DefaultEvaluationBudget returns a budget that ordinary covenants stay
+// well within.
+func DefaultEvaluationBudget() *EvaluationBudget {
+	return &EvaluationBudget{
+		MaxStatements:  MaxConstraints,
+		MaxMatchDepth:  256,
+		MaxMatchSteps:  1 << 20,
+		MaxContextSize: 10000,
+	}
+}
+
+// EvaluateWithBudget evaluates a CCL document as Evaluate does, within
+// budget and until ctx is done. If either runs out, it returns an error
+// with code ErrCodeBudgetExceeded rather than a decision; callers must
+// treat the action as denied. A nil budget is unlimited.
+func EvaluateWithBudget(ctx context.Context, doc *CCLDocument, action, resource string, evalContext map[string]interface{}, budget *EvaluationBudget) (*EvaluationResult, error) {
+	_, span := startSpan(ctx, SpanEvaluate, TraceAttribute{"grith.action", action}, TraceAttribute{"grith.resource", resource})
+	b := &evalBudget{ctx: ctx}
+	if budget != nil {
+		b.EvaluationBudget = *budget
+	}
+	result, err := evaluate(doc, action, resource, evalContext, b)
+	if result != nil {
+		span.SetAttributes(TraceAttribute{"grith.permitted", result.Permitted})
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+// evalBudget tracks the work of one evaluation. Its methods accept a nil
+// receiver, which is unlimited.
+type evalBudget struct {
+	EvaluationBudget
+	ctx   context.Context
+	steps int
+	err   error
+}
+
+// start checks the document and context against the budget.
+func (b *evalBudget) start(doc *CCLDocument, evalContext map[string]interface{}) error {
+	if b == nil {
+		return nil
+	}
+	if n := len(doc.Statements); b.MaxStatements > 0 && n > b.MaxStatements {
+		return errorf(ErrCodeBudgetExceeded, "grith: evaluation budget exceeded: %d statements, limit is %d", n, b.MaxStatements)
+	}
+	if b.MaxContextSize > 0 && contextSize(evalContext, b.MaxContextSize+1) > b.MaxContextSize {
+		return errorf(ErrCodeBudgetExceeded, "grith: evaluation budget exceeded: context has more than %d values", b.MaxContextSize)
+	}
+	if err := b.ctx.Err(); err != nil {
+		return errorf(ErrCodeBudgetExceeded, "grith: evaluation budget exceeded: %w", err)
+	}
+	return nil
+}
+
+// step charges one matching step at the given recursion depth, reporting
+// whether the budget allows it. Once the budget is exhausted, every step
+// fails.
+func (b *evalBudget) step(depth int) bool {
+	if b.err != nil {
+		return false
+	}
+	b.steps++
+	switch {
+	case b.MaxMatchDepth > 0 && depth > b.MaxMatchDepth:
+		b.err = errorf(ErrCodeBudgetExceeded, "grith: evaluation budget exceeded: pattern matching deeper than %d", b.MaxMatchDepth)
+	case b.MaxMatchSteps > 0 && b.steps > b.MaxMatchSteps:
+		b.err = errorf(ErrCodeBudgetExceeded, "grith: evaluation budget exceeded: more than %d matching steps", b.MaxMatchSteps)
+	case b.steps%1024 == 0 && b.ctx.Err() != nil:
+		b.err = errorf(ErrCodeBudgetExceeded, "grith: evaluation budget exceeded: %w", b.ctx.Err())
+	}
+	return b.err == nil
+}
+
+// exhausted returns the error that exhausted the budget, if any.
+func (b *evalBudget) exhausted() error {
+	if b == nil {
+		return nil
+	}
+	if b.err == nil && b.ctx.Err() != nil {
+		b.err = errorf(ErrCodeBudgetExceeded, "grith: evaluation budget exceeded: %w", b.ctx.Err())
+	}
+	return b.err
+}
+
+// contextSize counts the values in evalContext, stopping once it reaches
+// limit.
+func contextSize(evalContext map[string]interface{}, limit int) int {
+	n := 0
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		if n >= limit {
+			return
+		}
+		n++
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	for _, child := range evalContext {
+		walk(child)
+	}
+	return n
+}
@@ -0,0 +1,335 @@
+package grith
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// BundleFormat identifies the accountability bundle file format.
+const BundleFormat = "grith-bundle/1"
+
+// AccountabilityBundle packages everything needed to audit an agent's
+// conduct under a covenant into a single file: the covenant with its
+// countersignatures, the issuer's identity, a segment of the agent's
+// action log, and signed checkpoints over that log. VerifyBundle checks
+// the whole package offline.
+type AccountabilityBundle struct {
+	Format         string            `json:"format"`
+	Covenant       *CovenantDocument `json:"covenant"`
+	IssuerIdentity *AgentIdentity    `json:"issuerIdentity,omitempty"`
+	// PreviousHash is the hash of the entry preceding Entries[0], or
+	// ActionLogGenesisHash when the segment starts at index 0.
+	PreviousHash string           `json:"previousHash"`
+	Entries      []ActionLogEntry `json:"entries"`
+	Checkpoints  []LogCheckpoint  `json:"checkpoints"`
+	ExportedAt   string           `json:"exportedAt"`
+}
+
+// ExportBundleOptions are the inputs to ExportBundle.
+type ExportBundleOptions struct {
+	Covenant       *CovenantDocument
+	IssuerIdentity *AgentIdentity
+	// Entries is a contiguous segment of the covenant's action log.
+	Entries []ActionLogEntry
+	// PreviousHash is required when Entries does not start at index 0.
+	PreviousHash string
+	Checkpoints  []LogCheckpoint
+}
+
+// BundleVerifyOptions configure VerifyBundle.
+type BundleVerifyOptions struct {
+	// Covenant configures verification of the bundled covenant. Its Now
+	// field is ignored: time checks are evaluated at the last logged
+	// action, or at export time for a bundle without entries. Its
+	// Revocations also apply to the issuer identity.
+	Covenant *VerifyOptions
+	// RequireIdentity fails bundles without an issuer identity.
+	RequireIdentity bool
+	// Witnesses, if it sets a quorum, adds a witnesses check requiring
+	// every checkpoint to be cosigned by enough trusted witnesses.
+	Witnesses *WitnessPolicy
+	// Anchoring, if it sets a maximum gap, adds an anchoring check
+	// requiring every entry to be covered by an anchored checkpoint in
+	// time. Its Now field defaults to the bundle's export time.
+	Anchoring *AnchoringPolicy
+}
+
+// BundleVerificationResult is the outcome of VerifyBundle.
+type BundleVerificationResult struct {
+	Valid    bool                `json:"valid"`
+	Checks   []VerificationCheck `json:"checks"`
+	Warnings []VerificationCheck `json:"warnings,omitempty"`
+	// Covenant is the full result of verifying the bundled covenant.
+	Covenant *VerificationResult   `json:"covenant"`
+	Bundle   *AccountabilityBundle `json:"-"`
+}
+
+// ExportBundle assembles an accountability bundle and serializes it as
+// JSON. The pieces are checked for consistency with each other but not
+// verified; use VerifyBundle for that.
+func ExportBundle(opts *ExportBundleOptions) ([]byte, error) {
+	if opts == nil || opts.Covenant == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: bundle covenant is required")
+	}
+	prev := opts.PreviousHash
+	if len(opts.Entries) > 0 {
+		if opts.Entries[0].Index == 0 {
+			if prev == "" {
+				prev = ActionLogGenesisHash
+			}
+		} else if prev == "" {
+			return nil, errorf(ErrCodeMissingField, "grith: previousHash is required for a log segment starting at index %d", opts.Entries[0].Index)
+		}
+	}
+	for _, e := range opts.Entries {
+		if e.CovenantID != opts.Covenant.ID {
+			return nil, errorf(ErrCodeInvalidInput, "grith: log entry %d belongs to covenant %s", e.Index, shortID(e.CovenantID))
+		}
+	}
+	for _, cp := range opts.Checkpoints {
+		if cp.CovenantID != opts.Covenant.ID {
+			return nil, errorf(ErrCodeInvalidInput, "grith: checkpoint at size %d belongs to covenant %s", cp.Size, shortID(cp.CovenantID))
+		}
+	}
+
+	bundle := &AccountabilityBundle{
+		Format:         BundleFormat,
+		Covenant:       opts.Covenant,
+		IssuerIdentity: opts.IssuerIdentity,
+		PreviousHash:   prev,
+		Entries:        opts.Entries,
+		Checkpoints:    opts.Checkpoints,
+		ExportedAt:     Timestamp(),
+	}
+	if bundle.Entries == nil {
+		bundle.Entries = []ActionLogEntry{}
+	}
+	if bundle.Checkpoints == nil {
+		bundle.Checkpoints = []LogCheckpoint{}
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "grith: failed to serialize bundle: %w", err)
+	}
+	return data, nil
+}
+
+// VerifyBundle decodes and verifies an accountability bundle offline.
+// An error is returned only if data is not a bundle; verification
+// failures are reported in the result's checks:
+//
+//   - covenant        - the covenant passes verification, evaluated at the last logged action
+//   - issuer_identity - the identity is validly signed by the issuer's key (if present)
+//   - action_log      - entries belong to the covenant, chain, are signed by the
+//     beneficiary, and fall within the covenant's validity period
+//   - checkpoints     - each checkpoint is signed by the beneficiary and matches the log
+//   - witnesses       - each checkpoint meets opts.Witnesses (if it sets a quorum)
+//   - anchoring       - each entry is covered by a checkpoint anchored within
+//     opts.Anchoring.MaxGap (if set)
+func VerifyBundle(data []byte, opts *BundleVerifyOptions) (*BundleVerificationResult, error) {
+	if opts == nil {
+		opts = &BundleVerifyOptions{}
+	}
+	var bundle AccountabilityBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "grith: invalid bundle JSON: %w", err)
+	}
+	if bundle.Format != BundleFormat {
+		return nil, errorf(ErrCodeUnsupportedVersion, "grith: unsupported bundle format: %q", bundle.Format)
+	}
+	if bundle.Covenant == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: bundle has no covenant")
+	}
+	doc := bundle.Covenant
+
+	var resolver DIDResolver
+	var revocations []IdentityRevocation
+	covOpts := VerifyOptions{}
+	if opts.Covenant != nil {
+		covOpts = *opts.Covenant
+		resolver = opts.Covenant.DIDResolver
+		revocations = opts.Covenant.Revocations
+	}
+	covOpts.Now = bundleEvaluationTime(&bundle)
+	covResult, err := VerifyCovenantWithOptions(doc, &covOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BundleVerificationResult{Covenant: covResult, Bundle: &bundle}
+	result.Checks = append(result.Checks, bundleCovenantCheck(covResult))
+	if bundle.IssuerIdentity != nil || opts.RequireIdentity {
+		result.Checks = append(result.Checks, bundleIdentityCheck(doc, bundle.IssuerIdentity, resolver, revocations, covOpts.Now))
+	}
+	result.Checks = append(result.Checks, bundleLogCheck(&bundle, resolver))
+	result.Checks = append(result.Checks, bundleCheckpointsCheck(&bundle, resolver))
+	if opts.Witnesses != nil && opts.Witnesses.Quorum > 0 {
+		result.Checks = append(result.Checks, bundleWitnessCheck(&bundle, opts.Witnesses))
+	}
+	if opts.Anchoring != nil && opts.Anchoring.MaxGap > 0 {
+		result.Checks = append(result.Checks, bundleAnchoringCheck(&bundle, opts.Anchoring))
+	}
+
+	result.Valid, result.Warnings = aggregateChecks(result.Checks)
+	return result, nil
+}
+
+// bundleEvaluationTime is the instant at which the covenant must have
+// been valid: the last logged action, or the export time.
+func bundleEvaluationTime(b *AccountabilityBundle) time.Time {
+	ts := b.ExportedAt
+	if n := len(b.Entries); n > 0 {
+		ts = b.Entries[n-1].Timestamp
+	}
+	t, err := parseTimestamp(ts)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func bundleCovenantCheck(r *VerificationResult) VerificationCheck {
+	check := VerificationCheck{Name: "covenant", Code: CheckBundleCovenant, Passed: r.Valid, Message: "Covenant is valid"}
+	if !r.Valid {
+		check.Message = fmt.Sprintf("Covenant failed verification: %s", failedCheckNames(r.Checks))
+	}
+	return check
+}
+
+// failedCheckNames lists the names of the failed checks in English.
+func failedCheckNames(checks []VerificationCheck) string {
+	var failed []string
+	for _, c := range checks {
+		if !c.Passed {
+			failed = append(failed, c.Name)
+		}
+	}
+	return joinEnglish(failed)
+}
+
+func bundleIdentityCheck(doc *CovenantDocument, identity *AgentIdentity, resolver DIDResolver, revocations []IdentityRevocation, now time.Time) VerificationCheck {
+	check := VerificationCheck{Name: "issuer_identity", Code: CheckBundleIdentity}
+	if identity == nil {
+		check.Message = "Bundle has no issuer identity"
+		return check
+	}
+	result, err := VerifyIdentity(identity)
+	if err != nil || !result.Valid {
+		check.Message = "Issuer identity failed verification"
+		if err == nil {
+			check.Message = fmt.Sprintf("Issuer identity failed verification: %s", failedCheckNames(result.Checks))
+		}
+		return check
+	}
+	issuerKey, err := resolvePartyKey(doc.Issuer, resolver)
+	if err != nil {
+		check.Message = fmt.Sprintf("Cannot resolve issuer key: %v", err)
+		return check
+	}
+	if identity.OperatorPublicKey != ToHex(issuerKey) {
+		check.Message = "Issuer identity belongs to a different operator key"
+		return check
+	}
+	if r := revocationFor(identity, revocations, now); r != nil {
+		check.Message = fmt.Sprintf("Issuer identity was revoked (%s) effective %s", r.Reason, r.EffectiveAt)
+		return check
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("Issuer identity %s is valid", shortID(identity.ID))
+	return check
+}
+
+func bundleLogCheck(b *AccountabilityBundle, resolver DIDResolver) VerificationCheck {
+	check := VerificationCheck{Name: "action_log", Code: CheckBundleActionLog}
+	if len(b.Entries) == 0 {
+		check.Passed = true
+		check.Message = "Bundle contains no log entries"
+		return check
+	}
+	doc := b.Covenant
+	agentKey, err := resolvePartyKey(doc.Beneficiary, resolver)
+	if err != nil {
+		check.Message = fmt.Sprintf("Cannot resolve beneficiary key: %v", err)
+		return check
+	}
+	if b.Entries[0].Index == 0 && b.PreviousHash != ActionLogGenesisHash {
+		check.Message = "Log segment starting at index 0 must chain to the genesis hash"
+		return check
+	}
+	for _, e := range b.Entries {
+		if e.CovenantID != doc.ID {
+			check.Message = fmt.Sprintf("Log entry %d belongs to a different covenant", e.Index)
+			return check
+		}
+	}
+	if err := VerifyActionLogSegment(b.Entries, agentKey, b.PreviousHash); err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	for _, e := range b.Entries {
+		if msg := entryOutsideValidity(doc, e); msg != "" {
+			check.Message = msg
+			return check
+		}
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("%d log entries [%d, %d] are intact", len(b.Entries), b.Entries[0].Index, b.Entries[len(b.Entries)-1].Index)
+	return check
+}
+
+// entryOutsideValidity describes why e was logged outside the covenant's
+// validity period, or returns "" if it was not.
+func entryOutsideValidity(doc *CovenantDocument, e ActionLogEntry) string {
+	at, err := parseTimestamp(e.Timestamp)
+	if err != nil {
+		return fmt.Sprintf("Log entry %d has an invalid timestamp", e.Index)
+	}
+	if doc.ActivatesAt != "" {
+		if activates, err := parseTimestamp(doc.ActivatesAt); err == nil && at.Before(activates) {
+			return fmt.Sprintf("Log entry %d precedes covenant activation", e.Index)
+		}
+	}
+	if doc.ExpiresAt != "" {
+		if expires, err := parseTimestamp(doc.ExpiresAt); err == nil && !at.Before(expires.Add(doc.GracePeriodDuration())) {
+			return fmt.Sprintf("Log entry %d follows covenant expiry", e.Index)
+		}
+	}
+	return ""
+}
+
+func bundleCheckpointsCheck(b *AccountabilityBundle, resolver DIDResolver) VerificationCheck {
+	check := VerificationCheck{Name: "checkpoints", Code: CheckBundleCheckpoints}
+	if len(b.Checkpoints) == 0 {
+		check.Passed = true
+		check.Message = "Bundle contains no checkpoints"
+		return check
+	}
+	agentKey, err := resolvePartyKey(b.Covenant.Beneficiary, resolver)
+	if err != nil {
+		check.Message = fmt.Sprintf("Cannot resolve beneficiary key: %v", err)
+		return check
+	}
+	for i := range b.Checkpoints {
+		cp := &b.Checkpoints[i]
+		if cp.CovenantID != b.Covenant.ID {
+			check.Message = fmt.Sprintf("Checkpoint at size %d belongs to a different covenant", cp.Size)
+			return check
+		}
+		if cp.SignerPublicKey != ToHex(agentKey) {
+			check.Message = fmt.Sprintf("Checkpoint at size %d is not signed by the beneficiary", cp.Size)
+			return check
+		}
+		if err := VerifyLogCheckpoint(cp); err != nil {
+			check.Message = err.Error()
+			return check
+		}
+		if err := checkpointCoversSegment(cp, b.Entries); err != nil {
+			check.Message = err.Error()
+			return check
+		}
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("%d checkpoint(s) are valid", len(b.Checkpoints))
+	return check
+}
@@ -0,0 +1,214 @@
+package grith
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ExpiryEventType identifies a lifecycle transition observed by an
+// ExpiryMonitor.
+type ExpiryEventType string
+
+const (
+	// ExpiryEventApproaching fires once when a covenant enters the
+	// warning window before its expiresAt.
+	ExpiryEventApproaching ExpiryEventType = "approaching_expiry"
+	// ExpiryEventActivated fires once when a covenant's activatesAt passes.
+	ExpiryEventActivated ExpiryEventType = "activated"
+	// ExpiryEventExpired fires once when a covenant's expiresAt, plus any
+	// grace period, passes.
+	ExpiryEventExpired ExpiryEventType = "expired"
+)
+
+// ExpiryEvent describes a single lifecycle transition of a stored covenant.
+type ExpiryEvent struct {
+	Type       ExpiryEventType
+	DocumentID string
+	Document   *CovenantDocument
+	// At is the covenant time that triggered the event (activatesAt,
+	// expiresAt, or the end of the grace period), not the time the event
+	// was observed.
+	At time.Time
+}
+
+// ExpiryMonitorOptions configure an ExpiryMonitor.
+type ExpiryMonitorOptions struct {
+	// Store is the covenant store to watch. Required.
+	Store Store
+	// Interval is the polling interval. Defaults to one minute.
+	Interval time.Duration
+	// Warning is how far ahead of expiresAt an approaching_expiry event
+	// fires. Defaults to 24 hours.
+	Warning time.Duration
+	// OnEvent, if set, is invoked synchronously for every event.
+	OnEvent func(ExpiryEvent)
+	// Events, if set, receives every event. Sends block until received
+	// or the monitor is stopped.
+	Events chan<- ExpiryEvent
+	// Webhooks, if set, is notified of every expired event.
+	Webhooks *WebhookDispatcher
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// ExpiryMonitor watches a Store and reports covenants that are approaching
+// expiry, become active, or lapse. Each event fires at most once per
+// document. It is safe for concurrent use.
+type ExpiryMonitor struct {
+	opts ExpiryMonitorOptions
+
+	mu      sync.Mutex
+	emitted map[string]map[ExpiryEventType]bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewExpiryMonitor creates a new ExpiryMonitor. The monitor does not poll
+// until Start is called; Check may be used to run a single pass.
+func NewExpiryMonitor(opts *ExpiryMonitorOptions) (*ExpiryMonitor, error) {
+	if opts == nil || opts.Store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: expiry monitor requires a store")
+	}
+	o := *opts
+	if o.Interval <= 0 {
+		o.Interval = time.Minute
+	}
+	if o.Warning <= 0 {
+		o.Warning = 24 * time.Hour
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return &ExpiryMonitor{
+		opts:    o,
+		emitted: make(map[string]map[ExpiryEventType]bool),
+	}, nil
+}
+
+// Check runs a single scan of the store, dispatches any new events, and
+// returns them.
+func (m *ExpiryMonitor) Check() ([]ExpiryEvent, error) {
+	m.mu.Lock()
+	stop := m.stop
+	m.mu.Unlock()
+	return m.check(stop)
+}
+
+func (m *ExpiryMonitor) check(stop <-chan struct{}) ([]ExpiryEvent, error) {
+	docs, err := m.opts.Store.List()
+	if err != nil {
+		return nil, err
+	}
+	now := m.opts.Now().UTC()
+
+	var events []ExpiryEvent
+	seen := make(map[string]bool, len(docs))
+
+	m.mu.Lock()
+	for _, doc := range docs {
+		seen[doc.ID] = true
+		if doc.ActivatesAt != "" {
+			if at, perr := parseTimestamp(doc.ActivatesAt); perr == nil && !now.Before(at) {
+				events = m.record(events, ExpiryEventActivated, doc, at)
+			}
+		}
+		if doc.ExpiresAt != "" {
+			at, perr := parseTimestamp(doc.ExpiresAt)
+			if perr != nil {
+				continue
+			}
+			if lapse := at.Add(doc.GracePeriodDuration()); !now.Before(lapse) {
+				events = m.record(events, ExpiryEventExpired, doc, lapse)
+			} else if !now.Before(at.Add(-m.opts.Warning)) {
+				events = m.record(events, ExpiryEventApproaching, doc, at)
+			}
+		}
+	}
+	// Forget documents that have left the store
+	for id := range m.emitted {
+		if !seen[id] {
+			delete(m.emitted, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, ev := range events {
+		m.dispatch(ev, stop)
+	}
+	return events, nil
+}
+
+// record appends an event unless it has already been emitted for the
+// document. Callers must hold m.mu.
+func (m *ExpiryMonitor) record(events []ExpiryEvent, typ ExpiryEventType, doc *CovenantDocument, at time.Time) []ExpiryEvent {
+	state, ok := m.emitted[doc.ID]
+	if !ok {
+		state = make(map[ExpiryEventType]bool)
+		m.emitted[doc.ID] = state
+	}
+	if state[typ] {
+		return events
+	}
+	state[typ] = true
+	return append(events, ExpiryEvent{Type: typ, DocumentID: doc.ID, Document: doc, At: at})
+}
+
+func (m *ExpiryMonitor) dispatch(ev ExpiryEvent, stop <-chan struct{}) {
+	if m.opts.OnEvent != nil {
+		m.opts.OnEvent(ev)
+	}
+	if m.opts.Webhooks != nil {
+		m.opts.Webhooks.expiry(ev)
+	}
+	if m.opts.Events != nil {
+		select {
+		case m.opts.Events <- ev:
+		case <-stop:
+		}
+	}
+}
+
+// Start begins polling the store in a background goroutine. Calling
+// Start on a running monitor has no effect.
+func (m *ExpiryMonitor) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go m.run(m.stop, m.done)
+}
+
+// Stop halts polling and waits for the background goroutine to exit.
+func (m *ExpiryMonitor) Stop() {
+	m.mu.Lock()
+	stop, done := m.stop, m.done
+	m.stop, m.done = nil, nil
+	m.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (m *ExpiryMonitor) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+
+	// Store errors are logged and retried on the next tick
+	for {
+		if _, err := m.check(stop); err != nil {
+			logError(slog.LevelError, "expiry monitor pass failed", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
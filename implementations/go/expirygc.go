@@ -0,0 +1,158 @@
+package grith
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ExpiryCollectorOptions configure an ExpiryCollector.
+type ExpiryCollectorOptions struct {
+	// Store is the covenant store to collect from. Documents are deleted
+	// by their ID. Required.
+	Store Store
+	// Retention is how long a covenant is kept once it has lapsed, that
+	// is once its expiresAt and any grace period have passed. Zero
+	// collects covenants as soon as they lapse.
+	Retention time.Duration
+	// Interval is the polling interval of Start. Defaults to one hour.
+	Interval time.Duration
+	// Archive, if set, is given each covenant before it is deleted, to
+	// export it to cold storage. A covenant it fails to archive is kept
+	// until a later pass.
+	Archive func(doc *CovenantDocument) error
+	// OnEvict, if set, is invoked for every covenant deleted.
+	OnEvict func(doc *CovenantDocument)
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// ExpiryCollection is the outcome of one ExpiryCollector pass.
+type ExpiryCollection struct {
+	// Evicted lists the IDs of the covenants deleted.
+	Evicted []string
+	// Failed maps the IDs of covenants due for eviction but kept to the
+	// archive or delete error that kept them.
+	Failed map[string]error
+}
+
+// ExpiryCollector evicts covenants from a Store once they have been
+// lapsed for longer than a retention window, optionally archiving each
+// first. On a QueryableStore it finds candidates with FindExpiringBefore
+// rather than listing every document. It is safe for concurrent use.
+type ExpiryCollector struct {
+	opts ExpiryCollectorOptions
+
+	mu      sync.Mutex // serializes passes
+	startMu sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewExpiryCollector creates a new ExpiryCollector. The collector does not
+// run until Start is called; Collect may be used to run a single pass.
+func NewExpiryCollector(opts *ExpiryCollectorOptions) (*ExpiryCollector, error) {
+	if opts == nil || opts.Store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: expiry collector requires a store")
+	}
+	if opts.Retention < 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: expiry collector retention must not be negative")
+	}
+	o := *opts
+	if o.Interval <= 0 {
+		o.Interval = time.Hour
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return &ExpiryCollector{opts: o}, nil
+}
+
+// Collect runs a single pass, archiving and deleting every covenant that
+// lapsed more than the retention window ago. Covenants it could not
+// archive or delete are reported in the result's Failed; the error is for
+// failures to read the store.
+func (c *ExpiryCollector) Collect() (*ExpiryCollection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cutoff := c.opts.Now().UTC().Add(-c.opts.Retention)
+
+	var candidates []*CovenantDocument
+	var err error
+	if q, ok := c.opts.Store.(QueryableStore); ok {
+		candidates, err = q.FindExpiringBefore(cutoff)
+	} else {
+		candidates, err = c.opts.Store.List()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExpiryCollection{Failed: make(map[string]error)}
+	for _, doc := range candidates {
+		expires, ok := documentExpiry(doc)
+		if !ok || !expires.Add(doc.GracePeriodDuration()).Before(cutoff) {
+			continue
+		}
+		if c.opts.Archive != nil {
+			if err := c.opts.Archive(doc); err != nil {
+				result.Failed[doc.ID] = err
+				continue
+			}
+		}
+		if err := c.opts.Store.Delete(doc.ID); err != nil {
+			result.Failed[doc.ID] = err
+			continue
+		}
+		result.Evicted = append(result.Evicted, doc.ID)
+		if c.opts.OnEvict != nil {
+			c.opts.OnEvict(doc)
+		}
+	}
+	return result, nil
+}
+
+// Start begins collecting in a background goroutine, once immediately and
+// then every Interval. Calling Start on a running collector has no
+// effect.
+func (c *ExpiryCollector) Start() {
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+	if c.stop != nil {
+		return
+	}
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.run(c.stop, c.done)
+}
+
+// Stop halts collection and waits for the background goroutine to exit.
+func (c *ExpiryCollector) Stop() {
+	c.startMu.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.startMu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (c *ExpiryCollector) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+
+	// Store errors are logged and retried on the next tick
+	for {
+		if _, err := c.Collect(); err != nil {
+			logError(slog.LevelError, "expiry collection failed", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package grith
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Extension is a named, deployment-specific addition to a covenant.
+// Verifiers that do not understand a critical extension must reject the
+// document; unknown non-critical extensions are ignored.
+type Extension struct {
+	Critical bool        `json:"critical"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+// ExtensionHandler validates the value of an extension the verifier
+// understands.
+type ExtensionHandler func(name string, ext Extension) error
+
+// validateExtensionNames checks that every extension has a usable name.
+func validateExtensionNames(exts map[string]Extension) error {
+	for name := range exts {
+		if strings.TrimSpace(name) == "" {
+			return errorf(ErrCodeInvalidInput, "grith: extension names must be non-empty")
+		}
+	}
+	return nil
+}
+
+// checkExtensions fails if the document carries a critical extension not
+// present in handlers, or if a handler rejects its extension.
+func checkExtensions(doc *CovenantDocument, handlers map[string]ExtensionHandler) VerificationCheck {
+	names := make([]string, 0, len(doc.Extensions))
+	for name := range doc.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var unknown, rejected []string
+	for _, name := range names {
+		ext := doc.Extensions[name]
+		handler, known := handlers[name]
+		if !known {
+			if ext.Critical {
+				unknown = append(unknown, name)
+			}
+			continue
+		}
+		if handler != nil {
+			if err := handler(name, ext); err != nil {
+				rejected = append(rejected, fmt.Sprintf("%s (%v)", name, err))
+			}
+		}
+	}
+
+	check := VerificationCheck{Name: "extensions", Code: CheckExtensions, Passed: true}
+	switch {
+	case len(unknown) > 0:
+		check.Passed = false
+		check.Message = fmt.Sprintf("Unknown critical extension(s): %s", strings.Join(unknown, ", "))
+	case len(rejected) > 0:
+		check.Passed = false
+		check.Message = fmt.Sprintf("Invalid extension(s): %s", strings.Join(rejected, ", "))
+	default:
+		check.Message = fmt.Sprintf("All %d extension(s) are understood or non-critical", len(names))
+	}
+	return check
+}
@@ -0,0 +1,502 @@
+package grith
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls when a FileLog flushes appended entries to stable
+// storage.
+type SyncPolicy int
+
+const (
+	// SyncEveryAppend syncs each entry before Append returns.
+	SyncEveryAppend SyncPolicy = iota
+	// SyncInterval syncs at most once per FileLogOptions.SyncInterval. A
+	// crash may lose entries appended since the last sync.
+	SyncInterval
+	// SyncNever leaves syncing to the operating system and Close.
+	SyncNever
+)
+
+// DefaultSegmentSize is the size at which a FileLog starts a new segment.
+const DefaultSegmentSize = 64 << 20
+
+// FileLogOptions configure OpenFileLog.
+type FileLogOptions struct {
+	// Dir holds the log's segment files. It is created if necessary.
+	Dir      string
+	Covenant *CovenantDocument
+	// Agent is the key pair of the covenant's beneficiary.
+	Agent       *KeyPair
+	DIDResolver DIDResolver
+	Sync        SyncPolicy
+	// SyncInterval is the minimum time between syncs under SyncInterval.
+	SyncInterval time.Duration
+	// SegmentSize is the size in bytes after which appends go to a new
+	// segment file. Defaults to DefaultSegmentSize.
+	SegmentSize int64
+}
+
+// FileLog is a durable action log stored as append-only JSON Lines
+// segment files named after the index of their first entry. Opening a log
+// re-verifies its whole chain and truncates a torn final entry left by a
+// crash. It is safe for concurrent use within a single process.
+type FileLog struct {
+	mu       sync.Mutex
+	dir      string
+	doc      *CovenantDocument
+	agent    *KeyPair
+	opts     FileLogOptions
+	file     *os.File // current segment, nil once closed
+	segSize  int64
+	size     int64
+	head     string
+	tree     merkleAccumulator
+	lastSync time.Time
+	repaired int64
+}
+
+// OpenFileLog opens (creating if necessary) the action log in opts.Dir.
+// Every stored entry is verified; an invalid entry other than a torn tail
+// is an error, since it means the log was tampered with.
+func OpenFileLog(opts *FileLogOptions) (*FileLog, error) {
+	if opts == nil || opts.Dir == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: file log requires a directory")
+	}
+	if err := checkLogAgent(opts.Covenant, opts.Agent, opts.DIDResolver); err != nil {
+		return nil, err
+	}
+	if opts.Sync == SyncInterval && opts.SyncInterval <= 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: SyncInterval policy requires a positive interval")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to create log directory: %w", err)
+	}
+
+	l := &FileLog{dir: opts.Dir, doc: opts.Covenant, agent: opts.Agent, opts: *opts, head: ActionLogGenesisHash}
+	if l.opts.SegmentSize <= 0 {
+		l.opts.SegmentSize = DefaultSegmentSize
+	}
+	segments, err := l.segments()
+	if err != nil {
+		return nil, err
+	}
+	for i, first := range segments {
+		if err := l.load(first, i == len(segments)-1); err != nil {
+			return nil, err
+		}
+	}
+
+	path := l.segmentPath(0)
+	if n := len(segments); n > 0 {
+		path = l.segmentPath(segments[n-1])
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to open log segment: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errorf(ErrCodeStorage, "grith: failed to stat log segment: %w", err)
+	}
+	l.file, l.segSize, l.lastSync = f, info.Size(), time.Now()
+	if len(segments) == 0 {
+		syncDir(l.dir)
+	}
+	return l, nil
+}
+
+// segments returns the first indices of the log's segment files, in order.
+func (l *FileLog) segments() ([]int64, error) {
+	return listSegments(l.dir)
+}
+
+func (l *FileLog) segmentPath(first int64) string {
+	return segmentPath(l.dir, first)
+}
+
+// listSegments returns the first indices of the segment files in dir, in
+// order.
+func listSegments(dir string) ([]int64, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to list log segments: %w", err)
+	}
+	var firsts []int64
+	for _, name := range names {
+		first, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), ".jsonl"), 10, 64)
+		if err != nil {
+			continue
+		}
+		firsts = append(firsts, first)
+	}
+	sort.Slice(firsts, func(i, j int) bool { return firsts[i] < firsts[j] })
+	return firsts, nil
+}
+
+func segmentPath(dir string, first int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d.jsonl", first))
+}
+
+// load verifies one segment. In the last segment, a final line that is
+// unterminated or not valid JSON is a torn write and is truncated.
+func (l *FileLog) load(first int64, last bool) error {
+	if first != l.size {
+		return errorf(ErrCodeActionLog, "grith: log segment starting at %d follows %d entries", first, l.size)
+	}
+	path := l.segmentPath(first)
+	torn, err := scanSegment(path, last, func(e *ActionLogEntry) error {
+		if err := l.verifyNext(e); err != nil {
+			return err
+		}
+		l.push(e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if torn >= 0 {
+		return l.truncate(path, torn)
+	}
+	return nil
+}
+
+// scanSegment decodes the entries of a segment file in order, passing
+// each to fn. If last is set, a final line that is unterminated or not
+// valid JSON is a torn write: scanning stops and its offset is returned.
+// Otherwise the returned offset is -1.
+func scanSegment(path string, last bool, fn func(*ActionLogEntry) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return -1, errorf(ErrCodeStorage, "grith: failed to open log segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return -1, errorf(ErrCodeStorage, "grith: failed to read log segment: %w", err)
+		}
+		if len(line) == 0 {
+			return -1, nil
+		}
+		var e ActionLogEntry
+		complete := line[len(line)-1] == '\n'
+		if jerr := json.Unmarshal(line, &e); !complete || jerr != nil {
+			if last && (!complete || isFinalLine(r)) {
+				return offset, nil
+			}
+			return -1, errorf(ErrCodeActionLog, "grith: corrupt entry in log segment %s at offset %d", filepath.Base(path), offset)
+		}
+		if err := fn(&e); err != nil {
+			return -1, err
+		}
+		offset += int64(len(line))
+	}
+}
+
+// isFinalLine reports whether r has no more data.
+func isFinalLine(r *bufio.Reader) bool {
+	_, err := r.Peek(1)
+	return err == io.EOF
+}
+
+func (l *FileLog) truncate(path string, offset int64) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to stat log segment: %w", err)
+	}
+	if err := os.Truncate(path, offset); err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to truncate torn log tail: %w", err)
+	}
+	l.repaired = info.Size() - offset
+	return nil
+}
+
+func (l *FileLog) verifyNext(e *ActionLogEntry) error {
+	if e.Index != l.size {
+		return errorf(ErrCodeActionLog, "grith: log entry %d found where entry %d was expected", e.Index, l.size)
+	}
+	if e.CovenantID != l.doc.ID {
+		return errorf(ErrCodeActionLog, "grith: log entry %d belongs to covenant %s", e.Index, shortID(e.CovenantID))
+	}
+	return VerifyActionLogSegment([]ActionLogEntry{*e}, l.agent.PublicKey, l.head)
+}
+
+func (l *FileLog) push(e *ActionLogEntry) {
+	l.size++
+	l.head = e.Hash
+	l.tree.add(merkleLeaf([]byte(e.Hash)))
+}
+
+// Append records an action, chaining it to the current head, signing it
+// with the agent key, and writing it according to the sync policy.
+func (l *FileLog) Append(action, resource string, context map[string]interface{}, outcome ActionOutcome) (ActionLogEntry, error) {
+	e, err := newActionEntry(l.doc.ID, action, resource, context, outcome)
+	if err != nil {
+		return ActionLogEntry{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return ActionLogEntry{}, errorf(ErrCodeStorage, "grith: file log is closed")
+	}
+	e.Index = l.size
+	e.PreviousHash = l.head
+	if err := SignActionLogEntry(&e, l.agent.PrivateKey); err != nil {
+		return ActionLogEntry{}, err
+	}
+	line, err := json.Marshal(&e)
+	if err != nil {
+		return ActionLogEntry{}, errorf(ErrCodeSerialization, "grith: failed to encode log entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	// After a failed write or sync the file's state is unknown, so the
+	// log closes itself; reopening it verifies and repairs the tail.
+	if l.segSize > 0 && l.segSize+int64(len(line)) > l.opts.SegmentSize {
+		if err := l.rotate(e.Index); err != nil {
+			l.fail()
+			return ActionLogEntry{}, err
+		}
+	}
+	if _, err := l.file.Write(line); err != nil {
+		l.fail()
+		return ActionLogEntry{}, errorf(ErrCodeStorage, "grith: failed to append log entry: %w", err)
+	}
+	l.segSize += int64(len(line))
+	switch {
+	case l.opts.Sync == SyncEveryAppend,
+		l.opts.Sync == SyncInterval && time.Since(l.lastSync) >= l.opts.SyncInterval:
+		if err := l.syncLocked(); err != nil {
+			l.fail()
+			return ActionLogEntry{}, err
+		}
+	}
+	l.push(&e)
+	if m := currentMetrics(); m != nil {
+		m.ObserveLogAppend()
+	}
+	return e, nil
+}
+
+func (l *FileLog) fail() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// rotate closes the current segment and starts one at index first.
+func (l *FileLog) rotate(first int64) error {
+	if err := l.syncLocked(); err != nil {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to close log segment: %w", err)
+	}
+	l.file = nil
+	f, err := os.OpenFile(l.segmentPath(first), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to create log segment: %w", err)
+	}
+	syncDir(l.dir)
+	l.file, l.segSize = f, 0
+	return nil
+}
+
+func (l *FileLog) syncLocked() error {
+	if err := l.file.Sync(); err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to sync action log: %w", err)
+	}
+	l.lastSync = time.Now()
+	return nil
+}
+
+// syncDir makes a newly created segment file's directory entry durable.
+// Not every platform supports syncing directories, so errors are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+}
+
+// Sync flushes appended entries to stable storage.
+func (l *FileLog) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return errorf(ErrCodeStorage, "grith: file log is closed")
+	}
+	return l.syncLocked()
+}
+
+// Len returns the number of entries in the log.
+func (l *FileLog) Len() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// Head returns the hash of the latest entry, or ActionLogGenesisHash for
+// an empty log.
+func (l *FileLog) Head() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.head
+}
+
+// Repaired returns the number of bytes of torn tail truncated when the
+// log was opened.
+func (l *FileLog) Repaired() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.repaired
+}
+
+// Checkpoint signs a checkpoint over the whole log.
+func (l *FileLog) Checkpoint() (*LogCheckpoint, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size == 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: cannot checkpoint an empty log")
+	}
+	return signLogCheckpoint(l.doc.ID, l.size, l.head, hex.EncodeToString(l.tree.root()), l.agent)
+}
+
+// checkpointsFile holds a FileLog's stored checkpoints. Its name does not
+// parse as a segment index.
+const checkpointsFile = "checkpoints.jsonl"
+
+// StoreCheckpoint saves a checkpoint over this log, typically once
+// witnesses have cosigned it, in the log directory. Storing a checkpoint
+// of the same size again supersedes the earlier copy, so cosignatures can
+// be added as they arrive.
+func (l *FileLog) StoreCheckpoint(cp *LogCheckpoint) error {
+	if cp == nil {
+		return errorf(ErrCodeMissingField, "grith: checkpoint is required")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cp.CovenantID != l.doc.ID || cp.SignerPublicKey != l.agent.PublicKeyHex {
+		return errorf(ErrCodeActionLog, "grith: checkpoint does not belong to this log")
+	}
+	if cp.Size < 1 || cp.Size > l.size || cp.Size == l.size && cp.HeadHash != l.head {
+		return errorf(ErrCodeActionLog, "grith: checkpoint at size %d does not match the log", cp.Size)
+	}
+	if err := VerifyLogCheckpoint(cp); err != nil {
+		return err
+	}
+	return appendCheckpoint(l.dir, cp)
+}
+
+// Checkpoints returns the stored checkpoints in order of size, keeping
+// the latest copy stored for each size.
+func (l *FileLog) Checkpoints() ([]LogCheckpoint, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return readCheckpoints(l.dir)
+}
+
+// appendCheckpoint durably appends cp to the checkpoint file in dir.
+func appendCheckpoint(dir string, cp *LogCheckpoint) error {
+	line, err := json.Marshal(cp)
+	if err != nil {
+		return errorf(ErrCodeSerialization, "grith: failed to encode checkpoint: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, checkpointsFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to open checkpoint file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to store checkpoint: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to sync checkpoint file: %w", err)
+	}
+	return nil
+}
+
+// readCheckpoints returns the checkpoints stored in dir in order of size,
+// keeping the latest copy stored for each size.
+func readCheckpoints(dir string) ([]LogCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Join(dir, checkpointsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to read checkpoint file: %w", err)
+	}
+	bySize := make(map[int64]LogCheckpoint)
+	for _, line := range strings.Split(string(data), "\n") {
+		var cp LogCheckpoint
+		// Skip a torn final line left by a crash
+		if line == "" || json.Unmarshal([]byte(line), &cp) != nil {
+			continue
+		}
+		bySize[cp.Size] = cp
+	}
+	out := make([]LogCheckpoint, 0, len(bySize))
+	for _, cp := range bySize {
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Size < out[j].Size })
+	return out, nil
+}
+
+// WriteJSONL streams the log's entries to w as JSON Lines, for ReadJSONL.
+func (l *FileLog) WriteJSONL(w io.Writer) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	segments, err := l.segments()
+	if err != nil {
+		return err
+	}
+	for _, first := range segments {
+		f, err := os.Open(l.segmentPath(first))
+		if err != nil {
+			return errorf(ErrCodeStorage, "grith: failed to open log segment: %w", err)
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return errorf(ErrCodeStorage, "grith: failed to copy log segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close syncs and closes the current segment.
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Sync()
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	if err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to close action log: %w", err)
+	}
+	return nil
+}
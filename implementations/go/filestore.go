@@ -0,0 +1,336 @@
+package grith
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore is a Store over a directory. Documents are written as
+// content-addressed JSON files under objects/, named by the SHA-256 hash
+// of their contents, and index.json maps document IDs to those hashes.
+// Every file is written atomically, by renaming a synced temporary file,
+// and a document whose contents no longer match its hash is reported as
+// corrupt when read. It is safe for concurrent use within a single
+// process.
+type FileStore struct {
+	mu    sync.RWMutex
+	dir   string
+	index map[string]string
+	codec documentCodec
+	put   putCheck
+}
+
+const fileStoreIndex = "index.json"
+
+// OpenFileStore opens (creating if necessary) the store in dir. Objects
+// the index does not reference, left behind by an interrupted write, are
+// removed.
+func OpenFileStore(dir string) (*FileStore, error) {
+	return OpenFileStoreWithOptions(dir, nil)
+}
+
+// OpenFileStoreWithOptions opens the store in dir as OpenFileStore does,
+// with the given encryption and verification options.
+func OpenFileStoreWithOptions(dir string, opts *StoreOptions) (*FileStore, error) {
+	if dir == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: file store requires a directory")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0o700); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to create store directory: %w", err)
+	}
+	s := &FileStore{dir: dir, index: make(map[string]string), codec: newDocumentCodec(opts), put: newPutCheck(opts)}
+	b, err := os.ReadFile(filepath.Join(dir, fileStoreIndex))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errorf(ErrCodeStorage, "grith: failed to read store index: %w", err)
+	default:
+		if err := json.Unmarshal(b, &s.index); err != nil {
+			return nil, errorf(ErrCodeStorage, "grith: store index is corrupt: %w", err)
+		}
+		for id, hash := range s.index {
+			if id == "" || !isHexDigest(hash) {
+				return nil, errorf(ErrCodeStorage, "grith: store index is corrupt: invalid entry for %q", id)
+			}
+		}
+	}
+	if err := s.collectGarbage(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Put stores doc under id, replacing any existing document.
+func (s *FileStore) Put(id string, doc *CovenantDocument) error {
+	if id == "" {
+		return errorf(ErrCodeInvalidInput, "grith: fileStore.Put: id must be a non-empty string")
+	}
+	if doc == nil {
+		return errorf(ErrCodeMissingField, "grith: fileStore.Put: document is required")
+	}
+	if err := s.put.check(id, doc); err != nil {
+		return err
+	}
+	data, err := s.codec.encode(id, doc)
+	if err != nil {
+		return err
+	}
+	hash := SHA256Hex(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.objectPath(hash)); os.IsNotExist(err) {
+		if err := writeFileAtomic(filepath.Join(s.dir, "objects"), hash+".json", data); err != nil {
+			return errorf(ErrCodeStorage, "grith: fileStore.Put: failed to write document: %w", err)
+		}
+	}
+	old, existed := s.index[id]
+	s.index[id] = hash
+	if err := s.writeIndex(); err != nil {
+		if existed {
+			s.index[id] = old
+		} else {
+			delete(s.index, id)
+		}
+		return err
+	}
+	if existed && old != hash {
+		s.release(old)
+	}
+	return nil
+}
+
+// Get returns the document stored under id, or nil if there is none. A
+// document whose file is missing or does not match its hash is an error.
+func (s *FileStore) Get(id string) (*CovenantDocument, error) {
+	if id == "" {
+		return nil, errorf(ErrCodeInvalidInput, "grith: fileStore.Get: id must be a non-empty string")
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hash, ok := s.index[id]
+	if !ok {
+		return nil, nil
+	}
+	return s.read(id, hash)
+}
+
+// Delete removes the document stored under id.
+func (s *FileStore) Delete(id string) error {
+	if id == "" {
+		return errorf(ErrCodeInvalidInput, "grith: fileStore.Delete: id must be a non-empty string")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash, ok := s.index[id]
+	if !ok {
+		return errorf(ErrCodeNotFound, "grith: fileStore.Delete: document not found: %s", id)
+	}
+	delete(s.index, id)
+	if err := s.writeIndex(); err != nil {
+		s.index[id] = hash
+		return err
+	}
+	s.release(hash)
+	return nil
+}
+
+// List returns every stored document. It fails if any is corrupt.
+func (s *FileStore) List() ([]*CovenantDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*CovenantDocument, 0, len(s.index))
+	for id, hash := range s.index {
+		doc, err := s.read(id, hash)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, doc)
+	}
+	return result, nil
+}
+
+// ListPage returns up to limit documents following cursor, ordered by
+// ID, and the cursor of the next page. Only the page's documents are
+// read.
+func (s *FileStore) ListPage(cursor string, limit int) ([]*CovenantDocument, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.index))
+	for id := range s.index {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	page, next, err := pageOf(ids, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	result := make([]*CovenantDocument, 0, len(page))
+	for _, id := range page {
+		doc, err := s.read(id, s.index[id])
+		if err != nil {
+			return nil, "", err
+		}
+		result = append(result, doc)
+	}
+	return result, next, nil
+}
+
+// Has reports whether a document is stored under id.
+func (s *FileStore) Has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.index[id]
+	return ok
+}
+
+// Count returns the number of stored documents.
+func (s *FileStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.index)
+}
+
+// FindByIssuer returns the documents issued by the party with the given ID.
+func (s *FileStore) FindByIssuer(issuerID string) ([]*CovenantDocument, error) {
+	return s.find(issuedBy(issuerID))
+}
+
+// FindByBeneficiary returns the documents issued to the party with the
+// given ID.
+func (s *FileStore) FindByBeneficiary(beneficiaryID string) ([]*CovenantDocument, error) {
+	return s.find(issuedTo(beneficiaryID))
+}
+
+// FindExpiringBefore returns the documents that expire before t.
+func (s *FileStore) FindExpiringBefore(t time.Time) ([]*CovenantDocument, error) {
+	return s.find(expiringBefore(t))
+}
+
+// FindChildrenOf returns the documents chained to the given parent.
+func (s *FileStore) FindChildrenOf(parentID string) ([]*CovenantDocument, error) {
+	return s.find(childOf(parentID))
+}
+
+// FindByMetadata returns the documents whose metadata maps key to value.
+func (s *FileStore) FindByMetadata(key string, value interface{}) ([]*CovenantDocument, error) {
+	match, err := withMetadata(key, value)
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: fileStore.FindByMetadata: value is not JSON: %w", err)
+	}
+	return s.find(match)
+}
+
+// find reads every document and returns those that match, ordered by ID.
+func (s *FileStore) find(match covenantMatcher) ([]*CovenantDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs := make(map[string]*CovenantDocument, len(s.index))
+	for id, hash := range s.index {
+		doc, err := s.read(id, hash)
+		if err != nil {
+			return nil, err
+		}
+		docs[id] = doc
+	}
+	return matchDocuments(docs, match, func(doc *CovenantDocument) *CovenantDocument { return doc }), nil
+}
+
+func (s *FileStore) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash+".json")
+}
+
+// read loads and checks the object with the given hash, stored under id.
+// The caller holds the lock.
+func (s *FileStore) read(id, hash string) (*CovenantDocument, error) {
+	data, err := os.ReadFile(s.objectPath(hash))
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: fileStore: failed to read document %s: %w", hash[:16], err)
+	}
+	if SHA256Hex(data) != hash {
+		return nil, errorf(ErrCodeStorage, "grith: fileStore: document %s is corrupt", hash[:16])
+	}
+	return s.codec.decode(id, data)
+}
+
+// writeIndex persists the index. The caller holds the lock.
+func (s *FileStore) writeIndex() error {
+	data, err := json.Marshal(s.index)
+	if err != nil {
+		return errorf(ErrCodeSerialization, "grith: fileStore: failed to serialize index: %w", err)
+	}
+	if err := writeFileAtomic(s.dir, fileStoreIndex, data); err != nil {
+		return errorf(ErrCodeStorage, "grith: fileStore: failed to write index: %w", err)
+	}
+	return nil
+}
+
+// release removes the object with the given hash if no ID references it.
+// The caller holds the lock.
+func (s *FileStore) release(hash string) {
+	for _, h := range s.index {
+		if h == hash {
+			return
+		}
+	}
+	if err := os.Remove(s.objectPath(hash)); err != nil && !os.IsNotExist(err) {
+		logError(slog.LevelWarn, "file store object removal failed", err, slog.String("hash", hash))
+	}
+}
+
+// collectGarbage removes unreferenced objects and temporary files.
+func (s *FileStore) collectGarbage() error {
+	referenced := make(map[string]bool, len(s.index))
+	for _, hash := range s.index {
+		referenced[hash+".json"] = true
+	}
+	for _, dir := range []string{s.dir, filepath.Join(s.dir, "objects")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return errorf(ErrCodeStorage, "grith: failed to read store directory: %w", err)
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if strings.HasPrefix(name, ".tmp-") || (dir != s.dir && !referenced[name]) {
+				_ = os.Remove(filepath.Join(dir, name))
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces dir/name with data by writing and syncing a
+// temporary file and renaming it into place.
+func writeFileAtomic(dir, name string, data []byte) error {
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
@@ -0,0 +1,180 @@
+package grith
+
+// ChangeFork is the lineage change type of a forked identity's creation.
+const ChangeFork = "fork"
+
+// ForkLink records where a forked identity came from. A fork is a new
+// agent with its own lineage, not an evolution of its parent; the link,
+// signed by the parent's operators, names the fork's operator key and
+// why the fork was made, so the fork's provenance can be traced without
+// it inheriting the parent's identity.
+type ForkLink struct {
+	ParentID string `json:"parentId"`
+	// ParentLineageHash is the identity hash of the forked parent
+	// version's latest lineage entry.
+	ParentLineageHash string              `json:"parentLineageHash"`
+	ParentOperatorKey string              `json:"parentOperatorKey"`
+	ParentOperators   *OperatorSet        `json:"parentOperators,omitempty"`
+	ChildOperatorKey  string              `json:"childOperatorKey"`
+	Reason            string              `json:"reason"`
+	Timestamp         string              `json:"timestamp"`
+	Signature         string              `json:"signature,omitempty"`
+	Signatures        []OperatorSignature `json:"signatures,omitempty"`
+}
+
+// ForkIdentityOptions are the options for ForkIdentity.
+type ForkIdentityOptions struct {
+	// ParentKeyPair signs the fork link for a single-operator parent;
+	// ParentKeyPairs sign it for an organizational one.
+	ParentKeyPair  *KeyPair
+	ParentKeyPairs []*KeyPair
+	// OperatorKeyPair is the fork's operator key, which may be the
+	// parent's.
+	OperatorKeyPair *KeyPair
+	// Reason explains the fork. Required.
+	Reason             string
+	OperatorIdentifier string
+	// Model, Capabilities, and Deployment default to the parent's.
+	Model        *ModelAttestation
+	Capabilities []string
+	Deployment   *DeploymentContext
+}
+
+// ForkIdentity creates a new identity forked from parent. Its creation
+// lineage entry has change type "fork" and carries a ForkLink signed by
+// the parent's operators. Sub-identities cannot be forked, since the fork
+// would escape their parent's capability bound.
+func ForkIdentity(parent *AgentIdentity, opts *ForkIdentityOptions) (*AgentIdentity, error) {
+	if parent == nil || len(parent.Lineage) == 0 {
+		return nil, errorf(ErrCodeMissingField, "grith: parent identity with a lineage is required")
+	}
+	if opts == nil || opts.OperatorKeyPair == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: fork requires an operator key pair")
+	}
+	if opts.Reason == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: fork reason is required")
+	}
+	if parent.Parent != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: sub-identity %s cannot be forked", shortID(parent.ID))
+	}
+	if result, err := VerifyIdentity(parent); err != nil || !result.Valid {
+		return nil, errorf(ErrCodeInvalidInput, "grith: parent identity %s failed verification", shortID(parent.ID))
+	}
+	if opts.ParentKeyPair != nil && parent.Operators == nil && opts.ParentKeyPair.PublicKeyHex != parent.OperatorPublicKey {
+		return nil, errorf(ErrCodeInvalidInput, "grith: parent key pair is not the parent's operator key")
+	}
+
+	link := &ForkLink{
+		ParentID:          parent.ID,
+		ParentLineageHash: parent.Lineage[len(parent.Lineage)-1].IdentityHash,
+		ParentOperatorKey: parent.OperatorPublicKey,
+		ParentOperators:   copyOperatorSet(parent.Operators),
+		ChildOperatorKey:  opts.OperatorKeyPair.PublicKeyHex,
+		Reason:            opts.Reason,
+		Timestamp:         Timestamp(),
+	}
+	payload, err := forkLinkPayload(link)
+	if err != nil {
+		return nil, err
+	}
+	link.Signature, link.Signatures, err = signAsOperators(payload, opts.ParentKeyPair, opts.ParentKeyPairs, parent.Operators)
+	if err != nil {
+		return nil, err
+	}
+
+	create := &CreateIdentityOptions{
+		OperatorKeyPair:    opts.OperatorKeyPair,
+		OperatorIdentifier: parent.OperatorIdentifier,
+		Model:              parent.Model,
+		Capabilities:       parent.Capabilities,
+		Deployment:         parent.Deployment,
+		EvolutionPolicy:    parent.EvolutionPolicy,
+	}
+	if opts.OperatorIdentifier != "" {
+		create.OperatorIdentifier = opts.OperatorIdentifier
+	}
+	if opts.Model != nil {
+		create.Model = *opts.Model
+	}
+	if opts.Capabilities != nil {
+		create.Capabilities = opts.Capabilities
+	}
+	if opts.Deployment != nil {
+		create.Deployment = *opts.Deployment
+	}
+	return createIdentity(create, nil, link)
+}
+
+func forkLinkPayload(link *ForkLink) ([]byte, error) {
+	m, err := objectToMap(link)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to convert fork link to map: %w", err)
+	}
+	delete(m, "signature")
+	delete(m, "signatures")
+	canonical, err := CanonicalizeJSON(m)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to canonicalize fork link: %w", err)
+	}
+	return []byte(canonical), nil
+}
+
+// verifyForkLink checks that link is signed by the parent's operators
+// and names a key the identity's lineage links to its current key.
+func verifyForkLink(identity *AgentIdentity, link *ForkLink) error {
+	if link.Reason == "" {
+		return errorf(ErrCodeMissingField, "grith: fork link has no reason")
+	}
+	if !identityHasKey(identity, link.ChildOperatorKey) {
+		return errorf(ErrCodeInvalidInput, "grith: fork link names a different operator key")
+	}
+	payload, err := forkLinkPayload(link)
+	if err != nil {
+		return err
+	}
+	set, sigs := link.ParentOperators, link.Signatures
+	if set == nil {
+		set = &OperatorSet{Keys: []string{link.ParentOperatorKey}, Threshold: 1}
+		sigs = []OperatorSignature{{PublicKey: link.ParentOperatorKey, Signature: link.Signature}}
+	} else if validateOperatorSet(set) != nil || set.Keys[0] != link.ParentOperatorKey {
+		return errorf(ErrCodeInvalidInput, "grith: fork link has an invalid operator set")
+	}
+	if !verifyOperatorSignatures(payload, sigs, set) {
+		return errorf(ErrCodeCrypto, "grith: fork link is not signed by the parent's operators")
+	}
+	return nil
+}
+
+// ForkOf returns the fork link of identity, or nil if it was not forked.
+func ForkOf(identity *AgentIdentity) *ForkLink {
+	if identity == nil || len(identity.Lineage) == 0 {
+		return nil
+	}
+	return identity.Lineage[0].Fork
+}
+
+// VerifyFork verifies child and checks that it was forked from parent or
+// an earlier version of it, under an operator key or set the parent
+// still holds or held at the time.
+func VerifyFork(child, parent *AgentIdentity) error {
+	if child == nil || parent == nil {
+		return errorf(ErrCodeMissingField, "grith: child and parent identities are required")
+	}
+	link := ForkOf(child)
+	if link == nil {
+		return errorf(ErrCodeInvalidInput, "grith: identity %s is not a fork", shortID(child.ID))
+	}
+	if result, err := VerifyIdentity(child); err != nil || !result.Valid {
+		return errorf(ErrCodeInvalidInput, "grith: forked identity %s failed verification", shortID(child.ID))
+	}
+	if result, err := VerifyIdentity(parent); err != nil || !result.Valid {
+		return errorf(ErrCodeInvalidInput, "grith: parent identity %s failed verification", shortID(parent.ID))
+	}
+	if !identityHasLineage(parent, link.ParentLineageHash) {
+		return errorf(ErrCodeInvalidInput, "grith: identity %s was not forked from %s", shortID(child.ID), shortID(parent.ID))
+	}
+	if !identityHasKey(parent, link.ParentOperatorKey) && !parentHadOperatorKey(parent, link.ParentOperatorKey) {
+		return errorf(ErrCodeInvalidInput, "grith: identity %s was forked under a key that %s never held", shortID(child.ID), shortID(parent.ID))
+	}
+	return nil
+}
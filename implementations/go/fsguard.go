@@ -0,0 +1,159 @@
+package grith
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// The CCL actions of file system accesses through a GuardedFS or
+// GuardedDir.
+const (
+	ActionFileRead   = "file.read"
+	ActionFileWrite  = "file.write"
+	ActionFileDelete = "file.delete"
+)
+
+// GuardedFSOptions configure NewGuardedFS and NewGuardedDir.
+type GuardedFSOptions struct {
+	// Enforcer checks and logs every access. Required.
+	Enforcer *Enforcer
+}
+
+// GuardedFS is an fs.FS that checks every access against a covenant
+// before making it. Opening, reading, listing, or statting a path is a
+// file.read action on the resource "/" + path, with the operation ("open",
+// "readfile", "readdir", or "stat") as op in the evaluation context.
+// Denied accesses fail with fs.ErrPermission; every access, permitted or
+// denied, is logged by the enforcer. Reads through an opened fs.File are
+// covered by the check made when it was opened.
+//
+// GuardedFS implements fs.ReadFileFS, fs.ReadDirFS, and fs.StatFS. It is
+// safe for concurrent use if the underlying file system is.
+type GuardedFS struct {
+	fsys     fs.FS
+	enforcer *Enforcer
+}
+
+// NewGuardedFS returns a GuardedFS over fsys.
+func NewGuardedFS(fsys fs.FS, opts *GuardedFSOptions) (*GuardedFS, error) {
+	if fsys == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: guarded file system requires a file system")
+	}
+	if opts == nil || opts.Enforcer == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: guarded file system requires an enforcer")
+	}
+	return &GuardedFS{fsys: fsys, enforcer: opts.Enforcer}, nil
+}
+
+// check checks an access to name, returning an *fs.PathError if the name
+// is invalid, the access is denied, or the check fails.
+func (g *GuardedFS) check(op, action, name string, extra map[string]interface{}) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	resource := "/"
+	if name != "." {
+		resource += name
+	}
+	evalContext := map[string]interface{}{"op": op}
+	for k, v := range extra {
+		evalContext[k] = v
+	}
+	d, err := g.enforcer.Check(context.Background(), action, resource, evalContext)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if !d.Permitted {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+// Open checks a file.read of name and opens it.
+func (g *GuardedFS) Open(name string) (fs.File, error) {
+	if err := g.check("open", ActionFileRead, name, nil); err != nil {
+		return nil, err
+	}
+	return g.fsys.Open(name)
+}
+
+// ReadFile checks a file.read of name and reads it.
+func (g *GuardedFS) ReadFile(name string) ([]byte, error) {
+	if err := g.check("readfile", ActionFileRead, name, nil); err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(g.fsys, name)
+}
+
+// ReadDir checks a file.read of the directory name and lists it.
+func (g *GuardedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := g.check("readdir", ActionFileRead, name, nil); err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(g.fsys, name)
+}
+
+// Stat checks a file.read of name and returns its FileInfo.
+func (g *GuardedFS) Stat(name string) (fs.FileInfo, error) {
+	if err := g.check("stat", ActionFileRead, name, nil); err != nil {
+		return nil, err
+	}
+	return fs.Stat(g.fsys, name)
+}
+
+// GuardedDir is a GuardedFS over an operating system directory that can
+// also write. Writing a file or creating a directory is a file.write
+// action, with op "writefile" or "mkdir" and, for files, the size of the
+// data as size; removing one is a file.delete action with op "remove".
+//
+// Paths are resolved within the directory, but, as with os.DirFS,
+// symbolic links inside it are followed.
+type GuardedDir struct {
+	*GuardedFS
+	dir string
+}
+
+// NewGuardedDir returns a GuardedDir rooted at dir.
+func NewGuardedDir(dir string, opts *GuardedFSOptions) (*GuardedDir, error) {
+	if dir == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: guarded directory requires a directory")
+	}
+	g, err := NewGuardedFS(os.DirFS(dir), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &GuardedDir{GuardedFS: g, dir: dir}, nil
+}
+
+func (g *GuardedDir) path(name string) string {
+	return filepath.Join(g.dir, filepath.FromSlash(name))
+}
+
+// WriteFile checks a file.write of name and writes data to it, creating
+// it with perm if necessary.
+func (g *GuardedDir) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := g.check("writefile", ActionFileWrite, name, map[string]interface{}{"size": len(data)}); err != nil {
+		return err
+	}
+	return os.WriteFile(g.path(name), data, perm)
+}
+
+// MkdirAll checks a file.write of name and creates it as a directory,
+// along with any missing parents.
+func (g *GuardedDir) MkdirAll(name string, perm fs.FileMode) error {
+	if err := g.check("mkdir", ActionFileWrite, name, nil); err != nil {
+		return err
+	}
+	return os.MkdirAll(g.path(name), perm)
+}
+
+// Remove checks a file.delete of name and removes the file or empty
+// directory.
+func (g *GuardedDir) Remove(name string) error {
+	if err := g.check("remove", ActionFileDelete, name, nil); err != nil {
+		return err
+	}
+	return os.Remove(g.path(name))
+}
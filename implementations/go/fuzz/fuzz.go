@@ -0,0 +1,217 @@
+// Package fuzz provides native Go fuzz targets, with seed corpora, for the
+// parts of grith that consume untrusted input directly: the CCL parser,
+// covenant deserialization, JSON canonicalization, and action and
+// resource matching. Besides not panicking, each target checks an
+// invariant of the function it fuzzes, such as canonicalization being
+// idempotent.
+//
+// The targets are exported so that integrators can fuzz the grith they
+// build against in their own CI. A target is run from a fuzz function in
+// a _test.go file:
+//
+//	func FuzzParse(f *testing.F) { fuzz.Parse(f) }
+//
+// and then with go test -fuzz=FuzzParse. This package's own tests declare
+// the same functions, so go test -fuzz=FuzzParse ./fuzz fuzzes grith
+// itself.
+package fuzz
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	grith "github.com/agbusiness195/grith/implementations/go"
+)
+
+// cclSeeds are representative CCL sources, including malformed ones.
+var cclSeeds = []string{
+	"permit read on '/data/**'",
+	"deny write on '/system/**'",
+	"permit api.call on '**' when risk_level = 'low'",
+	"deny delete on '/data/**' when user.role != 'admin' and count > 3",
+	"permit read on '/a' when not (x = 1 or y < 2.5)",
+	"require audit.log on '**'",
+	"limit api.call 100 per 1 hours",
+	"permit read on '/data/**'\ndeny read on '/data/secret/**'\n# comment\nlimit write 10 per 60 seconds",
+	"permit file.* on '/tmp/*' when tags contains 'x'",
+	"permit",
+	"permit read on",
+	"limit api.call -1 per 0 days",
+	"deny write on '/unterminated",
+	"permit read on '/a' when (x = ",
+	"",
+}
+
+// Parse fuzzes grith.Parse. Parsed documents must evaluate, and serialize
+// without panicking.
+func Parse(f *testing.F) {
+	for _, s := range cclSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		doc, err := grith.Parse(source)
+		if err != nil {
+			if doc != nil {
+				t.Fatalf("Parse returned a document and error %v", err)
+			}
+			return
+		}
+		grith.Evaluate(doc, "read", "/data/x", map[string]interface{}{"risk_level": "low", "count": 5})
+		grith.Serialize(doc)
+	})
+}
+
+// DeserializeCovenant fuzzes grith.DeserializeCovenant. Accepted documents
+// must serialize and deserialize again to the same document ID.
+func DeserializeCovenant(f *testing.F) {
+	for _, s := range covenantSeeds(f) {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		doc, err := grith.DeserializeCovenant(data)
+		if err != nil {
+			return
+		}
+		out, err := grith.SerializeCovenant(doc)
+		if err != nil {
+			t.Fatalf("SerializeCovenant of a deserialized covenant: %v", err)
+		}
+		again, err := grith.DeserializeCovenant(out)
+		if err != nil {
+			t.Fatalf("DeserializeCovenant of a serialized covenant: %v\n%s", err, out)
+		}
+		if again.ID != doc.ID {
+			t.Fatalf("round trip changed ID %q to %q", doc.ID, again.ID)
+		}
+	})
+}
+
+// covenantSeeds returns a signed covenant, a countersigned chained one,
+// and malformed variants of them.
+func covenantSeeds(f *testing.F) []string {
+	issuer, err := grith.GenerateKeyPair()
+	if err != nil {
+		f.Fatal(err)
+	}
+	beneficiary, err := grith.GenerateKeyPair()
+	if err != nil {
+		f.Fatal(err)
+	}
+	opts := &grith.CovenantBuilderOptions{
+		Issuer:      grith.Party{ID: "alice", PublicKey: issuer.PublicKeyHex, Role: "issuer"},
+		Beneficiary: grith.Party{ID: "bob", PublicKey: beneficiary.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'\ndeny write on '/system/**'",
+		PrivateKey:  issuer.PrivateKey,
+	}
+	parent, err := grith.BuildCovenant(opts)
+	if err != nil {
+		f.Fatal(err)
+	}
+	opts.Constraints = "permit read on '/data/public/**'"
+	opts.Chain = &grith.ChainReference{ParentID: parent.ID, Relation: "delegates", Depth: 1}
+	child, err := grith.BuildCovenant(opts)
+	if err != nil {
+		f.Fatal(err)
+	}
+	if child, err = grith.CountersignCovenant(child, beneficiary, "auditor"); err != nil {
+		f.Fatal(err)
+	}
+	var seeds []string
+	for _, doc := range []*grith.CovenantDocument{parent, child} {
+		s, err := grith.SerializeCovenant(doc)
+		if err != nil {
+			f.Fatal(err)
+		}
+		seeds = append(seeds, s, s[:len(s)/2], strings.Replace(s, `"version":"1.0"`, `"version":"9.0"`, 1))
+	}
+	return append(seeds, `{}`, `{"id":"x","version":"1.0"}`, `[]`, `null`, `{"id":`)
+}
+
+// CanonicalizeJSON fuzzes grith.CanonicalizeJSON with decoded JSON
+// values. The output must be valid JSON and canonicalizing it again must
+// reproduce it.
+func CanonicalizeJSON(f *testing.F) {
+	for _, s := range []string{
+		`{"b":2,"a":1}`,
+		`{"z":{"y":[3,{"c":null,"b":true}]},"a":"x"}`,
+		`[1e21,1e-7,-0,0.1,123456789012345680000]`,
+		`{"é":1,"e":2,"😀":3,"<&>":" "}`,
+		`"\u0000\u001f"`,
+		`null`,
+		`{}`,
+	} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v interface{}
+		if json.Unmarshal(data, &v) != nil {
+			return
+		}
+		canonical, err := grith.CanonicalizeJSON(v)
+		if err != nil {
+			return
+		}
+		var reparsed interface{}
+		if err := json.Unmarshal([]byte(canonical), &reparsed); err != nil {
+			t.Fatalf("canonical form is not valid JSON: %v\n%s", err, canonical)
+		}
+		again, err := grith.CanonicalizeJSON(reparsed)
+		if err != nil {
+			t.Fatalf("canonicalizing the canonical form: %v", err)
+		}
+		if again != canonical {
+			t.Fatalf("canonicalization is not idempotent:\n%s\n%s", canonical, again)
+		}
+	})
+}
+
+// MatchAction fuzzes grith.MatchAction. A pattern without wildcards
+// matches itself, and ** matches every action.
+func MatchAction(f *testing.F) {
+	for _, s := range [][2]string{
+		{"read", "read"},
+		{"file.*", "file.read"},
+		{"file.**", "file.read.all"},
+		{"**.read", "a.b.read"},
+		{"a.**.b.**.c", "a.x.b.y.z.c"},
+		{"*", ""},
+		{"..", "."},
+	} {
+		f.Add(s[0], s[1])
+	}
+	f.Fuzz(func(t *testing.T, pattern, action string) {
+		grith.MatchAction(pattern, action)
+		if !strings.Contains(action, "*") && !grith.MatchAction(action, action) {
+			t.Fatalf("action %q does not match itself", action)
+		}
+		if !grith.MatchAction("**", action) {
+			t.Fatalf("** does not match %q", action)
+		}
+	})
+}
+
+// MatchResource fuzzes grith.MatchResource. A pattern without wildcards
+// matches itself, and ** matches every resource.
+func MatchResource(f *testing.F) {
+	for _, s := range [][2]string{
+		{"/data/**", "/data/a/b"},
+		{"/data/*", "/data/a"},
+		{"/data/*/x", "/data/a/x/"},
+		{"**/secret", "/a/b/secret"},
+		{"/", ""},
+		{"//a//", "a"},
+		{"/a/**/b/**/c", "/a/x/b/y/z/c"},
+	} {
+		f.Add(s[0], s[1])
+	}
+	f.Fuzz(func(t *testing.T, pattern, resource string) {
+		grith.MatchResource(pattern, resource)
+		if !strings.Contains(resource, "*") && !grith.MatchResource(resource, resource) {
+			t.Fatalf("resource %q does not match itself", resource)
+		}
+		if !grith.MatchResource("**", resource) {
+			t.Fatalf("** does not match %q", resource)
+		}
+	})
+}
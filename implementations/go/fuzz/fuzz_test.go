@@ -0,0 +1,9 @@
+package fuzz
+
+import "testing"
+
+func FuzzParse(f *testing.F)               { Parse(f) }
+func FuzzDeserializeCovenant(f *testing.F) { DeserializeCovenant(f) }
+func FuzzCanonicalizeJSON(f *testing.F)    { CanonicalizeJSON(f) }
+func FuzzMatchAction(f *testing.F)         { MatchAction(f) }
+func FuzzMatchResource(f *testing.F)       { MatchResource(f) }
@@ -1,9 +1,36 @@
 package grith
 
 import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -710,12 +737,37 @@ limit api.call 100 per 1 hours`
 	if len(doc2.Statements) != len(doc.Statements) {
 		t.Errorf("re-parsed statement count = %d, want %d", len(doc2.Statements), len(doc.Statements))
 	}
+
+	// Condition values keep their quoting; numbers and booleans stay bare.
+	for _, src := range []string{
+		"permit read on '/data/**' when role = 'admin'",
+		"deny write on '/data/**' when risk > 3",
+		"require audit.log on '/data/**' when user.flagged = true",
+	} {
+		doc, err := Parse(src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", src, err)
+		}
+		if got := Serialize(doc); got != src {
+			t.Errorf("Serialize(Parse(%q)) = %q", src, got)
+		}
+	}
 }
 
 // ═══════════════════════════════════════════════════════════════════════════════
 // Covenant tests
 // ═══════════════════════════════════════════════════════════════════════════════
 
+// requireReflectJSON skips tests that convert identities, log entries,
+// and other non-covenant values to JSON, which builds tagged
+// grith_noreflect refuse.
+func requireReflectJSON(t *testing.T) {
+	t.Helper()
+	if !reflectJSON {
+		t.Skip("converting this value to JSON requires reflection, which grith_noreflect excludes")
+	}
+}
+
 func makeTestKeyPairs(t *testing.T) (*KeyPair, *KeyPair) {
 	t.Helper()
 	kp1, err := GenerateKeyPair()
@@ -1198,7 +1250,7 @@ func TestValidateChainNarrowing(t *testing.T) {
 		},
 	})
 
-	result, err := ValidateChainNarrowing(child, parent)
+	result, err := ValidateChainNarrowing(child, parent, nil)
 	if err != nil {
 		t.Fatalf("ValidateChainNarrowing() error: %v", err)
 	}
@@ -1229,7 +1281,7 @@ func TestValidateChainNarrowingViolation(t *testing.T) {
 		},
 	})
 
-	result, err := ValidateChainNarrowing(child, parent)
+	result, err := ValidateChainNarrowing(child, parent, nil)
 	if err != nil {
 		t.Fatalf("ValidateChainNarrowing() error: %v", err)
 	}
@@ -1361,7 +1413,7 @@ func TestCreateIdentityValidation(t *testing.T) {
 func TestVerifyIdentity(t *testing.T) {
 	kp, _ := GenerateKeyPair()
 
-	identity, _ := CreateIdentity(&CreateIdentityOptions{
+	identity, err := CreateIdentity(&CreateIdentityOptions{
 		OperatorKeyPair: kp,
 		Model: ModelAttestation{
 			Provider: "anthropic",
@@ -1370,20 +1422,28 @@ func TestVerifyIdentity(t *testing.T) {
 		Capabilities: []string{"read"},
 		Deployment:   DeploymentContext{Runtime: RuntimeContainer},
 	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
 
-	valid, err := VerifyIdentity(identity)
+	result, err := VerifyIdentity(identity)
 	if err != nil {
 		t.Fatalf("VerifyIdentity() error: %v", err)
 	}
-	if !valid {
-		t.Error("expected identity to be valid")
+	if !result.Valid {
+		t.Errorf("expected identity to be valid: %+v", result.Checks)
+	}
+	for _, name := range []string{"signature_valid", "id_match", "capability_hash", "lineage_integrity", "parent_binding"} {
+		if c := findCheckIn(result.Checks, name); c == nil || !c.Passed {
+			t.Errorf("check %s = %+v, want passed", name, c)
+		}
 	}
 }
 
 func TestVerifyIdentityTampered(t *testing.T) {
 	kp, _ := GenerateKeyPair()
 
-	identity, _ := CreateIdentity(&CreateIdentityOptions{
+	identity, err := CreateIdentity(&CreateIdentityOptions{
 		OperatorKeyPair: kp,
 		Model: ModelAttestation{
 			Provider: "anthropic",
@@ -1392,23 +1452,96 @@ func TestVerifyIdentityTampered(t *testing.T) {
 		Capabilities: []string{"read"},
 		Deployment:   DeploymentContext{Runtime: RuntimeContainer},
 	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
 
 	// Tamper with the operator identifier
 	identity.OperatorIdentifier = "tampered"
 
-	valid, err := VerifyIdentity(identity)
+	result, err := VerifyIdentity(identity)
 	if err != nil {
 		t.Fatalf("VerifyIdentity() error: %v", err)
 	}
-	if valid {
+	if result.Valid {
 		t.Error("tampered identity should not be valid")
 	}
+	if c := findCheckIn(result.Checks, "signature_valid"); c == nil || c.Passed {
+		t.Error("signature_valid should fail for a tampered identity")
+	}
+}
+
+func TestVerifyIdentityChecks(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: kp,
+		Model:           ModelAttestation{Provider: "anthropic", ModelID: "claude-3"},
+		Capabilities:    []string{"read"},
+		Deployment:      DeploymentContext{Runtime: RuntimeContainer},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	evolved, err := EvolveIdentity(identity, &EvolveIdentityOptions{
+		OperatorKeyPair: kp,
+		ChangeType:      "capability_change",
+		Description:     "Added write",
+		Capabilities:    []string{"read", "write"},
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+
+	// Each tampering, re-signed by the operator, fails only its own check.
+	resign := func(v *AgentIdentity) *AgentIdentity {
+		payload, _ := identitySigningPayload(v)
+		sig, _ := Sign([]byte(payload), kp.PrivateKey)
+		v.Signature = ToHex(sig)
+		return v
+	}
+	failing := func(v *AgentIdentity) string {
+		result, err := VerifyIdentity(v)
+		if err != nil {
+			t.Fatalf("VerifyIdentity() error: %v", err)
+		}
+		return failedCheckNames(result.Checks)
+	}
+
+	extraCap := *evolved
+	extraCap.Capabilities = []string{"admin", "read", "write"}
+	if got := failing(resign(&extraCap)); got != "capability_hash and lineage_integrity" {
+		t.Errorf("capability tampering failed %q", got)
+	}
+	unlinked := *evolved
+	unlinked.Lineage = append([]LineageEntry(nil), evolved.Lineage...)
+	unlinked.Lineage[1].ParentHash = nil
+	if got := failing(resign(&unlinked)); got != "id_match and lineage_integrity" {
+		t.Errorf("lineage tampering failed %q", got)
+	}
+	renamed := *evolved
+	renamed.ID = identity.ID
+	if got := failing(resign(&renamed)); got != "id_match" {
+		t.Errorf("ID tampering failed %q", got)
+	}
+
+	// Expiry is opt-in through VerifyIdentityWithOptions.
+	result, err := VerifyIdentityWithOptions(evolved, &IdentityVerifyOptions{MaxAge: time.Hour, Now: time.Now().Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatalf("VerifyIdentityWithOptions() error: %v", err)
+	}
+	if c := findCheckIn(result.Checks, "not_expired"); result.Valid || c == nil || c.Passed {
+		t.Errorf("stale identity should fail not_expired: %+v", result.Checks)
+	}
+	result, _ = VerifyIdentityWithOptions(evolved, &IdentityVerifyOptions{MaxAge: time.Hour})
+	if !result.Valid {
+		t.Errorf("current identity should pass: %+v", result.Checks)
+	}
 }
 
 func TestEvolveIdentity(t *testing.T) {
 	kp, _ := GenerateKeyPair()
 
-	identity, _ := CreateIdentity(&CreateIdentityOptions{
+	identity, err := CreateIdentity(&CreateIdentityOptions{
 		OperatorKeyPair: kp,
 		Model: ModelAttestation{
 			Provider: "anthropic",
@@ -1417,6 +1550,9 @@ func TestEvolveIdentity(t *testing.T) {
 		Capabilities: []string{"read"},
 		Deployment:   DeploymentContext{Runtime: RuntimeContainer},
 	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
 
 	evolved, err := EvolveIdentity(identity, &EvolveIdentityOptions{
 		OperatorKeyPair: kp,
@@ -1447,8 +1583,8 @@ func TestEvolveIdentity(t *testing.T) {
 	if evolved.Lineage[1].ParentHash == nil {
 		t.Error("lineage[1].parentHash should not be nil")
 	}
-	if evolved.Lineage[1].ReputationCarryForward != DefaultEvolutionPolicy.ModelVersionChange {
-		t.Errorf("carry-forward = %f, want %f", evolved.Lineage[1].ReputationCarryForward, DefaultEvolutionPolicy.ModelVersionChange)
+	if evolved.Lineage[1].ReputationCarryForward != DefaultEvolutionPolicy().ModelVersionChange {
+		t.Errorf("carry-forward = %f, want %f", evolved.Lineage[1].ReputationCarryForward, DefaultEvolutionPolicy().ModelVersionChange)
 	}
 	if evolved.ID == identity.ID {
 		t.Error("evolved identity should have different ID")
@@ -1458,404 +1594,9609 @@ func TestEvolveIdentity(t *testing.T) {
 	}
 
 	// Verify evolved identity
-	valid, _ := VerifyIdentity(evolved)
-	if !valid {
+	result, _ := VerifyIdentity(evolved)
+	if !result.Valid {
 		t.Error("evolved identity should be valid")
 	}
 }
 
-func TestComputeEffectiveCarryForward(t *testing.T) {
-	kp, _ := GenerateKeyPair()
+func TestEvolveIdentityCapabilityInference(t *testing.T) {
+	d := DiffCapabilities([]string{"read", "write"}, []string{"write", "admin", "admin"})
+	if strings.Join(d.Added, ",") != "admin" || strings.Join(d.Removed, ",") != "read" {
+		t.Errorf("DiffCapabilities() = %+v", d)
+	}
+	if !DiffCapabilities([]string{"a", "b"}, []string{"b", "a"}).Empty() {
+		t.Error("reordered capabilities should diff empty")
+	}
 
-	identity, _ := CreateIdentity(&CreateIdentityOptions{
+	kp, _ := GenerateKeyPair()
+	identity, err := CreateIdentity(&CreateIdentityOptions{
 		OperatorKeyPair: kp,
-		Model: ModelAttestation{
-			Provider: "anthropic",
-			ModelID:  "claude-3",
-		},
-		Capabilities: []string{"read"},
-		Deployment:   DeploymentContext{Runtime: RuntimeContainer},
+		Model:           ModelAttestation{Provider: "anthropic", ModelID: "claude-3"},
+		Capabilities:    []string{"read", "write"},
+		Deployment:      DeploymentContext{Runtime: RuntimeContainer},
 	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	policy := DefaultEvolutionPolicy()
+	cases := []struct {
+		name, changeType string
+		capabilities     []string
+		want             float64
+	}{
+		{"expansion mislabelled as reduction", "capability_reduction", []string{"read", "write", "admin"}, policy.CapabilityExpansion},
+		{"reduction", "capability_reduction", []string{"read"}, policy.CapabilityReduction},
+		{"inferred reduction", "", []string{"read"}, policy.CapabilityReduction},
+		{"mixed", "capability_change", []string{"read", "admin"}, min(policy.CapabilityExpansion, policy.CapabilityReduction)},
+		{"unchanged", "capability_expansion", []string{"write", "read"}, policy.MinorUpdate},
+		{"expansion under another type", "merge", []string{"read", "write", "admin"}, min(policy.MinorUpdate, policy.CapabilityExpansion)},
+	}
+	for _, c := range cases {
+		evolved, err := EvolveIdentity(identity, &EvolveIdentityOptions{
+			OperatorKeyPair: kp,
+			ChangeType:      c.changeType,
+			Description:     c.name,
+			Capabilities:    c.capabilities,
+		})
+		if err != nil {
+			t.Fatalf("%s: EvolveIdentity() error: %v", c.name, err)
+		}
+		entry := evolved.Lineage[len(evolved.Lineage)-1]
+		if entry.ReputationCarryForward != c.want {
+			t.Errorf("%s: carry-forward = %v, want %v", c.name, entry.ReputationCarryForward, c.want)
+		}
+		if c.changeType != "merge" && entry.ChangeType != ChangeCapability {
+			t.Errorf("%s: changeType = %s, want %s", c.name, entry.ChangeType, ChangeCapability)
+		}
+	}
 
-	// Initially 1.0
-	rate := ComputeEffectiveCarryForward(identity)
-	if rate != 1.0 {
-		t.Errorf("initial carry-forward = %f, want 1.0", rate)
+	if _, err := EvolveIdentity(identity, &EvolveIdentityOptions{OperatorKeyPair: kp, Description: "nothing"}); err == nil {
+		t.Error("EvolveIdentity() should require a changeType it cannot infer")
 	}
 
-	// After model update (0.8)
-	evolved, _ := EvolveIdentity(identity, &EvolveIdentityOptions{
+	// A re-signed lineage cannot claim more reputation than its
+	// capability changes earn.
+	expanded, err := EvolveIdentity(identity, &EvolveIdentityOptions{
 		OperatorKeyPair: kp,
-		ChangeType:      "model_update",
-		Description:     "model update",
-		Model: &ModelAttestation{
-			Provider: "anthropic",
-			ModelID:  "claude-3.5",
-		},
+		ChangeType:      "capability_reduction",
+		Description:     "expansion",
+		Capabilities:    []string{"read", "write", "admin"},
 	})
-
-	rate = ComputeEffectiveCarryForward(evolved)
-	expected := 1.0 * DefaultEvolutionPolicy.ModelVersionChange
-	if rate != expected {
-		t.Errorf("carry-forward after model update = %f, want %f", rate, expected)
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	if result, _ := VerifyIdentity(expanded); !result.Valid {
+		t.Fatalf("evolved identity should verify: %+v", result.Checks)
+	}
+	forge := func(name string, tamper func(*LineageEntry)) {
+		forged := *expanded
+		forged.Lineage = append([]LineageEntry(nil), expanded.Lineage...)
+		entry := &forged.Lineage[len(forged.Lineage)-1]
+		tamper(entry)
+		payload, _ := lineageSigningPayload(entry)
+		sig, _ := Sign([]byte(payload), kp.PrivateKey)
+		entry.Signature = ToHex(sig)
+		payload, _ = identitySigningPayload(&forged)
+		sig, _ = Sign([]byte(payload), kp.PrivateKey)
+		forged.Signature = ToHex(sig)
+		result, err := VerifyIdentity(&forged)
+		if err != nil {
+			t.Fatalf("%s: VerifyIdentity() error: %v", name, err)
+		}
+		if check := findCheckIn(result.Checks, "lineage_integrity"); result.Valid || check == nil || check.Passed {
+			t.Errorf("%s: forged lineage should fail lineage_integrity", name)
+		}
 	}
+	forge("inflated carry-forward", func(e *LineageEntry) { e.ReputationCarryForward = 1 })
+	forge("reduction rate", func(e *LineageEntry) { e.ReputationCarryForward = policy.CapabilityReduction })
+	forge("unrecorded capabilities", func(e *LineageEntry) {
+		e.Capabilities = nil
+		e.ReputationCarryForward = policy.MinorUpdate
+	})
+	forge("reduction recorded", func(e *LineageEntry) {
+		e.Capabilities = []string{"read"}
+		e.ReputationCarryForward = policy.CapabilityReduction
+	})
+	forge("unadopted policy", func(e *LineageEntry) {
+		lenient := DefaultEvolutionPolicy()
+		lenient.CapabilityExpansion = 1
+		e.PolicyHash = ComputeEvolutionPolicyHash(lenient)
+		e.ReputationCarryForward = 1
+	})
 }
 
-// ═══════════════════════════════════════════════════════════════════════════════
-// Store tests
-// ═══════════════════════════════════════════════════════════════════════════════
-
-func TestMemoryStorePutGet(t *testing.T) {
-	store := NewMemoryStore()
-	doc, _ := buildTestCovenant(t)
+func TestEvolutionPolicyPerIdentity(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+	strict := DefaultEvolutionPolicy()
+	strict.CapabilityExpansion = 0.5
+	strict.OperatorKeyRotation = 0.9
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: kp,
+		Model:           ModelAttestation{Provider: "anthropic", ModelID: "claude-3"},
+		Capabilities:    []string{"read"},
+		Deployment:      DeploymentContext{Runtime: RuntimeContainer},
+		EvolutionPolicy: &strict,
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	strictHash := ComputeEvolutionPolicyHash(strict)
+	if identity.Lineage[0].PolicyHash != strictHash {
+		t.Error("creation entry should record the policy hash")
+	}
 
-	err := store.Put(doc.ID, doc)
+	// Evolutions are rated by the identity's policy and record its hash.
+	expanded, err := EvolveIdentity(identity, &EvolveIdentityOptions{
+		OperatorKeyPair: kp,
+		ChangeType:      "capability_change",
+		Description:     "Added write",
+		Capabilities:    []string{"read", "write"},
+	})
 	if err != nil {
-		t.Fatalf("Put() error: %v", err)
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	entry := expanded.Lineage[1]
+	if entry.ReputationCarryForward != 0.5 || entry.PolicyHash != strictHash {
+		t.Errorf("entry = %+v, want carry-forward 0.5 under the strict policy", entry)
+	}
+	newKP, _ := GenerateKeyPair()
+	rotated, err := RotateOperatorKey(expanded, kp, newKP)
+	if err != nil {
+		t.Fatalf("RotateOperatorKey() error: %v", err)
+	}
+	if rotated.Lineage[2].ReputationCarryForward != 0.9 {
+		t.Errorf("rotation carry-forward = %v, want 0.9", rotated.Lineage[2].ReputationCarryForward)
 	}
 
-	retrieved, err := store.Get(doc.ID)
+	// A new policy replaces the old one from the evolution that sets it.
+	lenient := DefaultEvolutionPolicy()
+	lenient.CapabilityExpansion = 1
+	relaxed, err := EvolveIdentity(rotated, &EvolveIdentityOptions{
+		OperatorKeyPair: newKP,
+		ChangeType:      "capability_change",
+		Description:     "Added admin",
+		Capabilities:    []string{"read", "write", "admin"},
+		EvolutionPolicy: &lenient,
+	})
 	if err != nil {
-		t.Fatalf("Get() error: %v", err)
+		t.Fatalf("EvolveIdentity() error: %v", err)
 	}
-	if retrieved == nil {
-		t.Fatal("Get() returned nil for stored document")
+	if e := relaxed.Lineage[3]; e.ReputationCarryForward != 1 || e.PolicyHash != ComputeEvolutionPolicyHash(lenient) {
+		t.Errorf("entry = %+v, want carry-forward 1 under the lenient policy", e)
 	}
-	if retrieved.ID != doc.ID {
-		t.Errorf("retrieved ID = %s, want %s", retrieved.ID, doc.ID)
+	for _, v := range []*AgentIdentity{identity, expanded, rotated, relaxed} {
+		if result, _ := VerifyIdentity(v); !result.Valid {
+			t.Errorf("identity version %d should verify", v.Version)
+		}
+	}
+
+	// The policy is bound to the identity.
+	tampered := *relaxed
+	tampered.EvolutionPolicy = &strict
+	if result, _ := VerifyIdentity(&tampered); result.Valid {
+		t.Error("an identity with a swapped policy should fail verification")
+	}
+	bad := DefaultEvolutionPolicy()
+	bad.MinorUpdate = 1.5
+	if _, err := EvolveIdentity(identity, &EvolveIdentityOptions{OperatorKeyPair: kp, ChangeType: "merge", Description: "bad", EvolutionPolicy: &bad}); err == nil {
+		t.Error("EvolveIdentity() should reject rates above 1")
 	}
 }
 
-func TestMemoryStoreGetNotFound(t *testing.T) {
-	store := NewMemoryStore()
+func TestRotateOperatorKey(t *testing.T) {
+	oldKP, _ := GenerateKeyPair()
+	newKP, _ := GenerateKeyPair()
 
-	retrieved, err := store.Get("nonexistent")
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: oldKP,
+		Model:           ModelAttestation{Provider: "anthropic", ModelID: "claude-3"},
+		Capabilities:    []string{"read"},
+		Deployment:      DeploymentContext{Runtime: RuntimeContainer},
+	})
 	if err != nil {
-		t.Fatalf("Get() error: %v", err)
+		t.Fatalf("CreateIdentity() error: %v", err)
 	}
-	if retrieved != nil {
-		t.Error("Get() should return nil for nonexistent document")
+
+	rotated, err := RotateOperatorKey(identity, oldKP, newKP)
+	if err != nil {
+		t.Fatalf("RotateOperatorKey() error: %v", err)
+	}
+	if rotated.OperatorPublicKey != newKP.PublicKeyHex {
+		t.Error("rotated identity should use the new operator key")
+	}
+	entry := rotated.Lineage[len(rotated.Lineage)-1]
+	if entry.ChangeType != ChangeOperatorKeyRotation || entry.PreviousOperatorKey != oldKP.PublicKeyHex || entry.NewKeySignature == "" {
+		t.Errorf("unexpected rotation entry: %+v", entry)
+	}
+	if ComputeEffectiveCarryForward(rotated) != 1.0 {
+		t.Error("key rotation should carry reputation forward in full")
+	}
+	if result, _ := VerifyIdentity(rotated); !result.Valid {
+		t.Error("rotated identity should be valid")
 	}
-}
 
-func TestMemoryStoreHas(t *testing.T) {
-	store := NewMemoryStore()
-	doc, _ := buildTestCovenant(t)
+	// Further evolution under the new key keeps the rotation verifiable.
+	evolved, err := EvolveIdentity(rotated, &EvolveIdentityOptions{
+		OperatorKeyPair: newKP,
+		ChangeType:      "capability_change",
+		Description:     "Added write",
+		Capabilities:    []string{"read", "write"},
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	if result, _ := VerifyIdentity(evolved); !result.Valid {
+		t.Error("identity evolved after rotation should be valid")
+	}
 
-	if store.Has(doc.ID) {
-		t.Error("Has() should return false before Put()")
+	if _, err := RotateOperatorKey(rotated, oldKP, newKP); err == nil {
+		t.Error("rotation from a key that is no longer the operator key should fail")
+	}
+	if _, err := EvolveIdentity(identity, &EvolveIdentityOptions{
+		OperatorKeyPair:   oldKP,
+		ChangeType:        ChangeOperatorKeyRotation,
+		Description:       "rotate",
+		OperatorPublicKey: newKP.PublicKeyHex,
+	}); err == nil {
+		t.Error("EvolveIdentity should refuse operator_key_rotation")
 	}
 
-	store.Put(doc.ID, doc)
+	// A rotation entry missing the new key's signature is rejected, even
+	// with the identity re-signed.
+	forged := *rotated
+	forged.Lineage = append([]LineageEntry(nil), rotated.Lineage...)
+	forged.Lineage[len(forged.Lineage)-1].NewKeySignature = ""
+	payload, _ := identitySigningPayload(&forged)
+	sig, _ := Sign([]byte(payload), newKP.PrivateKey)
+	forged.Signature = ToHex(sig)
+	if result, _ := VerifyIdentity(&forged); result.Valid {
+		t.Error("rotation without the new key's signature should be invalid")
+	}
 
-	if !store.Has(doc.ID) {
-		t.Error("Has() should return true after Put()")
+	// So is a rotation that does not end at the current operator key.
+	otherKP, _ := GenerateKeyPair()
+	detached := *rotated
+	detached.OperatorPublicKey = otherKP.PublicKeyHex
+	payload, _ = identitySigningPayload(&detached)
+	sig, _ = Sign([]byte(payload), otherKP.PrivateKey)
+	detached.Signature = ToHex(sig)
+	if result, _ := VerifyIdentity(&detached); result.Valid {
+		t.Error("identity whose key does not follow its last rotation should be invalid")
 	}
 }
 
-func TestMemoryStoreDelete(t *testing.T) {
-	store := NewMemoryStore()
-	doc, _ := buildTestCovenant(t)
-	store.Put(doc.ID, doc)
+func TestIdentityRevocation(t *testing.T) {
+	b := newTestBundle(t)
+	past := time.Now().Add(-time.Hour)
 
-	err := store.Delete(doc.ID)
+	decommission, err := RevokeIdentity(b.identity, b.issuer, &RevokeIdentityOptions{Reason: RevocationDecommissioned})
 	if err != nil {
-		t.Fatalf("Delete() error: %v", err)
+		t.Fatalf("RevokeIdentity() error: %v", err)
 	}
-
-	if store.Has(doc.ID) {
-		t.Error("document should not exist after Delete()")
+	if err := VerifyIdentityRevocation(decommission); err != nil {
+		t.Fatalf("VerifyIdentityRevocation() error: %v", err)
 	}
-}
 
-func TestMemoryStoreDeleteNotFound(t *testing.T) {
-	store := NewMemoryStore()
-	err := store.Delete("nonexistent")
-	if err == nil {
-		t.Error("Delete() should fail for nonexistent document")
+	result, err := VerifyIdentityWithOptions(b.identity, &IdentityVerifyOptions{Revocations: []IdentityRevocation{*decommission}})
+	if err != nil {
+		t.Fatalf("VerifyIdentityWithOptions() error: %v", err)
+	}
+	if result.Valid || findCheckIn(result.Checks, "not_revoked").Passed {
+		t.Error("decommissioned identity should fail not_revoked")
+	}
+	result, _ = VerifyIdentityWithOptions(b.identity, &IdentityVerifyOptions{Revocations: []IdentityRevocation{*decommission}, Now: past})
+	if !result.Valid {
+		t.Error("identity should be valid before the revocation takes effect")
 	}
-}
 
-func TestMemoryStoreList(t *testing.T) {
-	store := NewMemoryStore()
+	// Decommissioning also covers later versions of the identity.
+	evolved, err := EvolveIdentity(b.identity, &EvolveIdentityOptions{
+		OperatorKeyPair: b.issuer,
+		ChangeType:      "model_update",
+		Description:     "model-2",
+		Model:           &ModelAttestation{Provider: "example", ModelID: "model-2"},
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	if result, _ := VerifyIdentityWithOptions(evolved, &IdentityVerifyOptions{Revocations: []IdentityRevocation{*decommission}}); result.Valid {
+		t.Error("evolution of a decommissioned identity should be revoked")
+	}
 
-	// Build two different covenants
-	doc1, _ := buildTestCovenant(t)
-	store.Put(doc1.ID, doc1)
+	// A revocation signed by an unrelated key has no effect.
+	otherKP, _ := GenerateKeyPair()
+	forged := *decommission
+	forged.OperatorPublicKey = otherKP.PublicKeyHex
+	payload, _ := signedPayload(&forged)
+	sig, _ := Sign(payload, otherKP.PrivateKey)
+	forged.Signature = ToHex(sig)
+	if result, _ := VerifyIdentityWithOptions(b.identity, &IdentityVerifyOptions{Revocations: []IdentityRevocation{forged}}); !result.Valid {
+		t.Error("revocation by an unrelated key should be ignored")
+	}
+	tampered := *decommission
+	tampered.EffectiveAt = "2000-01-01T00:00:00.000Z"
+	if err := VerifyIdentityRevocation(&tampered); err == nil {
+		t.Error("tampered revocation should not verify")
+	}
 
-	doc2, _ := buildTestCovenant(t) // different nonce -> different ID
-	store.Put(doc2.ID, doc2)
+	// A key compromise revokes the issuer key in covenant verification.
+	compromise, err := RevokeIdentity(b.identity, b.issuer, &RevokeIdentityOptions{Reason: RevocationKeyCompromise, EffectiveAt: past})
+	if err != nil {
+		t.Fatalf("RevokeIdentity() error: %v", err)
+	}
+	covResult, err := VerifyCovenantWithOptions(b.doc, &VerifyOptions{Revocations: []IdentityRevocation{*compromise}})
+	if err != nil {
+		t.Fatalf("VerifyCovenantWithOptions() error: %v", err)
+	}
+	if covResult.Valid || findCheck(covResult, "not_revoked") == nil {
+		t.Error("covenant from a compromised issuer key should fail not_revoked")
+	}
+	covResult, _ = VerifyCovenantWithOptions(b.doc, &VerifyOptions{Revocations: []IdentityRevocation{*decommission}})
+	if !covResult.Valid {
+		t.Error("decommissioning an identity should not revoke its operator key")
+	}
 
-	docs, err := store.List()
+	bundleResult, err := VerifyBundle(b.export(t), &BundleVerifyOptions{Covenant: &VerifyOptions{Revocations: []IdentityRevocation{*compromise}}})
 	if err != nil {
-		t.Fatalf("List() error: %v", err)
+		t.Fatalf("VerifyBundle() error: %v", err)
 	}
-	if len(docs) != 2 {
-		t.Errorf("List() returned %d documents, want 2", len(docs))
+	if bundleResult.Valid || findCheckIn(bundleResult.Checks, "issuer_identity").Passed {
+		t.Error("bundle with a revoked issuer identity should fail issuer_identity")
 	}
 }
 
-func TestMemoryStoreCount(t *testing.T) {
-	store := NewMemoryStore()
-	if store.Count() != 0 {
-		t.Error("empty store should have count 0")
+func TestOrganizationalIdentity(t *testing.T) {
+	var kps []*KeyPair
+	var keys []string
+	for i := 0; i < 3; i++ {
+		kp, _ := GenerateKeyPair()
+		kps = append(kps, kp)
+		keys = append(keys, kp.PublicKeyHex)
+	}
+	set := &OperatorSet{Keys: keys, Threshold: 2}
+	base := CreateIdentityOptions{
+		Operators:    set,
+		Model:        ModelAttestation{Provider: "example", ModelID: "model-1"},
+		Capabilities: []string{"read"},
+		Deployment:   DeploymentContext{Runtime: RuntimeProcess},
 	}
 
-	doc, _ := buildTestCovenant(t)
-	store.Put(doc.ID, doc)
+	single := base
+	single.OperatorKeyPairs = kps[:1]
+	if _, err := CreateIdentity(&single); err == nil {
+		t.Error("CreateIdentity() with 1 of 2 required signatures should fail")
+	}
+	opts := base
+	opts.OperatorKeyPairs = []*KeyPair{kps[0], kps[2]}
+	org, err := CreateIdentity(&opts)
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	if org.OperatorPublicKey != keys[0] || len(org.Signatures) != 2 || org.Signature != "" {
+		t.Errorf("unexpected organizational identity: %+v", org)
+	}
+	if result, _ := VerifyIdentity(org); !result.Valid {
+		t.Fatal("organizational identity should be valid")
+	}
 
-	if store.Count() != 1 {
-		t.Errorf("store count = %d, want 1", store.Count())
+	under := *org
+	under.Signatures = org.Signatures[:1]
+	if result, _ := VerifyIdentity(&under); result.Valid {
+		t.Error("identity signed below threshold should be invalid")
 	}
-}
 
-func TestMemoryStoreDefensiveCopy(t *testing.T) {
-	store := NewMemoryStore()
-	doc, _ := buildTestCovenant(t)
-	store.Put(doc.ID, doc)
+	evolved, err := EvolveIdentity(org, &EvolveIdentityOptions{
+		OperatorKeyPairs: kps[1:],
+		ChangeType:       "capability_change",
+		Description:      "Added write",
+		Capabilities:     []string{"read", "write"},
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	if result, _ := VerifyIdentity(evolved); !result.Valid {
+		t.Error("evolved organizational identity should be valid")
+	}
+	if _, err := EvolveIdentity(org, &EvolveIdentityOptions{
+		OperatorKeyPair: kps[0],
+		ChangeType:      "capability_change",
+		Description:     "Added write",
+		Capabilities:    []string{"read", "write"},
+	}); err == nil {
+		t.Error("EvolveIdentity() by a single operator should fail")
+	}
+
+	// Replacing the set takes a threshold of the old set and the new one.
+	newKP, _ := GenerateKeyPair()
+	newSet := &OperatorSet{Keys: []string{keys[1], newKP.PublicKeyHex}, Threshold: 2}
+	replaced, err := EvolveIdentity(evolved, &EvolveIdentityOptions{
+		OperatorKeyPairs: []*KeyPair{kps[0], kps[1], newKP},
+		ChangeType:       "operator_transfer",
+		Description:      "Replaced operator 3",
+		Operators:        newSet,
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	if result, _ := VerifyIdentity(replaced); !result.Valid || replaced.OperatorPublicKey != keys[1] {
+		t.Error("identity with a replaced operator set should be valid")
+	}
 
-	// Mutate the original
-	doc.Constraints = "mutated"
+	// Swapping in another set without the lineage to authorize it fails.
+	thief, _ := GenerateKeyPair()
+	forged := *evolved
+	forged.Operators = &OperatorSet{Keys: []string{thief.PublicKeyHex}, Threshold: 1}
+	forged.OperatorPublicKey = thief.PublicKeyHex
+	payload, _ := identitySigningPayload(&forged)
+	_, forged.Signatures, _ = signAsOperators([]byte(payload), thief, nil, forged.Operators)
+	if result, _ := VerifyIdentity(&forged); result.Valid {
+		t.Error("identity with an unauthorized operator set should be invalid")
+	}
 
-	// Retrieve should return original
-	retrieved, _ := store.Get(doc.ID)
-	if retrieved.Constraints == "mutated" {
-		t.Error("store should defensively copy on Put()")
+	// The registry follows the organization through the set change.
+	registry, _ := NewIdentityRegistry(NewMemoryIdentityStore())
+	for _, v := range []*AgentIdentity{org, evolved, replaced} {
+		if err := registry.Register(v); err != nil {
+			t.Fatalf("Register() error: %v", err)
+		}
 	}
+	if byKey, _ := registry.ResolveByOperator(keys[1]); len(byKey) != 1 || byKey[0].ID != replaced.ID {
+		t.Errorf("ResolveByOperator() = %v, want the replaced identity", byKey)
+	}
+}
 
-	// Mutate the retrieved copy
-	retrieved.Constraints = "also mutated"
+func TestDeriveSubIdentity(t *testing.T) {
+	parentKP, workerKP := makeTestKeyPairs(t)
+	parent, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: parentKP,
+		Model:           ModelAttestation{Provider: "example", ModelID: "orchestrator"},
+		Capabilities:    []string{"read", "write", "deploy"},
+		Deployment:      DeploymentContext{Runtime: RuntimeContainer},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+
+	child, err := DeriveSubIdentity(parent, &SubIdentityOptions{
+		ParentKeyPair:   parentKP,
+		OperatorKeyPair: workerKP,
+		Capabilities:    []string{"read"},
+	})
+	if err != nil {
+		t.Fatalf("DeriveSubIdentity() error: %v", err)
+	}
+	if child.OperatorPublicKey != workerKP.PublicKeyHex || child.Parent == nil || child.Lineage[0].ChangeType != ChangeDerived {
+		t.Fatalf("unexpected sub-identity: %+v", child)
+	}
+	if result, _ := VerifyIdentity(child); !result.Valid {
+		t.Fatal("sub-identity should be valid")
+	}
+	if err := VerifySubIdentity(child, parent); err != nil {
+		t.Fatalf("VerifySubIdentity() error: %v", err)
+	}
+
+	// The binding survives the parent's evolution and bounds the child's.
+	evolvedParent, err := EvolveIdentity(parent, &EvolveIdentityOptions{
+		OperatorKeyPair: parentKP,
+		ChangeType:      "model_update",
+		Description:     "orchestrator-2",
+		Model:           &ModelAttestation{Provider: "example", ModelID: "orchestrator-2"},
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	if err := VerifySubIdentity(child, evolvedParent); err != nil {
+		t.Errorf("VerifySubIdentity() against the evolved parent error: %v", err)
+	}
+	grown, err := EvolveIdentity(child, &EvolveIdentityOptions{
+		OperatorKeyPair: workerKP,
+		ChangeType:      "capability_change",
+		Description:     "Added write",
+		Capabilities:    []string{"read", "write"},
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() within the parent's capabilities error: %v", err)
+	}
+	if result, _ := VerifyIdentity(grown); !result.Valid {
+		t.Error("sub-identity evolved within the parent's capabilities should be valid")
+	}
+	if _, err := EvolveIdentity(child, &EvolveIdentityOptions{
+		OperatorKeyPair: workerKP,
+		ChangeType:      "capability_change",
+		Description:     "Added admin",
+		Capabilities:    []string{"read", "admin"},
+	}); err == nil {
+		t.Error("EvolveIdentity() beyond the parent's capabilities should fail")
+	}
+
+	if _, err := DeriveSubIdentity(parent, &SubIdentityOptions{
+		ParentKeyPair:   parentKP,
+		OperatorKeyPair: workerKP,
+		Capabilities:    []string{"read", "admin"},
+	}); err == nil || !strings.Contains(err.Error(), "admin") {
+		t.Errorf("DeriveSubIdentity() with excess capabilities error = %v", err)
+	}
+	if _, err := DeriveSubIdentity(parent, &SubIdentityOptions{
+		ParentKeyPair:   workerKP,
+		OperatorKeyPair: workerKP,
+		Capabilities:    []string{"read"},
+	}); err == nil {
+		t.Error("DeriveSubIdentity() signed by a non-operator key should fail")
+	}
+
+	// A child that widens its grant and re-signs itself is rejected.
+	forged := *child
+	binding := *child.Parent
+	binding.ParentCapabilities = []string{"admin", "deploy", "read", "write"}
+	binding.ParentManifestHash = ComputeCapabilityManifestHash(binding.ParentCapabilities)
+	forged.Parent = &binding
+	payload, _ := identitySigningPayload(&forged)
+	sig, _ := Sign([]byte(payload), workerKP.PrivateKey)
+	forged.Signature = ToHex(sig)
+	if result, _ := VerifyIdentity(&forged); result.Valid {
+		t.Error("sub-identity with a tampered binding should be invalid")
+	}
+
+	unrelated, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: parentKP,
+		Model:           ModelAttestation{Provider: "example", ModelID: "other"},
+		Capabilities:    []string{"read"},
+		Deployment:      DeploymentContext{Runtime: RuntimeContainer},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	if err := VerifySubIdentity(child, unrelated); err == nil {
+		t.Error("VerifySubIdentity() against an unrelated identity should fail")
+	}
+}
+
+func TestForkIdentity(t *testing.T) {
+	parentKP, _ := GenerateKeyPair()
+	forkKP, _ := GenerateKeyPair()
+	parent, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: parentKP,
+		Model:           ModelAttestation{Provider: "anthropic", ModelID: "claude-3"},
+		Capabilities:    []string{"read", "write"},
+		Deployment:      DeploymentContext{Runtime: RuntimeContainer},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+
+	fork, err := ForkIdentity(parent, &ForkIdentityOptions{
+		ParentKeyPair:   parentKP,
+		OperatorKeyPair: forkKP,
+		Reason:          "spin off research agent",
+		Capabilities:    []string{"read", "write", "research"},
+	})
+	if err != nil {
+		t.Fatalf("ForkIdentity() error: %v", err)
+	}
+	entry := fork.Lineage[0]
+	if len(fork.Lineage) != 1 || entry.ChangeType != ChangeFork || entry.Fork == nil {
+		t.Fatalf("fork lineage = %+v", fork.Lineage)
+	}
+	if entry.Fork.ParentLineageHash != parent.Lineage[0].IdentityHash || entry.Fork.Reason != "spin off research agent" {
+		t.Errorf("fork link = %+v", entry.Fork)
+	}
+	if entry.ReputationCarryForward != DefaultEvolutionPolicy().ModelFamilyChange {
+		t.Errorf("fork carry-forward = %v", entry.ReputationCarryForward)
+	}
+	if result, _ := VerifyIdentity(fork); !result.Valid {
+		t.Fatal("fork should verify")
+	}
+	if err := VerifyFork(fork, parent); err != nil {
+		t.Errorf("VerifyFork() error: %v", err)
+	}
+
+	// The link holds across later versions of both identities.
+	evolvedParent, err := EvolveIdentity(parent, &EvolveIdentityOptions{OperatorKeyPair: parentKP, ChangeType: "merge", Description: "tweak"})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	evolvedFork, err := EvolveIdentity(fork, &EvolveIdentityOptions{OperatorKeyPair: forkKP, ChangeType: "merge", Description: "tweak"})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	if err := VerifyFork(evolvedFork, evolvedParent); err != nil {
+		t.Errorf("VerifyFork() across versions error: %v", err)
+	}
+	other, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: parentKP,
+		Model:           ModelAttestation{Provider: "anthropic", ModelID: "claude-3"},
+		Capabilities:    []string{"read"},
+		Deployment:      DeploymentContext{Runtime: RuntimeContainer},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	if err := VerifyFork(fork, other); err == nil {
+		t.Error("VerifyFork() should reject an unrelated parent")
+	}
+
+	// Forks need the parent operator's signature, and are not evolutions.
+	if _, err := ForkIdentity(parent, &ForkIdentityOptions{ParentKeyPair: forkKP, OperatorKeyPair: forkKP, Reason: "takeover"}); err == nil {
+		t.Error("ForkIdentity() should require the parent's operator key")
+	}
+	if _, err := EvolveIdentity(parent, &EvolveIdentityOptions{OperatorKeyPair: parentKP, ChangeType: ChangeFork, Description: "fork"}); err == nil {
+		t.Error("EvolveIdentity() should refuse the fork change type")
+	}
+	tampered := *fork
+	tampered.Lineage = append([]LineageEntry(nil), fork.Lineage...)
+	link := *fork.Lineage[0].Fork
+	link.Reason = "something else"
+	tampered.Lineage[0].Fork = &link
+	if err := VerifyFork(&tampered, parent); err == nil {
+		t.Error("VerifyFork() should reject a tampered fork link")
+	}
+
+	// The registry resolves the fork tree.
+	registry, _ := NewIdentityRegistry(NewMemoryIdentityStore())
+	for _, v := range []*AgentIdentity{parent, evolvedParent, fork, evolvedFork} {
+		if err := registry.Register(v); err != nil {
+			t.Fatalf("Register() error: %v", err)
+		}
+	}
+	if got, err := registry.ForkParent(fork.ID); err != nil || got == nil || got.ID != evolvedParent.ID {
+		t.Errorf("ForkParent() = %v, %v; want the latest parent", got, err)
+	}
+	if forks, _ := registry.Forks(parent.ID); len(forks) != 1 || forks[0].ID != evolvedFork.ID {
+		t.Errorf("Forks() = %v, want the latest fork", forks)
+	}
+	if got, _ := registry.ForkParent(parent.ID); got != nil {
+		t.Error("ForkParent() of an unforked identity should be nil")
+	}
+}
+
+func TestModelAttestation(t *testing.T) {
+	providerKP, _ := GenerateKeyPair()
+	weights := SHA256Hex([]byte("model-1 weights"))
+	manifest, err := SignModelManifest(&ModelManifest{
+		Provider: "example",
+		Models: []ModelManifestEntry{
+			{ModelID: "model-1", ModelVersion: "2024-01", AttestationType: ModelAttestationWeights, AttestationHash: weights},
+		},
+	}, providerKP)
+	if err != nil {
+		t.Fatalf("SignModelManifest() error: %v", err)
+	}
+	if err := VerifyModelManifest(manifest); err != nil {
+		t.Fatalf("VerifyModelManifest() error: %v", err)
+	}
+	verifier, err := NewManifestModelVerifier(manifest, providerKP.PublicKeyHex)
+	if err != nil {
+		t.Fatalf("NewManifestModelVerifier() error: %v", err)
+	}
+	opts := &IdentityVerifyOptions{ModelVerifiers: []ModelAttestationVerifier{verifier}}
+
+	kp, _ := GenerateKeyPair()
+	verify := func(model ModelAttestation) *IdentityVerificationResult {
+		identity, err := CreateIdentity(&CreateIdentityOptions{
+			OperatorKeyPair: kp,
+			Model:           model,
+			Capabilities:    []string{"read"},
+			Deployment:      DeploymentContext{Runtime: RuntimeContainer},
+		})
+		if err != nil {
+			t.Fatalf("CreateIdentity() error: %v", err)
+		}
+		result, err := VerifyIdentityWithOptions(identity, opts)
+		if err != nil {
+			t.Fatalf("VerifyIdentityWithOptions() error: %v", err)
+		}
+		return result
+	}
+	attested := ModelAttestation{Provider: "example", ModelID: "model-1", ModelVersion: "2024-01", AttestationType: ModelAttestationWeights, AttestationHash: weights}
+	if result := verify(attested); !result.Valid || findCheckIn(result.Checks, "model_attestation") == nil {
+		t.Fatalf("published model should pass: %+v", result.Checks)
+	}
+
+	for name, model := range map[string]ModelAttestation{
+		"unattested":       {Provider: "example", ModelID: "model-1", ModelVersion: "2024-01"},
+		"wrong hash":       {Provider: "example", ModelID: "model-1", ModelVersion: "2024-01", AttestationType: ModelAttestationWeights, AttestationHash: SHA256Hex([]byte("other"))},
+		"wrong type":       {Provider: "example", ModelID: "model-1", ModelVersion: "2024-01", AttestationType: ModelAttestationModelCard, AttestationHash: weights},
+		"unpublished":      {Provider: "example", ModelID: "model-2", AttestationType: ModelAttestationWeights, AttestationHash: weights},
+		"unknown provider": {Provider: "other", ModelID: "model-1", ModelVersion: "2024-01", AttestationType: ModelAttestationWeights, AttestationHash: weights},
+	} {
+		if result := verify(model); result.Valid {
+			t.Errorf("%s model should fail", name)
+		}
+	}
+
+	// Manifests must be signed by the provider's trusted key.
+	otherKP, _ := GenerateKeyPair()
+	if _, err := NewManifestModelVerifier(manifest, otherKP.PublicKeyHex); err == nil {
+		t.Error("NewManifestModelVerifier() should refuse an untrusted key")
+	}
+	tampered := *manifest
+	tampered.Models = []ModelManifestEntry{{ModelID: "model-1", ModelVersion: "2024-01", AttestationType: ModelAttestationWeights, AttestationHash: SHA256Hex([]byte("other"))}}
+	if err := VerifyModelManifest(&tampered); err == nil {
+		t.Error("VerifyModelManifest() should reject a tampered manifest")
+	}
+}
+
+// nitroTestAttestation builds a Nitro attestation document signed by a
+// fresh CA, returning it base64-encoded with the CA's root pool.
+func nitroTestAttestation(t *testing.T, userData []byte, pcr0 []byte, at time.Time) (string, *x509.CertPool) {
+	t.Helper()
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test nitro root"},
+		NotBefore:             at.Add(-time.Hour),
+		NotAfter:              at.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error: %v", err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "i-test-enc"},
+		NotBefore:    at.Add(-time.Hour),
+		NotAfter:     at.Add(3 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, root, &leafKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error: %v", err)
+	}
+
+	payload, _ := cborEncode(map[string]interface{}{
+		"module_id":   "i-test-enc",
+		"digest":      "SHA384",
+		"timestamp":   uint64(at.UnixMilli()),
+		"pcrs":        map[int]interface{}{0: pcr0, 1: make([]byte, 48)},
+		"certificate": leafDER,
+		"cabundle":    []interface{}{rootDER},
+		"public_key":  nil,
+		"user_data":   userData,
+		"nonce":       nil,
+	})
+	protected, _ := cborEncode(map[int]interface{}{1: coseAlgES384})
+	sigStructure, _ := cborEncode([]interface{}{"Signature1", protected, []byte{}, payload})
+	digest := sha512.Sum384(sigStructure)
+	r, s, err := ecdsa.Sign(rand.Reader, leafKey, digest[:])
+	if err != nil {
+		t.Fatalf("ecdsa.Sign() error: %v", err)
+	}
+	sig := make([]byte, 96)
+	r.FillBytes(sig[:48])
+	s.FillBytes(sig[48:])
+	doc, _ := cborEncode([]interface{}{protected, map[int]interface{}{}, payload, sig})
+	// Real documents carry the COSE_Sign1 tag (18).
+	doc = append([]byte{0xd2}, doc...)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return base64.StdEncoding.EncodeToString(doc), roots
+}
+
+func TestTEEAttestation(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+	now := time.Now()
+	pcr0 := bytes.Repeat([]byte{0xab}, 48)
+	attestation, roots := nitroTestAttestation(t, kp.PublicKey, pcr0, now.Add(-time.Minute))
+
+	create := func(runtime RuntimeType, attestation string) *AgentIdentity {
+		identity, err := CreateIdentity(&CreateIdentityOptions{
+			OperatorKeyPair: kp,
+			Model:           ModelAttestation{Provider: "example", ModelID: "model-1"},
+			Capabilities:    []string{"read"},
+			Deployment:      DeploymentContext{Runtime: runtime, TEEAttestation: attestation, TEEAttestationType: TEETypeAWSNitro},
+		})
+		if err != nil {
+			t.Fatalf("CreateIdentity() error: %v", err)
+		}
+		return identity
+	}
+	nitro, err := NewNitroAttestationVerifier(&NitroVerifierOptions{
+		Roots:  roots,
+		PCRs:   map[int]string{0: ToHex(pcr0)},
+		MaxAge: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewNitroAttestationVerifier() error: %v", err)
+	}
+	opts := &IdentityVerifyOptions{AttestationVerifiers: []AttestationVerifier{nitro}}
+
+	identity := create(RuntimeTEE, attestation)
+	result, err := VerifyIdentityWithOptions(identity, opts)
+	if err != nil {
+		t.Fatalf("VerifyIdentityWithOptions() error: %v", err)
+	}
+	if check := findCheckIn(result.Checks, "tee_attestation"); !result.Valid || check == nil || !check.Passed {
+		t.Fatalf("tee_attestation check failed: %+v", result.Checks)
+	}
+	report, err := VerifyDeploymentAttestation(identity, opts.AttestationVerifiers, now)
+	if err != nil {
+		t.Fatalf("VerifyDeploymentAttestation() error: %v", err)
+	}
+	if report.ModuleID != "i-test-enc" || report.Measurements["PCR0"] != ToHex(pcr0) {
+		t.Errorf("report = %+v", report)
+	}
+
+	// A TEE runtime claim without an attestation fails; other runtimes
+	// make no claim to check.
+	result, _ = VerifyIdentityWithOptions(create(RuntimeTEE, ""), opts)
+	if result.Valid {
+		t.Error("a TEE identity without an attestation should fail")
+	}
+	result, _ = VerifyIdentityWithOptions(create(RuntimeContainer, ""), opts)
+	if !result.Valid {
+		t.Errorf("a container identity should pass: %+v", result.Checks)
+	}
+
+	// The attestation is bound to its operator key.
+	otherKP, _ := GenerateKeyPair()
+	lifted, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: otherKP,
+		Model:           ModelAttestation{Provider: "example", ModelID: "model-1"},
+		Capabilities:    []string{"read"},
+		Deployment:      DeploymentContext{Runtime: RuntimeTEE, TEEAttestation: attestation, TEEAttestationType: TEETypeAWSNitro},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	if _, err := VerifyDeploymentAttestation(lifted, opts.AttestationVerifiers, now); err == nil {
+		t.Error("an attestation lifted onto another operator key should fail")
+	}
+
+	// Untrusted roots, unexpected measurements, stale or tampered
+	// documents are all rejected.
+	otherAttestation, _ := nitroTestAttestation(t, kp.PublicKey, pcr0, now)
+	if _, err := VerifyDeploymentAttestation(create(RuntimeTEE, otherAttestation), opts.AttestationVerifiers, now); err == nil {
+		t.Error("an attestation from an untrusted root should fail")
+	}
+	wrongPCR, _ := NewNitroAttestationVerifier(&NitroVerifierOptions{Roots: roots, PCRs: map[int]string{0: ToHex(make([]byte, 48))}})
+	if _, err := VerifyDeploymentAttestation(identity, []AttestationVerifier{wrongPCR}, now); err == nil {
+		t.Error("an unexpected PCR0 should fail")
+	}
+	upperPCR, _ := NewNitroAttestationVerifier(&NitroVerifierOptions{Roots: roots, PCRs: map[int]string{0: strings.ToUpper(ToHex(pcr0))}})
+	if _, err := VerifyDeploymentAttestation(identity, []AttestationVerifier{upperPCR}, now); err != nil {
+		t.Errorf("an uppercase expected PCR0 should match: %v", err)
+	}
+	if _, err := VerifyDeploymentAttestation(identity, opts.AttestationVerifiers, now.Add(2*time.Hour)); err == nil {
+		t.Error("an attestation older than MaxAge should fail")
+	}
+	raw, _ := base64.StdEncoding.DecodeString(attestation)
+	raw[len(raw)-100] ^= 0x01
+	if _, err := nitro.Verify(raw, kp.PublicKey, now); err == nil {
+		t.Error("a tampered attestation should fail")
+	}
+	if _, err := NewNitroAttestationVerifier(&NitroVerifierOptions{}); err == nil {
+		t.Error("NewNitroAttestationVerifier() should require roots")
+	}
+}
+
+func TestMemoryIdentityStore(t *testing.T) {
+	store := NewMemoryIdentityStore()
+	kp1, _ := GenerateKeyPair()
+	kp2, _ := GenerateKeyPair()
+	create := func(kp *KeyPair, modelID string, caps ...string) *AgentIdentity {
+		identity, err := CreateIdentity(&CreateIdentityOptions{
+			OperatorKeyPair: kp,
+			Model:           ModelAttestation{Provider: "anthropic", ModelID: modelID},
+			Capabilities:    caps,
+			Deployment:      DeploymentContext{Runtime: RuntimeContainer},
+		})
+		if err != nil {
+			t.Fatalf("CreateIdentity() error: %v", err)
+		}
+		if err := store.Put(identity); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+		return identity
+	}
+	a := create(kp1, "claude-3", "read", "write")
+	b := create(kp1, "claude-4", "read")
+	c := create(kp2, "claude-3", "read", "write", "admin")
+
+	if store.Count() != 3 || !store.Has(a.ID) {
+		t.Fatalf("Count() = %d, Has() = %v", store.Count(), store.Has(a.ID))
+	}
+	ids := func(q *IdentityQuery) string {
+		matches, err := store.Query(q)
+		if err != nil {
+			t.Fatalf("Query() error: %v", err)
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.ID)
+		}
+		return strings.Join(got, ",")
+	}
+	join := func(identities ...*AgentIdentity) string {
+		matches, _ := store.Query(nil)
+		var got []string
+		for _, m := range matches {
+			for _, want := range identities {
+				if m.ID == want.ID {
+					got = append(got, m.ID)
+				}
+			}
+		}
+		return strings.Join(got, ",")
+	}
+	if got, want := ids(&IdentityQuery{OperatorKey: kp1.PublicKeyHex}), join(a, b); got != want {
+		t.Errorf("query by operator = %s, want %s", got, want)
+	}
+	if got, want := ids(&IdentityQuery{ModelProvider: "anthropic", ModelID: "claude-3"}), join(a, c); got != want {
+		t.Errorf("query by model = %s, want %s", got, want)
+	}
+	if got, want := ids(&IdentityQuery{Capabilities: []string{"write", "admin"}}), join(c); got != want {
+		t.Errorf("query by capabilities = %s, want %s", got, want)
+	}
+	if got := ids(&IdentityQuery{OperatorKey: kp2.PublicKeyHex, ModelID: "claude-4"}); got != "" {
+		t.Errorf("query with no matches = %s", got)
+	}
+
+	if err := store.Delete(b.ID); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if store.Has(b.ID) || store.Count() != 2 {
+		t.Error("deleted identity should be gone")
+	}
+	if err := store.Delete(b.ID); CodeOf(err) != ErrCodeNotFound {
+		t.Errorf("Delete() of a missing identity code = %q", CodeOf(err))
+	}
+}
+
+func TestIdentityRegistry(t *testing.T) {
+	oldKP, beneficiaryKP := makeTestKeyPairs(t)
+	newKP, _ := GenerateKeyPair()
+	v1, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: oldKP,
+		Model:           ModelAttestation{Provider: "example", ModelID: "model-1"},
+		Capabilities:    []string{"read"},
+		Deployment:      DeploymentContext{Runtime: RuntimeProcess},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	v2, err := EvolveIdentity(v1, &EvolveIdentityOptions{
+		OperatorKeyPair: oldKP,
+		ChangeType:      "capability_change",
+		Description:     "Added write",
+		Capabilities:    []string{"read", "write"},
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	v3, err := RotateOperatorKey(v2, oldKP, newKP)
+	if err != nil {
+		t.Fatalf("RotateOperatorKey() error: %v", err)
+	}
+
+	store := NewMemoryIdentityStore()
+	registry, err := NewIdentityRegistry(store)
+	if err != nil {
+		t.Fatalf("NewIdentityRegistry() error: %v", err)
+	}
+	for _, v := range []*AgentIdentity{v1, v2, v3, v3} {
+		if err := registry.Register(v); err != nil {
+			t.Fatalf("Register(v%d) error: %v", v.Version, err)
+		}
+	}
+
+	latest, err := registry.Resolve(v1.ID)
+	if err != nil || latest == nil || latest.ID != v3.ID {
+		t.Fatalf("Resolve(v1) = %v, %v; want v3", latest, err)
+	}
+	history, _ := registry.History(v2.ID)
+	if len(history) != 3 || history[0].ID != v1.ID || history[2].ID != v3.ID {
+		t.Errorf("History() returned %d versions, want v1..v3", len(history))
+	}
+	if byNew, _ := registry.ResolveByOperator(newKP.PublicKeyHex); len(byNew) != 1 || byNew[0].ID != v3.ID {
+		t.Errorf("ResolveByOperator(new key) = %v, want [v3]", byNew)
+	}
+	if byOld, _ := registry.ResolveByOperator(oldKP.PublicKeyHex); len(byOld) != 0 {
+		t.Errorf("ResolveByOperator(old key) returned %d identities, want 0", len(byOld))
+	}
+	if missing, _ := registry.Resolve("unknown"); missing != nil {
+		t.Error("Resolve() of an unknown ID should return nil")
+	}
+
+	// A fork of an earlier version is refused.
+	fork, err := EvolveIdentity(v1, &EvolveIdentityOptions{
+		OperatorKeyPair: oldKP,
+		ChangeType:      "model_update",
+		Description:     "model-2",
+		Model:           &ModelAttestation{Provider: "example", ModelID: "model-2"},
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	if err := registry.Register(fork); err == nil {
+		t.Error("Register() should refuse a fork")
+	}
+	// So is a takeover that changes the operator key without a rotation.
+	thiefKP, _ := GenerateKeyPair()
+	takeover, err := EvolveIdentity(v3, &EvolveIdentityOptions{
+		OperatorKeyPair:   thiefKP,
+		ChangeType:        "operator_transfer",
+		Description:       "mine now",
+		OperatorPublicKey: thiefKP.PublicKeyHex,
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	if err := registry.Register(takeover); err == nil {
+		t.Error("Register() should refuse an operator change without rotation")
+	}
+
+	// A registry reopened over the same store sees the same history.
+	reopened, err := NewIdentityRegistry(store)
+	if err != nil {
+		t.Fatalf("NewIdentityRegistry() error: %v", err)
+	}
+	if latest, _ := reopened.Resolve(v2.ID); latest == nil || latest.ID != v3.ID {
+		t.Error("reopened registry should resolve to v3")
+	}
+
+	// Covenant verification resolves the issuer's Party.ID.
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: v1.ID, PublicKey: newKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'",
+		PrivateKey:  newKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+	result, err := VerifyCovenantWithOptions(doc, &VerifyOptions{IdentityRegistry: registry})
+	if err != nil {
+		t.Fatalf("VerifyCovenantWithOptions() error: %v", err)
+	}
+	if !result.Valid || findCheck(result, "issuer_identity") == nil {
+		t.Errorf("covenant from a registered issuer should pass issuer_identity: %+v", result.Checks)
+	}
+	result, _ = VerifyCovenantWithOptions(doc, &VerifyOptions{IdentityRegistry: registry, Revocations: []IdentityRevocation{*mustRevoke(t, v3, newKP)}})
+	if check := findCheck(result, "issuer_identity"); check == nil || check.Passed {
+		t.Errorf("issuer_identity = %+v, want failing for a revoked identity", check)
+	}
+	empty, _ := NewIdentityRegistry(NewMemoryIdentityStore())
+	result, _ = VerifyCovenantWithOptions(doc, &VerifyOptions{IdentityRegistry: empty})
+	if check := findCheck(result, "issuer_identity"); check == nil || check.Passed {
+		t.Errorf("issuer_identity = %+v, want failing for an unregistered issuer", check)
+	}
+}
+
+func mustRevoke(t *testing.T, identity *AgentIdentity, kp *KeyPair) *IdentityRevocation {
+	t.Helper()
+	r, err := RevokeIdentity(identity, kp, &RevokeIdentityOptions{Reason: RevocationDecommissioned})
+	if err != nil {
+		t.Fatalf("RevokeIdentity() error: %v", err)
+	}
+	return r
+}
+
+func TestComputeEffectiveCarryForward(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: kp,
+		Model: ModelAttestation{
+			Provider: "anthropic",
+			ModelID:  "claude-3",
+		},
+		Capabilities: []string{"read"},
+		Deployment:   DeploymentContext{Runtime: RuntimeContainer},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+
+	// Initially 1.0
+	rate := ComputeEffectiveCarryForward(identity)
+	if rate != 1.0 {
+		t.Errorf("initial carry-forward = %f, want 1.0", rate)
+	}
+
+	// After model update (0.8)
+	evolved, err := EvolveIdentity(identity, &EvolveIdentityOptions{
+		OperatorKeyPair: kp,
+		ChangeType:      "model_update",
+		Description:     "model update",
+		Model: &ModelAttestation{
+			Provider: "anthropic",
+			ModelID:  "claude-3.5",
+		},
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+
+	rate = ComputeEffectiveCarryForward(evolved)
+	expected := 1.0 * DefaultEvolutionPolicy().ModelVersionChange
+	if rate != expected {
+		t.Errorf("carry-forward after model update = %f, want %f", rate, expected)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Store tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestMemoryStorePutGet(t *testing.T) {
+	store := NewMemoryStore()
+	doc, _ := buildTestCovenant(t)
+
+	err := store.Put(doc.ID, doc)
+	if err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+
+	retrieved, err := store.Get(doc.ID)
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if retrieved == nil {
+		t.Fatal("Get() returned nil for stored document")
+	}
+	if retrieved.ID != doc.ID {
+		t.Errorf("retrieved ID = %s, want %s", retrieved.ID, doc.ID)
+	}
+}
+
+func TestMemoryStoreGetNotFound(t *testing.T) {
+	store := NewMemoryStore()
+
+	retrieved, err := store.Get("nonexistent")
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if retrieved != nil {
+		t.Error("Get() should return nil for nonexistent document")
+	}
+}
+
+func TestMemoryStoreHas(t *testing.T) {
+	store := NewMemoryStore()
+	doc, _ := buildTestCovenant(t)
+
+	if store.Has(doc.ID) {
+		t.Error("Has() should return false before Put()")
+	}
+
+	store.Put(doc.ID, doc)
+
+	if !store.Has(doc.ID) {
+		t.Error("Has() should return true after Put()")
+	}
+}
+
+func TestMemoryStoreDelete(t *testing.T) {
+	store := NewMemoryStore()
+	doc, _ := buildTestCovenant(t)
+	store.Put(doc.ID, doc)
+
+	err := store.Delete(doc.ID)
+	if err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+
+	if store.Has(doc.ID) {
+		t.Error("document should not exist after Delete()")
+	}
+}
+
+func TestMemoryStoreDeleteNotFound(t *testing.T) {
+	store := NewMemoryStore()
+	err := store.Delete("nonexistent")
+	if err == nil {
+		t.Error("Delete() should fail for nonexistent document")
+	}
+}
+
+func TestMemoryStoreList(t *testing.T) {
+	store := NewMemoryStore()
+
+	// Build two different covenants
+	doc1, _ := buildTestCovenant(t)
+	store.Put(doc1.ID, doc1)
+
+	doc2, _ := buildTestCovenant(t) // different nonce -> different ID
+	store.Put(doc2.ID, doc2)
+
+	docs, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Errorf("List() returned %d documents, want 2", len(docs))
+	}
+}
+
+func TestMemoryStoreCount(t *testing.T) {
+	store := NewMemoryStore()
+	if store.Count() != 0 {
+		t.Error("empty store should have count 0")
+	}
+
+	doc, _ := buildTestCovenant(t)
+	store.Put(doc.ID, doc)
+
+	if store.Count() != 1 {
+		t.Errorf("store count = %d, want 1", store.Count())
+	}
+}
+
+func TestMemoryStoreDefensiveCopy(t *testing.T) {
+	store := NewMemoryStore()
+	doc, _ := buildTestCovenant(t)
+	store.Put(doc.ID, doc)
+
+	// Mutate the original
+	doc.Constraints = "mutated"
+
+	// Retrieve should return original
+	retrieved, _ := store.Get(doc.ID)
+	if retrieved.Constraints == "mutated" {
+		t.Error("store should defensively copy on Put()")
+	}
+
+	// Mutate the retrieved copy
+	retrieved.Constraints = "also mutated"
+
+	// Re-retrieve should be unaffected
+	retrieved2, _ := store.Get(doc.ID)
+	if retrieved2.Constraints == "also mutated" {
+		t.Error("store should defensively copy on Get()")
+	}
+}
+
+func TestMemoryStoreClear(t *testing.T) {
+	store := NewMemoryStore()
+	doc, _ := buildTestCovenant(t)
+	store.Put(doc.ID, doc)
+
+	store.Clear()
+
+	if store.Count() != 0 {
+		t.Error("store should be empty after Clear()")
+	}
+}
+
+func TestMemoryStoreValidation(t *testing.T) {
+	store := NewMemoryStore()
+
+	err := store.Put("", &CovenantDocument{})
+	if err == nil {
+		t.Error("Put() with empty ID should fail")
+	}
+
+	err = store.Put("id", nil)
+	if err == nil {
+		t.Error("Put() with nil document should fail")
+	}
+
+	_, err = store.Get("")
+	if err == nil {
+		t.Error("Get() with empty ID should fail")
+	}
+
+	err = store.Delete("")
+	if err == nil {
+		t.Error("Delete() with empty ID should fail")
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Integration tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestFullWorkflow(t *testing.T) {
+	// 1. Generate key pairs
+	issuerKP, _ := GenerateKeyPair()
+	beneficiaryKP, _ := GenerateKeyPair()
+	auditorKP, _ := GenerateKeyPair()
+
+	// 2. Build a covenant
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer: Party{
+			ID:        "alice",
+			PublicKey: issuerKP.PublicKeyHex,
+			Role:      "issuer",
+		},
+		Beneficiary: Party{
+			ID:        "bob",
+			PublicKey: beneficiaryKP.PublicKeyHex,
+			Role:      "beneficiary",
+		},
+		Constraints: "permit read on '/data/**'\ndeny read on '/data/secret'",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+
+	// 3. Verify the covenant
+	result, _ := VerifyCovenant(doc)
+	if !result.Valid {
+		t.Fatal("freshly built covenant should be valid")
+	}
+
+	// 4. Add a countersignature
+	signed, err := CountersignCovenant(doc, auditorKP, "auditor")
+	if err != nil {
+		t.Fatalf("CountersignCovenant() error: %v", err)
+	}
+
+	// 5. Verify with countersignature
+	result2, _ := VerifyCovenant(signed)
+	if !result2.Valid {
+		t.Fatal("countersigned covenant should be valid")
+	}
+
+	// 6. Store the covenant
+	store := NewMemoryStore()
+	if err := store.Put(signed.ID, signed); err != nil {
+		t.Fatalf("store.Put() error: %v", err)
+	}
+
+	// 7. Retrieve and verify from store
+	retrieved, _ := store.Get(signed.ID)
+	result3, _ := VerifyCovenant(retrieved)
+	if !result3.Valid {
+		t.Fatal("retrieved covenant should be valid")
+	}
+
+	// 8. Evaluate CCL
+	ccl, _ := Parse(doc.Constraints)
+	evalResult := Evaluate(ccl, "read", "/data/users", nil)
+	if !evalResult.Permitted {
+		t.Error("read on /data/users should be permitted")
+	}
+
+	evalResult2 := Evaluate(ccl, "read", "/data/secret", nil)
+	if evalResult2.Permitted {
+		t.Error("read on /data/secret should be denied")
+	}
+
+	// 9. Serialize and deserialize
+	serialized, _ := SerializeCovenant(signed)
+	restored, _ := DeserializeCovenant(serialized)
+	result4, _ := VerifyCovenant(restored)
+	if !result4.Valid {
+		t.Fatal("deserialized covenant should be valid")
+	}
+}
+
+func TestCovenantChainWorkflow(t *testing.T) {
+	issuerKP, _ := GenerateKeyPair()
+	beneficiaryKP, _ := GenerateKeyPair()
+
+	// Build parent covenant
+	parent, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer: Party{
+			ID:        "alice",
+			PublicKey: issuerKP.PublicKeyHex,
+			Role:      "issuer",
+		},
+		Beneficiary: Party{
+			ID:        "bob",
+			PublicKey: beneficiaryKP.PublicKeyHex,
+			Role:      "beneficiary",
+		},
+		Constraints: "permit read on '/data/**'\npermit write on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant(parent) error: %v", err)
+	}
+
+	// Build child covenant (narrows parent)
+	child, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer: Party{
+			ID:        "alice",
+			PublicKey: issuerKP.PublicKeyHex,
+			Role:      "issuer",
+		},
+		Beneficiary: Party{
+			ID:        "bob",
+			PublicKey: beneficiaryKP.PublicKeyHex,
+			Role:      "beneficiary",
+		},
+		Constraints: "permit read on '/data/public'",
+		PrivateKey:  issuerKP.PrivateKey,
+		Chain: &ChainReference{
+			ParentID: parent.ID,
+			Relation: "restricts",
+			Depth:    1,
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant(child) error: %v", err)
+	}
+
+	// Validate narrowing
+	result, err := ValidateChainNarrowing(child, parent, nil)
+	if err != nil {
+		t.Fatalf("ValidateChainNarrowing() error: %v", err)
+	}
+	if !result.Valid {
+		t.Error("expected valid narrowing for restrictive child")
+	}
+
+	// Verify both
+	parentResult, _ := VerifyCovenant(parent)
+	if !parentResult.Valid {
+		t.Error("parent should be valid")
+	}
+	childResult, _ := VerifyCovenant(child)
+	if !childResult.Valid {
+		t.Error("child should be valid")
+	}
+}
+
+func TestIdentityCovenantWorkflow(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+
+	// Create identity
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: kp,
+		Model: ModelAttestation{
+			Provider: "anthropic",
+			ModelID:  "claude-3",
+		},
+		Capabilities: []string{"read", "write"},
+		Deployment:   DeploymentContext{Runtime: RuntimeContainer},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+
+	// Use the identity's key to build a covenant
+	beneficiaryKP, _ := GenerateKeyPair()
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer: Party{
+			ID:        identity.ID,
+			PublicKey: identity.OperatorPublicKey,
+			Role:      "issuer",
+		},
+		Beneficiary: Party{
+			ID:        "beneficiary",
+			PublicKey: beneficiaryKP.PublicKeyHex,
+			Role:      "beneficiary",
+		},
+		Constraints: "permit read on '/data/**'",
+		PrivateKey:  kp.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+
+	result, _ := VerifyCovenant(doc)
+	if !result.Valid {
+		t.Error("covenant signed by identity key should be valid")
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Error code tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestBuildCovenantErrorCodes(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+	base := func() CovenantBuilderOptions {
+		return CovenantBuilderOptions{
+			Issuer:      Party{ID: "alice", PublicKey: kp.PublicKeyHex, Role: "issuer"},
+			Beneficiary: Party{ID: "bob", PublicKey: kp.PublicKeyHex, Role: "beneficiary"},
+			Constraints: "permit read on '/data'",
+			PrivateKey:  kp.PrivateKey,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(o *CovenantBuilderOptions)
+		want   ErrorCode
+	}{
+		{"missing issuer id", func(o *CovenantBuilderOptions) { o.Issuer.ID = "" }, ErrCodeMissingField},
+		{"wrong role", func(o *CovenantBuilderOptions) { o.Beneficiary.Role = "x" }, ErrCodeInvalidRole},
+		{"bad key", func(o *CovenantBuilderOptions) { o.PrivateKey = nil }, ErrCodeInvalidPrivateKey},
+		{"bad ccl", func(o *CovenantBuilderOptions) { o.Constraints = "allow everything" }, ErrCodeCCLParse},
+		{"chain depth", func(o *CovenantBuilderOptions) {
+			o.Chain = &ChainReference{ParentID: "p", Relation: "delegates", Depth: MaxChainDepth + 1}
+		}, ErrCodeChainDepthExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := base()
+			tt.mutate(&opts)
+			_, err := BuildCovenant(&opts)
+			if err == nil {
+				t.Fatal("BuildCovenant should fail")
+			}
+			if got := CodeOf(err); got != tt.want {
+				t.Errorf("CodeOf(err) = %q, want %q", got, tt.want)
+			}
+			if !errors.Is(err, &Error{Code: tt.want}) {
+				t.Errorf("errors.Is should match code %q", tt.want)
+			}
+		})
+	}
+}
+
+func TestDeserializeErrorCodes(t *testing.T) {
+	if got := CodeOf(deserializeErr("not json")); got != ErrCodeInvalidJSON {
+		t.Errorf("invalid JSON code = %q, want %q", got, ErrCodeInvalidJSON)
+	}
+	if got := CodeOf(deserializeErr(`{"id":"x","version":"9.0"}`)); got != ErrCodeUnsupportedVersion {
+		t.Errorf("wrong version code = %q, want %q", got, ErrCodeUnsupportedVersion)
+	}
+}
+
+func deserializeErr(jsonStr string) error {
+	_, err := DeserializeCovenant(jsonStr)
+	return err
+}
+
+func TestErrorCodePreservesMessageAndCause(t *testing.T) {
+	_, err := FromHex("zz")
+	if err == nil {
+		t.Fatal("FromHex should fail")
+	}
+	if CodeOf(err) != ErrCodeInvalidHex {
+		t.Errorf("CodeOf = %q, want %q", CodeOf(err), ErrCodeInvalidHex)
+	}
+	if !strings.HasPrefix(err.Error(), "grith: invalid hex string") {
+		t.Errorf("message changed: %s", err.Error())
+	}
+	if errors.Unwrap(errors.Unwrap(err)) == nil {
+		t.Error("underlying hex error should be reachable via Unwrap")
+	}
+	if CodeOf(errors.New("plain")) != "" {
+		t.Error("plain errors should have no code")
+	}
+}
+
+func TestVerificationCheckCodes(t *testing.T) {
+	doc, _ := buildTestCovenant(t)
+	result, _ := VerifyCovenant(doc)
+
+	want := []CheckCode{
+		CheckIDMatch, CheckSignatureValid, CheckNotExpired, CheckActive,
+		CheckCCLParses, CheckEnforcementValid, CheckProofValid,
+		CheckChainDepth, CheckDocumentSize, CheckCountersignatures, CheckNoncePresent,
+	}
+	for i, code := range want {
+		if result.Checks[i].Code != code {
+			t.Errorf("check[%d] code = %q, want %q", i, result.Checks[i].Code, code)
+		}
+	}
+
+	b, _ := json.Marshal(result.Checks[0])
+	if !strings.Contains(string(b), `"code":"CHECK_ID_MATCH"`) {
+		t.Errorf("serialized check missing code: %s", b)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Expiry monitor tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func buildTimedCovenant(t *testing.T, activatesAt, expiresAt string) *CovenantDocument {
+	t.Helper()
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+		ActivatesAt: activatesAt,
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+	return doc
+}
+
+func TestExpiryMonitorEvents(t *testing.T) {
+	base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	store := NewMemoryStore()
+	doc := buildTimedCovenant(t,
+		base.Add(time.Hour).Format(time.RFC3339),
+		base.Add(48*time.Hour).Format(time.RFC3339))
+	store.Put(doc.ID, doc)
+
+	var got []ExpiryEventType
+	m, err := NewExpiryMonitor(&ExpiryMonitorOptions{
+		Store:   store,
+		Warning: 24 * time.Hour,
+		OnEvent: func(ev ExpiryEvent) { got = append(got, ev.Type) },
+		Now:     func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("NewExpiryMonitor() error: %v", err)
+	}
+
+	steps := []struct {
+		at   time.Duration
+		want []ExpiryEventType
+	}{
+		{0, nil},
+		{2 * time.Hour, []ExpiryEventType{ExpiryEventActivated}},
+		{3 * time.Hour, nil},
+		{30 * time.Hour, []ExpiryEventType{ExpiryEventApproaching}},
+		{49 * time.Hour, []ExpiryEventType{ExpiryEventExpired}},
+		{50 * time.Hour, nil},
+	}
+	for _, step := range steps {
+		now = base.Add(step.at)
+		got = nil
+		events, err := m.Check()
+		if err != nil {
+			t.Fatalf("Check() error: %v", err)
+		}
+		if len(events) != len(step.want) || len(got) != len(step.want) {
+			t.Fatalf("at +%v: events = %v, want %v", step.at, got, step.want)
+		}
+		for i := range step.want {
+			if events[i].Type != step.want[i] || events[i].DocumentID != doc.ID {
+				t.Errorf("at +%v: event[%d] = %+v, want %s", step.at, i, events[i], step.want[i])
+			}
+		}
+	}
+}
+
+func TestExpiryMonitorChannel(t *testing.T) {
+	store := NewMemoryStore()
+	doc := buildTimedCovenant(t, "", time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+	store.Put(doc.ID, doc)
+
+	events := make(chan ExpiryEvent, 1)
+	m, _ := NewExpiryMonitor(&ExpiryMonitorOptions{
+		Store:    store,
+		Interval: 10 * time.Millisecond,
+		Events:   events,
+	})
+	m.Start()
+	defer m.Stop()
+
+	select {
+	case ev := <-events:
+		if ev.Type != ExpiryEventExpired {
+			t.Errorf("event type = %s, want %s", ev.Type, ExpiryEventExpired)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for expiry event")
+	}
+}
+
+func TestExpiryMonitorRequiresStore(t *testing.T) {
+	if _, err := NewExpiryMonitor(&ExpiryMonitorOptions{}); err == nil {
+		t.Error("NewExpiryMonitor should fail without a store")
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Grace period tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func buildGraceCovenant(t *testing.T, expiresAt time.Time, grace time.Duration) *CovenantDocument {
+	t.Helper()
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+		ExpiresAt:   expiresAt.UTC().Format(time.RFC3339Nano),
+		GracePeriod: grace,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+	return doc
+}
+
+func findCheck(result *VerificationResult, name string) *VerificationCheck {
+	for i := range result.Checks {
+		if result.Checks[i].Name == name {
+			return &result.Checks[i]
+		}
+	}
+	return nil
+}
+
+func TestGracePeriodWarning(t *testing.T) {
+	doc := buildGraceCovenant(t, time.Now().Add(-time.Minute), time.Hour)
+	if doc.GracePeriod != time.Hour.Milliseconds() {
+		t.Errorf("GracePeriod = %d, want %d", doc.GracePeriod, time.Hour.Milliseconds())
+	}
+
+	result, _ := VerifyCovenant(doc)
+	if !result.Valid {
+		t.Fatal("document within grace period should be valid")
+	}
+	check := findCheck(result, "not_expired")
+	if !check.Passed || check.Severity != SeverityWarning {
+		t.Errorf("not_expired = %+v, want passed with warning", check)
+	}
+}
+
+func TestGracePeriodLapsed(t *testing.T) {
+	doc := buildGraceCovenant(t, time.Now().Add(-2*time.Hour), time.Hour)
+	result, _ := VerifyCovenant(doc)
+	if result.Valid {
+		t.Error("document past its grace period should be invalid")
+	}
+	if check := findCheck(result, "not_expired"); check.Passed || check.Severity != "" {
+		t.Errorf("not_expired = %+v, want hard failure", check)
+	}
+}
+
+func TestGracePeriodNotInUseBeforeExpiry(t *testing.T) {
+	doc := buildGraceCovenant(t, time.Now().Add(time.Hour), time.Hour)
+	result, _ := VerifyCovenant(doc)
+	if check := findCheck(result, "not_expired"); !check.Passed || check.Severity != "" {
+		t.Errorf("not_expired = %+v, want plain pass", check)
+	}
+}
+
+func TestGracePeriodValidation(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+	opts := CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: kp.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "bob", PublicKey: kp.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data'",
+		PrivateKey:  kp.PrivateKey,
+		GracePeriod: time.Hour,
+	}
+	if _, err := BuildCovenant(&opts); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("grace period without expiry: err = %v, want %s", err, ErrCodeInvalidInput)
+	}
+	opts.ExpiresAt = "2030-01-01T00:00:00.000Z"
+	opts.GracePeriod = -time.Second
+	if _, err := BuildCovenant(&opts); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("negative grace period: err = %v, want %s", err, ErrCodeInvalidInput)
+	}
+}
+
+func TestExpiryMonitorRespectsGracePeriod(t *testing.T) {
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := expires.Add(30 * time.Minute)
+	store := NewMemoryStore()
+	doc := buildGraceCovenant(t, expires, time.Hour)
+	store.Put(doc.ID, doc)
+
+	m, _ := NewExpiryMonitor(&ExpiryMonitorOptions{Store: store, Now: func() time.Time { return now }})
+	events, _ := m.Check()
+	if len(events) != 1 || events[0].Type != ExpiryEventApproaching {
+		t.Fatalf("events within grace = %+v, want one approaching_expiry", events)
+	}
+
+	now = expires.Add(2 * time.Hour)
+	events, _ = m.Check()
+	if len(events) != 1 || events[0].Type != ExpiryEventExpired || !events[0].At.Equal(expires.Add(time.Hour)) {
+		t.Fatalf("events after grace = %+v, want expired at end of grace", events)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Constraints-by-reference tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func buildRefCovenant(t *testing.T, resolver ConstraintResolver, ref ConstraintsRef) *CovenantDocument {
+	t.Helper()
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:             Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary:        Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		ConstraintsRef:     &ref,
+		ConstraintResolver: resolver,
+		PrivateKey:         issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+	return doc
+}
+
+func TestConstraintsByReference(t *testing.T) {
+	resolver := NewMemoryConstraintResolver()
+	ref := resolver.Add("permit read on '/data/**'\ndeny read on '/data/secret'", "https://policies.example/shared.ccl")
+	doc := buildRefCovenant(t, resolver, ref)
+
+	if doc.Constraints != "" {
+		t.Errorf("Constraints should not be inlined, got %q", doc.Constraints)
+	}
+	if doc.ConstraintsRef == nil || doc.ConstraintsRef.Hash != ref.Hash {
+		t.Fatalf("ConstraintsRef = %+v, want %+v", doc.ConstraintsRef, ref)
+	}
+
+	result, _ := VerifyCovenantWithOptions(doc, &VerifyOptions{ConstraintResolver: resolver})
+	if !result.Valid {
+		t.Errorf("covenant with resolvable reference should be valid: %+v", findCheck(result, "ccl_parses"))
+	}
+
+	ccl, err := ParseCovenantConstraints(doc, resolver)
+	if err != nil {
+		t.Fatalf("ParseCovenantConstraints() error: %v", err)
+	}
+	if Evaluate(ccl, "read", "/data/secret", nil).Permitted {
+		t.Error("referenced deny rule should apply")
+	}
+
+	// Round-trip through JSON keeps the reference
+	s, _ := SerializeCovenant(doc)
+	restored, err := DeserializeCovenant(s)
+	if err != nil {
+		t.Fatalf("DeserializeCovenant() error: %v", err)
+	}
+	if restored.ConstraintsRef == nil || restored.ConstraintsRef.URI != ref.URI {
+		t.Errorf("restored ConstraintsRef = %+v", restored.ConstraintsRef)
+	}
+}
+
+func TestConstraintsByReferenceWithoutResolver(t *testing.T) {
+	resolver := NewMemoryConstraintResolver()
+	doc := buildRefCovenant(t, resolver, resolver.Add("permit read on '/data'", ""))
+
+	result, _ := VerifyCovenant(doc)
+	if result.Valid {
+		t.Error("verification without a resolver should fail")
+	}
+	if check := findCheck(result, "ccl_parses"); check.Passed {
+		t.Error("ccl_parses should fail without a resolver")
+	}
+}
+
+func TestValidateChainNarrowingByReference(t *testing.T) {
+	resolver := NewMemoryConstraintResolver()
+	parent := buildRefCovenant(t, resolver, resolver.Add("permit read on '/data/**'", ""))
+	narrow := buildRefCovenant(t, resolver, resolver.Add("permit read on '/data/public'", ""))
+	broad := buildRefCovenant(t, resolver, resolver.Add("permit write on '/data/**'", ""))
+
+	if result, err := ValidateChainNarrowing(narrow, parent, resolver); err != nil || !result.Valid {
+		t.Errorf("narrowing child by reference = %+v, %v", result, err)
+	}
+	if result, err := ValidateChainNarrowing(broad, parent, resolver); err != nil || result.Valid {
+		t.Errorf("broadening child by reference = %+v, %v", result, err)
+	}
+	if _, err := ValidateChainNarrowing(narrow, parent, nil); CodeOf(err) != ErrCodeConstraintUnavailable {
+		t.Errorf("without a resolver code = %q, want %q", CodeOf(err), ErrCodeConstraintUnavailable)
+	}
+}
+
+func TestConstraintsByReferenceHashMismatch(t *testing.T) {
+	ref := NewConstraintsRef("permit read on '/data'", "")
+	tampered := ConstraintResolverFunc(func(ConstraintsRef) (string, error) {
+		return "permit ** on '**'", nil
+	})
+
+	issuerKP, _ := makeTestKeyPairs(t)
+	_, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:             Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary:        Party{ID: "bob", PublicKey: issuerKP.PublicKeyHex, Role: "beneficiary"},
+		ConstraintsRef:     &ref,
+		ConstraintResolver: tampered,
+		PrivateKey:         issuerKP.PrivateKey,
+	})
+	if CodeOf(err) != ErrCodeConstraintHashMismatch {
+		t.Errorf("err = %v, want %s", err, ErrCodeConstraintHashMismatch)
+	}
+}
+
+func TestConstraintsByReferenceExclusive(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+	ref := NewConstraintsRef("permit read on '/data'", "")
+	_, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:         Party{ID: "alice", PublicKey: kp.PublicKeyHex, Role: "issuer"},
+		Beneficiary:    Party{ID: "bob", PublicKey: kp.PublicKeyHex, Role: "beneficiary"},
+		Constraints:    "permit read on '/data'",
+		ConstraintsRef: &ref,
+		PrivateKey:     kp.PrivateKey,
+	})
+	if CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("err = %v, want %s", err, ErrCodeInvalidInput)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Nonce registry tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestMemoryNonceRegistry(t *testing.T) {
+	r := NewMemoryNonceRegistry()
+	if _, replayed, err := r.Record("issuer", "n1", "doc-a"); err != nil || replayed {
+		t.Fatalf("first Record: replayed=%v err=%v", replayed, err)
+	}
+	if _, replayed, _ := r.Record("issuer", "n1", "doc-a"); replayed {
+		t.Error("re-recording the same document should not be a replay")
+	}
+	first, replayed, _ := r.Record("issuer", "n1", "doc-b")
+	if !replayed || first != "doc-a" {
+		t.Errorf("Record(doc-b) = (%s, %v), want (doc-a, true)", first, replayed)
+	}
+	if _, replayed, _ := r.Record("other-issuer", "n1", "doc-c"); replayed {
+		t.Error("nonces are scoped per issuer")
+	}
+	if r.Count() != 2 {
+		t.Errorf("Count() = %d, want 2", r.Count())
+	}
+	if _, _, err := r.Record("", "n", "d"); err == nil {
+		t.Error("Record should reject empty issuer")
+	}
+}
+
+func TestFileNonceRegistryPersists(t *testing.T) {
+	path := t.TempDir() + "/nonces.jsonl"
+	r, err := OpenFileNonceRegistry(path)
+	if err != nil {
+		t.Fatalf("OpenFileNonceRegistry() error: %v", err)
+	}
+	r.Record("issuer", "n1", "doc-a")
+	r.Close()
+
+	// Simulate a torn write left by a crash
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString(`{"issuer":"issuer","no`)
+	f.Close()
+
+	r2, err := OpenFileNonceRegistry(path)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	defer r2.Close()
+	if id, ok, _ := r2.Lookup("issuer", "n1"); !ok || id != "doc-a" {
+		t.Errorf("Lookup after reopen = (%s, %v), want (doc-a, true)", id, ok)
+	}
+	if _, replayed, _ := r2.Record("issuer", "n1", "doc-b"); !replayed {
+		t.Error("replay should be detected after reopen")
+	}
+	if _, _, err := r2.Record("issuer", "n2", "doc-c"); err != nil {
+		t.Fatalf("Record after torn tail error: %v", err)
+	}
+	r2.Close()
+
+	r3, _ := OpenFileNonceRegistry(path)
+	defer r3.Close()
+	if _, ok, _ := r3.Lookup("issuer", "n2"); !ok {
+		t.Error("record appended after a torn tail should survive reopen")
+	}
+}
+
+func TestVerifyCovenantDetectsNonceReplay(t *testing.T) {
+	doc, issuerKP := buildTestCovenant(t)
+	registry := NewMemoryNonceRegistry()
+	opts := &VerifyOptions{NonceRegistry: registry}
+
+	result, _ := VerifyCovenantWithOptions(doc, opts)
+	if !result.Valid || findCheck(result, "nonce_unique") == nil {
+		t.Fatal("first verification should pass with a nonce_unique check")
+	}
+	result, _ = VerifyCovenantWithOptions(doc, opts)
+	if !result.Valid {
+		t.Error("re-verifying the same document should not be a replay")
+	}
+
+	// The issuer re-signs different content with the same nonce
+	replay := *doc
+	replay.Constraints = "permit ** on '**'"
+	canonical, _ := CanonicalForm(&replay)
+	sig, _ := Sign([]byte(canonical), issuerKP.PrivateKey)
+	replay.Signature = ToHex(sig)
+	replay.ID = SHA256String(canonical)
+
+	result, _ = VerifyCovenantWithOptions(&replay, opts)
+	if result.Valid {
+		t.Error("document re-using an issuer nonce should be invalid")
+	}
+	check := findCheck(result, "nonce_unique")
+	if check.Passed || check.Code != CheckNonceUnique || !strings.Contains(check.Message, doc.ID) {
+		t.Errorf("nonce_unique = %+v", check)
+	}
+}
+
+func TestVerifyCovenantDoesNotRecordForgedNonce(t *testing.T) {
+	doc, _ := buildTestCovenant(t)
+	registry := NewMemoryNonceRegistry()
+
+	forged := *doc
+	forged.Signature = strings.Repeat("00", 64)
+	VerifyCovenantWithOptions(&forged, &VerifyOptions{NonceRegistry: registry})
+	if registry.Count() != 0 {
+		t.Error("nonces from documents with invalid signatures must not be recorded")
+	}
+
+	// The ID is not signed: replaying the signed document under a forged
+	// ID must not claim its nonce from the genuine document.
+	forged = *doc
+	forged.ID = strings.Repeat("ab", 32)
+	VerifyCovenantWithOptions(&forged, &VerifyOptions{NonceRegistry: registry})
+	if registry.Count() != 0 {
+		t.Error("nonces from documents with a mismatched ID must not be recorded")
+	}
+	if result, _ := VerifyCovenantWithOptions(doc, &VerifyOptions{NonceRegistry: registry}); !result.Valid {
+		t.Errorf("genuine document after a forged replay = %+v", result.Checks)
+	}
+}
+
+func TestVerifyCovenantNonceNamespaceIsKey(t *testing.T) {
+	doc, issuerKP := buildTestCovenant(t)
+	registry := NewMemoryNonceRegistry()
+	opts := &VerifyOptions{NonceRegistry: registry}
+	if result, _ := VerifyCovenantWithOptions(doc, opts); !result.Valid {
+		t.Fatalf("first verification = %+v", result.Checks)
+	}
+
+	// The same issuer naming its key as a did:key re-uses the nonce.
+	replay := *doc
+	replay.Issuer.PublicKey = DIDKeyFromPublicKey(issuerKP.PublicKey)
+	replay.Constraints = "permit ** on '**'"
+	canonical, _ := CanonicalForm(&replay)
+	sig, _ := Sign([]byte(canonical), issuerKP.PrivateKey)
+	replay.Signature = ToHex(sig)
+	replay.ID = SHA256String(canonical)
+
+	result, _ := VerifyCovenantWithOptions(&replay, opts)
+	if check := findCheck(result, "signature_valid"); check == nil || !check.Passed {
+		t.Fatalf("signature_valid = %+v", check)
+	}
+	if check := findCheck(result, "nonce_unique"); check == nil || check.Passed {
+		t.Errorf("nonce_unique = %+v, want a replay across key forms", check)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Immutable covenant tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestImmutableCovenantMemoizes(t *testing.T) {
+	doc, _ := buildTestCovenant(t)
+	ic, err := NewImmutableCovenant(doc)
+	if err != nil {
+		t.Fatalf("NewImmutableCovenant() error: %v", err)
+	}
+
+	canonical, _ := CanonicalForm(doc)
+	if ic.CanonicalForm() != canonical {
+		t.Error("memoized canonical form differs from CanonicalForm()")
+	}
+	if ic.ID() != doc.ID || ic.ComputedID() != doc.ID {
+		t.Errorf("ID() = %s, ComputedID() = %s, want %s", ic.ID(), ic.ComputedID(), doc.ID)
+	}
+
+	// Mutating the source must not affect the wrapper
+	doc.Constraints = "permit ** on '**'"
+	result, err := ic.Verify(nil)
+	if err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if !result.Valid {
+		t.Error("immutable covenant should remain valid after source mutation")
+	}
+
+	// Mutating the returned document must not affect the wrapper either
+	result.Document.Constraints = "deny ** on '**'"
+	again, _ := ic.Verify(nil)
+	if !again.Valid {
+		t.Error("mutating a returned copy should not affect the wrapper")
+	}
+}
+
+func TestImmutableCovenantCountersign(t *testing.T) {
+	doc, _ := buildTestCovenant(t)
+	ic, _ := NewImmutableCovenant(doc)
+
+	auditor, _ := GenerateKeyPair()
+	signed, err := ic.Countersign(auditor, "auditor")
+	if err != nil {
+		t.Fatalf("Countersign() error: %v", err)
+	}
+	if signed.CanonicalForm() != ic.CanonicalForm() {
+		t.Error("countersigning should not change the canonical form")
+	}
+
+	result, _ := signed.Verify(nil)
+	if !result.Valid {
+		t.Error("countersigned immutable covenant should be valid")
+	}
+	if len(result.Document.Countersignatures) != 1 {
+		t.Errorf("countersignatures = %d, want 1", len(result.Document.Countersignatures))
+	}
+
+	original, _ := ic.Document()
+	if len(original.Countersignatures) != 0 {
+		t.Error("countersigning should not modify the original wrapper")
+	}
+}
+
+func TestImmutableCovenantDetectsTampering(t *testing.T) {
+	doc, _ := buildTestCovenant(t)
+	doc.Constraints = "permit ** on '**'"
+	ic, _ := NewImmutableCovenant(doc)
+	if ic.ComputedID() == ic.ID() {
+		t.Error("ComputedID should differ from claimed ID for a tampered document")
+	}
+	result, _ := ic.Verify(nil)
+	if result.Valid {
+		t.Error("tampered document should be invalid")
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Conformance test vector tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestGenerateTestVectorsDeterministic(t *testing.T) {
+	a, err := GenerateTestVectors()
+	if err != nil {
+		t.Fatalf("GenerateTestVectors() error: %v", err)
+	}
+	b, _ := GenerateTestVectors()
+
+	var bufA, bufB bytes.Buffer
+	if err := WriteTestVectors(&bufA, a); err != nil {
+		t.Fatalf("WriteTestVectors() error: %v", err)
+	}
+	_ = WriteTestVectors(&bufB, b)
+	if bufA.String() != bufB.String() {
+		t.Error("GenerateTestVectors should produce identical output on every run")
+	}
+
+	if a.Meta.TotalVectors != 56 {
+		t.Errorf("total_vectors = %d, want 56", a.Meta.TotalVectors)
+	}
+	if a.Meta.CategoryCounts["covenant"] != 6 {
+		t.Errorf("covenant vectors = %d, want 6", a.Meta.CategoryCounts["covenant"])
+	}
+}
+
+func TestGeneratedTestVectorsPass(t *testing.T) {
+	set, _ := GenerateTestVectors()
+
+	var buf bytes.Buffer
+	_ = WriteTestVectors(&buf, set)
+	loaded, err := ReadTestVectors(&buf)
+	if err != nil {
+		t.Fatalf("ReadTestVectors() error: %v", err)
+	}
+
+	for _, r := range RunTestVectors(loaded) {
+		if !r.Passed {
+			t.Errorf("%s/%s: %s", r.Category, r.Name, r.Message)
+		}
+	}
+}
+
+func TestSharedTestVectors(t *testing.T) {
+	set, err := LoadTestVectors("../../test-vectors/canonical-vectors.json")
+	if err != nil {
+		t.Fatalf("LoadTestVectors() error: %v", err)
+	}
+
+	results := RunTestVectors(set)
+	if len(results) != set.Meta.TotalVectors {
+		t.Errorf("ran %d vectors, want %d", len(results), set.Meta.TotalVectors)
+	}
+	for _, r := range results {
+		if !r.Passed {
+			t.Errorf("%s/%s: skipped=%v %s", r.Category, r.Name, r.Skipped, r.Message)
+		}
+	}
+}
+
+func TestLoadTestVectorsErrors(t *testing.T) {
+	if _, err := LoadTestVectors(t.TempDir() + "/missing.json"); CodeOf(err) != ErrCodeStorage {
+		t.Errorf("missing file code = %q, want %q", CodeOf(err), ErrCodeStorage)
+	}
+	if _, err := ReadTestVectors(strings.NewReader("{")); CodeOf(err) != ErrCodeInvalidJSON {
+		t.Errorf("invalid JSON code = %q, want %q", CodeOf(err), ErrCodeInvalidJSON)
+	}
+	if _, err := ReadTestVectors(strings.NewReader(`{"_meta":{}}`)); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("no vectors code = %q, want %q", CodeOf(err), ErrCodeMissingField)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Protocol version tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestIsSupportedVersion(t *testing.T) {
+	for _, v := range []string{"1.0", "1.1", "1.12"} {
+		if !IsSupportedVersion(v) {
+			t.Errorf("IsSupportedVersion(%q) = false, want true", v)
+		}
+	}
+	for _, v := range []string{"", "1", "2.0", "0.9", "1.x", "1.0.1"} {
+		if IsSupportedVersion(v) {
+			t.Errorf("IsSupportedVersion(%q) = true, want false", v)
+		}
+	}
+}
+
+func TestDeserializeMinorVersion(t *testing.T) {
+	doc, kp := buildTestCovenant(t)
+	migrated, err := MigrateDocument(doc, "1.3")
+	if err != nil {
+		t.Fatalf("MigrateDocument() error: %v", err)
+	}
+	signed, err := ResignCovenant(migrated, kp.PrivateKey)
+	if err != nil {
+		t.Fatalf("ResignCovenant() error: %v", err)
+	}
+
+	s, _ := SerializeCovenant(signed)
+	restored, err := DeserializeCovenant(s)
+	if err != nil {
+		t.Fatalf("DeserializeCovenant() should accept 1.x: %v", err)
+	}
+	result, _ := VerifyCovenant(restored)
+	if !result.Valid {
+		t.Error("re-signed 1.3 document should be valid")
+	}
+	if len(result.Checks) != 11 {
+		t.Errorf("checks = %d, want 11", len(result.Checks))
+	}
+}
+
+func TestVerifyUnsupportedVersion(t *testing.T) {
+	doc, kp := buildTestCovenant(t)
+	doc.Version = "2.0"
+	signed, _ := ResignCovenant(doc, kp.PrivateKey)
+
+	result, _ := VerifyCovenant(signed)
+	if result.Valid {
+		t.Error("document with unsupported version should be invalid")
+	}
+	check := findCheck(result, "version_supported")
+	if check == nil || check.Passed || check.Code != CheckVersionSupported {
+		t.Errorf("version_supported check = %+v, want failing", check)
+	}
+}
+
+func TestMigrateDocument(t *testing.T) {
+	doc, _ := buildTestCovenant(t)
+	auditor, _ := GenerateKeyPair()
+	doc, _ = CountersignCovenant(doc, auditor, "auditor")
+
+	migrated, err := MigrateDocument(doc, "1.1")
+	if err != nil {
+		t.Fatalf("MigrateDocument() error: %v", err)
+	}
+	if migrated.Version != "1.1" {
+		t.Errorf("version = %s, want 1.1", migrated.Version)
+	}
+	if doc.Version != ProtocolVersion {
+		t.Error("MigrateDocument should not modify the original")
+	}
+	if migrated.Signature != "" || len(migrated.Countersignatures) != 0 {
+		t.Error("migrated document should be unsigned")
+	}
+	if id, _ := ComputeID(migrated); migrated.ID != id {
+		t.Error("migrated document ID should match its canonical form")
+	}
+
+	same, _ := MigrateDocument(doc, ProtocolVersion)
+	if same.Signature != doc.Signature {
+		t.Error("migrating to the current version should preserve the signature")
+	}
+
+	if _, err := MigrateDocument(doc, "2.0"); CodeOf(err) != ErrCodeUnsupportedVersion {
+		t.Errorf("unsupported target code = %q, want %q", CodeOf(err), ErrCodeUnsupportedVersion)
+	}
+}
+
+func TestMigrateDocumentRegisteredPath(t *testing.T) {
+	err := RegisterMigration(Migration{
+		From:        "0.8",
+		To:          "0.9",
+		Description: "Lowercase issuer key",
+		Migrate: func(doc *CovenantDocument) error {
+			doc.Issuer.PublicKey = strings.ToLower(doc.Issuer.PublicKey)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterMigration() error: %v", err)
+	}
+	_ = RegisterMigration(Migration{
+		From:        "0.9",
+		To:          "1.0",
+		Description: "Add nonce",
+		Migrate: func(doc *CovenantDocument) error {
+			if doc.Nonce == "" {
+				doc.Nonce = strings.Repeat("0", 64)
+			}
+			return nil
+		},
+	})
+
+	doc, kp := buildTestCovenant(t)
+	doc.Version = "0.8"
+	doc.Nonce = ""
+	doc.Issuer.PublicKey = strings.ToUpper(doc.Issuer.PublicKey)
+
+	migrated, err := MigrateDocument(doc, "1.2")
+	if err != nil {
+		t.Fatalf("MigrateDocument() error: %v", err)
+	}
+	if migrated.Version != "1.2" || migrated.Nonce == "" {
+		t.Errorf("migrated = version %s nonce %q", migrated.Version, migrated.Nonce)
+	}
+	if migrated.Issuer.PublicKey != kp.PublicKeyHex {
+		t.Error("registered migrations should be applied in order")
+	}
+
+	if _, err := MigrateDocument(&CovenantDocument{Version: "0.1"}, "1.0"); CodeOf(err) != ErrCodeUnsupportedVersion {
+		t.Errorf("missing path code = %q, want %q", CodeOf(err), ErrCodeUnsupportedVersion)
+	}
+	if err := RegisterMigration(Migration{From: "0.1", To: "0.2"}); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("nil Migrate code = %q, want %q", CodeOf(err), ErrCodeMissingField)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Extension tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func buildExtensionCovenant(t *testing.T, exts map[string]Extension) *CovenantDocument {
+	t.Helper()
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+		Extensions:  exts,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+	return doc
+}
+
+func TestExtensionsNonCriticalIgnored(t *testing.T) {
+	doc := buildExtensionCovenant(t, map[string]Extension{
+		"x-region": {Value: "eu-west-1"},
+	})
+	result, _ := VerifyCovenant(doc)
+	if !result.Valid {
+		t.Error("unknown non-critical extension should be ignored")
+	}
+	if check := findCheck(result, "extensions"); check == nil || !check.Passed {
+		t.Errorf("extensions check = %+v, want passing", check)
+	}
+}
+
+func TestExtensionsUnknownCriticalFails(t *testing.T) {
+	doc := buildExtensionCovenant(t, map[string]Extension{
+		"x-tee-policy": {Critical: true, Value: map[string]interface{}{"vendor": "sgx"}},
+	})
+	result, _ := VerifyCovenant(doc)
+	if result.Valid {
+		t.Error("unknown critical extension should fail verification")
+	}
+	check := findCheck(result, "extensions")
+	if check == nil || check.Passed || check.Code != CheckExtensions {
+		t.Fatalf("extensions check = %+v, want failing", check)
+	}
+	if !strings.Contains(check.Message, "x-tee-policy") {
+		t.Errorf("message should name the extension, got %q", check.Message)
+	}
+
+	result, _ = VerifyCovenantWithOptions(doc, &VerifyOptions{
+		Extensions: map[string]ExtensionHandler{"x-tee-policy": nil},
+	})
+	if !result.Valid {
+		t.Error("known critical extension should pass")
+	}
+}
+
+func TestExtensionsHandlerRejects(t *testing.T) {
+	doc := buildExtensionCovenant(t, map[string]Extension{
+		"x-tier": {Critical: true, Value: "platinum"},
+	})
+	result, _ := VerifyCovenantWithOptions(doc, &VerifyOptions{
+		Extensions: map[string]ExtensionHandler{
+			"x-tier": func(name string, ext Extension) error {
+				if ext.Value != "gold" {
+					return errors.New("unsupported tier")
+				}
+				return nil
+			},
+		},
+	})
+	if result.Valid {
+		t.Error("extension rejected by its handler should fail verification")
+	}
+}
+
+func TestExtensionsSignedAndRoundTrip(t *testing.T) {
+	doc := buildExtensionCovenant(t, map[string]Extension{
+		"x-region": {Value: "eu-west-1"},
+	})
+	s, _ := SerializeCovenant(doc)
+	restored, err := DeserializeCovenant(s)
+	if err != nil {
+		t.Fatalf("DeserializeCovenant() error: %v", err)
+	}
+	if restored.Extensions["x-region"].Critical || restored.Extensions["x-region"].Value != "eu-west-1" {
+		t.Errorf("extensions = %+v", restored.Extensions)
+	}
+
+	restored.Extensions["x-region"] = Extension{Critical: true, Value: "eu-west-1"}
+	result, _ := VerifyCovenant(restored)
+	if result.Valid {
+		t.Error("modifying an extension should invalidate the signature")
+	}
+
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	_, err = BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+		Extensions:  map[string]Extension{" ": {}},
+	})
+	if CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("empty extension name code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Metadata schema tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+var testMetadataSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"team", "tier"},
+	"properties": map[string]interface{}{
+		"team": map[string]interface{}{"type": "string", "minLength": 1},
+		"tier": map[string]interface{}{"enum": []interface{}{"free", "pro"}},
+		"seats": map[string]interface{}{
+			"type": "integer", "minimum": 1, "maximum": 100,
+		},
+		"tags": map[string]interface{}{
+			"type": "array", "items": map[string]interface{}{"type": "string"}, "uniqueItems": true,
+		},
+	},
+	"additionalProperties": false,
+}
+
+func TestValidateMetadata(t *testing.T) {
+	valid := map[string]interface{}{"team": "infra", "tier": "pro", "seats": 10, "tags": []string{"a", "b"}}
+	if err := ValidateMetadata(testMetadataSchema, valid); err != nil {
+		t.Errorf("valid metadata rejected: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		metadata map[string]interface{}
+		want     string
+	}{
+		{"missing required", map[string]interface{}{"team": "infra"}, `missing required property "tier"`},
+		{"wrong type", map[string]interface{}{"team": 5, "tier": "pro"}, "expected type string"},
+		{"enum", map[string]interface{}{"team": "infra", "tier": "gold"}, "not one of the allowed values"},
+		{"integer", map[string]interface{}{"team": "infra", "tier": "pro", "seats": 1.5}, "expected type integer"},
+		{"maximum", map[string]interface{}{"team": "infra", "tier": "pro", "seats": 101}, "greater than maximum"},
+		{"additional", map[string]interface{}{"team": "infra", "tier": "pro", "owner": "x"}, `additional property "owner"`},
+		{"unique items", map[string]interface{}{"team": "infra", "tier": "pro", "tags": []string{"a", "a"}}, "are equal"},
+		{"nil metadata", nil, `missing required property "team"`},
+	}
+	for _, tc := range cases {
+		err := ValidateMetadata(testMetadataSchema, tc.metadata)
+		if CodeOf(err) != ErrCodeSchemaViolation {
+			t.Errorf("%s: code = %q, want %q", tc.name, CodeOf(err), ErrCodeSchemaViolation)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error %q should contain %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestValidateMetadataCombinators(t *testing.T) {
+	schema := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{
+				"oneOf": []interface{}{
+					map[string]interface{}{"type": "string", "pattern": "^usr_"},
+					map[string]interface{}{"type": "integer"},
+				},
+			},
+			"mode": map[string]interface{}{"not": map[string]interface{}{"const": "debug"}},
+		},
+	}
+	if err := ValidateMetadata(schema, map[string]interface{}{"id": "usr_1", "mode": "prod"}); err != nil {
+		t.Errorf("valid metadata rejected: %v", err)
+	}
+	if err := ValidateMetadata(schema, map[string]interface{}{"id": "grp_1"}); err == nil {
+		t.Error("oneOf with no match should fail")
+	}
+	if err := ValidateMetadata(schema, map[string]interface{}{"mode": "debug"}); err == nil {
+		t.Error("not should reject a matching value")
+	}
+
+	bad := map[string]interface{}{"properties": map[string]interface{}{"x": "string"}}
+	if err := ValidateMetadata(bad, map[string]interface{}{"x": 1}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("malformed schema code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+func TestMetadataSchemaBuildAndVerify(t *testing.T) {
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	opts := &CovenantBuilderOptions{
+		Issuer:         Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary:    Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints:    "permit read on '/data/**'",
+		PrivateKey:     issuerKP.PrivateKey,
+		Metadata:       map[string]interface{}{"team": "infra"},
+		MetadataSchema: testMetadataSchema,
+	}
+	if _, err := BuildCovenant(opts); CodeOf(err) != ErrCodeSchemaViolation {
+		t.Errorf("build with invalid metadata code = %q, want %q", CodeOf(err), ErrCodeSchemaViolation)
+	}
+
+	opts.Metadata = map[string]interface{}{"team": "infra", "tier": "free"}
+	doc, err := BuildCovenant(opts)
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+	result, _ := VerifyCovenant(doc)
+	if !result.Valid {
+		t.Error("document with valid metadata should verify")
+	}
+	if check := findCheck(result, "metadata_schema"); check == nil || !check.Passed {
+		t.Errorf("metadata_schema check = %+v, want passing", check)
+	}
+
+	// An issuer profile schema applies on top of the embedded one
+	profile := map[string]interface{}{
+		"properties": map[string]interface{}{"tier": map[string]interface{}{"const": "pro"}},
+	}
+	result, _ = VerifyCovenantWithOptions(doc, &VerifyOptions{MetadataSchema: profile})
+	if result.Valid {
+		t.Error("metadata violating the profile schema should fail verification")
+	}
+	if check := findCheck(result, "metadata_schema"); check == nil || check.Code != CheckMetadataSchema || check.Passed {
+		t.Errorf("metadata_schema check = %+v, want failing", check)
+	}
+
+	plain, _ := buildTestCovenant(t)
+	result, _ = VerifyCovenant(plain)
+	if findCheck(result, "metadata_schema") != nil {
+		t.Error("metadata_schema check should only run when a schema is declared")
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Merkle tree tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func testMerkleLeaves(n int) []string {
+	leaves := make([]string, n)
+	for i := range leaves {
+		leaves[i] = MerkleLeafHash([]byte{byte(i)})
+	}
+	return leaves
+}
+
+func TestMerkleRootKnownValues(t *testing.T) {
+	empty, _ := MerkleRoot(nil)
+	if empty != SHA256String("") {
+		t.Errorf("empty root = %s, want SHA-256 of empty string", empty)
+	}
+	// RFC 6962 leaf hash of the empty string
+	if got := MerkleLeafHash(nil); got != "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d" {
+		t.Errorf("MerkleLeafHash(nil) = %s", got)
+	}
+	one := testMerkleLeaves(1)
+	root, _ := MerkleRoot(one)
+	if root != one[0] {
+		t.Error("root of a single-leaf tree should be the leaf hash")
+	}
+}
+
+func TestMerkleInclusionProofs(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		leaves := testMerkleLeaves(n)
+		root, _ := MerkleRoot(leaves)
+		for i := 0; i < n; i++ {
+			proof, err := MerkleInclusionProof(leaves, i)
+			if err != nil {
+				t.Fatalf("MerkleInclusionProof(%d, %d) error: %v", n, i, err)
+			}
+			if !VerifyMerkleInclusion(leaves[i], int64(i), int64(n), proof, root) {
+				t.Errorf("inclusion proof for leaf %d of %d should verify", i, n)
+			}
+			if n > 1 && VerifyMerkleInclusion(leaves[(i+1)%n], int64(i), int64(n), proof, root) {
+				t.Errorf("inclusion proof for leaf %d of %d should not verify another leaf", i, n)
+			}
+		}
+	}
+	if _, err := MerkleInclusionProof(testMerkleLeaves(3), 3); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("out of range code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+func TestMerkleConsistencyProofs(t *testing.T) {
+	leaves := testMerkleLeaves(13)
+	for m := 1; m <= len(leaves); m++ {
+		for n := m; n <= len(leaves); n++ {
+			root1, _ := MerkleRoot(leaves[:m])
+			root2, _ := MerkleRoot(leaves[:n])
+			proof, err := MerkleConsistencyProof(leaves[:n], m)
+			if err != nil {
+				t.Fatalf("MerkleConsistencyProof(%d, %d) error: %v", m, n, err)
+			}
+			if !VerifyMerkleConsistency(int64(m), int64(n), root1, root2, proof) {
+				t.Errorf("consistency proof %d -> %d should verify", m, n)
+			}
+			if m < n && VerifyMerkleConsistency(int64(m), int64(n), root2, root2, proof) {
+				t.Errorf("consistency proof %d -> %d should not verify a wrong root", m, n)
+			}
+		}
+	}
+
+	// A rewritten history is not consistent
+	forked := append(testMerkleLeaves(4), MerkleLeafHash([]byte("forked")))
+	root1, _ := MerkleRoot(testMerkleLeaves(5))
+	root2, _ := MerkleRoot(forked)
+	proof, _ := MerkleConsistencyProof(forked, 5)
+	if VerifyMerkleConsistency(5, 5, root1, root2, proof) {
+		t.Error("different trees of the same size should not be consistent")
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Transparency log tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func newTestTransparencyLog(t *testing.T) (*MemoryTransparencyLog, *KeyPair) {
+	t.Helper()
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	log, err := NewMemoryTransparencyLog(kp)
+	if err != nil {
+		t.Fatalf("NewMemoryTransparencyLog() error: %v", err)
+	}
+	return log, kp
+}
+
+func TestTransparencyReceiptVerifies(t *testing.T) {
+	log, logKP := newTestTransparencyLog(t)
+	doc, _ := buildTestCovenant(t)
+
+	// Pad the log so the proof is non-trivial
+	for _, leaf := range testMerkleLeaves(5) {
+		_, _ = log.Submit(leaf)
+	}
+	logged, err := SubmitToTransparencyLog(doc, log)
+	if err != nil {
+		t.Fatalf("SubmitToTransparencyLog() error: %v", err)
+	}
+	if logged.ID != doc.ID || len(doc.Transparency) != 0 {
+		t.Error("submitting should not change the ID or the original document")
+	}
+	if c1, _ := CanonicalForm(doc); c1 != mustCanonical(t, logged) {
+		t.Error("transparency receipts should not be part of the canonical form")
+	}
+
+	opts := &VerifyOptions{TransparencyLogs: []TrustedLog{{PublicKey: logKP.PublicKeyHex}}}
+	result, _ := VerifyCovenantWithOptions(logged, opts)
+	if !result.Valid {
+		t.Errorf("document with a valid promise should verify: %+v", findCheck(result, "transparency"))
+	}
+
+	for _, leaf := range testMerkleLeaves(3) {
+		_, _ = log.Submit(MerkleLeafHash([]byte(leaf)))
+	}
+	proven, err := UpdateTransparencyProofs(logged, log)
+	if err != nil {
+		t.Fatalf("UpdateTransparencyProofs() error: %v", err)
+	}
+	if proven.Transparency[0].Proof == nil || proven.Transparency[0].TreeHead.TreeSize != 9 {
+		t.Fatalf("receipt = %+v, want proof against tree of size 9", proven.Transparency[0])
+	}
+	result, _ = VerifyCovenantWithOptions(proven, opts)
+	if check := findCheck(result, "transparency"); check == nil || !check.Passed || check.Code != CheckTransparency {
+		t.Errorf("transparency check = %+v, want passing", check)
+	}
+}
+
+func mustCanonical(t *testing.T, doc *CovenantDocument) string {
+	t.Helper()
+	c, err := CanonicalForm(doc)
+	if err != nil {
+		t.Fatalf("CanonicalForm() error: %v", err)
+	}
+	return c
+}
+
+func TestTransparencyReceiptRejected(t *testing.T) {
+	log, logKP := newTestTransparencyLog(t)
+	_, otherKP := newTestTransparencyLog(t)
+	doc, _ := buildTestCovenant(t)
+	logged, err := SubmitToTransparencyLog(doc, log)
+	if err != nil {
+		t.Fatalf("SubmitToTransparencyLog() error: %v", err)
+	}
+	logged, _ = UpdateTransparencyProofs(logged, log)
+
+	// No receipt from a trusted log
+	result, _ := VerifyCovenantWithOptions(logged, &VerifyOptions{
+		TransparencyLogs: []TrustedLog{{PublicKey: otherKP.PublicKeyHex}},
+	})
+	if result.Valid {
+		t.Error("receipt from an untrusted log should not satisfy verification")
+	}
+
+	// Tampered inclusion proof
+	opts := &VerifyOptions{TransparencyLogs: []TrustedLog{{PublicKey: logKP.PublicKeyHex}}}
+	tampered := *logged
+	tampered.Transparency = []TransparencyReceipt{logged.Transparency[0]}
+	head := *tampered.Transparency[0].TreeHead
+	head.RootHash = SHA256String("forged")
+	tampered.Transparency[0].TreeHead = &head
+	result, _ = VerifyCovenantWithOptions(&tampered, opts)
+	if result.Valid {
+		t.Error("receipt with a forged tree head should fail")
+	}
+
+	// Promise for another covenant
+	other2, _ := buildTestCovenant(t)
+	swapped := *other2
+	swapped.Transparency = logged.Transparency
+	result, _ = VerifyCovenantWithOptions(&swapped, opts)
+	if result.Valid {
+		t.Error("receipt for a different covenant should fail")
+	}
+}
+
+func TestTransparencyCheckpointConsistency(t *testing.T) {
+	log, logKP := newTestTransparencyLog(t)
+	for _, leaf := range testMerkleLeaves(3) {
+		_, _ = log.Submit(leaf)
+	}
+	checkpoint, _ := log.TreeHead()
+
+	doc, _ := buildTestCovenant(t)
+	logged, err := SubmitToTransparencyLog(doc, log)
+	if err != nil {
+		t.Fatalf("SubmitToTransparencyLog() error: %v", err)
+	}
+	logged, _ = UpdateTransparencyProofs(logged, log)
+
+	opts := &VerifyOptions{TransparencyLogs: []TrustedLog{{PublicKey: logKP.PublicKeyHex, Checkpoint: checkpoint, Log: log}}}
+	result, _ := VerifyCovenantWithOptions(logged, opts)
+	if !result.Valid {
+		t.Errorf("receipt consistent with checkpoint should verify: %+v", findCheck(result, "transparency"))
+	}
+
+	// A forked log signs a tree that does not extend the checkpoint
+	forked, _ := NewMemoryTransparencyLog(logKP)
+	for _, leaf := range testMerkleLeaves(2) {
+		_, _ = forked.Submit(leaf)
+	}
+	_, _ = forked.Submit(SHA256String("rewritten"))
+	forkedDoc, err := SubmitToTransparencyLog(doc, forked)
+	if err != nil {
+		t.Fatalf("SubmitToTransparencyLog() error: %v", err)
+	}
+	forkedDoc, _ = UpdateTransparencyProofs(forkedDoc, forked)
+	opts.TransparencyLogs[0].Log = forked
+	result, _ = VerifyCovenantWithOptions(forkedDoc, opts)
+	if result.Valid {
+		t.Error("receipt from a forked log should fail the consistency check")
+	}
+}
+
+func TestTransparencyLogHTTP(t *testing.T) {
+	log, logKP := newTestTransparencyLog(t)
+	server := httptest.NewServer(NewTransparencyLogHandler(log))
+	defer server.Close()
+
+	client, err := NewTransparencyLogClient(server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("NewTransparencyLogClient() error: %v", err)
+	}
+	doc, _ := buildTestCovenant(t)
+	logged, err := SubmitToTransparencyLog(doc, client)
+	if err != nil {
+		t.Fatalf("SubmitToTransparencyLog() error: %v", err)
+	}
+	logged, err = UpdateTransparencyProofs(logged, client)
+	if err != nil {
+		t.Fatalf("UpdateTransparencyProofs() error: %v", err)
+	}
+	result, _ := VerifyCovenantWithOptions(logged, &VerifyOptions{
+		TransparencyLogs: []TrustedLog{{PublicKey: logKP.PublicKeyHex}},
+	})
+	if !result.Valid {
+		t.Errorf("receipt fetched over HTTP should verify: %+v", findCheck(result, "transparency"))
+	}
+
+	if _, err := client.InclusionProof(SHA256String("missing"), 1); CodeOf(err) != ErrCodeNotFound {
+		t.Errorf("missing entry code = %q, want %q", CodeOf(err), ErrCodeNotFound)
+	}
+	if _, err := client.Submit("not-hex"); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("invalid submission code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Batch anchoring tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestAnchorBatch(t *testing.T) {
+	var docs []*CovenantDocument
+	for i := 0; i < 7; i++ {
+		doc, _ := buildTestCovenant(t)
+		docs = append(docs, doc)
+	}
+
+	anchor, err := AnchorBatch(docs)
+	if err != nil {
+		t.Fatalf("AnchorBatch() error: %v", err)
+	}
+	if anchor.TreeSize != 7 || len(anchor.Proofs) != 7 {
+		t.Fatalf("anchor = size %d with %d proofs, want 7", anchor.TreeSize, len(anchor.Proofs))
+	}
+
+	for _, doc := range docs {
+		proof := anchor.Proofs[doc.ID]
+		if !VerifyDocumentBatchProof(doc, proof, anchor.Root) {
+			t.Errorf("proof for %s should verify", doc.ID)
+		}
+		if !VerifyBatchProof(doc.ID, proof) {
+			t.Errorf("VerifyBatchProof for %s should verify", doc.ID)
+		}
+	}
+
+	// A proof for one document does not verify another
+	if VerifyBatchProof(docs[1].ID, anchor.Proofs[docs[0].ID]) {
+		t.Error("proof should not verify a different covenant")
+	}
+	if VerifyDocumentBatchProof(docs[0], anchor.Proofs[docs[0].ID], SHA256String("other root")) {
+		t.Error("proof should not verify against a different root")
+	}
+
+	tampered := *docs[2]
+	tampered.Constraints = "permit ** on '**'"
+	if VerifyDocumentBatchProof(&tampered, anchor.Proofs[docs[2].ID], anchor.Root) {
+		t.Error("proof should not verify a tampered document")
+	}
+}
+
+func TestAnchorBatchErrors(t *testing.T) {
+	if _, err := AnchorBatch(nil); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("empty batch code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+	doc, _ := buildTestCovenant(t)
+	if _, err := AnchorBatch([]*CovenantDocument{doc, doc}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("duplicate code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+	tampered := *doc
+	tampered.Nonce = strings.Repeat("0", 64)
+	if _, err := AnchorBatch([]*CovenantDocument{&tampered}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("mismatched ID code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Anchor tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+// fakeCalendar is an OpenTimestamps calendar that commits each submitted
+// digest under a pending attestation until mine is called.
+type fakeCalendar struct {
+	server  *httptest.Server
+	pending map[string][]byte // hex pending message -> upgrade response
+	headers fakeHeaders
+}
+
+type fakeHeaders map[uint64][]byte
+
+func (h fakeHeaders) BlockMerkleRoot(height uint64) ([]byte, time.Time, error) {
+	root, ok := h[height]
+	if !ok {
+		return nil, time.Time{}, errors.New("unknown block")
+	}
+	return root, time.Unix(1700000000+int64(height), 0), nil
+}
+
+func newFakeCalendar(t *testing.T) *fakeCalendar {
+	t.Helper()
+	cal := &fakeCalendar{pending: make(map[string][]byte), headers: make(fakeHeaders)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/digest", func(w http.ResponseWriter, r *http.Request) {
+		msg, _ := io.ReadAll(r.Body)
+		stamp := &otsTimestamp{msg: msg}
+		node, _ := stamp.add(otsOp{tag: otsOpAppend, arg: []byte("calendar")})
+		node, _ = node.add(otsOp{tag: otsOpSHA256})
+		var uri bytes.Buffer
+		writeOTSVarbytes(&uri, []byte(cal.server.URL))
+		var tag [8]byte
+		copy(tag[:], otsTagPending)
+		node.attestations = append(node.attestations, otsAttestation{tag: tag, payload: uri.Bytes()})
+		cal.pending[ToHex(node.msg)] = nil
+
+		var buf bytes.Buffer
+		stamp.encode(&buf)
+		_, _ = w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("/timestamp/", func(w http.ResponseWriter, r *http.Request) {
+		resp := cal.pending[strings.TrimPrefix(r.URL.Path, "/timestamp/")]
+		if resp == nil {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(resp)
+	})
+	cal.server = httptest.NewServer(mux)
+	t.Cleanup(cal.server.Close)
+	return cal
+}
+
+// mine commits every pending message into a block at height.
+func (c *fakeCalendar) mine(height uint64) {
+	for msgHex := range c.pending {
+		msg, _ := FromHex(msgHex)
+		stamp := &otsTimestamp{msg: msg}
+		node, _ := stamp.add(otsOp{tag: otsOpSHA256})
+		var payload bytes.Buffer
+		writeOTSVaruint(&payload, height)
+		var tag [8]byte
+		copy(tag[:], otsTagBitcoin)
+		node.attestations = append(node.attestations, otsAttestation{tag: tag, payload: payload.Bytes()})
+		c.headers[height] = node.msg
+
+		var buf bytes.Buffer
+		stamp.encode(&buf)
+		c.pending[msgHex] = buf.Bytes()
+	}
+}
+
+func (c *fakeCalendar) anchor(t *testing.T) *OpenTimestamps {
+	t.Helper()
+	ots, err := NewOpenTimestamps(&OpenTimestampsOptions{
+		Calendars:  []string{c.server.URL},
+		HTTPClient: c.server.Client(),
+		Headers:    c.headers,
+	})
+	if err != nil {
+		t.Fatalf("NewOpenTimestamps() error: %v", err)
+	}
+	return ots
+}
+
+func TestOpenTimestampsAnchorCovenant(t *testing.T) {
+	cal := newFakeCalendar(t)
+	ots := cal.anchor(t)
+	doc, _ := buildTestCovenant(t)
+
+	anchored, err := AnchorCovenant(doc, ots)
+	if err != nil {
+		t.Fatalf("AnchorCovenant() error: %v", err)
+	}
+	if len(anchored.Anchors) != 1 || anchored.Anchors[0].Digest != doc.ID {
+		t.Fatalf("anchors = %+v, want one proof for the document ID", anchored.Anchors)
+	}
+	if len(doc.Anchors) != 0 {
+		t.Error("AnchorCovenant should not mutate the original document")
+	}
+
+	// Anchors are outside the canonical form, so the document still verifies
+	result, err := VerifyCovenantWithOptions(anchored, &VerifyOptions{Anchors: []Anchor{ots}})
+	if err != nil {
+		t.Fatalf("VerifyCovenantWithOptions() error: %v", err)
+	}
+	if findCheck(result, "id_match") == nil || !findCheck(result, "id_match").Passed {
+		t.Error("id_match should pass with anchors attached")
+	}
+	check := findCheck(result, "anchored")
+	if check == nil || check.Passed || check.Code != CheckAnchored {
+		t.Fatalf("anchored check before mining = %+v, want failing", check)
+	}
+	if !strings.Contains(check.Message, "pending") {
+		t.Errorf("pending message = %q", check.Message)
+	}
+
+	// Nothing to upgrade yet
+	same, err := UpgradeAnchorProofs(anchored, ots)
+	if err != nil {
+		t.Fatalf("UpgradeAnchorProofs() error: %v", err)
+	}
+	if same.Anchors[0].Proof != anchored.Anchors[0].Proof {
+		t.Error("proof should be unchanged while pending")
+	}
+
+	cal.mine(100)
+	upgraded, err := UpgradeAnchorProofs(anchored, ots)
+	if err != nil {
+		t.Fatalf("UpgradeAnchorProofs() error: %v", err)
+	}
+	atts, err := VerifyAnchorProofs(upgraded, ots)
+	if err != nil {
+		t.Fatalf("VerifyAnchorProofs() error: %v", err)
+	}
+	if len(atts) != 1 || !atts[0].Complete || atts[0].Detail != "bitcoin block 100" {
+		t.Fatalf("attestations = %+v, want complete at block 100", atts)
+	}
+
+	result, err = VerifyCovenantWithOptions(upgraded, &VerifyOptions{Anchors: []Anchor{ots}})
+	if err != nil {
+		t.Fatalf("VerifyCovenantWithOptions() error: %v", err)
+	}
+	if !result.Valid {
+		t.Errorf("upgraded covenant should verify: %+v", result.Checks)
+	}
+}
+
+func TestOpenTimestampsAnchorBatch(t *testing.T) {
+	cal := newFakeCalendar(t)
+	ots := cal.anchor(t)
+	var docs []*CovenantDocument
+	for i := 0; i < 5; i++ {
+		doc, _ := buildTestCovenant(t)
+		docs = append(docs, doc)
+	}
+
+	anchored, batch, err := AnchorCovenantBatch(docs, ots)
+	if err != nil {
+		t.Fatalf("AnchorCovenantBatch() error: %v", err)
+	}
+	if len(cal.pending) != 1 {
+		t.Errorf("calendar received %d submissions, want 1", len(cal.pending))
+	}
+	cal.mine(200)
+
+	for i, doc := range anchored {
+		if doc.Anchors[0].Digest != batch.Root {
+			t.Errorf("doc %d digest = %s, want batch root", i, doc.Anchors[0].Digest)
+		}
+		upgraded, err := UpgradeAnchorProofs(doc, ots)
+		if err != nil {
+			t.Fatalf("UpgradeAnchorProofs() error: %v", err)
+		}
+		atts, err := VerifyAnchorProofs(upgraded, ots)
+		if err != nil {
+			t.Fatalf("VerifyAnchorProofs() error: %v", err)
+		}
+		if len(atts) != 1 || !atts[0].Complete {
+			t.Errorf("doc %d attestations = %+v, want complete", i, atts)
+		}
+	}
+
+	// A batch proof cannot be moved to another document
+	moved := *anchored[1]
+	moved.Anchors = anchored[0].Anchors
+	if _, err := VerifyAnchorProofs(&moved, ots); CodeOf(err) != ErrCodeAnchor {
+		t.Errorf("moved proof code = %q, want %q", CodeOf(err), ErrCodeAnchor)
+	}
+}
+
+func TestOpenTimestampsRejectsTampering(t *testing.T) {
+	cal := newFakeCalendar(t)
+	ots := cal.anchor(t)
+	doc, _ := buildTestCovenant(t)
+	anchored, err := AnchorCovenant(doc, ots)
+	if err != nil {
+		t.Fatalf("AnchorCovenant() error: %v", err)
+	}
+	cal.mine(300)
+	anchored, err = UpgradeAnchorProofs(anchored, ots)
+	if err != nil {
+		t.Fatalf("UpgradeAnchorProofs() error: %v", err)
+	}
+
+	// A tampered document no longer matches its ID
+	tampered := *anchored
+	tampered.Constraints = "permit ** on '**'"
+	if _, err := VerifyAnchorProofs(&tampered, ots); CodeOf(err) != ErrCodeAnchor {
+		t.Errorf("tampered document code = %q, want %q", CodeOf(err), ErrCodeAnchor)
+	}
+
+	// A block header that disagrees with the attestation fails verification
+	cal.headers[300] = make([]byte, 32)
+	if _, err := VerifyAnchorProofs(anchored, ots); CodeOf(err) != ErrCodeAnchor {
+		t.Errorf("wrong header code = %q, want %q", CodeOf(err), ErrCodeAnchor)
+	}
+
+	// A corrupted proof is rejected
+	corrupt := *anchored
+	corrupt.Anchors = []AnchorProof{anchored.Anchors[0]}
+	corrupt.Anchors[0].Proof = "AAAA"
+	if _, err := VerifyAnchorProofs(&corrupt, ots); CodeOf(err) != ErrCodeAnchor {
+		t.Errorf("corrupt proof code = %q, want %q", CodeOf(err), ErrCodeAnchor)
+	}
+}
+
+func TestOpenTimestampsProofRoundTrip(t *testing.T) {
+	cal := newFakeCalendar(t)
+	ots := cal.anchor(t)
+	digest := make([]byte, 32)
+	digest[0] = 1
+
+	proof, err := ots.Stamp(digest)
+	if err != nil {
+		t.Fatalf("Stamp() error: %v", err)
+	}
+	if !bytes.HasPrefix(proof, []byte(otsHeaderMagic)) {
+		t.Error("proof should be a detached .ots file")
+	}
+	root, err := decodeOTSFile(digest, proof)
+	if err != nil {
+		t.Fatalf("decodeOTSFile() error: %v", err)
+	}
+	if !bytes.Equal(encodeOTSFile(root), proof) {
+		t.Error("proof should re-encode identically")
+	}
+	if _, err := decodeOTSFile(make([]byte, 32), proof); CodeOf(err) != ErrCodeAnchor {
+		t.Errorf("wrong digest code = %q, want %q", CodeOf(err), ErrCodeAnchor)
+	}
+
+	att, err := ots.Verify(digest, proof)
+	if err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if att.Complete || !strings.Contains(att.Detail, cal.server.URL) {
+		t.Errorf("attestation = %+v, want pending at the calendar", att)
+	}
+}
+
+func TestNewOpenTimestampsErrors(t *testing.T) {
+	if _, err := NewOpenTimestamps(&OpenTimestampsOptions{Calendars: []string{"ftp://example.com"}}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("bad URL code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+	if _, err := NewOpenTimestamps(&OpenTimestampsOptions{MinCalendars: 5}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("MinCalendars code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+	ots, err := NewOpenTimestamps(nil)
+	if err != nil {
+		t.Fatalf("NewOpenTimestamps(nil) error: %v", err)
+	}
+	if ots.Type() != "opentimestamps" {
+		t.Errorf("Type() = %q", ots.Type())
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// DID tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func buildDIDCovenant(t *testing.T, issuer, beneficiary Party, kp *KeyPair) *CovenantDocument {
+	t.Helper()
+	issuer.Role = "issuer"
+	beneficiary.Role = "beneficiary"
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      issuer,
+		Beneficiary: beneficiary,
+		Constraints: "permit read on '/data/**'",
+		PrivateKey:  kp.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+	return doc
+}
+
+func TestBase58(t *testing.T) {
+	if got := base58Encode([]byte("Hello World!")); got != "2NEpo7TZRRrLZSi2U" {
+		t.Errorf("base58Encode = %q", got)
+	}
+	if got := base58Encode([]byte{0, 0, 1}); got != "112" {
+		t.Errorf("base58Encode leading zeros = %q", got)
+	}
+	decoded, err := base58Decode("2NEpo7TZRRrLZSi2U")
+	if err != nil || string(decoded) != "Hello World!" {
+		t.Errorf("base58Decode = %q, %v", decoded, err)
+	}
+	if _, err := base58Decode("0OIl"); err == nil {
+		t.Error("base58Decode should reject characters outside the alphabet")
+	}
+}
+
+func TestDIDKeyRoundTrip(t *testing.T) {
+	kp, _ := makeTestKeyPairs(t)
+	did := DIDKeyFromPublicKey(kp.PublicKey)
+	if !strings.HasPrefix(did, "did:key:z6Mk") {
+		t.Errorf("did:key = %q, want did:key:z6Mk prefix", did)
+	}
+	doc, err := NewDIDResolver(nil).Resolve(did)
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	keys := doc.AssertionKeys()
+	if len(keys) != 1 || !bytes.Equal(keys[0], kp.PublicKey) {
+		t.Errorf("AssertionKeys() = %x, want %x", keys, kp.PublicKey)
+	}
+	if _, err := NewDIDResolver(nil).Resolve("did:key:zInvalid"); CodeOf(err) != ErrCodeDIDResolution {
+		t.Errorf("invalid did:key code = %q, want %q", CodeOf(err), ErrCodeDIDResolution)
+	}
+
+	// The largest key still fits; longer fingerprints are rejected before decoding
+	maxKey := bytes.Repeat([]byte{0xff}, ed25519.PublicKeySize)
+	if _, err := NewDIDResolver(nil).Resolve(DIDKeyFromPublicKey(maxKey)); err != nil {
+		t.Errorf("Resolve() of the largest key error: %v", err)
+	}
+	long := "did:key:z6Mk" + strings.Repeat("z", 1<<20)
+	start := time.Now()
+	if _, err := NewDIDResolver(nil).Resolve(long); CodeOf(err) != ErrCodeDIDResolution {
+		t.Errorf("oversized did:key code = %q, want %q", CodeOf(err), ErrCodeDIDResolution)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("oversized did:key took %v to reject", elapsed)
+	}
+}
+
+func TestVerifyDIDKeyParties(t *testing.T) {
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	issuerDID := DIDKeyFromPublicKey(issuerKP.PublicKey)
+	doc := buildDIDCovenant(t,
+		Party{ID: issuerDID, PublicKey: issuerDID},
+		Party{ID: DIDKeyFromPublicKey(beneficiaryKP.PublicKey), PublicKey: beneficiaryKP.PublicKeyHex},
+		issuerKP)
+
+	// did:key resolves without a configured resolver
+	result, err := VerifyCovenant(doc)
+	if err != nil {
+		t.Fatalf("VerifyCovenant() error: %v", err)
+	}
+	if !result.Valid {
+		t.Fatalf("covenant with did:key parties should verify: %+v", result.Checks)
+	}
+	if check := findCheck(result, "did_binding"); check == nil || !check.Passed || check.Code != CheckDIDBinding {
+		t.Errorf("did_binding = %+v, want passing", check)
+	}
+
+	// A hex key not controlled by the party's DID fails the binding check
+	otherKP, _ := makeTestKeyPairs(t)
+	unbound := buildDIDCovenant(t,
+		Party{ID: issuerDID, PublicKey: otherKP.PublicKeyHex},
+		Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex},
+		otherKP)
+	result, _ = VerifyCovenant(unbound)
+	if result.Valid {
+		t.Error("covenant signed with a key not bound to the issuer DID should not verify")
+	}
+	if check := findCheck(result, "did_binding"); check == nil || check.Passed {
+		t.Errorf("did_binding = %+v, want failing", check)
+	}
+
+	// Documents without DIDs do not run the check
+	plain, _ := buildTestCovenant(t)
+	result, _ = VerifyCovenant(plain)
+	if findCheck(result, "did_binding") != nil {
+		t.Error("did_binding should only run for documents using DIDs")
+	}
+}
+
+func TestVerifyDIDWebParties(t *testing.T) {
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	var didDoc []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/agents/alice/did.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(didDoc)
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	did := "did:web:" + strings.ReplaceAll(host, ":", "%3A") + ":agents:alice"
+	didDoc = []byte(`{
+		"id": "` + did + `",
+		"verificationMethod": [{
+			"id": "#key-1",
+			"type": "Ed25519VerificationKey2020",
+			"controller": "` + did + `",
+			"publicKeyMultibase": "` + encodeMultibaseEd25519(issuerKP.PublicKey) + `"
+		}],
+		"assertionMethod": ["#key-1"]
+	}`)
+
+	doc := buildDIDCovenant(t,
+		Party{ID: did, PublicKey: did + "#key-1"},
+		Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex},
+		issuerKP)
+	resolver := NewDIDResolver(&DIDResolverOptions{HTTPClient: server.Client()})
+
+	result, err := VerifyCovenantWithOptions(doc, &VerifyOptions{DIDResolver: resolver})
+	if err != nil {
+		t.Fatalf("VerifyCovenantWithOptions() error: %v", err)
+	}
+	if !result.Valid {
+		t.Fatalf("covenant with did:web issuer should verify: %+v", result.Checks)
+	}
+
+	// Without a resolver the did:web key cannot be fetched
+	result, _ = VerifyCovenant(doc)
+	if result.Valid {
+		t.Error("did:web covenant should not verify without a resolver")
+	}
+	if check := findCheck(result, "signature_valid"); check == nil || check.Passed {
+		t.Errorf("signature_valid = %+v, want failing", check)
+	}
+
+	// A method that is not an assertion method is rejected
+	unlisted := buildDIDCovenant(t,
+		Party{ID: did, PublicKey: did + "#key-2"},
+		Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex},
+		issuerKP)
+	result, _ = VerifyCovenantWithOptions(unlisted, &VerifyOptions{DIDResolver: resolver})
+	if check := findCheck(result, "did_binding"); check == nil || check.Passed {
+		t.Errorf("did_binding = %+v, want failing", check)
+	}
+}
+
+func TestIdentityDIDDocument(t *testing.T) {
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: issuerKP,
+		Model:           ModelAttestation{Provider: "example", ModelID: "model-1"},
+		Capabilities:    []string{"read"},
+		Deployment:      DeploymentContext{Runtime: RuntimeProcess},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+
+	doc, err := identity.DIDDocument()
+	if err != nil {
+		t.Fatalf("DIDDocument() error: %v", err)
+	}
+	did := DIDKeyFromPublicKey(issuerKP.PublicKey)
+	if doc.ID != did || len(doc.CapabilityInvocation) != 1 || len(doc.Authentication) != 1 {
+		t.Fatalf("unexpected did:key document: %+v", doc)
+	}
+	resolved, err := NewDIDResolver(nil).Resolve(did)
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	want, _ := json.Marshal(resolved)
+	got, _ := json.Marshal(doc)
+	if !bytes.Equal(got, want) {
+		t.Errorf("DIDDocument() = %s, want resolved document %s", got, want)
+	}
+
+	// The document survives a JSON round trip with its relationships.
+	var decoded DIDDocument
+	if err := json.Unmarshal(got, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if again, _ := json.Marshal(&decoded); !bytes.Equal(again, got) {
+		t.Errorf("round trip = %s, want %s", again, got)
+	}
+
+	// A did:web document can be served and used to verify covenants.
+	var served []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(served)
+	}))
+	defer server.Close()
+	webDID := "did:web:" + strings.ReplaceAll(strings.TrimPrefix(server.URL, "https://"), ":", "%3A")
+	webDoc, err := identity.DIDDocumentWithOptions(&DIDDocumentOptions{WebDID: webDID})
+	if err != nil {
+		t.Fatalf("DIDDocumentWithOptions() error: %v", err)
+	}
+	if len(webDoc.AlsoKnownAs) != 1 || webDoc.AlsoKnownAs[0] != did {
+		t.Errorf("alsoKnownAs = %v, want [%s]", webDoc.AlsoKnownAs, did)
+	}
+	served, _ = json.Marshal(webDoc)
+	cov := buildDIDCovenant(t,
+		Party{ID: webDID, PublicKey: webDoc.AssertionMethod[0]},
+		Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex},
+		issuerKP)
+	resolver := NewDIDResolver(&DIDResolverOptions{HTTPClient: server.Client()})
+	result, err := VerifyCovenantWithOptions(cov, &VerifyOptions{DIDResolver: resolver})
+	if err != nil {
+		t.Fatalf("VerifyCovenantWithOptions() error: %v", err)
+	}
+	if !result.Valid {
+		t.Errorf("covenant issued under the identity's did:web should verify: %+v", result.Checks)
+	}
+
+	if _, err := identity.DIDDocumentWithOptions(&DIDDocumentOptions{WebDID: "did:key:z6Mk"}); err == nil {
+		t.Error("non-did:web identifier should be rejected")
+	}
+}
+
+func TestDIDWebURL(t *testing.T) {
+	cases := map[string]string{
+		"did:web:example.com":                   "https://example.com/.well-known/did.json",
+		"did:web:example.com%3A8443":            "https://example.com:8443/.well-known/did.json",
+		"did:web:example.com:agents:alice":      "https://example.com/agents/alice/did.json",
+		"did:web:example.com%3A8443:user:alice": "https://example.com:8443/user/alice/did.json",
+	}
+	for did, want := range cases {
+		got, err := didWebURL(did)
+		if err != nil || got != want {
+			t.Errorf("didWebURL(%q) = %q, %v; want %q", did, got, err, want)
+		}
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Summary tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestSummarize(t *testing.T) {
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'\n" +
+			"permit write on '/data/reports' when user.role = 'admin'\n" +
+			"deny delete on '**'\n" +
+			"limit api.call 100 per 1 hours\n" +
+			"require audit.log on '/data/**'",
+		ExpiresAt:   "2030-06-01T12:00:00.000Z",
+		GracePeriod: time.Hour,
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+
+	s := Summarize(doc)
+	if want := "alice grants bob 2 permissions, 1 restriction, 1 rate limit, and 1 obligation."; s.Headline != want {
+		t.Errorf("Headline = %q, want %q", s.Headline, want)
+	}
+	wantPermits := []string{
+		`May perform "read" on anything under /data.`,
+		`May perform "write" on /data/reports, only when user.role is admin.`,
+	}
+	if strings.Join(s.Permits, "|") != strings.Join(wantPermits, "|") {
+		t.Errorf("Permits = %q, want %q", s.Permits, wantPermits)
+	}
+	if len(s.Denies) != 1 || s.Denies[0] != `May not perform "delete" on any resource.` {
+		t.Errorf("Denies = %q", s.Denies)
+	}
+	if len(s.Limits) != 1 || s.Limits[0] != `May perform "api.call" at most 100 times per hour.` {
+		t.Errorf("Limits = %q", s.Limits)
+	}
+	if len(s.Obligations) != 1 || s.Obligations[0] != `Must perform "audit.log" on anything under /data.` {
+		t.Errorf("Obligations = %q", s.Obligations)
+	}
+	if len(s.Validity) != 2 || s.Validity[1] != "Expires on 1 June 2030 at 12:00 UTC, with a grace period of 1h0m0s." {
+		t.Errorf("Validity = %q", s.Validity)
+	}
+	if !strings.HasPrefix(s.Parties[0], "Issuer: alice (key "+issuerKP.PublicKeyHex[:16]) {
+		t.Errorf("Parties[0] = %q", s.Parties[0])
+	}
+
+	text := s.String()
+	for _, want := range []string{s.Headline, "Permitted:", "Forbidden:", "Rate limits:", "Obligations:"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("String() missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestSummarizeNotes(t *testing.T) {
+	doc, _ := buildTestCovenant(t)
+	doc.Constraints = "this is not ccl"
+	doc.Chain = &ChainReference{ParentID: strings.Repeat("ab", 32), Relation: "delegates", Depth: 1}
+	doc.Extensions = map[string]Extension{"x-required": {Critical: true}, "x-optional": {}}
+
+	s := Summarize(doc)
+	if len(s.Permits) != 0 || s.Headline != "alice issues a covenant to bob." {
+		t.Errorf("unparseable constraints summary = %+v", s)
+	}
+	notes := strings.Join(s.Notes, "\n")
+	for _, want := range []string{"could not be parsed", "Delegated from covenant abababababababab (delegates, depth 1)", "critical extensions that verifiers must understand: x-required."} {
+		if !strings.Contains(notes, want) {
+			t.Errorf("Notes missing %q: %q", want, s.Notes)
+		}
+	}
+	if strings.Contains(notes, "x-optional") {
+		t.Error("non-critical extensions should not be listed")
+	}
+
+	doc.Constraints = ""
+	doc.ConstraintsRef = &ConstraintsRef{Hash: strings.Repeat("cd", 32), URI: "https://example.com/policy.ccl"}
+	s = Summarize(doc)
+	if !strings.Contains(strings.Join(s.Notes, "\n"), "stored by reference (https://example.com/policy.ccl)") {
+		t.Errorf("Notes = %q, want constraintsRef note", s.Notes)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// DOT export tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestExportChainDOT(t *testing.T) {
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	build := func(constraints string, parent *CovenantDocument) *CovenantDocument {
+		t.Helper()
+		opts := &CovenantBuilderOptions{
+			Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+			Beneficiary: Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+			Constraints: constraints,
+			PrivateKey:  issuerKP.PrivateKey,
+		}
+		if parent != nil {
+			depth := 1
+			if parent.Chain != nil {
+				depth = parent.Chain.Depth + 1
+			}
+			opts.Chain = &ChainReference{ParentID: parent.ID, Relation: "restricts", Depth: depth}
+		}
+		doc, err := BuildCovenant(opts)
+		if err != nil {
+			t.Fatalf("BuildCovenant() error: %v", err)
+		}
+		return doc
+	}
+
+	root := build("permit read on '/data/**'", nil)
+	narrow := build("permit read on '/data/public'", root)
+	grandchild := build("permit read on '/data/public'", narrow)
+	broad := build("permit write on '/data/**'", root)
+	unrelated := build("permit read on '/other/**'", nil)
+
+	store := NewMemoryStore()
+	for _, doc := range []*CovenantDocument{root, narrow, grandchild, broad, unrelated} {
+		if err := store.Put(doc.ID, doc); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+
+	dot, err := ExportChainDOT(store, root.ID)
+	if err != nil {
+		t.Fatalf("ExportChainDOT() error: %v", err)
+	}
+	if !strings.HasPrefix(dot, "digraph covenants {") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("output is not a DOT digraph:\n%s", dot)
+	}
+	for _, want := range []string{
+		`"` + root.ID + `" -> "` + narrow.ID + `" [label="restricts\nnarrows", color="#2e7d32"]`,
+		`"` + narrow.ID + `" -> "` + grandchild.ID + `"`,
+		`"` + root.ID + `" -> "` + broad.ID + `" [label="restricts\n1 narrowing violation(s)", color="#c62828"`,
+		`label="` + root.ID[:16] + `\nalice -> bob"`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT missing %q:\n%s", want, dot)
+		}
+	}
+	if strings.Contains(dot, unrelated.ID) {
+		t.Error("covenants outside the tree should not be exported")
+	}
+
+	if _, err := ExportChainDOT(store, strings.Repeat("0", 64)); CodeOf(err) != ErrCodeNotFound {
+		t.Errorf("missing root code = %q, want %q", CodeOf(err), ErrCodeNotFound)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Evidence bundle tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+// buildTestActionLog appends n signed entries to a log for doc, starting
+// after entries.
+func buildTestActionLog(t *testing.T, doc *CovenantDocument, agent *KeyPair, entries []ActionLogEntry, n int) []ActionLogEntry {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		prev := ActionLogGenesisHash
+		if len(entries) > 0 {
+			prev = entries[len(entries)-1].Hash
+		}
+		ctxHash, err := HashActionContext(map[string]interface{}{"step": i})
+		if err != nil {
+			t.Fatalf("HashActionContext() error: %v", err)
+		}
+		e := ActionLogEntry{
+			Index:        int64(len(entries)),
+			CovenantID:   doc.ID,
+			Action:       "read",
+			Resource:     "/data/report",
+			ContextHash:  ctxHash,
+			Outcome:      OutcomeExecuted,
+			Timestamp:    Timestamp(),
+			PreviousHash: prev,
+		}
+		if err := SignActionLogEntry(&e, agent.PrivateKey); err != nil {
+			t.Fatalf("SignActionLogEntry() error: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+type testBundle struct {
+	doc      *CovenantDocument
+	issuer   *KeyPair
+	agent    *KeyPair
+	identity *AgentIdentity
+	entries  []ActionLogEntry
+	cps      []LogCheckpoint
+}
+
+func newTestBundle(t *testing.T) *testBundle {
+	t.Helper()
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+	doc, err = CountersignCovenant(doc, agentKP, "beneficiary")
+	if err != nil {
+		t.Fatalf("CountersignCovenant() error: %v", err)
+	}
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: issuerKP,
+		Model:           ModelAttestation{Provider: "example", ModelID: "model-1"},
+		Capabilities:    []string{"read"},
+		Deployment:      DeploymentContext{Runtime: RuntimeProcess},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+
+	b := &testBundle{doc: doc, issuer: issuerKP, agent: agentKP, identity: identity}
+	b.entries = buildTestActionLog(t, doc, agentKP, nil, 3)
+	cp1, err := CreateLogCheckpoint(b.entries, agentKP)
+	if err != nil {
+		t.Fatalf("CreateLogCheckpoint() error: %v", err)
+	}
+	b.entries = buildTestActionLog(t, doc, agentKP, b.entries, 2)
+	cp2, err := CreateLogCheckpoint(b.entries, agentKP)
+	if err != nil {
+		t.Fatalf("CreateLogCheckpoint() error: %v", err)
+	}
+	b.cps = []LogCheckpoint{*cp1, *cp2}
+	return b
+}
+
+func (b *testBundle) export(t *testing.T) []byte {
+	t.Helper()
+	data, err := ExportBundle(&ExportBundleOptions{
+		Covenant:       b.doc,
+		IssuerIdentity: b.identity,
+		Entries:        b.entries,
+		Checkpoints:    b.cps,
+	})
+	if err != nil {
+		t.Fatalf("ExportBundle() error: %v", err)
+	}
+	return data
+}
+
+func TestVerifyBundle(t *testing.T) {
+	b := newTestBundle(t)
+	result, err := VerifyBundle(b.export(t), nil)
+	if err != nil {
+		t.Fatalf("VerifyBundle() error: %v", err)
+	}
+	if !result.Valid {
+		t.Fatalf("bundle should verify: %+v", result.Checks)
+	}
+	for _, name := range []string{"covenant", "issuer_identity", "action_log", "checkpoints"} {
+		if findCheckIn(result.Checks, name) == nil {
+			t.Errorf("missing %s check", name)
+		}
+	}
+	if len(result.Covenant.Document.Countersignatures) != 1 {
+		t.Error("bundle should carry the covenant's countersignatures")
+	}
+
+	// A later segment verifies against its predecessor's hash
+	data, err := ExportBundle(&ExportBundleOptions{
+		Covenant:     b.doc,
+		Entries:      b.entries[2:],
+		PreviousHash: b.entries[1].Hash,
+		Checkpoints:  b.cps,
+	})
+	if err != nil {
+		t.Fatalf("ExportBundle() error: %v", err)
+	}
+	result, _ = VerifyBundle(data, nil)
+	if !result.Valid {
+		t.Errorf("log segment bundle should verify: %+v", result.Checks)
+	}
+	if _, err := ExportBundle(&ExportBundleOptions{Covenant: b.doc, Entries: b.entries[2:]}); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("segment without previousHash code = %q, want %q", CodeOf(err), ErrCodeMissingField)
+	}
+}
+
+func TestVerifyBundleDetectsTampering(t *testing.T) {
+	b := newTestBundle(t)
+	tamper := func(name string, mutate func(*AccountabilityBundle), failing string) {
+		t.Helper()
+		var bundle AccountabilityBundle
+		if err := json.Unmarshal(b.export(t), &bundle); err != nil {
+			t.Fatalf("Unmarshal() error: %v", err)
+		}
+		mutate(&bundle)
+		data, _ := json.Marshal(&bundle)
+		result, err := VerifyBundle(data, nil)
+		if err != nil {
+			t.Fatalf("%s: VerifyBundle() error: %v", name, err)
+		}
+		if result.Valid {
+			t.Errorf("%s: tampered bundle should not verify", name)
+		}
+		if c := findCheckIn(result.Checks, failing); c == nil || c.Passed {
+			t.Errorf("%s: %s check = %+v, want failing", name, failing, c)
+		}
+	}
+
+	tamper("edited entry", func(b *AccountabilityBundle) { b.Entries[1].Resource = "/secrets" }, "action_log")
+	tamper("deleted entry", func(b *AccountabilityBundle) {
+		b.Entries = append(b.Entries[:1], b.Entries[2:]...)
+	}, "action_log")
+	tamper("truncated log", func(b *AccountabilityBundle) { b.Entries = b.Entries[:4] }, "checkpoints")
+	tamper("forged checkpoint", func(b *AccountabilityBundle) { b.Checkpoints[0].Size = 2 }, "checkpoints")
+	tamper("edited covenant", func(b *AccountabilityBundle) { b.Covenant.Constraints = "permit ** on '**'" }, "covenant")
+	otherKP, _ := makeTestKeyPairs(t)
+	tamper("foreign identity", func(b *AccountabilityBundle) {
+		other, err := CreateIdentity(&CreateIdentityOptions{
+			OperatorKeyPair: otherKP,
+			Model:           ModelAttestation{Provider: "example", ModelID: "model-1"},
+			Capabilities:    []string{"read"},
+			Deployment:      DeploymentContext{Runtime: RuntimeProcess},
+		})
+		if err != nil {
+			t.Fatalf("CreateIdentity() error: %v", err)
+		}
+		b.IssuerIdentity = other
+	}, "issuer_identity")
+
+	if _, err := VerifyBundle([]byte(`{"format":"other"}`), nil); CodeOf(err) != ErrCodeUnsupportedVersion {
+		t.Errorf("unknown format code = %q, want %q", CodeOf(err), ErrCodeUnsupportedVersion)
+	}
+}
+
+func findCheckIn(checks []VerificationCheck, name string) *VerificationCheck {
+	for i := range checks {
+		if checks[i].Name == name {
+			return &checks[i]
+		}
+	}
+	return nil
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Check registry tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestRegisterCheck(t *testing.T) {
+	err := RegisterCheck("org_owner_metadata", func(doc *CovenantDocument, opts *VerifyOptions) VerificationCheck {
+		_, ok := doc.Metadata["owner"]
+		return VerificationCheck{Passed: ok, Message: "metadata.owner is required"}
+	})
+	if err != nil {
+		t.Fatalf("RegisterCheck() error: %v", err)
+	}
+	defer UnregisterCheck("org_owner_metadata")
+	err = RegisterCheck("org_panics", func(doc *CovenantDocument, opts *VerifyOptions) VerificationCheck {
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatalf("RegisterCheck() error: %v", err)
+	}
+	defer UnregisterCheck("org_panics")
+
+	doc, _ := buildTestCovenant(t)
+	result, err := VerifyCovenant(doc)
+	if err != nil {
+		t.Fatalf("VerifyCovenant() error: %v", err)
+	}
+	if result.Valid {
+		t.Error("failing custom check should invalidate the result")
+	}
+	n := len(result.Checks)
+	if n != 13 || result.Checks[n-2].Name != "org_owner_metadata" || result.Checks[n-1].Name != "org_panics" {
+		t.Fatalf("custom checks should follow the built-ins in registration order: %+v", result.Checks)
+	}
+	custom := result.Checks[n-2]
+	if custom.Passed || custom.Code != "CHECK_ORG_OWNER_METADATA" {
+		t.Errorf("custom check = %+v", custom)
+	}
+	if panicked := result.Checks[n-1]; panicked.Passed || !strings.Contains(panicked.Message, "boom") {
+		t.Errorf("panicking check = %+v, want failed", panicked)
+	}
+
+	if !UnregisterCheck("org_panics") {
+		t.Error("UnregisterCheck should report a registered check")
+	}
+	if UnregisterCheck("org_panics") {
+		t.Error("UnregisterCheck should report an unknown check")
+	}
+}
+
+func TestRegisterCheckErrors(t *testing.T) {
+	noop := func(doc *CovenantDocument, opts *VerifyOptions) VerificationCheck {
+		return VerificationCheck{Passed: true}
+	}
+	for _, name := range []string{"", "Bad-Name", "_leading", "signature_valid"} {
+		if err := RegisterCheck(name, noop); CodeOf(err) != ErrCodeInvalidInput {
+			t.Errorf("RegisterCheck(%q) code = %q, want %q", name, CodeOf(err), ErrCodeInvalidInput)
+		}
+	}
+	if err := RegisterCheck("no_func", nil); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("nil function code = %q, want %q", CodeOf(err), ErrCodeMissingField)
+	}
+	if err := RegisterCheck("dup_check", noop); err != nil {
+		t.Fatalf("RegisterCheck() error: %v", err)
+	}
+	defer UnregisterCheck("dup_check")
+	if err := RegisterCheck("dup_check", noop); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("duplicate code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Severity tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestVerifySeverityWarnings(t *testing.T) {
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'",
+		ExpiresAt:   time.Now().Add(6 * time.Hour).UTC().Format(time.RFC3339),
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+
+	result, _ := VerifyCovenant(doc)
+	if len(result.Warnings) != 0 {
+		t.Errorf("default verification should not warn: %+v", result.Warnings)
+	}
+
+	result, err = VerifyCovenantWithOptions(doc, &VerifyOptions{ExpiryWarning: 24 * time.Hour, WarnUncountersigned: true})
+	if err != nil {
+		t.Fatalf("VerifyCovenantWithOptions() error: %v", err)
+	}
+	if !result.Valid {
+		t.Fatalf("warnings should not invalidate the document: %+v", result.Checks)
+	}
+	if len(result.Warnings) != 2 || result.Warnings[0].Name != "not_expired" || result.Warnings[1].Name != "countersignatures" {
+		t.Errorf("Warnings = %+v, want not_expired and countersignatures", result.Warnings)
+	}
+	if !strings.Contains(result.Warnings[0].Message, "expires at") {
+		t.Errorf("expiry warning message = %q", result.Warnings[0].Message)
+	}
+}
+
+func TestVerifySeverityNonFatalChecks(t *testing.T) {
+	for _, severity := range []CheckSeverity{SeverityWarning, SeverityInfo} {
+		severity := severity
+		err := RegisterCheck("org_advisory", func(doc *CovenantDocument, opts *VerifyOptions) VerificationCheck {
+			return VerificationCheck{Passed: false, Message: "advisory", Severity: severity}
+		})
+		if err != nil {
+			t.Fatalf("RegisterCheck() error: %v", err)
+		}
+		doc, _ := buildTestCovenant(t)
+		result, _ := VerifyCovenant(doc)
+		UnregisterCheck("org_advisory")
+
+		if !result.Valid {
+			t.Errorf("failing %s check should not invalidate the document", severity)
+		}
+		if got, want := len(result.Warnings), map[CheckSeverity]int{SeverityWarning: 1, SeverityInfo: 0}[severity]; got != want {
+			t.Errorf("%s check: %d warnings, want %d", severity, got, want)
+		}
+	}
+
+	err := RegisterCheck("org_fatal", func(doc *CovenantDocument, opts *VerifyOptions) VerificationCheck {
+		return VerificationCheck{Passed: false, Severity: SeverityFatal}
+	})
+	if err != nil {
+		t.Fatalf("RegisterCheck() error: %v", err)
+	}
+	defer UnregisterCheck("org_fatal")
+	doc, _ := buildTestCovenant(t)
+	if result, _ := VerifyCovenant(doc); result.Valid {
+		t.Error("failing fatal check should invalidate the document")
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Verification profile tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestVerifyProfiles(t *testing.T) {
+	doc, _ := buildTestCovenant(t)
+	doc.Countersignatures = []Countersignature{{
+		SignerPublicKey: strings.Repeat("ab", 32),
+		SignerRole:      "auditor",
+		Signature:       strings.Repeat("cd", 64),
+		Timestamp:       Timestamp(),
+	}}
+
+	if result, _ := VerifyCovenant(doc); result.Valid {
+		t.Fatal("document with a bad countersignature should fail by default")
+	}
+	result, err := VerifyCovenantWithOptions(doc, &VerifyOptions{Profile: ProfileIngest})
+	if err != nil {
+		t.Fatalf("VerifyCovenantWithOptions() error: %v", err)
+	}
+	if !result.Valid {
+		t.Errorf("ingest profile should not verify countersignatures: %+v", result.Checks)
+	}
+	if findCheck(result, "countersignatures") != nil {
+		t.Error("skipped check should be omitted from the result")
+	}
+	if len(result.Checks) != 10 {
+		t.Errorf("ingest profile ran %d checks, want 10", len(result.Checks))
+	}
+
+	doc.Countersignatures = nil
+	opts := &VerifyOptions{WarnUncountersigned: true}
+	if result, _ := VerifyCovenantWithOptions(doc, opts); !result.Valid {
+		t.Fatal("warning should not invalidate the document")
+	}
+	opts.Profile = ProfileFullAudit
+	result, _ = VerifyCovenantWithOptions(doc, opts)
+	if result.Valid {
+		t.Error("full-audit profile should treat warnings as failures")
+	}
+	if c := findCheck(result, "countersignatures"); c == nil || c.Passed || c.Severity != SeverityFatal {
+		t.Errorf("countersignatures under full-audit = %+v", c)
+	}
+
+	if _, err := VerifyCovenantWithOptions(doc, &VerifyOptions{Profile: "no-such-profile"}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("unknown profile code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+func TestRegisterProfile(t *testing.T) {
+	err := RegisterProfile(VerificationProfile{
+		Name:       "test-lenient",
+		Skip:       []string{"countersignatures"},
+		Severities: map[string]CheckSeverity{"nonce_present": SeverityInfo},
+	})
+	if err != nil {
+		t.Fatalf("RegisterProfile() error: %v", err)
+	}
+	p, ok := LookupProfile("test-lenient")
+	if !ok || len(p.Skip) != 1 {
+		t.Fatalf("LookupProfile() = %+v, %v", p, ok)
+	}
+	p.Skip[0] = "id_match"
+	if again, _ := LookupProfile("test-lenient"); again.Skip[0] != "countersignatures" {
+		t.Error("LookupProfile should return a copy")
+	}
+
+	doc, _ := buildTestCovenant(t)
+	doc.Nonce = ""
+	if result, _ := VerifyCovenant(doc); result.Valid {
+		t.Fatal("document without nonce should fail by default")
+	}
+	result, err := VerifyCovenantWithOptions(doc, &VerifyOptions{Profile: "test-lenient"})
+	if err != nil {
+		t.Fatalf("VerifyCovenantWithOptions() error: %v", err)
+	}
+	for _, c := range result.Checks {
+		if !c.Passed && c.Name != "nonce_present" && c.Name != "id_match" && c.Name != "signature_valid" {
+			t.Errorf("unexpected failed check %s", c.Name)
+		}
+	}
+	if c := findCheck(result, "nonce_present"); c == nil || c.Severity != SeverityInfo {
+		t.Errorf("nonce_present severity = %+v, want info", c)
+	}
+	if findCheck(result, "countersignatures") != nil {
+		t.Error("countersignatures should be skipped")
+	}
+
+	// No profile relaxes expiry, activation, or version checks.
+	expired, _ := buildTestCovenant(t)
+	expired.ExpiresAt = "2000-01-01T00:00:00Z"
+	result, err = VerifyCovenantWithOptions(expired, &VerifyOptions{Profile: "test-lenient"})
+	if err != nil {
+		t.Fatalf("VerifyCovenantWithOptions() error: %v", err)
+	}
+	if c := findCheck(result, "not_expired"); result.Valid || c == nil || c.Passed {
+		t.Errorf("expired document under a profile: valid=%v not_expired=%+v", result.Valid, c)
+	}
+
+	for _, bad := range []VerificationProfile{
+		{},
+		{Name: ProfileIngest},
+		{Name: "test-lenient"},
+		{Name: "bad-skip", Skip: []string{"Not A Check"}},
+		{Name: "bad-severity", Severities: map[string]CheckSeverity{"nonce_present": "loud"}},
+		{Name: "skip-id", Skip: []string{"id_match"}},
+		{Name: "skip-signature", Skip: []string{"signature_valid"}},
+		{Name: "skip-ccl", Skip: []string{"ccl_parses"}},
+		{Name: "lenient-signature", Severities: map[string]CheckSeverity{"signature_valid": SeverityWarning}},
+		{Name: "lenient-id", Severities: map[string]CheckSeverity{"id_match": SeverityInfo}},
+		{Name: "skip-expiry", Skip: []string{"not_expired"}},
+		{Name: "skip-active", Skip: []string{"active"}},
+		{Name: "lenient-expiry", Severities: map[string]CheckSeverity{"not_expired": SeverityInfo}},
+		{Name: "lenient-version", Severities: map[string]CheckSeverity{"version_supported": SeverityWarning}},
+	} {
+		if err := RegisterProfile(bad); CodeOf(err) == "" {
+			t.Errorf("RegisterProfile(%+v) = %v, should fail", bad, err)
+		}
+	}
+	if _, ok := LookupProfile("skip-signature"); ok {
+		t.Error("profile skipping a protected check was registered")
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Compression tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func gzipEnvelope(t *testing.T, plain []byte) string {
+	t.Helper()
+	compressed, err := gzipCodec{}.Compress(plain)
+	if err != nil {
+		t.Fatalf("Compress() error: %v", err)
+	}
+	b, _ := json.Marshal(compressedEnvelope{ContentEncoding: EncodingGzip, Payload: base64.StdEncoding.EncodeToString(compressed)})
+	return string(b)
+}
+
+// policyText returns n bytes of compressible but non-repetitive text.
+func policyText(n int) string {
+	var b strings.Builder
+	h := SHA256Hex([]byte("policy"))
+	for b.Len() < n {
+		h = SHA256Hex([]byte(h))
+		b.WriteString("permit read on '/data/" + h[:8] + "/**' ")
+	}
+	return b.String()[:n]
+}
+
+func TestSerializeCovenantCompressed(t *testing.T) {
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'",
+		Metadata:    map[string]interface{}{"policy": policyText(400_000)},
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+	plain, _ := SerializeCovenant(doc)
+
+	wire, err := SerializeCovenantWithOptions(doc, &SerializeOptions{ContentEncoding: EncodingGzip})
+	if err != nil {
+		t.Fatalf("SerializeCovenantWithOptions() error: %v", err)
+	}
+	if len(wire) >= len(plain)/2 || !strings.Contains(wire, `"contentEncoding":"gzip"`) {
+		t.Errorf("compressed size %d (plain %d): %.80s", len(wire), len(plain), wire)
+	}
+	decoded, err := DeserializeCovenant(wire)
+	if err != nil {
+		t.Fatalf("DeserializeCovenant() error: %v", err)
+	}
+	if decoded.ID != doc.ID {
+		t.Errorf("decoded ID = %s, want %s", decoded.ID, doc.ID)
+	}
+	if result, _ := VerifyCovenant(decoded); !result.Valid {
+		t.Errorf("decompressed covenant should verify: %+v", result.Checks)
+	}
+
+	small, _ := buildTestCovenant(t)
+	out, err := SerializeCovenantWithOptions(small, &SerializeOptions{ContentEncoding: EncodingGzip, MinSize: 64 << 10})
+	if err != nil || strings.Contains(out, "contentEncoding") {
+		t.Errorf("document below MinSize should not be compressed: %v", err)
+	}
+	if _, err := SerializeCovenantWithOptions(small, &SerializeOptions{ContentEncoding: "zstd"}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("unregistered encoding code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+func TestDeserializeCompressedLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		wire string
+		code ErrorCode
+	}{
+		{"too large", gzipEnvelope(t, []byte(policyText(MaxDocumentSize+1))), ErrCodeDocumentTooLarge},
+		{"ratio", gzipEnvelope(t, bytes.Repeat([]byte{' '}, 200_000)), ErrCodeCompression},
+		{"encoding", `{"contentEncoding":"br","payload":""}`, ErrCodeCompression},
+		{"payload", `{"contentEncoding":"gzip","payload":"!!"}`, ErrCodeCompression},
+		{"corrupt", `{"contentEncoding":"gzip","payload":"AAAA"}`, ErrCodeCompression},
+	}
+	for _, tt := range tests {
+		if _, err := DeserializeCovenant(tt.wire); CodeOf(err) != tt.code {
+			t.Errorf("%s: code = %q, want %q (%v)", tt.name, CodeOf(err), tt.code, err)
+		}
+	}
+}
+
+func TestRegisterContentEncoding(t *testing.T) {
+	if err := RegisterContentEncoding(EncodingGzip, gzipCodec{}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("re-registering gzip code = %q", CodeOf(err))
+	}
+	if err := RegisterContentEncoding("test-gzip", nil); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("nil codec code = %q", CodeOf(err))
+	}
+	if err := RegisterContentEncoding("test-gzip", gzipCodec{}); err != nil {
+		t.Fatalf("RegisterContentEncoding() error: %v", err)
+	}
+	doc, _ := buildTestCovenant(t)
+	wire, err := SerializeCovenantWithOptions(doc, &SerializeOptions{ContentEncoding: "test-gzip"})
+	if err != nil {
+		t.Fatalf("SerializeCovenantWithOptions() error: %v", err)
+	}
+	if decoded, err := DeserializeCovenant(wire); err != nil || decoded.ID != doc.ID {
+		t.Errorf("round trip through registered encoding failed: %v", err)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Deterministic build tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestBuildCovenantDeterministic(t *testing.T) {
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	opts := &CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+	}
+	nonce := SHA256String("golden-nonce")
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 6_000_000, time.FixedZone("CET", 3600))
+
+	first, err := BuildCovenantDeterministic(opts, nonce, createdAt)
+	if err != nil {
+		t.Fatalf("BuildCovenantDeterministic() error: %v", err)
+	}
+	second, _ := BuildCovenantDeterministic(opts, nonce, createdAt)
+	a, _ := SerializeCovenant(first)
+	b, _ := SerializeCovenant(second)
+	if a != b {
+		t.Errorf("deterministic builds differ:\n%s\n%s", a, b)
+	}
+	if first.Nonce != nonce || first.CreatedAt != "2025-01-02T02:04:05.006Z" {
+		t.Errorf("nonce/createdAt = %s / %s", first.Nonce, first.CreatedAt)
+	}
+	if result, _ := VerifyCovenant(first); !result.Valid {
+		t.Errorf("deterministic covenant should verify: %+v", result.Checks)
+	}
+
+	if _, err := BuildCovenantDeterministic(opts, "abc", createdAt); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("short nonce code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+	if _, err := BuildCovenantDeterministic(opts, nonce, time.Time{}); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("zero createdAt code = %q, want %q", CodeOf(err), ErrCodeMissingField)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// ActionLog tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+func TestActionLog(t *testing.T) {
+	b := newTestBundle(t)
+	log, err := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	if err != nil {
+		t.Fatalf("NewActionLog() error: %v", err)
+	}
+	if log.Head() != ActionLogGenesisHash {
+		t.Errorf("empty log head = %s", log.Head())
+	}
+	for i, outcome := range []ActionOutcome{OutcomeExecuted, OutcomeDenied, OutcomeExecuted} {
+		e, err := log.Append("read", "/data/report", map[string]interface{}{"step": i}, outcome)
+		if err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+		if e.Index != int64(i) || e.CovenantID != b.doc.ID || log.Head() != e.Hash {
+			t.Errorf("entry %d = %+v", i, e)
+		}
+	}
+	if err := log.VerifyChain(); err != nil {
+		t.Errorf("VerifyChain() error: %v", err)
+	}
+	cp, err := log.Checkpoint()
+	if err != nil || cp.Size != 3 || cp.HeadHash != log.Head() {
+		t.Fatalf("Checkpoint() = %+v, %v", cp, err)
+	}
+
+	data, err := log.Export()
+	if err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+	entries, err := ParseActionLog(data)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("ParseActionLog() = %d entries, %v", len(entries), err)
+	}
+	resumed, err := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent, Entries: entries})
+	if err != nil {
+		t.Fatalf("resuming log error: %v", err)
+	}
+	if e, _ := resumed.Append("read", "/data/other", nil, OutcomeExecuted); e.Index != 3 || e.PreviousHash != cp.HeadHash {
+		t.Errorf("resumed append = %+v", e)
+	}
+
+	entries[1].Resource = "/data/secret"
+	if _, err := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent, Entries: entries}); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("tampered log code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+	if _, err := log.Append("", "/x", nil, OutcomeExecuted); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("empty action code = %q", CodeOf(err))
+	}
+	if _, err := log.Append("read", "/x", nil, "MAYBE"); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("bad outcome code = %q", CodeOf(err))
+	}
+	if _, err := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.issuer}); CodeOf(err) != ErrCodeInvalidParty {
+		t.Errorf("non-beneficiary agent code = %q, want %q", CodeOf(err), ErrCodeInvalidParty)
+	}
+}
+
+func TestActionLogConsistencyProof(t *testing.T) {
+	b := newTestBundle(t)
+	appendN := func(log *ActionLog, resource string, n int) {
+		for i := 0; i < n; i++ {
+			if _, err := log.Append("read", resource, nil, OutcomeExecuted); err != nil {
+				t.Fatalf("Append() error: %v", err)
+			}
+		}
+	}
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	appendN(log, "/data/a", 3)
+	old, _ := log.Checkpoint()
+	appendN(log, "/data/b", 4)
+	cur, _ := log.Checkpoint()
+
+	proof, err := log.ConsistencyProof(3, 7)
+	if err != nil {
+		t.Fatalf("ConsistencyProof() error: %v", err)
+	}
+	if err := VerifyLogConsistency(old, cur, proof); err != nil {
+		t.Errorf("VerifyLogConsistency() error: %v", err)
+	}
+	same, _ := log.ConsistencyProof(7, 7)
+	if err := VerifyLogConsistency(cur, cur, same); err != nil {
+		t.Errorf("equal-size consistency error: %v", err)
+	}
+
+	// A log that rewrote its history cannot extend the old checkpoint.
+	forged, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	appendN(forged, "/data/forged", 7)
+	forgedCP, _ := forged.Checkpoint()
+	forgedProof, _ := forged.ConsistencyProof(3, 7)
+	if err := VerifyLogConsistency(old, forgedCP, forgedProof); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("rewritten history code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+
+	if err := VerifyLogConsistency(old, cur, same); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("mismatched proof sizes code = %q", CodeOf(err))
+	}
+	for _, sizes := range [][2]int64{{0, 3}, {4, 3}, {3, 8}} {
+		if _, err := log.ConsistencyProof(sizes[0], sizes[1]); CodeOf(err) != ErrCodeInvalidInput {
+			t.Errorf("ConsistencyProof(%d, %d) code = %q", sizes[0], sizes[1], CodeOf(err))
+		}
+	}
+}
+
+// ═══════════════════════════════════════════════════════════════════════════════
+// Compliance replay tests
+// ═══════════════════════════════════════════════════════════════════════════════
+
+// buildReplayCovenant returns a covenant with the given constraints and
+// an entry factory with controllable timestamps. Replay does not check
+// signatures, so the entries are left unsigned.
+func buildReplayCovenant(t *testing.T, constraints string) (*CovenantDocument, func(action, resource string, outcome ActionOutcome, at time.Duration) ActionLogEntry) {
+	t.Helper()
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: constraints,
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("BuildCovenant() error: %v", err)
+	}
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	var index int64
+	entry := func(action, resource string, outcome ActionOutcome, at time.Duration) ActionLogEntry {
+		ctxHash, _ := HashActionContext(map[string]interface{}{"index": index})
+		e := ActionLogEntry{
+			Index:       index,
+			CovenantID:  doc.ID,
+			Action:      action,
+			Resource:    resource,
+			ContextHash: ctxHash,
+			Outcome:     outcome,
+			Timestamp:   start.Add(at).Format("2006-01-02T15:04:05.000Z"),
+		}
+		index++
+		return e
+	}
+	return doc, entry
+}
+
+func TestReplayCompliance(t *testing.T) {
+	doc, entry := buildReplayCovenant(t, `permit read on '/data/**'
+permit write on '/system/**'
+permit audit.log on '/system/**'
+deny read on '/data/secret'
+limit read 2 per 1 minutes
+require audit.log on '/system/**'`)
+
+	entries := []ActionLogEntry{
+		entry("read", "/data/a", OutcomeExecuted, 0),
+		entry("read", "/data/b", OutcomeExecuted, 10*time.Second),
+		entry("read", "/data/c", OutcomeExecuted, 20*time.Second),
+		entry("read", "/data/secret", OutcomeExecuted, 2*time.Minute),
+		entry("write", "/system/x", OutcomeExecuted, 3*time.Minute),
+		entry("audit.log", "/system/x", OutcomeExecuted, 4*time.Minute),
+		entry("write", "/system/y", OutcomeExecuted, 5*time.Minute),
+		entry("delete", "/data/a", OutcomeDenied, 6*time.Minute),
+	}
+	report := ReplayComplianceWithOptions(doc, entries, nil)
+	if report.Compliant || report.Entries != len(entries) || report.Error != "" {
+		t.Fatalf("report = %+v", report)
+	}
+	want := []struct {
+		index int64
+		kind  ViolationKind
+	}{{2, ViolationRateLimit}, {3, ViolationUnpermitted}, {6, ViolationObligation}}
+	if len(report.Violations) != len(want) {
+		t.Fatalf("violations = %+v", report.Violations)
+	}
+	for i, w := range want {
+		if v := report.Violations[i]; v.Index != w.index || v.Kind != w.kind || v.Rule == "" {
+			t.Errorf("violation %d = %+v, want %s at %d", i, v, w.kind, w.index)
+		}
+	}
+
+	clean := ReplayComplianceWithOptions(doc, entries[:2], nil)
+	if !clean.Compliant || len(clean.Violations) != 0 {
+		t.Errorf("clean prefix report = %+v", clean)
+	}
+}
+
+func TestReplayComplianceActionLog(t *testing.T) {
+	b := newTestBundle(t)
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	log.Append("read", "/data/report", nil, OutcomeExecuted)
+	log.Append("write", "/data/report", nil, OutcomeExecuted)
+	log.Append("write", "/data/report", nil, OutcomeDenied)
+
+	report := ReplayCompliance(b.doc, log)
+	if report.Compliant || len(report.Violations) != 1 || report.Violations[0].Index != 1 || report.Violations[0].Kind != ViolationUnpermitted {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestReplayComplianceContexts(t *testing.T) {
+	doc, entry := buildReplayCovenant(t, "permit transfer on '/treasury' when amount <= 100")
+	small := entry("transfer", "/treasury", OutcomeExecuted, 0)
+	large := entry("transfer", "/treasury", OutcomeExecuted, time.Minute)
+
+	report := ReplayComplianceWithOptions(doc, []ActionLogEntry{small, large}, nil)
+	if report.Compliant || len(report.Unevaluated) != 2 || len(report.Violations) != 0 {
+		t.Errorf("without contexts: %+v", report)
+	}
+
+	// Commit the entries to real contexts and supply them to the replay.
+	small.ContextHash, _ = HashActionContext(map[string]interface{}{"amount": 50})
+	large.ContextHash, _ = HashActionContext(map[string]interface{}{"amount": 500})
+	report = ReplayComplianceWithOptions(doc, []ActionLogEntry{small, large}, &ReplayOptions{
+		Contexts: []map[string]interface{}{{"amount": 50}, {"amount": 500}},
+	})
+	if len(report.Unevaluated) != 0 || len(report.Violations) != 1 || report.Violations[0].Index != 1 {
+		t.Errorf("with contexts: %+v", report)
+	}
+}
+
+func TestReplayComplianceObligationWindow(t *testing.T) {
+	doc, entry := buildReplayCovenant(t, `permit write on '/system/**'
+permit audit.log on '/system/**'
+require audit.log on '/system/**'`)
+	entries := []ActionLogEntry{
+		entry("write", "/system/a", OutcomeExecuted, 0),
+		entry("audit.log", "/system/a", OutcomeExecuted, 30*time.Second),
+		entry("write", "/system/b", OutcomeExecuted, 2*time.Minute),
+		entry("audit.log", "/system/b", OutcomeExecuted, 5*time.Minute),
+		entry("write", "/system/c", OutcomeExecuted, 10*time.Minute),
+	}
+
+	report := ReplayComplianceWithOptions(doc, entries, &ReplayOptions{ObligationWindow: time.Minute})
+	if len(report.Violations) != 1 {
+		t.Fatalf("violations = %+v", report.Violations)
+	}
+	v := report.Violations[0]
+	if v.Index != 2 || v.Kind != ViolationObligation || v.Deadline != "2025-06-01T12:03:00.000Z" {
+		t.Errorf("late fulfilment violation = %+v", v)
+	}
+	if len(report.OpenObligations) != 1 || report.OpenObligations[0].Index != 4 || report.OpenObligations[0].Deadline != "2025-06-01T12:11:00.000Z" {
+		t.Errorf("open obligations = %+v", report.OpenObligations)
+	}
+
+	// Auditing after the last deadline turns the open obligation into a violation.
+	report = ReplayComplianceWithOptions(doc, entries, &ReplayOptions{
+		ObligationWindow: time.Minute,
+		Now:              time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC),
+	})
+	if len(report.Violations) != 2 || report.Violations[1].Index != 4 || len(report.OpenObligations) != 0 {
+		t.Errorf("audit after deadline = %+v", report)
+	}
+
+	// Without a window, any later fulfilment counts.
+	report = ReplayComplianceWithOptions(doc, entries, nil)
+	if len(report.Violations) != 1 || report.Violations[0].Index != 4 || report.Violations[0].Deadline != "" {
+		t.Errorf("unwindowed violations = %+v", report.Violations)
+	}
+}
+
+func TestAuditRateLimits(t *testing.T) {
+	doc, entry := buildReplayCovenant(t, `permit read on '/data/**'
+limit read 2 per 1 minutes`)
+	entries := []ActionLogEntry{
+		entry("read", "/data/a", OutcomeExecuted, 0),
+		entry("read", "/data/a", OutcomeExecuted, 10*time.Second),
+		entry("read", "/data/a", OutcomeExecuted, 20*time.Second),
+		entry("read", "/data/a", OutcomeExecuted, 30*time.Second),
+		entry("read", "/data/a", OutcomeExecuted, 5*time.Minute),
+		entry("read", "/data/a", OutcomeExecuted, 5*time.Minute+10*time.Second),
+		entry("read", "/data/a", OutcomeExecuted, 10*time.Minute),
+		entry("read", "/data/a", OutcomeExecuted, 10*time.Minute+5*time.Second),
+		entry("read", "/data/a", OutcomeExecuted, 10*time.Minute+6*time.Second),
+		entry("read", "/data/a", OutcomeDenied, 10*time.Minute+7*time.Second),
+	}
+	excesses, err := AuditRateLimitsWithOptions(doc, entries, nil)
+	if err != nil {
+		t.Fatalf("AuditRateLimitsWithOptions() error: %v", err)
+	}
+	if len(excesses) != 2 {
+		t.Fatalf("excesses = %+v", excesses)
+	}
+	first, second := excesses[0], excesses[1]
+	if first.Start != "2025-06-01T12:00:00.000Z" || first.End != "2025-06-01T12:00:30.000Z" || first.MaxCount != 4 || len(first.Indices) != 4 {
+		t.Errorf("first interval = %+v", first)
+	}
+	if second.Start != "2025-06-01T12:10:00.000Z" || second.MaxCount != 3 || len(second.Indices) != 3 || second.Indices[0] != 6 {
+		t.Errorf("second interval = %+v", second)
+	}
+	if first.Rule != "limit read 2 per 1 minutes" || first.Limit != 2 {
+		t.Errorf("rule = %q, limit = %v", first.Rule, first.Limit)
+	}
+
+	b := newTestBundle(t)
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	log.Append("read", "/data/report", nil, OutcomeExecuted)
+	if excesses, err := AuditRateLimits(b.doc, log); err != nil || len(excesses) != 0 {
+		t.Errorf("AuditRateLimits() without limits = %+v, %v", excesses, err)
+	}
+}
+
+func TestActionLogJSONL(t *testing.T) {
+	b := newTestBundle(t)
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	for i := 0; i < 5; i++ {
+		log.Append("read", "/data/report", map[string]interface{}{"i": i}, OutcomeExecuted)
+	}
+	cp3, _ := CreateLogCheckpoint(log.Entries()[:3], b.agent)
+	cp5, _ := log.Checkpoint()
+
+	var buf bytes.Buffer
+	if err := log.WriteJSONL(&buf); err != nil {
+		t.Fatalf("WriteJSONL() error: %v", err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 5 {
+		t.Fatalf("WriteJSONL() wrote %d lines, want 5", n)
+	}
+
+	opts := &ReadJSONLOptions{PublicKey: b.agent.PublicKey, Checkpoints: []LogCheckpoint{*cp3, *cp5}}
+	var seen []int64
+	result, err := ReadJSONL(bytes.NewReader(buf.Bytes()), opts, func(e ActionLogEntry) error {
+		seen = append(seen, e.Index)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadJSONL() error: %v", err)
+	}
+	if result.Entries != 5 || len(seen) != 5 || result.HeadHash != cp5.HeadHash || result.Root != cp5.Root || result.CovenantID != b.doc.ID {
+		t.Errorf("result = %+v, seen %v", result, seen)
+	}
+
+	lines := strings.SplitAfter(buf.String(), "\n")
+	tampered := strings.Join(lines[:2], "") + strings.Replace(lines[2], "/data/report", "/data/secret", 1) + strings.Join(lines[3:], "")
+	if _, err := ReadJSONL(strings.NewReader(tampered), opts, nil); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("tampered entry code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+	truncated := strings.Join(lines[:4], "")
+	if _, err := ReadJSONL(strings.NewReader(truncated), opts, nil); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("truncated log code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+	reordered := lines[1] + lines[0] + strings.Join(lines[2:], "")
+	if _, err := ReadJSONL(strings.NewReader(reordered), opts, nil); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("reordered log code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+
+	// A segment resumes from the hash preceding it.
+	entries := log.Entries()
+	segment := strings.Join(lines[2:], "")
+	result, err = ReadJSONL(strings.NewReader(segment), &ReadJSONLOptions{PublicKey: b.agent.PublicKey, PreviousHash: entries[1].Hash}, nil)
+	if err != nil || result.FirstIndex != 2 || result.Entries != 3 || result.Root != "" {
+		t.Errorf("segment result = %+v, %v", result, err)
+	}
+}
+
+func TestMerkleAccumulator(t *testing.T) {
+	var leaves []string
+	acc := &merkleAccumulator{}
+	for i := 0; i < 17; i++ {
+		leaf := MerkleLeafHash([]byte{byte(i)})
+		leaves = append(leaves, leaf)
+		acc.add(merkleLeaf([]byte{byte(i)}))
+		want, _ := MerkleRoot(leaves)
+		if got := ToHex(acc.root()); got != want {
+			t.Errorf("root of %d leaves = %s, want %s", i+1, got, want)
+		}
+	}
+}
+
+func TestFileLog(t *testing.T) {
+	b := newTestBundle(t)
+	dir := t.TempDir()
+	opts := &FileLogOptions{Dir: dir, Covenant: b.doc, Agent: b.agent, SegmentSize: 1024}
+	log, err := OpenFileLog(opts)
+	if err != nil {
+		t.Fatalf("OpenFileLog() error: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		if _, err := log.Append("read", "/data/report", map[string]interface{}{"i": i}, OutcomeExecuted); err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+	}
+	head := log.Head()
+	cp, err := log.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint() error: %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	if _, err := log.Append("read", "/x", nil, OutcomeExecuted); CodeOf(err) != ErrCodeStorage {
+		t.Errorf("append after close code = %q", CodeOf(err))
+	}
+	segments, _ := os.ReadDir(dir)
+	if len(segments) < 2 {
+		t.Fatalf("expected several segments, got %d", len(segments))
+	}
+
+	log, err = OpenFileLog(opts)
+	if err != nil {
+		t.Fatalf("reopening error: %v", err)
+	}
+	if log.Len() != 6 || log.Head() != head || log.Repaired() != 0 {
+		t.Errorf("reopened log: len %d, head %s, repaired %d", log.Len(), log.Head(), log.Repaired())
+	}
+	var buf bytes.Buffer
+	if err := log.WriteJSONL(&buf); err != nil {
+		t.Fatalf("WriteJSONL() error: %v", err)
+	}
+	result, err := ReadJSONL(&buf, &ReadJSONLOptions{PublicKey: b.agent.PublicKey, Checkpoints: []LogCheckpoint{*cp}}, nil)
+	if err != nil || result.Entries != 6 || result.Root != cp.Root {
+		t.Errorf("ReadJSONL() of file log = %+v, %v", result, err)
+	}
+	log.Close()
+
+	// A torn write at the tail is truncated on open.
+	last := dir + "/" + segments[len(segments)-1].Name()
+	f, _ := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0o600)
+	f.WriteString(`{"index":6,"covenantId":"`)
+	f.Close()
+	log, err = OpenFileLog(opts)
+	if err != nil {
+		t.Fatalf("opening torn log error: %v", err)
+	}
+	if log.Len() != 6 || log.Repaired() == 0 {
+		t.Errorf("torn log: len %d, repaired %d", log.Len(), log.Repaired())
+	}
+	if e, err := log.Append("read", "/data/report", nil, OutcomeExecuted); err != nil || e.Index != 6 || e.PreviousHash != head {
+		t.Errorf("append after repair = %+v, %v", e, err)
+	}
+	log.Close()
+
+	// Tampering anywhere else fails verification.
+	first := dir + "/" + segments[0].Name()
+	data, _ := os.ReadFile(first)
+	os.WriteFile(first, bytes.Replace(data, []byte("/data/report"), []byte("/data/secret"), 1), 0o600)
+	if _, err := OpenFileLog(opts); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("tampered log code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+
+	if _, err := OpenFileLog(&FileLogOptions{Dir: t.TempDir(), Covenant: b.doc, Agent: b.agent, Sync: SyncInterval}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("SyncInterval without interval code = %q", CodeOf(err))
+	}
+}
+
+func TestCheckpointWitnesses(t *testing.T) {
+	b := newTestBundle(t)
+	auditor, _ := GenerateKeyPair()
+	other, _ := GenerateKeyPair()
+	outsider, _ := GenerateKeyPair()
+	policy := &WitnessPolicy{Witnesses: []string{auditor.PublicKeyHex, other.PublicKeyHex, b.issuer.PublicKeyHex}, Quorum: 2}
+
+	cp, err := CosignCheckpoint(&b.cps[1], auditor, "auditor")
+	if err != nil {
+		t.Fatalf("CosignCheckpoint() error: %v", err)
+	}
+	if len(b.cps[1].Cosignatures) != 0 {
+		t.Error("CosignCheckpoint() should not modify its input")
+	}
+	if err := VerifyLogCheckpoint(cp); err != nil {
+		t.Errorf("cosigned checkpoint signature: %v", err)
+	}
+	if err := VerifyCheckpointWitnesses(cp, policy); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("one cosignature code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+	// Untrusted and repeated cosignatures do not count towards the quorum.
+	cp, _ = CosignCheckpoint(cp, outsider, "")
+	cp, _ = CosignCheckpoint(cp, auditor, "auditor")
+	if len(cp.Cosignatures) != 2 {
+		t.Errorf("cosignatures = %d, want 2", len(cp.Cosignatures))
+	}
+	if err := VerifyCheckpointWitnesses(cp, policy); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("untrusted cosignature code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+	cp, _ = CosignCheckpoint(cp, b.issuer, "issuer")
+	if err := VerifyCheckpointWitnesses(cp, policy); err != nil {
+		t.Errorf("VerifyCheckpointWitnesses() with quorum: %v", err)
+	}
+
+	forged := *cp
+	forged.Size++
+	if _, err := CosignCheckpoint(&forged, auditor, "auditor"); err == nil {
+		t.Error("cosigning a checkpoint with a bad signature should fail")
+	}
+	if err := VerifyCheckpointWitnesses(cp, &WitnessPolicy{Witnesses: []string{auditor.PublicKeyHex}, Quorum: 2}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("unreachable quorum code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+
+	// Bundles and JSONL imports enforce the policy.
+	opts := &BundleVerifyOptions{Witnesses: policy}
+	result, _ := VerifyBundle(b.export(t), opts)
+	if result.Valid || findCheckIn(result.Checks, "witnesses").Passed {
+		t.Error("bundle without cosignatures should fail the witness check")
+	}
+	b.cps[1] = *cp
+	if result, _ = VerifyBundle(b.export(t), opts); result.Valid {
+		t.Error("bundle with an unwitnessed checkpoint should not verify")
+	}
+	c0, _ := CosignCheckpoint(&b.cps[0], auditor, "auditor")
+	c0, _ = CosignCheckpoint(c0, other, "auditor")
+	b.cps[0] = *c0
+	if result, _ = VerifyBundle(b.export(t), opts); !result.Valid {
+		t.Errorf("cosigned bundle should verify: %+v", result.Checks)
+	}
+
+	var buf bytes.Buffer
+	writeJSONL(&buf, b.entries)
+	if _, err := ReadJSONL(bytes.NewReader(buf.Bytes()), &ReadJSONLOptions{PublicKey: b.agent.PublicKey, Checkpoints: b.cps, Witnesses: policy}, nil); err != nil {
+		t.Errorf("ReadJSONL() with witnessed checkpoints: %v", err)
+	}
+	bare := []LogCheckpoint{b.cps[1]}
+	bare[0].Cosignatures = nil
+	if _, err := ReadJSONL(bytes.NewReader(buf.Bytes()), &ReadJSONLOptions{PublicKey: b.agent.PublicKey, Checkpoints: bare, Witnesses: policy}, nil); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("ReadJSONL() unwitnessed checkpoint code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+}
+
+func TestFileLogCheckpoints(t *testing.T) {
+	b := newTestBundle(t)
+	auditor, _ := GenerateKeyPair()
+	log, err := OpenFileLog(&FileLogOptions{Dir: t.TempDir(), Covenant: b.doc, Agent: b.agent})
+	if err != nil {
+		t.Fatalf("OpenFileLog() error: %v", err)
+	}
+	defer log.Close()
+	log.Append("read", "/data/report", nil, OutcomeExecuted)
+	log.Append("read", "/data/report", nil, OutcomeExecuted)
+	cp, _ := log.Checkpoint()
+	if err := log.StoreCheckpoint(cp); err != nil {
+		t.Fatalf("StoreCheckpoint() error: %v", err)
+	}
+	cosigned, _ := CosignCheckpoint(cp, auditor, "auditor")
+	if err := log.StoreCheckpoint(cosigned); err != nil {
+		t.Fatalf("StoreCheckpoint() error: %v", err)
+	}
+	if err := log.StoreCheckpoint(&b.cps[0]); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("foreign checkpoint code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+	log.Append("read", "/data/report", nil, OutcomeExecuted)
+
+	cps, err := log.Checkpoints()
+	if err != nil || len(cps) != 1 || len(cps[0].Cosignatures) != 1 {
+		t.Fatalf("Checkpoints() = %+v, %v", cps, err)
+	}
+	if err := VerifyCheckpointWitnesses(&cps[0], &WitnessPolicy{Witnesses: []string{auditor.PublicKeyHex}, Quorum: 1}); err != nil {
+		t.Errorf("stored cosignature: %v", err)
+	}
+}
+
+func TestGenerateComplianceReport(t *testing.T) {
+	requireReflectJSON(t)
+	b := newTestBundle(t)
+	auditor, _ := GenerateKeyPair()
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	log.Append("read", "/data/report", nil, OutcomeExecuted)
+	log.Append("read", "/data/summary", nil, OutcomeExecuted)
+
+	report, err := GenerateComplianceReport(b.doc, log, auditor)
+	if err != nil {
+		t.Fatalf("GenerateComplianceReport() error: %v", err)
+	}
+	if !report.Compliant || len(report.Checks) != 3 || report.Period == nil || report.Period.LastIndex != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if len(report.Checkpoints) != 1 || report.Checkpoints[0].HeadHash != log.Head() {
+		t.Errorf("report checkpoints = %+v", report.Checkpoints)
+	}
+	if err := VerifyComplianceReport(report); err != nil {
+		t.Fatalf("VerifyComplianceReport() error: %v", err)
+	}
+
+	serialized, err := SerializeComplianceReport(report)
+	if err != nil {
+		t.Fatalf("SerializeComplianceReport() error: %v", err)
+	}
+	parsed, err := ParseComplianceReport([]byte(serialized))
+	if err != nil || parsed.ID != report.ID {
+		t.Fatalf("ParseComplianceReport() = %+v, %v", parsed, err)
+	}
+	tampered := strings.Replace(serialized, `"compliant":true`, `"compliant":false`, 1)
+	if _, err := ParseComplianceReport([]byte(tampered)); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("tampered report code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+	forged := *report
+	forged.VerifierPublicKey = b.issuer.PublicKeyHex
+	forged.ID = ""
+	payload, _ := complianceReportPayload(&forged)
+	forged.ID = SHA256Hex(payload)
+	if err := VerifyComplianceReport(&forged); CodeOf(err) != ErrCodeCrypto {
+		t.Errorf("forged report code = %q, want %q", CodeOf(err), ErrCodeCrypto)
+	}
+
+	// Violations are recorded, not returned as errors.
+	log.Append("write", "/data/report", nil, OutcomeExecuted)
+	report, err = GenerateComplianceReport(b.doc, log, auditor)
+	if err != nil {
+		t.Fatalf("GenerateComplianceReport() error: %v", err)
+	}
+	if c := findCheckIn(report.Checks, "compliance"); report.Compliant || c == nil || c.Passed || len(report.Compliance.Violations) != 1 {
+		t.Errorf("non-compliant report = %+v", report)
+	}
+	if err := VerifyComplianceReport(report); err != nil {
+		t.Errorf("VerifyComplianceReport() error: %v", err)
+	}
+
+	other := newTestBundle(t)
+	if _, err := GenerateComplianceReport(other.doc, log, auditor); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("mismatched covenant code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+func TestReputation(t *testing.T) {
+	requireReflectJSON(t)
+	b := newTestBundle(t)
+	auditor, _ := GenerateKeyPair()
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	log.Append("read", "/data/report", nil, OutcomeExecuted)
+	report, err := GenerateComplianceReport(b.doc, log, auditor)
+	if err != nil {
+		t.Fatalf("GenerateComplianceReport() error: %v", err)
+	}
+
+	at := time.Now().UTC().Add(time.Hour)
+	start := at.Add(-48 * time.Hour)
+	earned, err := ReputationEventFromReport(b.identity, report, auditor)
+	if err != nil {
+		t.Fatalf("ReputationEventFromReport() error: %v", err)
+	}
+	if earned.Type != ReputationCompliance || earned.Delta != 1 || earned.Evidence != report.ID {
+		t.Errorf("unexpected event from report: %+v", earned)
+	}
+	old, _ := IssueReputationEvent(b.identity, auditor, &ReputationEventOptions{
+		Type: ReputationAttestation, Delta: 4, Timestamp: start,
+	})
+
+	// After a model update, earlier reputation carries forward at 0.8.
+	evolved, err := EvolveIdentity(b.identity, &EvolveIdentityOptions{
+		OperatorKeyPair: b.issuer,
+		ChangeType:      "model_update",
+		Description:     "model-2",
+		Model:           &ModelAttestation{Provider: "example", ModelID: "model-2"},
+	})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	penalty, _ := IssueReputationEvent(evolved, auditor, &ReputationEventOptions{Type: ReputationViolation, Delta: -1})
+
+	rep := NewReputation(&ReputationPolicy{HalfLife: 24 * time.Hour, Issuers: []string{auditor.PublicKeyHex}})
+	for _, e := range []*ReputationEvent{earned, old, penalty, old} {
+		if err := rep.Record(e); err != nil {
+			t.Fatalf("Record() error: %v", err)
+		}
+	}
+	stranger, _ := GenerateKeyPair()
+	untrusted, _ := IssueReputationEvent(evolved, stranger, &ReputationEventOptions{Type: ReputationAttestation, Delta: 100})
+	if err := rep.Record(untrusted); err == nil {
+		t.Error("Record() should refuse events from untrusted issuers")
+	}
+	tampered := *penalty
+	tampered.Delta = 1
+	if err := rep.Record(&tampered); err == nil {
+		t.Error("Record() should refuse tampered events")
+	}
+
+	score, err := rep.Score(evolved, at)
+	if err != nil {
+		t.Fatalf("Score() error: %v", err)
+	}
+	if len(score.Evidence) != 3 {
+		t.Fatalf("score has %d events, want 3", len(score.Evidence))
+	}
+	// 4 * 0.25 (two half-lives) * 0.8, plus about 1 * 0.8 and -1 decayed
+	// by an hour.
+	if first := score.Evidence[0]; first.Event.ID != old.ID || first.Decay != 0.25 || first.CarryForward != 0.8 {
+		t.Errorf("oldest evidence = %+v", first)
+	}
+	if score.Score < 0.55 || score.Score > 0.65 {
+		t.Errorf("score = %f, want about 0.6", score.Score)
+	}
+	if err := VerifyReputationScore(evolved, score); err != nil {
+		t.Fatalf("VerifyReputationScore() error: %v", err)
+	}
+
+	// The original version has not lost the later penalty's reputation.
+	if original, _ := rep.Score(b.identity, at); len(original.Evidence) != 2 {
+		t.Errorf("original version score has %d events, want 2", len(original.Evidence))
+	}
+
+	inflated := *score
+	inflated.Score += 1
+	if err := VerifyReputationScore(evolved, &inflated); err == nil {
+		t.Error("VerifyReputationScore() should reject an inflated score")
+	}
+	undecayed := *score
+	undecayed.Evidence = append([]ReputationEvidence(nil), score.Evidence...)
+	undecayed.Evidence[0].Decay = 1
+	if err := VerifyReputationScore(evolved, &undecayed); err == nil {
+		t.Error("VerifyReputationScore() should reject incorrect decay")
+	}
+}
+
+func TestActionReceipts(t *testing.T) {
+	b := newTestBundle(t)
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	var receipts []*ActionReceipt
+	for i := 0; i < 5; i++ {
+		e, _ := log.Append("read", "/data/report", map[string]interface{}{"i": i}, OutcomeExecuted)
+		r, err := IssueActionReceipt(&e, b.agent)
+		if err != nil {
+			t.Fatalf("IssueActionReceipt() error: %v", err)
+		}
+		receipts = append(receipts, r)
+	}
+	if err := VerifyActionReceipt(receipts[2]); err != nil {
+		t.Errorf("VerifyActionReceipt() error: %v", err)
+	}
+
+	cp, _ := log.Checkpoint()
+	for i, r := range receipts {
+		proof, err := log.InclusionProof(int64(i), cp.Size)
+		if err != nil {
+			t.Fatalf("InclusionProof() error: %v", err)
+		}
+		if err := VerifyReceiptInclusion(r, cp, proof); err != nil {
+			t.Errorf("VerifyReceiptInclusion(%d) error: %v", i, err)
+		}
+	}
+
+	proof, _ := log.InclusionProof(1, cp.Size)
+	forged := *receipts[1]
+	forged.Outcome = OutcomeDenied
+	if err := VerifyReceiptInclusion(&forged, cp, proof); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("altered receipt code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+	// A receipt for an entry the published log does not contain fails.
+	other, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	e, _ := other.Append("read", "/data/elsewhere", nil, OutcomeExecuted)
+	r, _ := IssueActionReceipt(&e, b.agent)
+	proof, _ = log.InclusionProof(0, cp.Size)
+	if err := VerifyReceiptInclusion(r, cp, proof); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("unlogged receipt code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+
+	if _, err := IssueActionReceipt(&e, b.issuer); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("receipt signed by another key code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+	if _, err := log.InclusionProof(5, 5); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("out of range proof code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+func TestLogStores(t *testing.T) {
+	fileStore, err := NewFileLogStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileLogStore() error: %v", err)
+	}
+	fileStore.segmentSize = 1024
+	kv, err := OpenKVStore(t.TempDir() + "/grith.kv")
+	if err != nil {
+		t.Fatalf("OpenKVStore() error: %v", err)
+	}
+	defer kv.Close()
+	for name, store := range map[string]LogStore{"memory": NewMemoryLogStore(), "file": fileStore, "kv": kv.Logs()} {
+		t.Run(name, func(t *testing.T) {
+			b := newTestBundle(t)
+			id := b.doc.ID
+			if n, err := store.Len(id); err != nil || n != 0 {
+				t.Fatalf("Len() of empty log = %d, %v", n, err)
+			}
+			if err := store.Append(id, b.entries[:2]...); err != nil {
+				t.Fatalf("Append() error: %v", err)
+			}
+			if err := store.Append(id, b.entries[3:]...); CodeOf(err) != ErrCodeActionLog {
+				t.Errorf("gap code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+			}
+			forged := b.entries[2]
+			forged.Resource = "/data/secret"
+			if err := store.Append(id, forged); CodeOf(err) != ErrCodeActionLog {
+				t.Errorf("altered entry code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+			}
+			if err := store.Append(id, b.entries[2:]...); err != nil {
+				t.Fatalf("Append() error: %v", err)
+			}
+
+			if n, _ := store.Len(id); n != int64(len(b.entries)) {
+				t.Errorf("Len() = %d, want %d", n, len(b.entries))
+			}
+			entries, err := store.Range(id, 1, 4)
+			if err != nil || len(entries) != 3 || entries[0].Index != 1 || entries[2].Hash != b.entries[3].Hash {
+				t.Fatalf("Range(1, 4) = %+v, %v", entries, err)
+			}
+			if err := VerifyActionLogSegment(entries, b.agent.PublicKey, b.entries[0].Hash); err != nil {
+				t.Errorf("ranged entries do not verify: %v", err)
+			}
+			if _, err := store.Range(id, 2, 9); CodeOf(err) != ErrCodeInvalidInput {
+				t.Errorf("out of range code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+			}
+
+			if cp, err := store.LatestCheckpoint(id); err != nil || cp != nil {
+				t.Errorf("LatestCheckpoint() before any = %+v, %v", cp, err)
+			}
+			for i := range b.cps {
+				if err := store.PutCheckpoint(&b.cps[i]); err != nil {
+					t.Fatalf("PutCheckpoint() error: %v", err)
+				}
+			}
+			witness, _ := GenerateKeyPair()
+			cosigned, _ := CosignCheckpoint(&b.cps[1], witness, "auditor")
+			store.PutCheckpoint(cosigned)
+			if cp, err := store.LatestCheckpoint(id); err != nil || cp.Size != b.cps[1].Size || len(cp.Cosignatures) != 1 {
+				t.Errorf("LatestCheckpoint() = %+v, %v", cp, err)
+			}
+			other := newTestBundle(t)
+			if err := store.PutCheckpoint(&other.cps[0]); CodeOf(err) != ErrCodeActionLog {
+				t.Errorf("checkpoint over unstored log code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+			}
+
+			store.Append(other.doc.ID, other.entries...)
+			ids, err := store.Covenants()
+			want := []string{id, other.doc.ID}
+			if want[0] > want[1] {
+				want[0], want[1] = want[1], want[0]
+			}
+			if err != nil || strings.Join(ids, ",") != strings.Join(want, ",") {
+				t.Errorf("Covenants() = %v, %v, want %v", ids, err, want)
+			}
+		})
+	}
+}
+
+func TestFileLogStoreReopen(t *testing.T) {
+	b := newTestBundle(t)
+	dir := t.TempDir()
+	store, _ := NewFileLogStore(dir)
+	store.segmentSize = 1024
+	if err := store.Append(b.doc.ID, b.entries...); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+
+	// A torn tail is dropped when another store opens the log.
+	segments, _ := listSegments(dir + "/" + b.doc.ID)
+	if len(segments) < 2 {
+		t.Fatalf("expected several segments, got %v", segments)
+	}
+	f, _ := os.OpenFile(segmentPath(dir+"/"+b.doc.ID, segments[len(segments)-1]), os.O_WRONLY|os.O_APPEND, 0o600)
+	f.WriteString(`{"index":5,`)
+	f.Close()
+
+	reopened, _ := NewFileLogStore(dir)
+	if n, err := reopened.Len(b.doc.ID); err != nil || n != int64(len(b.entries)) {
+		t.Fatalf("Len() after reopen = %d, %v", n, err)
+	}
+	entries, err := reopened.Range(b.doc.ID, 0, int64(len(b.entries)))
+	if err != nil || VerifyActionLogSegment(entries, b.agent.PublicKey, ActionLogGenesisHash) != nil {
+		t.Errorf("Range() after reopen = %d entries, %v", len(entries), err)
+	}
+	more := buildTestActionLog(t, b.doc, b.agent, b.entries, 1)
+	if err := reopened.Append(b.doc.ID, more[len(b.entries):]...); err != nil {
+		t.Errorf("Append() after repair error: %v", err)
+	}
+	if _, err := reopened.Len("../escape"); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("path-like covenant ID code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+func TestQueryActionLog(t *testing.T) {
+	b := newTestBundle(t)
+	store := NewMemoryLogStore()
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	log.Append("read", "/data/a", nil, OutcomeExecuted)
+	log.Append("write", "/data/a", nil, OutcomeDenied)
+	log.Append("read", "/data/b/c", nil, OutcomeExecuted)
+	log.Append("read", "/other", nil, OutcomeExecuted)
+	store.Append(b.doc.ID, log.Entries()...)
+	cp, _ := log.Checkpoint()
+	store.PutCheckpoint(cp)
+	log.Append("read", "/data/d", nil, OutcomeExecuted)
+	store.Append(b.doc.ID, log.Entries()[4])
+
+	result, err := QueryActionLog(store, &LogQuery{CovenantID: b.doc.ID, Action: "read", Resource: "/data/**"})
+	if err != nil {
+		t.Fatalf("QueryActionLog() error: %v", err)
+	}
+	if len(result.Matches) != 3 || result.Scanned != 5 || result.Truncated {
+		t.Fatalf("matches = %+v, scanned %d", result.Matches, result.Scanned)
+	}
+	for i, want := range []int64{0, 2, 4} {
+		if got := result.Matches[i].Entry.Index; got != want {
+			t.Errorf("match %d is entry %d, want %d", i, got, want)
+		}
+	}
+	for _, m := range result.Matches[:2] {
+		r, _ := IssueActionReceipt(&m.Entry, b.agent)
+		if m.Proof == nil || VerifyReceiptInclusion(r, result.Checkpoint, m.Proof) != nil {
+			t.Errorf("match %d does not verify against the checkpoint", m.Entry.Index)
+		}
+	}
+	if result.Matches[2].Proof != nil {
+		t.Error("entry after the checkpoint should have no proof")
+	}
+
+	result, _ = QueryActionLog(store, &LogQuery{CovenantID: b.doc.ID, Outcome: OutcomeDenied})
+	if len(result.Matches) != 1 || result.Matches[0].Entry.Action != "write" {
+		t.Errorf("outcome query = %+v", result.Matches)
+	}
+	result, _ = QueryActionLog(store, &LogQuery{CovenantID: b.doc.ID, Limit: 2})
+	if len(result.Matches) != 2 || !result.Truncated {
+		t.Errorf("limited query = %d matches, truncated %v", len(result.Matches), result.Truncated)
+	}
+	future := time.Now().Add(time.Hour)
+	result, _ = QueryActionLog(store, &LogQuery{CovenantID: b.doc.ID, Since: future})
+	if len(result.Matches) != 0 {
+		t.Errorf("future time range matched %d entries", len(result.Matches))
+	}
+	result, _ = QueryActionLog(store, &LogQuery{CovenantID: b.doc.ID, Until: future})
+	if len(result.Matches) != 5 {
+		t.Errorf("time range matched %d entries, want 5", len(result.Matches))
+	}
+	if _, err := QueryActionLog(store, &LogQuery{}); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("query without covenant code = %q, want %q", CodeOf(err), ErrCodeMissingField)
+	}
+}
+
+// clockAnchor attests every digest it stamps at a fixed time.
+type clockAnchor struct{ at time.Time }
+
+func (clockAnchor) Type() string { return "clock" }
+
+func (a clockAnchor) Stamp(digest []byte) ([]byte, error) {
+	return []byte(ToHex(digest) + "@" + a.at.Format(time.RFC3339)), nil
+}
+
+func (clockAnchor) Upgrade(digest, proof []byte) ([]byte, error) { return proof, nil }
+
+func (clockAnchor) Verify(digest, proof []byte) (*AnchorAttestation, error) {
+	parts := strings.SplitN(string(proof), "@", 2)
+	if len(parts) != 2 || parts[0] != ToHex(digest) {
+		return nil, errorf(ErrCodeAnchor, "clock proof does not match digest")
+	}
+	at, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return &AnchorAttestation{Type: "clock", Complete: true, Time: at}, nil
+}
+
+func TestCheckpointAnchoring(t *testing.T) {
+	b := newTestBundle(t)
+	soon := clockAnchor{at: time.Now().Add(time.Minute)}
+	policy := &AnchoringPolicy{Anchors: []Anchor{clockAnchor{}}, MaxGap: 10 * time.Minute}
+
+	cp, err := AnchorCheckpoint(&b.cps[1], soon)
+	if err != nil {
+		t.Fatalf("AnchorCheckpoint() error: %v", err)
+	}
+	if len(b.cps[1].Anchors) != 0 || VerifyLogCheckpoint(cp) != nil {
+		t.Fatal("anchoring should copy the checkpoint and leave its signature valid")
+	}
+	witness, _ := GenerateKeyPair()
+	cp, _ = CosignCheckpoint(cp, witness, "auditor")
+	atts, err := VerifyCheckpointAnchors(cp, clockAnchor{})
+	if err != nil || len(atts) != 1 || !atts[0].Complete {
+		t.Fatalf("VerifyCheckpointAnchors() = %+v, %v", atts, err)
+	}
+	if err := VerifyLogAnchoring(b.entries, []LogCheckpoint{*cp}, policy); err != nil {
+		t.Errorf("VerifyLogAnchoring() error: %v", err)
+	}
+
+	// Anchoring too late, or not at all, fails once the gap has passed.
+	late, _ := AnchorCheckpoint(&b.cps[1], clockAnchor{at: time.Now().Add(time.Hour)})
+	if err := VerifyLogAnchoring(b.entries, []LogCheckpoint{*late}, policy); CodeOf(err) != ErrCodeAnchor {
+		t.Errorf("late anchor code = %q, want %q", CodeOf(err), ErrCodeAnchor)
+	}
+	if err := VerifyLogAnchoring(b.entries, b.cps, policy); err != nil {
+		t.Errorf("recent unanchored entries should be exempt: %v", err)
+	}
+	later := *policy
+	later.Now = time.Now().Add(time.Hour)
+	if err := VerifyLogAnchoring(b.entries, b.cps, &later); CodeOf(err) != ErrCodeAnchor {
+		t.Errorf("unanchored entries code = %q, want %q", CodeOf(err), ErrCodeAnchor)
+	}
+
+	// A proof for one checkpoint does not vouch for another.
+	moved := *cp
+	moved.Size, moved.HeadHash = b.cps[0].Size, b.cps[0].HeadHash
+	moved.Anchors = cp.Anchors
+	if _, err := VerifyCheckpointAnchors(&moved, clockAnchor{}); CodeOf(err) != ErrCodeAnchor {
+		t.Errorf("moved anchor code = %q, want %q", CodeOf(err), ErrCodeAnchor)
+	}
+
+	b.cps = []LogCheckpoint{b.cps[0], *cp}
+	result, _ := VerifyBundle(b.export(t), &BundleVerifyOptions{Anchoring: &later})
+	if check := findCheckIn(result.Checks, "anchoring"); check == nil || !check.Passed || !result.Valid {
+		t.Errorf("anchored bundle checks = %+v", result.Checks)
+	}
+	b.cps[1] = *late
+	result, _ = VerifyBundle(b.export(t), &BundleVerifyOptions{Anchoring: &later})
+	if check := findCheckIn(result.Checks, "anchoring"); check == nil || check.Passed || result.Valid {
+		t.Errorf("late-anchored bundle checks = %+v", result.Checks)
+	}
+}
+
+func TestVerifyLogStream(t *testing.T) {
+	b := newTestBundle(t)
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: b.doc, Agent: b.agent})
+	for i := 0; i < 25; i++ {
+		action := "read"
+		if i%10 == 9 {
+			action = "write"
+		}
+		log.Append(action, "/data/report", map[string]interface{}{"i": i}, OutcomeExecuted)
+	}
+	cp, _ := log.Checkpoint()
+	var buf bytes.Buffer
+	log.WriteJSONL(&buf)
+	data := buf.Bytes()
+
+	var reports []StreamProgress
+	result, err := VerifyLogStream(bytes.NewReader(data), &StreamVerifyOptions{
+		Covenant:         b.doc,
+		Read:             ReadJSONLOptions{Checkpoints: []LogCheckpoint{*cp}},
+		Progress:         func(p StreamProgress) { reports = append(reports, p) },
+		ProgressInterval: 10,
+	})
+	if err != nil {
+		t.Fatalf("VerifyLogStream() error: %v", err)
+	}
+	if result.Log.Entries != 25 || result.Log.Root != cp.Root {
+		t.Errorf("log result = %+v", result.Log)
+	}
+	if result.Compliance.Compliant || result.Compliance.Entries != 25 || len(result.Compliance.Violations) != 2 || result.Compliance.Violations[1].Index != 19 {
+		t.Errorf("compliance = %+v", result.Compliance)
+	}
+	if len(reports) != 3 || reports[0].Entries != 10 || reports[0].Violations != 1 || !reports[2].Done || reports[2].Bytes != int64(len(data)) {
+		t.Errorf("progress = %+v", reports)
+	}
+
+	// Findings beyond MaxFindings are counted, not kept.
+	result, _ = VerifyLogStream(bytes.NewReader(data), &StreamVerifyOptions{Covenant: b.doc, Replay: ReplayOptions{MaxFindings: 1}})
+	if len(result.Compliance.Violations) != 1 || result.Compliance.Omitted != 1 || result.Compliance.Compliant {
+		t.Errorf("bounded compliance = %+v", result.Compliance)
+	}
+
+	tampered := bytes.Replace(data, []byte(`"write"`), []byte(`"read"`), 1)
+	if _, err := VerifyLogStream(bytes.NewReader(tampered), &StreamVerifyOptions{Covenant: b.doc}); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("tampered stream code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+	if _, err := VerifyLogStream(bytes.NewReader(data), nil); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("missing covenant code = %q, want %q", CodeOf(err), ErrCodeMissingField)
+	}
+}
+
+func TestCompactLineage(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+	kp2, _ := GenerateKeyPair()
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair: kp,
+		Model:           ModelAttestation{Provider: "anthropic", ModelID: "claude-3"},
+		Capabilities:    []string{"read"},
+		Deployment:      DeploymentContext{Runtime: RuntimeContainer},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	registry, _ := NewIdentityRegistry(NewMemoryIdentityStore())
+	versions := []*AgentIdentity{identity}
+	v1, err := EvolveIdentity(identity, &EvolveIdentityOptions{OperatorKeyPair: kp, ChangeType: "model_update", Description: "upgrade", Model: &ModelAttestation{Provider: "anthropic", ModelID: "claude-3", ModelVersion: "2"}})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	v2, err := RotateOperatorKey(v1, kp, kp2)
+	if err != nil {
+		t.Fatalf("RotateOperatorKey() error: %v", err)
+	}
+	versions = append(versions, v1, v2)
+	for i := 0; i < 3; i++ {
+		next, err := EvolveIdentity(versions[len(versions)-1], &EvolveIdentityOptions{OperatorKeyPair: kp2, ChangeType: "merge", Description: "tweak"})
+		if err != nil {
+			t.Fatalf("EvolveIdentity() error: %v", err)
+		}
+		versions = append(versions, next)
+	}
+	for _, v := range versions {
+		if err := registry.Register(v); err != nil {
+			t.Fatalf("Register() error: %v", err)
+		}
+	}
+	latest := versions[len(versions)-1]
+	revocation, _ := RevokeIdentity(v1, kp, &RevokeIdentityOptions{Reason: RevocationDecommissioned})
+
+	compacted, pruned, err := CompactLineage(latest, &CompactLineageOptions{OperatorKeyPair: kp2, Keep: 2})
+	if err != nil {
+		t.Fatalf("CompactLineage() error: %v", err)
+	}
+	summary := compacted.Lineage[0].Summary
+	if len(compacted.Lineage) != 3 || len(pruned) != 4 || summary == nil || summary.Count != 4 || summary.Length != 4 {
+		t.Fatalf("compacted lineage = %+v, %d pruned", compacted.Lineage, len(pruned))
+	}
+	if summary.RootHash != identity.Lineage[0].IdentityHash || !slices.Contains(summary.RotatedKeys, kp.PublicKeyHex) {
+		t.Errorf("summary = %+v", summary)
+	}
+	if got, want := ComputeEffectiveCarryForward(compacted), ComputeEffectiveCarryForward(latest); got != want {
+		t.Errorf("effective carry-forward = %v, want %v", got, want)
+	}
+	if result, _ := VerifyIdentity(compacted); !result.Valid {
+		t.Fatalf("compacted identity should verify: %s", failedCheckNames(result.Checks))
+	}
+	if compacted.Version != latest.Version+1 || lineageLength(compacted) != len(latest.Lineage)+1 {
+		t.Errorf("version = %d, length = %d", compacted.Version, lineageLength(compacted))
+	}
+
+	// Pruned entries remain provable one at a time or as a whole.
+	proof, err := ProveLineageEntry(pruned, 1)
+	if err != nil {
+		t.Fatalf("ProveLineageEntry() error: %v", err)
+	}
+	if err := VerifyLineageEntryProof(compacted, &pruned[1], proof); err != nil {
+		t.Errorf("VerifyLineageEntryProof() error: %v", err)
+	}
+	if err := VerifyLineageEntryProof(compacted, &pruned[2], proof); err == nil {
+		t.Error("VerifyLineageEntryProof() should reject a different entry")
+	}
+	if err := VerifyPrunedLineage(compacted, pruned); err != nil {
+		t.Errorf("VerifyPrunedLineage() error: %v", err)
+	}
+	if err := VerifyPrunedLineage(compacted, pruned[1:]); err == nil {
+		t.Error("VerifyPrunedLineage() should reject a partial history")
+	}
+
+	// The registry accepts the compaction and its evolutions as the same
+	// agent, and a decommissioning of a pruned version still applies.
+	if err := registry.Register(compacted); err != nil {
+		t.Fatalf("Register(compacted) error: %v", err)
+	}
+	evolved, err := EvolveIdentity(compacted, &EvolveIdentityOptions{OperatorKeyPair: kp2, ChangeType: "merge", Description: "tweak"})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	if err := registry.Register(evolved); err != nil {
+		t.Fatalf("Register(evolved) error: %v", err)
+	}
+	if resolved, _ := registry.Resolve(identity.ID); resolved == nil || resolved.ID != evolved.ID {
+		t.Error("Resolve() should return the evolution of the compacted identity")
+	}
+	if result, _ := VerifyIdentityWithOptions(evolved, &IdentityVerifyOptions{Revocations: []IdentityRevocation{*revocation}}); result.Valid {
+		t.Error("decommissioning of a pruned version should apply to the compacted identity")
+	}
+
+	// Compactions nest.
+	again, pruned2, err := CompactLineage(evolved, &CompactLineageOptions{OperatorKeyPair: kp2, Keep: 1})
+	if err != nil {
+		t.Fatalf("nested CompactLineage() error: %v", err)
+	}
+	if again.Lineage[0].Summary.Length != 7 || lineageLength(again) != lineageLength(evolved)+1 {
+		t.Errorf("nested summary = %+v", again.Lineage[0].Summary)
+	}
+	if err := VerifyPrunedLineage(again, pruned2); err != nil {
+		t.Errorf("nested VerifyPrunedLineage() error: %v", err)
+	}
+	if err := registry.Register(again); err != nil {
+		t.Errorf("Register(nested) error: %v", err)
+	}
+
+	// Kept entries cannot change operators, and the summary is signed.
+	if _, _, err := CompactLineage(v2, &CompactLineageOptions{OperatorKeyPair: kp2, Keep: 1}); err == nil {
+		t.Error("CompactLineage() should refuse to keep a key rotation")
+	}
+	if _, _, err := CompactLineage(latest, &CompactLineageOptions{OperatorKeyPair: kp2, Keep: 5}); err == nil {
+		t.Error("CompactLineage() should prune at least two entries")
+	}
+	if _, err := EvolveIdentity(latest, &EvolveIdentityOptions{OperatorKeyPair: kp2, ChangeType: ChangeCompacted, Description: "x"}); err == nil {
+		t.Error("EvolveIdentity() should refuse the compacted change type")
+	}
+	tampered, _ := deepCopyIdentity(compacted)
+	tampered.Lineage[0].Summary.CarryForward = 1
+	tampered.Lineage[0].ReputationCarryForward = 1
+	if result, _ := VerifyIdentity(tampered); result.Valid || findCheckIn(result.Checks, "lineage_integrity").Passed {
+		t.Error("a tampered summary should fail lineage_integrity")
+	}
+}
+
+func TestPreRotationCommitments(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+	next, _ := GenerateKeyPair()
+	after, _ := GenerateKeyPair()
+	attacker, _ := GenerateKeyPair()
+	nextCommitment, err := ComputeKeyCommitment(next.PublicKeyHex)
+	if err != nil {
+		t.Fatalf("ComputeKeyCommitment() error: %v", err)
+	}
+	afterCommitment, _ := ComputeKeyCommitment(after.PublicKeyHex)
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair:   kp,
+		Model:             ModelAttestation{Provider: "anthropic", ModelID: "claude-3"},
+		Capabilities:      []string{"read"},
+		Deployment:        DeploymentContext{Runtime: RuntimeContainer},
+		NextKeyCommitment: nextCommitment,
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	if identity.NextKeyCommitment != nextCommitment || identity.Lineage[0].NextKeyCommitment != nextCommitment {
+		t.Fatalf("commitment not recorded: %+v", identity)
+	}
+
+	// A holder of the current key alone cannot rotate away or replace
+	// the commitment.
+	if _, err := RotateOperatorKey(identity, kp, attacker); err == nil {
+		t.Error("RotateOperatorKey() should require the committed key")
+	}
+	if _, err := EvolveIdentity(identity, &EvolveIdentityOptions{OperatorKeyPair: kp, ChangeType: "merge", Description: "recommit", NextKeyCommitment: afterCommitment}); err == nil {
+		t.Error("EvolveIdentity() should not replace a key commitment")
+	}
+	if _, err := EvolveIdentity(identity, &EvolveIdentityOptions{OperatorKeyPair: kp, ChangeType: "operator_transfer", Description: "transfer", OperatorPublicKey: attacker.PublicKeyHex}); err == nil {
+		t.Error("EvolveIdentity() should not transfer a committed identity")
+	}
+
+	evolved, err := EvolveIdentity(identity, &EvolveIdentityOptions{OperatorKeyPair: kp, ChangeType: "merge", Description: "tweak"})
+	if err != nil {
+		t.Fatalf("EvolveIdentity() error: %v", err)
+	}
+	rotated, err := RotateOperatorKeyWithOptions(evolved, &RotateOperatorKeyOptions{OldKeyPair: kp, NewKeyPair: next, NextKeyCommitment: afterCommitment})
+	if err != nil {
+		t.Fatalf("RotateOperatorKeyWithOptions() error: %v", err)
+	}
+	if result, _ := VerifyIdentity(rotated); !result.Valid {
+		t.Fatalf("rotated identity should verify: %s", failedCheckNames(result.Checks))
+	}
+	if rotated.NextKeyCommitment != afterCommitment {
+		t.Errorf("next commitment = %q", rotated.NextKeyCommitment)
+	}
+	final, err := RotateOperatorKey(rotated, next, after)
+	if err != nil {
+		t.Fatalf("RotateOperatorKey() error: %v", err)
+	}
+	if result, _ := VerifyIdentity(final); !result.Valid || final.NextKeyCommitment != "" {
+		t.Error("rotation without a new commitment should end pre-rotation")
+	}
+
+	// Lineages that skip the commitment fail verification.
+	tampered, _ := deepCopyIdentity(rotated)
+	tampered.NextKeyCommitment = ""
+	tampered.ID, _ = computeIdentityHash(tampered)
+	payload, _ := identitySigningPayload(tampered)
+	sig, _ := Sign([]byte(payload), next.PrivateKey)
+	tampered.Signature = ToHex(sig)
+	if result, _ := VerifyIdentity(tampered); findCheckIn(result.Checks, "lineage_integrity").Passed {
+		t.Error("dropping the key commitment should fail lineage_integrity")
+	}
+	if _, err := CreateIdentity(&CreateIdentityOptions{OperatorKeyPair: kp, Model: ModelAttestation{Provider: "anthropic", ModelID: "claude-3"}, Capabilities: []string{}, NextKeyCommitment: "abc"}); err == nil {
+		t.Error("CreateIdentity() should reject a malformed commitment")
+	}
+
+	// Compaction carries the commitment in force.
+	compacted, pruned, err := CompactLineage(evolved, &CompactLineageOptions{OperatorKeyPair: kp})
+	if err != nil {
+		t.Fatalf("CompactLineage() error: %v", err)
+	}
+	if compacted.Lineage[0].Summary.NextKeyCommitment != nextCommitment || VerifyPrunedLineage(compacted, pruned) != nil {
+		t.Errorf("compaction summary = %+v", compacted.Lineage[0].Summary)
+	}
+	if r, err := RotateOperatorKey(compacted, kp, next); err != nil {
+		t.Errorf("RotateOperatorKey() after compaction error: %v", err)
+	} else if result, _ := VerifyIdentity(r); !result.Valid {
+		t.Errorf("rotation after compaction should verify: %s", failedCheckNames(result.Checks))
+	}
+}
+
+func TestRecoverOperatorKey(t *testing.T) {
+	kp, _ := GenerateKeyPair()
+	newKP, _ := GenerateKeyPair()
+	r1, _ := GenerateKeyPair()
+	r2, _ := GenerateKeyPair()
+	r3, _ := GenerateKeyPair()
+	next, _ := GenerateKeyPair()
+	commitment, _ := ComputeKeyCommitment(next.PublicKeyHex)
+	recovery := &OperatorSet{Keys: []string{r1.PublicKeyHex, r2.PublicKeyHex, r3.PublicKeyHex}, Threshold: 2}
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair:   kp,
+		Model:             ModelAttestation{Provider: "anthropic", ModelID: "claude-3"},
+		Capabilities:      []string{"read"},
+		Deployment:        DeploymentContext{Runtime: RuntimeContainer},
+		Recovery:          recovery,
+		NextKeyCommitment: commitment,
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	registry, _ := NewIdentityRegistry(NewMemoryIdentityStore())
+	_ = registry.Register(identity)
+
+	// Both the operator key and the committed next key are lost.
+	if _, err := RecoverOperatorKey(identity, &RecoverOperatorKeyOptions{RecoveryKeyPairs: []*KeyPair{r1}, NewKeyPair: newKP}); err == nil {
+		t.Error("RecoverOperatorKey() should require a threshold of recovery keys")
+	}
+	recovered, err := RecoverOperatorKey(identity, &RecoverOperatorKeyOptions{RecoveryKeyPairs: []*KeyPair{r1, r3}, NewKeyPair: newKP})
+	if err != nil {
+		t.Fatalf("RecoverOperatorKey() error: %v", err)
+	}
+	entry := recovered.Lineage[1]
+	if entry.ChangeType != ChangeOperatorKeyRecovery || entry.ReputationCarryForward != DefaultEvolutionPolicy().OperatorKeyRecovery || recovered.OperatorPublicKey != newKP.PublicKeyHex {
+		t.Errorf("recovery entry = %+v", entry)
+	}
+	if recovered.NextKeyCommitment != "" || recovered.Recovery == nil {
+		t.Errorf("recovered identity = %+v", recovered)
+	}
+	if result, _ := VerifyIdentity(recovered); !result.Valid {
+		t.Fatalf("recovered identity should verify: %s", failedCheckNames(result.Checks))
+	}
+	if err := registry.Register(recovered); err != nil {
+		t.Errorf("Register(recovered) error: %v", err)
+	}
+	if evolved, err := EvolveIdentity(recovered, &EvolveIdentityOptions{OperatorKeyPair: newKP, ChangeType: "merge", Description: "back in business"}); err != nil {
+		t.Errorf("EvolveIdentity() after recovery error: %v", err)
+	} else if result, _ := VerifyIdentity(evolved); !result.Valid {
+		t.Error("evolution after recovery should verify")
+	}
+
+	// A recovery not signed by the recovery quorum fails verification.
+	forged, _ := deepCopyIdentity(recovered)
+	forged.Lineage[1].Signatures = forged.Lineage[1].Signatures[:1]
+	if result, _ := VerifyIdentity(forged); findCheckIn(result.Checks, "lineage_integrity").Passed {
+		t.Error("an under-signed recovery should fail lineage_integrity")
+	}
+
+	// The operator key cannot swap the recovery keys while a commitment
+	// is in force, and identities without recovery keys cannot recover.
+	if _, err := EvolveIdentity(identity, &EvolveIdentityOptions{OperatorKeyPair: kp, ChangeType: "merge", Description: "swap", Recovery: &OperatorSet{Keys: []string{kp.PublicKeyHex}, Threshold: 1}}); err == nil {
+		t.Error("EvolveIdentity() should not change recovery keys under a key commitment")
+	}
+	plain, err := CreateIdentity(&CreateIdentityOptions{OperatorKeyPair: kp, Model: ModelAttestation{Provider: "anthropic", ModelID: "claude-3"}, Capabilities: []string{}})
+	if err != nil {
+		t.Fatalf("CreateIdentity() error: %v", err)
+	}
+	if _, err := RecoverOperatorKey(plain, &RecoverOperatorKeyOptions{RecoveryKeyPairs: []*KeyPair{r1, r2}, NewKeyPair: newKP}); err == nil {
+		t.Error("RecoverOperatorKey() should require recovery keys")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error: %v", err)
+	}
+	var _ Store = store
+	doc, _ := buildTestCovenant(t)
+	if err := store.Put(doc.ID, doc); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	if err := store.Put("alias", doc); err != nil {
+		t.Fatalf("Put(alias) error: %v", err)
+	}
+	if store.Count() != 2 || !store.Has("alias") {
+		t.Errorf("count = %d", store.Count())
+	}
+	objects, _ := os.ReadDir(dir + "/objects")
+	if len(objects) != 1 {
+		t.Errorf("identical documents should share one object, got %d", len(objects))
+	}
+
+	// Contents survive reopening; deletes keep shared objects.
+	if err := store.Delete("alias"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if err := store.Delete("alias"); CodeOf(err) != ErrCodeNotFound {
+		t.Errorf("second Delete() code = %q", CodeOf(err))
+	}
+	reopened, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	got, err := reopened.Get(doc.ID)
+	if err != nil || got == nil || got.ID != doc.ID || got.Signature != doc.Signature {
+		t.Fatalf("Get() after reopen = %v, %v", got, err)
+	}
+	if missing, err := reopened.Get("missing"); missing != nil || err != nil {
+		t.Errorf("Get(missing) = %v, %v", missing, err)
+	}
+	if docs, err := reopened.List(); err != nil || len(docs) != 1 {
+		t.Errorf("List() = %d docs, %v", len(docs), err)
+	}
+
+	// Corruption is detected on read, and stray files are cleaned up.
+	objects, _ = os.ReadDir(dir + "/objects")
+	path := dir + "/objects/" + objects[0].Name()
+	data, _ := os.ReadFile(path)
+	_ = os.WriteFile(path, bytes.Replace(data, []byte(doc.ID), []byte(strings.Repeat("0", len(doc.ID))), 1), 0o600)
+	if _, err := reopened.Get(doc.ID); CodeOf(err) != ErrCodeStorage {
+		t.Errorf("Get() of a corrupt document code = %q", CodeOf(err))
+	}
+	if _, err := reopened.List(); err == nil {
+		t.Error("List() should report a corrupt document")
+	}
+	_ = os.WriteFile(dir+"/objects/orphan.json", []byte("{}"), 0o600)
+	_ = os.WriteFile(dir+"/.tmp-123", []byte("partial"), 0o600)
+	if _, err := OpenFileStore(dir); err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	if _, err := os.Stat(dir + "/objects/orphan.json"); !os.IsNotExist(err) {
+		t.Error("unreferenced objects should be removed on open")
+	}
+	if _, err := os.Stat(dir + "/.tmp-123"); !os.IsNotExist(err) {
+		t.Error("temporary files should be removed on open")
+	}
+	_ = os.WriteFile(dir+"/index.json", []byte("{not json"), 0o600)
+	if _, err := OpenFileStore(dir); CodeOf(err) != ErrCodeStorage {
+		t.Errorf("corrupt index code = %q", CodeOf(err))
+	}
+}
+
+// fakeSQL is an in-memory database/sql driver that runs the statements
+// SQLStore issues, so that the store's SQL can be tested without a
+// SQLite dependency. It rejects statements it does not know, and fail
+// makes statements starting with a given prefix (or "COMMIT") fail.
+type fakeSQL struct {
+	mu     sync.Mutex
+	tables *fakeSQLTables
+	fail   string
+	ran    []string
+}
+
+// fakeSQLTables holds the database contents. A nil table does not exist.
+type fakeSQLTables struct {
+	migrations []int64
+	covenants  map[string]fakeSQLRow
+	indexes    []string
+}
+
+type fakeSQLRow struct {
+	issuer, beneficiary string
+	expiresAt, parent   driver.Value
+	document            string
+}
+
+func (t *fakeSQLTables) clone() *fakeSQLTables {
+	c := &fakeSQLTables{migrations: slices.Clone(t.migrations), indexes: slices.Clone(t.indexes)}
+	if t.covenants != nil {
+		c.covenants = make(map[string]fakeSQLRow, len(t.covenants))
+		for id, row := range t.covenants {
+			c.covenants[id] = row
+		}
+	}
+	return c
+}
+
+func newFakeSQL() *fakeSQL { return &fakeSQL{tables: &fakeSQLTables{}} }
+
+func (f *fakeSQL) open() *sql.DB { return sql.OpenDB(f) }
+
+// count reports how many statements starting with prefix have run.
+func (f *fakeSQL) count(prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, q := range f.ran {
+		if strings.HasPrefix(q, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeSQL) Connect(context.Context) (driver.Conn, error) { return &fakeSQLConn{db: f}, nil }
+func (f *fakeSQL) Driver() driver.Driver                        { return nil }
+
+// fakeSQLConn runs statements against the database, or against a copy
+// of it while a transaction is open.
+type fakeSQLConn struct {
+	db *fakeSQL
+	tx *fakeSQLTables
+}
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{conn: c, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+func (c *fakeSQLConn) Close() error { return nil }
+
+func (c *fakeSQLConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.tx = c.db.tables.clone()
+	return c, nil
+}
+
+func (c *fakeSQLConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	tx := c.tx
+	c.tx = nil
+	if c.db.fail == "COMMIT" {
+		return errors.New("fake: commit failed")
+	}
+	c.db.tables = tx
+	return nil
+}
+
+func (c *fakeSQLConn) Rollback() error {
+	c.tx = nil
+	return nil
+}
+
+type fakeSQLStmt struct {
+	conn  *fakeSQLConn
+	query string
+}
+
+func (s *fakeSQLStmt) Close() error  { return nil }
+func (s *fakeSQLStmt) NumInput() int { return -1 }
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	n, _, err := s.run(args)
+	return driver.RowsAffected(n), err
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	_, rows, err := s.run(args)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// run executes the statement, returning the rows it affected or selected.
+func (s *fakeSQLStmt) run(args []driver.Value) (int64, *fakeSQLRows, error) {
+	f := s.conn.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := s.query
+	f.ran = append(f.ran, q)
+	if f.fail != "" && strings.HasPrefix(q, f.fail) {
+		return 0, nil, errors.New("fake: statement failed")
+	}
+	t := f.tables
+	if s.conn.tx != nil {
+		t = s.conn.tx
+	}
+	if t.covenants == nil && strings.Contains(q, "grith_covenants") && !strings.HasPrefix(q, "CREATE TABLE grith_covenants") {
+		return 0, nil, errors.New("fake: no such table: grith_covenants")
+	}
+	one := func(v driver.Value) *fakeSQLRows {
+		return &fakeSQLRows{cols: []string{"v"}, rows: [][]driver.Value{{v}}}
+	}
+
+	switch {
+	case q == "CREATE TABLE IF NOT EXISTS grith_schema_migrations (version INTEGER PRIMARY KEY)":
+		if t.migrations == nil {
+			t.migrations = []int64{}
+		}
+		return 0, nil, nil
+	case q == "SELECT COALESCE(MAX(version), 0) FROM grith_schema_migrations":
+		if t.migrations == nil {
+			return 0, nil, errors.New("fake: no such table: grith_schema_migrations")
+		}
+		var version int64
+		for _, v := range t.migrations {
+			version = max(version, v)
+		}
+		return 0, one(version), nil
+	case q == "INSERT INTO grith_schema_migrations (version) VALUES (?)":
+		if slices.Contains(t.migrations, args[0].(int64)) {
+			return 0, nil, errors.New("fake: UNIQUE constraint failed")
+		}
+		t.migrations = append(t.migrations, args[0].(int64))
+		return 1, nil, nil
+	case strings.HasPrefix(q, "CREATE TABLE grith_covenants "):
+		if t.covenants != nil {
+			return 0, nil, errors.New("fake: table grith_covenants already exists")
+		}
+		t.covenants = map[string]fakeSQLRow{}
+		return 0, nil, nil
+	case strings.HasPrefix(q, "CREATE INDEX "):
+		name := strings.Fields(q)[2]
+		if slices.Contains(t.indexes, name) {
+			return 0, nil, errors.New("fake: index " + name + " already exists")
+		}
+		t.indexes = append(t.indexes, name)
+		return 0, nil, nil
+	case strings.HasPrefix(q, "INSERT INTO grith_covenants (id, issuer, beneficiary, expires_at, chain_parent, document) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO UPDATE SET"):
+		t.covenants[args[0].(string)] = fakeSQLRow{args[1].(string), args[2].(string), args[3], args[4], args[5].(string)}
+		return 1, nil, nil
+	case q == "DELETE FROM grith_covenants WHERE id = ?":
+		if _, ok := t.covenants[args[0].(string)]; !ok {
+			return 0, nil, nil
+		}
+		delete(t.covenants, args[0].(string))
+		return 1, nil, nil
+	case q == "SELECT COUNT(*) FROM grith_covenants":
+		return 0, one(int64(len(t.covenants))), nil
+	case q == "SELECT 1 FROM grith_covenants WHERE id = ?", q == "SELECT document FROM grith_covenants WHERE id = ?":
+		row, ok := t.covenants[args[0].(string)]
+		if !ok {
+			return 0, &fakeSQLRows{cols: []string{"v"}}, nil
+		}
+		if strings.HasPrefix(q, "SELECT 1") {
+			return 0, one(int64(1)), nil
+		}
+		return 0, one(row.document), nil
+	case strings.HasPrefix(q, "SELECT id, document FROM grith_covenants "):
+		return f.selectDocuments(t, strings.TrimPrefix(q, "SELECT id, document FROM grith_covenants "), args)
+	}
+	return 0, nil, errors.New("fake: unsupported statement: " + q)
+}
+
+// selectDocuments runs "[WHERE cond] [ORDER BY id] [LIMIT ?]" over the
+// covenants table, always returning rows in ID order.
+func (f *fakeSQL) selectDocuments(t *fakeSQLTables, clause string, args []driver.Value) (int64, *fakeSQLRows, error) {
+	limit := int64(-1)
+	if rest, ok := strings.CutSuffix(clause, " LIMIT ?"); ok {
+		clause, limit, args = rest, args[len(args)-1].(int64), args[:len(args)-1]
+	}
+	clause, _ = strings.CutSuffix(clause, "ORDER BY id")
+	cond := strings.TrimSpace(strings.TrimPrefix(clause, "WHERE "))
+	var match func(id string, row fakeSQLRow) bool
+	switch cond {
+	case "", "1 = 1":
+		match = func(string, fakeSQLRow) bool { return true }
+	case "id > ?":
+		match = func(id string, _ fakeSQLRow) bool { return id > args[0].(string) }
+	case "issuer = ?":
+		match = func(_ string, r fakeSQLRow) bool { return r.issuer == args[0] }
+	case "beneficiary = ?":
+		match = func(_ string, r fakeSQLRow) bool { return r.beneficiary == args[0] }
+	case "chain_parent = ?":
+		match = func(_ string, r fakeSQLRow) bool { return r.parent != nil && r.parent == args[0] }
+	case "expires_at <= ?":
+		match = func(_ string, r fakeSQLRow) bool {
+			return r.expiresAt != nil && r.expiresAt.(string) <= args[0].(string)
+		}
+	case "id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ") + ")":
+		match = func(id string, _ fakeSQLRow) bool { return slices.Contains(args, driver.Value(id)) }
+	case "json_type(document, ?) IS NOT NULL":
+		key := strings.Trim(strings.TrimPrefix(args[0].(string), "$.metadata."), `"`)
+		match = func(_ string, r fakeSQLRow) bool {
+			var doc struct {
+				Metadata map[string]json.RawMessage `json:"metadata"`
+			}
+			if json.Unmarshal([]byte(r.document), &doc) != nil {
+				return false
+			}
+			_, ok := doc.Metadata[key]
+			return ok
+		}
+	default:
+		return 0, nil, errors.New("fake: unsupported condition: " + cond)
+	}
+	ids := make([]string, 0, len(t.covenants))
+	for id := range t.covenants {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	rows := &fakeSQLRows{cols: []string{"id", "document"}}
+	for _, id := range ids {
+		if int64(len(rows.rows)) == limit {
+			break
+		}
+		if row := t.covenants[id]; match(id, row) {
+			rows.rows = append(rows.rows, []driver.Value{id, row.document})
+		}
+	}
+	return 0, rows, nil
+}
+
+type fakeSQLRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string { return r.cols }
+func (r *fakeSQLRows) Close() error      { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLStore(t *testing.T) {
+	if _, err := NewSQLStore(nil); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("NewSQLStore(nil) code = %q", CodeOf(err))
+	}
+	var _ Store = (*SQLStore)(nil)
+
+	// Indexed columns: party IDs, an expiry that orders as text, and the
+	// chain parent; absent values are NULL.
+	doc, _ := buildTestCovenant(t)
+	issuer, beneficiary, expiresAt, parent := sqlCovenantRow(doc)
+	if issuer != doc.Issuer.ID || beneficiary != doc.Beneficiary.ID {
+		t.Errorf("parties = %q, %q", issuer, beneficiary)
+	}
+	if expiresAt != nil || parent != nil {
+		t.Errorf("absent columns = %v, %v, want nil", expiresAt, parent)
+	}
+	withChain := *doc
+	withChain.ExpiresAt = "2031-02-03T04:05:06+02:00"
+	withChain.Chain = &ChainReference{ParentID: "parent-id", Relation: "delegates", Depth: 1}
+	_, _, expiresAt, parent = sqlCovenantRow(&withChain)
+	if expiresAt != "2031-02-03T02:05:06.000Z" || parent != "parent-id" {
+		t.Errorf("columns = %v, %v", expiresAt, parent)
+	}
+
+	// Against an in-memory driver: migrations apply once and atomically,
+	// queries agree with MemoryStore, and failed writes roll back.
+	fake := newFakeSQL()
+	store, err := NewSQLStore(fake.open())
+	if err != nil {
+		t.Fatalf("NewSQLStore() error: %v", err)
+	}
+	if _, err := NewSQLStore(fake.open()); err != nil {
+		t.Fatalf("second NewSQLStore() error: %v", err)
+	}
+	if v, err := store.SchemaVersion(); err != nil || v != len(sqlMigrations) || fake.count("CREATE TABLE grith_covenants") != 1 {
+		t.Errorf("SchemaVersion() = %d, %v after %d table creations", v, err, fake.count("CREATE TABLE grith_covenants"))
+	}
+	broken := newFakeSQL()
+	broken.fail = "CREATE INDEX grith_covenants_chain_parent"
+	if _, err := NewSQLStore(broken.open()); CodeOf(err) != ErrCodeStorage {
+		t.Errorf("failed migration code = %q", CodeOf(err))
+	}
+	broken.fail = ""
+	if _, err := NewSQLStore(broken.open()); err != nil {
+		t.Errorf("NewSQLStore() after a failed migration error: %v", err)
+	}
+	newer := fake.open()
+	newer.Exec(`INSERT INTO grith_schema_migrations (version) VALUES (?)`, len(sqlMigrations)+1)
+	if _, err := NewSQLStore(newer); CodeOf(err) != ErrCodeStorage {
+		t.Errorf("newer schema code = %q", CodeOf(err))
+	}
+	fake.tables.migrations = fake.tables.migrations[:len(sqlMigrations)]
+
+	mem := NewMemoryStore()
+	base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, d := range []struct {
+		id, issuer, beneficiary, parent, expiresAt string
+		grace                                      time.Duration
+	}{
+		{"a", "alice", "bob", "", "2030-01-01T00:00:00Z", 0},
+		{"b", "alice", "carol", "a", "2030-01-01T00:00:00.0001Z", 0},
+		{"c", "bob", "carol", "a", "2030-01-01T00:00:00.0009Z", 0},
+		{"d", "bob", "alice", "b", "2030-01-01T00:00:00.001Z", 0},
+		{"e", "carol", "alice", "", "2030-01-01T01:00:00.0005+01:00", 0},
+		{"f", "carol", "bob", "", "2029-12-31T23:59:59.999Z", time.Hour},
+		{"g", "dave", "bob", "", "", 0},
+		{"h", "dave", "dave", "", "not a time", 0},
+	} {
+		doc := *doc
+		doc.ID, doc.Issuer.ID, doc.Beneficiary.ID = d.id, d.issuer, d.beneficiary
+		doc.ExpiresAt, doc.GracePeriod = d.expiresAt, d.grace.Milliseconds()
+		doc.Metadata = map[string]interface{}{"rank": float64(len(d.issuer))}
+		if d.parent != "" {
+			doc.Chain = &ChainReference{ParentID: d.parent, Relation: "delegates", Depth: 1}
+		}
+		if err := store.Put(d.id, &doc); err != nil {
+			t.Fatalf("Put(%s) error: %v", d.id, err)
+		}
+		mem.Put(d.id, &doc)
+	}
+	ids := func(docs []*CovenantDocument, err error) string {
+		if err != nil {
+			return err.Error()
+		}
+		var out []string
+		for _, d := range docs {
+			out = append(out, d.ID)
+		}
+		slices.Sort(out)
+		return strings.Join(out, ",")
+	}
+	same := func(name, got, want string) {
+		if got != want {
+			t.Errorf("%s = %q, MemoryStore has %q", name, got, want)
+		}
+	}
+	for _, at := range []time.Time{
+		base.Add(-time.Nanosecond), base, base.Add(time.Nanosecond), base.Add(100 * time.Microsecond),
+		base.Add(500 * time.Microsecond), base.Add(time.Millisecond - time.Nanosecond), base.Add(time.Millisecond),
+		base.Add(time.Millisecond + time.Nanosecond), base.Add(time.Hour),
+	} {
+		same("FindExpiringBefore("+at.Format(time.RFC3339Nano)+")", ids(store.FindExpiringBefore(at)), ids(mem.FindExpiringBefore(at)))
+	}
+	for _, party := range []string{"alice", "bob", "carol", "dave", "nobody"} {
+		same("FindByIssuer("+party+")", ids(store.FindByIssuer(party)), ids(mem.FindByIssuer(party)))
+		same("FindByBeneficiary("+party+")", ids(store.FindByBeneficiary(party)), ids(mem.FindByBeneficiary(party)))
+	}
+	for _, parent := range []string{"a", "b", "c"} {
+		same("FindChildrenOf("+parent+")", ids(store.FindChildrenOf(parent)), ids(mem.FindChildrenOf(parent)))
+	}
+	same("FindByMetadata(rank, 5)", ids(store.FindByMetadata("rank", 5)), ids(mem.FindByMetadata("rank", 5)))
+	same("List()", ids(store.List()), ids(mem.List()))
+	var paged []*CovenantDocument
+	for cursor := ""; ; {
+		page, next, err := store.ListPage(cursor, 3)
+		if err != nil {
+			t.Fatalf("ListPage() error: %v", err)
+		}
+		paged = append(paged, page...)
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	same("ListPage()", ids(paged, nil), ids(mem.List()))
+	if got, err := store.Get("e"); err != nil || got == nil || got.ExpiresAt != "2030-01-01T01:00:00.0005+01:00" {
+		t.Errorf("Get(e) = %+v, %v", got, err)
+	}
+	if got, err := store.Get("missing"); got != nil || err != nil {
+		t.Errorf("Get(missing) = %v, %v", got, err)
+	}
+
+	// A Delete whose statement or commit fails leaves the document.
+	for _, fail := range []string{"DELETE", "COMMIT"} {
+		fake.fail = fail
+		if err := store.Delete("a"); CodeOf(err) != ErrCodeStorage {
+			t.Errorf("Delete() failing at %s code = %q", fail, CodeOf(err))
+		}
+		fake.fail = ""
+		if !store.Has("a") || store.Count() != 8 {
+			t.Errorf("Delete() failing at %s was not rolled back", fail)
+		}
+	}
+	fake.fail = "INSERT INTO grith_covenants"
+	err = store.Put("z", doc)
+	fake.fail = ""
+	if CodeOf(err) != ErrCodeStorage || store.Has("z") {
+		t.Errorf("failed Put() code = %q, stored = %v", CodeOf(err), store.Has("z"))
+	}
+	if err := store.Delete("missing"); CodeOf(err) != ErrCodeNotFound {
+		t.Errorf("Delete(missing) code = %q", CodeOf(err))
+	}
+	if err := store.Delete("a"); err != nil || store.Has("a") || ids(store.FindByIssuer("alice")) != "b" {
+		t.Errorf("Delete(a) = %v, leaving issuer alice with %q", err, ids(store.FindByIssuer("alice")))
+	}
+
+	// Batches share the transaction: a failed one leaves nothing behind.
+	failed := errors.New("abandon")
+	err = store.Batch(func(tx Tx) error {
+		tx.Put("y", doc)
+		tx.Delete("b")
+		if got, _ := tx.Get("y"); got == nil {
+			t.Error("a batch should read its own writes")
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) || store.Has("y") || !store.Has("b") {
+		t.Errorf("abandoned Batch() = %v left y=%v b=%v", err, store.Has("y"), store.Has("b"))
+	}
+	if err := store.PutMany(map[string]*CovenantDocument{"x": doc, "y": doc}); err != nil {
+		t.Fatalf("PutMany() error: %v", err)
+	}
+	got, err := store.GetMany([]string{"x", "y", "b", "missing"})
+	if err != nil || len(got) != 3 || got["missing"] != nil {
+		t.Errorf("GetMany() = %d documents, %v", len(got), err)
+	}
+}
+
+func TestKVStore(t *testing.T) {
+	path := t.TempDir() + "/grith.kv"
+	kv, err := OpenKVStore(path)
+	if err != nil {
+		t.Fatalf("OpenKVStore() error: %v", err)
+	}
+	var _ Store = kv.Covenants()
+	var _ IdentityStore = kv.Identities()
+	var _ LogStore = kv.Logs()
+
+	b := newTestBundle(t)
+	if err := kv.Covenants().Put(b.doc.ID, b.doc); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	if err := kv.Covenants().Put("doomed", b.doc); err != nil {
+		t.Fatalf("Put(doomed) error: %v", err)
+	}
+	if err := kv.Covenants().Delete("doomed"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if err := kv.Covenants().Delete("doomed"); CodeOf(err) != ErrCodeNotFound {
+		t.Errorf("second Delete() code = %q", CodeOf(err))
+	}
+	if err := kv.Identities().Put(b.identity); err != nil {
+		t.Fatalf("identity Put() error: %v", err)
+	}
+	if err := kv.Logs().Append(b.doc.ID, b.entries...); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	kv.Close()
+	if err := kv.Covenants().Put("late", b.doc); CodeOf(err) != ErrCodeStorage {
+		t.Errorf("Put() after Close() code = %q", CodeOf(err))
+	}
+
+	// A torn final record is dropped on reopen; earlier records survive.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	f.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	f.Close()
+	reopened, err := OpenKVStore(path)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	if reopened.Repaired() != 7 {
+		t.Errorf("Repaired() = %d, want 7", reopened.Repaired())
+	}
+	doc, err := reopened.Covenants().Get(b.doc.ID)
+	if err != nil || doc == nil || doc.ID != b.doc.ID || reopened.Covenants().Has("doomed") {
+		t.Fatalf("Get() after reopen = %v, %v", doc, err)
+	}
+	matches, _ := reopened.Identities().Query(&IdentityQuery{ModelID: "model-1"})
+	if len(matches) != 1 || matches[0].ID != b.identity.ID {
+		t.Errorf("identity Query() after reopen = %d matches", len(matches))
+	}
+	if n, _ := reopened.Logs().Len(b.doc.ID); n != int64(len(b.entries)) {
+		t.Errorf("log Len() after reopen = %d", n)
+	}
+
+	// Compaction keeps only current contents.
+	info, _ := os.Stat(path)
+	if err := reopened.Compact(); err != nil {
+		t.Fatalf("Compact() error: %v", err)
+	}
+	compacted, _ := os.Stat(path)
+	if compacted.Size() >= info.Size() {
+		t.Errorf("compacted size %d, was %d", compacted.Size(), info.Size())
+	}
+	more := buildTestActionLog(t, b.doc, b.agent, b.entries, 1)
+	if err := reopened.Logs().Append(b.doc.ID, more[len(b.entries):]...); err != nil {
+		t.Fatalf("Append() after Compact() error: %v", err)
+	}
+	reopened.Close()
+	again, err := OpenKVStore(path)
+	if err != nil || again.Covenants().Count() != 1 || again.Identities().Count() != 1 {
+		t.Fatalf("reopen after Compact() = %v", err)
+	}
+	if n, _ := again.Logs().Len(b.doc.ID); n != int64(len(more)) {
+		t.Errorf("log Len() after Compact() = %d, want %d", n, len(more))
+	}
+	again.Close()
+
+	// Corruption before the final record is an error, not a repair.
+	data, _ := os.ReadFile(path)
+	data[kvHeaderSize+2] ^= 0xff
+	os.WriteFile(path, data, 0o600)
+	if _, err := OpenKVStore(path); CodeOf(err) != ErrCodeStorage {
+		t.Errorf("corrupt store code = %q, want %q", CodeOf(err), ErrCodeStorage)
+	}
+}
+
+func TestQueryableStores(t *testing.T) {
+	fileStore, err := OpenFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenFileStore() error: %v", err)
+	}
+	kv, err := OpenKVStore(t.TempDir() + "/grith.kv")
+	if err != nil {
+		t.Fatalf("OpenKVStore() error: %v", err)
+	}
+	defer kv.Close()
+	var _ QueryableStore = (*SQLStore)(nil)
+
+	base, _ := buildTestCovenant(t)
+	variant := func(issuer, beneficiary, expires, parent string, metadata map[string]interface{}) *CovenantDocument {
+		doc := *base
+		doc.Issuer.ID, doc.Beneficiary.ID, doc.ExpiresAt, doc.Metadata = issuer, beneficiary, expires, metadata
+		if parent != "" {
+			doc.Chain = &ChainReference{ParentID: parent, Relation: "delegates", Depth: 1}
+		}
+		return &doc
+	}
+	docs := map[string]*CovenantDocument{
+		"a": variant("alice", "bob", "2030-01-01T00:00:00.000Z", "", map[string]interface{}{"tier": "gold", "seats": 3}),
+		"b": variant("alice", "carol", "2031-01-01T00:00:00.000Z", "a", map[string]interface{}{"tier": "silver"}),
+		"c": variant("dave", "bob", "", "a", nil),
+	}
+
+	for name, store := range map[string]QueryableStore{"memory": NewMemoryStore(), "file": fileStore, "kv": kv.Covenants()} {
+		t.Run(name, func(t *testing.T) {
+			for id, doc := range docs {
+				if err := store.Put(id, doc); err != nil {
+					t.Fatalf("Put() error: %v", err)
+				}
+			}
+			check := func(label string, got []*CovenantDocument, err error, want ...string) {
+				t.Helper()
+				var ids []string
+				for _, doc := range got {
+					for id, d := range docs {
+						if d.Issuer.ID == doc.Issuer.ID && d.Beneficiary.ID == doc.Beneficiary.ID && d.ExpiresAt == doc.ExpiresAt {
+							ids = append(ids, id)
+						}
+					}
+				}
+				if err != nil || strings.Join(ids, ",") != strings.Join(want, ",") {
+					t.Errorf("%s = %v, %v, want %v", label, ids, err, want)
+				}
+			}
+			got, err := store.FindByIssuer("alice")
+			check("FindByIssuer", got, err, "a", "b")
+			got, err = store.FindByBeneficiary("bob")
+			check("FindByBeneficiary", got, err, "a", "c")
+			got, err = store.FindExpiringBefore(time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC))
+			check("FindExpiringBefore", got, err, "a")
+			got, err = store.FindChildrenOf("a")
+			check("FindChildrenOf", got, err, "b", "c")
+			got, err = store.FindByMetadata("seats", 3.0)
+			check("FindByMetadata(seats)", got, err, "a")
+			got, err = store.FindByMetadata("tier", "silver")
+			check("FindByMetadata(tier)", got, err, "b")
+			got, err = store.FindByIssuer("nobody")
+			check("FindByIssuer(nobody)", got, err)
+			if _, err := store.FindByMetadata("tier", func() {}); CodeOf(err) != ErrCodeInvalidInput {
+				t.Errorf("non-JSON metadata value code = %q", CodeOf(err))
+			}
+		})
+	}
+}
+
+func TestMemoryStoreIndexes(t *testing.T) {
+	store := NewMemoryStore()
+	doc, _ := buildTestCovenant(t)
+	doc.ExpiresAt = "2030-01-01T00:00:00.000Z"
+	doc.Chain = &ChainReference{ParentID: "parent", Relation: "delegates", Depth: 1}
+	for _, id := range []string{"b", "a"} {
+		store.Put(id, doc)
+	}
+	ids := func(docs []*CovenantDocument, err error) int {
+		if err != nil {
+			t.Fatalf("query error: %v", err)
+		}
+		return len(docs)
+	}
+	cutoff := time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)
+	if n := ids(store.FindByIssuer("alice")); n != 2 {
+		t.Errorf("FindByIssuer() = %d documents, want 2", n)
+	}
+
+	// Replacing a document moves its index entries.
+	moved := *doc
+	moved.Issuer.ID = "carol"
+	moved.ExpiresAt = "2032-01-01T00:00:00.000Z"
+	moved.Chain = nil
+	store.Put("a", &moved)
+	if n := ids(store.FindByIssuer("alice")); n != 1 {
+		t.Errorf("FindByIssuer(alice) after replace = %d, want 1", n)
+	}
+	if n := ids(store.FindByIssuer("carol")); n != 1 {
+		t.Errorf("FindByIssuer(carol) after replace = %d, want 1", n)
+	}
+	if n := ids(store.FindExpiringBefore(cutoff)); n != 1 {
+		t.Errorf("FindExpiringBefore() after replace = %d, want 1", n)
+	}
+	if n := ids(store.FindChildrenOf("parent")); n != 1 {
+		t.Errorf("FindChildrenOf() after replace = %d, want 1", n)
+	}
+
+	store.Delete("b")
+	if n := ids(store.FindExpiringBefore(cutoff)); n != 0 || len(store.index.expiries) != 1 || len(store.index.byParent) != 0 {
+		t.Errorf("after Delete(): %d expiring, %d expiries, %d parents", n, len(store.index.expiries), len(store.index.byParent))
+	}
+	store.Clear()
+	if n := ids(store.FindByIssuer("carol")); n != 0 || len(store.index.expiries) != 0 {
+		t.Errorf("after Clear(): %d documents, %d expiries", n, len(store.index.expiries))
+	}
+}
+
+func TestPagedStores(t *testing.T) {
+	fileStore, err := OpenFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenFileStore() error: %v", err)
+	}
+	kv, err := OpenKVStore(t.TempDir() + "/grith.kv")
+	if err != nil {
+		t.Fatalf("OpenKVStore() error: %v", err)
+	}
+	defer kv.Close()
+	var _ PagedStore = (*SQLStore)(nil)
+	doc, _ := buildTestCovenant(t)
+
+	for name, store := range map[string]PagedStore{"memory": NewMemoryStore(), "file": fileStore, "kv": kv.Covenants()} {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"d3", "d0", "d4", "d1", "d2"} {
+				store.Put(id, doc)
+			}
+			var pages []int
+			cursor := ""
+			for i := 0; ; i++ {
+				page, next, err := store.ListPage(cursor, 2)
+				if err != nil {
+					t.Fatalf("ListPage() error: %v", err)
+				}
+				pages = append(pages, len(page))
+				if i == 0 {
+					// Changes behind the cursor are not revisited; those
+					// ahead of it are seen.
+					store.Delete("d0")
+					store.Put("d1a", doc)
+				}
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+			if !slices.Equal(pages, []int{2, 2, 2}) {
+				t.Errorf("page sizes = %v, want [2 2 2]", pages)
+			}
+			if _, _, err := store.ListPage("!!", 2); CodeOf(err) != ErrCodeInvalidInput {
+				t.Errorf("invalid cursor code = %q", CodeOf(err))
+			}
+			if _, _, err := store.ListPage("", 0); CodeOf(err) != ErrCodeInvalidInput {
+				t.Errorf("zero limit code = %q", CodeOf(err))
+			}
+		})
+	}
+}
+
+func TestExpiryCollector(t *testing.T) {
+	now := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	put := func(expiresAt time.Time) *CovenantDocument {
+		doc := buildTimedCovenant(t, "", expiresAt.Format(time.RFC3339))
+		store.Put(doc.ID, doc)
+		return doc
+	}
+	old := put(now.Add(-40 * 24 * time.Hour))
+	recent := put(now.Add(-10 * 24 * time.Hour))
+	live := put(now.Add(24 * time.Hour))
+	unarchivable := put(now.Add(-50 * 24 * time.Hour))
+	graced := buildTimedCovenant(t, "", now.Add(-40*24*time.Hour).Format(time.RFC3339))
+	graced.GracePeriod = (20 * 24 * time.Hour).Milliseconds()
+	store.Put(graced.ID, graced)
+
+	archive := NewMemoryStore()
+	var evicted []string
+	c, err := NewExpiryCollector(&ExpiryCollectorOptions{
+		Store:     store,
+		Retention: 30 * 24 * time.Hour,
+		Archive: func(doc *CovenantDocument) error {
+			if doc.ID == unarchivable.ID {
+				return errors.New("cold storage unavailable")
+			}
+			return archive.Put(doc.ID, doc)
+		},
+		OnEvict: func(doc *CovenantDocument) { evicted = append(evicted, doc.ID) },
+		Now:     func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("NewExpiryCollector() error: %v", err)
+	}
+	result, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error: %v", err)
+	}
+	if !slices.Equal(result.Evicted, []string{old.ID}) || !slices.Equal(evicted, result.Evicted) {
+		t.Errorf("Evicted = %v, OnEvict saw %v, want [%s]", result.Evicted, evicted, old.ID)
+	}
+	if len(result.Failed) != 1 || result.Failed[unarchivable.ID] == nil {
+		t.Errorf("Failed = %v", result.Failed)
+	}
+	if store.Has(old.ID) || !archive.Has(old.ID) {
+		t.Error("evicted covenant should move to the archive")
+	}
+	for _, doc := range []*CovenantDocument{recent, live, unarchivable, graced} {
+		if !store.Has(doc.ID) {
+			t.Errorf("covenant expiring %s should be kept", doc.ExpiresAt)
+		}
+	}
+
+	if _, err := NewExpiryCollector(&ExpiryCollectorOptions{Store: store, Retention: -time.Hour}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("negative retention code = %q", CodeOf(err))
+	}
+	if _, err := NewExpiryCollector(&ExpiryCollectorOptions{}); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("missing store code = %q", CodeOf(err))
+	}
+	c.Start()
+	c.Stop()
+}
+
+func TestStoreEncryption(t *testing.T) {
+	key1, key2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	keys, err := NewStaticKeyProvider("k1", map[string][]byte{"k1": key1})
+	if err != nil {
+		t.Fatalf("NewStaticKeyProvider() error: %v", err)
+	}
+	if _, err := NewStaticKeyProvider("k1", map[string][]byte{"k1": key1[:16]}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("short key code = %q", CodeOf(err))
+	}
+	if _, err := NewStaticKeyProvider("k3", map[string][]byte{"k1": key1}); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("missing current key code = %q", CodeOf(err))
+	}
+	rotated, _ := NewStaticKeyProvider("k2", map[string][]byte{"k1": key1, "k2": key2})
+	doc, _ := buildTestCovenant(t)
+	doc.Metadata = map[string]interface{}{"operator": "acme-ops-team"}
+
+	dir := t.TempDir()
+	fileStore, err := OpenFileStoreWithOptions(dir, &StoreOptions{Encryption: keys})
+	if err != nil {
+		t.Fatalf("OpenFileStoreWithOptions() error: %v", err)
+	}
+	kvPath := t.TempDir() + "/grith.kv"
+	kv, err := OpenKVStoreWithOptions(kvPath, &StoreOptions{Encryption: keys})
+	if err != nil {
+		t.Fatalf("OpenKVStoreWithOptions() error: %v", err)
+	}
+	for name, store := range map[string]QueryableStore{"file": fileStore, "kv": kv.Covenants()} {
+		if err := store.Put(doc.ID, doc); err != nil {
+			t.Fatalf("%s: Put() error: %v", name, err)
+		}
+		got, err := store.Get(doc.ID)
+		if err != nil || got.ID != doc.ID || got.Metadata["operator"] != "acme-ops-team" {
+			t.Errorf("%s: Get() = %v, %v", name, got, err)
+		}
+		if found, err := store.FindByMetadata("operator", "acme-ops-team"); err != nil || len(found) != 1 {
+			t.Errorf("%s: FindByMetadata() = %d, %v", name, len(found), err)
+		}
+	}
+	kv.Close()
+
+	// Nothing readable reaches the disk.
+	objects, _ := os.ReadDir(dir + "/objects")
+	for _, path := range []string{dir + "/objects/" + objects[0].Name(), kvPath} {
+		raw, _ := os.ReadFile(path)
+		if bytes.Contains(raw, []byte("acme-ops-team")) || bytes.Contains(raw, []byte(doc.Issuer.PublicKey)) {
+			t.Errorf("%s holds plaintext", path)
+		}
+	}
+
+	// Ciphertext is bound to its ID.
+	hash := strings.TrimSuffix(objects[0].Name(), ".json")
+	os.WriteFile(dir+"/index.json", []byte(`{"`+doc.ID+`":"`+hash+`","alias":"`+hash+`"}`), 0o600)
+	moved, _ := OpenFileStoreWithOptions(dir, &StoreOptions{Encryption: keys})
+	if _, err := moved.Get("alias"); CodeOf(err) != ErrCodeCrypto {
+		t.Errorf("moved ciphertext code = %q, want %q", CodeOf(err), ErrCodeCrypto)
+	}
+
+	// Rotated providers read old documents; stores without one, or with
+	// the wrong keys, cannot.
+	if got, err := moved.Get(doc.ID); err != nil || got.ID != doc.ID {
+		t.Errorf("Get() = %v, %v", got, err)
+	}
+	reopened, _ := OpenKVStoreWithOptions(kvPath, &StoreOptions{Encryption: rotated})
+	if got, err := reopened.Covenants().Get(doc.ID); err != nil || got.ID != doc.ID {
+		t.Errorf("Get() with rotated keys = %v, %v", got, err)
+	}
+	reopened.Close()
+	plain, _ := OpenKVStore(kvPath)
+	if _, err := plain.Covenants().Get(doc.ID); CodeOf(err) != ErrCodeCrypto {
+		t.Errorf("Get() without keys code = %q, want %q", CodeOf(err), ErrCodeCrypto)
+	}
+	plain.Covenants().Put("plain", doc)
+	plain.Close()
+	other, _ := NewStaticKeyProvider("k2", map[string][]byte{"k2": key2})
+	wrong, _ := OpenKVStoreWithOptions(kvPath, &StoreOptions{Encryption: other})
+	defer wrong.Close()
+	if _, err := wrong.Covenants().Get(doc.ID); CodeOf(err) != ErrCodeCrypto {
+		t.Errorf("Get() with unknown key code = %q, want %q", CodeOf(err), ErrCodeCrypto)
+	}
+	if _, err := wrong.Covenants().Get("plain"); CodeOf(err) != ErrCodeStorage {
+		t.Errorf("unencrypted document code = %q, want %q", CodeOf(err), ErrCodeStorage)
+	}
+}
+
+func TestStoreSnapshot(t *testing.T) {
+	source := NewMemoryStore()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		doc, _ := buildTestCovenant(t)
+		source.Put(doc.ID, doc)
+		ids = append(ids, doc.ID)
+	}
+	slices.Sort(ids)
+	signer, _ := GenerateKeyPair()
+	var buf bytes.Buffer
+	manifest, err := ExportSnapshot(&buf, source, &ExportSnapshotOptions{KeyPair: signer})
+	if err != nil {
+		t.Fatalf("ExportSnapshot() error: %v", err)
+	}
+	if len(manifest.Documents) != 3 || manifest.Documents[0].ID != ids[0] || manifest.Signature == "" {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+	archive := buf.Bytes()
+
+	// Migrate to another backend, requiring the signer.
+	kv, err := OpenKVStore(t.TempDir() + "/grith.kv")
+	if err != nil {
+		t.Fatalf("OpenKVStore() error: %v", err)
+	}
+	defer kv.Close()
+	if _, err := ImportSnapshot(bytes.NewReader(archive), kv.Covenants(), &ImportSnapshotOptions{SignerPublicKey: signer.PublicKeyHex}); err != nil {
+		t.Fatalf("ImportSnapshot() error: %v", err)
+	}
+	if kv.Covenants().Count() != 3 || !kv.Covenants().Has(ids[1]) {
+		t.Errorf("imported %d documents", kv.Covenants().Count())
+	}
+
+	// Nothing is stored from a snapshot that fails verification.
+	other, _ := GenerateKeyPair()
+	tampered := bytes.Replace(archive, []byte(`"permit read`), []byte(`"permit write`), 1)
+	unsigned := bytes.Replace(archive, []byte(`"signature":"`+manifest.Signature+`"`), []byte(`"signature":""`), 1)
+	for name, c := range map[string]struct {
+		data []byte
+		opts *ImportSnapshotOptions
+		code ErrorCode
+	}{
+		"tampered":      {tampered, nil, ErrCodeInvalidInput},
+		"wrong signer":  {archive, &ImportSnapshotOptions{SignerPublicKey: other.PublicKeyHex}, ErrCodeCrypto},
+		"bad signature": {unsigned, nil, ErrCodeCrypto},
+		"not json":      {[]byte("{"), nil, ErrCodeInvalidJSON},
+	} {
+		target := NewMemoryStore()
+		if _, err := ImportSnapshot(bytes.NewReader(c.data), target, c.opts); CodeOf(err) != c.code || target.Count() != 0 {
+			t.Errorf("%s: code = %q, want %q; stored %d", name, CodeOf(err), c.code, target.Count())
+		}
+	}
+}
+
+func TestVerifyOnPut(t *testing.T) {
+	memory, err := NewMemoryStoreWithOptions(&StoreOptions{VerifyOnPut: true})
+	if err != nil {
+		t.Fatalf("NewMemoryStoreWithOptions() error: %v", err)
+	}
+	fileStore, err := OpenFileStoreWithOptions(t.TempDir(), &StoreOptions{VerifyOnPut: true})
+	if err != nil {
+		t.Fatalf("OpenFileStoreWithOptions() error: %v", err)
+	}
+	doc, _ := buildTestCovenant(t)
+	altered := *doc
+	altered.Constraints = "permit write on '/data/**'"
+	resigned := altered
+	resigned.ID, _ = ComputeID(&resigned)
+
+	for name, store := range map[string]Store{"memory": memory, "file": fileStore} {
+		if err := store.Put("elsewhere", doc); CodeOf(err) != ErrCodeInvalidInput {
+			t.Errorf("%s: wrong key code = %q", name, CodeOf(err))
+		}
+		if err := store.Put(altered.ID, &altered); err == nil || !strings.Contains(err.Error(), "does not match its contents") {
+			t.Errorf("%s: stale ID error = %v", name, err)
+		}
+		if err := store.Put(resigned.ID, &resigned); err == nil || !strings.Contains(err.Error(), "failed verification") {
+			t.Errorf("%s: bad signature error = %v", name, err)
+		}
+		if err := store.Put(doc.ID, doc); err != nil {
+			t.Errorf("%s: valid Put() error: %v", name, err)
+		}
+		if store.Count() != 1 {
+			t.Errorf("%s: stored %d documents, want 1", name, store.Count())
+		}
+	}
+
+	keys, _ := NewStaticKeyProvider("k", map[string][]byte{"k": make([]byte, 32)})
+	if _, err := NewMemoryStoreWithOptions(&StoreOptions{Encryption: keys}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("encrypted memory store code = %q", CodeOf(err))
+	}
+}
+
+func TestStoreMiddleware(t *testing.T) {
+	backing := NewMemoryStore()
+	cached, err := NewCachedStore(backing, 2)
+	if err != nil {
+		t.Fatalf("NewCachedStore() error: %v", err)
+	}
+	metrics, _ := NewMetricsStore(cached)
+	var accesses []StoreAccess
+	var store Store
+	store, err = NewAuditStore(metrics, func(a StoreAccess) { accesses = append(accesses, a) })
+	if err != nil {
+		t.Fatalf("NewAuditStore() error: %v", err)
+	}
+
+	var docs []*CovenantDocument
+	for i := 0; i < 3; i++ {
+		doc, _ := buildTestCovenant(t)
+		docs = append(docs, doc)
+		if err := store.Put(doc.ID, doc); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+	// The first document was evicted by the third; the others are cached.
+	for _, doc := range []*CovenantDocument{docs[2], docs[1], docs[0], docs[0]} {
+		if got, err := store.Get(doc.ID); err != nil || got.ID != doc.ID {
+			t.Fatalf("Get() = %v, %v", got, err)
+		}
+	}
+	if hits, misses := cached.Stats(); hits != 3 || misses != 1 {
+		t.Errorf("cache hits, misses = %d, %d, want 3, 1", hits, misses)
+	}
+	got, _ := store.Get(docs[0].ID)
+	got.Constraints = "mutated"
+	if again, _ := store.Get(docs[0].ID); again.Constraints == "mutated" {
+		t.Error("cached documents must be copied")
+	}
+	store.Delete(docs[0].ID)
+	if got, _ := store.Get(docs[0].ID); got != nil || backing.Has(docs[0].ID) {
+		t.Error("Delete() should evict the cached document")
+	}
+	if err := store.Delete(docs[0].ID); CodeOf(err) != ErrCodeNotFound {
+		t.Errorf("second Delete() code = %q", CodeOf(err))
+	}
+
+	m := metrics.Metrics()
+	if m[StoreOpPut].Count != 3 || m[StoreOpGet].Count != 7 || m[StoreOpDelete].Count != 2 || m[StoreOpDelete].Errors != 1 {
+		t.Errorf("metrics = %+v", m)
+	}
+	if len(accesses) != 12 || accesses[0].Op != StoreOpPut || accesses[0].ID != docs[0].ID || accesses[11].Err == nil {
+		t.Errorf("audit recorded %d accesses: %+v", len(accesses), accesses)
+	}
+
+	if _, err := NewCachedStore(backing, 0); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("zero cache size code = %q", CodeOf(err))
+	}
+	if _, err := NewAuditStore(backing, nil); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("missing record function code = %q", CodeOf(err))
+	}
+}
+
+func TestRemoteStore(t *testing.T) {
+	backing := NewMemoryStore()
+	var ops []string
+	handler := NewStoreHandler(backing, &StoreHandlerOptions{
+		Authorize: func(r *http.Request, op, id string) error {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return errors.New("bad token")
+			}
+			ops = append(ops, op)
+			return nil
+		},
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	store, err := NewRemoteStore(server.URL, &RemoteStoreOptions{
+		Authenticate: func(req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer secret")
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRemoteStore() error: %v", err)
+	}
+
+	var docs []*CovenantDocument
+	for i := 0; i < 3; i++ {
+		doc, _ := buildTestCovenant(t)
+		docs = append(docs, doc)
+		if err := store.Put(doc.ID, doc); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+	if store.Count() != 3 || !store.Has(docs[0].ID) || store.Has("missing") {
+		t.Errorf("Count() = %d, Has() = %v", store.Count(), store.Has(docs[0].ID))
+	}
+	got, etag, err := store.GetWithETag(docs[1].ID)
+	if err != nil || got.ID != docs[1].ID || etag == "" {
+		t.Fatalf("GetWithETag() = %v, %q, %v", got, etag, err)
+	}
+	if got, err := store.Get("missing"); got != nil || err != nil {
+		t.Errorf("Get(missing) = %v, %v", got, err)
+	}
+	list, err := store.List()
+	if err != nil || len(list) != 3 {
+		t.Fatalf("List() = %d documents, %v", len(list), err)
+	}
+	page, next, err := store.ListPage("", 2)
+	if err != nil || len(page) != 2 || next == "" {
+		t.Fatalf("ListPage() = %d, %q, %v", len(page), next, err)
+	}
+
+	// Conditional requests.
+	if newTag, err := store.PutIfMatch(docs[1].ID, docs[1], etag); err != nil || newTag != etag {
+		t.Errorf("PutIfMatch(current) = %q, %v", newTag, err)
+	}
+	if _, err := store.PutIfMatch(docs[1].ID, docs[1], `"stale"`); CodeOf(err) != ErrCodeConflict {
+		t.Errorf("PutIfMatch(stale) code = %q", CodeOf(err))
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/covenants/"+docs[1].ID, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("If-None-Match", etag)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional GET = %v, %v", resp, err)
+	}
+
+	// Documents are content-addressed.
+	if err := store.Put(docs[0].ID, docs[1]); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("Put() under another ID code = %q", CodeOf(err))
+	}
+	tampered := *docs[0]
+	tampered.Constraints = "deny ** on '**'"
+	if err := store.Put(docs[0].ID, &tampered); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("Put() of tampered document code = %q", CodeOf(err))
+	}
+
+	if err := store.Delete(docs[0].ID); err != nil || backing.Has(docs[0].ID) {
+		t.Errorf("Delete() error: %v", err)
+	}
+	if err := store.Delete(docs[0].ID); CodeOf(err) != ErrCodeNotFound {
+		t.Errorf("second Delete() code = %q", CodeOf(err))
+	}
+	if !slices.Contains(ops, StoreOpPut) || !slices.Contains(ops, StoreOpHas) || !slices.Contains(ops, StoreOpCount) {
+		t.Errorf("authorized ops = %v", ops)
+	}
+
+	anonymous, _ := NewRemoteStore(server.URL, nil)
+	if _, err := anonymous.Get(docs[1].ID); CodeOf(err) != ErrCodeUnauthorized {
+		t.Errorf("unauthenticated Get() code = %q", CodeOf(err))
+	}
+	if _, err := NewRemoteStore("", nil); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("empty URL code = %q", CodeOf(err))
+	}
+}
+
+func TestGRPCStore(t *testing.T) {
+	backing := NewMemoryStore()
+	var methods []string
+	server := httptest.NewUnstartedServer(NewGRPCStoreHandler(backing, &GRPCStoreHandlerOptions{
+		Authorize: func(r *http.Request, method string) error {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return errors.New("bad token")
+			}
+			methods = append(methods, method)
+			return nil
+		},
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := NewGRPCStoreClient(server.URL, &GRPCStoreClientOptions{
+		HTTPClient: server.Client(),
+		Authenticate: func(req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer secret")
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewGRPCStoreClient() error: %v", err)
+	}
+	var store PagedStore = client
+
+	var docs []*CovenantDocument
+	for i := 0; i < 3; i++ {
+		doc, _ := buildTestCovenant(t)
+		docs = append(docs, doc)
+		if err := store.Put(doc.ID, doc); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+	if store.Count() != 3 || !store.Has(docs[0].ID) || store.Has("missing") {
+		t.Errorf("Count() = %d, Has() = %v", store.Count(), store.Has(docs[0].ID))
+	}
+	got, err := store.Get(docs[1].ID)
+	if err != nil || got == nil || got.ID != docs[1].ID {
+		t.Fatalf("Get() = %v, %v", got, err)
+	}
+	if id, err := ComputeID(got); err != nil || id != got.ID {
+		t.Errorf("round-tripped document ID = %q, %v", id, err)
+	}
+	if got, err := store.Get("missing"); got != nil || err != nil {
+		t.Errorf("Get(missing) = %v, %v", got, err)
+	}
+	if list, err := store.List(); err != nil || len(list) != 3 {
+		t.Fatalf("List() = %d documents, %v", len(list), err)
+	}
+	page, next, err := store.ListPage("", 2)
+	if err != nil || len(page) != 2 || next == "" {
+		t.Fatalf("ListPage() = %d, %q, %v", len(page), next, err)
+	}
+	if rest, next, err := store.ListPage(next, 2); err != nil || len(rest) != 1 || next != "" {
+		t.Errorf("second ListPage() = %d, %q, %v", len(rest), next, err)
+	}
+
+	result, err := client.Verify(docs[0])
+	if err != nil || !result.Valid || len(result.Checks) == 0 {
+		t.Fatalf("Verify() = %+v, %v", result, err)
+	}
+	tampered := *docs[0]
+	tampered.Constraints = "deny ** on '**'"
+	if result, err := client.Verify(&tampered); err != nil || result.Valid {
+		t.Errorf("Verify(tampered) = %+v, %v", result, err)
+	}
+	if err := store.Put(docs[0].ID, &tampered); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("Put() of tampered document code = %q", CodeOf(err))
+	}
+
+	if err := store.Delete(docs[0].ID); err != nil || backing.Has(docs[0].ID) {
+		t.Errorf("Delete() error: %v", err)
+	}
+	if err := store.Delete(docs[0].ID); CodeOf(err) != ErrCodeNotFound {
+		t.Errorf("second Delete() code = %q", CodeOf(err))
+	}
+	extra, _ := buildTestCovenant(t)
+	if err := client.PutMany(map[string]*CovenantDocument{docs[0].ID: docs[0], extra.ID: extra}); err != nil || !backing.Has(docs[0].ID) || !backing.Has(extra.ID) {
+		t.Errorf("PutMany() error: %v", err)
+	}
+	if !slices.Contains(methods, "Verify") || !slices.Contains(methods, "List") {
+		t.Errorf("authorized methods = %v", methods)
+	}
+
+	anonymous, _ := NewGRPCStoreClient(server.URL, &GRPCStoreClientOptions{HTTPClient: server.Client()})
+	if _, err := anonymous.Get(docs[1].ID); CodeOf(err) != ErrCodeUnauthorized {
+		t.Errorf("unauthenticated Get() code = %q", CodeOf(err))
+	}
+
+	// Protobuf wire format round trip, including a negative int32.
+	msg := protoMessage(nil).bytes(1, []byte("id")).varint(2, -1).repeated(3, nil).repeated(3, []byte("x"))
+	fields, err := parseProto(msg)
+	if err != nil || fields.str(1) != "id" || int32(fields.num(2)) != -1 || len(fields.lengths[3]) != 2 {
+		t.Errorf("parseProto() = %+v, %v", fields, err)
+	}
+	if _, err := parseProto([]byte{0x0a, 0x05, 'a'}); err == nil {
+		t.Error("parseProto() should reject a truncated field")
+	}
+}
+
+func TestGRPCStoreFrameLimits(t *testing.T) {
+	frame := func(size uint32, body string) []byte {
+		b := []byte{0, byte(size >> 24), byte(size >> 16), byte(size >> 8), byte(size)}
+		return append(b, body...)
+	}
+	handler := NewGRPCStoreHandler(NewMemoryStore(), nil)
+	serve := func(method string, body []byte) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, grpcStoreService+method, bytes.NewReader(body))
+		req.ProtoMajor = 2
+		req.Header.Set("Content-Type", "application/grpc")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Frames over the method's limit are refused from the header alone,
+	// PutMany frames included.
+	for _, tc := range []struct {
+		method string
+		size   uint32
+	}{
+		{"Put", MaxDocumentSize + 4097},
+		{"PutMany", maxBulkRequestSize + 1},
+		{"PutMany", 1 << 30},
+	} {
+		rec := serve(tc.method, frame(tc.size, "x"))
+		if got := rec.Header().Get("Grpc-Status"); got != strconv.Itoa(grpcInvalidArgument) {
+			t.Errorf("%s of %d bytes: Grpc-Status = %q, want %d", tc.method, tc.size, got, grpcInvalidArgument)
+		}
+	}
+
+	// A frame declaring more than it sends is not allocated up front.
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := readGRPCFrame(bytes.NewReader(frame(maxBulkRequestSize, "short")), maxBulkRequestSize)
+	runtime.ReadMemStats(&after)
+	if err == nil {
+		t.Error("readGRPCFrame() should reject a truncated message")
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("readGRPCFrame() allocated %d bytes for a 5-byte body", allocated)
+	}
+}
+
+func TestBatchStores(t *testing.T) {
+	open := map[string]func(t *testing.T, opts *StoreOptions) BatchStore{
+		"memory": func(t *testing.T, opts *StoreOptions) BatchStore {
+			s, err := NewMemoryStoreWithOptions(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+		"file": func(t *testing.T, opts *StoreOptions) BatchStore {
+			s, err := OpenFileStoreWithOptions(t.TempDir(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+		"kv": func(t *testing.T, opts *StoreOptions) BatchStore {
+			kv, err := OpenKVStoreWithOptions(t.TempDir()+"/grith.kv", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { kv.Close() })
+			return kv.Covenants()
+		},
+	}
+	for name, open := range open {
+		t.Run(name, func(t *testing.T) {
+			store := open(t, &StoreOptions{VerifyOnPut: true})
+			predecessor, _ := buildTestCovenant(t)
+			parent, _ := buildTestCovenant(t)
+			child, _ := buildTestCovenant(t)
+			if err := store.Put(predecessor.ID, predecessor); err != nil {
+				t.Fatalf("Put() error: %v", err)
+			}
+
+			// A failing transaction applies nothing.
+			boom := errors.New("boom")
+			err := store.Batch(func(tx Tx) error {
+				if err := tx.Put(parent.ID, parent); err != nil {
+					return err
+				}
+				if err := tx.Delete(predecessor.ID); err != nil {
+					return err
+				}
+				return boom
+			})
+			if err != boom || store.Has(parent.ID) || !store.Has(predecessor.ID) {
+				t.Fatalf("failed Batch() = %v, parent stored %v", err, store.Has(parent.ID))
+			}
+			tampered := *child
+			tampered.Constraints = "deny ** on '**'"
+			err = store.Batch(func(tx Tx) error {
+				if err := tx.Put(parent.ID, parent); err != nil {
+					return err
+				}
+				return tx.Put(child.ID, &tampered)
+			})
+			if CodeOf(err) != ErrCodeInvalidInput || store.Has(parent.ID) {
+				t.Fatalf("Batch() with an invalid document = %v, parent stored %v", err, store.Has(parent.ID))
+			}
+
+			var leaked Tx
+			err = store.Batch(func(tx Tx) error {
+				leaked = tx
+				if err := tx.Put(parent.ID, parent); err != nil {
+					return err
+				}
+				if got, err := tx.Get(parent.ID); err != nil || got.ID != parent.ID {
+					t.Errorf("tx.Get() of a staged document = %v, %v", got, err)
+				}
+				if err := tx.Put(child.ID, child); err != nil {
+					return err
+				}
+				if err := tx.Delete(predecessor.ID); err != nil {
+					return err
+				}
+				if tx.Has(predecessor.ID) {
+					t.Error("tx.Has() should not see a staged delete")
+				}
+				if err := tx.Delete(predecessor.ID); CodeOf(err) != ErrCodeNotFound {
+					t.Errorf("second tx.Delete() code = %q", CodeOf(err))
+				}
+				if err := tx.Put(parent.ID, child); CodeOf(err) != ErrCodeInvalidInput {
+					t.Errorf("tx.Put() under another ID code = %q", CodeOf(err))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Batch() error: %v", err)
+			}
+			if !store.Has(parent.ID) || !store.Has(child.ID) || store.Has(predecessor.ID) || store.Count() != 2 {
+				t.Errorf("after Batch(): count %d", store.Count())
+			}
+			if err := leaked.Put(predecessor.ID, predecessor); CodeOf(err) != ErrCodeInvalidInput {
+				t.Errorf("Put() on a closed transaction code = %q", CodeOf(err))
+			}
+			if err := store.Batch(func(tx Tx) error {
+				if err := tx.Put(predecessor.ID, predecessor); err != nil {
+					return err
+				}
+				return tx.Delete(predecessor.ID)
+			}); err != nil || store.Has(predecessor.ID) {
+				t.Errorf("Batch() storing and deleting a document = %v", err)
+			}
+		})
+	}
+	var _ BatchStore = (*SQLStore)(nil)
+}
+
+func TestCovenantDocumentClone(t *testing.T) {
+	doc, _ := buildTestCovenant(t)
+	doc.ConstraintsRef = &ConstraintsRef{Hash: "abc"}
+	doc.Chain = &ChainReference{ParentID: "parent", Relation: "delegates", Depth: 1}
+	doc.Metadata = map[string]interface{}{
+		"tags":   []interface{}{"a", map[string]interface{}{"b": 1.0}},
+		"limits": map[string]interface{}{"rate": 10.0},
+		"owners": []string{"alice"},
+		"typed":  struct{ N int }{3},
+	}
+	doc.Extensions = map[string]Extension{"x": {Value: map[string]interface{}{"k": "v"}}}
+	doc.Countersignatures = []Countersignature{{SignerRole: "auditor"}}
+	doc.Transparency = []TransparencyReceipt{{Proof: &InclusionProof{Hashes: []string{"h"}}, TreeHead: &SignedTreeHead{TreeSize: 1}}}
+	doc.Anchors = []AnchorProof{{Type: "t", Batch: &BatchProof{Hashes: []string{"h"}}}}
+
+	before, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := doc.Clone()
+	if after, _ := json.Marshal(c); !bytes.Equal(after, before) {
+		t.Fatalf("Clone() serializes as %s, want %s", after, before)
+	}
+
+	c.ConstraintsRef.Hash = "changed"
+	c.Chain.Depth = 5
+	c.Metadata["tags"].([]interface{})[1].(map[string]interface{})["b"] = 2.0
+	c.Metadata["limits"].(map[string]interface{})["rate"] = 0.0
+	c.Metadata["owners"].([]string)[0] = "mallory"
+	c.Extensions["x"].Value.(map[string]interface{})["k"] = "changed"
+	c.Countersignatures[0].SignerRole = "changed"
+	c.Transparency[0].Proof.Hashes[0] = "changed"
+	c.Transparency[0].TreeHead.TreeSize = 9
+	c.Anchors[0].Batch.Hashes[0] = "changed"
+	if after, _ := json.Marshal(doc); !bytes.Equal(after, before) {
+		t.Errorf("mutating the clone changed the original: %s", after)
+	}
+	if (*CovenantDocument)(nil).Clone() != nil {
+		t.Error("Clone() of nil should be nil")
+	}
+
+	// Stored documents are clones in both directions.
+	store := NewMemoryStore()
+	if err := store.Put(doc.ID, doc); err != nil {
+		t.Fatal(err)
+	}
+	doc.Metadata["limits"].(map[string]interface{})["rate"] = 1.0
+	got, _ := store.Get(doc.ID)
+	if got.Metadata["limits"].(map[string]interface{})["rate"] != 10.0 {
+		t.Error("store retained the caller's metadata")
+	}
+}
+
+func TestBulkStores(t *testing.T) {
+	docs := make(map[string]*CovenantDocument)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		doc, _ := buildTestCovenant(t)
+		docs[doc.ID] = doc
+		ids = append(ids, doc.ID)
+	}
+	invalid, _ := buildTestCovenant(t)
+	invalid.Constraints = "deny ** on '**'"
+
+	kv, err := OpenKVStoreWithOptions(t.TempDir()+"/grith.kv", &StoreOptions{VerifyOnPut: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	fileStore, err := OpenFileStoreWithOptions(t.TempDir(), &StoreOptions{VerifyOnPut: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory, _ := NewMemoryStoreWithOptions(&StoreOptions{VerifyOnPut: true})
+
+	httpServer := httptest.NewServer(NewStoreHandler(NewMemoryStore(), nil))
+	defer httpServer.Close()
+	remote, _ := NewRemoteStore(httpServer.URL, nil)
+	grpcServer := httptest.NewUnstartedServer(NewGRPCStoreHandler(NewMemoryStore(), nil))
+	grpcServer.EnableHTTP2 = true
+	grpcServer.StartTLS()
+	defer grpcServer.Close()
+	grpcClient, _ := NewGRPCStoreClient(grpcServer.URL, &GRPCStoreClientOptions{HTTPClient: grpcServer.Client()})
+	metrics, _ := NewMetricsStore(NewMemoryStore())
+
+	stores := map[string]Store{
+		"memory": memory, "file": fileStore, "kv": kv.Covenants(),
+		"remote": remote, "grpc": grpcClient, "fallback": metrics,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if err := PutMany(store, docs); err != nil {
+				t.Fatalf("PutMany() error: %v", err)
+			}
+			got, err := GetMany(store, append([]string{"missing"}, ids...))
+			if err != nil || len(got) != 3 {
+				t.Fatalf("GetMany() = %d documents, %v", len(got), err)
+			}
+			for _, id := range ids {
+				if got[id] == nil || got[id].ID != id {
+					t.Errorf("GetMany()[%s] = %v", shortID(id), got[id])
+				}
+			}
+			if name == "fallback" {
+				if m := metrics.Metrics(); m[StoreOpPut].Count != 3 || m[StoreOpGet].Count != 4 {
+					t.Errorf("fallback metrics = %+v", m)
+				}
+				return
+			}
+			// Bulk puts to the local stores are atomic; remote stores refuse
+			// documents that are not content-addressed.
+			extra, _ := buildTestCovenant(t)
+			err = PutMany(store, map[string]*CovenantDocument{extra.ID: extra, invalid.ID: invalid})
+			if CodeOf(err) != ErrCodeInvalidInput || store.Has(extra.ID) {
+				t.Errorf("PutMany() with an invalid document = %v, stored %v", err, store.Has(extra.ID))
+			}
+		})
+	}
+}
+
+func TestStoreStats(t *testing.T) {
+	now := time.Now().UTC()
+	ts := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+	active, _ := buildTestCovenant(t)
+	pending := buildTimedCovenant(t, ts(time.Hour), "")
+	expired := buildTimedCovenant(t, "", ts(-time.Hour))
+	graced := buildTimedCovenant(t, "", ts(-time.Hour))
+	graced.GracePeriod = (2 * time.Hour).Milliseconds()
+
+	if got := graced.StateAt(now); got != CovenantInGrace {
+		t.Errorf("StateAt() in grace = %q", got)
+	}
+	if got := graced.StateAt(now.Add(2 * time.Hour)); got != CovenantExpired {
+		t.Errorf("StateAt() after grace = %q", got)
+	}
+	if got := pending.StateAt(now.Add(2 * time.Hour)); got != CovenantActive {
+		t.Errorf("StateAt() after activation = %q", got)
+	}
+
+	dir := t.TempDir()
+	fileStore, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv, err := OpenKVStore(t.TempDir() + "/grith.kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+
+	for name, store := range map[string]MaintainedStore{"file": fileStore, "kv": kv.Covenants()} {
+		t.Run(name, func(t *testing.T) {
+			for _, doc := range []*CovenantDocument{active, pending, expired, graced} {
+				if err := store.Put(doc.ID, doc); err != nil {
+					t.Fatal(err)
+				}
+			}
+			extra, _ := buildTestCovenant(t)
+			store.Put(extra.ID, extra)
+			store.Delete(extra.ID)
+			if name == "file" {
+				os.WriteFile(dir+"/objects/stray.json", []byte("{}"), 0o600)
+			}
+
+			st, err := store.Stats()
+			if err != nil {
+				t.Fatalf("Stats() error: %v", err)
+			}
+			want := map[CovenantState]int{CovenantActive: 1, CovenantPending: 1, CovenantExpired: 1, CovenantInGrace: 1}
+			if st.Documents != 4 || st.Indexes["id"] != 4 || len(st.ByState) != len(want) {
+				t.Errorf("Stats() = %+v", st)
+			}
+			for state, n := range want {
+				if st.ByState[state] != n {
+					t.Errorf("Stats().ByState[%q] = %d, want %d", state, st.ByState[state], n)
+				}
+			}
+			if st.SizeOnDisk <= 0 || st.Reclaimable <= 0 {
+				t.Errorf("Stats() size %d, reclaimable %d", st.SizeOnDisk, st.Reclaimable)
+			}
+
+			if err := store.Compact(); err != nil {
+				t.Fatalf("Compact() error: %v", err)
+			}
+			after, _ := store.Stats()
+			if after.SizeOnDisk >= st.SizeOnDisk || after.Documents != 4 {
+				t.Errorf("Compact() left size %d of %d, %d documents", after.SizeOnDisk, st.SizeOnDisk, after.Documents)
+			}
+			if name == "file" && after.Reclaimable != 0 {
+				t.Errorf("Compact() left %d reclaimable bytes", after.Reclaimable)
+			}
+		})
+	}
+	var _ MaintainedStore = (*SQLStore)(nil)
+}
+
+func TestEnforcer(t *testing.T) {
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	build := func(constraints string, chain *ChainReference) *CovenantDocument {
+		doc, err := BuildCovenant(&CovenantBuilderOptions{
+			Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+			Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+			Constraints: constraints,
+			PrivateKey:  issuerKP.PrivateKey,
+			Chain:       chain,
+		})
+		if err != nil {
+			t.Fatalf("BuildCovenant() error: %v", err)
+		}
+		return doc
+	}
+	root := build("permit read on '/data/**'\npermit write on '/data/**'\npermit audit.log on '/data/**'\nlimit read 3 per 1 hours", nil)
+	leaf := build("permit read on '/data/**'\npermit write on '/data/**'\npermit audit.log on '/data/**'\nrequire audit.log on '/data/secret/**'\nlimit read 2 per 1 minutes",
+		&ChainReference{ParentID: root.ID, Relation: "delegates", Depth: 1})
+	log, err := NewActionLog(&ActionLogOptions{Covenant: leaf, Agent: agentKP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Millisecond)
+	enforcer, err := NewEnforcer(&EnforcerOptions{
+		Covenant:         leaf,
+		Ancestors:        []*CovenantDocument{root},
+		Log:              log,
+		ObligationWindow: time.Hour,
+		Now:              func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("NewEnforcer() error: %v", err)
+	}
+
+	ctx := context.Background()
+	check := func(action, resource string, want bool) *EnforcementDecision {
+		t.Helper()
+		d, err := enforcer.Check(ctx, action, resource, nil)
+		if err != nil {
+			t.Fatalf("Check(%s, %s) error: %v", action, resource, err)
+		}
+		if d.Permitted != want || d.Entry == nil {
+			t.Fatalf("Check(%s, %s) = %+v, want permitted %v", action, resource, d, want)
+		}
+		return d
+	}
+
+	if d := check("read", "/data/a", true); d.RateLimit == nil || d.RateLimit.Remaining != 1 {
+		t.Errorf("RateLimit = %+v, want 1 remaining", d.RateLimit)
+	}
+	check("read", "/data/a", true)
+	if d := check("read", "/data/a", false); d.CovenantID != leaf.ID || d.RateLimit == nil || !d.RateLimit.Exceeded {
+		t.Errorf("over the leaf's limit: %+v", d)
+	}
+	now = now.Add(2 * time.Minute)
+	check("read", "/data/a", true)
+	now = now.Add(2 * time.Minute)
+	if d := check("read", "/data/a", false); d.CovenantID != root.ID {
+		t.Errorf("over the root's limit, denied by %s", shortID(d.CovenantID))
+	}
+	check("delete", "/data/a", false)
+
+	d := check("write", "/data/secret/x", true)
+	if len(d.Obligations) != 1 || d.Obligations[0].Action != "audit.log" || !d.Obligations[0].Deadline.Equal(now.Add(time.Hour)) {
+		t.Errorf("Obligations = %+v", d.Obligations)
+	}
+	if len(enforcer.Obligations()) != 1 {
+		t.Errorf("pending obligations = %+v", enforcer.Obligations())
+	}
+	if d := check("audit.log", "/data/secret/x", true); len(d.Fulfilled) != 1 || len(enforcer.Obligations()) != 0 {
+		t.Errorf("Fulfilled = %+v, pending %+v", d.Fulfilled, enforcer.Obligations())
+	}
+
+	if n := log.Len(); n != 8 {
+		t.Errorf("log length = %d, want 8", n)
+	}
+
+	// With the default clock, the log replays as compliant.
+	log, _ = NewActionLog(&ActionLogOptions{Covenant: leaf, Agent: agentKP})
+	enforcer, err = NewEnforcer(&EnforcerOptions{Covenant: leaf, Ancestors: []*CovenantDocument{root}, Log: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("read", "/data/a", true)
+	check("read", "/data/a", true)
+	check("read", "/data/a", false)
+	check("write", "/data/secret/y", true)
+	check("audit.log", "/data/secret/y", true)
+	if report := ReplayCompliance(leaf, log); !report.Compliant || report.Entries != 5 {
+		t.Errorf("enforced log should replay compliant: %+v", report)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := enforcer.Check(cancelled, "read", "/data/a", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Check() error = %v", err)
+	}
+	if _, err := NewEnforcer(&EnforcerOptions{Covenant: leaf, Ancestors: []*CovenantDocument{leaf}}); CodeOf(err) != ErrCodeInvalidChain {
+		t.Errorf("broken chain code = %q, want %q", CodeOf(err), ErrCodeInvalidChain)
+	}
+	other, _ := buildTestCovenant(t)
+	if _, err := NewEnforcer(&EnforcerOptions{Covenant: other, Log: log}); CodeOf(err) != ErrCodeActionLog {
+		t.Errorf("foreign log code = %q, want %q", CodeOf(err), ErrCodeActionLog)
+	}
+}
+
+func TestToolGate(t *testing.T) {
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read_file on '/workspace/**'\npermit search on '/web' when count <= 10\nlimit read_file 2 per 1 hours",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: doc, Agent: agentKP})
+	enforcer, err := NewEnforcer(&EnforcerOptions{Covenant: doc, Log: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate, err := NewToolGate(&ToolGateOptions{
+		Enforcer: enforcer,
+		Tools: map[string]ToolMapping{
+			"read_file": {Resource: "/workspace/{path}", Context: []string{}},
+			"web_search": {
+				Action:   "search",
+				Resource: "/web",
+				Transform: func(args map[string]interface{}) (map[string]interface{}, error) {
+					args["safe"] = true
+					return args, nil
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewToolGate() error: %v", err)
+	}
+
+	ctx := context.Background()
+	gated := func(name, args string, want ToolVerdict) *ToolDecision {
+		t.Helper()
+		d, err := gate.Check(ctx, ToolCall{Name: name, Arguments: json.RawMessage(args)})
+		if err != nil {
+			t.Fatalf("Check(%s %s) error: %v", name, args, err)
+		}
+		if d.Verdict != want {
+			t.Fatalf("Check(%s %s) = %s (%s), want %s", name, args, d.Verdict, d.Reason, want)
+		}
+		return d
+	}
+
+	if d := gated("read_file", `{"path": "notes/a.txt"}`, ToolAllow); d.Resource != "/workspace/notes/a.txt" || d.Action != "read_file" {
+		t.Errorf("mapped to %s on %s", d.Action, d.Resource)
+	}
+	if d := gated("read_file", `{"path": "../etc/passwd"}`, ToolDeny); d.Resource != "/etc/passwd" {
+		t.Errorf("traversal mapped to %s", d.Resource)
+	}
+	gated("read_file", `{"path": "b.txt"}`, ToolAllow)
+	if d := gated("read_file", `{"path": "c.txt"}`, ToolDeny); d.Enforcement.RateLimit == nil {
+		t.Errorf("third read should hit the limit: %s", d.Reason)
+	}
+	gated("read_file", `{}`, ToolDeny)
+	gated("read_file", `["a"]`, ToolDeny)
+	gated("delete_file", `{"path": "a.txt"}`, ToolDeny)
+
+	d := gated("web_search", `{"q": "grith", "count": 5}`, ToolTransform)
+	var args map[string]interface{}
+	if err := json.Unmarshal(d.Call.Arguments, &args); err != nil || args["safe"] != true || args["q"] != "grith" {
+		t.Errorf("transformed arguments = %s", d.Call.Arguments)
+	}
+	gated("web_search", `{"q": "grith", "count": 50}`, ToolDeny)
+	gated("web_search", `{"q": "grith", "count": 5, "safe": true}`, ToolAllow)
+
+	// Calls denied before reaching the enforcer are not logged.
+	if n := log.Len(); n != 7 {
+		t.Errorf("log length = %d, want 7", n)
+	}
+	if _, err := NewToolGate(&ToolGateOptions{Enforcer: enforcer, Tools: map[string]ToolMapping{"x": {Resource: "/a/{b"}}}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("bad template code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+func TestCommandGuard(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("echo not found")
+	}
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit process.exec on '/bin/echo'\ndeny process.exec on '/bin/echo' when flag.e = true\npermit process.exec on '/bin/rm' when argc = 1",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: doc, Agent: agentKP})
+	enforcer, _ := NewEnforcer(&EnforcerOptions{Covenant: doc, Log: log})
+	guard, err := NewCommandGuard(&CommandGuardOptions{Enforcer: enforcer})
+	if err != nil {
+		t.Fatalf("NewCommandGuard() error: %v", err)
+	}
+
+	cmd := guard.CommandContext(context.Background(), "echo", "hello", "--", "-e")
+	out, err := cmd.Output()
+	if err != nil || strings.TrimSpace(string(out)) != "hello -- -e" {
+		t.Fatalf("Output() = %q, %v", out, err)
+	}
+	if d := cmd.Decision(); d == nil || !d.Permitted || d.Entry == nil || d.Entry.Resource != "/bin/echo" {
+		t.Errorf("Decision() = %+v", d)
+	}
+
+	denied := guard.Command("echo", "-e", "x")
+	if err := denied.Run(); CodeOf(err) != ErrCodeUnauthorized || denied.Process != nil {
+		t.Errorf("Run() with a denied flag = %v, process %v", err, denied.Process)
+	}
+	if err := denied.Start(); CodeOf(err) != ErrCodeUnauthorized {
+		t.Errorf("Start() after denial = %v", err)
+	}
+	dir := t.TempDir()
+	if err := guard.Command("rm", "-r", dir).Run(); CodeOf(err) != ErrCodeUnauthorized {
+		t.Errorf("rm with two arguments = %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("denied rm removed %s: %v", dir, err)
+	}
+
+	entries := log.Entries()
+	if len(entries) != 3 || entries[0].Outcome != OutcomeExecuted || entries[1].Outcome != OutcomeDenied || entries[2].Resource != "/bin/rm" {
+		t.Errorf("log = %+v", entries)
+	}
+	ctx := commandContext("tar", "/usr/bin/tar", "", []string{"tar", "-xzf", "--no-same-owner", "a.tar"})
+	flags := ctx["flag"].(map[string]interface{})
+	if ctx["argc"] != 3 || ctx["arg3"] != "a.tar" || flags["x"] != true || flags["f"] != true || flags["no_same_owner"] != true {
+		t.Errorf("commandContext() = %+v", ctx)
+	}
+}
+
+func TestGuardedFS(t *testing.T) {
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit file.read on '/**'\ndeny file.read on '/secret/**'\npermit file.write on '/out/**' when size <= 16\npermit file.delete on '/out/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: doc, Agent: agentKP})
+	enforcer, _ := NewEnforcer(&EnforcerOptions{Covenant: doc, Log: log})
+
+	dir := t.TempDir()
+	os.MkdirAll(dir+"/secret", 0o700)
+	os.WriteFile(dir+"/secret/key", []byte("k"), 0o600)
+	os.WriteFile(dir+"/notes.txt", []byte("notes"), 0o600)
+	g, err := NewGuardedDir(dir, &GuardedFSOptions{Enforcer: enforcer})
+	if err != nil {
+		t.Fatalf("NewGuardedDir() error: %v", err)
+	}
+
+	if data, err := fs.ReadFile(g, "notes.txt"); err != nil || string(data) != "notes" {
+		t.Errorf("ReadFile(notes.txt) = %q, %v", data, err)
+	}
+	if _, err := g.Open("secret/key"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Open(secret/key) error = %v, want fs.ErrPermission", err)
+	}
+	if _, err := fs.Stat(g, "secret/key"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Stat(secret/key) error = %v, want fs.ErrPermission", err)
+	}
+	if _, err := g.Open("../etc/passwd"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open(../etc/passwd) error = %v, want fs.ErrInvalid", err)
+	}
+
+	if err := g.MkdirAll("out", 0o700); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("MkdirAll(out) error = %v, want fs.ErrPermission", err)
+	}
+	os.Mkdir(dir+"/out", 0o700)
+	if err := g.WriteFile("out/a.txt", []byte("small"), 0o600); err != nil {
+		t.Errorf("WriteFile(out/a.txt) error: %v", err)
+	}
+	if err := g.WriteFile("out/b.txt", bytes.Repeat([]byte("x"), 17), 0o600); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("oversized WriteFile error = %v, want fs.ErrPermission", err)
+	}
+	if err := g.WriteFile("notes.txt", nil, 0o600); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("WriteFile(notes.txt) error = %v, want fs.ErrPermission", err)
+	}
+	if err := g.Remove("notes.txt"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Remove(notes.txt) error = %v, want fs.ErrPermission", err)
+	}
+	if err := g.Remove("out/a.txt"); err != nil {
+		t.Errorf("Remove(out/a.txt) error: %v", err)
+	}
+	if entries, err := fs.ReadDir(g, "out"); err != nil || len(entries) != 0 {
+		t.Errorf("ReadDir(out) = %v, %v", entries, err)
+	}
+
+	var outcomes []ActionOutcome
+	for _, e := range log.Entries() {
+		outcomes = append(outcomes, e.Outcome)
+	}
+	want := []ActionOutcome{OutcomeExecuted, OutcomeDenied, OutcomeDenied, OutcomeDenied, OutcomeExecuted, OutcomeDenied, OutcomeDenied, OutcomeDenied, OutcomeExecuted, OutcomeExecuted}
+	if !slices.Equal(outcomes, want) {
+		t.Errorf("logged outcomes = %v, want %v", outcomes, want)
+	}
+	var _ fs.StatFS = g
+}
+
+func TestEgressGuard(t *testing.T) {
+	var sent []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method+" "+r.URL.Path)
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit network.http.get on '/127.0.0.1/**'\npermit network.http.post on '/127.0.0.1/api/**' when content_length <= 8\nlimit network.http.** 3 per 1 hours",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: doc, Agent: agentKP})
+	enforcer, _ := NewEnforcer(&EnforcerOptions{Covenant: doc, Log: log})
+	guard, err := NewEgressGuard(&EgressGuardOptions{Enforcer: enforcer})
+	if err != nil {
+		t.Fatalf("NewEgressGuard() error: %v", err)
+	}
+	client := &http.Client{Transport: guard}
+
+	resp, err := client.Get(upstream.URL + "/docs/../index.html")
+	if err != nil {
+		t.Fatalf("permitted GET error: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := client.Post(upstream.URL+"/api/items", "text/plain", strings.NewReader("a long request body")); CodeOf(err) != ErrCodeUnauthorized {
+		t.Errorf("oversized POST error = %v", err)
+	}
+	resp, err = client.Post(upstream.URL+"/api/items", "text/plain", strings.NewReader("small"))
+	if err != nil {
+		t.Fatalf("permitted POST error: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := client.Get(strings.Replace(upstream.URL, "127.0.0.1", "localhost", 1)); CodeOf(err) != ErrCodeUnauthorized {
+		t.Errorf("GET to another host error = %v", err)
+	}
+	resp, err = client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("third permitted request error: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := client.Get(upstream.URL); CodeOf(err) != ErrCodeUnauthorized {
+		t.Errorf("request over the limit error = %v", err)
+	}
+
+	if want := []string{"GET /docs/../index.html", "POST /api/items", "GET /"}; !slices.Equal(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+	entries := log.Entries()
+	if len(entries) != 6 || entries[0].Action != "network.http.get" || entries[0].Resource != "/127.0.0.1/index.html" {
+		t.Errorf("log = %+v", entries)
+	}
+}
+
+func TestDecisionCache(t *testing.T) {
+	doc, _ := buildTestCovenant(t)
+	now := time.Now()
+	cache, err := NewDecisionCache(&DecisionCacheOptions{Size: 2, TTL: time.Minute, Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatalf("NewDecisionCache() error: %v", err)
+	}
+	enforcer, err := NewEnforcer(&EnforcerOptions{Covenant: doc, Cache: cache})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	check := func(action, resource string, evalContext map[string]interface{}, want bool) {
+		t.Helper()
+		d, err := enforcer.Check(ctx, action, resource, evalContext)
+		if err != nil || d.Permitted != want || want && d.MatchedRule == nil {
+			t.Fatalf("Check(%s, %s) = %+v, %v", action, resource, d, err)
+		}
+	}
+	stats := func(wantHits, wantMisses int64) {
+		t.Helper()
+		if hits, misses := cache.Stats(); hits != wantHits || misses != wantMisses {
+			t.Errorf("Stats() = %d hits, %d misses, want %d, %d", hits, misses, wantHits, wantMisses)
+		}
+	}
+
+	check("read", "/data/a", map[string]interface{}{"n": 1}, true)
+	check("read", "/data/a", map[string]interface{}{"n": 1}, true)
+	stats(1, 1)
+	check("read", "/data/a", map[string]interface{}{"n": 2}, true)
+	check("write", "/data/a", nil, false)
+	check("write", "/data/a", nil, false)
+	stats(2, 3)
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+	// The least recently used evaluation was evicted.
+	check("read", "/data/a", map[string]interface{}{"n": 1}, true)
+	stats(2, 4)
+
+	now = now.Add(2 * time.Minute)
+	check("write", "/data/a", nil, false)
+	stats(2, 5)
+
+	cache.Invalidate(doc.ID)
+	if cache.Len() != 0 {
+		t.Errorf("Len() after Invalidate = %d, want 0", cache.Len())
+	}
+	if _, err := NewDecisionCache(&DecisionCacheOptions{}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("zero size code = %q, want %q", CodeOf(err), ErrCodeInvalidInput)
+	}
+}
+
+func TestEnforcerObligationHandlers(t *testing.T) {
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit write on '/data/**'\npermit audit.log on '/data/**'\nrequire audit.* on '/data/secret/**'\nrequire notify.owner on '/data/shared/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: doc, Agent: agentKP})
+	var shipped []string
+	enforcer, err := NewEnforcer(&EnforcerOptions{
+		Covenant: doc,
+		Log:      log,
+		ObligationHandlers: map[string]ObligationHandler{
+			"audit.log": func(ctx context.Context, ob EnforcedObligation) error {
+				shipped = append(shipped, ob.Trigger)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	d, err := enforcer.Check(ctx, "write", "/data/secret/x", nil)
+	if err != nil || !d.Permitted {
+		t.Fatalf("Check() = %+v, %v", d, err)
+	}
+	if len(d.Handled) != 1 || d.Handled[0].Err != nil || d.Handled[0].Action != "audit.log" || len(d.Handled[0].Fulfillment.Fulfilled) != 1 {
+		t.Fatalf("Handled = %+v", d.Handled)
+	}
+	if !slices.Equal(shipped, []string{"write on /data/secret/x"}) || len(enforcer.Obligations()) != 0 {
+		t.Errorf("shipped %v, pending %+v", shipped, enforcer.Obligations())
+	}
+	if entries := log.Entries(); len(entries) != 2 || entries[1].Action != "audit.log" || entries[1].Resource != "/data/secret/x" {
+		t.Errorf("log = %+v", entries)
+	}
+
+	failing := errors.New("audit sink unavailable")
+	enforcer.OnObligation("audit.log", func(ctx context.Context, ob EnforcedObligation) error { return failing })
+	enforcer.OnObligation("notify.owner", func(ctx context.Context, ob EnforcedObligation) error { return nil })
+	d, _ = enforcer.Check(ctx, "write", "/data/secret/y", nil)
+	if len(d.Handled) != 1 || !errors.Is(d.Handled[0].Err, failing) || d.Handled[0].Fulfillment != nil {
+		t.Errorf("failing handler: %+v", d.Handled)
+	}
+	d, _ = enforcer.Check(ctx, "write", "/data/shared/z", nil)
+	if len(d.Handled) != 1 || CodeOf(d.Handled[0].Err) != ErrCodeUnauthorized {
+		t.Errorf("unpermitted fulfilment: %+v", d.Handled)
+	}
+	if n := len(enforcer.Obligations()); n != 2 {
+		t.Errorf("pending obligations = %d, want 2", n)
+	}
+
+	enforcer.OnObligation("audit.log", nil)
+	d, err = enforcer.Check(ctx, "write", "/data/secret/w", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Handled) != 0 {
+		t.Errorf("removed handler ran: %+v", d.Handled)
+	}
+}
+
+func TestPDPHandler(t *testing.T) {
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	root, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'\nlimit read 2 per 1 hours",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'\npermit write on '/data/**'\nrequire audit.log on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+		Chain:       &ChainReference{ParentID: root.ID, Relation: "delegates", Depth: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryStore()
+	store.Put(root.ID, root)
+	store.Put(leaf.ID, leaf)
+	srv := httptest.NewServer(NewPDPHandler(&PDPHandlerOptions{
+		Store: store,
+		Authorize: func(r *http.Request, endpoint, covenantID string) error {
+			if r.Header.Get("Authorization") != "Bearer agent" {
+				return errors.New("bad token")
+			}
+			return nil
+		},
+	}))
+	defer srv.Close()
+
+	post := func(path string, body interface{}, token string, out interface{}) int {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, bytes.NewReader(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	var d PDPDecision
+	if status := post("/v1/decide", PDPDecideRequest{CovenantID: leaf.ID, Action: "read", Resource: "/data/a"}, "agent", &d); status != http.StatusOK || !d.Permitted || d.Rule != "permit read on '/data/**'" {
+		t.Fatalf("decide = %d %+v", status, d)
+	}
+	if len(d.Obligations) != 1 || d.Obligations[0].Action != "audit.log" || d.RateLimit == nil || d.RateLimit.Remaining != 1 {
+		t.Errorf("decision = %+v", d)
+	}
+	post("/v1/decide", PDPDecideRequest{CovenantID: leaf.ID, Action: "read", Resource: "/data/a"}, "agent", nil)
+	d = PDPDecision{}
+	if post("/v1/decide", PDPDecideRequest{CovenantID: leaf.ID, Action: "read", Resource: "/data/a"}, "agent", &d); d.Permitted || d.DecidedBy != root.ID {
+		t.Errorf("over the root's limit: %+v", d)
+	}
+	d = PDPDecision{}
+	if post("/v1/decide", PDPDecideRequest{CovenantID: leaf.ID, Action: "write", Resource: "/data/a"}, "agent", &d); d.Permitted {
+		t.Errorf("write not permitted by the root: %+v", d)
+	}
+
+	var body logErrorBody
+	if status := post("/v1/decide", PDPDecideRequest{CovenantID: leaf.ID, Action: "read"}, "other", &body); status != http.StatusForbidden || body.Code != ErrCodeUnauthorized {
+		t.Errorf("unauthenticated decide = %d %+v", status, body)
+	}
+	if status := post("/v1/decide", PDPDecideRequest{CovenantID: "missing", Action: "read"}, "agent", nil); status != http.StatusNotFound {
+		t.Errorf("unknown covenant status = %d", status)
+	}
+	if status := post("/v1/decide", PDPDecideRequest{CovenantID: leaf.ID}, "agent", nil); status != http.StatusBadRequest {
+		t.Errorf("missing action status = %d", status)
+	}
+
+	var result VerificationResult
+	if status := post("/v1/verify", PDPVerifyRequest{CovenantID: root.ID}, "agent", &result); status != http.StatusOK || !result.Valid {
+		t.Errorf("verify by ID = %d %+v", status, result)
+	}
+	tampered := root.Clone()
+	tampered.Constraints = "permit ** on '**'"
+	result = VerificationResult{}
+	if status := post("/v1/verify", PDPVerifyRequest{Document: tampered}, "agent", &result); status != http.StatusOK || result.Valid {
+		t.Errorf("verify tampered = %d %+v", status, result.Valid)
+	}
+	if status := post("/v1/verify", PDPVerifyRequest{}, "agent", nil); status != http.StatusBadRequest {
+		t.Errorf("empty verify status = %d", status)
+	}
+	resp, err := http.Get(srv.URL + "/v1/decide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /v1/decide status = %d", resp.StatusCode)
+	}
+}
+
+func TestPolicyAgent(t *testing.T) {
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	build := func(constraints string) *CovenantDocument {
+		t.Helper()
+		// CreatedAt has millisecond precision; keep versions ordered.
+		time.Sleep(2 * time.Millisecond)
+		doc, err := BuildCovenant(&CovenantBuilderOptions{
+			Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+			Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+			Constraints: constraints,
+			PrivateKey:  issuerKP.PrivateKey,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	permitted := func(a *PolicyAgent, action string) bool {
+		t.Helper()
+		d, err := a.Check(context.Background(), action, "/data/x", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d.Permitted
+	}
+
+	if _, err := NewPolicyAgent(&PolicyAgentOptions{}); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("NewPolicyAgent without a source: got %v", err)
+	}
+	store := NewMemoryStore()
+	if _, err := NewPolicyAgent(&PolicyAgentOptions{Store: store}); CodeOf(err) != ErrCodeNotFound {
+		t.Errorf("NewPolicyAgent with an empty store: got %v", err)
+	}
+
+	v1 := build("permit read on '/data/**'")
+	store.Put(v1.ID, v1)
+	var swaps []string
+	agent, err := NewPolicyAgent(&PolicyAgentOptions{
+		Store:  store,
+		OnSwap: func(oldID, newID string) { swaps = append(swaps, oldID+">"+newID) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent.CovenantID() != v1.ID || !permitted(agent, "read") || permitted(agent, "write") {
+		t.Fatalf("agent should enforce v1, got %s", shortID(agent.CovenantID()))
+	}
+	if changed, err := agent.Reload(); err != nil || changed {
+		t.Errorf("Reload without an amendment = %v, %v", changed, err)
+	}
+
+	v2 := build("permit read on '/data/**'\npermit write on '/data/**'")
+	store.Put(v2.ID, v2)
+	before := agent.Enforcer()
+	if changed, err := agent.Reload(); err != nil || !changed {
+		t.Fatalf("Reload after an amendment = %v, %v", changed, err)
+	}
+	if agent.CovenantID() != v2.ID || !permitted(agent, "write") {
+		t.Errorf("agent should enforce v2, got %s", shortID(agent.CovenantID()))
+	}
+	if before.covenant.ID != v1.ID {
+		t.Error("the swapped-out enforcer should keep its covenant")
+	}
+	if len(swaps) != 2 || swaps[0] != ">"+v1.ID || swaps[1] != v1.ID+">"+v2.ID {
+		t.Errorf("swaps = %v", swaps)
+	}
+
+	// A tampered amendment is rejected and the active policy kept.
+	v3 := build("deny write on '/data/**'")
+	tampered := *v3
+	tampered.Constraints = "permit ** on '/**'"
+	store.Put(tampered.ID, &tampered)
+	if _, err := agent.Reload(); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("Reload of a tampered covenant: got %v", err)
+	}
+	if agent.CovenantID() != v2.ID || !permitted(agent, "write") || permitted(agent, "delete") {
+		t.Error("agent should keep enforcing v2")
+	}
+
+	// Polling picks up amendments.
+	store.Put(v3.ID, v3)
+	agent.opts.Interval = 5 * time.Millisecond
+	agent.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for agent.CovenantID() != v3.ID && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	agent.Stop()
+	agent.Stop()
+	if agent.CovenantID() != v3.ID || permitted(agent, "write") {
+		t.Errorf("polling agent should enforce v3, got %s", shortID(agent.CovenantID()))
+	}
+
+	// A file source is re-read on each reload.
+	path := t.TempDir() + "/covenant.json"
+	writeCovenant := func(doc *CovenantDocument) {
+		t.Helper()
+		data, err := SerializeCovenant(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeCovenant(v1)
+	fileAgent, err := NewPolicyAgent(&PolicyAgentOptions{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileAgent.CovenantID() != v1.ID {
+		t.Errorf("file agent should enforce v1, got %s", shortID(fileAgent.CovenantID()))
+	}
+	writeCovenant(v2)
+	if changed, err := fileAgent.Reload(); err != nil || !changed || fileAgent.CovenantID() != v2.ID {
+		t.Errorf("file Reload = %v, %v, enforcing %s", changed, err, shortID(fileAgent.CovenantID()))
+	}
+	os.Remove(path)
+	if _, err := fileAgent.Reload(); CodeOf(err) != ErrCodeStorage || fileAgent.CovenantID() != v2.ID {
+		t.Errorf("Reload of a missing file: got %v", err)
+	}
+}
+
+func TestEnforcerViolations(t *testing.T) {
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'\npermit write on '/data/**'\npermit audit.log on '/data/**'\nlimit read 1 per 1 hours\nrequire audit.log on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: doc, Agent: agentKP})
+	now := time.Now()
+	events := make(chan Violation, 10)
+	var seen []Violation
+	enforcer, err := NewEnforcer(&EnforcerOptions{
+		Covenant:         doc,
+		Log:              log,
+		ObligationWindow: time.Minute,
+		OnViolation:      func(v Violation) { seen = append(seen, v) },
+		Violations:       events,
+		Now:              func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	d, err := enforcer.Check(ctx, "read", "/data/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Permitted || len(d.Violations) != 0 || len(d.Obligations) != 1 || d.Obligations[0].TriggerIndex != 0 {
+		t.Fatalf("permitted read: %+v", d)
+	}
+	d, _ = enforcer.Check(ctx, "delete", "/data/a", nil)
+	if d.Permitted || len(d.Violations) != 1 {
+		t.Fatalf("denied delete: %+v", d)
+	}
+	if v := d.Violations[0]; v.Kind != ViolationUnpermitted || v.CovenantID != doc.ID || v.Action != "delete" || v.Resource != "/data/a" || v.LogIndex != 1 || v.Message == "" {
+		t.Errorf("unpermitted violation = %+v", v)
+	}
+	d, _ = enforcer.Check(ctx, "read", "/data/b", nil)
+	if d.Permitted || len(d.Violations) != 1 {
+		t.Fatalf("rate limited read: %+v", d)
+	}
+	if v := d.Violations[0]; v.Kind != ViolationRateLimit || v.Rule != "limit read 1 per 1 hours" || v.LogIndex != 2 {
+		t.Errorf("rate limit violation = %+v", v)
+	}
+
+	// The read's obligation falls due unfulfilled and is reported once.
+	now = now.Add(2 * time.Minute)
+	if vs, err := enforcer.CheckObligations(ctx); err != nil || len(vs) != 1 || vs[0].Kind != ViolationObligation || vs[0].LogIndex != 0 || vs[0].Action != "audit.log" || vs[0].Resource != "/data/a" || vs[0].Rule != "require audit.log on '/data/**'" {
+		t.Errorf("CheckObligations() = %+v", vs)
+	}
+	d, _ = enforcer.Check(ctx, "write", "/data/c", nil)
+	if !d.Permitted || len(d.Violations) != 0 {
+		t.Errorf("overdue obligation reported twice: %+v", d.Violations)
+	}
+	if vs, _ := enforcer.CheckObligations(ctx); len(vs) != 0 {
+		t.Error("CheckObligations() should not report an obligation twice")
+	}
+
+	if len(seen) != 3 || len(events) != 3 {
+		t.Fatalf("OnViolation saw %d, channel got %d, want 3", len(seen), len(events))
+	}
+	for i, kind := range []ViolationKind{ViolationUnpermitted, ViolationRateLimit, ViolationObligation} {
+		if v := <-events; v.Kind != kind || seen[i].Kind != kind {
+			t.Errorf("violation %d = %s/%s, want %s", i, v.Kind, seen[i].Kind, kind)
+		}
+	}
+
+	// A full channel does not block past the check's context.
+	full, _ := NewEnforcer(&EnforcerOptions{Covenant: doc, Violations: make(chan Violation)})
+	cancelled, cancel := context.WithCancel(ctx)
+	go cancel()
+	if d, err := full.Check(cancelled, "delete", "/data/a", nil); err == nil && (d.Permitted || d.Violations[0].LogIndex != -1) {
+		t.Errorf("unlogged violation: %+v", d)
+	}
+}
+
+func TestEnforcerKillSwitch(t *testing.T) {
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'\npermit audit.log on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEnforcer(&EnforcerOptions{Covenant: doc, KillSwitch: &KillSwitchOptions{Threshold: 2, Window: time.Minute}}); CodeOf(err) != ErrCodeInvalidPrivateKey {
+		t.Errorf("kill switch without a signer: got %v", err)
+	}
+	if _, err := NewEnforcer(&EnforcerOptions{Covenant: doc, KillSwitch: &KillSwitchOptions{Window: time.Minute, Signer: issuerKP}}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("kill switch without a threshold: got %v", err)
+	}
+
+	now := time.Now()
+	var suspensions []*SuspensionRecord
+	enforcer, err := NewEnforcer(&EnforcerOptions{
+		Covenant: doc,
+		KillSwitch: &KillSwitchOptions{
+			Threshold: 3,
+			Window:    time.Minute,
+			SafeList:  []string{"audit.**"},
+			Signer:    issuerKP,
+			OnSuspend: func(r *SuspensionRecord) { suspensions = append(suspensions, r) },
+		},
+		Now: func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	check := func(action string) *EnforcementDecision {
+		t.Helper()
+		d, err := enforcer.Check(ctx, action, "/data/x", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	// Violations that fall out of the window do not count.
+	check("delete")
+	check("delete")
+	now = now.Add(2 * time.Minute)
+	if d := check("delete"); d.Suspension != nil || enforcer.Suspension() != nil {
+		t.Fatal("kill switch tripped by violations outside its window")
+	}
+	check("delete")
+	d := check("delete")
+	if d.Suspension == nil || enforcer.Suspension() != d.Suspension || len(suspensions) != 1 {
+		t.Fatalf("kill switch should trip on the third violation: %+v", d)
+	}
+	r := d.Suspension
+	if r.CovenantID != doc.ID || len(r.Violations) != 3 || r.SignerPublicKey != issuerKP.PublicKeyHex {
+		t.Errorf("suspension record = %+v", r)
+	}
+	if err := VerifySuspensionRecord(r); err != nil {
+		t.Errorf("VerifySuspensionRecord() error: %v", err)
+	}
+	data, _ := json.Marshal(r)
+	var decoded SuspensionRecord
+	if err := json.Unmarshal(data, &decoded); err != nil || VerifySuspensionRecord(&decoded) != nil {
+		t.Errorf("decoded suspension record does not verify: %v", err)
+	}
+	decoded.Reason = "nothing happened"
+	if CodeOf(VerifySuspensionRecord(&decoded)) != ErrCodeCrypto {
+		t.Error("tampered suspension record should not verify")
+	}
+
+	// Only safe-listed actions the covenant permits are allowed.
+	if d := check("read"); d.Permitted || !strings.Contains(d.Reason, "suspended") || len(d.Violations) != 0 {
+		t.Errorf("read during suspension: %+v", d)
+	}
+	if d := check("audit.log"); !d.Permitted {
+		t.Errorf("safe-listed audit.log during suspension: %+v", d)
+	}
+	if d := check("audit.erase"); d.Permitted || len(d.Violations) != 1 {
+		t.Errorf("safe-listed action the covenant denies: %+v", d)
+	}
+	if len(suspensions) != 1 {
+		t.Errorf("suspended %d times, want 1", len(suspensions))
+	}
+
+	// Suspension lasts until an operator resets it.
+	now = now.Add(time.Hour)
+	if check("read").Permitted {
+		t.Error("suspension should not lapse on its own")
+	}
+	enforcer.Reset()
+	if enforcer.Suspension() != nil || !check("read").Permitted {
+		t.Error("Reset() should lift the suspension")
+	}
+	check("delete")
+	if check("delete").Suspension != nil {
+		t.Error("Reset() should clear counted violations")
+	}
+
+	// A persisted suspension survives a restart.
+	restarted, err := NewEnforcer(&EnforcerOptions{
+		Covenant:   doc,
+		KillSwitch: &KillSwitchOptions{Threshold: 3, Window: time.Minute, Signer: issuerKP, Suspension: r},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := restarted.Check(ctx, "read", "/data/x", nil); d.Permitted || restarted.Suspension() != r {
+		t.Errorf("restarted enforcer should be suspended: %+v", d)
+	}
+	restarted.Reset()
+	if d, _ := restarted.Check(ctx, "read", "/data/x", nil); !d.Permitted {
+		t.Errorf("Reset() should lift a persisted suspension: %+v", d)
+	}
+	if _, err := NewEnforcer(&EnforcerOptions{Covenant: doc, KillSwitch: &KillSwitchOptions{Threshold: 3, Window: time.Minute, Signer: agentKP, Suspension: r}}); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("suspension signed by another key: got %v", err)
+	}
+	if _, err := NewEnforcer(&EnforcerOptions{Covenant: doc, KillSwitch: &KillSwitchOptions{Threshold: 3, Window: time.Minute, Signer: issuerKP, Suspension: &decoded}}); CodeOf(err) != ErrCodeCrypto {
+		t.Errorf("tampered suspension: got %v", err)
+	}
+}
+
+func TestPolicyAgentKeepsSuspension(t *testing.T) {
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	build := func(constraints string) *CovenantDocument {
+		t.Helper()
+		time.Sleep(2 * time.Millisecond)
+		doc, err := BuildCovenant(&CovenantBuilderOptions{
+			Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+			Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+			Constraints: constraints,
+			PrivateKey:  issuerKP.PrivateKey,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	store := NewMemoryStore()
+	v1 := build("permit read on '/data/**'")
+	store.Put(v1.ID, v1)
+	agent, err := NewPolicyAgent(&PolicyAgentOptions{
+		Store:    store,
+		Enforcer: EnforcerOptions{KillSwitch: &KillSwitchOptions{Threshold: 1, Window: time.Minute, Signer: issuerKP}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	d, err := agent.Check(ctx, "delete", "/data/x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Suspension == nil {
+		t.Fatalf("kill switch should trip: %+v", d)
+	}
+
+	// Swapping in an amended covenant does not lift the suspension.
+	v2 := build("permit read on '/data/**'\npermit write on '/data/**'")
+	store.Put(v2.ID, v2)
+	if changed, err := agent.Reload(); err != nil || !changed {
+		t.Fatalf("Reload() = %v, %v", changed, err)
+	}
+	d, err = agent.Check(ctx, "read", "/data/x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Permitted || agent.Enforcer().Suspension() == nil {
+		t.Errorf("swapped-in enforcer should stay suspended: %+v", d)
+	}
+	agent.Enforcer().Reset()
+	d, err = agent.Check(ctx, "write", "/data/x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Permitted {
+		t.Errorf("Reset() should lift the suspension: %+v", d)
+	}
+	if agent.opts.Enforcer.KillSwitch.Suspension != nil {
+		t.Error("the agent's options should not be modified")
+	}
+}
+
+func TestEvaluationBudget(t *testing.T) {
+	ctx := context.Background()
+	budget := DefaultEvaluationBudget()
+	ordinary, err := Parse("permit read on '/data/**'\ndeny read on '/data/secret/**'\nrequire audit.log on '/data/**' when risk > 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, resource := range []string{"/data/a", "/data/secret/a", "/other"} {
+		want := Evaluate(ordinary, "read", resource, map[string]interface{}{"risk": 7})
+		got, err := EvaluateWithBudget(ctx, ordinary, "read", resource, map[string]interface{}{"risk": 7}, budget)
+		if err != nil || got.Permitted != want.Permitted || got.Reason != want.Reason || len(got.AllMatches) != len(want.AllMatches) {
+			t.Errorf("EvaluateWithBudget(%s) = %+v, %v, want %+v", resource, got, err, want)
+		}
+	}
+
+	// Many ** segments make matching exponential in the resource length.
+	pathological, err := Parse("permit read on '/" + strings.Repeat("**/a/", 20) + "b'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource := "/" + strings.Repeat("a/", 40) + "c"
+	if _, err := EvaluateWithBudget(ctx, pathological, "read", resource, nil, budget); CodeOf(err) != ErrCodeBudgetExceeded {
+		t.Errorf("pathological pattern: got %v", err)
+	}
+
+	deep := "/data/" + strings.Repeat("x/", 300)
+	if r, err := EvaluateWithBudget(ctx, ordinary, "read", deep, nil, nil); err != nil || !r.Permitted {
+		t.Errorf("unlimited budget: %+v, %v", r, err)
+	}
+	if _, err := EvaluateWithBudget(ctx, ordinary, "read", deep, nil, budget); CodeOf(err) != ErrCodeBudgetExceeded {
+		t.Errorf("deep resource: got %v", err)
+	}
+	if _, err := EvaluateWithBudget(ctx, ordinary, "read", "/data/a", nil, &EvaluationBudget{MaxStatements: 2}); CodeOf(err) != ErrCodeBudgetExceeded {
+		t.Errorf("too many statements: got %v", err)
+	}
+	nested := map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{1, 2}}, "c": 3}
+	if _, err := EvaluateWithBudget(ctx, ordinary, "read", "/data/a", nested, &EvaluationBudget{MaxContextSize: 4}); CodeOf(err) != ErrCodeBudgetExceeded {
+		t.Errorf("oversized context: got %v", err)
+	}
+	if _, err := EvaluateWithBudget(ctx, ordinary, "read", "/data/a", nested, &EvaluationBudget{MaxContextSize: 5}); err != nil {
+		t.Errorf("context within budget: %v", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := EvaluateWithBudget(cancelled, ordinary, "read", "/data/a", nil, nil); CodeOf(err) != ErrCodeBudgetExceeded || !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled evaluation: got %v", err)
+	}
+
+	// Enforcers fail checks that exceed their budget.
+	doc, _ := buildTestCovenant(t)
+	enforcer, err := NewEnforcer(&EnforcerOptions{Covenant: doc, Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := enforcer.Check(ctx, "read", "/data/a", nil); err != nil || !d.Permitted {
+		t.Errorf("Check() within budget = %+v, %v", d, err)
+	}
+	if _, err := enforcer.Check(ctx, "read", deep, nil); CodeOf(err) != ErrCodeBudgetExceeded {
+		t.Errorf("Check() over budget: got %v", err)
+	}
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	signer, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWebhookDispatcher(&WebhookDispatcherOptions{Signer: signer}); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("dispatcher without endpoints: got %v", err)
+	}
+
+	// The receiver fails the first attempt at every event.
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	var received []*WebhookEvent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ev, err := VerifyWebhook(body, r.Header.Get(WebhookSignatureHeader), signer.PublicKey)
+		if err != nil || r.Header.Get(WebhookIDHeader) != ev.ID || r.Header.Get(WebhookSignerHeader) != signer.PublicKeyHex {
+			t.Errorf("invalid webhook request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := VerifyWebhook(bytes.Replace(body, []byte(ev.ID), []byte("x"), 1), r.Header.Get(WebhookSignatureHeader), signer.PublicKey); CodeOf(err) != ErrCodeCrypto {
+			t.Errorf("tampered webhook body verified: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts[ev.ID]++; attempts[ev.ID] == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received = append(received, ev)
+	}))
+	defer receiver.Close()
+	rejecter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecter.Close()
+
+	deliveries := make(chan WebhookDelivery, 16)
+	d, err := NewWebhookDispatcher(&WebhookDispatcherOptions{
+		Endpoints: []WebhookEndpoint{
+			{URL: receiver.URL},
+			{URL: rejecter.URL, Events: []WebhookEventType{WebhookViolation}},
+		},
+		Signer:     signer,
+		Backoff:    time.Millisecond,
+		OnDelivery: func(dl WebhookDelivery) { deliveries <- dl },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Store writes.
+	store, err := NewWebhookStore(NewMemoryStore(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, _ := buildTestCovenant(t)
+	if err := store.Put(doc.ID, doc); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := CountersignCovenant(doc, agentKP, "auditor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put(signed.ID, signed)
+	store.Put(signed.ID, signed) // no new countersignature, no event
+	if err := store.Delete(doc.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Violations and expiry.
+	enforcer, err := NewEnforcer(&EnforcerOptions{Covenant: doc, Webhooks: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enforcer.Check(context.Background(), "delete", "/nowhere", nil); err != nil {
+		t.Fatal(err)
+	}
+	expiring := buildTimedCovenant(t, "", time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+	expiries := NewMemoryStore()
+	expiries.Put(expiring.ID, expiring)
+	monitor, _ := NewExpiryMonitor(&ExpiryMonitorOptions{Store: expiries, Webhooks: d})
+	if _, err := monitor.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Start()
+	defer d.Stop()
+	var rejected []WebhookDelivery
+	for i := 0; i < 6; i++ {
+		select {
+		case dl := <-deliveries:
+			if dl.Endpoint == rejecter.URL {
+				rejected = append(rejected, dl)
+			} else if dl.Err != nil || dl.Attempts != 2 || dl.StatusCode != http.StatusOK {
+				t.Errorf("delivery of %s = %+v", dl.Event.Type, dl)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %d deliveries", i)
+		}
+	}
+	d.Stop()
+
+	// A 400 is final, and the rejecter only subscribed to violations.
+	if len(rejected) != 1 || rejected[0].Event.Type != WebhookViolation || rejected[0].Attempts != 1 || CodeOf(rejected[0].Err) != ErrCodeWebhook {
+		t.Errorf("rejected deliveries = %+v", rejected)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []WebhookEventType{WebhookCovenantCreated, WebhookCovenantCountersigned, WebhookCovenantRevoked, WebhookViolation, WebhookCovenantExpired}
+	if len(received) != len(want) {
+		t.Fatalf("received %d events, want %d", len(received), len(want))
+	}
+	for i, ev := range received {
+		if ev.Type != want[i] {
+			t.Errorf("event %d = %s, want %s", i, ev.Type, want[i])
+		}
+	}
+	if ev := received[1]; ev.CovenantID != doc.ID || ev.Countersignature == nil || ev.Countersignature.SignerPublicKey != agentKP.PublicKeyHex {
+		t.Errorf("countersigned event = %+v", ev)
+	}
+	if ev := received[3]; ev.Violation == nil || ev.Violation.Kind != ViolationUnpermitted || ev.Violation.Action != "delete" {
+		t.Errorf("violation event = %+v", ev)
+	}
+	if ev := received[4]; ev.CovenantID != expiring.ID || ev.Covenant == nil || ev.Covenant.ID != expiring.ID {
+		t.Errorf("expired event = %+v", ev)
+	}
+	if _, err := VerifyWebhook([]byte(`{}`), "00", issuerKP.PublicKey); CodeOf(err) != ErrCodeCrypto {
+		t.Errorf("unsigned webhook verified: %v", err)
+	}
+
+	// A full queue drops events.
+	full, _ := NewWebhookDispatcher(&WebhookDispatcherOptions{Endpoints: []WebhookEndpoint{{URL: receiver.URL}}, Signer: signer, QueueSize: 1})
+	if err := full.Notify(WebhookEvent{Type: WebhookViolation}); err != nil {
+		t.Fatal(err)
+	}
+	if err := full.Notify(WebhookEvent{Type: WebhookViolation}); CodeOf(err) != ErrCodeWebhook {
+		t.Errorf("notify on a full queue: got %v", err)
+	}
+}
+
+func TestMetricsCollector(t *testing.T) {
+	c := NewCollector()
+	SetMetrics(c)
+	defer SetMetrics(nil)
+
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	doc, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'\nlimit read 1 per 1 hours",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := NewActionLog(&ActionLogOptions{Covenant: doc, Agent: agentKP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforcer, err := NewEnforcer(&EnforcerOptions{Covenant: doc, Log: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, resource := range []string{"/data/a", "/data/b", "/other"} {
+		if _, err := enforcer.Check(context.Background(), "read", resource, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tampered := *doc
+	tampered.Constraints = "permit ** on '/**'"
+	if _, err := VerifyCovenant(&tampered); err != nil {
+		t.Fatal(err)
+	}
+	store, _ := NewMetricsStore(NewMemoryStore())
+	store.Put(doc.ID, doc)
+	store.Delete("missing")
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("content type = %q", rec.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		"# TYPE grith_evaluation_duration_seconds histogram\n",
+		`grith_evaluation_duration_seconds_count{outcome="permitted"} 2` + "\n",
+		`grith_evaluation_duration_seconds_count{outcome="denied"} 1` + "\n",
+		`grith_evaluation_duration_seconds_bucket{outcome="denied",le="+Inf"} 1` + "\n",
+		`grith_verification_check_failures_total{check="id_match"} 1` + "\n",
+		`grith_verification_check_failures_total{check="signature_valid"} 1` + "\n",
+		`grith_store_operation_duration_seconds_count{op="put"} 1` + "\n",
+		`grith_store_operation_errors_total{op="delete"} 1` + "\n",
+		`grith_rate_limit_rejections_total{action="read"} 1` + "\n",
+		"grith_log_appends_total 3\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q:\n%s", want, out)
+		}
+	}
 
-	// Re-retrieve should be unaffected
-	retrieved2, _ := store.Get(doc.ID)
-	if retrieved2.Constraints == "also mutated" {
-		t.Error("store should defensively copy on Get()")
+	// Uninstalled metrics observe nothing.
+	SetMetrics(nil)
+	Evaluate(&CCLDocument{}, "read", "/x", nil)
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil || buf.String() != out {
+		t.Errorf("observation after SetMetrics(nil): %v", err)
 	}
 }
 
-func TestMemoryStoreClear(t *testing.T) {
-	store := NewMemoryStore()
+// testTracer records spans with the name of their parent.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+type testSpan struct {
+	name, parent string
+	attrs        map[string]interface{}
+	err          error
+	ended        bool
+}
+
+type testSpanKey struct{}
+
+func (tr *testTracer) Start(ctx context.Context, name string, attrs ...TraceAttribute) (context.Context, Span) {
+	s := &testSpan{name: name, attrs: make(map[string]interface{})}
+	if parent, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		s.parent = parent.name
+	}
+	s.SetAttributes(attrs...)
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, s)
+	tr.mu.Unlock()
+	return context.WithValue(ctx, testSpanKey{}, s), s
+}
+
+func (s *testSpan) SetAttributes(attrs ...TraceAttribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+func (s *testSpan) RecordError(err error) { s.err = err }
+func (s *testSpan) End()                  { s.ended = true }
+
+func (tr *testTracer) find(name string) []*testSpan {
+	var spans []*testSpan
+	for _, s := range tr.spans {
+		if s.name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	tr := &testTracer{}
+	SetTracer(tr)
+	defer SetTracer(nil)
+	ctx, root := tr.Start(context.Background(), "request")
+
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	parent, err := BuildCovenantContext(ctx, &CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := BuildCovenant(&CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/public/**'",
+		PrivateKey:  issuerKP.PrivateKey,
+		Chain:       &ChainReference{ParentID: parent.ID, Relation: "delegates", Depth: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	builds := tr.find(SpanBuildCovenant)
+	if len(builds) != 2 || builds[0].parent != "request" || builds[0].attrs["grith.covenant_id"] != parent.ID || builds[1].parent != "" || !builds[1].ended {
+		t.Errorf("build spans = %+v", builds)
+	}
+
+	tampered := *child
+	tampered.Constraints = "permit ** on '/**'"
+	if _, err := VerifyCovenantContext(ctx, &tampered, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v := tr.find(SpanVerifyCovenant); len(v) != 1 || v[0].parent != "request" || v[0].attrs["grith.valid"] != false || !strings.Contains(v[0].attrs["grith.failed_checks"].(string), "signature_valid") {
+		t.Errorf("verify spans = %+v", v)
+	}
+
+	base, _ := NewTracingStore(NewMemoryStore())
+	store := base.WithContext(ctx)
+	store.Put(parent.ID, parent)
+	store.Put(child.ID, child)
+	ancestors, err := ResolveChain(ctx, store, child)
+	if err != nil || len(ancestors) != 1 {
+		t.Fatalf("ResolveChain = %v, %v", ancestors, err)
+	}
+	if r := tr.find(SpanResolveChain); len(r) != 1 || r[0].attrs["grith.chain_depth"] != int64(1) {
+		t.Errorf("resolve spans = %+v", r)
+	}
+	if gets := tr.find(SpanStorePrefix + StoreOpGet); len(gets) != 1 || gets[0].parent != "request" || gets[0].attrs["grith.found"] != true {
+		t.Errorf("store get spans = %+v", gets)
+	}
+	if err := store.Delete("missing"); err == nil {
+		t.Fatal("deleting a missing document succeeded")
+	}
+	if dels := tr.find(SpanStorePrefix + StoreOpDelete); len(dels) != 1 || dels[0].err == nil {
+		t.Errorf("store delete spans = %+v", dels)
+	}
+
+	log, _ := NewActionLog(&ActionLogOptions{Covenant: child, Agent: agentKP})
+	enforcer, err := NewEnforcer(&EnforcerOptions{Covenant: child, Ancestors: ancestors, Log: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enforcer.Check(ctx, "read", "/data/public/x", nil); err != nil {
+		t.Fatal(err)
+	}
+	checks := tr.find(SpanEnforcerCheck)
+	if len(checks) != 1 || checks[0].parent != "request" || checks[0].attrs["grith.permitted"] != true || !checks[0].ended {
+		t.Errorf("check spans = %+v", checks)
+	}
+	if evals := tr.find(SpanEvaluate); len(evals) != 2 || evals[0].parent != SpanEnforcerCheck || evals[0].attrs["grith.action"] != "read" {
+		t.Errorf("evaluate spans = %+v", evals)
+	}
+	if appends := tr.find(SpanLogAppend); len(appends) != 1 || appends[0].parent != SpanEnforcerCheck || appends[0].attrs["grith.outcome"] != string(OutcomeExecuted) {
+		t.Errorf("log append spans = %+v", appends)
+	}
+	root.End()
+
+	SetTracer(nil)
+	n := len(tr.spans)
+	if _, err := VerifyCovenantContext(ctx, parent, nil); err != nil || len(tr.spans) != n {
+		t.Errorf("spans started without a tracer: %v", err)
+	}
+}
+
+// listErrorStore is a store whose List fails.
+type listErrorStore struct{ *MemoryStore }
+
+func (listErrorStore) List() ([]*CovenantDocument, error) {
+	return nil, errorf(ErrCodeStorage, "grith: store offline")
+}
+
+func TestStructuredLogging(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer SetLogger(nil)
+	records := func() []map[string]interface{} {
+		var out []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var r map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				t.Fatalf("log line %q: %v", line, err)
+			}
+			out = append(out, r)
+		}
+		buf.Reset()
+		return out
+	}
+
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	opts := &CovenantBuilderOptions{
+		Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'\npermit read",
+		PrivateKey:  issuerKP.PrivateKey,
+	}
+	_, err := BuildCovenant(opts)
+	var syntax *CCLSyntaxError
+	if !errors.As(err, &syntax) || syntax.Line != 2 {
+		t.Fatalf("BuildCovenant error = %v, want a syntax error on line 2", err)
+	}
+	r := records()
+	if len(r) != 1 || r[0]["level"] != "DEBUG" || r[0]["msg"] != "covenant build failed" || r[0]["code"] != string(ErrCodeCCLParse) || r[0]["line"] != float64(2) || r[0]["column"] != float64(syntax.Column) {
+		t.Errorf("build failure records = %v", r)
+	}
+
+	opts.Constraints = "permit read on '/data/**'"
+	doc, err := BuildCovenant(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("successful build logged %q", buf.String())
+	}
+	tampered := *doc
+	tampered.Constraints = "permit ** on '/**'"
+	VerifyCovenant(&tampered)
+	r = records()
+	if len(r) != 2 || r[0]["level"] != "WARN" || r[0]["check"] != "id_match" || r[1]["check"] != "signature_valid" || r[1]["covenant_id"] != doc.ID || r[1]["severity"] != "fatal" {
+		t.Errorf("verification records = %v", r)
+	}
+
+	enforcer, _ := NewEnforcer(&EnforcerOptions{Covenant: doc})
+	enforcer.Check(context.Background(), "delete", "/data/x", nil)
+	r = records()
+	if len(r) != 1 || r[0]["msg"] != "covenant violation" || r[0]["kind"] != string(ViolationUnpermitted) || r[0]["action"] != "delete" {
+		t.Errorf("violation records = %v", r)
+	}
+
+	// Failures of background passes are no longer silent.
+	m, _ := NewExpiryMonitor(&ExpiryMonitorOptions{Store: listErrorStore{NewMemoryStore()}, Interval: time.Hour})
+	m.Start() // the first pass runs before Stop returns
+	m.Stop()
+	r = records()
+	if len(r) == 0 || r[0]["level"] != "ERROR" || r[0]["msg"] != "expiry monitor pass failed" || r[0]["code"] != string(ErrCodeStorage) {
+		t.Errorf("expiry monitor records = %v", r)
+	}
+}
+
+func TestContextBuilder(t *testing.T) {
+	requireReflectJSON(t)
+	type user struct {
+		Role string `json:"role"`
+	}
+	type request struct {
+		Count  int32   `json:"count"`
+		Score  float32 `json:"score"`
+		User   *user   `json:"user"`
+		Secret string  `json:"-"`
+	}
+	// Each condition must hold: a deny matching a failed one overrides.
+	doc, err := Parse("permit read on '/data/**' when count > 3\ndeny read on '/data/**' when score != 0.1\ndeny read on '/data/**' when user.role != 'admin'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := request{Count: 5, Score: 0.1, User: &user{Role: "admin"}, Secret: "x"}
+
+	// A hand-built map with an int32 silently fails the numeric comparison.
+	if Evaluate(doc, "read", "/data/a", map[string]interface{}{"count": req.Count, "score": 0.1, "user": map[string]interface{}{"role": "admin"}}).Permitted {
+		t.Fatal("int32 context value unexpectedly compared")
+	}
+
+	ctx, err := ToContext(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Evaluate(doc, "read", "/data/a", ctx).Permitted {
+		t.Errorf("ToContext(%+v) = %v, want permitted", req, ctx)
+	}
+	if _, ok := ctx["Secret"]; ok {
+		t.Error("ignored field present in context")
+	}
+	if ctx, err = ToContext(&req); err != nil || !Evaluate(doc, "read", "/data/a", ctx).Permitted {
+		t.Errorf("ToContext(pointer) = %v, %v", ctx, err)
+	}
+
+	b := NewContextBuilder[*request]().With("env", "prod").With("count", 1)
+	ctx, err = b.Build(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx["env"] != "prod" || ctx["count"] != float64(5) {
+		t.Errorf("Build = %v, want env and the value's count", ctx)
+	}
+	if ctx, err = b.Build(nil); err != nil || len(ctx) != 2 || ctx["count"] != float64(1) {
+		t.Errorf("Build(nil) = %v, %v", ctx, err)
+	}
+
+	if _, err := ToContext(42); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("ToContext(int) error = %v", err)
+	}
+	if _, err := ToContext(map[string]interface{}{"c": make(chan int)}); CodeOf(err) != ErrCodeSerialization {
+		t.Errorf("ToContext(chan) error = %v", err)
+	}
+	if _, err := NewContextBuilder[request]().With("f", func() {}).Build(req); CodeOf(err) != ErrCodeSerialization {
+		t.Errorf("With(func) error = %v", err)
+	}
+}
+
+func TestReflectionFreeJSON(t *testing.T) {
 	doc, _ := buildTestCovenant(t)
-	store.Put(doc.ID, doc)
+	doc.ConstraintsRef = &ConstraintsRef{Hash: strings.Repeat("a", 64)}
+	doc.Chain = &ChainReference{ParentID: "p", Relation: "delegates", Depth: 2}
+	doc.ExpiresAt = "2030-01-01T00:00:00.000Z"
+	doc.GracePeriod = 60000
+	doc.Metadata = map[string]interface{}{
+		"n": 3, "u": uint8(7), "f32": float32(0.1), "num": json.Number("1e3"),
+		"tags": []string{"a", "b\xff"}, "labels": map[string]string{"k": "v"},
+		"nested":  map[string]interface{}{"list": []interface{}{nil, true, 2.5}, "empty": map[string]interface{}{}},
+		"bad\xfe": "<&> ",
+	}
+	doc.Extensions = map[string]Extension{"x": {Critical: true, Value: []interface{}{"v"}}, "y": {}}
+	doc.Countersignatures = []Countersignature{{SignerPublicKey: "k", SignerRole: "auditor", Signature: "s", Timestamp: "t"}}
+	doc.Transparency = []TransparencyReceipt{
+		{Promise: InclusionPromise{LogID: "l"}, Proof: &InclusionProof{LeafIndex: 1, TreeSize: 2}, TreeHead: &SignedTreeHead{TreeSize: 2}},
+		{},
+	}
+	doc.Anchors = []AnchorProof{{Type: "t", Batch: &BatchProof{Hashes: []string{"h"}}}, {Type: "u"}}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]interface{}
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := objectToMap(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("objectToMap(doc) =\n%v\nwant\n%v", got, want)
+	}
+	if m, err := objectToMap((*CovenantDocument)(nil)); m != nil || err != nil {
+		t.Errorf("objectToMap(nil) = %v, %v", m, err)
+	}
+	// Apart from json.Number literals, which it normalizes, the canonical
+	// form is as long as the serialization.
+	delete(doc.Metadata, "num")
+	data, _ = json.Marshal(doc)
+	if size, err := documentSize(doc); err != nil || size != len(data) {
+		t.Errorf("documentSize() = %d, %v, want %d", size, err, len(data))
+	}
+
+	// Identity, log, and enforcement types convert as encoding/json
+	// converts them, with every optional field set and with none.
+	parent := "p\xff"
+	set := &OperatorSet{Keys: []string{"k1", "k2"}, Threshold: 2}
+	sigs := []OperatorSignature{{PublicKey: "k1", Signature: "s1"}}
+	policy := DefaultEvolutionPolicy()
+	at := time.Date(2030, 1, 2, 3, 4, 5, 6, time.FixedZone("x", 3600))
+	full := []interface{}{
+		&AgentIdentity{
+			ID: "id", OperatorPublicKey: "k", OperatorIdentifier: "op",
+			Model:        ModelAttestation{Provider: "p", ModelID: "m", ModelVersion: "1", AttestationHash: "h", AttestationType: "t"},
+			Capabilities: []string{"a"}, CapabilityManifestHash: "c",
+			Deployment: DeploymentContext{Runtime: RuntimeTEE, TEEAttestation: "a", TEEAttestationType: "t", Region: "r", Provider: "p"},
+			Lineage: []LineageEntry{
+				{IdentityHash: "h0", ChangeType: "created", Capabilities: []string{"a"}, EvolutionPolicy: &policy, ReputationCarryForward: 1},
+				{
+					IdentityHash: "h1", ChangeType: ChangeOperatorKeyRotation, ParentHash: &parent, ReputationCarryForward: 0.25,
+					PreviousOperatorKey: "a", NewOperatorKey: "b", NewKeySignature: "s", Operators: set, Signatures: sigs,
+					PolicyHash: "ph", NextKeyCommitment: "n", Recovery: set,
+					Fork:    &ForkLink{ParentID: "p", ParentOperators: set, Signature: "s", Signatures: sigs},
+					Summary: &LineageSummary{Count: 2, CarryForward: 0.5, Operators: set, RotatedKeys: []string{"r"}, NextKeyCommitment: "n", Recovery: set},
+				},
+			},
+			Version: 2, CreatedAt: "c", UpdatedAt: "u", Signature: "s",
+			Operators: set, Signatures: sigs, EvolutionPolicy: &policy, NextKeyCommitment: "n", Recovery: set,
+			Parent: &ParentBinding{ParentID: "p", ParentOperators: set, ParentCapabilities: []string{"a"}, Signature: "s", Signatures: sigs},
+		},
+		&AgentIdentity{},
+		&LineageEntry{Summary: &LineageSummary{}, Fork: &ForkLink{}},
+		&ActionLogEntry{Index: 3, Outcome: OutcomeExecuted, Resource: "<r>"},
+		&LogCheckpoint{
+			Size: 4, Cosignatures: []CheckpointCosignature{{Role: "auditor"}, {WitnessPublicKey: "w"}},
+			Anchors: []AnchorProof{{Type: "t"}},
+		},
+		&LogCheckpoint{},
+		&IdentityRevocation{Reason: "compromised", AgentRoot: "r", Description: "d"},
+		&IdentityRevocation{},
+		&ActionReceipt{Index: 1, Outcome: OutcomeExecuted},
+		&ModelManifest{Models: []ModelManifestEntry{{ModelID: "m", ModelVersion: "1"}, {}}, Signature: "s"},
+		&ModelManifest{},
+		&SuspensionRecord{Violations: []Violation{{Kind: "denied", Rule: "deny x on y", LogIndex: -1, At: at}, {}}, SafeList: []string{"s"}},
+		&SuspensionRecord{},
+		&SnapshotManifest{Version: 1, Documents: []SnapshotEntry{{ID: "i", Hash: "h"}}, SignerPublicKey: "k", Signature: "s"},
+		&SnapshotManifest{},
+		&InclusionPromise{LogID: "l"},
+		&SignedTreeHead{TreeSize: 9},
+		&ParentBinding{},
+		&OperatorSet{},
+		&policy,
+	}
+	for _, v := range full {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want map[string]interface{}
+		json.Unmarshal(data, &want)
+		got, err := objectToMap(v)
+		if err != nil {
+			t.Fatalf("objectToMap(%T) error: %v", v, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("objectToMap(%T) =\n%v\nwant\n%v", v, got, want)
+		}
+		if canonical, err := CanonicalizeJSON(v); err != nil || len(canonical) != len(data) {
+			t.Errorf("CanonicalizeJSON(%T) = %s, %v; encoding/json gives %s", v, canonical, err, data)
+		}
+	}
+	if _, err := objectToMap(map[string]interface{}{"x": math.NaN()}); CodeOf(err) != ErrCodeSerialization {
+		t.Errorf("objectToMap(NaN) error = %v", err)
+	}
 
-	store.Clear()
+	// The canonical encoder escapes and formats as encoding/json does.
+	var all []byte
+	for c := 0; c < 256; c++ {
+		all = append(all, byte(c))
+	}
+	values := []interface{}{
+		string(all), "é😀  <script>&", "a\xffb\xc3",
+		0.0, -0.0, 1.0, -1.5, 0.1, 1e-6, 1e-7, 123456789012345680000.0, 1e21, 1e300, 5e-324,
+		float32(0.1), float32(1e21), float32(1e-7), int64(-1 << 62), uint64(1<<64 - 1),
+		json.Number("-1.5e+10"), []string{"x", "<"}, map[string]string{"b": "1", "a": "2"},
+		[]interface{}{map[string]interface{}{"z": nil, "a": []interface{}{}}},
+	}
+	for _, v := range values {
+		want, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := CanonicalizeJSON(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != string(want) {
+			t.Errorf("CanonicalizeJSON(%#v) = %s, want %s", v, got, want)
+		}
+	}
+	if _, err := CanonicalizeJSON(json.Number("1.")); err == nil {
+		t.Error("CanonicalizeJSON accepted an invalid number literal")
+	}
+	if _, err := CanonicalizeJSON([]interface{}{math.Inf(1)}); CodeOf(err) != ErrCodeCanonicalization {
+		t.Errorf("CanonicalizeJSON(Inf) error = %v", err)
+	}
+}
+
+// endlessReader yields an endless JSON string value, counting the bytes
+// read from it.
+type endlessReader struct{ n int64 }
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+		if r.n+int64(i) == 0 {
+			p[i] = '"'
+		}
+	}
+	r.n += int64(len(p))
+	return len(p), nil
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestStreamingDeserialization(t *testing.T) {
+	b := newTestBundle(t)
+	serialized, err := SerializeCovenant(b.doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ReadCovenant(strings.NewReader(serialized))
+	if err != nil || doc.ID != b.doc.ID || len(doc.Countersignatures) != 1 {
+		t.Fatalf("ReadCovenant() = %+v, %v", doc, err)
+	}
+	if doc, err = ReadCovenant(strings.NewReader(gzipEnvelope(t, []byte(serialized)))); err != nil || doc.ID != b.doc.ID {
+		t.Fatalf("ReadCovenant(envelope) = %+v, %v", doc, err)
+	}
+
+	// Oversized input is rejected without reading it whole.
+	r := &endlessReader{}
+	if _, err := ReadCovenant(r); CodeOf(err) != ErrCodeDocumentTooLarge {
+		t.Errorf("ReadCovenant(endless) error = %v", err)
+	}
+	if r.n > MaxDocumentSize+64*1024 {
+		t.Errorf("ReadCovenant read %d bytes of an oversized document", r.n)
+	}
+	if _, err := DeserializeCovenant(`{"id":"` + strings.Repeat("a", MaxDocumentSize) + `"}`); CodeOf(err) != ErrCodeDocumentTooLarge {
+		t.Errorf("DeserializeCovenant(oversized) error = %v", err)
+	}
+	for _, in := range []string{serialized + " {}", serialized[:len(serialized)/2], "", `{"id":5}`} {
+		if _, err := ReadCovenant(strings.NewReader(in)); CodeOf(err) != ErrCodeInvalidJSON {
+			t.Errorf("ReadCovenant(%.20q) error = %v, want %s", in, err, ErrCodeInvalidJSON)
+		}
+	}
+	if _, err := ReadCovenant(strings.NewReader(serialized + "\n")); err != nil {
+		t.Errorf("ReadCovenant(trailing newline) error = %v", err)
+	}
+	if _, err := ReadCovenant(failingReader{}); CodeOf(err) != ErrCodeStorage {
+		t.Errorf("ReadCovenant(failing) error = %v", err)
+	}
+
+	data, _ := json.Marshal(b.identity)
+	identity, err := ReadIdentity(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := VerifyIdentity(identity); err != nil || !result.Valid {
+		t.Errorf("VerifyIdentity(ReadIdentity()) = %+v, %v", result, err)
+	}
+	if _, err := ReadIdentity(strings.NewReader(`{"version":1}`)); CodeOf(err) != ErrCodeMissingField {
+		t.Errorf("ReadIdentity(no id) error = %v", err)
+	}
+	if _, err := ReadIdentity(&endlessReader{}); CodeOf(err) != ErrCodeDocumentTooLarge {
+		t.Errorf("ReadIdentity(endless) error = %v", err)
+	}
+
+	data, _ = json.Marshal(b.entries)
+	entries, err := ReadActionLog(bytes.NewReader(data), int64(len(data)))
+	if err != nil || len(entries) != len(b.entries) {
+		t.Fatalf("ReadActionLog() = %d entries, %v", len(entries), err)
+	}
+	if err := VerifyActionLogSegment(entries, b.agent.PublicKey, ActionLogGenesisHash); err != nil {
+		t.Errorf("VerifyActionLogSegment(ReadActionLog()) error = %v", err)
+	}
+	if entries, err := ReadActionLog(strings.NewReader(" [ ] "), 10); err != nil || entries == nil || len(entries) != 0 {
+		t.Errorf("ReadActionLog(empty) = %v, %v", entries, err)
+	}
+	if _, err := ReadActionLog(bytes.NewReader(data), int64(len(data))-1); CodeOf(err) != ErrCodeDocumentTooLarge {
+		t.Errorf("ReadActionLog(over limit) error = %v", err)
+	}
+	for _, in := range []string{`{}`, `[{}`, `[] []`, `[1]`} {
+		if _, err := ReadActionLog(strings.NewReader(in), 1024); CodeOf(err) != ErrCodeInvalidJSON {
+			t.Errorf("ReadActionLog(%q) error = %v, want %s", in, err, ErrCodeInvalidJSON)
+		}
+	}
+	if _, err := ReadActionLog(strings.NewReader("[]"), 0); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("ReadActionLog(limit 0) error = %v", err)
+	}
+}
+
+func TestCCLREPL(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	repl, err := NewCCLREPL(&CCLREPLOptions{
+		Policy:  "permit read on '/data/**'\ndeny read on '/data/secret' when user.role != 'admin'\nlimit read 2 per 1 minutes",
+		Context: map[string]interface{}{"user": map[string]interface{}{"role": "guest"}},
+		Now:     func() time.Time { return now },
+		ReadFile: func(name string) ([]byte, error) {
+			return []byte("permit write on '**'"), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec := func(line string) string {
+		t.Helper()
+		var out strings.Builder
+		if err := repl.Exec(line, &out); err != nil {
+			t.Fatalf("Exec(%q) error = %v", line, err)
+		}
+		return out.String()
+	}
+
+	out := exec("read /data/secret")
+	if !strings.HasPrefix(out, "DENIED") || !strings.Contains(out, "MATCH, decides") || !strings.Contains(out, "0/2 used") {
+		t.Errorf("deny trace = %q", out)
+	}
+	out = exec(`read /data/secret user.role="admin"`)
+	if !strings.HasPrefix(out, "PERMITTED") || !strings.Contains(out, "condition not met: user.role is admin") || !strings.Contains(out, "1/2 used") {
+		t.Errorf("permit trace = %q", out)
+	}
+	exec("read /data/a")
+	if out = exec("read /data/a"); !strings.HasPrefix(out, "DENIED  Rate limit of 2 exceeded") {
+		t.Errorf("exhausted limit = %q", out)
+	}
+	exec(":advance 61s")
+	if out = exec("read /data/a"); !strings.HasPrefix(out, "PERMITTED") || !strings.Contains(out, "1/2 used") {
+		t.Errorf("after window = %q", out)
+	}
+
+	exec(":set user.role=admin level=3")
+	if got := resolveField(repl.context, "user.role"); got != "admin" || repl.context["level"] != float64(3) {
+		t.Errorf("context after :set = %v", repl.context)
+	}
+	exec(":unset level")
+	if _, ok := repl.context["level"]; ok {
+		t.Errorf("context after :unset = %v", repl.context)
+	}
+	if out = exec("write /x"); !strings.Contains(out, "action does not match") || !strings.HasPrefix(out, "DENIED") {
+		t.Errorf("unmatched trace = %q", out)
+	}
+	exec(":add permit write on '/x'")
+	if len(repl.Policy().Statements) != 4 || !strings.HasPrefix(exec("write /x"), "PERMITTED") {
+		t.Errorf("policy after :add = %s", Serialize(repl.Policy()))
+	}
+	exec(":load policy.ccl")
+	if len(repl.Policy().Statements) != 1 || !strings.Contains(exec(":limits"), "no limit statements") {
+		t.Errorf("policy after :load = %s", Serialize(repl.Policy()))
+	}
+
+	for _, line := range []string{":bogus", ":add permit", "read a b c", `read "/x`, ":advance soon"} {
+		var out strings.Builder
+		if err := repl.Exec(line, &out); err == nil {
+			t.Errorf("Exec(%q) error = %v", line, err)
+		}
+	}
+
+	var session strings.Builder
+	if err := repl.Run(strings.NewReader("write /y\n:bogus\n:quit\nwrite /z\n"), &session); err != nil {
+		t.Fatal(err)
+	}
+	if got := session.String(); strings.Count(got, "ccl> ") != 3 || !strings.Contains(got, "error: unknown command") || strings.Contains(got, "/z") {
+		t.Errorf("Run() output = %q", got)
+	}
+	if _, err := NewCCLREPL(&CCLREPLOptions{Policy: "permit"}); err == nil {
+		t.Error("NewCCLREPL(invalid policy) succeeded")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	doc, kp := buildTestCovenant(t)
+	opts := &CovenantBuilderOptions{
+		Issuer:      doc.Issuer,
+		Beneficiary: doc.Beneficiary,
+		Constraints: "permit read on '/data/**'\ndeny write on '/data/**' when risk > 3\nlimit read 10 per 1 hours",
+		PrivateKey:  kp.PrivateKey,
+		ExpiresAt:   "2999-01-01T00:00:00.000Z",
+		GracePeriod: time.Hour,
+	}
+	doc, err := BuildCovenant(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := GenerateKeyPair()
+	doc, err = CountersignCovenant(doc, signer, "auditor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := *signer
+	other, _ := GenerateKeyPair()
+	forged.PrivateKey = other.PrivateKey
+	doc, err = CountersignCovenant(doc, &forged, "forger")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := Inspect(doc)
+	if in.ID != doc.ID || len(in.Parties) != 2 || in.Parties[0].Role != "issuer" || in.Validity.State != CovenantActive || in.Validity.GracePeriod != "1h0m0s" {
+		t.Errorf("Inspect() = %+v", in)
+	}
+	want := []InspectedStatement{
+		{Type: StatementPermit, Action: "read", Resource: "/data/**", Rule: "permit read on '/data/**'"},
+		{Type: StatementDeny, Action: "write", Resource: "/data/**", Condition: "risk > 3", Rule: "deny write on '/data/**' when risk > 3"},
+		{Type: StatementLimit, Action: "read", Limit: "10 per 1 hours", Rule: "limit read 10 per 1 hours"},
+	}
+	if !reflect.DeepEqual(in.Statements, want) {
+		t.Errorf("Statements = %+v, want %+v", in.Statements, want)
+	}
+	if len(in.Countersignatures) != 2 || !in.Countersignatures[0].Valid || in.Countersignatures[1].Valid || in.Countersignatures[1].SignerRole != "forger" {
+		t.Errorf("Countersignatures = %+v", in.Countersignatures)
+	}
+
+	text, err := in.Render(InspectText)
+	if err != nil || !strings.Contains(string(text), "Grace period  1h0m0s") || !strings.Contains(string(text), "  3  limit   read    -         -          10 per 1 hours") || !strings.Contains(string(text), "INVALID") {
+		t.Errorf("Render(text) = %s, %v", text, err)
+	}
+	data, err := in.Render(InspectJSON)
+	var decoded Inspection
+	if err != nil || json.Unmarshal(data, &decoded) != nil || !reflect.DeepEqual(decoded, in) {
+		t.Errorf("Render(json) = %s, %v", data, err)
+	}
+	yaml, err := in.Render(InspectYAML)
+	if err != nil || !strings.Contains(string(yaml), "statements:\n  - type: \"permit\"\n    action: \"read\"\n") || !strings.Contains(string(yaml), "    valid: false\n") {
+		t.Errorf("Render(yaml) = %s, %v", yaml, err)
+	}
+	if _, err := in.Render("xml"); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("Render(xml) error = %v", err)
+	}
+
+	doc.Constraints = "permit"
+	if in := Inspect(doc); len(in.Statements) != 0 || len(in.Notes) != 1 {
+		t.Errorf("Inspect(unparseable) = %+v", in)
+	}
+	if out, _ := Inspect(doc).Render(InspectYAML); !strings.Contains(string(out), "statements: []\n") {
+		t.Errorf("Render(yaml) without statements = %s", out)
+	}
+}
+
+func TestCompilePattern(t *testing.T) {
+	cases := []struct {
+		kind            PatternKind
+		pattern, target string
+	}{
+		{ActionPattern, "file.read", "file.read"},
+		{ActionPattern, "file.*", "file.read"},
+		{ActionPattern, "file.*", "file.read.all"},
+		{ActionPattern, "file.**", "file"},
+		{ActionPattern, "**", "a.b.c"},
+		{ActionPattern, "", ""},
+		{ActionPattern, "a.**.z", "a.b.c.z"},
+		{ResourcePattern, "/data/**", "/data/a/b"},
+		{ResourcePattern, "/data/*", "/data/a/b"},
+		{ResourcePattern, "*", ""},
+		{ResourcePattern, "", "/"},
+		{ResourcePattern, "", "/x"},
+		{ResourcePattern, "/a/**/z/", "a/b/c/z"},
+	}
+	for _, c := range cases {
+		p, err := CompilePattern(c.pattern, c.kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := MatchAction(c.pattern, c.target)
+		if c.kind == ResourcePattern {
+			want = MatchResource(c.pattern, c.target)
+		}
+		if got := p.Match(c.target); got != want || p.String() != c.pattern || p.Kind() != c.kind {
+			t.Errorf("CompilePattern(%q, %d).Match(%q) = %v, want %v", c.pattern, c.kind, c.target, got, want)
+		}
+	}
+	if p, _ := CompilePattern("a.*", ActionPattern); !p.Match("a.b") || p.Match("a") {
+		t.Error("compiled action pattern a.* matched wrongly")
+	}
+	if p1, _ := CompilePattern("/x/**", ResourcePattern); p1 != cachedPattern("/x/**", ResourcePattern) {
+		t.Error("CompilePattern() did not use the cache")
+	}
+	if _, err := CompilePattern("a", PatternKind(7)); CodeOf(err) != ErrCodeInvalidInput {
+		t.Errorf("CompilePattern(unknown kind) error = %v", err)
+	}
+	if got := specificity("file.*", "/data/**"); got != 5 {
+		t.Errorf("specificity() = %d, want 5", got)
+	}
 
-	if store.Count() != 0 {
-		t.Error("store should be empty after Clear()")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if !MatchResource("/c/"+strconv.Itoa(j%10)+"/**", "/c/"+strconv.Itoa(j%10)+"/x") {
+					t.Errorf("concurrent MatchResource failed")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := testing.AllocsPerRun(100, func() { MatchResource("/data/**/x", "/data/a/b/x") }); n != 0 {
+		t.Errorf("MatchResource() allocates %v times", n)
 	}
 }
 
-func TestMemoryStoreValidation(t *testing.T) {
-	store := NewMemoryStore()
-
-	err := store.Put("", &CovenantDocument{})
-	if err == nil {
-		t.Error("Put() with empty ID should fail")
+func TestCanonicalFormEncoder(t *testing.T) {
+	// mapCanonicalForm is the canonical form as the document's JSON
+	// object with the unsigned fields removed.
+	mapCanonicalForm := func(doc *CovenantDocument) string {
+		m, err := objectToMap(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range []string{"id", "signature", "countersignatures", "transparency", "anchors"} {
+			delete(m, k)
+		}
+		s, err := CanonicalizeJSON(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
 	}
 
-	err = store.Put("id", nil)
-	if err == nil {
-		t.Error("Put() with nil document should fail")
+	doc, kp := buildTestCovenant(t)
+	doc, err := CountersignCovenant(doc, kp, "auditor")
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	_, err = store.Get("")
-	if err == nil {
-		t.Error("Get() with empty ID should fail")
+	full := doc.Clone()
+	full.ActivatesAt = "2025-01-01T00:00:00.000Z"
+	full.ExpiresAt = "2999-01-01T00:00:00.000Z"
+	full.GracePeriod = 1 << 60
+	full.Chain = &ChainReference{ParentID: "p\u2028<&>", Relation: "delegates", Depth: 3}
+	full.ConstraintsRef = &ConstraintsRef{Hash: "ab", URI: "https://x/\xff"}
+	full.Metadata = map[string]interface{}{"n": int64(1<<53 + 1), "f": float32(0.1), "s": []string{"a"}, "z\xffa": "\x00", "m": map[string]interface{}{"b": nil, "a": []interface{}{1e21, 1e-7}}}
+	full.MetadataSchema = map[string]interface{}{"type": "object"}
+	full.Extensions = map[string]Extension{"b": {Critical: true, Value: map[string]string{"k": "v"}}, "a\xff": {}, "a": {Value: 1.5}}
+
+	for _, d := range []*CovenantDocument{doc, full, {}} {
+		want := mapCanonicalForm(d)
+		got, err := CanonicalForm(d)
+		if err != nil || got != want {
+			t.Errorf("CanonicalForm() =\n%s, %v\nwant\n%s", got, err, want)
+		}
+		if id, err := ComputeID(d); err != nil || id != SHA256String(want) {
+			t.Errorf("ComputeID() = %s, %v", id, err)
+		}
+	}
+	if got, err := CanonicalForm(nil); err != nil || got != "null" {
+		t.Errorf("CanonicalForm(nil) = %q, %v", got, err)
+	}
+	full.Metadata["bad"] = math.NaN()
+	if _, err := CanonicalForm(full); CodeOf(err) != ErrCodeCanonicalization {
+		t.Errorf("CanonicalForm(NaN metadata) error = %v", err)
 	}
 
-	err = store.Delete("")
-	if err == nil {
-		t.Error("Delete() with empty ID should fail")
+	if n := testing.AllocsPerRun(100, func() { ComputeID(doc) }); n > 1 {
+		t.Errorf("ComputeID() allocates %v times, want at most 1", n)
 	}
 }
 
-// ═══════════════════════════════════════════════════════════════════════════════
-// Integration tests
-// ═══════════════════════════════════════════════════════════════════════════════
-
-func TestFullWorkflow(t *testing.T) {
-	// 1. Generate key pairs
-	issuerKP, _ := GenerateKeyPair()
-	beneficiaryKP, _ := GenerateKeyPair()
-	auditorKP, _ := GenerateKeyPair()
-
-	// 2. Build a covenant
+func BenchmarkCanonicalForm(b *testing.B) {
+	kp, _ := GenerateKeyPair()
 	doc, err := BuildCovenant(&CovenantBuilderOptions{
-		Issuer: Party{
-			ID:        "alice",
-			PublicKey: issuerKP.PublicKeyHex,
-			Role:      "issuer",
-		},
-		Beneficiary: Party{
-			ID:        "bob",
-			PublicKey: beneficiaryKP.PublicKeyHex,
-			Role:      "beneficiary",
-		},
-		Constraints: "permit read on '/data/**'\ndeny read on '/data/secret'",
-		PrivateKey:  issuerKP.PrivateKey,
+		Issuer:      Party{ID: "alice", PublicKey: kp.PublicKeyHex, Role: "issuer"},
+		Beneficiary: Party{ID: "bob", PublicKey: kp.PublicKeyHex, Role: "beneficiary"},
+		Constraints: "permit read on '/data/**'\ndeny write on '/data/secret/**'",
+		PrivateKey:  kp.PrivateKey,
+		Metadata:    map[string]interface{}{"team": "payments", "tier": 2.0},
 	})
 	if err != nil {
-		t.Fatalf("BuildCovenant() error: %v", err)
+		b.Fatal(err)
 	}
+	b.Run("CanonicalForm", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			CanonicalForm(doc)
+		}
+	})
+	b.Run("ComputeID", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ComputeID(doc)
+		}
+	})
+	b.Run("CanonicalizeJSON", func(b *testing.B) {
+		v := map[string]interface{}{"b": []interface{}{1.0, "x", true}, "a": map[string]interface{}{"z": "q", "y": nil}}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			CanonicalizeJSON(v)
+		}
+	})
+}
 
-	// 3. Verify the covenant
-	result, _ := VerifyCovenant(doc)
-	if !result.Valid {
-		t.Fatal("freshly built covenant should be valid")
+func TestTokenizeInPlace(t *testing.T) {
+	src := "# héllo\npermit file.read on '/a\nb' when x >= 2.5\n\n  deny * on /p/**\xff"
+	var got []string
+	for _, tok := range tokenize(src) {
+		got = append(got, tok.value)
 	}
-
-	// 4. Add a countersignature
-	signed, err := CountersignCovenant(doc, auditorKP, "auditor")
-	if err != nil {
-		t.Fatalf("CountersignCovenant() error: %v", err)
+	want := []string{"# héllo", "\n", "permit", "file", ".", "read", "on", "/a\nb", "when", "x", ">=", "2.5", "\n", "deny", "*", "on", "/p/**\ufffd", ""}
+	if !slices.Equal(got, want) {
+		t.Errorf("tokenize() values = %q, want %q", got, want)
 	}
 
-	// 5. Verify with countersignature
-	result2, _ := VerifyCovenant(signed)
-	if !result2.Valid {
-		t.Fatal("countersigned covenant should be valid")
+	cases := []struct {
+		src          string
+		line, column int
+	}{
+		{"permit", 1, 7},
+		{"permit read on '/x'\nbogus", 2, 1},
+		{"# é\npermit read on 'a\nb' when", 3, 8},
+		{"permit € on '/x'", 1, 10},
+		{"limit read x per 1 hours", 1, 12},
+	}
+	for _, c := range cases {
+		_, err := Parse(c.src)
+		var syntaxErr *CCLSyntaxError
+		if !errors.As(err, &syntaxErr) || syntaxErr.Line != c.line || syntaxErr.Column != c.column {
+			t.Errorf("Parse(%q) error = %v, want position %d:%d", c.src, err, c.line, c.column)
+		}
 	}
+}
 
-	// 6. Store the covenant
-	store := NewMemoryStore()
-	if err := store.Put(signed.ID, signed); err != nil {
-		t.Fatalf("store.Put() error: %v", err)
-	}
+// largeCCL returns a constraint block of n statements.
+func largeCCL(n int) string {
+	var b strings.Builder
+	for i := 0; i < n/4; i++ {
+		b.WriteString("# rule " + strconv.Itoa(i) + "\n")
+		b.WriteString("permit file.read on '/data/" + strconv.Itoa(i) + "/**' when user.role = 'admin'\n")
+		b.WriteString("deny net.* on '/hosts/" + strconv.Itoa(i) + "/*'\n")
+		b.WriteString("require audit.log on '/logs/" + strconv.Itoa(i) + "'\n")
+		b.WriteString("limit api.call 100 per 1 hours\n")
+	}
+	return b.String()
+}
 
-	// 7. Retrieve and verify from store
-	retrieved, _ := store.Get(signed.ID)
-	result3, _ := VerifyCovenant(retrieved)
-	if !result3.Valid {
-		t.Fatal("retrieved covenant should be valid")
+func BenchmarkParse(b *testing.B) {
+	src := largeCCL(256)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(src); err != nil {
+			b.Fatal(err)
+		}
 	}
+}
 
-	// 8. Evaluate CCL
-	ccl, _ := Parse(doc.Constraints)
-	evalResult := Evaluate(ccl, "read", "/data/users", nil)
-	if !evalResult.Permitted {
-		t.Error("read on /data/users should be permitted")
+func TestParseAndEvaluateReuseBuffers(t *testing.T) {
+	// Names written with spaces around their dots are joined; names
+	// written without are taken from the source.
+	doc, err := Parse("permit file . read on '/a' when user . role = 'x'\npermit net.*.get on '/b' when a.b.c = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := doc.Statements; s[0].Action != "file.read" || s[0].Condition.Field != "user.role" || s[1].Action != "net.*.get" || s[1].Condition.Field != "a.b.c" {
+		t.Errorf("Parse() = %+v", s)
 	}
 
-	evalResult2 := Evaluate(ccl, "read", "/data/secret", nil)
-	if evalResult2.Permitted {
-		t.Error("read on /data/secret should be denied")
+	// Documents and results do not share the pooled buffers, so they stay
+	// intact while other parses and evaluations run concurrently.
+	srcs := []string{largeCCL(64), "permit read on '/x'\ndeny read on '/x/secret'", "limit api.call 5 per 1 minutes"}
+	want := make([]string, len(srcs))
+	docs := make([]*CCLDocument, len(srcs))
+	for i, src := range srcs {
+		if docs[i], err = Parse(src); err != nil {
+			t.Fatal(err)
+		}
+		want[i] = Serialize(docs[i])
+	}
+	ctx := map[string]interface{}{"user": map[string]interface{}{"role": "admin"}}
+	first := Evaluate(docs[0], "file.read", "/data/3/x", ctx)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				k := (g + i) % len(srcs)
+				doc, err := Parse(srcs[k])
+				if err != nil || Serialize(doc) != want[k] {
+					t.Errorf("concurrent Parse() = %v", err)
+					return
+				}
+				if r := Evaluate(docs[0], "file.read", "/data/3/x", ctx); !r.Permitted || len(r.AllMatches) != 1 {
+					t.Errorf("concurrent Evaluate() = %+v", r)
+					return
+				}
+				if _, err := Parse("permit read on"); err == nil {
+					t.Error("Parse(invalid) succeeded")
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for i, doc := range docs {
+		if Serialize(doc) != want[i] {
+			t.Errorf("document %d changed after reuse", i)
+		}
+	}
+	if !first.Permitted || first.MatchedRule.Resource != "/data/3/**" || first.MatchedRule.Condition.Field != "user.role" {
+		t.Errorf("result changed after reuse: %+v", first)
 	}
 
-	// 9. Serialize and deserialize
-	serialized, _ := SerializeCovenant(signed)
-	restored, _ := DeserializeCovenant(serialized)
-	result4, _ := VerifyCovenant(restored)
-	if !result4.Valid {
-		t.Fatal("deserialized covenant should be valid")
+	if n := testing.AllocsPerRun(100, func() { Evaluate(docs[1], "write", "/y", nil) }); n > 1 {
+		t.Errorf("Evaluate() without matches allocates %v times, want at most 1", n)
 	}
 }
 
-func TestCovenantChainWorkflow(t *testing.T) {
-	issuerKP, _ := GenerateKeyPair()
-	beneficiaryKP, _ := GenerateKeyPair()
+func TestParsedConstraintCache(t *testing.T) {
+	src := "permit read on '/data/**' when user.role = 'admin'\nlimit read 5 per 1 minutes"
+	a, err := parsedConstraints(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := parsedConstraints(src); b != a {
+		t.Error("parsedConstraints() parsed a cached source again")
+	}
+	if p, _ := Parse(src); p == a || Serialize(p) != Serialize(a) {
+		t.Error("Parse() returned the cached document")
+	}
+	if _, err := parsedConstraints("permit read on"); err == nil {
+		t.Error("parsedConstraints() accepted invalid CCL")
+	} else if _, err2 := parsedConstraints("permit read on"); err2 != err {
+		t.Error("parsedConstraints() did not cache the parse error")
+	}
 
-	// Build parent covenant
-	parent, err := BuildCovenant(&CovenantBuilderOptions{
-		Issuer: Party{
-			ID:        "alice",
-			PublicKey: issuerKP.PublicKeyHex,
-			Role:      "issuer",
-		},
-		Beneficiary: Party{
-			ID:        "bob",
-			PublicKey: beneficiaryKP.PublicKeyHex,
-			Role:      "beneficiary",
-		},
-		Constraints: "permit read on '/data/**'\npermit write on '/data/**'",
-		PrivateKey:  issuerKP.PrivateKey,
-	})
+	// Entries are evicted least recently used first, by count and by size.
+	c := &constraintCache{entries: make(map[string]*list.Element), order: list.New()}
+	for i := 0; i <= maxCachedConstraints; i++ {
+		if _, err := c.parse("permit read on '/" + strconv.Itoa(i) + "'"); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			c.parse("permit read on '/0'")
+		}
+	}
+	if len(c.entries) != maxCachedConstraints || c.order.Len() != maxCachedConstraints {
+		t.Fatalf("cache holds %d entries, want %d", len(c.entries), maxCachedConstraints)
+	}
+	if _, ok := c.entries["permit read on '/0'"]; ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	// A comment pads each source to 3 MiB without making it costly to
+	// parse.
+	pad := "# " + strings.Repeat("x", 3<<20) + "\n"
+	for i := 0; i < 8; i++ {
+		if _, err := c.parse(pad + "permit read on '/" + strconv.Itoa(i) + "'"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.bytes > maxCachedConstraintBytes {
+		t.Errorf("cache holds %d bytes, limit is %d", c.bytes, maxCachedConstraintBytes)
+	}
+	huge := strings.Repeat(" ", maxCachedConstraintBytes/4) + "permit read on '/x'"
+	if _, err := c.parse(huge); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.entries[huge]; ok {
+		t.Error("oversized source was cached")
+	}
+
+	// Rules the enforcer returns do not share the cached document.
+	doc, _ := buildTestCovenant(t)
+	enforcer, err := NewEnforcer(&EnforcerOptions{Covenant: doc})
 	if err != nil {
-		t.Fatalf("BuildCovenant(parent) error: %v", err)
+		t.Fatal(err)
 	}
+	d, err := enforcer.Check(context.Background(), "read", "/data/x", nil)
+	if err != nil || d.MatchedRule == nil {
+		t.Fatalf("Check() = %+v, %v", d, err)
+	}
+	d.MatchedRule.Action = "write"
+	d, err = enforcer.Check(context.Background(), "read", "/data/x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Permitted || d.MatchedRule.Action != "read" {
+		t.Errorf("Check() after modifying a returned rule = %+v", d)
+	}
+	if cached, _ := parsedConstraints(doc.Constraints); cached.Permits[0].Action != "read" {
+		t.Errorf("cached rule was modified: %+v", cached.Permits[0])
+	}
+	stmt := a.Permits[0].clone()
+	stmt.Condition.Value = "guest"
+	if a.Permits[0].Condition.Value != "admin" {
+		t.Error("clone() shares the condition")
+	}
+}
 
-	// Build child covenant (narrows parent)
-	child, err := BuildCovenant(&CovenantBuilderOptions{
-		Issuer: Party{
-			ID:        "alice",
-			PublicKey: issuerKP.PublicKeyHex,
-			Role:      "issuer",
-		},
-		Beneficiary: Party{
-			ID:        "bob",
-			PublicKey: beneficiaryKP.PublicKeyHex,
-			Role:      "beneficiary",
-		},
-		Constraints: "permit read on '/data/public'",
-		PrivateKey:  issuerKP.PrivateKey,
-		Chain: &ChainReference{
-			ParentID: parent.ID,
-			Relation: "restricts",
-			Depth:    1,
-		},
+func TestPolicyBundle(t *testing.T) {
+	requireReflectJSON(t)
+	issuerKP, agentKP := makeTestKeyPairs(t)
+	operatorKP, _ := makeTestKeyPairs(t)
+	build := func(constraints string, chain *ChainReference) *CovenantDocument {
+		doc, err := BuildCovenant(&CovenantBuilderOptions{
+			Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+			Beneficiary: Party{ID: "agent", PublicKey: agentKP.PublicKeyHex, Role: "beneficiary"},
+			Constraints: constraints,
+			PrivateKey:  issuerKP.PrivateKey,
+			Chain:       chain,
+		})
+		if err != nil {
+			t.Fatalf("BuildCovenant() error: %v", err)
+		}
+		return doc
+	}
+	root := build("permit read on '/data/**'\npermit write on '/data/**'", nil)
+	leaf := build("permit read on '/data/reports/**'", &ChainReference{ParentID: root.ID, Relation: "delegates", Depth: 1})
+	other := build("permit read on '/public/**'", nil)
+
+	// Covenants are ordered parents first.
+	data, err := BuildPolicyBundle(&PolicyBundleOptions{
+		Name:      "fleet",
+		Version:   "1",
+		Covenants: []*CovenantDocument{leaf, root, other},
+		Roles:     map[string]string{root.ID: "root", leaf.ID: "reporter"},
+		Signer:    operatorKP,
 	})
 	if err != nil {
-		t.Fatalf("BuildCovenant(child) error: %v", err)
+		t.Fatalf("BuildPolicyBundle() error: %v", err)
+	}
+	bundle, err := ParsePolicyBundle(data)
+	if err != nil {
+		t.Fatalf("ParsePolicyBundle() error: %v", err)
+	}
+	want := []PolicyManifestEntry{
+		{ID: root.ID, Role: "root", Issuer: "alice", Beneficiary: "agent"},
+		{ID: other.ID, Issuer: "alice", Beneficiary: "agent"},
+		{ID: leaf.ID, Role: "reporter", Issuer: "alice", Beneficiary: "agent", ParentID: root.ID, Depth: 1},
+	}
+	if !reflect.DeepEqual(bundle.Manifest.Covenants, want) || bundle.Covenants[2].ID != leaf.ID {
+		t.Errorf("manifest = %+v", bundle.Manifest.Covenants)
 	}
 
-	// Validate narrowing
-	result, err := ValidateChainNarrowing(child, parent)
+	result, err := VerifyPolicyBundle(data, &PolicyBundleVerifyOptions{TrustedSigners: []string{operatorKP.PublicKeyHex}, PinnedID: bundle.ID})
 	if err != nil {
-		t.Fatalf("ValidateChainNarrowing() error: %v", err)
+		t.Fatalf("VerifyPolicyBundle() error: %v", err)
 	}
-	if !result.Valid {
-		t.Error("expected valid narrowing for restrictive child")
+	if !result.Valid || len(result.Covenants) != 3 {
+		t.Fatalf("bundle should verify: %+v", result.Checks)
+	}
+	for _, name := range []string{"bundle_id", "bundle_signature", "trusted_signer", "pinned", "manifest", "covenants", "chain"} {
+		if findCheckIn(result.Checks, name) == nil {
+			t.Errorf("missing %s check", name)
+		}
 	}
 
-	// Verify both
-	parentResult, _ := VerifyCovenant(parent)
-	if !parentResult.Valid {
-		t.Error("parent should be valid")
+	failed := func(data []byte, opts *PolicyBundleVerifyOptions, names ...string) {
+		t.Helper()
+		result, err := VerifyPolicyBundle(data, opts)
+		if err != nil {
+			t.Fatalf("VerifyPolicyBundle() error: %v", err)
+		}
+		if result.Valid {
+			t.Errorf("bundle should fail %v", names)
+		}
+		for _, name := range names {
+			if c := findCheckIn(result.Checks, name); c == nil || c.Passed {
+				t.Errorf("%s check = %+v, want failed", name, c)
+			}
+		}
 	}
-	childResult, _ := VerifyCovenant(child)
-	if !childResult.Valid {
-		t.Error("child should be valid")
+	failed(data, &PolicyBundleVerifyOptions{TrustedSigners: []string{issuerKP.PublicKeyHex}}, "trusted_signer")
+	failed(data, &PolicyBundleVerifyOptions{PinnedID: strings.Repeat("0", 64)}, "pinned")
+
+	// A valid signature alone does not make a bundle trusted.
+	for _, opts := range []*PolicyBundleVerifyOptions{nil, {Covenant: &VerifyOptions{}}} {
+		if _, err := VerifyPolicyBundle(data, opts); CodeOf(err) != ErrCodeMissingField {
+			t.Errorf("VerifyPolicyBundle(%+v) code = %q, want %q", opts, CodeOf(err), ErrCodeMissingField)
+		}
 	}
-}
+	trusted := &PolicyBundleVerifyOptions{TrustedSigners: []string{operatorKP.PublicKeyHex}}
+
+	// Changing any part of the bundle changes its ID and breaks the
+	// signature.
+	tampered := *bundle
+	tampered.Manifest.Name = "other"
+	tamperedData, _ := json.Marshal(&tampered)
+	failed(tamperedData, trusted, "bundle_id", "bundle_signature")
+	tampered = *bundle
+	tampered.Manifest.Covenants = bundle.Manifest.Covenants[:2]
+	tamperedData, _ = json.Marshal(&tampered)
+	failed(tamperedData, trusted, "bundle_id", "manifest")
+	tampered = *bundle
+	tampered.Covenants = slices.Clone(bundle.Covenants)
+	tampered.Covenants[1] = bundle.Covenants[1].Clone()
+	tampered.Covenants[1].Constraints = "permit read on '/**'"
+	tamperedData, _ = json.Marshal(&tampered)
+	failed(tamperedData, trusted, "bundle_id", "covenants")
+
+	// A delegated covenant must narrow its parent.
+	broad := build("permit read on '/**'", &ChainReference{ParentID: root.ID, Relation: "delegates", Depth: 1})
+	data, err = BuildPolicyBundle(&PolicyBundleOptions{Covenants: []*CovenantDocument{root, broad}, Signer: operatorKP})
+	if err != nil {
+		t.Fatalf("BuildPolicyBundle() error: %v", err)
+	}
+	failed(data, trusted, "chain")
 
-func TestIdentityCovenantWorkflow(t *testing.T) {
-	kp, _ := GenerateKeyPair()
+	for _, tc := range []struct {
+		name string
+		opts *PolicyBundleOptions
+		code ErrorCode
+	}{
+		{"no covenants", &PolicyBundleOptions{Signer: operatorKP}, ErrCodeMissingField},
+		{"no signer", &PolicyBundleOptions{Covenants: []*CovenantDocument{root}}, ErrCodeInvalidPrivateKey},
+		{"duplicate", &PolicyBundleOptions{Covenants: []*CovenantDocument{root, root}, Signer: operatorKP}, ErrCodeInvalidInput},
+		{"missing parent", &PolicyBundleOptions{Covenants: []*CovenantDocument{leaf}, Signer: operatorKP}, ErrCodeInvalidChain},
+		{"unknown role", &PolicyBundleOptions{Covenants: []*CovenantDocument{root}, Roles: map[string]string{leaf.ID: "x"}, Signer: operatorKP}, ErrCodeInvalidInput},
+	} {
+		if _, err := BuildPolicyBundle(tc.opts); CodeOf(err) != tc.code {
+			t.Errorf("%s: BuildPolicyBundle() code = %q, want %q", tc.name, CodeOf(err), tc.code)
+		}
+	}
+	if _, err := VerifyPolicyBundle([]byte(`{"format":"grith-bundle/1"}`), trusted); CodeOf(err) != ErrCodeUnsupportedVersion {
+		t.Errorf("accountability bundle code = %q, want %q", CodeOf(err), ErrCodeUnsupportedVersion)
+	}
+}
 
-	// Create identity
-	identity, err := CreateIdentity(&CreateIdentityOptions{
-		OperatorKeyPair: kp,
-		Model: ModelAttestation{
-			Provider: "anthropic",
-			ModelID:  "claude-3",
+func TestStoreHandlerBulkLimits(t *testing.T) {
+	backing := NewMemoryStore()
+	handler := NewStoreHandler(backing, &StoreHandlerOptions{
+		Authorize: func(r *http.Request, op, id string) error {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return errors.New("bad token")
+			}
+			return nil
 		},
-		Capabilities: []string{"read", "write"},
-		Deployment:   DeploymentContext{Runtime: RuntimeContainer},
 	})
-	if err != nil {
-		t.Fatalf("CreateIdentity() error: %v", err)
+
+	// Unauthorized bulk requests are refused before their body is read.
+	for _, path := range []string{"/bulk/put", "/bulk/get"} {
+		body := &countingReader{r: strings.NewReader(`{"documents":{` + strings.Repeat(" ", 1<<20) + `}}`)}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, body))
+		if rec.Code != http.StatusForbidden || body.n != 0 {
+			t.Errorf("unauthorized %s = %d after reading %d bytes", path, rec.Code, body.n)
+		}
 	}
 
-	// Use the identity's key to build a covenant
-	beneficiaryKP, _ := GenerateKeyPair()
-	doc, err := BuildCovenant(&CovenantBuilderOptions{
-		Issuer: Party{
-			ID:        identity.ID,
-			PublicKey: identity.OperatorPublicKey,
-			Role:      "issuer",
-		},
-		Beneficiary: Party{
-			ID:        "beneficiary",
-			PublicKey: beneficiaryKP.PublicKeyHex,
-			Role:      "beneficiary",
+	// Bodies past maxBulkRequestSize are refused.
+	req := httptest.NewRequest(http.MethodPost, "/bulk/get", strings.NewReader(`{"ids":["`+strings.Repeat("a", maxBulkRequestSize)+`"]}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("oversized bulk request = %d, want 400", rec.Code)
+	}
+
+	// RemoteStore splits bulk puts to fit.
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bulk/put" {
+			requests++
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	store, _ := NewRemoteStore(server.URL, &RemoteStoreOptions{
+		Authenticate: func(req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer secret")
+			return nil
 		},
-		Constraints: "permit read on '/data/**'",
-		PrivateKey:  kp.PrivateKey,
 	})
-	if err != nil {
-		t.Fatalf("BuildCovenant() error: %v", err)
+	issuerKP, beneficiaryKP := makeTestKeyPairs(t)
+	docs := make(map[string]*CovenantDocument)
+	for i := 0; i < 12; i++ {
+		doc, err := BuildCovenant(&CovenantBuilderOptions{
+			Issuer:      Party{ID: "alice", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"},
+			Beneficiary: Party{ID: "bob", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"},
+			Constraints: "permit read on '/data/**'",
+			Metadata:    map[string]interface{}{"policy": strings.Repeat("x", 800_000)},
+			PrivateKey:  issuerKP.PrivateKey,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs[doc.ID] = doc
 	}
-
-	result, _ := VerifyCovenant(doc)
-	if !result.Valid {
-		t.Error("covenant signed by identity key should be valid")
+	if err := store.PutMany(docs); err != nil {
+		t.Fatalf("PutMany() error: %v", err)
+	}
+	if requests < 2 || backing.Count() != len(docs) {
+		t.Errorf("PutMany() sent %d requests, stored %d documents", requests, backing.Count())
 	}
 }
@@ -0,0 +1,718 @@
+package grith
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The gRPC service of proto/grith/v1/store.proto is implemented here over
+// net/http, which speaks HTTP/2, with a minimal protobuf codec, so stock
+// gRPC clients and servers generated from the proto interoperate with it
+// without the package depending on a gRPC runtime.
+
+// grpcStoreService is the full name of the covenant store service.
+const grpcStoreService = "/grith.v1.CovenantStore/"
+
+// gRPC status codes.
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcNotFound           = 5
+	grpcPermissionDenied   = 7
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnauthenticated    = 16
+)
+
+// ----------------------------------------------------------------------------
+// Protobuf wire format
+// ----------------------------------------------------------------------------
+
+// protoMessage is an encoded protobuf message, built a field at a time.
+type protoMessage []byte
+
+// bytes appends a length-delimited field, omitted if empty as proto3
+// omits default values.
+func (m protoMessage) bytes(field int, v []byte) protoMessage {
+	if len(v) == 0 {
+		return m
+	}
+	return m.repeated(field, v)
+}
+
+// repeated appends one element of a repeated length-delimited field.
+func (m protoMessage) repeated(field int, v []byte) protoMessage {
+	m = binary.AppendUvarint(m, uint64(field)<<3|2)
+	m = binary.AppendUvarint(m, uint64(len(v)))
+	return append(m, v...)
+}
+
+// varint appends a varint field, omitted if zero. Negative integers are
+// encoded as their two's complement, as for int32 and int64.
+func (m protoMessage) varint(field int, v int64) protoMessage {
+	if v == 0 {
+		return m
+	}
+	m = binary.AppendUvarint(m, uint64(field)<<3)
+	return binary.AppendUvarint(m, uint64(v))
+}
+
+// protoFields are the decoded fields of a protobuf message. Fields of
+// other wire types are skipped.
+type protoFields struct {
+	lengths map[int][][]byte
+	varints map[int]uint64
+}
+
+func parseProto(data []byte) (*protoFields, error) {
+	f := &protoFields{lengths: make(map[int][][]byte), varints: make(map[int]uint64)}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 || key>>3 == 0 {
+			return nil, fmt.Errorf("invalid field key")
+		}
+		data = data[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint in field %d", field)
+			}
+			f.varints[field] = v
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			data = data[8:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			f.lengths[field] = append(f.lengths[field], data[n:n+int(size)])
+			data = data[n+int(size):]
+		case 5:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			data = data[4:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in field %d", key&7, field)
+		}
+	}
+	return f, nil
+}
+
+// bytes returns the last value of a length-delimited field.
+func (f *protoFields) bytes(field int) []byte {
+	values := f.lengths[field]
+	if len(values) == 0 {
+		return nil
+	}
+	return values[len(values)-1]
+}
+
+func (f *protoFields) str(field int) string {
+	return string(f.bytes(field))
+}
+
+func (f *protoFields) num(field int) int64 {
+	return int64(f.varints[field])
+}
+
+// ----------------------------------------------------------------------------
+// gRPC framing
+// ----------------------------------------------------------------------------
+
+// grpcFrame returns msg as an uncompressed length-prefixed gRPC message.
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// readGRPCFrame reads one length-prefixed gRPC message of at most limit
+// bytes. The message buffer grows as bytes arrive, so a frame that
+// declares a large size costs no more memory than it delivers.
+func readGRPCFrame(r io.Reader, limit int64) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("missing message: %w", err)
+	}
+	if header[0] != 0 {
+		return nil, fmt.Errorf("compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if int64(size) > limit {
+		return nil, fmt.Errorf("message of %d bytes exceeds %d", size, limit)
+	}
+	msg, err := io.ReadAll(io.LimitReader(r, int64(size)))
+	if err != nil {
+		return nil, fmt.Errorf("truncated message: %w", err)
+	}
+	if len(msg) < int(size) {
+		return nil, fmt.Errorf("truncated message: %w", io.ErrUnexpectedEOF)
+	}
+	return msg, nil
+}
+
+// grpcStatusOf returns the gRPC status code for an error.
+func grpcStatusOf(err error) int {
+	switch CodeOf(err) {
+	case ErrCodeNotFound:
+		return grpcNotFound
+	case ErrCodeInvalidInput, ErrCodeInvalidJSON, ErrCodeMissingField:
+		return grpcInvalidArgument
+	case ErrCodeUnauthorized:
+		return grpcPermissionDenied
+	case ErrCodeConflict:
+		return grpcFailedPrecondition
+	}
+	return grpcInternal
+}
+
+// errorCodeOfGRPC returns the ErrorCode for a gRPC status from a server
+// that did not send one.
+func errorCodeOfGRPC(status int) ErrorCode {
+	switch status {
+	case grpcNotFound:
+		return ErrCodeNotFound
+	case grpcInvalidArgument:
+		return ErrCodeInvalidInput
+	case grpcPermissionDenied, grpcUnauthenticated:
+		return ErrCodeUnauthorized
+	case grpcFailedPrecondition:
+		return ErrCodeConflict
+	}
+	return ErrCodeStorage
+}
+
+// grpcEncodeMessage percent-encodes a grpc-message value.
+func grpcEncodeMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ----------------------------------------------------------------------------
+// Server
+// ----------------------------------------------------------------------------
+
+// GRPCStoreHandlerOptions configure NewGRPCStoreHandler.
+type GRPCStoreHandlerOptions struct {
+	// Authorize, if set, is called before every call with the name of its
+	// method, such as "Put" or "Verify". An error refuses the call with
+	// PERMISSION_DENIED.
+	Authorize func(r *http.Request, method string) error
+	// Verify are the options the Verify method verifies documents with.
+	Verify *VerifyOptions
+}
+
+// grpcStoreHandler serves the CovenantStore gRPC service.
+type grpcStoreHandler struct {
+	store Store
+	opts  GRPCStoreHandlerOptions
+}
+
+// NewGRPCStoreHandler serves store as the grith.v1.CovenantStore gRPC
+// service of proto/grith/v1/store.proto, with server-side verification of
+// submitted documents. Documents are content-addressed as by
+// NewStoreHandler. gRPC requires HTTP/2, which net/http serves over TLS;
+// cleartext HTTP/2 needs a wrapper such as golang.org/x/net/http2/h2c.
+func NewGRPCStoreHandler(store Store, opts *GRPCStoreHandlerOptions) http.Handler {
+	h := &grpcStoreHandler{store: store}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+func (h *grpcStoreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "not a gRPC request", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+
+	method, ok := strings.CutPrefix(r.URL.Path, grpcStoreService)
+	call, known := h.methods()[method]
+	if !ok || !known {
+		writeGRPCStatus(w, grpcUnimplemented, "", fmt.Sprintf("unknown method %s", r.URL.Path))
+		return
+	}
+	if h.opts.Authorize != nil {
+		if err := h.opts.Authorize(r, method); err != nil {
+			err = errorf(ErrCodeUnauthorized, "%s refused: %w", method, err)
+			writeGRPCStatus(w, grpcPermissionDenied, ErrCodeUnauthorized, err.Error())
+			return
+		}
+	}
+	limit := int64(MaxDocumentSize + 4096)
+	if method == "PutMany" {
+		limit = maxBulkRequestSize
+	}
+	data, err := readGRPCFrame(r.Body, limit)
+	var req *protoFields
+	if err == nil {
+		req, err = parseProto(data)
+	}
+	if err != nil {
+		writeGRPCStatus(w, grpcInvalidArgument, ErrCodeInvalidInput, "invalid request: "+err.Error())
+		return
+	}
+	resp, err := call(req)
+	if err != nil {
+		writeGRPCStatus(w, grpcStatusOf(err), CodeOf(err), strings.TrimPrefix(err.Error(), "grith: "))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(grpcFrame(resp))
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+}
+
+// writeGRPCStatus writes a trailers-only error response.
+func writeGRPCStatus(w http.ResponseWriter, status int, code ErrorCode, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(status))
+	w.Header().Set("Grpc-Message", grpcEncodeMessage(message))
+	if code != "" {
+		w.Header().Set("Grith-Error-Code", string(code))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *grpcStoreHandler) methods() map[string]func(*protoFields) (protoMessage, error) {
+	return map[string]func(*protoFields) (protoMessage, error){
+		"Put":     h.put,
+		"Get":     h.get,
+		"Delete":  h.delete,
+		"List":    h.list,
+		"Has":     h.has,
+		"Count":   h.count,
+		"Verify":  h.verify,
+		"PutMany": h.putMany,
+		"GetMany": h.getMany,
+	}
+}
+
+// decodeDocument decodes a JSON document field of a request.
+func decodeDocument(data []byte) (*CovenantDocument, error) {
+	var doc CovenantDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "invalid document: %w", err)
+	}
+	return &doc, nil
+}
+
+func (h *grpcStoreHandler) put(req *protoFields) (protoMessage, error) {
+	id := req.str(1)
+	doc, err := decodeDocument(req.bytes(2))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContentAddress(id, doc); err != nil {
+		return nil, err
+	}
+	return nil, h.store.Put(id, doc)
+}
+
+func (h *grpcStoreHandler) get(req *protoFields) (protoMessage, error) {
+	doc, err := h.store.Get(req.str(1))
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "failed to serialize document: %w", err)
+	}
+	return protoMessage(nil).bytes(1, data).varint(2, 1), nil
+}
+
+func (h *grpcStoreHandler) delete(req *protoFields) (protoMessage, error) {
+	return nil, h.store.Delete(req.str(1))
+}
+
+func (h *grpcStoreHandler) list(req *protoFields) (protoMessage, error) {
+	limit := int(req.num(2))
+	if limit == 0 || limit > maxStorePageSize {
+		limit = maxStorePageSize
+	}
+	var docs []*CovenantDocument
+	var next string
+	var err error
+	if paged, ok := h.store.(PagedStore); ok {
+		docs, next, err = paged.ListPage(req.str(1), limit)
+	} else {
+		docs, next, err = listStorePage(h.store, req.str(1), limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var resp protoMessage
+	for _, doc := range docs {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, errorf(ErrCodeSerialization, "failed to serialize document: %w", err)
+		}
+		resp = resp.repeated(1, data)
+	}
+	return resp.bytes(2, []byte(next)), nil
+}
+
+func (h *grpcStoreHandler) has(req *protoFields) (protoMessage, error) {
+	if h.store.Has(req.str(1)) {
+		return protoMessage(nil).varint(1, 1), nil
+	}
+	return nil, nil
+}
+
+func (h *grpcStoreHandler) count(*protoFields) (protoMessage, error) {
+	return protoMessage(nil).varint(1, int64(h.store.Count())), nil
+}
+
+func (h *grpcStoreHandler) verify(req *protoFields) (protoMessage, error) {
+	doc, err := decodeDocument(req.bytes(1))
+	if err != nil {
+		return nil, err
+	}
+	result, err := VerifyCovenantWithOptions(doc, h.opts.Verify)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "failed to serialize verification result: %w", err)
+	}
+	return protoMessage(nil).bytes(1, data), nil
+}
+
+func (h *grpcStoreHandler) putMany(req *protoFields) (protoMessage, error) {
+	entries := req.lengths[1]
+	if len(entries) > maxStorePageSize {
+		return nil, errorf(ErrCodeInvalidInput, "bulk requests are limited to %d entries", maxStorePageSize)
+	}
+	docs := make(map[string]*CovenantDocument, len(entries))
+	for _, entry := range entries {
+		fields, err := parseProto(entry)
+		if err != nil {
+			return nil, errorf(ErrCodeInvalidInput, "invalid document entry: %w", err)
+		}
+		id := fields.str(1)
+		doc, err := decodeDocument(fields.bytes(2))
+		if err != nil {
+			return nil, err
+		}
+		if err := checkContentAddress(id, doc); err != nil {
+			return nil, err
+		}
+		docs[id] = doc
+	}
+	return nil, PutMany(h.store, docs)
+}
+
+func (h *grpcStoreHandler) getMany(req *protoFields) (protoMessage, error) {
+	if len(req.lengths[1]) > maxStorePageSize {
+		return nil, errorf(ErrCodeInvalidInput, "bulk requests are limited to %d entries", maxStorePageSize)
+	}
+	ids := make([]string, len(req.lengths[1]))
+	for i, id := range req.lengths[1] {
+		ids[i] = string(id)
+	}
+	docs, err := GetMany(h.store, ids)
+	if err != nil {
+		return nil, err
+	}
+	return encodeStoredDocuments(docs)
+}
+
+// encodeStoredDocuments encodes docs as repeated StoredDocument field 1.
+func encodeStoredDocuments(docs map[string]*CovenantDocument) (protoMessage, error) {
+	var msg protoMessage
+	for _, id := range sortedDocumentIDs(docs) {
+		data, err := json.Marshal(docs[id])
+		if err != nil {
+			return nil, errorf(ErrCodeSerialization, "failed to serialize document: %w", err)
+		}
+		msg = msg.repeated(1, protoMessage(nil).bytes(1, []byte(id)).bytes(2, data))
+	}
+	return msg, nil
+}
+
+// ----------------------------------------------------------------------------
+// Client
+// ----------------------------------------------------------------------------
+
+// GRPCStoreClientOptions configure a GRPCStoreClient.
+type GRPCStoreClientOptions struct {
+	// HTTPClient is used for calls and must speak HTTP/2, as
+	// http.DefaultClient does over TLS. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Authenticate, if set, is called on every call before it is sent, to
+	// add credentials such as an Authorization header.
+	Authenticate func(req *http.Request) error
+}
+
+// GRPCStoreClient is a PagedStore and BulkStore backed by a grith.v1.CovenantStore gRPC
+// service, such as one served by NewGRPCStoreHandler, which can also
+// verify documents server-side. Has and Count cannot report errors, so a
+// failed call reports false and zero. It is safe for concurrent use.
+type GRPCStoreClient struct {
+	baseURL string
+	opts    GRPCStoreClientOptions
+}
+
+// NewGRPCStoreClient creates a client for the service at baseURL, such as
+// "https://registry.example.com".
+func NewGRPCStoreClient(baseURL string, opts *GRPCStoreClientOptions) (*GRPCStoreClient, error) {
+	if _, err := url.Parse(baseURL); err != nil || baseURL == "" {
+		return nil, errorf(ErrCodeInvalidInput, "grith: invalid gRPC store URL: %q", baseURL)
+	}
+	c := &GRPCStoreClient{baseURL: strings.TrimRight(baseURL, "/")}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.HTTPClient == nil {
+		c.opts.HTTPClient = http.DefaultClient
+	}
+	return c, nil
+}
+
+// Put stores doc under id, which the service requires to be its ID.
+func (c *GRPCStoreClient) Put(id string, doc *CovenantDocument) error {
+	if doc == nil {
+		return errorf(ErrCodeMissingField, "grith: grpcStoreClient.Put: document is nil")
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return errorf(ErrCodeSerialization, "grith: grpcStoreClient.Put: failed to serialize document: %w", err)
+	}
+	_, err = c.call("Put", protoMessage(nil).bytes(1, []byte(id)).bytes(2, data), 4096)
+	return err
+}
+
+// Get retrieves a document by ID. Returns nil if not found.
+func (c *GRPCStoreClient) Get(id string) (*CovenantDocument, error) {
+	resp, err := c.call("Get", protoMessage(nil).bytes(1, []byte(id)), MaxDocumentSize+4096)
+	if err != nil || resp.num(2) == 0 {
+		return nil, err
+	}
+	var doc CovenantDocument
+	if err := json.Unmarshal(resp.bytes(1), &doc); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "grith: invalid gRPC store response: %w", err)
+	}
+	return &doc, nil
+}
+
+// Delete removes a document by ID.
+func (c *GRPCStoreClient) Delete(id string) error {
+	_, err := c.call("Delete", protoMessage(nil).bytes(1, []byte(id)), 4096)
+	return err
+}
+
+// List returns every document in the service, reading it a page at a
+// time.
+func (c *GRPCStoreClient) List() ([]*CovenantDocument, error) {
+	var docs []*CovenantDocument
+	cursor := ""
+	for {
+		page, next, err := c.ListPage(cursor, remoteStorePageSize)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, page...)
+		if next == "" {
+			return docs, nil
+		}
+		cursor = next
+	}
+}
+
+// ListPage returns a page of documents. See PagedStore.
+func (c *GRPCStoreClient) ListPage(cursor string, limit int) ([]*CovenantDocument, string, error) {
+	if limit < 1 {
+		return nil, "", errorf(ErrCodeInvalidInput, "grith: page limit must be positive, got %d", limit)
+	}
+	limit = min(limit, maxStorePageSize)
+	req := protoMessage(nil).bytes(1, []byte(cursor)).varint(2, int64(limit))
+	resp, err := c.call("List", req, int64(limit+1)*MaxDocumentSize)
+	if err != nil {
+		return nil, "", err
+	}
+	docs := make([]*CovenantDocument, 0, len(resp.lengths[1]))
+	for _, data := range resp.lengths[1] {
+		var doc CovenantDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, "", errorf(ErrCodeInvalidJSON, "grith: invalid gRPC store response: %w", err)
+		}
+		docs = append(docs, &doc)
+	}
+	return docs, resp.str(2), nil
+}
+
+// Has reports whether the service holds a document with the given ID.
+func (c *GRPCStoreClient) Has(id string) bool {
+	resp, err := c.call("Has", protoMessage(nil).bytes(1, []byte(id)), 4096)
+	return err == nil && resp.num(1) != 0
+}
+
+// Count returns the number of documents in the service.
+func (c *GRPCStoreClient) Count() int {
+	resp, err := c.call("Count", nil, 4096)
+	if err != nil {
+		return 0
+	}
+	return int(resp.num(1))
+}
+
+// PutMany stores docs with one call per 1000 documents or
+// maxBulkRequestSize bytes, each call stored as a whole if the server's
+// store is a BulkStore. See BulkStore.
+func (c *GRPCStoreClient) PutMany(docs map[string]*CovenantDocument) error {
+	var req protoMessage
+	n := 0
+	send := func() error {
+		if n == 0 {
+			return nil
+		}
+		_, err := c.call("PutMany", req, 4096)
+		req, n = req[:0], 0
+		return err
+	}
+	for _, id := range sortedDocumentIDs(docs) {
+		if docs[id] == nil {
+			return errorf(ErrCodeMissingField, "grith: grpcStoreClient.PutMany: document %s is nil", id)
+		}
+		data, err := json.Marshal(docs[id])
+		if err != nil {
+			return errorf(ErrCodeSerialization, "grith: grpcStoreClient.PutMany: failed to serialize document: %w", err)
+		}
+		entry := protoMessage(nil).repeated(1, protoMessage(nil).bytes(1, []byte(id)).bytes(2, data))
+		if n == maxStorePageSize || len(req)+len(entry) > maxBulkRequestSize {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		req = append(req, entry...)
+		n++
+	}
+	return send()
+}
+
+// GetMany retrieves documents with one call per 1000 IDs. See BulkStore.
+func (c *GRPCStoreClient) GetMany(ids []string) (map[string]*CovenantDocument, error) {
+	result := make(map[string]*CovenantDocument, len(ids))
+	for start := 0; start < len(ids); start += maxStorePageSize {
+		chunk := ids[start:min(start+maxStorePageSize, len(ids))]
+		var req protoMessage
+		for _, id := range chunk {
+			req = req.repeated(1, []byte(id))
+		}
+		resp, err := c.call("GetMany", req, int64(len(chunk)+1)*MaxDocumentSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range resp.lengths[1] {
+			fields, err := parseProto(entry)
+			if err != nil {
+				return nil, errorf(ErrCodeStorage, "grith: invalid gRPC response: %w", err)
+			}
+			var doc CovenantDocument
+			if err := json.Unmarshal(fields.bytes(2), &doc); err != nil {
+				return nil, errorf(ErrCodeInvalidJSON, "grith: invalid gRPC store response: %w", err)
+			}
+			result[fields.str(1)] = &doc
+		}
+	}
+	return result, nil
+}
+
+// Verify verifies doc on the server with its verification options.
+func (c *GRPCStoreClient) Verify(doc *CovenantDocument) (*VerificationResult, error) {
+	if doc == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: grpcStoreClient.Verify: document is nil")
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "grith: grpcStoreClient.Verify: failed to serialize document: %w", err)
+	}
+	resp, err := c.call("Verify", protoMessage(nil).bytes(1, data), 2*MaxDocumentSize)
+	if err != nil {
+		return nil, err
+	}
+	var result VerificationResult
+	if err := json.Unmarshal(resp.bytes(1), &result); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "grith: invalid gRPC verification result: %w", err)
+	}
+	return &result, nil
+}
+
+// call invokes a unary method and returns its response of at most limit
+// bytes.
+func (c *GRPCStoreClient) call(method string, req protoMessage, limit int64) (*protoFields, error) {
+	httpReq, err := http.NewRequest(http.MethodPost, c.baseURL+grpcStoreService+method, bytes.NewReader(grpcFrame(req)))
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: failed to build gRPC request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("Te", "trailers")
+	if c.opts.Authenticate != nil {
+		if err := c.opts.Authenticate(httpReq); err != nil {
+			return nil, errorf(ErrCodeUnauthorized, "grith: failed to authenticate gRPC request: %w", err)
+		}
+	}
+	resp, err := c.opts.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: gRPC request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorf(ErrCodeStorage, "grith: gRPC store returned HTTP %d", resp.StatusCode)
+	}
+
+	// A trailers-only response carries its status in the headers.
+	status := resp.Header
+	var msg []byte
+	if status.Get("Grpc-Status") == "" {
+		if msg, err = readGRPCFrame(resp.Body, limit); err != nil {
+			return nil, errorf(ErrCodeStorage, "grith: invalid gRPC response: %w", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		status = resp.Trailer
+	}
+	code, err := strconv.Atoi(status.Get("Grpc-Status"))
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: gRPC response has no status")
+	}
+	if code != grpcOK {
+		message, _ := url.PathUnescape(status.Get("Grpc-Message"))
+		errCode := ErrorCode(status.Get("Grith-Error-Code"))
+		if errCode == "" {
+			errCode = errorCodeOfGRPC(code)
+		}
+		return nil, errorf(errCode, "grith: gRPC store: %s", message)
+	}
+	fields, err := parseProto(msg)
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: invalid gRPC response: %w", err)
+	}
+	return fields, nil
+}
@@ -3,6 +3,7 @@ package grith
 import (
 	"crypto/ed25519"
 	"fmt"
+	"io"
 	"sort"
 )
 
@@ -29,10 +30,14 @@ type ModelAttestation struct {
 
 // DeploymentContext describes where and how an agent is deployed.
 type DeploymentContext struct {
-	Runtime        RuntimeType `json:"runtime"`
-	TEEAttestation string      `json:"teeAttestation,omitempty"`
-	Region         string      `json:"region,omitempty"`
-	Provider       string      `json:"provider,omitempty"`
+	Runtime RuntimeType `json:"runtime"`
+	// TEEAttestation is the base64-encoded attestation document of a TEE
+	// runtime, in the format named by TEEAttestationType. It must bind
+	// the identity's operator key; see VerifyDeploymentAttestation.
+	TEEAttestation     string `json:"teeAttestation,omitempty"`
+	TEEAttestationType string `json:"teeAttestationType,omitempty"`
+	Region             string `json:"region,omitempty"`
+	Provider           string `json:"provider,omitempty"`
 }
 
 // LineageEntry is a single entry in an agent's identity evolution chain.
@@ -44,8 +49,44 @@ type LineageEntry struct {
 	ParentHash             *string `json:"parentHash"`
 	Signature              string  `json:"signature"`
 	ReputationCarryForward float64 `json:"reputationCarryForward"`
+	// PreviousOperatorKey and NewOperatorKey record the keys involved in
+	// an operator_key_rotation entry. Signature is made with the previous
+	// key and NewKeySignature with the new one, over the same payload.
+	PreviousOperatorKey string `json:"previousOperatorKey,omitempty"`
+	NewOperatorKey      string `json:"newOperatorKey,omitempty"`
+	NewKeySignature     string `json:"newKeySignature,omitempty"`
+	// Operators records a new operator set introduced by this entry.
+	// Entries of organizational identities carry threshold Signatures
+	// instead of Signature.
+	Operators  *OperatorSet        `json:"operators,omitempty"`
+	Signatures []OperatorSignature `json:"signatures,omitempty"`
+	// PolicyHash is the hash of the evolution policy that rated this
+	// entry's carry-forward, set when the identity carries its own.
+	PolicyHash string `json:"policyHash,omitempty"`
+	// Fork links the creation entry of a forked identity to the identity
+	// it was forked from.
+	Fork *ForkLink `json:"fork,omitempty"`
+	// Summary stands in for the entries before it in a lineage compacted
+	// by CompactLineage.
+	Summary *LineageSummary `json:"summary,omitempty"`
+	// NextKeyCommitment records a pre-rotation commitment made by this
+	// entry to the operator key of the next rotation.
+	NextKeyCommitment string `json:"nextKeyCommitment,omitempty"`
+	// Recovery records a new recovery set declared by this entry.
+	Recovery *OperatorSet `json:"recovery,omitempty"`
+	// Capabilities records the identity's sorted capabilities after this
+	// entry, set by the first entry and by entries that change them.
+	// EvolutionPolicy records the policy in force from this entry on, set
+	// by entries that adopt one. Together they let VerifyIdentity
+	// recompute every entry's ReputationCarryForward.
+	Capabilities    []string         `json:"capabilities,omitempty"`
+	EvolutionPolicy *EvolutionPolicy `json:"evolutionPolicy,omitempty"`
 }
 
+// ChangeOperatorKeyRotation is the lineage change type recorded by
+// RotateOperatorKey.
+const ChangeOperatorKeyRotation = "operator_key_rotation"
+
 // AgentIdentity is a complete, signed AI agent identity.
 type AgentIdentity struct {
 	ID                     string            `json:"id"`
@@ -60,43 +101,118 @@ type AgentIdentity struct {
 	CreatedAt              string            `json:"createdAt"`
 	UpdatedAt              string            `json:"updatedAt"`
 	Signature              string            `json:"signature"`
+	// Operators is set for organizational identities, which carry
+	// threshold Signatures instead of Signature.
+	Operators  *OperatorSet        `json:"operators,omitempty"`
+	Signatures []OperatorSignature `json:"signatures,omitempty"`
+	// Parent binds a sub-identity to the identity it was derived from.
+	Parent *ParentBinding `json:"parent,omitempty"`
+	// EvolutionPolicy, if set, rates the carry-forward of this identity's
+	// evolutions in place of DefaultEvolutionPolicy.
+	EvolutionPolicy *EvolutionPolicy `json:"evolutionPolicy,omitempty"`
+	// NextKeyCommitment, if set, is the ComputeKeyCommitment of the only
+	// key the operator key may next be rotated to.
+	NextKeyCommitment string `json:"nextKeyCommitment,omitempty"`
+	// Recovery, if set, is the set of recovery keys a threshold of which
+	// can replace a lost operator key with RecoverOperatorKey.
+	Recovery *OperatorSet `json:"recovery,omitempty"`
 }
 
 // EvolutionPolicy defines reputation carry-forward rates for each
-// type of identity evolution.
+// type of identity evolution. Rates are between 0 and 1.
 type EvolutionPolicy struct {
-	MinorUpdate        float64
-	ModelVersionChange float64
-	ModelFamilyChange  float64
-	OperatorTransfer   float64
-	CapabilityExpansion float64
-	CapabilityReduction float64
-	FullRebuild        float64
-}
-
-// DefaultEvolutionPolicy is the default reputation carry-forward policy.
-var DefaultEvolutionPolicy = EvolutionPolicy{
-	MinorUpdate:        0.95,
-	ModelVersionChange: 0.80,
-	ModelFamilyChange:  0.20,
-	OperatorTransfer:   0.50,
-	CapabilityExpansion: 0.90,
-	CapabilityReduction: 1.00,
-	FullRebuild:        0.00,
+	MinorUpdate         float64 `json:"minorUpdate"`
+	ModelVersionChange  float64 `json:"modelVersionChange"`
+	ModelFamilyChange   float64 `json:"modelFamilyChange"`
+	OperatorTransfer    float64 `json:"operatorTransfer"`
+	CapabilityExpansion float64 `json:"capabilityExpansion"`
+	CapabilityReduction float64 `json:"capabilityReduction"`
+	FullRebuild         float64 `json:"fullRebuild"`
+	OperatorKeyRotation float64 `json:"operatorKeyRotation"`
+	OperatorKeyRecovery float64 `json:"operatorKeyRecovery"`
+}
+
+// DefaultEvolutionPolicy returns the default reputation carry-forward
+// policy, used by identities that do not carry their own.
+func DefaultEvolutionPolicy() EvolutionPolicy {
+	return EvolutionPolicy{
+		MinorUpdate:         0.95,
+		ModelVersionChange:  0.80,
+		ModelFamilyChange:   0.20,
+		OperatorTransfer:    0.50,
+		CapabilityExpansion: 0.90,
+		CapabilityReduction: 1.00,
+		FullRebuild:         0.00,
+		OperatorKeyRotation: 1.00,
+		OperatorKeyRecovery: 0.30,
+	}
+}
+
+// ComputeEvolutionPolicyHash computes the canonical hash of a policy, as
+// recorded in lineage entries.
+func ComputeEvolutionPolicyHash(policy EvolutionPolicy) string {
+	canonical, _ := CanonicalizeJSON(&policy)
+	return SHA256String(canonical)
+}
+
+func validateEvolutionPolicy(policy *EvolutionPolicy) error {
+	rates := []float64{policy.MinorUpdate, policy.ModelVersionChange, policy.ModelFamilyChange, policy.OperatorTransfer,
+		policy.CapabilityExpansion, policy.CapabilityReduction, policy.FullRebuild, policy.OperatorKeyRotation}
+	for _, r := range rates {
+		if !(r >= 0 && r <= 1) {
+			return errorf(ErrCodeInvalidInput, "grith: evolution policy rates must be between 0 and 1")
+		}
+	}
+	return nil
+}
+
+// identityPolicy returns the policy in force for identity and the hash
+// its lineage entries record, which is empty for the default policy.
+func identityPolicy(identity *AgentIdentity) (EvolutionPolicy, string) {
+	if identity.EvolutionPolicy == nil {
+		return DefaultEvolutionPolicy(), ""
+	}
+	return *identity.EvolutionPolicy, ComputeEvolutionPolicyHash(*identity.EvolutionPolicy)
+}
+
+func copyEvolutionPolicy(policy *EvolutionPolicy) *EvolutionPolicy {
+	if policy == nil {
+		return nil
+	}
+	p := *policy
+	return &p
 }
 
 // CreateIdentityOptions are the options for creating a new agent identity.
 type CreateIdentityOptions struct {
 	OperatorKeyPair    *KeyPair
+	// Operators, if set, creates an organizational identity controlled by
+	// the set, signed by a threshold of OperatorKeyPairs.
+	Operators          *OperatorSet
+	OperatorKeyPairs   []*KeyPair
 	OperatorIdentifier string
 	Model              ModelAttestation
 	Capabilities       []string
 	Deployment         DeploymentContext
+	// EvolutionPolicy, if set, is recorded on the identity and rates its
+	// evolutions' carry-forward.
+	EvolutionPolicy *EvolutionPolicy
+	// NextKeyCommitment, if set, commits a single-operator identity to
+	// the key of its next operator key rotation.
+	NextKeyCommitment string
+	// Recovery, if set, declares the recovery keys of a single-operator
+	// identity.
+	Recovery *OperatorSet
 }
 
 // EvolveIdentityOptions are the options for evolving an existing identity.
 type EvolveIdentityOptions struct {
 	OperatorKeyPair        *KeyPair
+	// OperatorKeyPairs sign the evolution of an organizational identity.
+	// A threshold of the current set must sign, and of Operators too if
+	// it replaces the set.
+	OperatorKeyPairs       []*KeyPair
+	Operators              *OperatorSet
 	ChangeType             string
 	Description            string
 	Model                  *ModelAttestation
@@ -104,7 +220,60 @@ type EvolveIdentityOptions struct {
 	Deployment             *DeploymentContext
 	OperatorPublicKey      string
 	OperatorIdentifier     string
-	ReputationCarryForward *float64
+	// EvolutionPolicy, if set, replaces the identity's policy and rates
+	// this evolution.
+	EvolutionPolicy *EvolutionPolicy
+	// NextKeyCommitment, if set, commits the identity to the key of its
+	// next operator key rotation. Only an identity without a commitment
+	// may adopt one; a commitment is replaced by rotating.
+	NextKeyCommitment string
+	// Recovery, if set, declares or replaces the identity's recovery
+	// keys. It cannot be changed while a key commitment is in force.
+	Recovery *OperatorSet
+}
+
+// ChangeCapability is the lineage change type of an evolution that only
+// changes capabilities. The callers' labels "capability_expansion" and
+// "capability_reduction" are recorded as ChangeCapability; whether the
+// change expands or reduces is inferred from the capabilities themselves.
+const ChangeCapability = "capability_change"
+
+// CapabilityDiff lists the capabilities an evolution adds and removes.
+type CapabilityDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// Empty reports whether the diff changes nothing.
+func (d CapabilityDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// DiffCapabilities returns the capabilities in updated but not in old,
+// and those in old but not in updated, each sorted and deduplicated.
+func DiffCapabilities(old, updated []string) CapabilityDiff {
+	inOld := make(map[string]bool, len(old))
+	for _, c := range old {
+		inOld[c] = true
+	}
+	inUpdated := make(map[string]bool, len(updated))
+	for _, c := range updated {
+		inUpdated[c] = true
+	}
+	var d CapabilityDiff
+	for c := range inUpdated {
+		if !inOld[c] {
+			d.Added = append(d.Added, c)
+		}
+	}
+	for c := range inOld {
+		if !inUpdated[c] {
+			d.Removed = append(d.Removed, c)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	return d
 }
 
 // ComputeCapabilityManifestHash computes a canonical hash of a sorted
@@ -122,10 +291,25 @@ func ComputeCapabilityManifestHash(capabilities []string) string {
 func computeIdentityHash(identity *AgentIdentity) (string, error) {
 	composite := map[string]interface{}{
 		"operatorPublicKey":      identity.OperatorPublicKey,
-		"model":                  identity.Model,
+		"model":                  identity.Model.jsonMap(),
 		"capabilityManifestHash": identity.CapabilityManifestHash,
-		"deployment":             identity.Deployment,
-		"lineage":                identity.Lineage,
+		"deployment":             identity.Deployment.jsonMap(),
+		"lineage":                lineageValue(identity.Lineage),
+	}
+	if identity.Operators != nil {
+		composite["operators"] = identity.Operators
+	}
+	if identity.Parent != nil {
+		composite["parent"] = identity.Parent
+	}
+	if identity.EvolutionPolicy != nil {
+		composite["evolutionPolicy"] = identity.EvolutionPolicy
+	}
+	if identity.NextKeyCommitment != "" {
+		composite["nextKeyCommitment"] = identity.NextKeyCommitment
+	}
+	if identity.Recovery != nil {
+		composite["recovery"] = identity.Recovery
 	}
 	return SHA256Object(composite)
 }
@@ -138,6 +322,7 @@ func identitySigningPayload(identity *AgentIdentity) (string, error) {
 		return "", err
 	}
 	delete(m, "signature")
+	delete(m, "signatures")
 	return CanonicalizeJSON(m)
 }
 
@@ -149,6 +334,8 @@ func lineageSigningPayload(entry *LineageEntry) (string, error) {
 		return "", err
 	}
 	delete(m, "signature")
+	delete(m, "newKeySignature")
+	delete(m, "signatures")
 	return CanonicalizeJSON(m)
 }
 
@@ -156,17 +343,47 @@ func lineageSigningPayload(entry *LineageEntry) (string, error) {
 // capability manifest hash and composite identity hash, initializes a
 // single lineage entry of type "created", and signs the whole identity.
 func CreateIdentity(opts *CreateIdentityOptions) (*AgentIdentity, error) {
+	return createIdentity(opts, nil, nil)
+}
+
+// createIdentity creates an identity, bound to a parent if parent is set
+// or forked from another identity if fork is set.
+func createIdentity(opts *CreateIdentityOptions, parent *ParentBinding, fork *ForkLink) (*AgentIdentity, error) {
 	if opts == nil {
-		return nil, fmt.Errorf("grith: createIdentity requires options")
+		return nil, errorf(ErrCodeMissingField, "grith: createIdentity requires options")
 	}
-	if opts.OperatorKeyPair == nil {
-		return nil, fmt.Errorf("grith: operatorKeyPair is required")
+	if opts.OperatorKeyPair == nil && opts.Operators == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: operatorKeyPair is required")
+	}
+	operatorKey := ""
+	if opts.Operators != nil {
+		if err := validateOperatorSet(opts.Operators); err != nil {
+			return nil, err
+		}
+		operatorKey = opts.Operators.Keys[0]
+	} else {
+		operatorKey = opts.OperatorKeyPair.PublicKeyHex
 	}
 	if opts.Model.Provider == "" || opts.Model.ModelID == "" {
-		return nil, fmt.Errorf("grith: model.provider and model.modelId are required")
+		return nil, errorf(ErrCodeMissingField, "grith: model.provider and model.modelId are required")
 	}
 	if opts.Capabilities == nil {
-		return nil, fmt.Errorf("grith: capabilities array is required")
+		return nil, errorf(ErrCodeMissingField, "grith: capabilities array is required")
+	}
+	if opts.EvolutionPolicy != nil {
+		if err := validateEvolutionPolicy(opts.EvolutionPolicy); err != nil {
+			return nil, err
+		}
+	}
+	if opts.NextKeyCommitment != "" {
+		if err := validateKeyCommitment(opts.NextKeyCommitment, opts.Operators); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Recovery != nil {
+		if err := validateRecoverySet(opts.Recovery, opts.Operators); err != nil {
+			return nil, err
+		}
 	}
 
 	now := Timestamp()
@@ -180,7 +397,7 @@ func CreateIdentity(opts *CreateIdentityOptions) (*AgentIdentity, error) {
 
 	identity := &AgentIdentity{
 		ID:                     "",
-		OperatorPublicKey:      opts.OperatorKeyPair.PublicKeyHex,
+		OperatorPublicKey:      operatorKey,
 		OperatorIdentifier:     opts.OperatorIdentifier,
 		Model:                  opts.Model,
 		Capabilities:           sortedCaps,
@@ -191,55 +408,75 @@ func CreateIdentity(opts *CreateIdentityOptions) (*AgentIdentity, error) {
 		CreatedAt:              now,
 		UpdatedAt:              now,
 		Signature:              "",
+		Operators:              copyOperatorSet(opts.Operators),
+		Parent:                 parent,
+		EvolutionPolicy:        copyEvolutionPolicy(opts.EvolutionPolicy),
+		NextKeyCommitment:      opts.NextKeyCommitment,
+		Recovery:               copyOperatorSet(opts.Recovery),
 	}
 
 	// Compute identity hash
 	idHash, err := computeIdentityHash(identity)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to compute identity hash: %w", err)
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute identity hash: %w", err)
 	}
 
 	// Create initial lineage entry
+	changeType, description := "created", "Identity created"
+	carryForward := 1.0
+	policy, policyHash := identityPolicy(identity)
+	if parent != nil {
+		changeType, description = ChangeDerived, "Derived from "+shortID(parent.ParentID)
+	}
+	if fork != nil {
+		changeType, description = ChangeFork, "Forked from "+shortID(fork.ParentID)+": "+fork.Reason
+		carryForward = getCarryForwardRate(ChangeFork, policy)
+	}
 	lineageEntry := &LineageEntry{
 		IdentityHash:           idHash,
-		ChangeType:             "created",
-		Description:            "Identity created",
+		ChangeType:             changeType,
+		Description:            description,
 		Timestamp:              now,
 		ParentHash:             nil,
 		Signature:              "",
-		ReputationCarryForward: 1.0,
+		ReputationCarryForward: carryForward,
+		Operators:              copyOperatorSet(opts.Operators),
+		PolicyHash:             policyHash,
+		Fork:                   fork,
+		NextKeyCommitment:      opts.NextKeyCommitment,
+		Recovery:               copyOperatorSet(opts.Recovery),
+		Capabilities:           sortedCaps,
+		EvolutionPolicy:        copyEvolutionPolicy(opts.EvolutionPolicy),
 	}
 
 	// Sign lineage entry
 	lineagePayload, err := lineageSigningPayload(lineageEntry)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to compute lineage signing payload: %w", err)
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute lineage signing payload: %w", err)
 	}
-	lineageSig, err := Sign([]byte(lineagePayload), opts.OperatorKeyPair.PrivateKey)
+	lineageEntry.Signature, lineageEntry.Signatures, err = signAsOperators([]byte(lineagePayload), opts.OperatorKeyPair, opts.OperatorKeyPairs, opts.Operators)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to sign lineage entry: %w", err)
+		return nil, err
 	}
-	lineageEntry.Signature = ToHex(lineageSig)
 
 	identity.Lineage = []LineageEntry{*lineageEntry}
 
 	// Recompute identity hash with lineage
 	idHash, err = computeIdentityHash(identity)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to recompute identity hash: %w", err)
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to recompute identity hash: %w", err)
 	}
 	identity.ID = idHash
 
 	// Sign the identity
 	payload, err := identitySigningPayload(identity)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to compute identity signing payload: %w", err)
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute identity signing payload: %w", err)
 	}
-	sig, err := Sign([]byte(payload), opts.OperatorKeyPair.PrivateKey)
+	identity.Signature, identity.Signatures, err = signAsOperators([]byte(payload), opts.OperatorKeyPair, opts.OperatorKeyPairs, identity.Operators)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to sign identity: %w", err)
+		return nil, err
 	}
-	identity.Signature = ToHex(sig)
 
 	return identity, nil
 }
@@ -248,19 +485,80 @@ func CreateIdentity(opts *CreateIdentityOptions) (*AgentIdentity, error) {
 // The new identity is linked to the previous one via the lineage chain.
 func EvolveIdentity(current *AgentIdentity, opts *EvolveIdentityOptions) (*AgentIdentity, error) {
 	if current == nil {
-		return nil, fmt.Errorf("grith: current identity is required")
+		return nil, errorf(ErrCodeMissingField, "grith: current identity is required")
 	}
 	if opts == nil {
-		return nil, fmt.Errorf("grith: evolve options are required")
+		return nil, errorf(ErrCodeMissingField, "grith: evolve options are required")
 	}
-	if opts.OperatorKeyPair == nil {
-		return nil, fmt.Errorf("grith: operatorKeyPair is required")
+	if opts.OperatorKeyPair == nil && len(opts.OperatorKeyPairs) == 0 {
+		return nil, errorf(ErrCodeMissingField, "grith: operatorKeyPair is required")
 	}
-	if opts.ChangeType == "" {
-		return nil, fmt.Errorf("grith: changeType is required")
+	changeType := opts.ChangeType
+	switch changeType {
+	case "capability_expansion", "capability_reduction":
+		changeType = ChangeCapability
+	case "":
+		if opts.Capabilities == nil || DiffCapabilities(current.Capabilities, opts.Capabilities).Empty() {
+			return nil, errorf(ErrCodeMissingField, "grith: changeType is required")
+		}
+		changeType = ChangeCapability
 	}
 	if opts.Description == "" {
-		return nil, fmt.Errorf("grith: description is required")
+		return nil, errorf(ErrCodeMissingField, "grith: description is required")
+	}
+	if changeType == ChangeOperatorKeyRotation {
+		return nil, errorf(ErrCodeInvalidInput, "grith: use RotateOperatorKey for operator key rotations")
+	}
+	if changeType == ChangeFork {
+		return nil, errorf(ErrCodeInvalidInput, "grith: use ForkIdentity to fork an identity")
+	}
+	if changeType == ChangeCompacted {
+		return nil, errorf(ErrCodeInvalidInput, "grith: use CompactLineage to compact a lineage")
+	}
+	if opts.Operators != nil {
+		if err := validateOperatorSet(opts.Operators); err != nil {
+			return nil, err
+		}
+	}
+	if opts.EvolutionPolicy != nil {
+		if err := validateEvolutionPolicy(opts.EvolutionPolicy); err != nil {
+			return nil, err
+		}
+	}
+	if opts.OperatorPublicKey != "" && (current.Operators != nil || opts.Operators != nil) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: the operator key of an organizational identity is set by its operator set")
+	}
+	if current.NextKeyCommitment != "" {
+		if (opts.OperatorPublicKey != "" && opts.OperatorPublicKey != current.OperatorPublicKey) || opts.Operators != nil {
+			return nil, errorf(ErrCodeInvalidInput, "grith: identity is committed to its next operator key; change it with RotateOperatorKey")
+		}
+		if opts.NextKeyCommitment != "" {
+			return nil, errorf(ErrCodeInvalidInput, "grith: identity already has a key commitment; replace it with RotateOperatorKeyWithOptions")
+		}
+		if opts.Recovery != nil {
+			return nil, errorf(ErrCodeInvalidInput, "grith: recovery keys cannot change while a key commitment is in force")
+		}
+	}
+	if opts.Recovery != nil {
+		operators := current.Operators
+		if opts.Operators != nil {
+			operators = opts.Operators
+		}
+		if err := validateRecoverySet(opts.Recovery, operators); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Operators != nil && current.Recovery != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: organizational identities cannot have recovery keys")
+	}
+	if opts.NextKeyCommitment != "" {
+		operators := current.Operators
+		if opts.Operators != nil {
+			operators = opts.Operators
+		}
+		if err := validateKeyCommitment(opts.NextKeyCommitment, operators); err != nil {
+			return nil, err
+		}
 	}
 
 	now := Timestamp()
@@ -279,6 +577,11 @@ func EvolveIdentity(current *AgentIdentity, opts *EvolveIdentityOptions) (*Agent
 		CreatedAt:              current.CreatedAt,
 		UpdatedAt:              now,
 		Signature:              "",
+		Operators:              copyOperatorSet(current.Operators),
+		Parent:                 current.Parent,
+		EvolutionPolicy:        copyEvolutionPolicy(current.EvolutionPolicy),
+		NextKeyCommitment:      current.NextKeyCommitment,
+		Recovery:               copyOperatorSet(current.Recovery),
 	}
 	copy(newIdentity.Lineage, current.Lineage)
 
@@ -292,6 +595,11 @@ func EvolveIdentity(current *AgentIdentity, opts *EvolveIdentityOptions) (*Agent
 		sort.Strings(sorted)
 		newIdentity.Capabilities = sorted
 		newIdentity.CapabilityManifestHash = ComputeCapabilityManifestHash(sorted)
+		if current.Parent != nil {
+			if err := checkCapabilitySubset(sorted, current.Parent.ParentCapabilities); err != nil {
+				return nil, err
+			}
+		}
 	}
 	if opts.Deployment != nil {
 		newIdentity.Deployment = *opts.Deployment
@@ -302,17 +610,30 @@ func EvolveIdentity(current *AgentIdentity, opts *EvolveIdentityOptions) (*Agent
 	if opts.OperatorIdentifier != "" {
 		newIdentity.OperatorIdentifier = opts.OperatorIdentifier
 	}
-
-	// Determine carry-forward rate
-	carryForward := getCarryForwardRate(opts.ChangeType, DefaultEvolutionPolicy)
-	if opts.ReputationCarryForward != nil {
-		carryForward = *opts.ReputationCarryForward
+	if opts.Operators != nil {
+		newIdentity.Operators = copyOperatorSet(opts.Operators)
+		newIdentity.OperatorPublicKey = opts.Operators.Keys[0]
+	}
+	if opts.EvolutionPolicy != nil {
+		newIdentity.EvolutionPolicy = copyEvolutionPolicy(opts.EvolutionPolicy)
+	}
+	if opts.NextKeyCommitment != "" {
+		newIdentity.NextKeyCommitment = opts.NextKeyCommitment
+	}
+	if opts.Recovery != nil {
+		newIdentity.Recovery = copyOperatorSet(opts.Recovery)
 	}
 
+	// The carry-forward rate follows from the capability diff and the
+	// policy, both recorded so that verification can recompute it.
+	policy, policyHash := identityPolicy(newIdentity)
+	diff := DiffCapabilities(current.Capabilities, newIdentity.Capabilities)
+	carryForward := evolutionCarryForward(changeType, diff, policy)
+
 	// Compute new identity hash
 	idHash, err := computeIdentityHash(newIdentity)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to compute identity hash: %w", err)
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute identity hash: %w", err)
 	}
 
 	// Get parent hash from the last lineage entry
@@ -325,72 +646,381 @@ func EvolveIdentity(current *AgentIdentity, opts *EvolveIdentityOptions) (*Agent
 	// Create new lineage entry
 	lineageEntry := &LineageEntry{
 		IdentityHash:           idHash,
-		ChangeType:             opts.ChangeType,
+		ChangeType:             changeType,
 		Description:            opts.Description,
 		Timestamp:              now,
 		ParentHash:             parentHash,
 		Signature:              "",
 		ReputationCarryForward: carryForward,
+		Operators:              copyOperatorSet(opts.Operators),
+		PolicyHash:             policyHash,
+		NextKeyCommitment:      opts.NextKeyCommitment,
+		Recovery:               copyOperatorSet(opts.Recovery),
+		EvolutionPolicy:        copyEvolutionPolicy(opts.EvolutionPolicy),
+	}
+	if !diff.Empty() {
+		lineageEntry.Capabilities = newIdentity.Capabilities
 	}
 
-	// Sign lineage entry
+	// Sign lineage entry. A new operator set is authorized by the set it
+	// replaces.
 	lineagePayload, err := lineageSigningPayload(lineageEntry)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to compute lineage signing payload: %w", err)
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute lineage signing payload: %w", err)
 	}
-	lineageSig, err := Sign([]byte(lineagePayload), opts.OperatorKeyPair.PrivateKey)
+	lineageEntry.Signature, lineageEntry.Signatures, err = signAsOperators([]byte(lineagePayload), opts.OperatorKeyPair, opts.OperatorKeyPairs, current.Operators)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to sign lineage entry: %w", err)
+		return nil, err
 	}
-	lineageEntry.Signature = ToHex(lineageSig)
 
 	newIdentity.Lineage = append(newIdentity.Lineage, *lineageEntry)
 
 	// Recompute identity hash with updated lineage
 	idHash, err = computeIdentityHash(newIdentity)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to recompute identity hash: %w", err)
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to recompute identity hash: %w", err)
 	}
 	newIdentity.ID = idHash
 
 	// Sign the identity
 	payload, err := identitySigningPayload(newIdentity)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to compute identity signing payload: %w", err)
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute identity signing payload: %w", err)
 	}
-	sig, err := Sign([]byte(payload), opts.OperatorKeyPair.PrivateKey)
+	newIdentity.Signature, newIdentity.Signatures, err = signAsOperators([]byte(payload), opts.OperatorKeyPair, opts.OperatorKeyPairs, newIdentity.Operators)
 	if err != nil {
-		return nil, fmt.Errorf("grith: failed to sign identity: %w", err)
+		return nil, err
 	}
-	newIdentity.Signature = ToHex(sig)
 
 	return newIdentity, nil
 }
 
-// VerifyIdentity verifies an agent identity by checking the signature
-// over the canonical form.
-func VerifyIdentity(identity *AgentIdentity) (bool, error) {
-	if identity == nil {
-		return false, fmt.Errorf("grith: identity is required")
+// RotateOperatorKey moves an identity from oldKP to newKP. Unlike changing
+// OperatorPublicKey with EvolveIdentity, the rotation's lineage entry is
+// signed by both keys, so the new key is provably authorized by the old
+// one and reputation carries forward in full. If the identity has a key
+// commitment, newKP must be the committed key, and the rotation ends
+// pre-rotation; use RotateOperatorKeyWithOptions to commit to the next
+// key.
+func RotateOperatorKey(current *AgentIdentity, oldKP, newKP *KeyPair) (*AgentIdentity, error) {
+	return rotateOperatorKey(current, oldKP, newKP, "")
+}
+
+func rotateOperatorKey(current *AgentIdentity, oldKP, newKP *KeyPair, nextCommitment string) (*AgentIdentity, error) {
+	if current == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: current identity is required")
+	}
+	if oldKP == nil || newKP == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: old and new operator key pairs are required")
+	}
+	if current.Operators != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: replace the operator set of an organizational identity with EvolveIdentity")
+	}
+	if oldKP.PublicKeyHex != current.OperatorPublicKey {
+		return nil, errorf(ErrCodeInvalidInput, "grith: old key pair is not the identity's operator key")
+	}
+	if newKP.PublicKeyHex == oldKP.PublicKeyHex {
+		return nil, errorf(ErrCodeInvalidInput, "grith: new operator key must differ from the old one")
+	}
+	if current.NextKeyCommitment != "" {
+		if c, err := ComputeKeyCommitment(newKP.PublicKeyHex); err != nil || c != current.NextKeyCommitment {
+			return nil, errorf(ErrCodeInvalidInput, "grith: new operator key does not match the identity's key commitment")
+		}
+	}
+	if nextCommitment != "" {
+		if err := validateKeyCommitment(nextCommitment, nil); err != nil {
+			return nil, err
+		}
 	}
 
-	// Verify the identity signature
-	payload, err := identitySigningPayload(identity)
+	now := Timestamp()
+
+	newIdentity := *current
+	newIdentity.ID = ""
+	newIdentity.OperatorPublicKey = newKP.PublicKeyHex
+	newIdentity.NextKeyCommitment = nextCommitment
+	newIdentity.Lineage = make([]LineageEntry, len(current.Lineage), len(current.Lineage)+1)
+	newIdentity.Version = current.Version + 1
+	newIdentity.UpdatedAt = now
+	newIdentity.Signature = ""
+	copy(newIdentity.Lineage, current.Lineage)
+
+	idHash, err := computeIdentityHash(&newIdentity)
 	if err != nil {
-		return false, fmt.Errorf("grith: failed to compute signing payload: %w", err)
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute identity hash: %w", err)
+	}
+
+	var parentHash *string
+	if len(current.Lineage) > 0 {
+		lastEntry := current.Lineage[len(current.Lineage)-1]
+		parentHash = &lastEntry.IdentityHash
 	}
 
-	sigBytes, err := FromHex(identity.Signature)
+	policy, policyHash := identityPolicy(current)
+	lineageEntry := &LineageEntry{
+		IdentityHash:           idHash,
+		ChangeType:             ChangeOperatorKeyRotation,
+		Description:            "Operator key rotated",
+		Timestamp:              now,
+		ParentHash:             parentHash,
+		ReputationCarryForward: policy.OperatorKeyRotation,
+		PreviousOperatorKey:    oldKP.PublicKeyHex,
+		NewOperatorKey:         newKP.PublicKeyHex,
+		PolicyHash:             policyHash,
+		NextKeyCommitment:      nextCommitment,
+	}
+
+	// Both keys sign the same payload: the old key authorizes its
+	// successor and the new key proves it is held.
+	lineagePayload, err := lineageSigningPayload(lineageEntry)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute lineage signing payload: %w", err)
+	}
+	oldSig, err := Sign([]byte(lineagePayload), oldKP.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign lineage entry: %w", err)
+	}
+	newSig, err := Sign([]byte(lineagePayload), newKP.PrivateKey)
 	if err != nil {
-		return false, nil
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign lineage entry: %w", err)
 	}
+	lineageEntry.Signature = ToHex(oldSig)
+	lineageEntry.NewKeySignature = ToHex(newSig)
 
-	pubKeyBytes, err := FromHex(identity.OperatorPublicKey)
+	newIdentity.Lineage = append(newIdentity.Lineage, *lineageEntry)
+
+	idHash, err = computeIdentityHash(&newIdentity)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to recompute identity hash: %w", err)
+	}
+	newIdentity.ID = idHash
+
+	payload, err := identitySigningPayload(&newIdentity)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute identity signing payload: %w", err)
+	}
+	sig, err := Sign([]byte(payload), newKP.PrivateKey)
 	if err != nil {
-		return false, nil
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign identity: %w", err)
 	}
+	newIdentity.Signature = ToHex(sig)
 
-	return Verify([]byte(payload), sigBytes, ed25519.PublicKey(pubKeyBytes)), nil
+	return &newIdentity, nil
+}
+
+// verifyKeyRotation checks both signatures on an operator_key_rotation
+// lineage entry.
+func verifyKeyRotation(entry *LineageEntry) bool {
+	payload, err := lineageSigningPayload(entry)
+	if err != nil {
+		return false
+	}
+	for _, pair := range [][2]string{
+		{entry.PreviousOperatorKey, entry.Signature},
+		{entry.NewOperatorKey, entry.NewKeySignature},
+	} {
+		pub, err := FromHex(pair[0])
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return false
+		}
+		sig, err := FromHex(pair[1])
+		if err != nil || !Verify([]byte(payload), sig, ed25519.PublicKey(pub)) {
+			return false
+		}
+	}
+	return true
+}
+
+// IdentityVerificationResult is the outcome of verifying an identity:
+// each named check, and whether all of them passed.
+type IdentityVerificationResult struct {
+	Valid    bool                `json:"valid"`
+	Checks   []VerificationCheck `json:"checks"`
+	Identity *AgentIdentity      `json:"identity"`
+}
+
+// ReadIdentity decodes an agent identity from r, streaming the JSON into
+// the identity rather than buffering it. At most MaxDocumentSize bytes
+// are read: a larger payload fails with ErrCodeDocumentTooLarge as soon
+// as it passes the limit. The identity is not verified; use
+// VerifyIdentity.
+func ReadIdentity(r io.Reader) (*AgentIdentity, error) {
+	var identity AgentIdentity
+	if err := decodeJSONLimited(r, MaxDocumentSize, "identity", &identity); err != nil {
+		return nil, err
+	}
+	if identity.ID == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: missing required field: id")
+	}
+	return &identity, nil
+}
+
+// VerifyIdentity verifies an agent identity and reports each part as a
+// named check:
+//
+//   - signature_valid: the signature over the canonical form, or for an
+//     organizational identity threshold signatures from its operator set
+//   - id_match: the ID is the composite identity hash
+//   - capability_hash: the capability manifest hash matches the
+//     capabilities
+//   - lineage_integrity: entries link by parent hash; operator key
+//     rotations are signed by both keys and chain to the current key;
+//     operator set changes are signed by the set in force; the latest
+//     entry records the identity's evolution policy; a fork link is
+//     signed by the forked parent; a compaction summary is signed by the
+//     operators it records; rotations reveal the key committed to
+//     before them; and recoveries are signed by the recovery keys in
+//     force
+//   - parent_binding: a sub-identity's binding is signed by its parent
+//     and grants every capability the identity claims
+//
+// VerifyIdentityWithOptions adds revocation, attestation, and expiry
+// checks.
+func VerifyIdentity(identity *AgentIdentity) (*IdentityVerificationResult, error) {
+	if identity == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: identity is required")
+	}
+	payload, err := identitySigningPayload(identity)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute signing payload: %w", err)
+	}
+
+	sigCheck := VerificationCheck{Name: "signature_valid", Code: CheckSignatureValid}
+	if identity.Operators != nil {
+		sigCheck.Passed = identity.OperatorPublicKey == identity.Operators.Keys[0] &&
+			verifyOperatorSignatures([]byte(payload), identity.Signatures, identity.Operators)
+	} else {
+		sig, sigErr := FromHex(identity.Signature)
+		pub, pubErr := FromHex(identity.OperatorPublicKey)
+		sigCheck.Passed = sigErr == nil && pubErr == nil && len(pub) == ed25519.PublicKeySize &&
+			Verify([]byte(payload), sig, ed25519.PublicKey(pub))
+	}
+	sigCheck.Message = "Identity signature is valid"
+	if !sigCheck.Passed {
+		sigCheck.Message = "Identity signature is invalid"
+	}
+
+	idCheck := VerificationCheck{Name: "id_match", Code: CheckIDMatch, Message: "Identity ID matches its composite hash"}
+	if hash, err := computeIdentityHash(identity); err == nil && hash == identity.ID {
+		idCheck.Passed = true
+	} else {
+		idCheck.Message = "Identity ID does not match its composite hash"
+	}
+
+	capCheck := VerificationCheck{Name: "capability_hash", Code: CheckCapabilityHash, Message: "Capability manifest hash matches the capabilities"}
+	if ComputeCapabilityManifestHash(identity.Capabilities) == identity.CapabilityManifestHash {
+		capCheck.Passed = true
+	} else {
+		capCheck.Message = "Capability manifest hash does not match the capabilities"
+	}
+
+	lineageCheck := VerificationCheck{Name: "lineage_integrity", Code: CheckLineageIntegrity}
+	if problem := checkLineage(identity); problem != "" {
+		lineageCheck.Message = problem
+	} else {
+		lineageCheck.Passed = true
+		lineageCheck.Message = fmt.Sprintf("Lineage of %s is intact", plural(len(identity.Lineage), "entry", "entries"))
+	}
+
+	parentCheck := VerificationCheck{Name: "parent_binding", Code: CheckParentBinding, Passed: true, Message: "Identity is not a sub-identity"}
+	if identity.Parent != nil {
+		if err := verifyParentBinding(identity); err != nil {
+			parentCheck.Passed = false
+			parentCheck.Message = err.Error()
+		} else {
+			parentCheck.Message = fmt.Sprintf("Sub-identity is bound to %s", shortID(identity.Parent.ParentID))
+		}
+	}
+
+	checks := []VerificationCheck{sigCheck, idCheck, capCheck, lineageCheck, parentCheck}
+	valid, _ := aggregateChecks(checks)
+	return &IdentityVerificationResult{Valid: valid, Checks: checks, Identity: identity}, nil
+}
+
+// checkLineage describes the first integrity problem in identity's
+// lineage, or returns "" if there is none.
+func checkLineage(identity *AgentIdentity) string {
+	if len(identity.Lineage) == 0 {
+		return "Identity has no lineage"
+	}
+	for i := range identity.Lineage {
+		entry := &identity.Lineage[i]
+		if i == 0 && entry.ParentHash != nil {
+			return "First lineage entry has a parent hash"
+		}
+		if i > 0 && (entry.ParentHash == nil || *entry.ParentHash != identity.Lineage[i-1].IdentityHash) {
+			return fmt.Sprintf("Lineage entry %d does not link to the entry before it", i)
+		}
+		compacted := entry.ChangeType == ChangeCompacted
+		if (entry.Summary != nil) != compacted || (compacted && i > 0) {
+			return fmt.Sprintf("Lineage entry %d has a misplaced compaction summary", i)
+		}
+		if entry.Summary != nil {
+			if err := verifyLineageSummary(entry); err != nil {
+				return err.Error()
+			}
+		}
+		// A summary carries the fork link of the entries it replaces.
+		if (entry.Fork != nil && (i > 0 || (entry.ChangeType != ChangeFork && !compacted))) || (entry.ChangeType == ChangeFork && entry.Fork == nil) {
+			return fmt.Sprintf("Lineage entry %d has a misplaced fork link", i)
+		}
+		if entry.Fork != nil {
+			if err := verifyForkLink(identity, entry.Fork); err != nil {
+				return err.Error()
+			}
+		}
+	}
+
+	// Rotations must chain: each starts from the key the previous one
+	// moved to, and the last ends at the current operator key. An
+	// operator_transfer or a new operator set replaces the key without a
+	// link. A compacted lineage's rotations start from its summary's key.
+	rotatedTo := ""
+	if s := identity.Lineage[0].Summary; s != nil && s.Operators == nil {
+		rotatedTo = s.OperatorKey
+	}
+	for i := range identity.Lineage {
+		entry := &identity.Lineage[i]
+		switch entry.ChangeType {
+		case ChangeOperatorKeyRotation:
+			if !verifyKeyRotation(entry) || (rotatedTo != "" && entry.PreviousOperatorKey != rotatedTo) {
+				return fmt.Sprintf("Operator key rotation at lineage entry %d is invalid", i)
+			}
+			rotatedTo = entry.NewOperatorKey
+		case ChangeOperatorKeyRecovery:
+			if rotatedTo != "" && entry.PreviousOperatorKey != rotatedTo {
+				return fmt.Sprintf("Operator key recovery at lineage entry %d does not start from the operator key", i)
+			}
+			rotatedTo = entry.NewOperatorKey
+		case "operator_transfer":
+			rotatedTo = ""
+		}
+		if entry.Operators != nil {
+			rotatedTo = ""
+		}
+	}
+	if rotatedTo != "" && rotatedTo != identity.OperatorPublicKey {
+		return "Operator key rotations do not end at the current operator key"
+	}
+
+	// The latest entry was rated by the policy the identity carries.
+	if identity.EvolutionPolicy != nil && validateEvolutionPolicy(identity.EvolutionPolicy) != nil {
+		return "Evolution policy is invalid"
+	}
+	if _, policyHash := identityPolicy(identity); identity.Lineage[len(identity.Lineage)-1].PolicyHash != policyHash {
+		return "Latest lineage entry does not record the identity's evolution policy"
+	}
+	if problem := checkCarryForward(identity); problem != "" {
+		return problem
+	}
+
+	if !verifyOperatorLineage(identity) {
+		return "Operator set changes are not signed by the operators in force"
+	}
+	if problem := checkRecovery(identity); problem != "" {
+		return problem
+	}
+	return checkKeyCommitments(identity)
 }
 
 // ComputeEffectiveCarryForward computes the multiplicative carry-forward
@@ -403,19 +1033,128 @@ func ComputeEffectiveCarryForward(identity *AgentIdentity) float64 {
 	return rate
 }
 
+// checkCarryForward describes the first lineage entry whose
+// carry-forward is not the rate its change, capability diff, and policy
+// give, or returns "" if there is none. Capabilities may only change by
+// evolution, and the lineage must end at the identity's capabilities.
+func checkCarryForward(identity *AgentIdentity) string {
+	var capabilities []string
+	policy, policyHash := DefaultEvolutionPolicy(), ""
+	for i := range identity.Lineage {
+		entry := &identity.Lineage[i]
+		if entry.EvolutionPolicy != nil {
+			if validateEvolutionPolicy(entry.EvolutionPolicy) != nil {
+				return fmt.Sprintf("Lineage entry %d adopts an invalid evolution policy", i)
+			}
+			policy, policyHash = *entry.EvolutionPolicy, ComputeEvolutionPolicyHash(*entry.EvolutionPolicy)
+		}
+		if entry.PolicyHash != policyHash {
+			return fmt.Sprintf("Lineage entry %d records a policy it did not adopt", i)
+		}
+		previous := capabilities
+		if i == 0 || entry.Capabilities != nil {
+			capabilities = entry.Capabilities
+		}
+		diff := DiffCapabilities(previous, capabilities)
+
+		var want float64
+		switch entry.ChangeType {
+		case "created", ChangeDerived, ChangeFork, ChangeCompacted:
+			if i > 0 {
+				// Misplaced entries are reported by checkLineage.
+				continue
+			}
+			want = getCarryForwardRate(entry.ChangeType, policy)
+			if entry.ChangeType == ChangeCompacted {
+				want = entry.Summary.CarryForward
+			}
+		case ChangeOperatorKeyRotation, ChangeOperatorKeyRecovery:
+			if !diff.Empty() {
+				return fmt.Sprintf("Lineage entry %d changes capabilities outside an evolution", i)
+			}
+			want = getCarryForwardRate(entry.ChangeType, policy)
+		default:
+			want = evolutionCarryForward(entry.ChangeType, diff, policy)
+		}
+		if entry.ReputationCarryForward != want {
+			return fmt.Sprintf("Lineage entry %d carries forward %v of reputation, not the %v its changes earn", i, entry.ReputationCarryForward, want)
+		}
+	}
+	if !DiffCapabilities(capabilities, identity.Capabilities).Empty() {
+		return "Lineage does not end at the identity's capabilities"
+	}
+	return ""
+}
+
+// capabilitiesAfter returns the capabilities recorded by entries, which
+// start with the identity's first entry, as of the last of them.
+func capabilitiesAfter(entries []LineageEntry) []string {
+	var capabilities []string
+	for i, e := range entries {
+		if i == 0 || e.Capabilities != nil {
+			capabilities = e.Capabilities
+		}
+	}
+	return capabilities
+}
+
+// policyAfter returns the evolution policy adopted by entries, which
+// start with the identity's first entry, as of the last of them, or nil
+// for the default policy.
+func policyAfter(entries []LineageEntry) *EvolutionPolicy {
+	var policy *EvolutionPolicy
+	for _, e := range entries {
+		if e.EvolutionPolicy != nil {
+			policy = e.EvolutionPolicy
+		}
+	}
+	return copyEvolutionPolicy(policy)
+}
+
+// evolutionCarryForward returns the carry-forward rate of an evolution
+// of the given change type that makes the capability changes in diff. A
+// capability change is rated by what it actually does, whatever the
+// change type: expansion, reduction, or the lower of the two when mixed.
+// An evolution of another type that also changes capabilities gets the
+// lower of the two rates.
+func evolutionCarryForward(changeType string, diff CapabilityDiff, policy EvolutionPolicy) float64 {
+	var capRate float64
+	switch {
+	case diff.Empty():
+		if changeType == ChangeCapability {
+			return policy.MinorUpdate
+		}
+		return getCarryForwardRate(changeType, policy)
+	case len(diff.Removed) == 0:
+		capRate = policy.CapabilityExpansion
+	case len(diff.Added) == 0:
+		capRate = policy.CapabilityReduction
+	default:
+		capRate = min(policy.CapabilityExpansion, policy.CapabilityReduction)
+	}
+	if changeType == ChangeCapability {
+		return capRate
+	}
+	return min(capRate, getCarryForwardRate(changeType, policy))
+}
+
 // getCarryForwardRate returns the default carry-forward rate for a
 // given change type using the evolution policy.
 func getCarryForwardRate(changeType string, policy EvolutionPolicy) float64 {
 	switch changeType {
-	case "created":
+	case "created", ChangeDerived:
 		return 1.0
 	case "model_update":
 		return policy.ModelVersionChange
-	case "capability_change":
+	case ChangeCapability:
 		return policy.CapabilityExpansion
 	case "operator_transfer":
 		return policy.OperatorTransfer
-	case "fork":
+	case ChangeOperatorKeyRotation:
+		return policy.OperatorKeyRotation
+	case ChangeOperatorKeyRecovery:
+		return policy.OperatorKeyRecovery
+	case ChangeFork:
 		return policy.ModelFamilyChange
 	case "merge":
 		return policy.MinorUpdate
@@ -0,0 +1,74 @@
+package grith
+
+// ImmutableCovenant is a read-only covenant document that memoizes its
+// canonical form and computed ID. Because the wrapped document cannot be
+// mutated, repeated verification and countersigning never recompute the
+// canonical form.
+type ImmutableCovenant struct {
+	doc       *CovenantDocument
+	canonical string
+	id        string
+}
+
+// NewImmutableCovenant deep-copies doc and computes its canonical form
+// once. Later changes to doc do not affect the returned value.
+func NewImmutableCovenant(doc *CovenantDocument) (*ImmutableCovenant, error) {
+	if doc == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: document is required")
+	}
+	copied := doc.Clone()
+	canonical, err := CanonicalForm(copied)
+	if err != nil {
+		return nil, err
+	}
+	return &ImmutableCovenant{
+		doc:       copied,
+		canonical: canonical,
+		id:        SHA256String(canonical),
+	}, nil
+}
+
+// ID returns the document's claimed ID.
+func (c *ImmutableCovenant) ID() string {
+	return c.doc.ID
+}
+
+// ComputedID returns the SHA-256 of the canonical form. It equals ID for
+// an untampered document.
+func (c *ImmutableCovenant) ComputedID() string {
+	return c.id
+}
+
+// CanonicalForm returns the memoized canonical form.
+func (c *ImmutableCovenant) CanonicalForm() string {
+	return c.canonical
+}
+
+// Document returns a deep copy of the wrapped document.
+func (c *ImmutableCovenant) Document() (*CovenantDocument, error) {
+	return c.doc.Clone(), nil
+}
+
+// Verify runs covenant verification using the memoized canonical form.
+// The returned result references a copy of the document.
+func (c *ImmutableCovenant) Verify(opts *VerifyOptions) (*VerificationResult, error) {
+	result, err := verifyCovenant(c.doc, c.canonical, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	if result.Document, err = c.Document(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Countersign returns a new ImmutableCovenant with a countersignature
+// appended. Countersignatures are excluded from the canonical form, so
+// the memoized form is reused.
+func (c *ImmutableCovenant) Countersign(kp *KeyPair, role string) (*ImmutableCovenant, error) {
+	signed, err := countersign(c.doc, c.canonical, kp, role)
+	if err != nil {
+		return nil, err
+	}
+	return &ImmutableCovenant{doc: signed, canonical: c.canonical, id: c.id}, nil
+}
@@ -0,0 +1,361 @@
+package grith
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// InspectionFormat names a rendering of an Inspection.
+type InspectionFormat string
+
+const (
+	// InspectText renders an Inspection as aligned plain text.
+	InspectText InspectionFormat = "text"
+	// InspectJSON renders an Inspection as indented JSON.
+	InspectJSON InspectionFormat = "json"
+	// InspectYAML renders an Inspection as YAML.
+	InspectYAML InspectionFormat = "yaml"
+)
+
+// Inspection is a structured view of a covenant for tools that display
+// one, such as the grith CLI and web UIs. Unlike CovenantSummary, which
+// describes a covenant in sentences, it keeps each item as data, so a
+// front end can lay it out itself; Render lays it out as text, JSON, or
+// YAML.
+type Inspection struct {
+	ID      string  `json:"id"`
+	Version string  `json:"version"`
+	Parties []Party `json:"parties"`
+	// Validity is evaluated at the time of inspection.
+	Validity InspectedValidity `json:"validity"`
+	Chain    *ChainReference   `json:"chain,omitempty"`
+	// ConstraintsRef is set for a covenant whose constraints are stored
+	// by reference, in which case Statements is empty.
+	ConstraintsRef    *ConstraintsRef             `json:"constraintsRef,omitempty"`
+	Statements        []InspectedStatement        `json:"statements"`
+	Countersignatures []InspectedCountersignature `json:"countersignatures"`
+	// Extensions lists the document's extensions by name.
+	Extensions []InspectedExtension `json:"extensions,omitempty"`
+	// Notes reports anything that kept an item from being inspected, such
+	// as constraints that do not parse.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// InspectedValidity is the validity window of an inspected covenant.
+type InspectedValidity struct {
+	State       CovenantState `json:"state"`
+	At          string        `json:"at"`
+	CreatedAt   string        `json:"createdAt"`
+	ActivatesAt string        `json:"activatesAt,omitempty"`
+	ExpiresAt   string        `json:"expiresAt,omitempty"`
+	// GracePeriod is a duration such as "1h0m0s".
+	GracePeriod string `json:"gracePeriod,omitempty"`
+}
+
+// InspectedStatement is one row of an inspected covenant's constraints.
+type InspectedStatement struct {
+	Type      StatementType `json:"type"`
+	Action    string        `json:"action"`
+	Resource  string        `json:"resource,omitempty"`
+	Condition string        `json:"condition,omitempty"`
+	// Limit is set for limit statements, as in "10 per 1 hours".
+	Limit string `json:"limit,omitempty"`
+	// Rule is the statement as CCL.
+	Rule string `json:"rule"`
+}
+
+// InspectedCountersignature is a countersignature of an inspected
+// covenant and whether it verifies.
+type InspectedCountersignature struct {
+	SignerPublicKey string `json:"signerPublicKey"`
+	SignerRole      string `json:"signerRole"`
+	Timestamp       string `json:"timestamp"`
+	Valid           bool   `json:"valid"`
+}
+
+// InspectedExtension is an extension of an inspected covenant.
+type InspectedExtension struct {
+	Name     string `json:"name"`
+	Critical bool   `json:"critical"`
+}
+
+// Inspect returns a structured view of doc. Constraints stored by
+// reference are not fetched. Inspect never fails: problems with the
+// document are reported in Notes.
+func Inspect(doc *CovenantDocument) Inspection {
+	now := time.Now().UTC()
+	in := Inspection{
+		ID:      doc.ID,
+		Version: doc.Version,
+		Parties: []Party{doc.Issuer, doc.Beneficiary},
+		Validity: InspectedValidity{
+			State:       doc.StateAt(now),
+			At:          now.Format(time.RFC3339),
+			CreatedAt:   doc.CreatedAt,
+			ActivatesAt: doc.ActivatesAt,
+			ExpiresAt:   doc.ExpiresAt,
+		},
+		Chain:             doc.Chain,
+		ConstraintsRef:    doc.ConstraintsRef,
+		Statements:        []InspectedStatement{},
+		Countersignatures: []InspectedCountersignature{},
+	}
+	if doc.GracePeriod > 0 {
+		in.Validity.GracePeriod = doc.GracePeriodDuration().String()
+	}
+
+	if doc.ConstraintsRef == nil {
+		ccl, err := parsedConstraints(doc.Constraints)
+		if err != nil {
+			in.Notes = append(in.Notes, fmt.Sprintf("Constraints could not be parsed: %v", err))
+		} else {
+			for _, stmt := range ccl.Statements {
+				in.Statements = append(in.Statements, inspectStatement(stmt))
+			}
+		}
+	}
+
+	if len(doc.Countersignatures) > 0 {
+		canonical, err := CanonicalForm(doc)
+		if err != nil {
+			in.Notes = append(in.Notes, fmt.Sprintf("Countersignatures could not be verified: %v", err))
+		}
+		for _, cs := range doc.Countersignatures {
+			in.Countersignatures = append(in.Countersignatures, InspectedCountersignature{
+				SignerPublicKey: cs.SignerPublicKey,
+				SignerRole:      cs.SignerRole,
+				Timestamp:       cs.Timestamp,
+				Valid:           err == nil && verifyCountersignature(canonical, cs),
+			})
+		}
+	}
+
+	for name, ext := range doc.Extensions {
+		in.Extensions = append(in.Extensions, InspectedExtension{Name: name, Critical: ext.Critical})
+	}
+	sort.Slice(in.Extensions, func(i, j int) bool { return in.Extensions[i].Name < in.Extensions[j].Name })
+	return in
+}
+
+func inspectStatement(stmt Statement) InspectedStatement {
+	s := InspectedStatement{
+		Type:     stmt.Type,
+		Action:   stmt.Action,
+		Resource: stmt.Resource,
+		Rule:     serializeStatement(stmt),
+	}
+	if c := stmt.Condition; c != nil {
+		s.Condition = serializeCondition(c)
+	}
+	if stmt.Type == StatementLimit {
+		value, unit := bestTimeUnit(stmt.Period)
+		s.Limit = fmt.Sprintf("%s per %s %s", strconv.FormatFloat(stmt.Limit, 'f', -1, 64), strconv.FormatFloat(value, 'f', -1, 64), unit)
+	}
+	return s
+}
+
+// Render renders the inspection in the given format.
+func (in Inspection) Render(format InspectionFormat) ([]byte, error) {
+	switch format {
+	case InspectText, "":
+		return []byte(in.String()), nil
+	case InspectJSON:
+		b, err := json.MarshalIndent(in, "", "  ")
+		if err != nil {
+			return nil, errorf(ErrCodeSerialization, "grith: failed to render inspection: %w", err)
+		}
+		return append(b, '\n'), nil
+	case InspectYAML:
+		return in.yaml(), nil
+	}
+	return nil, errorf(ErrCodeInvalidInput, "grith: unsupported inspection format %q: want text, json, or yaml", format)
+}
+
+// String renders the inspection as aligned plain text.
+func (in Inspection) String() string {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Covenant\t%s\n", in.ID)
+	fmt.Fprintf(tw, "Version\t%s\n", in.Version)
+	for _, p := range in.Parties {
+		fmt.Fprintf(tw, "%s\t%s (key %s)\n", inspectTitle(p.Role), p.ID, summarizeKey(p.PublicKey))
+	}
+	v := in.Validity
+	fmt.Fprintf(tw, "State\t%s at %s\n", v.State, v.At)
+	fmt.Fprintf(tw, "Created\t%s\n", v.CreatedAt)
+	if v.ActivatesAt != "" {
+		fmt.Fprintf(tw, "Activates\t%s\n", v.ActivatesAt)
+	}
+	if v.ExpiresAt != "" {
+		fmt.Fprintf(tw, "Expires\t%s\n", v.ExpiresAt)
+	}
+	if v.GracePeriod != "" {
+		fmt.Fprintf(tw, "Grace period\t%s\n", v.GracePeriod)
+	}
+	if c := in.Chain; c != nil {
+		fmt.Fprintf(tw, "Chain\t%s of %s, depth %d\n", c.Relation, c.ParentID, c.Depth)
+	}
+	if r := in.ConstraintsRef; r != nil {
+		fmt.Fprintf(tw, "Constraints\tby reference %s\n", strings.TrimSpace(r.Hash+" "+r.URI))
+	}
+	tw.Flush()
+
+	if len(in.Statements) > 0 {
+		b.WriteString("\nStatements:\n")
+		tw = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  #\tTYPE\tACTION\tRESOURCE\tCONDITION\tLIMIT")
+		for i, s := range in.Statements {
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\t%s\t%s\n", i+1, s.Type, s.Action, inspectCell(s.Resource), inspectCell(s.Condition), inspectCell(s.Limit))
+		}
+		tw.Flush()
+	}
+
+	if len(in.Countersignatures) > 0 {
+		b.WriteString("\nCountersignatures:\n")
+		tw = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, cs := range in.Countersignatures {
+			status := "valid"
+			if !cs.Valid {
+				status = "INVALID"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", summarizeKey(cs.SignerPublicKey), cs.SignerRole, cs.Timestamp, status)
+		}
+		tw.Flush()
+	}
+
+	if len(in.Extensions) > 0 {
+		b.WriteString("\nExtensions:\n")
+		for _, ext := range in.Extensions {
+			if ext.Critical {
+				fmt.Fprintf(&b, "  %s (critical)\n", ext.Name)
+			} else {
+				fmt.Fprintf(&b, "  %s\n", ext.Name)
+			}
+		}
+	}
+
+	if len(in.Notes) > 0 {
+		b.WriteString("\nNotes:\n")
+		for _, note := range in.Notes {
+			fmt.Fprintf(&b, "  %s\n", note)
+		}
+	}
+	return b.String()
+}
+
+func inspectTitle(s string) string {
+	if s == "" {
+		return "Party"
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func inspectCell(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// yaml renders the inspection as YAML. Strings are written as JSON
+// strings, which YAML reads as double-quoted scalars.
+func (in Inspection) yaml() []byte {
+	var b []byte
+	field := func(indent, key, value string) {
+		b = append(b, indent...)
+		b = append(b, key...)
+		b = append(b, ": "...)
+		b = appendJSONString(b, value)
+		b = append(b, '\n')
+	}
+	raw := func(indent, key, value string) {
+		b = append(b, strings.TrimSuffix(indent+key+": "+value, " ")+"\n"...)
+	}
+	field("", "id", in.ID)
+	field("", "version", in.Version)
+	raw("", "parties", yamlEmpty(len(in.Parties)))
+	for _, p := range in.Parties {
+		field("  - ", "id", p.ID)
+		field("    ", "publicKey", p.PublicKey)
+		field("    ", "role", p.Role)
+	}
+	v := in.Validity
+	b = append(b, "validity:\n"...)
+	field("  ", "state", string(v.State))
+	field("  ", "at", v.At)
+	field("  ", "createdAt", v.CreatedAt)
+	if v.ActivatesAt != "" {
+		field("  ", "activatesAt", v.ActivatesAt)
+	}
+	if v.ExpiresAt != "" {
+		field("  ", "expiresAt", v.ExpiresAt)
+	}
+	if v.GracePeriod != "" {
+		field("  ", "gracePeriod", v.GracePeriod)
+	}
+	if c := in.Chain; c != nil {
+		b = append(b, "chain:\n"...)
+		field("  ", "parentId", c.ParentID)
+		field("  ", "relation", c.Relation)
+		raw("  ", "depth", strconv.Itoa(c.Depth))
+	}
+	if r := in.ConstraintsRef; r != nil {
+		b = append(b, "constraintsRef:\n"...)
+		field("  ", "hash", r.Hash)
+		if r.URI != "" {
+			field("  ", "uri", r.URI)
+		}
+	}
+	raw("", "statements", yamlEmpty(len(in.Statements)))
+	for _, s := range in.Statements {
+		field("  - ", "type", string(s.Type))
+		field("    ", "action", s.Action)
+		if s.Resource != "" {
+			field("    ", "resource", s.Resource)
+		}
+		if s.Condition != "" {
+			field("    ", "condition", s.Condition)
+		}
+		if s.Limit != "" {
+			field("    ", "limit", s.Limit)
+		}
+		field("    ", "rule", s.Rule)
+	}
+	raw("", "countersignatures", yamlEmpty(len(in.Countersignatures)))
+	for _, cs := range in.Countersignatures {
+		field("  - ", "signerPublicKey", cs.SignerPublicKey)
+		field("    ", "signerRole", cs.SignerRole)
+		field("    ", "timestamp", cs.Timestamp)
+		raw("    ", "valid", strconv.FormatBool(cs.Valid))
+	}
+	if len(in.Extensions) > 0 {
+		b = append(b, "extensions:\n"...)
+		for _, ext := range in.Extensions {
+			field("  - ", "name", ext.Name)
+			raw("    ", "critical", strconv.FormatBool(ext.Critical))
+		}
+	}
+	if len(in.Notes) > 0 {
+		b = append(b, "notes:\n"...)
+		for _, note := range in.Notes {
+			b = append(b, "  - "...)
+			b = appendJSONString(b, note)
+			b = append(b, '\n')
+		}
+	}
+	return b
+}
+
+// yamlEmpty returns the value written after the key of a sequence: empty
+// for a non-empty sequence, whose items follow, or [] for an empty one.
+func yamlEmpty(n int) string {
+	if n == 0 {
+		return "[]"
+	}
+	return ""
+}
@@ -0,0 +1,21 @@
+//go:build grith_noreflect
+
+package grith
+
+// This file replaces the reflection-based JSON conversions of
+// jsonreflect.go in builds for runtimes with limited reflection.
+// Values implementing jsonObjecter and decoded JSON values convert
+// without reflection; other values fail with ErrCodeSerialization instead
+// of misbehaving at run time.
+
+// reflectJSON reports whether values other than jsonObjecters and
+// decoded JSON convert to JSON.
+const reflectJSON = false
+
+func reflectJSONValue(v interface{}) (interface{}, error) {
+	return nil, errorf(ErrCodeSerialization, "grith: converting %T to JSON requires reflection, which this build excludes", v)
+}
+
+func reflectMarshalJSON(v interface{}) ([]byte, error) {
+	return nil, errorf(ErrCodeSerialization, "grith: encoding %T as JSON requires reflection, which this build excludes", v)
+}
@@ -0,0 +1,78 @@
+package grith
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var (
+	// errTooLarge is returned by a sizeLimitedReader whose source holds
+	// more than its limit.
+	errTooLarge     = errors.New("input exceeds size limit")
+	errTrailingData = errors.New("invalid data after top-level value")
+)
+
+// sizeLimitedReader reads at most n bytes from r and fails with
+// errTooLarge, rather than io.EOF, if r holds more, so input beyond the
+// limit is never read.
+type sizeLimitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if l.n <= 0 {
+		// Probe for a byte beyond the limit.
+		var b [1]byte
+		n, err := io.ReadAtLeast(l.r, b[:], 1)
+		if n > 0 {
+			return 0, errTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// decodeJSONLimited decodes the single JSON value held by r into v,
+// streaming it rather than buffering it, and reading at most limit bytes.
+// what names the value in errors.
+func decodeJSONLimited(r io.Reader, limit int64, what string, v interface{}) error {
+	dec := json.NewDecoder(&sizeLimitedReader{r: r, n: limit})
+	err := dec.Decode(v)
+	if err == nil {
+		// Reject trailing data, as json.Unmarshal does.
+		if _, err = dec.Token(); err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			err = errTrailingData
+		}
+	}
+	return jsonReadError(err, limit, what)
+}
+
+// jsonReadError classifies an error from decoding a JSON value read
+// through a sizeLimitedReader.
+func jsonReadError(err error, limit int64, what string) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, errTooLarge):
+		return errorf(ErrCodeDocumentTooLarge, "grith: %s exceeds maximum of %d bytes", what, limit)
+	case err == io.EOF, errors.Is(err, io.ErrUnexpectedEOF):
+		return errorf(ErrCodeInvalidJSON, "grith: invalid JSON: unexpected end of %s", what)
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, errTrailingData):
+		return errorf(ErrCodeInvalidJSON, "grith: invalid JSON: %w", err)
+	default:
+		return errorf(ErrCodeStorage, "grith: failed to read %s: %w", what, err)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !grith_noreflect
+
+package grith
+
+import "encoding/json"
+
+// reflectJSON reports whether values other than jsonObjecters and
+// decoded JSON convert to JSON.
+const reflectJSON = true
+
+// reflectJSONValue converts a value jsonValue does not handle directly
+// by a JSON round trip through encoding/json, which uses reflection.
+// Builds tagged grith_noreflect replace it with one that
+// fails; see jsonnoreflect.go.
+func reflectJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// reflectMarshalJSON encodes a value the canonical encoder does not
+// handle directly with encoding/json.
+func reflectMarshalJSON(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
@@ -0,0 +1,1073 @@
+package grith
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// jsonObjecter is implemented by types that build their decoded JSON
+// form, the map a JSON round trip would produce, directly instead of
+// through reflection. The covenant, identity, action log, and
+// enforcement types implement it, so their canonical forms, hashes, and
+// signatures need no reflection; see jsonreflect.go for the values that
+// do.
+type jsonObjecter interface {
+	jsonObject() (map[string]interface{}, error)
+}
+
+// objectToMap converts a Go value to the map a JSON round trip would
+// produce. It is used to canonicalize struct types.
+func objectToMap(obj interface{}) (map[string]interface{}, error) {
+	v, err := jsonValue(obj)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errorf(ErrCodeSerialization, "grith: %T is not a JSON object", obj)
+	}
+	return m, nil
+}
+
+// jsonValue converts a Go value to the value a JSON round trip would
+// produce: nil, bool, float64, string, []interface{}, or
+// map[string]interface{}. Decoded JSON values, Go numbers, string slices
+// and maps, and jsonObjecters are converted directly; any other value
+// goes through reflectJSONValue.
+func jsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return v, nil
+	case string:
+		return validJSONString(v), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, errorf(ErrCodeSerialization, "grith: unsupported JSON number %v", v)
+		}
+		return v, nil
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil, errorf(ErrCodeSerialization, "grith: unsupported JSON number %v", v)
+		}
+		// As decoded from the shortest representation of the float32.
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+		return f, nil
+	case int:
+		return float64(v), nil
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case json.Number:
+		if !isJSONNumber(string(v)) {
+			return nil, errorf(ErrCodeSerialization, "grith: invalid number literal %q", string(v))
+		}
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return nil, errorf(ErrCodeSerialization, "grith: invalid number literal %q: %w", string(v), err)
+		}
+		return f, nil
+	case jsonObjecter:
+		m, err := v.jsonObject()
+		if m == nil || err != nil {
+			return nil, err
+		}
+		return m, nil
+	case map[string]interface{}:
+		if v == nil {
+			return nil, nil
+		}
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			m[validJSONString(k)] = c
+		}
+		return m, nil
+	case map[string]string:
+		if v == nil {
+			return nil, nil
+		}
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[validJSONString(k)] = validJSONString(e)
+		}
+		return m, nil
+	case []interface{}:
+		if v == nil {
+			return nil, nil
+		}
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			c, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = c
+		}
+		return s, nil
+	case []string:
+		return stringsValue(v), nil
+	}
+	return reflectJSONValue(v)
+}
+
+// stringsValue converts a string slice to its decoded JSON form.
+func stringsValue(v []string) interface{} {
+	if v == nil {
+		return nil
+	}
+	s := make([]interface{}, len(v))
+	for i, e := range v {
+		s[i] = validJSONString(e)
+	}
+	return s
+}
+
+// validJSONString returns s with each byte of invalid UTF-8 replaced by
+// U+FFFD, as encoding it to JSON does.
+func validJSONString(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	b := make([]byte, 0, len(s)+8)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = utf8.AppendRune(b, utf8.RuneError)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return string(b)
+}
+
+// isJSONNumber reports whether s is a valid JSON number literal.
+func isJSONNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	if s[0] == '-' {
+		s = s[1:]
+		if s == "" {
+			return false
+		}
+	}
+	switch {
+	case s[0] == '0':
+		s = s[1:]
+	case '1' <= s[0] && s[0] <= '9':
+		for s != "" && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	default:
+		return false
+	}
+	if len(s) >= 2 && s[0] == '.' && '0' <= s[1] && s[1] <= '9' {
+		s = s[2:]
+		for s != "" && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+	if len(s) >= 2 && (s[0] == 'e' || s[0] == 'E') {
+		s = s[1:]
+		if s[0] == '+' || s[0] == '-' {
+			s = s[1:]
+			if s == "" {
+				return false
+			}
+		}
+		for s != "" && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+	return s == ""
+}
+
+// ----------------------------------------------------------------------------
+// Canonical encoding
+// ----------------------------------------------------------------------------
+
+// appendCanonicalJSON appends the canonical JSON encoding of v to b, with
+// the keys of every map sorted. Decoded JSON values, Go numbers, and
+// string slices and maps are encoded directly, byte for byte as
+// encoding/json would; any other value goes through reflectMarshalJSON.
+func appendCanonicalJSON(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case bool:
+		return strconv.AppendBool(b, v), nil
+	case string:
+		return appendJSONString(b, v), nil
+	case float64:
+		return appendJSONFloat(b, v, 64)
+	case float32:
+		return appendJSONFloat(b, float64(v), 32)
+	case int:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(b, v, 10), nil
+	case uint:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(b, v, 10), nil
+	case json.Number:
+		if v == "" {
+			return append(b, '0'), nil
+		}
+		if !isJSONNumber(string(v)) {
+			return nil, errorf(ErrCodeSerialization, "grith: invalid number literal %q", string(v))
+		}
+		return append(b, v...), nil
+	case map[string]interface{}:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		b = append(b, '{')
+		for i, k := range sortedKeys(v) {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = append(appendJSONString(b, k), ':')
+			var err error
+			if b, err = appendCanonicalJSON(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, '}'), nil
+	case map[string]string:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		b = append(b, '{')
+		for i, k := range sortedKeys(v) {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = append(appendJSONString(b, k), ':')
+			b = appendJSONString(b, v[k])
+		}
+		return append(b, '}'), nil
+	case []interface{}:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		b = append(b, '[')
+		for i, e := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = appendCanonicalJSON(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, ']'), nil
+	case []string:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		b = append(b, '[')
+		for i, e := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, e)
+		}
+		return append(b, ']'), nil
+	case jsonObjecter:
+		m, err := v.jsonObject()
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			return append(b, "null"...), nil
+		}
+		return appendCanonicalJSON(b, m)
+	}
+	data, err := reflectMarshalJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, data...), nil
+}
+
+// appendJSONFloat appends f as encoding/json formats a float of the given
+// bit size: like ECMAScript, in exponent form only for very large and
+// very small magnitudes.
+func appendJSONFloat(b []byte, f float64, bits int) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, errorf(ErrCodeSerialization, "grith: unsupported JSON number %v", f)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+	if format == 'e' {
+		// Shorten e-09 to e-9.
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b, nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s as a JSON string escaped as encoding/json
+// escapes it: HTML-sensitive characters, control characters, and U+2028
+// and U+2029 are escaped, and each byte of invalid UTF-8 is replaced by
+// U+FFFD.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b = append(b, s[start:i]...)
+			b = utf8.AppendRune(b, utf8.RuneError)
+		case r == '\u2028' || r == '\u2029':
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+// ----------------------------------------------------------------------------
+// Covenant types
+// ----------------------------------------------------------------------------
+
+func (doc *CovenantDocument) jsonObject() (map[string]interface{}, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	m := map[string]interface{}{
+		"id":          validJSONString(doc.ID),
+		"version":     validJSONString(doc.Version),
+		"issuer":      doc.Issuer.jsonMap(),
+		"beneficiary": doc.Beneficiary.jsonMap(),
+		"constraints": validJSONString(doc.Constraints),
+		"nonce":       validJSONString(doc.Nonce),
+		"createdAt":   validJSONString(doc.CreatedAt),
+		"signature":   validJSONString(doc.Signature),
+	}
+	if doc.ConstraintsRef != nil {
+		ref := map[string]interface{}{"hash": validJSONString(doc.ConstraintsRef.Hash)}
+		if doc.ConstraintsRef.URI != "" {
+			ref["uri"] = validJSONString(doc.ConstraintsRef.URI)
+		}
+		m["constraintsRef"] = ref
+	}
+	if doc.Chain != nil {
+		m["chain"] = map[string]interface{}{
+			"parentId": validJSONString(doc.Chain.ParentID),
+			"relation": validJSONString(doc.Chain.Relation),
+			"depth":    float64(doc.Chain.Depth),
+		}
+	}
+	if doc.ExpiresAt != "" {
+		m["expiresAt"] = validJSONString(doc.ExpiresAt)
+	}
+	if doc.ActivatesAt != "" {
+		m["activatesAt"] = validJSONString(doc.ActivatesAt)
+	}
+	if doc.GracePeriod != 0 {
+		m["gracePeriod"] = float64(doc.GracePeriod)
+	}
+	if len(doc.Metadata) > 0 {
+		v, err := jsonValue(doc.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		m["metadata"] = v
+	}
+	if len(doc.MetadataSchema) > 0 {
+		v, err := jsonValue(doc.MetadataSchema)
+		if err != nil {
+			return nil, err
+		}
+		m["metadataSchema"] = v
+	}
+	if len(doc.Extensions) > 0 {
+		exts := make(map[string]interface{}, len(doc.Extensions))
+		for name, ext := range doc.Extensions {
+			e, err := ext.jsonObject()
+			if err != nil {
+				return nil, err
+			}
+			exts[validJSONString(name)] = e
+		}
+		m["extensions"] = exts
+	}
+	if len(doc.Countersignatures) > 0 {
+		sigs := make([]interface{}, len(doc.Countersignatures))
+		for i, cs := range doc.Countersignatures {
+			sigs[i] = map[string]interface{}{
+				"signerPublicKey": validJSONString(cs.SignerPublicKey),
+				"signerRole":      validJSONString(cs.SignerRole),
+				"signature":       validJSONString(cs.Signature),
+				"timestamp":       validJSONString(cs.Timestamp),
+			}
+		}
+		m["countersignatures"] = sigs
+	}
+	if len(doc.Transparency) > 0 {
+		receipts := make([]interface{}, len(doc.Transparency))
+		for i := range doc.Transparency {
+			receipts[i] = doc.Transparency[i].jsonMap()
+		}
+		m["transparency"] = receipts
+	}
+	if len(doc.Anchors) > 0 {
+		anchors := make([]interface{}, len(doc.Anchors))
+		for i := range doc.Anchors {
+			anchors[i] = doc.Anchors[i].jsonMap()
+		}
+		m["anchors"] = anchors
+	}
+	return m, nil
+}
+
+func (p Party) jsonMap() map[string]interface{} {
+	return map[string]interface{}{
+		"id":        validJSONString(p.ID),
+		"publicKey": validJSONString(p.PublicKey),
+		"role":      validJSONString(p.Role),
+	}
+}
+
+func (e *Extension) jsonObject() (map[string]interface{}, error) {
+	if e == nil {
+		return nil, nil
+	}
+	m := map[string]interface{}{"critical": e.Critical}
+	if e.Value != nil {
+		v, err := jsonValue(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		m["value"] = v
+	}
+	return m, nil
+}
+
+func (r *TransparencyReceipt) jsonMap() map[string]interface{} {
+	m := map[string]interface{}{"promise": r.Promise.jsonMap()}
+	if r.Proof != nil {
+		m["proof"] = map[string]interface{}{
+			"leafIndex": float64(r.Proof.LeafIndex),
+			"treeSize":  float64(r.Proof.TreeSize),
+			"hashes":    stringsValue(r.Proof.Hashes),
+		}
+	}
+	if r.TreeHead != nil {
+		m["treeHead"] = r.TreeHead.jsonMap()
+	}
+	return m
+}
+
+func (p *InclusionPromise) jsonObject() (map[string]interface{}, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return p.jsonMap(), nil
+}
+
+func (p *InclusionPromise) jsonMap() map[string]interface{} {
+	return map[string]interface{}{
+		"logId":      validJSONString(p.LogID),
+		"covenantId": validJSONString(p.CovenantID),
+		"timestamp":  validJSONString(p.Timestamp),
+		"signature":  validJSONString(p.Signature),
+	}
+}
+
+func (h *SignedTreeHead) jsonObject() (map[string]interface{}, error) {
+	if h == nil {
+		return nil, nil
+	}
+	return h.jsonMap(), nil
+}
+
+func (h *SignedTreeHead) jsonMap() map[string]interface{} {
+	return map[string]interface{}{
+		"logId":     validJSONString(h.LogID),
+		"treeSize":  float64(h.TreeSize),
+		"rootHash":  validJSONString(h.RootHash),
+		"timestamp": validJSONString(h.Timestamp),
+		"signature": validJSONString(h.Signature),
+	}
+}
+
+func (p *AnchorProof) jsonMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"type":   validJSONString(p.Type),
+		"digest": validJSONString(p.Digest),
+		"proof":  validJSONString(p.Proof),
+	}
+	if p.Batch != nil {
+		m["batch"] = map[string]interface{}{
+			"covenantId": validJSONString(p.Batch.CovenantID),
+			"root":       validJSONString(p.Batch.Root),
+			"leafIndex":  float64(p.Batch.LeafIndex),
+			"treeSize":   float64(p.Batch.TreeSize),
+			"hashes":     stringsValue(p.Batch.Hashes),
+		}
+	}
+	return m
+}
+
+func (mf *SnapshotManifest) jsonObject() (map[string]interface{}, error) {
+	if mf == nil {
+		return nil, nil
+	}
+	m := map[string]interface{}{
+		"version":   float64(mf.Version),
+		"createdAt": validJSONString(mf.CreatedAt),
+		"documents": nil,
+	}
+	if mf.Documents != nil {
+		docs := make([]interface{}, len(mf.Documents))
+		for i, e := range mf.Documents {
+			docs[i] = map[string]interface{}{"id": validJSONString(e.ID), "hash": validJSONString(e.Hash)}
+		}
+		m["documents"] = docs
+	}
+	if mf.SignerPublicKey != "" {
+		m["signerPublicKey"] = validJSONString(mf.SignerPublicKey)
+	}
+	if mf.Signature != "" {
+		m["signature"] = validJSONString(mf.Signature)
+	}
+	return m, nil
+}
+
+// ----------------------------------------------------------------------------
+// Identity types
+// ----------------------------------------------------------------------------
+
+func (identity *AgentIdentity) jsonObject() (map[string]interface{}, error) {
+	if identity == nil {
+		return nil, nil
+	}
+	m := map[string]interface{}{
+		"id":                     validJSONString(identity.ID),
+		"operatorPublicKey":      validJSONString(identity.OperatorPublicKey),
+		"model":                  identity.Model.jsonMap(),
+		"capabilities":           stringsValue(identity.Capabilities),
+		"capabilityManifestHash": validJSONString(identity.CapabilityManifestHash),
+		"deployment":             identity.Deployment.jsonMap(),
+		"lineage":                lineageValue(identity.Lineage),
+		"version":                float64(identity.Version),
+		"createdAt":              validJSONString(identity.CreatedAt),
+		"updatedAt":              validJSONString(identity.UpdatedAt),
+		"signature":              validJSONString(identity.Signature),
+	}
+	if identity.OperatorIdentifier != "" {
+		m["operatorIdentifier"] = validJSONString(identity.OperatorIdentifier)
+	}
+	if identity.Operators != nil {
+		m["operators"] = identity.Operators.jsonMap()
+	}
+	if len(identity.Signatures) > 0 {
+		m["signatures"] = operatorSignaturesValue(identity.Signatures)
+	}
+	if identity.Parent != nil {
+		m["parent"] = identity.Parent.jsonMap()
+	}
+	if identity.EvolutionPolicy != nil {
+		m["evolutionPolicy"] = identity.EvolutionPolicy.jsonMap()
+	}
+	if identity.NextKeyCommitment != "" {
+		m["nextKeyCommitment"] = validJSONString(identity.NextKeyCommitment)
+	}
+	if identity.Recovery != nil {
+		m["recovery"] = identity.Recovery.jsonMap()
+	}
+	return m, nil
+}
+
+func (a ModelAttestation) jsonMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"provider": validJSONString(a.Provider),
+		"modelId":  validJSONString(a.ModelID),
+	}
+	if a.ModelVersion != "" {
+		m["modelVersion"] = validJSONString(a.ModelVersion)
+	}
+	if a.AttestationHash != "" {
+		m["attestationHash"] = validJSONString(a.AttestationHash)
+	}
+	if a.AttestationType != "" {
+		m["attestationType"] = validJSONString(a.AttestationType)
+	}
+	return m
+}
+
+func (d DeploymentContext) jsonMap() map[string]interface{} {
+	m := map[string]interface{}{"runtime": validJSONString(string(d.Runtime))}
+	if d.TEEAttestation != "" {
+		m["teeAttestation"] = validJSONString(d.TEEAttestation)
+	}
+	if d.TEEAttestationType != "" {
+		m["teeAttestationType"] = validJSONString(d.TEEAttestationType)
+	}
+	if d.Region != "" {
+		m["region"] = validJSONString(d.Region)
+	}
+	if d.Provider != "" {
+		m["provider"] = validJSONString(d.Provider)
+	}
+	return m
+}
+
+func lineageValue(entries []LineageEntry) interface{} {
+	if entries == nil {
+		return nil
+	}
+	s := make([]interface{}, len(entries))
+	for i := range entries {
+		s[i] = entries[i].jsonMap()
+	}
+	return s
+}
+
+func (e *LineageEntry) jsonObject() (map[string]interface{}, error) {
+	if e == nil {
+		return nil, nil
+	}
+	return e.jsonMap(), nil
+}
+
+func (e *LineageEntry) jsonMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"identityHash":           validJSONString(e.IdentityHash),
+		"changeType":             validJSONString(e.ChangeType),
+		"description":            validJSONString(e.Description),
+		"timestamp":              validJSONString(e.Timestamp),
+		"parentHash":             nil,
+		"signature":              validJSONString(e.Signature),
+		"reputationCarryForward": e.ReputationCarryForward,
+	}
+	if e.ParentHash != nil {
+		m["parentHash"] = validJSONString(*e.ParentHash)
+	}
+	if e.PreviousOperatorKey != "" {
+		m["previousOperatorKey"] = validJSONString(e.PreviousOperatorKey)
+	}
+	if e.NewOperatorKey != "" {
+		m["newOperatorKey"] = validJSONString(e.NewOperatorKey)
+	}
+	if e.NewKeySignature != "" {
+		m["newKeySignature"] = validJSONString(e.NewKeySignature)
+	}
+	if e.Operators != nil {
+		m["operators"] = e.Operators.jsonMap()
+	}
+	if len(e.Signatures) > 0 {
+		m["signatures"] = operatorSignaturesValue(e.Signatures)
+	}
+	if e.PolicyHash != "" {
+		m["policyHash"] = validJSONString(e.PolicyHash)
+	}
+	if e.Fork != nil {
+		m["fork"] = e.Fork.jsonMap()
+	}
+	if e.Summary != nil {
+		m["summary"] = e.Summary.jsonMap()
+	}
+	if e.NextKeyCommitment != "" {
+		m["nextKeyCommitment"] = validJSONString(e.NextKeyCommitment)
+	}
+	if e.Recovery != nil {
+		m["recovery"] = e.Recovery.jsonMap()
+	}
+	if len(e.Capabilities) > 0 {
+		m["capabilities"] = stringsValue(e.Capabilities)
+	}
+	if e.EvolutionPolicy != nil {
+		m["evolutionPolicy"] = e.EvolutionPolicy.jsonMap()
+	}
+	return m
+}
+
+func (s *OperatorSet) jsonObject() (map[string]interface{}, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return s.jsonMap(), nil
+}
+
+func (s *OperatorSet) jsonMap() map[string]interface{} {
+	return map[string]interface{}{
+		"keys":      stringsValue(s.Keys),
+		"threshold": float64(s.Threshold),
+	}
+}
+
+func operatorSignaturesValue(sigs []OperatorSignature) interface{} {
+	if sigs == nil {
+		return nil
+	}
+	s := make([]interface{}, len(sigs))
+	for i, sig := range sigs {
+		s[i] = map[string]interface{}{
+			"publicKey": validJSONString(sig.PublicKey),
+			"signature": validJSONString(sig.Signature),
+		}
+	}
+	return s
+}
+
+func (f *ForkLink) jsonObject() (map[string]interface{}, error) {
+	if f == nil {
+		return nil, nil
+	}
+	return f.jsonMap(), nil
+}
+
+func (f *ForkLink) jsonMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"parentId":          validJSONString(f.ParentID),
+		"parentLineageHash": validJSONString(f.ParentLineageHash),
+		"parentOperatorKey": validJSONString(f.ParentOperatorKey),
+		"childOperatorKey":  validJSONString(f.ChildOperatorKey),
+		"reason":            validJSONString(f.Reason),
+		"timestamp":         validJSONString(f.Timestamp),
+	}
+	if f.ParentOperators != nil {
+		m["parentOperators"] = f.ParentOperators.jsonMap()
+	}
+	if f.Signature != "" {
+		m["signature"] = validJSONString(f.Signature)
+	}
+	if len(f.Signatures) > 0 {
+		m["signatures"] = operatorSignaturesValue(f.Signatures)
+	}
+	return m
+}
+
+func (p *ParentBinding) jsonObject() (map[string]interface{}, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return p.jsonMap(), nil
+}
+
+func (p *ParentBinding) jsonMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"parentId":           validJSONString(p.ParentID),
+		"parentLineageHash":  validJSONString(p.ParentLineageHash),
+		"parentOperatorKey":  validJSONString(p.ParentOperatorKey),
+		"parentCapabilities": stringsValue(p.ParentCapabilities),
+		"parentManifestHash": validJSONString(p.ParentManifestHash),
+		"childOperatorKey":   validJSONString(p.ChildOperatorKey),
+		"timestamp":          validJSONString(p.Timestamp),
+	}
+	if p.ParentOperators != nil {
+		m["parentOperators"] = p.ParentOperators.jsonMap()
+	}
+	if p.Signature != "" {
+		m["signature"] = validJSONString(p.Signature)
+	}
+	if len(p.Signatures) > 0 {
+		m["signatures"] = operatorSignaturesValue(p.Signatures)
+	}
+	return m
+}
+
+func (s *LineageSummary) jsonMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"count":        float64(s.Count),
+		"length":       float64(s.Length),
+		"carryForward": s.CarryForward,
+		"merkleRoot":   validJSONString(s.MerkleRoot),
+		"rootHash":     validJSONString(s.RootHash),
+		"operatorKey":  validJSONString(s.OperatorKey),
+	}
+	if s.Operators != nil {
+		m["operators"] = s.Operators.jsonMap()
+	}
+	if len(s.RotatedKeys) > 0 {
+		m["rotatedKeys"] = stringsValue(s.RotatedKeys)
+	}
+	if s.NextKeyCommitment != "" {
+		m["nextKeyCommitment"] = validJSONString(s.NextKeyCommitment)
+	}
+	if s.Recovery != nil {
+		m["recovery"] = s.Recovery.jsonMap()
+	}
+	return m
+}
+
+func (p *EvolutionPolicy) jsonObject() (map[string]interface{}, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return p.jsonMap(), nil
+}
+
+func (p *EvolutionPolicy) jsonMap() map[string]interface{} {
+	return map[string]interface{}{
+		"minorUpdate":         p.MinorUpdate,
+		"modelVersionChange":  p.ModelVersionChange,
+		"modelFamilyChange":   p.ModelFamilyChange,
+		"operatorTransfer":    p.OperatorTransfer,
+		"capabilityExpansion": p.CapabilityExpansion,
+		"capabilityReduction": p.CapabilityReduction,
+		"fullRebuild":         p.FullRebuild,
+		"operatorKeyRotation": p.OperatorKeyRotation,
+		"operatorKeyRecovery": p.OperatorKeyRecovery,
+	}
+}
+
+func (r *IdentityRevocation) jsonObject() (map[string]interface{}, error) {
+	if r == nil {
+		return nil, nil
+	}
+	m := map[string]interface{}{
+		"identityId":        validJSONString(r.IdentityID),
+		"lineageHash":       validJSONString(r.LineageHash),
+		"operatorPublicKey": validJSONString(r.OperatorPublicKey),
+		"reason":            validJSONString(string(r.Reason)),
+		"revokedAt":         validJSONString(r.RevokedAt),
+		"effectiveAt":       validJSONString(r.EffectiveAt),
+		"signature":         validJSONString(r.Signature),
+	}
+	if r.AgentRoot != "" {
+		m["agentRoot"] = validJSONString(r.AgentRoot)
+	}
+	if r.Description != "" {
+		m["description"] = validJSONString(r.Description)
+	}
+	return m, nil
+}
+
+func (mf *ModelManifest) jsonObject() (map[string]interface{}, error) {
+	if mf == nil {
+		return nil, nil
+	}
+	m := map[string]interface{}{
+		"provider":  validJSONString(mf.Provider),
+		"publicKey": validJSONString(mf.PublicKey),
+		"models":    nil,
+		"issuedAt":  validJSONString(mf.IssuedAt),
+	}
+	if mf.Models != nil {
+		models := make([]interface{}, len(mf.Models))
+		for i, e := range mf.Models {
+			model := map[string]interface{}{
+				"modelId":         validJSONString(e.ModelID),
+				"attestationType": validJSONString(e.AttestationType),
+				"attestationHash": validJSONString(e.AttestationHash),
+			}
+			if e.ModelVersion != "" {
+				model["modelVersion"] = validJSONString(e.ModelVersion)
+			}
+			models[i] = model
+		}
+		m["models"] = models
+	}
+	if mf.Signature != "" {
+		m["signature"] = validJSONString(mf.Signature)
+	}
+	return m, nil
+}
+
+// ----------------------------------------------------------------------------
+// Action log types
+// ----------------------------------------------------------------------------
+
+func (e *ActionLogEntry) jsonObject() (map[string]interface{}, error) {
+	if e == nil {
+		return nil, nil
+	}
+	return map[string]interface{}{
+		"index":        float64(e.Index),
+		"covenantId":   validJSONString(e.CovenantID),
+		"action":       validJSONString(e.Action),
+		"resource":     validJSONString(e.Resource),
+		"contextHash":  validJSONString(e.ContextHash),
+		"outcome":      validJSONString(string(e.Outcome)),
+		"timestamp":    validJSONString(e.Timestamp),
+		"previousHash": validJSONString(e.PreviousHash),
+		"hash":         validJSONString(e.Hash),
+		"signature":    validJSONString(e.Signature),
+	}, nil
+}
+
+func (cp *LogCheckpoint) jsonObject() (map[string]interface{}, error) {
+	if cp == nil {
+		return nil, nil
+	}
+	m := map[string]interface{}{
+		"covenantId":      validJSONString(cp.CovenantID),
+		"size":            float64(cp.Size),
+		"headHash":        validJSONString(cp.HeadHash),
+		"root":            validJSONString(cp.Root),
+		"timestamp":       validJSONString(cp.Timestamp),
+		"signerPublicKey": validJSONString(cp.SignerPublicKey),
+		"signature":       validJSONString(cp.Signature),
+	}
+	if len(cp.Cosignatures) > 0 {
+		cosigs := make([]interface{}, len(cp.Cosignatures))
+		for i, c := range cp.Cosignatures {
+			cosig := map[string]interface{}{
+				"witnessPublicKey": validJSONString(c.WitnessPublicKey),
+				"timestamp":        validJSONString(c.Timestamp),
+				"signature":        validJSONString(c.Signature),
+			}
+			if c.Role != "" {
+				cosig["role"] = validJSONString(c.Role)
+			}
+			cosigs[i] = cosig
+		}
+		m["cosignatures"] = cosigs
+	}
+	if len(cp.Anchors) > 0 {
+		anchors := make([]interface{}, len(cp.Anchors))
+		for i := range cp.Anchors {
+			anchors[i] = cp.Anchors[i].jsonMap()
+		}
+		m["anchors"] = anchors
+	}
+	return m, nil
+}
+
+func (r *ActionReceipt) jsonObject() (map[string]interface{}, error) {
+	if r == nil {
+		return nil, nil
+	}
+	return map[string]interface{}{
+		"covenantId":      validJSONString(r.CovenantID),
+		"index":           float64(r.Index),
+		"entryHash":       validJSONString(r.EntryHash),
+		"action":          validJSONString(r.Action),
+		"resource":        validJSONString(r.Resource),
+		"outcome":         validJSONString(string(r.Outcome)),
+		"timestamp":       validJSONString(r.Timestamp),
+		"signerPublicKey": validJSONString(r.SignerPublicKey),
+		"signature":       validJSONString(r.Signature),
+	}, nil
+}
+
+// ----------------------------------------------------------------------------
+// Enforcement types
+// ----------------------------------------------------------------------------
+
+func (r *SuspensionRecord) jsonObject() (map[string]interface{}, error) {
+	if r == nil {
+		return nil, nil
+	}
+	m := map[string]interface{}{
+		"covenantId":      validJSONString(r.CovenantID),
+		"reason":          validJSONString(r.Reason),
+		"violations":      nil,
+		"suspendedAt":     validJSONString(r.SuspendedAt),
+		"signerPublicKey": validJSONString(r.SignerPublicKey),
+		"signature":       validJSONString(r.Signature),
+	}
+	if r.Violations != nil {
+		violations := make([]interface{}, len(r.Violations))
+		for i := range r.Violations {
+			violations[i] = r.Violations[i].jsonMap()
+		}
+		m["violations"] = violations
+	}
+	if len(r.SafeList) > 0 {
+		m["safeList"] = stringsValue(r.SafeList)
+	}
+	return m, nil
+}
+
+func (v *Violation) jsonMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"kind":       validJSONString(string(v.Kind)),
+		"covenantId": validJSONString(v.CovenantID),
+		"action":     validJSONString(v.Action),
+		"resource":   validJSONString(v.Resource),
+		"message":    validJSONString(v.Message),
+		"logIndex":   float64(v.LogIndex),
+		"at":         v.At.Format(time.RFC3339Nano),
+	}
+	if v.Rule != "" {
+		m["rule"] = validJSONString(v.Rule)
+	}
+	return m
+}
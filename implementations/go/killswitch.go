@@ -0,0 +1,176 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"time"
+)
+
+// KillSwitchOptions configure an Enforcer's kill switch: a circuit
+// breaker that suspends the covenant after repeated violations. While
+// suspended, the enforcer denies every action except those matching
+// SafeList, which are still checked against the covenant, until an
+// operator calls Enforcer.Reset. A PolicyAgent carries a suspension over
+// to each Enforcer it swaps in; to keep one across a restart, persist the
+// records passed to OnSuspend and start the new Enforcer with Suspension.
+type KillSwitchOptions struct {
+	// Threshold is the number of violations within Window that trips the
+	// switch. Required.
+	Threshold int
+	// Window is the period violations are counted over. Required.
+	Window time.Duration
+	// SafeList are CCL action patterns, such as "audit.**", that stay
+	// available during a suspension. Obligations can only be fulfilled
+	// while suspended if their actions are safe-listed.
+	SafeList []string
+	// Signer signs suspension records. Required.
+	Signer *KeyPair
+	// OnSuspend, if set, is invoked synchronously with the record of each
+	// suspension.
+	OnSuspend func(*SuspensionRecord)
+	// Suspension, if set, is a suspension the enforcer starts under, such
+	// as one persisted before a restart. It must be signed by Signer and
+	// lasts until Reset. It may be for an earlier covenant of the agent.
+	Suspension *SuspensionRecord
+}
+
+// SuspensionRecord is a signed record that an Enforcer's kill switch
+// suspended a covenant.
+type SuspensionRecord struct {
+	CovenantID string `json:"covenantId"`
+	Reason     string `json:"reason"`
+	// Violations are the violations within the window that tripped the
+	// switch, oldest first.
+	Violations      []Violation `json:"violations"`
+	SafeList        []string    `json:"safeList,omitempty"`
+	SuspendedAt     string      `json:"suspendedAt"`
+	SignerPublicKey string      `json:"signerPublicKey"`
+	Signature       string      `json:"signature"`
+}
+
+// VerifySuspensionRecord checks a suspension record's signature. Whether
+// the signer is trusted to suspend the covenant is up to the caller.
+func VerifySuspensionRecord(r *SuspensionRecord) error {
+	if r == nil {
+		return errorf(ErrCodeMissingField, "grith: suspension record is required")
+	}
+	if _, err := parseTimestamp(r.SuspendedAt); err != nil {
+		return errorf(ErrCodeInvalidInput, "grith: suspension record has an invalid time")
+	}
+	pub, err := FromHex(r.SignerPublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errorf(ErrCodeInvalidInput, "grith: suspension record signer key is invalid")
+	}
+	if !verifyLogSignature(r, r.Signature, ed25519.PublicKey(pub)) {
+		return errorf(ErrCodeCrypto, "grith: suspension of %s has an invalid signature", shortID(r.CovenantID))
+	}
+	return nil
+}
+
+// validateKillSwitch checks the kill switch options of NewEnforcer.
+func validateKillSwitch(opts *KillSwitchOptions) error {
+	if opts.Threshold < 1 || opts.Window <= 0 {
+		return errorf(ErrCodeInvalidInput, "grith: kill switch requires a positive threshold and window")
+	}
+	if opts.Signer == nil || len(opts.Signer.PrivateKey) != ed25519.PrivateKeySize {
+		return errorf(ErrCodeInvalidPrivateKey, "grith: kill switch requires a signer")
+	}
+	if r := opts.Suspension; r != nil {
+		if err := VerifySuspensionRecord(r); err != nil {
+			return err
+		}
+		if r.SignerPublicKey != opts.Signer.PublicKeyHex {
+			return errorf(ErrCodeInvalidInput, "grith: kill switch suspension was not signed by its signer")
+		}
+	}
+	return nil
+}
+
+// strike counts violations against the kill switch and, if they trip it,
+// suspends the covenant and returns the suspension record. The caller
+// holds the lock.
+func (e *Enforcer) strike(violations []Violation, now time.Time) (*SuspensionRecord, error) {
+	if e.kill == nil || e.suspension != nil || len(violations) == 0 {
+		return nil, nil
+	}
+	e.strikes = append(e.strikes, violations...)
+	start := 0
+	for start < len(e.strikes) && !e.strikes[start].At.After(now.Add(-e.kill.Window)) {
+		start++
+	}
+	e.strikes = e.strikes[start:]
+	if len(e.strikes) < e.kill.Threshold {
+		return nil, nil
+	}
+
+	r := &SuspensionRecord{
+		CovenantID:      e.covenant.ID,
+		Reason:          fmt.Sprintf("%d violations within %s", len(e.strikes), e.kill.Window),
+		Violations:      e.strikes,
+		SafeList:        e.kill.SafeList,
+		SuspendedAt:     now.UTC().Format("2006-01-02T15:04:05.000Z"),
+		SignerPublicKey: e.kill.Signer.PublicKeyHex,
+	}
+	payload, err := signedPayload(r)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := Sign(payload, e.kill.Signer.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign suspension record: %w", err)
+	}
+	r.Signature = ToHex(sig)
+	e.suspension = r
+	e.strikes = nil
+	return r, nil
+}
+
+// suspended reports whether action is denied by a suspension. The caller
+// holds the lock.
+func (e *Enforcer) suspended(action string) bool {
+	if e.suspension == nil {
+		return false
+	}
+	for _, pattern := range e.kill.SafeList {
+		if MatchAction(pattern, action) {
+			return false
+		}
+	}
+	return true
+}
+
+// Suspension returns the record of the active suspension, or nil if the
+// covenant is not suspended.
+func (e *Enforcer) Suspension() *SuspensionRecord {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.suspension
+}
+
+// inheritSuspension carries a suspension of prev, the enforcer e replaces,
+// over to e, so that replacing an enforcer does not lift it.
+func (e *Enforcer) inheritSuspension(prev *Enforcer) {
+	if e.kill == nil || prev == nil {
+		return
+	}
+	r := prev.Suspension()
+	if r == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.suspension == nil {
+		e.suspension = r
+	}
+}
+
+// Reset lifts a suspension and clears the violations counted against the
+// kill switch. It is the operator's acknowledgement of the suspension; a
+// persisted record passed to KillSwitchOptions.Suspension must also be
+// discarded, or the next Enforcer starts suspended again.
+func (e *Enforcer) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.suspension = nil
+	e.strikes = nil
+}
@@ -0,0 +1,733 @@
+package grith
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KVStore is an embedded key-value database in a single file, for agents
+// on edge devices where SQLite is too heavy. It keeps one bucket per type
+// of content, served by Covenants, Identities, and Logs. Each write is a
+// checksummed record appended to the file and synced before it returns,
+// so a write spanning several keys is applied entirely or not at all;
+// opening the store replays the file and truncates a torn final record
+// left by a crash. The file is rewritten once most of it is superseded
+// records. Contents are held in memory. It is safe for concurrent use
+// within a single process.
+type KVStore struct {
+	mu       sync.RWMutex
+	path     string
+	file     *os.File // nil once closed
+	size     int64    // bytes in the file
+	live     int64    // bytes of current keys and values
+	buckets  map[string]map[string][]byte
+	repaired int64
+
+	covenants  *KVCovenantStore
+	identities *KVIdentityStore
+	logs       *KVLogStore
+}
+
+// Bucket names in a KVStore.
+const (
+	kvBucketCovenants  = "covenants"
+	kvBucketIdentities = "identities"
+	kvBucketLogs       = "logs"
+)
+
+// kvCompactMinSize is the file size below which a KVStore is never
+// rewritten.
+const kvCompactMinSize = 1 << 20
+
+// kvHeaderSize is the size of a record header: the payload length and
+// its CRC-32C checksum, both big-endian.
+const kvHeaderSize = 8
+
+var kvCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// kvOp is one key written or deleted by a record.
+type kvOp struct {
+	Bucket string          `json:"b"`
+	Key    string          `json:"k"`
+	Value  json.RawMessage `json:"v,omitempty"`
+	Delete bool            `json:"d,omitempty"`
+}
+
+// OpenKVStore opens (creating if necessary) the store in the file at
+// path. A corrupt record other than a torn tail is an error.
+func OpenKVStore(path string) (*KVStore, error) {
+	return OpenKVStoreWithOptions(path, nil)
+}
+
+// OpenKVStoreWithOptions opens the store at path as OpenKVStore does,
+// with the given encryption and verification options for its covenant
+// bucket.
+func OpenKVStoreWithOptions(path string, opts *StoreOptions) (*KVStore, error) {
+	if path == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: KV store requires a file path")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to create KV store directory: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errorf(ErrCodeStorage, "grith: failed to read KV store: %w", err)
+	}
+	s := &KVStore{path: path, buckets: make(map[string]map[string][]byte)}
+	valid, err := s.replay(data)
+	if err != nil {
+		return nil, err
+	}
+	if valid < int64(len(data)) {
+		if err := os.Truncate(path, valid); err != nil {
+			return nil, errorf(ErrCodeStorage, "grith: failed to truncate torn KV store tail: %w", err)
+		}
+		s.repaired = int64(len(data)) - valid
+	}
+	s.size = valid
+	if s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to open KV store: %w", err)
+	}
+	syncDir(filepath.Dir(path))
+
+	s.covenants = &KVCovenantStore{kv: s, codec: newDocumentCodec(opts), put: newPutCheck(opts)}
+	s.identities = &KVIdentityStore{kv: s}
+	if s.logs, err = loadKVLogStore(s); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// replay applies the records in data and returns the length of its valid
+// prefix. A final record that is short or fails its checksum is a torn
+// write and ends the prefix.
+func (s *KVStore) replay(data []byte) (int64, error) {
+	var offset int64
+	for offset < int64(len(data)) {
+		rest := data[offset:]
+		if len(rest) < kvHeaderSize {
+			return offset, nil
+		}
+		n := int64(binary.BigEndian.Uint32(rest))
+		if n > int64(len(rest))-kvHeaderSize {
+			return offset, nil
+		}
+		payload := rest[kvHeaderSize : kvHeaderSize+n]
+		last := kvHeaderSize+n == int64(len(rest))
+		var ops []kvOp
+		if crc32.Checksum(payload, kvCRCTable) != binary.BigEndian.Uint32(rest[4:]) || json.Unmarshal(payload, &ops) != nil {
+			if last {
+				return offset, nil
+			}
+			return 0, errorf(ErrCodeStorage, "grith: corrupt record in KV store at offset %d", offset)
+		}
+		s.apply(ops)
+		offset += kvHeaderSize + n
+	}
+	return offset, nil
+}
+
+// apply updates the in-memory buckets. The caller holds the lock or has
+// not yet shared the store.
+func (s *KVStore) apply(ops []kvOp) {
+	for _, op := range ops {
+		b := s.buckets[op.Bucket]
+		if old, ok := b[op.Key]; ok {
+			s.live -= int64(len(op.Key) + len(old))
+			delete(b, op.Key)
+		}
+		if op.Delete {
+			continue
+		}
+		if b == nil {
+			b = make(map[string][]byte)
+			s.buckets[op.Bucket] = b
+		}
+		b[op.Key] = op.Value
+		s.live += int64(len(op.Key) + len(op.Value))
+	}
+}
+
+// commit appends ops as one record, syncs it, and applies it. The caller
+// holds the write lock.
+func (s *KVStore) commit(ops []kvOp) error {
+	if s.file == nil {
+		return errorf(ErrCodeStorage, "grith: KV store is closed")
+	}
+	payload, err := json.Marshal(ops)
+	if err != nil {
+		return errorf(ErrCodeSerialization, "grith: failed to serialize KV record: %w", err)
+	}
+	record := encodeKVRecord(payload)
+	if _, err := s.file.Write(record); err != nil {
+		s.rollback()
+		return errorf(ErrCodeStorage, "grith: failed to write KV record: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		s.rollback()
+		return errorf(ErrCodeStorage, "grith: failed to sync KV record: %w", err)
+	}
+	s.size += int64(len(record))
+	s.apply(ops)
+	if s.size > kvCompactMinSize && s.size > 2*s.live {
+		// The write is durable; a failed rewrite leaves the old file.
+		if err := s.compact(); err != nil {
+			logError(slog.LevelWarn, "kv store compaction failed", err)
+		}
+	}
+	return nil
+}
+
+// rollback drops a partly written record so that later records do not
+// follow it. If that fails the store refuses further writes, and the
+// record is treated as torn when the store is next opened.
+func (s *KVStore) rollback() {
+	if err := s.file.Truncate(s.size); err != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+func encodeKVRecord(payload []byte) []byte {
+	record := make([]byte, kvHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record, uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.Checksum(payload, kvCRCTable))
+	copy(record[kvHeaderSize:], payload)
+	return record
+}
+
+// Compact rewrites the file with one record per bucket holding only its
+// current contents.
+func (s *KVStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return errorf(ErrCodeStorage, "grith: KV store is closed")
+	}
+	return s.compact()
+}
+
+// compact rewrites the file. The caller holds the write lock.
+func (s *KVStore) compact() error {
+	names := make([]string, 0, len(s.buckets))
+	for name := range s.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var data []byte
+	for _, name := range names {
+		ops := make([]kvOp, 0, len(s.buckets[name]))
+		for k, v := range s.buckets[name] {
+			ops = append(ops, kvOp{Bucket: name, Key: k, Value: v})
+		}
+		if len(ops) == 0 {
+			continue
+		}
+		payload, err := json.Marshal(ops)
+		if err != nil {
+			return errorf(ErrCodeSerialization, "grith: failed to serialize KV record: %w", err)
+		}
+		data = append(data, encodeKVRecord(payload)...)
+	}
+	dir, name := filepath.Split(s.path)
+	if dir == "" {
+		dir = "."
+	}
+	if err := writeFileAtomic(dir, name, data); err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to rewrite KV store: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		s.file.Close()
+		s.file = nil
+		return errorf(ErrCodeStorage, "grith: failed to reopen KV store: %w", err)
+	}
+	s.file.Close()
+	s.file = f
+	s.size = int64(len(data))
+	return nil
+}
+
+// Repaired returns the number of bytes of torn tail truncated when the
+// store was opened.
+func (s *KVStore) Repaired() int64 {
+	return s.repaired
+}
+
+// Close closes the store's file. Reads still succeed; writes fail.
+func (s *KVStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to close KV store: %w", err)
+	}
+	return nil
+}
+
+// Covenants returns the store's covenant bucket as a Store.
+func (s *KVStore) Covenants() *KVCovenantStore { return s.covenants }
+
+// Identities returns the store's identity bucket as an IdentityStore.
+func (s *KVStore) Identities() *KVIdentityStore { return s.identities }
+
+// Logs returns the store's action log bucket as a LogStore.
+func (s *KVStore) Logs() *KVLogStore { return s.logs }
+
+// sortedKeys returns the keys of a bucket in order. The caller holds the
+// lock.
+func (s *KVStore) sortedKeys(bucket string) []string {
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for k := range s.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ----------------------------------------------------------------------------
+// Covenants
+// ----------------------------------------------------------------------------
+
+// KVCovenantStore is the Store over a KVStore's covenant bucket.
+type KVCovenantStore struct {
+	kv    *KVStore
+	codec documentCodec
+	put   putCheck
+}
+
+// Put stores doc under id, replacing any existing document.
+func (s *KVCovenantStore) Put(id string, doc *CovenantDocument) error {
+	if id == "" {
+		return errorf(ErrCodeInvalidInput, "grith: kvStore.Put: id must be a non-empty string")
+	}
+	if doc == nil {
+		return errorf(ErrCodeMissingField, "grith: kvStore.Put: document is required")
+	}
+	if err := s.put.check(id, doc); err != nil {
+		return err
+	}
+	data, err := s.codec.encode(id, doc)
+	if err != nil {
+		return err
+	}
+	s.kv.mu.Lock()
+	defer s.kv.mu.Unlock()
+	return s.kv.commit([]kvOp{{Bucket: kvBucketCovenants, Key: id, Value: data}})
+}
+
+// Get returns the document stored under id, or nil if there is none.
+func (s *KVCovenantStore) Get(id string) (*CovenantDocument, error) {
+	if id == "" {
+		return nil, errorf(ErrCodeInvalidInput, "grith: kvStore.Get: id must be a non-empty string")
+	}
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	data, ok := s.kv.buckets[kvBucketCovenants][id]
+	if !ok {
+		return nil, nil
+	}
+	return s.codec.decode(id, data)
+}
+
+// Delete removes the document stored under id.
+func (s *KVCovenantStore) Delete(id string) error {
+	if id == "" {
+		return errorf(ErrCodeInvalidInput, "grith: kvStore.Delete: id must be a non-empty string")
+	}
+	s.kv.mu.Lock()
+	defer s.kv.mu.Unlock()
+	if _, ok := s.kv.buckets[kvBucketCovenants][id]; !ok {
+		return errorf(ErrCodeNotFound, "grith: kvStore.Delete: document not found: %s", id)
+	}
+	return s.kv.commit([]kvOp{{Bucket: kvBucketCovenants, Key: id, Delete: true}})
+}
+
+// List returns every stored document, ordered by ID.
+func (s *KVCovenantStore) List() ([]*CovenantDocument, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	keys := s.kv.sortedKeys(kvBucketCovenants)
+	result := make([]*CovenantDocument, 0, len(keys))
+	for _, k := range keys {
+		doc, err := s.codec.decode(k, s.kv.buckets[kvBucketCovenants][k])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, doc)
+	}
+	return result, nil
+}
+
+// ListPage returns up to limit documents following cursor, ordered by
+// ID, and the cursor of the next page.
+func (s *KVCovenantStore) ListPage(cursor string, limit int) ([]*CovenantDocument, string, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	page, next, err := pageOf(s.kv.sortedKeys(kvBucketCovenants), cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	result := make([]*CovenantDocument, 0, len(page))
+	for _, id := range page {
+		doc, err := s.codec.decode(id, s.kv.buckets[kvBucketCovenants][id])
+		if err != nil {
+			return nil, "", err
+		}
+		result = append(result, doc)
+	}
+	return result, next, nil
+}
+
+// Has reports whether a document is stored under id.
+func (s *KVCovenantStore) Has(id string) bool {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	_, ok := s.kv.buckets[kvBucketCovenants][id]
+	return ok
+}
+
+// Count returns the number of stored documents.
+func (s *KVCovenantStore) Count() int {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	return len(s.kv.buckets[kvBucketCovenants])
+}
+
+// FindByIssuer returns the documents issued by the party with the given ID.
+func (s *KVCovenantStore) FindByIssuer(issuerID string) ([]*CovenantDocument, error) {
+	return s.find(issuedBy(issuerID))
+}
+
+// FindByBeneficiary returns the documents issued to the party with the
+// given ID.
+func (s *KVCovenantStore) FindByBeneficiary(beneficiaryID string) ([]*CovenantDocument, error) {
+	return s.find(issuedTo(beneficiaryID))
+}
+
+// FindExpiringBefore returns the documents that expire before t.
+func (s *KVCovenantStore) FindExpiringBefore(t time.Time) ([]*CovenantDocument, error) {
+	return s.find(expiringBefore(t))
+}
+
+// FindChildrenOf returns the documents chained to the given parent.
+func (s *KVCovenantStore) FindChildrenOf(parentID string) ([]*CovenantDocument, error) {
+	return s.find(childOf(parentID))
+}
+
+// FindByMetadata returns the documents whose metadata maps key to value.
+func (s *KVCovenantStore) FindByMetadata(key string, value interface{}) ([]*CovenantDocument, error) {
+	match, err := withMetadata(key, value)
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: kvStore.FindByMetadata: value is not JSON: %w", err)
+	}
+	return s.find(match)
+}
+
+// find returns the matching documents, ordered by ID.
+func (s *KVCovenantStore) find(match covenantMatcher) ([]*CovenantDocument, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	docs := make(map[string]*CovenantDocument, len(s.kv.buckets[kvBucketCovenants]))
+	for id, data := range s.kv.buckets[kvBucketCovenants] {
+		doc, err := s.codec.decode(id, data)
+		if err != nil {
+			return nil, err
+		}
+		docs[id] = doc
+	}
+	return matchDocuments(docs, match, func(doc *CovenantDocument) *CovenantDocument { return doc }), nil
+}
+
+// ----------------------------------------------------------------------------
+// Identities
+// ----------------------------------------------------------------------------
+
+// KVIdentityStore is the IdentityStore over a KVStore's identity bucket.
+type KVIdentityStore struct {
+	kv *KVStore
+}
+
+// Put stores identity, replacing any existing identity with its ID.
+func (s *KVIdentityStore) Put(identity *AgentIdentity) error {
+	if identity == nil || identity.ID == "" {
+		return errorf(ErrCodeInvalidInput, "grith: kvIdentityStore.Put: identity with an ID is required")
+	}
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return errorf(ErrCodeSerialization, "grith: kvIdentityStore.Put: failed to serialize identity: %w", err)
+	}
+	s.kv.mu.Lock()
+	defer s.kv.mu.Unlock()
+	return s.kv.commit([]kvOp{{Bucket: kvBucketIdentities, Key: identity.ID, Value: data}})
+}
+
+// Get returns the identity with the given ID, or nil.
+func (s *KVIdentityStore) Get(id string) (*AgentIdentity, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	data, ok := s.kv.buckets[kvBucketIdentities][id]
+	if !ok {
+		return nil, nil
+	}
+	return decodeKVIdentity(data)
+}
+
+// Delete removes the identity with the given ID.
+func (s *KVIdentityStore) Delete(id string) error {
+	s.kv.mu.Lock()
+	defer s.kv.mu.Unlock()
+	if _, ok := s.kv.buckets[kvBucketIdentities][id]; !ok {
+		return errorf(ErrCodeNotFound, "grith: kvIdentityStore.Delete: identity not found: %s", id)
+	}
+	return s.kv.commit([]kvOp{{Bucket: kvBucketIdentities, Key: id, Delete: true}})
+}
+
+// List returns every stored identity, ordered by ID.
+func (s *KVIdentityStore) List() ([]*AgentIdentity, error) {
+	return s.Query(nil)
+}
+
+// Query returns the identities matching q, ordered by ID.
+func (s *KVIdentityStore) Query(q *IdentityQuery) ([]*AgentIdentity, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	var result []*AgentIdentity
+	for _, k := range s.kv.sortedKeys(kvBucketIdentities) {
+		identity, err := decodeKVIdentity(s.kv.buckets[kvBucketIdentities][k])
+		if err != nil {
+			return nil, err
+		}
+		if q.Matches(identity) {
+			result = append(result, identity)
+		}
+	}
+	return result, nil
+}
+
+// Has reports whether an identity with the given ID is stored.
+func (s *KVIdentityStore) Has(id string) bool {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	_, ok := s.kv.buckets[kvBucketIdentities][id]
+	return ok
+}
+
+// Count returns the number of stored identities.
+func (s *KVIdentityStore) Count() int {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	return len(s.kv.buckets[kvBucketIdentities])
+}
+
+func decodeKVIdentity(data []byte) (*AgentIdentity, error) {
+	var identity AgentIdentity
+	if err := json.Unmarshal(data, &identity); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: kvIdentityStore: stored identity is corrupt: %w", err)
+	}
+	return &identity, nil
+}
+
+// ----------------------------------------------------------------------------
+// Action logs
+// ----------------------------------------------------------------------------
+
+// KVLogStore is the LogStore over a KVStore's log bucket. A covenant's
+// entries are keyed by its ID and their zero-padded index, and its latest
+// checkpoint by its ID and "checkpoint"; an Append is a single record.
+type KVLogStore struct {
+	kv *KVStore
+	// heads maps each covenant with a stored log to its size and head
+	// hash. It is guarded by kv.mu.
+	heads map[string]kvLogHead
+}
+
+type kvLogHead struct {
+	size int64
+	head string
+}
+
+const kvCheckpointKey = "checkpoint"
+
+func kvLogKey(covenantID string, index int64) string {
+	return fmt.Sprintf("%s/%020d", covenantID, index)
+}
+
+// loadKVLogStore verifies every stored log and indexes its head.
+func loadKVLogStore(kv *KVStore) (*KVLogStore, error) {
+	s := &KVLogStore{kv: kv, heads: make(map[string]kvLogHead)}
+	for _, key := range kv.sortedKeys(kvBucketLogs) {
+		i := strings.LastIndexByte(key, '/')
+		if i <= 0 {
+			return nil, errorf(ErrCodeStorage, "grith: invalid log key %q in KV store", key)
+		}
+		covenantID, suffix := key[:i], key[i+1:]
+		if suffix == kvCheckpointKey {
+			continue
+		}
+		index, err := strconv.ParseInt(suffix, 10, 64)
+		if err != nil {
+			return nil, errorf(ErrCodeStorage, "grith: invalid log key %q in KV store", key)
+		}
+		var e ActionLogEntry
+		if err := json.Unmarshal(kv.buckets[kvBucketLogs][key], &e); err != nil || e.Index != index {
+			return nil, errorf(ErrCodeStorage, "grith: corrupt log entry %q in KV store", key)
+		}
+		h, ok := s.heads[covenantID]
+		if !ok {
+			h.head = ActionLogGenesisHash
+		}
+		if err := checkLogContinuation(covenantID, h.size, h.head, []ActionLogEntry{e}); err != nil {
+			return nil, err
+		}
+		s.heads[covenantID] = kvLogHead{size: h.size + 1, head: e.Hash}
+	}
+	return s, nil
+}
+
+// Append adds entries to the end of a covenant's log in one record.
+func (s *KVLogStore) Append(covenantID string, entries ...ActionLogEntry) error {
+	if covenantID == "" {
+		return errorf(ErrCodeInvalidInput, "grith: kvLogStore.Append: covenant ID must be a non-empty string")
+	}
+	s.kv.mu.Lock()
+	defer s.kv.mu.Unlock()
+	h, ok := s.heads[covenantID]
+	if !ok {
+		h.head = ActionLogGenesisHash
+	}
+	if err := checkLogContinuation(covenantID, h.size, h.head, entries); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	ops := make([]kvOp, len(entries))
+	for i := range entries {
+		data, err := json.Marshal(&entries[i])
+		if err != nil {
+			return errorf(ErrCodeSerialization, "grith: kvLogStore.Append: failed to serialize entry: %w", err)
+		}
+		ops[i] = kvOp{Bucket: kvBucketLogs, Key: kvLogKey(covenantID, entries[i].Index), Value: data}
+	}
+	if err := s.kv.commit(ops); err != nil {
+		return err
+	}
+	last := entries[len(entries)-1]
+	s.heads[covenantID] = kvLogHead{size: last.Index + 1, head: last.Hash}
+	return nil
+}
+
+// Range returns the entries with indices in [from, to).
+func (s *KVLogStore) Range(covenantID string, from, to int64) ([]ActionLogEntry, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	if err := checkRange(from, to, s.heads[covenantID].size); err != nil {
+		return nil, err
+	}
+	result := make([]ActionLogEntry, 0, to-from)
+	for i := from; i < to; i++ {
+		e, err := s.entry(covenantID, i)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *e)
+	}
+	return result, nil
+}
+
+// entry decodes a stored entry. The caller holds the lock.
+func (s *KVLogStore) entry(covenantID string, index int64) (*ActionLogEntry, error) {
+	var e ActionLogEntry
+	if err := json.Unmarshal(s.kv.buckets[kvBucketLogs][kvLogKey(covenantID, index)], &e); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: kvLogStore: stored entry %d is corrupt: %w", index, err)
+	}
+	return &e, nil
+}
+
+// Len returns the number of entries in a covenant's log.
+func (s *KVLogStore) Len(covenantID string) (int64, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	return s.heads[covenantID].size, nil
+}
+
+// PutCheckpoint stores a checkpoint if it is at least as large as the
+// latest one stored.
+func (s *KVLogStore) PutCheckpoint(cp *LogCheckpoint) error {
+	if cp == nil {
+		return errorf(ErrCodeMissingField, "grith: kvLogStore.PutCheckpoint: checkpoint is required")
+	}
+	s.kv.mu.Lock()
+	defer s.kv.mu.Unlock()
+	err := checkStoredCheckpoint(cp, s.heads[cp.CovenantID].size, func(i int64) (string, error) {
+		e, err := s.entry(cp.CovenantID, i)
+		if err != nil {
+			return "", err
+		}
+		return e.Hash, nil
+	})
+	if err != nil {
+		return err
+	}
+	latest, err := s.checkpoint(cp.CovenantID)
+	if err != nil {
+		return err
+	}
+	if latest != nil && cp.Size < latest.Size {
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return errorf(ErrCodeSerialization, "grith: kvLogStore.PutCheckpoint: failed to serialize checkpoint: %w", err)
+	}
+	return s.kv.commit([]kvOp{{Bucket: kvBucketLogs, Key: cp.CovenantID + "/" + kvCheckpointKey, Value: data}})
+}
+
+// LatestCheckpoint returns the largest stored checkpoint.
+func (s *KVLogStore) LatestCheckpoint(covenantID string) (*LogCheckpoint, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	return s.checkpoint(covenantID)
+}
+
+// checkpoint decodes a covenant's stored checkpoint. The caller holds the
+// lock.
+func (s *KVLogStore) checkpoint(covenantID string) (*LogCheckpoint, error) {
+	data, ok := s.kv.buckets[kvBucketLogs][covenantID+"/"+kvCheckpointKey]
+	if !ok {
+		return nil, nil
+	}
+	var cp LogCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: kvLogStore: stored checkpoint is corrupt: %w", err)
+	}
+	return &cp, nil
+}
+
+// Covenants returns the IDs of the covenants with stored logs.
+func (s *KVLogStore) Covenants() ([]string, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	ids := make([]string, 0, len(s.heads))
+	for id := range s.heads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,184 @@
+package grith
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AnchoringPolicy requires every logged action to be covered by an
+// externally anchored checkpoint soon after it was taken. Without it, an
+// operator holding the agent key could regenerate a whole log, with fresh
+// checkpoints, after the fact.
+type AnchoringPolicy struct {
+	// Anchors verify the checkpoints' anchor proofs.
+	Anchors []Anchor
+	// MaxGap is the longest an entry may wait for a covering checkpoint
+	// to be anchored.
+	MaxGap time.Duration
+	// Now is the time of verification: entries logged within MaxGap of
+	// it need not be anchored yet. Defaults to the current time.
+	Now time.Time
+}
+
+// CheckpointDigest returns the hex digest an anchor stamps for cp: the
+// SHA-256 of its signed content, so cosignatures and anchors can be added
+// without changing it.
+func CheckpointDigest(cp *LogCheckpoint) (string, error) {
+	payload, err := checkpointSigningPayload(cp)
+	if err != nil {
+		return "", err
+	}
+	return SHA256Hex([]byte(payload)), nil
+}
+
+// AnchorCheckpoint stamps cp's digest with anchor and returns a copy of
+// cp with the proof attached.
+func AnchorCheckpoint(cp *LogCheckpoint, anchor Anchor) (*LogCheckpoint, error) {
+	if cp == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: checkpoint is required")
+	}
+	id, err := CheckpointDigest(cp)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := anchorDigest(id)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := anchor.Stamp(digest)
+	if err != nil {
+		return nil, err
+	}
+	out := *cp
+	out.Anchors = append(append([]AnchorProof(nil), cp.Anchors...), AnchorProof{
+		Type:   anchor.Type(),
+		Digest: id,
+		Proof:  base64.StdEncoding.EncodeToString(proof),
+	})
+	return &out, nil
+}
+
+// UpgradeCheckpointAnchors asks anchor to complete each of cp's proofs of
+// the anchor's type and returns a copy of cp with the upgraded proofs.
+func UpgradeCheckpointAnchors(cp *LogCheckpoint, anchor Anchor) (*LogCheckpoint, error) {
+	out := *cp
+	out.Anchors = append([]AnchorProof(nil), cp.Anchors...)
+	for i, ap := range out.Anchors {
+		if ap.Type != anchor.Type() {
+			continue
+		}
+		digest, proof, err := decodeAnchorProof(ap)
+		if err != nil {
+			return nil, err
+		}
+		upgraded, err := anchor.Upgrade(digest, proof)
+		if err != nil {
+			return nil, err
+		}
+		out.Anchors[i].Proof = base64.StdEncoding.EncodeToString(upgraded)
+	}
+	return &out, nil
+}
+
+// VerifyCheckpointAnchors verifies each of cp's anchor proofs with the
+// anchor of matching type and returns the resulting attestations, as
+// VerifyAnchorProofs does for covenants.
+func VerifyCheckpointAnchors(cp *LogCheckpoint, anchors ...Anchor) ([]*AnchorAttestation, error) {
+	id, err := CheckpointDigest(cp)
+	if err != nil {
+		return nil, err
+	}
+	return verifyAnchorList(id, cp.Anchors, anchors)
+}
+
+// VerifyLogAnchoring checks entries, a contiguous log segment, against
+// policy: each entry must be covered by a checkpoint from checkpoints
+// with a complete anchor attestation no more than policy.MaxGap after the
+// entry's timestamp. Entries logged within MaxGap of policy.Now are
+// exempt. Checkpoints must be validly signed and match the segment.
+func VerifyLogAnchoring(entries []ActionLogEntry, checkpoints []LogCheckpoint, policy *AnchoringPolicy) error {
+	if policy == nil || policy.MaxGap <= 0 {
+		return errorf(ErrCodeInvalidInput, "grith: anchoring policy requires a positive maximum gap")
+	}
+	now := policy.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	type anchored struct {
+		size int64
+		at   time.Time
+	}
+	var anchoredCps []anchored
+	for i := range checkpoints {
+		cp := &checkpoints[i]
+		if err := VerifyLogCheckpoint(cp); err != nil {
+			return err
+		}
+		if err := checkpointCoversSegment(cp, entries); err != nil {
+			return err
+		}
+		atts, err := VerifyCheckpointAnchors(cp, policy.Anchors...)
+		if err != nil {
+			return err
+		}
+		var earliest time.Time
+		for _, att := range atts {
+			if att.Complete && (earliest.IsZero() || att.Time.Before(earliest)) {
+				earliest = att.Time
+			}
+		}
+		if !earliest.IsZero() {
+			anchoredCps = append(anchoredCps, anchored{cp.Size, earliest})
+		}
+	}
+
+	// An entry is anchored at the earliest anchor time of any checkpoint
+	// that covers it, i.e. the minimum over checkpoints larger than its
+	// index.
+	sort.Slice(anchoredCps, func(i, j int) bool { return anchoredCps[i].size < anchoredCps[j].size })
+	for i := len(anchoredCps) - 2; i >= 0; i-- {
+		if anchoredCps[i+1].at.Before(anchoredCps[i].at) {
+			anchoredCps[i].at = anchoredCps[i+1].at
+		}
+	}
+	next := 0
+	for _, e := range entries {
+		for next < len(anchoredCps) && anchoredCps[next].size <= e.Index {
+			next++
+		}
+		logged, err := parseTimestamp(e.Timestamp)
+		if err != nil {
+			return errorf(ErrCodeActionLog, "grith: log entry %d has an invalid timestamp", e.Index)
+		}
+		if next == len(anchoredCps) {
+			if now.Sub(logged) > policy.MaxGap {
+				return errorf(ErrCodeAnchor, "grith: log entry %d has gone unanchored for more than %s", e.Index, policy.MaxGap)
+			}
+			continue
+		}
+		if gap := anchoredCps[next].at.Sub(logged); gap > policy.MaxGap {
+			return errorf(ErrCodeAnchor, "grith: log entry %d was anchored %s after it was logged, more than %s", e.Index, gap.Round(time.Second), policy.MaxGap)
+		}
+	}
+	return nil
+}
+
+// bundleAnchoringCheck applies an anchoring policy to a bundle, exempting
+// entries logged within the maximum gap of export.
+func bundleAnchoringCheck(b *AccountabilityBundle, policy *AnchoringPolicy) VerificationCheck {
+	check := VerificationCheck{Name: "anchoring", Code: CheckBundleAnchoring}
+	p := *policy
+	if p.Now.IsZero() {
+		p.Now, _ = parseTimestamp(b.ExportedAt)
+	}
+	if err := VerifyLogAnchoring(b.Entries, b.Checkpoints, &p); err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("Every log entry was anchored within %s", policy.MaxGap)
+	return check
+}
@@ -0,0 +1,81 @@
+package grith
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+)
+
+var installedLogger atomic.Pointer[slog.Logger]
+
+// SetLogger installs l to receive the package's structured diagnostics;
+// nil, the default, silences them. They are:
+//
+//   - Debug: failed covenant builds, with the error code and, for invalid
+//     CCL, the line and column of the syntax error
+//   - Warn: failed verification checks, enforcement violations, failed
+//     webhook deliveries, and background store maintenance failures
+//   - Error: enforcement checks that failed or could not be logged,
+//     kill switch suspensions, and failed background passes of expiry
+//     monitors, expiry collectors, and policy agents
+//
+// Failures returned to the caller are logged at Debug, since the caller
+// sees them; failures that would otherwise go unreported are logged at
+// Warn or Error.
+func SetLogger(l *slog.Logger) {
+	installedLogger.Store(l)
+}
+
+// currentLogger returns the installed logger, or nil.
+func currentLogger() *slog.Logger {
+	return installedLogger.Load()
+}
+
+// logEvent logs msg at level with attrs, if a logger is installed.
+func logEvent(level slog.Level, msg string, attrs ...interface{}) {
+	if l := currentLogger(); l != nil {
+		l.Log(context.Background(), level, msg, attrs...)
+	}
+}
+
+// logError logs a non-nil err at level with msg, attrs, and the error's
+// message, code, and CCL syntax error position.
+func logError(level slog.Level, msg string, err error, attrs ...interface{}) {
+	l := currentLogger()
+	if l == nil || err == nil {
+		return
+	}
+	attrs = append(attrs, slog.String("error", err.Error()))
+	if code := CodeOf(err); code != "" {
+		attrs = append(attrs, slog.String("code", string(code)))
+	}
+	var syntax *CCLSyntaxError
+	if errors.As(err, &syntax) {
+		attrs = append(attrs, slog.Int("line", syntax.Line), slog.Int("column", syntax.Column))
+	}
+	l.Log(context.Background(), level, msg, attrs...)
+}
+
+// logCheckFailures logs the failed checks of a covenant verification.
+func logCheckFailures(doc *CovenantDocument, checks []VerificationCheck) {
+	l := currentLogger()
+	if l == nil {
+		return
+	}
+	for _, c := range checks {
+		if c.Passed {
+			continue
+		}
+		severity := c.Severity
+		if severity == "" {
+			severity = SeverityFatal
+		}
+		l.Warn("verification check failed",
+			slog.String("covenant_id", doc.ID),
+			slog.String("check", c.Name),
+			slog.String("code", string(c.Code)),
+			slog.String("severity", string(severity)),
+			slog.String("message", c.Message))
+	}
+}
@@ -0,0 +1,146 @@
+package grith
+
+import "time"
+
+// queryChunk is how many entries QueryActionLog reads from a store at a
+// time.
+const queryChunk = 1024
+
+// LogQuery selects entries of a covenant's action log. Empty fields match
+// everything.
+type LogQuery struct {
+	CovenantID string
+	// Action is a CCL action pattern, matched with MatchAction.
+	Action string
+	// Resource is a CCL resource pattern, matched with MatchResource.
+	Resource string
+	Outcome  ActionOutcome
+	// Since and Until bound entry timestamps: Since is inclusive, Until
+	// exclusive.
+	Since time.Time
+	Until time.Time
+	// Limit caps the number of matches returned; zero means no limit.
+	Limit int
+}
+
+// LogQueryMatch is an entry matching a query, with the proof that it is
+// in the log committed to by the result's checkpoint. Proof is nil for
+// entries appended after that checkpoint.
+type LogQueryMatch struct {
+	Entry ActionLogEntry     `json:"entry"`
+	Proof *LogInclusionProof `json:"proof,omitempty"`
+}
+
+// LogQueryResult is the outcome of QueryActionLog.
+type LogQueryResult struct {
+	// Checkpoint is the store's latest checkpoint for the covenant, which
+	// the matches' proofs are against, or nil if none is stored.
+	Checkpoint *LogCheckpoint  `json:"checkpoint,omitempty"`
+	Matches    []LogQueryMatch `json:"matches"`
+	Scanned    int64           `json:"scanned"`
+	// Truncated is set when the limit was reached with matches left out
+	// or entries left unscanned.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// QueryActionLog returns the entries of a stored log matching q, each
+// with an inclusion proof against the store's latest checkpoint. An
+// auditor checks a match with VerifyActionLogSegment (for the entry's
+// signature) and VerifyMerkleInclusion or VerifyReceiptInclusion (for its
+// place in the checkpointed log), without fetching the rest of the log.
+func QueryActionLog(store LogStore, q *LogQuery) (*LogQueryResult, error) {
+	if store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: log store is required")
+	}
+	if q == nil || q.CovenantID == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: query requires a covenant ID")
+	}
+	switch q.Outcome {
+	case "", OutcomeExecuted, OutcomeDenied, OutcomeImpossible:
+	default:
+		return nil, errorf(ErrCodeInvalidInput, "grith: unknown action outcome %q", q.Outcome)
+	}
+	size, err := store.Len(q.CovenantID)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := store.LatestCheckpoint(q.CovenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LogQueryResult{Checkpoint: cp, Matches: []LogQueryMatch{}}
+	// Proofs need every leaf up to the checkpoint, so the scan covers at
+	// least that much even once the limit is reached.
+	var leaves [][]byte
+	var proofSize int64
+	if cp != nil {
+		proofSize = cp.Size
+	}
+	for from := int64(0); from < size; from += queryChunk {
+		full := q.Limit > 0 && len(result.Matches) >= q.Limit
+		if full && from >= proofSize {
+			result.Truncated = true
+			break
+		}
+		to := from + queryChunk
+		if to > size {
+			to = size
+		}
+		entries, err := store.Range(q.CovenantID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Index < proofSize {
+				leaves = append(leaves, merkleLeaf([]byte(e.Hash)))
+			}
+			result.Scanned++
+			if !q.matches(&e) {
+				continue
+			}
+			if q.Limit > 0 && len(result.Matches) >= q.Limit {
+				result.Truncated = true
+				continue
+			}
+			result.Matches = append(result.Matches, LogQueryMatch{Entry: e})
+		}
+	}
+
+	for i := range result.Matches {
+		m := &result.Matches[i]
+		if m.Entry.Index >= proofSize {
+			continue
+		}
+		m.Proof = &LogInclusionProof{
+			CovenantID: q.CovenantID,
+			Index:      m.Entry.Index,
+			Size:       proofSize,
+			Hashes:     encodeMerkleHashes(merklePath(int(m.Entry.Index), leaves)),
+		}
+	}
+	return result, nil
+}
+
+func (q *LogQuery) matches(e *ActionLogEntry) bool {
+	if q.Action != "" && !MatchAction(q.Action, e.Action) {
+		return false
+	}
+	if q.Resource != "" && !MatchResource(q.Resource, e.Resource) {
+		return false
+	}
+	if q.Outcome != "" && e.Outcome != q.Outcome {
+		return false
+	}
+	if q.Since.IsZero() && q.Until.IsZero() {
+		return true
+	}
+	at, err := parseTimestamp(e.Timestamp)
+	if err != nil {
+		return false
+	}
+	if !q.Since.IsZero() && at.Before(q.Since) {
+		return false
+	}
+	return q.Until.IsZero() || at.Before(q.Until)
+}
@@ -0,0 +1,485 @@
+package grith
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// LogStore is the interface for action log storage, shared by the
+// components that record actions and the auditors that read them. It
+// holds the logs of many covenants, keyed by covenant ID.
+//
+// A store checks that appended entries extend the stored log (indices,
+// hash chain and entry hashes) but cannot check signatures, since it does
+// not know the agents' keys. Readers should verify what they read with
+// VerifyActionLogSegment.
+type LogStore interface {
+	// Append adds entries to the end of a covenant's log. The first entry
+	// must have index Len and chain to the stored head.
+	Append(covenantID string, entries ...ActionLogEntry) error
+
+	// Range returns the entries with indices in [from, to).
+	Range(covenantID string, from, to int64) ([]ActionLogEntry, error)
+
+	// Len returns the number of entries in a covenant's log, or 0 if
+	// nothing is stored for it.
+	Len(covenantID string) (int64, error)
+
+	// PutCheckpoint stores a checkpoint over a covenant's stored log. A
+	// checkpoint of the same size as the latest replaces it, so
+	// cosignatures can be added as they arrive.
+	PutCheckpoint(cp *LogCheckpoint) error
+
+	// LatestCheckpoint returns the stored checkpoint with the largest
+	// size, or nil if there is none.
+	LatestCheckpoint(covenantID string) (*LogCheckpoint, error)
+
+	// Covenants returns the IDs of the covenants with stored logs, sorted.
+	Covenants() ([]string, error)
+}
+
+// checkLogContinuation checks that entries extend a log of the given size
+// and head hash.
+func checkLogContinuation(covenantID string, size int64, head string, entries []ActionLogEntry) error {
+	for i := range entries {
+		e := &entries[i]
+		if e.CovenantID != covenantID {
+			return errorf(ErrCodeActionLog, "grith: log entry %d belongs to covenant %s", e.Index, shortID(e.CovenantID))
+		}
+		if e.Index != size {
+			return errorf(ErrCodeActionLog, "grith: log entry %d found where entry %d was expected", e.Index, size)
+		}
+		if e.PreviousHash != head {
+			return errorf(ErrCodeActionLog, "grith: log entry %d does not chain to entry %d", e.Index, size-1)
+		}
+		hash, err := ComputeEntryHash(e)
+		if err != nil {
+			return err
+		}
+		if hash != e.Hash {
+			return errorf(ErrCodeActionLog, "grith: log entry %d hash mismatch", e.Index)
+		}
+		size++
+		head = e.Hash
+	}
+	return nil
+}
+
+// checkRange validates a [from, to) range against a log of the given size.
+func checkRange(from, to, size int64) error {
+	if from < 0 || from > to || to > size {
+		return errorf(ErrCodeInvalidInput, "grith: range [%d, %d) out of bounds for log of size %d", from, to, size)
+	}
+	return nil
+}
+
+// checkStoredCheckpoint checks cp against a stored log of the given size,
+// where entryHash returns the hash of the entry at an index.
+func checkStoredCheckpoint(cp *LogCheckpoint, size int64, entryHash func(int64) (string, error)) error {
+	if cp.Size < 1 || cp.Size > size {
+		return errorf(ErrCodeActionLog, "grith: checkpoint at size %d is beyond the stored log of size %d", cp.Size, size)
+	}
+	hash, err := entryHash(cp.Size - 1)
+	if err != nil {
+		return err
+	}
+	if hash != cp.HeadHash {
+		return errorf(ErrCodeActionLog, "grith: checkpoint at size %d does not match the stored log", cp.Size)
+	}
+	return VerifyLogCheckpoint(cp)
+}
+
+func copyCheckpoint(cp *LogCheckpoint) *LogCheckpoint {
+	c := *cp
+	c.Cosignatures = append([]CheckpointCosignature(nil), cp.Cosignatures...)
+	c.Anchors = append([]AnchorProof(nil), cp.Anchors...)
+	return &c
+}
+
+// ----------------------------------------------------------------------------
+// In-memory store
+// ----------------------------------------------------------------------------
+
+// MemoryLogStore is an in-memory LogStore. It is safe for concurrent use.
+type MemoryLogStore struct {
+	mu          sync.RWMutex
+	logs        map[string][]ActionLogEntry
+	checkpoints map[string]*LogCheckpoint
+}
+
+// NewMemoryLogStore creates a new, empty MemoryLogStore.
+func NewMemoryLogStore() *MemoryLogStore {
+	return &MemoryLogStore{
+		logs:        make(map[string][]ActionLogEntry),
+		checkpoints: make(map[string]*LogCheckpoint),
+	}
+}
+
+// Append adds entries to the end of a covenant's log.
+func (s *MemoryLogStore) Append(covenantID string, entries ...ActionLogEntry) error {
+	if covenantID == "" {
+		return errorf(ErrCodeInvalidInput, "grith: logstore.Append: covenant ID must be a non-empty string")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log := s.logs[covenantID]
+	head := ActionLogGenesisHash
+	if n := len(log); n > 0 {
+		head = log[n-1].Hash
+	}
+	if err := checkLogContinuation(covenantID, int64(len(log)), head, entries); err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		s.logs[covenantID] = append(log, entries...)
+	}
+	return nil
+}
+
+// Range returns a copy of the entries with indices in [from, to).
+func (s *MemoryLogStore) Range(covenantID string, from, to int64) ([]ActionLogEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	log := s.logs[covenantID]
+	if err := checkRange(from, to, int64(len(log))); err != nil {
+		return nil, err
+	}
+	return append([]ActionLogEntry{}, log[from:to]...), nil
+}
+
+// Len returns the number of entries in a covenant's log.
+func (s *MemoryLogStore) Len(covenantID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.logs[covenantID])), nil
+}
+
+// PutCheckpoint stores a checkpoint if it is at least as large as the
+// latest one stored.
+func (s *MemoryLogStore) PutCheckpoint(cp *LogCheckpoint) error {
+	if cp == nil {
+		return errorf(ErrCodeMissingField, "grith: logstore.PutCheckpoint: checkpoint is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log := s.logs[cp.CovenantID]
+	err := checkStoredCheckpoint(cp, int64(len(log)), func(i int64) (string, error) {
+		return log[i].Hash, nil
+	})
+	if err != nil {
+		return err
+	}
+	if latest := s.checkpoints[cp.CovenantID]; latest == nil || cp.Size >= latest.Size {
+		s.checkpoints[cp.CovenantID] = copyCheckpoint(cp)
+	}
+	return nil
+}
+
+// LatestCheckpoint returns a copy of the largest stored checkpoint.
+func (s *MemoryLogStore) LatestCheckpoint(covenantID string) (*LogCheckpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cp, ok := s.checkpoints[covenantID]
+	if !ok {
+		return nil, nil
+	}
+	return copyCheckpoint(cp), nil
+}
+
+// Covenants returns the IDs of the covenants with stored logs.
+func (s *MemoryLogStore) Covenants() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.logs))
+	for id := range s.logs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ----------------------------------------------------------------------------
+// File store
+// ----------------------------------------------------------------------------
+
+// FileLogStore is a LogStore keeping each covenant's log in a
+// subdirectory named after the covenant ID, in the same segment format as
+// FileLog. Every append is synced before it returns. It is safe for
+// concurrent use within a single process.
+type FileLogStore struct {
+	mu          sync.Mutex
+	dir         string
+	segmentSize int64
+	logs        map[string]*storedLog
+}
+
+// storedLog caches the tail of a covenant's log in a FileLogStore.
+type storedLog struct {
+	size      int64
+	head      string
+	lastFirst int64 // first index of the last segment
+	lastBytes int64 // size of the last segment
+}
+
+// NewFileLogStore opens (creating if necessary) a file log store in dir.
+func NewFileLogStore(dir string) (*FileLogStore, error) {
+	if dir == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: file log store requires a directory")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to create log store directory: %w", err)
+	}
+	return &FileLogStore{dir: dir, segmentSize: DefaultSegmentSize, logs: make(map[string]*storedLog)}, nil
+}
+
+// covenantDir returns the directory of a covenant's log. Covenant IDs are
+// hex, which also keeps them from escaping the store directory.
+func (s *FileLogStore) covenantDir(covenantID string) (string, error) {
+	if b, err := FromHex(covenantID); err != nil || len(b) == 0 || ToHex(b) != covenantID {
+		return "", errorf(ErrCodeInvalidInput, "grith: invalid covenant ID %q", covenantID)
+	}
+	return filepath.Join(s.dir, covenantID), nil
+}
+
+// state loads and caches a covenant's log, truncating a torn tail.
+func (s *FileLogStore) state(covenantID string) (*storedLog, string, error) {
+	dir, err := s.covenantDir(covenantID)
+	if err != nil {
+		return nil, "", err
+	}
+	if st, ok := s.logs[covenantID]; ok {
+		return st, dir, nil
+	}
+	st := &storedLog{head: ActionLogGenesisHash}
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	for i, first := range segments {
+		if first != st.size {
+			return nil, "", errorf(ErrCodeActionLog, "grith: log segment starting at %d follows %d entries", first, st.size)
+		}
+		path := segmentPath(dir, first)
+		last := i == len(segments)-1
+		torn, err := scanSegment(path, last, func(e *ActionLogEntry) error {
+			if err := checkLogContinuation(covenantID, st.size, st.head, []ActionLogEntry{*e}); err != nil {
+				return err
+			}
+			st.size++
+			st.head = e.Hash
+			return nil
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		if torn >= 0 {
+			if err := os.Truncate(path, torn); err != nil {
+				return nil, "", errorf(ErrCodeStorage, "grith: failed to truncate torn log tail: %w", err)
+			}
+		}
+		if last {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, "", errorf(ErrCodeStorage, "grith: failed to stat log segment: %w", err)
+			}
+			st.lastFirst, st.lastBytes = first, info.Size()
+		}
+	}
+	s.logs[covenantID] = st
+	return st, dir, nil
+}
+
+// Append adds entries to the end of a covenant's log and syncs them.
+func (s *FileLogStore) Append(covenantID string, entries ...ActionLogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, dir, err := s.state(covenantID)
+	if err != nil {
+		return err
+	}
+	if err := checkLogContinuation(covenantID, st.size, st.head, entries); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to create log directory: %w", err)
+	}
+
+	// After a failed write the segment's state is unknown, so the cached
+	// tail is dropped; the next access reloads and repairs it.
+	next := *st
+	var f *os.File
+	closeFile := func() error {
+		if f == nil {
+			return nil
+		}
+		err := f.Sync()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		f = nil
+		if err != nil {
+			return errorf(ErrCodeStorage, "grith: failed to sync log segment: %w", err)
+		}
+		return nil
+	}
+	for i := range entries {
+		line, err := json.Marshal(&entries[i])
+		if err != nil {
+			closeFile()
+			return errorf(ErrCodeSerialization, "grith: failed to encode log entry: %w", err)
+		}
+		line = append(line, '\n')
+		if next.lastBytes > 0 && next.lastBytes+int64(len(line)) > s.segmentSize {
+			if err := closeFile(); err != nil {
+				delete(s.logs, covenantID)
+				return err
+			}
+			next.lastFirst, next.lastBytes = entries[i].Index, 0
+		}
+		if f == nil {
+			if f, err = os.OpenFile(segmentPath(dir, next.lastFirst), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+				delete(s.logs, covenantID)
+				return errorf(ErrCodeStorage, "grith: failed to open log segment: %w", err)
+			}
+			if next.lastBytes == 0 {
+				syncDir(dir)
+			}
+		}
+		if _, err := f.Write(line); err != nil {
+			closeFile()
+			delete(s.logs, covenantID)
+			return errorf(ErrCodeStorage, "grith: failed to append log entry: %w", err)
+		}
+		next.lastBytes += int64(len(line))
+		next.size++
+		next.head = entries[i].Hash
+	}
+	if err := closeFile(); err != nil {
+		delete(s.logs, covenantID)
+		return err
+	}
+	*st = next
+	return nil
+}
+
+// Range returns the entries with indices in [from, to).
+func (s *FileLogStore) Range(covenantID string, from, to int64) ([]ActionLogEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rangeLocked(covenantID, from, to)
+}
+
+func (s *FileLogStore) rangeLocked(covenantID string, from, to int64) ([]ActionLogEntry, error) {
+	st, dir, err := s.state(covenantID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRange(from, to, st.size); err != nil {
+		return nil, err
+	}
+	out := []ActionLogEntry{}
+	if from == to {
+		return out, nil
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, first := range segments {
+		if first >= to {
+			break
+		}
+		if i+1 < len(segments) && segments[i+1] <= from {
+			continue
+		}
+		_, err := scanSegment(segmentPath(dir, first), true, func(e *ActionLogEntry) error {
+			if e.Index >= from && e.Index < to {
+				out = append(out, *e)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if int64(len(out)) != to-from {
+		return nil, errorf(ErrCodeActionLog, "grith: log store is missing entries in [%d, %d)", from, to)
+	}
+	return out, nil
+}
+
+// Len returns the number of entries in a covenant's log.
+func (s *FileLogStore) Len(covenantID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, _, err := s.state(covenantID)
+	if err != nil {
+		return 0, err
+	}
+	return st.size, nil
+}
+
+// PutCheckpoint durably stores a checkpoint beside the covenant's log.
+func (s *FileLogStore) PutCheckpoint(cp *LogCheckpoint) error {
+	if cp == nil {
+		return errorf(ErrCodeMissingField, "grith: logstore.PutCheckpoint: checkpoint is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, dir, err := s.state(cp.CovenantID)
+	if err != nil {
+		return err
+	}
+	err = checkStoredCheckpoint(cp, st.size, func(i int64) (string, error) {
+		entries, err := s.rangeLocked(cp.CovenantID, i, i+1)
+		if err != nil {
+			return "", err
+		}
+		return entries[0].Hash, nil
+	})
+	if err != nil {
+		return err
+	}
+	return appendCheckpoint(dir, cp)
+}
+
+// LatestCheckpoint returns the largest stored checkpoint.
+func (s *FileLogStore) LatestCheckpoint(covenantID string) (*LogCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir, err := s.covenantDir(covenantID)
+	if err != nil {
+		return nil, err
+	}
+	cps, err := readCheckpoints(dir)
+	if err != nil || len(cps) == 0 {
+		return nil, err
+	}
+	return &cps[len(cps)-1], nil
+}
+
+// Covenants returns the IDs of the covenants with stored logs.
+func (s *FileLogStore) Covenants() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dirents, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to list log store: %w", err)
+	}
+	ids := []string{}
+	for _, d := range dirents {
+		if !d.IsDir() {
+			continue
+		}
+		if _, err := s.covenantDir(d.Name()); err == nil {
+			ids = append(ids, d.Name())
+		}
+	}
+	return ids, nil
+}
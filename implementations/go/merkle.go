@@ -0,0 +1,259 @@
+package grith
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Merkle trees follow RFC 6962 / RFC 9162: leaves are hashed as
+// SHA-256(0x00 || data) and interior nodes as SHA-256(0x01 || left || right),
+// so a leaf can never be confused with an interior node. All hashes are
+// exchanged as lowercase hex strings.
+
+// MerkleLeafHash returns the hex-encoded RFC 6962 leaf hash of data.
+func MerkleLeafHash(data []byte) string {
+	return hex.EncodeToString(merkleLeaf(data))
+}
+
+// MerkleRoot computes the root of the tree over the given hex leaf hashes.
+// The root of an empty tree is the SHA-256 of the empty string.
+func MerkleRoot(leafHashes []string) (string, error) {
+	leaves, err := decodeMerkleHashes(leafHashes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(merkleTreeHash(leaves)), nil
+}
+
+// MerkleInclusionProof returns the audit path for the leaf at index in the
+// tree over leafHashes.
+func MerkleInclusionProof(leafHashes []string, index int) ([]string, error) {
+	if index < 0 || index >= len(leafHashes) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: leaf index %d out of range for tree of size %d", index, len(leafHashes))
+	}
+	leaves, err := decodeMerkleHashes(leafHashes)
+	if err != nil {
+		return nil, err
+	}
+	return encodeMerkleHashes(merklePath(index, leaves)), nil
+}
+
+// MerkleConsistencyProof returns the proof that the tree of the first size
+// leaves is a prefix of the tree over all of leafHashes.
+func MerkleConsistencyProof(leafHashes []string, size int) ([]string, error) {
+	if size < 1 || size > len(leafHashes) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: consistency proof size %d out of range for tree of size %d", size, len(leafHashes))
+	}
+	leaves, err := decodeMerkleHashes(leafHashes)
+	if err != nil {
+		return nil, err
+	}
+	return encodeMerkleHashes(merkleSubproof(size, leaves, true)), nil
+}
+
+// VerifyMerkleInclusion reports whether proof shows that leafHash is the
+// leaf at index in a tree of the given size with the given root.
+func VerifyMerkleInclusion(leafHash string, index, size int64, proof []string, root string) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	r, err := hex.DecodeString(leafHash)
+	if err != nil {
+		return false
+	}
+	want, err := hex.DecodeString(root)
+	if err != nil {
+		return false
+	}
+	path, err := decodeMerkleHashes(proof)
+	if err != nil {
+		return false
+	}
+
+	fn, sn := index, size-1
+	for _, p := range path {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNode(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNode(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(r, want)
+}
+
+// VerifyMerkleConsistency reports whether proof shows that the tree of
+// size1 with root1 is a prefix of the tree of size2 with root2.
+func VerifyMerkleConsistency(size1, size2 int64, root1, root2 string, proof []string) bool {
+	if size1 < 1 || size1 > size2 {
+		return false
+	}
+	first, err1 := hex.DecodeString(root1)
+	second, err2 := hex.DecodeString(root2)
+	path, err3 := decodeMerkleHashes(proof)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return false
+	}
+	if size1 == size2 {
+		return len(path) == 0 && bytes.Equal(first, second)
+	}
+
+	// When the first tree is a complete subtree its root is implied
+	if size1&(size1-1) == 0 {
+		path = append([][]byte{first}, path...)
+	}
+	if len(path) == 0 {
+		return false
+	}
+
+	fn, sn := size1-1, size2-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := path[0], path[0]
+	for _, c := range path[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = merkleNode(c, fr)
+			sr = merkleNode(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = merkleNode(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(fr, first) && bytes.Equal(sr, second)
+}
+
+func merkleLeaf(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func merkleNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleSplit returns the largest power of two strictly less than n.
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func merkleTreeHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leaves[0]
+	}
+	k := merkleSplit(len(leaves))
+	return merkleNode(merkleTreeHash(leaves[:k]), merkleTreeHash(leaves[k:]))
+}
+
+// merklePath implements PATH(m, D[n]) from RFC 6962 section 2.1.1.
+func merklePath(m int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := merkleSplit(len(leaves))
+	if m < k {
+		return append(merklePath(m, leaves[:k]), merkleTreeHash(leaves[k:]))
+	}
+	return append(merklePath(m-k, leaves[k:]), merkleTreeHash(leaves[:k]))
+}
+
+// merkleSubproof implements SUBPROOF(m, D[n], b) from RFC 6962 section 2.1.2.
+func merkleSubproof(m int, leaves [][]byte, complete bool) [][]byte {
+	n := len(leaves)
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{merkleTreeHash(leaves)}
+	}
+	k := merkleSplit(n)
+	if m <= k {
+		return append(merkleSubproof(m, leaves[:k], complete), merkleTreeHash(leaves[k:]))
+	}
+	return append(merkleSubproof(m-k, leaves[k:], false), merkleTreeHash(leaves[:k]))
+}
+
+// merkleAccumulator computes the root of a tree whose leaves arrive one
+// at a time, keeping only the roots of its complete subtrees: O(log n)
+// memory for n leaves.
+type merkleAccumulator struct {
+	roots [][]byte // roots of complete subtrees, largest first
+	sizes []int64
+}
+
+func (a *merkleAccumulator) add(leaf []byte) {
+	a.roots = append(a.roots, leaf)
+	a.sizes = append(a.sizes, 1)
+	for n := len(a.sizes); n > 1 && a.sizes[n-1] == a.sizes[n-2]; n = len(a.sizes) {
+		a.roots = append(a.roots[:n-2], merkleNode(a.roots[n-2], a.roots[n-1]))
+		a.sizes = append(a.sizes[:n-2], 2*a.sizes[n-2])
+	}
+}
+
+// root returns the tree hash of the leaves added so far. Folding the
+// subtree roots from the right reproduces the RFC 6962 split.
+func (a *merkleAccumulator) root() []byte {
+	if len(a.roots) == 0 {
+		return merkleTreeHash(nil)
+	}
+	acc := a.roots[len(a.roots)-1]
+	for i := len(a.roots) - 2; i >= 0; i-- {
+		acc = merkleNode(a.roots[i], acc)
+	}
+	return acc
+}
+
+func decodeMerkleHashes(hashes []string) ([][]byte, error) {
+	out := make([][]byte, len(hashes))
+	for i, h := range hashes {
+		if !isHexDigest(h) {
+			return nil, errorf(ErrCodeInvalidHex, "grith: merkle hash %d is not a 64-char hex SHA-256 digest", i)
+		}
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, errorf(ErrCodeInvalidHex, "grith: invalid merkle hash %d: %w", i, err)
+		}
+		out[i] = b
+	}
+	return out, nil
+}
+
+func encodeMerkleHashes(hashes [][]byte) []string {
+	out := make([]string, len(hashes))
+	for i, h := range hashes {
+		out[i] = hex.EncodeToString(h)
+	}
+	return out
+}
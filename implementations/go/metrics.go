@@ -0,0 +1,258 @@
+package grith
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Evaluation outcomes, as reported to Metrics.ObserveEvaluation.
+const (
+	EvaluationPermitted = "permitted"
+	EvaluationDenied    = "denied"
+	EvaluationError     = "error"
+)
+
+// Metrics receives observations from the instrumented parts of the
+// package once installed with SetMetrics. Collector implements it with
+// Prometheus text exposition; integrators using a metrics library, such
+// as the Prometheus client, implement it to feed their own collectors.
+// Methods are called synchronously on hot paths and must be cheap and
+// safe for concurrent use.
+type Metrics interface {
+	// ObserveEvaluation records a CCL evaluation, including each
+	// covenant of an Enforcer's chain, with its outcome: one of
+	// EvaluationPermitted, EvaluationDenied, or EvaluationError.
+	ObserveEvaluation(outcome string, elapsed time.Duration)
+	// ObserveCheckFailure records a failed covenant verification check.
+	ObserveCheckFailure(check string)
+	// ObserveStoreOperation records an operation, named by its StoreOp
+	// constant, on a store wrapped with NewMetricsStore.
+	ObserveStoreOperation(op string, elapsed time.Duration, err error)
+	// ObserveRateLimitRejection records an action an Enforcer denied
+	// because it exceeded a limit statement.
+	ObserveRateLimitRejection(action string)
+	// ObserveLogAppend records an entry appended to an ActionLog or
+	// FileLog.
+	ObserveLogAppend()
+}
+
+// metricsHolder lets an atomic.Pointer hold a Metrics interface.
+type metricsHolder struct{ m Metrics }
+
+var installedMetrics atomic.Pointer[metricsHolder]
+
+// SetMetrics installs m to receive the package's observations; nil stops
+// them. Without metrics installed, instrumentation costs one atomic load.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		installedMetrics.Store(nil)
+		return
+	}
+	installedMetrics.Store(&metricsHolder{m: m})
+}
+
+// currentMetrics returns the installed Metrics, or nil.
+func currentMetrics() Metrics {
+	if h := installedMetrics.Load(); h != nil {
+		return h.m
+	}
+	return nil
+}
+
+// observeCheckFailures reports the failed checks of a verification.
+func observeCheckFailures(checks []VerificationCheck) {
+	m := currentMetrics()
+	if m == nil {
+		return
+	}
+	for _, c := range checks {
+		if !c.Passed {
+			m.ObserveCheckFailure(c.Name)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Collector
+// ----------------------------------------------------------------------------
+
+// collectorBuckets are the upper bounds, in seconds, of the Collector's
+// latency histograms: decades from 10µs, since CCL evaluations take
+// microseconds and store operations up to seconds.
+var collectorBuckets = []float64{0.00001, 0.0001, 0.001, 0.01, 0.1, 1, 10}
+
+// Collector is a Metrics that aggregates observations in memory and
+// serves them in the Prometheus text exposition format, so it can be
+// scraped without a metrics library:
+//
+//	grith_evaluation_duration_seconds{outcome}      histogram
+//	grith_verification_check_failures_total{check}  counter
+//	grith_store_operation_duration_seconds{op}      histogram
+//	grith_store_operation_errors_total{op}          counter
+//	grith_rate_limit_rejections_total{action}       counter
+//	grith_log_appends_total                         counter
+//
+// Histogram counts are the operation counts; rates, such as the log
+// append rate, are derived by the Prometheus server. It is safe for
+// concurrent use.
+type Collector struct {
+	mu            sync.Mutex
+	evaluations   map[string]*histogram
+	checkFailures map[string]int64
+	storeOps      map[string]*histogram
+	storeErrors   map[string]int64
+	rateLimited   map[string]int64
+	logAppends    int64
+}
+
+type histogram struct {
+	counts []int64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+}
+
+func (h *histogram) observe(elapsed time.Duration) {
+	s := elapsed.Seconds()
+	i := sort.SearchFloat64s(collectorBuckets, s)
+	h.counts[i]++
+	h.sum += s
+}
+
+// NewCollector creates an empty Collector. Install it with SetMetrics and
+// serve it on a metrics endpoint.
+func NewCollector() *Collector {
+	return &Collector{
+		evaluations:   make(map[string]*histogram),
+		checkFailures: make(map[string]int64),
+		storeOps:      make(map[string]*histogram),
+		storeErrors:   make(map[string]int64),
+		rateLimited:   make(map[string]int64),
+	}
+}
+
+func (c *Collector) histogram(m map[string]*histogram, label string) *histogram {
+	h, ok := m[label]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(collectorBuckets)+1)}
+		m[label] = h
+	}
+	return h
+}
+
+// ObserveEvaluation implements Metrics.
+func (c *Collector) ObserveEvaluation(outcome string, elapsed time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.histogram(c.evaluations, outcome).observe(elapsed)
+}
+
+// ObserveCheckFailure implements Metrics.
+func (c *Collector) ObserveCheckFailure(check string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkFailures[check]++
+}
+
+// ObserveStoreOperation implements Metrics.
+func (c *Collector) ObserveStoreOperation(op string, elapsed time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.histogram(c.storeOps, op).observe(elapsed)
+	if err != nil {
+		c.storeErrors[op]++
+	}
+}
+
+// ObserveRateLimitRejection implements Metrics.
+func (c *Collector) ObserveRateLimitRejection(action string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rateLimited[action]++
+}
+
+// ObserveLogAppend implements Metrics.
+func (c *Collector) ObserveLogAppend() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logAppends++
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition
+// format, with label values in sorted order.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	c.mu.Lock()
+	writeHistograms(bw, "grith_evaluation_duration_seconds", "Latency of CCL evaluations by outcome.", "outcome", c.evaluations)
+	writeCounters(bw, "grith_verification_check_failures_total", "Failed covenant verification checks by check name.", "check", c.checkFailures)
+	writeHistograms(bw, "grith_store_operation_duration_seconds", "Latency of store operations by operation.", "op", c.storeOps)
+	writeCounters(bw, "grith_store_operation_errors_total", "Failed store operations by operation.", "op", c.storeErrors)
+	writeCounters(bw, "grith_rate_limit_rejections_total", "Actions denied by a limit statement by action.", "action", c.rateLimited)
+	fmt.Fprintf(bw, "# HELP grith_log_appends_total Entries appended to action logs.\n# TYPE grith_log_appends_total counter\ngrith_log_appends_total %d\n", c.logAppends)
+	c.mu.Unlock()
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics for scraping.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func writeCounters(w io.Writer, name, help, label string, counters map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, value := range sortedKeys(counters) {
+		fmt.Fprintf(w, "%s{%s=%s} %d\n", name, label, quoteLabel(value), counters[value])
+	}
+}
+
+func writeHistograms(w io.Writer, name, help, label string, histograms map[string]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, value := range sortedKeys(histograms) {
+		h, l := histograms[value], label+"="+quoteLabel(value)
+		var cumulative int64
+		for i, bound := range collectorBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", name, l, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		cumulative += h.counts[len(collectorBuckets)]
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, cumulative)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, l, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, l, cumulative)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelEscaper escapes a label value for the text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,174 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"fmt"
+)
+
+// ModelAttestationVerifier checks an identity's ModelAttestation against
+// what its provider has published, so that AttestationHash and
+// AttestationType are more than caller-supplied text.
+type ModelAttestationVerifier interface {
+	// Provider names the model provider, matched against
+	// ModelAttestation.Provider to select the verifier.
+	Provider() string
+	// Verify checks the attestation's hash and type for its model.
+	Verify(model ModelAttestation) error
+}
+
+// Common ModelAttestation.AttestationType values.
+const (
+	// ModelAttestationWeights is the SHA-256 hash of the model weights.
+	ModelAttestationWeights = "weights_sha256"
+	// ModelAttestationModelCard is the SHA-256 hash of a signed model card.
+	ModelAttestationModelCard = "model_card_sha256"
+)
+
+// ModelManifest is a provider-published list of the attestations of its
+// models, signed with the provider's Ed25519 key.
+type ModelManifest struct {
+	Provider  string               `json:"provider"`
+	PublicKey string               `json:"publicKey"`
+	Models    []ModelManifestEntry `json:"models"`
+	IssuedAt  string               `json:"issuedAt"`
+	Signature string               `json:"signature,omitempty"`
+}
+
+// ModelManifestEntry is the published attestation of one model version.
+// An empty ModelVersion matches attestations that name no version.
+type ModelManifestEntry struct {
+	ModelID         string `json:"modelId"`
+	ModelVersion    string `json:"modelVersion,omitempty"`
+	AttestationType string `json:"attestationType"`
+	AttestationHash string `json:"attestationHash"`
+}
+
+// SignModelManifest signs a copy of manifest with the provider's key,
+// setting PublicKey and, if empty, IssuedAt.
+func SignModelManifest(manifest *ModelManifest, kp *KeyPair) (*ModelManifest, error) {
+	if manifest == nil || manifest.Provider == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: model manifest with a provider is required")
+	}
+	if kp == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: provider key pair is required")
+	}
+	for _, e := range manifest.Models {
+		if e.ModelID == "" || e.AttestationType == "" || e.AttestationHash == "" {
+			return nil, errorf(ErrCodeMissingField, "grith: model manifest entries require modelId, attestationType, and attestationHash")
+		}
+	}
+	signed := *manifest
+	signed.Models = append([]ModelManifestEntry(nil), manifest.Models...)
+	signed.PublicKey = kp.PublicKeyHex
+	if signed.IssuedAt == "" {
+		signed.IssuedAt = Timestamp()
+	}
+	payload, err := signedPayload(&signed)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := Sign(payload, kp.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign model manifest: %w", err)
+	}
+	signed.Signature = ToHex(sig)
+	return &signed, nil
+}
+
+// VerifyModelManifest verifies manifest's signature under its PublicKey.
+func VerifyModelManifest(manifest *ModelManifest) error {
+	if manifest == nil {
+		return errorf(ErrCodeMissingField, "grith: model manifest is required")
+	}
+	pub, err := FromHex(manifest.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errorf(ErrCodeInvalidInput, "grith: model manifest public key is not a hex Ed25519 key")
+	}
+	sig, err := FromHex(manifest.Signature)
+	if err != nil {
+		return errorf(ErrCodeInvalidInput, "grith: model manifest signature is not hex")
+	}
+	payload, err := signedPayload(manifest)
+	if err != nil {
+		return err
+	}
+	if !Verify(payload, sig, ed25519.PublicKey(pub)) {
+		return errorf(ErrCodeCrypto, "grith: model manifest signature is invalid")
+	}
+	return nil
+}
+
+// ManifestModelVerifier is a ModelAttestationVerifier backed by a
+// provider's signed ModelManifest.
+type ManifestModelVerifier struct {
+	manifest ModelManifest
+}
+
+// NewManifestModelVerifier verifies manifest and that it is signed by
+// the provider's trusted hex public key.
+func NewManifestModelVerifier(manifest *ModelManifest, trustedKey string) (*ManifestModelVerifier, error) {
+	if err := VerifyModelManifest(manifest); err != nil {
+		return nil, err
+	}
+	if manifest.PublicKey != trustedKey {
+		return nil, errorf(ErrCodeInvalidInput, "grith: model manifest for %s is not signed by the trusted key", manifest.Provider)
+	}
+	m := *manifest
+	m.Models = append([]ModelManifestEntry(nil), manifest.Models...)
+	return &ManifestModelVerifier{manifest: m}, nil
+}
+
+// Provider returns the manifest's provider.
+func (v *ManifestModelVerifier) Provider() string { return v.manifest.Provider }
+
+// Verify requires the manifest to publish model's ID and version with
+// its attestation type and hash.
+func (v *ManifestModelVerifier) Verify(model ModelAttestation) error {
+	if model.AttestationHash == "" || model.AttestationType == "" {
+		return errorf(ErrCodeMissingField, "grith: model %s has no attestation", model.ModelID)
+	}
+	found := false
+	for _, e := range v.manifest.Models {
+		if e.ModelID != model.ModelID || e.ModelVersion != model.ModelVersion {
+			continue
+		}
+		found = true
+		if e.AttestationType == model.AttestationType && e.AttestationHash == model.AttestationHash {
+			return nil
+		}
+	}
+	if !found {
+		return errorf(ErrCodeInvalidInput, "grith: %s does not publish model %s", v.manifest.Provider, modelName(model))
+	}
+	return errorf(ErrCodeInvalidInput, "grith: %s attestation of model %s does not match the published manifest", model.AttestationType, modelName(model))
+}
+
+func modelName(model ModelAttestation) string {
+	if model.ModelVersion == "" {
+		return model.ModelID
+	}
+	return model.ModelID + "@" + model.ModelVersion
+}
+
+func modelAttestationCheck(identity *AgentIdentity, verifiers []ModelAttestationVerifier) VerificationCheck {
+	check := VerificationCheck{Name: "model_attestation", Code: CheckModelAttestation}
+	model := identity.Model
+	var verifier ModelAttestationVerifier
+	for _, v := range verifiers {
+		if v.Provider() == model.Provider {
+			verifier = v
+			break
+		}
+	}
+	if verifier == nil {
+		check.Message = fmt.Sprintf("No model attestation verifier for provider %q", model.Provider)
+		return check
+	}
+	if err := verifier.Verify(model); err != nil {
+		check.Message = fmt.Sprintf("Model attestation is invalid: %v", err)
+		return check
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("Model %s is attested by %s", modelName(model), model.Provider)
+	return check
+}
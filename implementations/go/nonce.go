@@ -0,0 +1,167 @@
+package grith
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// NonceRegistry records the nonces each issuer has used so that a nonce
+// re-used across different documents can be detected.
+type NonceRegistry interface {
+	// Record notes that issuer used nonce in the document with the given
+	// ID. It returns the ID of the first document seen with that issuer
+	// and nonce, and whether that differs from documentID (a replay).
+	Record(issuerPublicKey, nonce, documentID string) (firstID string, replayed bool, err error)
+
+	// Lookup returns the ID of the document in which issuer first used
+	// nonce, if any.
+	Lookup(issuerPublicKey, nonce string) (documentID string, ok bool, err error)
+}
+
+// nonceKey identifies a nonce within an issuer's namespace.
+type nonceKey struct {
+	issuer string
+	nonce  string
+}
+
+// MemoryNonceRegistry is an in-memory NonceRegistry. It is safe for
+// concurrent use.
+type MemoryNonceRegistry struct {
+	mu   sync.Mutex
+	seen map[nonceKey]string
+}
+
+// NewMemoryNonceRegistry creates a new, empty MemoryNonceRegistry.
+func NewMemoryNonceRegistry() *MemoryNonceRegistry {
+	return &MemoryNonceRegistry{
+		seen: make(map[nonceKey]string),
+	}
+}
+
+// Record records a nonce. See NonceRegistry.
+func (r *MemoryNonceRegistry) Record(issuerPublicKey, nonce, documentID string) (string, bool, error) {
+	if issuerPublicKey == "" || nonce == "" || documentID == "" {
+		return "", false, errorf(ErrCodeInvalidInput, "grith: nonceRegistry.Record: issuer, nonce, and document ID are required")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := nonceKey{issuer: issuerPublicKey, nonce: nonce}
+	if first, ok := r.seen[key]; ok {
+		return first, first != documentID, nil
+	}
+	r.seen[key] = documentID
+	return documentID, false, nil
+}
+
+// Lookup looks up a nonce. See NonceRegistry.
+func (r *MemoryNonceRegistry) Lookup(issuerPublicKey, nonce string) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.seen[nonceKey{issuer: issuerPublicKey, nonce: nonce}]
+	return id, ok, nil
+}
+
+// Count returns the number of recorded nonces.
+func (r *MemoryNonceRegistry) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.seen)
+}
+
+// nonceRecord is a single line of a FileNonceRegistry journal.
+type nonceRecord struct {
+	Issuer     string `json:"issuer"`
+	Nonce      string `json:"nonce"`
+	DocumentID string `json:"documentId"`
+}
+
+// FileNonceRegistry is a NonceRegistry persisted to an append-only JSON
+// Lines journal. The journal is replayed into memory on open and every
+// newly seen nonce is appended and synced before Record returns. It is
+// safe for concurrent use within a single process.
+type FileNonceRegistry struct {
+	mem  *MemoryNonceRegistry
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenFileNonceRegistry opens (creating if necessary) a nonce journal at
+// path. A torn final line left by a crash is skipped and terminated.
+func OpenFileNonceRegistry(path string) (*FileNonceRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errorf(ErrCodeStorage, "grith: failed to read nonce registry: %w", err)
+	}
+
+	mem := NewMemoryNonceRegistry()
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		var rec nonceRecord
+		if len(line) == 0 || json.Unmarshal(line, &rec) != nil {
+			continue
+		}
+		_, _, _ = mem.Record(rec.Issuer, rec.Nonce, rec.DocumentID)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to open nonce registry: %w", err)
+	}
+	// Terminate a torn final line so the next record starts cleanly
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		if _, err := f.Write([]byte{'\n'}); err != nil {
+			f.Close()
+			return nil, errorf(ErrCodeStorage, "grith: failed to repair nonce registry: %w", err)
+		}
+	}
+
+	return &FileNonceRegistry{mem: mem, file: f}, nil
+}
+
+// Record records a nonce, appending it to the journal if it is new.
+// See NonceRegistry.
+func (r *FileNonceRegistry) Record(issuerPublicKey, nonce, documentID string) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return "", false, errorf(ErrCodeStorage, "grith: nonce registry is closed")
+	}
+
+	if issuerPublicKey == "" || nonce == "" || documentID == "" {
+		return "", false, errorf(ErrCodeInvalidInput, "grith: nonceRegistry.Record: issuer, nonce, and document ID are required")
+	}
+	if first, ok, _ := r.mem.Lookup(issuerPublicKey, nonce); ok {
+		return first, first != documentID, nil
+	}
+
+	// Persist before updating memory so a failed write is retried
+	line, err := json.Marshal(nonceRecord{Issuer: issuerPublicKey, Nonce: nonce, DocumentID: documentID})
+	if err != nil {
+		return "", false, errorf(ErrCodeSerialization, "grith: failed to encode nonce record: %w", err)
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return "", false, errorf(ErrCodeStorage, "grith: failed to append nonce record: %w", err)
+	}
+	if err := r.file.Sync(); err != nil {
+		return "", false, errorf(ErrCodeStorage, "grith: failed to sync nonce registry: %w", err)
+	}
+	return r.mem.Record(issuerPublicKey, nonce, documentID)
+}
+
+// Lookup looks up a nonce. See NonceRegistry.
+func (r *FileNonceRegistry) Lookup(issuerPublicKey, nonce string) (string, bool, error) {
+	return r.mem.Lookup(issuerPublicKey, nonce)
+}
+
+// Close closes the underlying journal file.
+func (r *FileNonceRegistry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
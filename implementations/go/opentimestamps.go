@@ -0,0 +1,610 @@
+package grith
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultOpenTimestampsCalendars are the public calendar servers used when
+// OpenTimestampsOptions.Calendars is empty.
+var DefaultOpenTimestampsCalendars = []string{
+	"https://alice.btc.calendar.opentimestamps.org",
+	"https://bob.btc.calendar.opentimestamps.org",
+	"https://finney.calendar.eternitywall.com",
+}
+
+// BitcoinHeaderSource looks up Bitcoin block headers for verifying
+// OpenTimestamps attestations, typically backed by a full node or a
+// trusted block explorer.
+type BitcoinHeaderSource interface {
+	// BlockMerkleRoot returns the merkle root of the block at height, in
+	// the byte order it appears in the serialized header, and the block
+	// time.
+	BlockMerkleRoot(height uint64) ([]byte, time.Time, error)
+}
+
+// OpenTimestampsOptions configure an OpenTimestamps anchor.
+type OpenTimestampsOptions struct {
+	// Calendars are the calendar server URLs to submit to. Pending proofs
+	// are only upgraded from these calendars. Defaults to
+	// DefaultOpenTimestampsCalendars.
+	Calendars []string
+	// MinCalendars is how many calendars must accept a submission.
+	// Defaults to 1.
+	MinCalendars int
+	// HTTPClient is used for calendar requests. Defaults to a client with
+	// a 30 second timeout.
+	HTTPClient *http.Client
+	// Headers verifies Bitcoin attestations. Without it, attested proofs
+	// are reported as incomplete.
+	Headers BitcoinHeaderSource
+}
+
+// OpenTimestamps is an Anchor backed by OpenTimestamps calendar servers.
+// Proofs are standard detached .ots files, so they can also be checked
+// with the reference `ots verify` tool against the covenant's canonical
+// form.
+type OpenTimestamps struct {
+	opts OpenTimestampsOptions
+}
+
+// NewOpenTimestamps creates an OpenTimestamps anchor.
+func NewOpenTimestamps(opts *OpenTimestampsOptions) (*OpenTimestamps, error) {
+	var o OpenTimestampsOptions
+	if opts != nil {
+		o = *opts
+	}
+	if len(o.Calendars) == 0 {
+		o.Calendars = DefaultOpenTimestampsCalendars
+	}
+	o.Calendars = append([]string(nil), o.Calendars...)
+	for i, c := range o.Calendars {
+		if !strings.HasPrefix(c, "https://") && !strings.HasPrefix(c, "http://") {
+			return nil, errorf(ErrCodeInvalidInput, "grith: invalid calendar URL: %q", c)
+		}
+		o.Calendars[i] = strings.TrimRight(c, "/")
+	}
+	if o.MinCalendars <= 0 {
+		o.MinCalendars = 1
+	}
+	if o.MinCalendars > len(o.Calendars) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: MinCalendars %d exceeds the %d configured calendars", o.MinCalendars, len(o.Calendars))
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &OpenTimestamps{opts: o}, nil
+}
+
+// Type returns "opentimestamps".
+func (o *OpenTimestamps) Type() string {
+	return "opentimestamps"
+}
+
+// Stamp submits digest to the configured calendars and returns a pending
+// .ots proof. A random nonce is appended before submission so calendars
+// learn nothing about the digest.
+func (o *OpenTimestamps) Stamp(digest []byte) ([]byte, error) {
+	if len(digest) != sha256.Size {
+		return nil, errorf(ErrCodeInvalidInput, "grith: digest must be %d bytes", sha256.Size)
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to generate nonce: %w", err)
+	}
+
+	root := &otsTimestamp{msg: digest}
+	appended, err := root.add(otsOp{tag: otsOpAppend, arg: nonce})
+	if err != nil {
+		return nil, err
+	}
+	commitment, err := appended.add(otsOp{tag: otsOpSHA256})
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := 0
+	var lastErr error
+	for _, cal := range o.opts.Calendars {
+		stamp, err := o.fetch(http.MethodPost, cal+"/digest", commitment.msg, commitment.msg)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if stamp == nil {
+			lastErr = fmt.Errorf("%s: no timestamp returned", cal)
+			continue
+		}
+		commitment.merge(stamp)
+		accepted++
+	}
+	if accepted < o.opts.MinCalendars {
+		return nil, errorf(ErrCodeAnchor, "grith: only %d of %d required calendars accepted the digest: %v", accepted, o.opts.MinCalendars, lastErr)
+	}
+	return encodeOTSFile(root), nil
+}
+
+// Upgrade fetches completed attestations for any pending calendar
+// attestations in proof. Only configured calendars are contacted.
+func (o *OpenTimestamps) Upgrade(digest, proof []byte) ([]byte, error) {
+	root, err := decodeOTSFile(digest, proof)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]bool, len(o.opts.Calendars))
+	for _, c := range o.opts.Calendars {
+		allowed[c] = true
+	}
+
+	for _, p := range root.pending() {
+		uri := strings.TrimRight(p.uri, "/")
+		if !allowed[uri] {
+			continue
+		}
+		stamp, err := o.fetch(http.MethodGet, uri+"/timestamp/"+hex.EncodeToString(p.node.msg), nil, p.node.msg)
+		if err != nil || stamp == nil {
+			// Still pending, or the calendar is unavailable
+			continue
+		}
+		p.node.merge(stamp)
+	}
+	return encodeOTSFile(root), nil
+}
+
+// Verify checks an .ots proof for digest. Bitcoin attestations are
+// checked against the configured header source; the earliest verified
+// block time is reported.
+func (o *OpenTimestamps) Verify(digest, proof []byte) (*AnchorAttestation, error) {
+	root, err := decodeOTSFile(digest, proof)
+	if err != nil {
+		return nil, err
+	}
+
+	att := &AnchorAttestation{Type: o.Type()}
+	var pending, unchecked []string
+	for _, a := range root.allAttestations() {
+		switch {
+		case bytes.Equal(a.att.tag[:], otsTagPending):
+			uri, _ := a.att.pendingURI()
+			pending = append(pending, uri)
+		case bytes.Equal(a.att.tag[:], otsTagBitcoin):
+			height, err := a.att.bitcoinHeight()
+			if err != nil {
+				return nil, err
+			}
+			if o.opts.Headers == nil {
+				unchecked = append(unchecked, fmt.Sprintf("bitcoin block %d", height))
+				continue
+			}
+			merkleRoot, blockTime, err := o.opts.Headers.BlockMerkleRoot(height)
+			if err != nil {
+				return nil, errorf(ErrCodeAnchor, "grith: failed to fetch bitcoin block %d: %w", height, err)
+			}
+			if !bytes.Equal(a.msg, merkleRoot) {
+				return nil, errorf(ErrCodeAnchor, "grith: attestation does not match merkle root of bitcoin block %d", height)
+			}
+			if !att.Complete || blockTime.Before(att.Time) {
+				att.Complete = true
+				att.Time = blockTime
+				att.Detail = fmt.Sprintf("bitcoin block %d", height)
+			}
+		}
+	}
+
+	if !att.Complete {
+		switch {
+		case len(unchecked) > 0:
+			att.Detail = "unverified (no header source): " + strings.Join(unchecked, ", ")
+		case len(pending) > 0:
+			att.Detail = "pending at " + strings.Join(pending, ", ")
+		default:
+			att.Detail = "no attestations"
+		}
+	}
+	return att, nil
+}
+
+// fetch performs a calendar request and decodes the returned timestamp
+// for msg. It returns nil, nil if the calendar has no timestamp yet.
+func (o *OpenTimestamps) fetch(method, url string, body, msg []byte) (*otsTimestamp, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.opentimestamps.v1")
+	req.Header.Set("User-Agent", "grith-go")
+	resp, err := o.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, otsMaxResponse))
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(bytes.NewReader(data))
+	stamp, err := decodeOTSTimestamp(br, msg, otsMaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errorf(ErrCodeAnchor, "grith: trailing data in calendar response")
+	}
+	return stamp, nil
+}
+
+// ----------------------------------------------------------------------------
+// OpenTimestamps serialization
+// ----------------------------------------------------------------------------
+
+const (
+	otsHeaderMagic    = "\x00OpenTimestamps\x00\x00Proof\x00\xbf\x89\xe2\xe8\x84\xe8\x92\x94"
+	otsMajorVersion   = 1
+	otsMaxDepth       = 256
+	otsMaxMsgLength   = 4096
+	otsMaxPayload     = 8192
+	otsMaxResponse    = 10000
+	otsOpSHA1         = 0x02
+	otsOpRIPEMD160    = 0x03
+	otsOpSHA256       = 0x08
+	otsOpKeccak256    = 0x67
+	otsOpAppend       = 0xf0
+	otsOpPrepend      = 0xf1
+	otsOpReverse      = 0xf2
+	otsOpHexlify      = 0xf3
+	otsTagAttestation = 0x00
+	otsTagFork        = 0xff
+)
+
+var (
+	otsTagPending = []byte{0x83, 0xdf, 0xe3, 0x0d, 0x2e, 0xf9, 0x0c, 0x8e}
+	otsTagBitcoin = []byte{0x05, 0x88, 0x96, 0x0d, 0x73, 0xd7, 0x19, 0x01}
+)
+
+// otsOp is a commitment operation.
+type otsOp struct {
+	tag byte
+	arg []byte
+}
+
+func (op otsOp) binary() bool {
+	return op.tag == otsOpAppend || op.tag == otsOpPrepend
+}
+
+func (op otsOp) apply(msg []byte) ([]byte, error) {
+	var out []byte
+	switch op.tag {
+	case otsOpAppend:
+		out = append(append([]byte(nil), msg...), op.arg...)
+	case otsOpPrepend:
+		out = append(append([]byte(nil), op.arg...), msg...)
+	case otsOpSHA256:
+		sum := sha256.Sum256(msg)
+		out = sum[:]
+	case otsOpSHA1:
+		sum := sha1.Sum(msg)
+		out = sum[:]
+	case otsOpReverse:
+		out = make([]byte, len(msg))
+		for i := range msg {
+			out[i] = msg[len(msg)-1-i]
+		}
+	case otsOpHexlify:
+		out = []byte(hex.EncodeToString(msg))
+	case otsOpRIPEMD160, otsOpKeccak256:
+		return nil, errorf(ErrCodeAnchor, "grith: unsupported OpenTimestamps operation 0x%02x", op.tag)
+	default:
+		return nil, errorf(ErrCodeAnchor, "grith: unknown OpenTimestamps operation 0x%02x", op.tag)
+	}
+	if len(out) > otsMaxMsgLength {
+		return nil, errorf(ErrCodeAnchor, "grith: OpenTimestamps message exceeds %d bytes", otsMaxMsgLength)
+	}
+	return out, nil
+}
+
+// otsAttestation is a raw attestation: an 8-byte type tag and payload.
+type otsAttestation struct {
+	tag     [8]byte
+	payload []byte
+}
+
+func (a otsAttestation) pendingURI() (string, error) {
+	r := bufio.NewReader(bytes.NewReader(a.payload))
+	uri, err := readOTSVarbytes(r, 1000)
+	if err != nil {
+		return "", err
+	}
+	return string(uri), nil
+}
+
+func (a otsAttestation) bitcoinHeight() (uint64, error) {
+	return readOTSVaruint(bufio.NewReader(bytes.NewReader(a.payload)))
+}
+
+// otsTimestamp is a node in an OpenTimestamps commitment tree: a message,
+// the attestations on it, and the operations deriving child messages.
+type otsTimestamp struct {
+	msg          []byte
+	attestations []otsAttestation
+	ops          []otsBranch
+}
+
+type otsBranch struct {
+	op    otsOp
+	stamp *otsTimestamp
+}
+
+// add appends an operation, returning the child node.
+func (t *otsTimestamp) add(op otsOp) (*otsTimestamp, error) {
+	for _, b := range t.ops {
+		if b.op.tag == op.tag && bytes.Equal(b.op.arg, op.arg) {
+			return b.stamp, nil
+		}
+	}
+	msg, err := op.apply(t.msg)
+	if err != nil {
+		return nil, err
+	}
+	child := &otsTimestamp{msg: msg}
+	t.ops = append(t.ops, otsBranch{op: op, stamp: child})
+	return child, nil
+}
+
+// merge folds other, a timestamp for the same message, into t.
+func (t *otsTimestamp) merge(other *otsTimestamp) {
+	for _, a := range other.attestations {
+		dup := false
+		for _, existing := range t.attestations {
+			if existing.tag == a.tag && bytes.Equal(existing.payload, a.payload) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			t.attestations = append(t.attestations, a)
+		}
+	}
+	for _, b := range other.ops {
+		merged := false
+		for _, existing := range t.ops {
+			if existing.op.tag == b.op.tag && bytes.Equal(existing.op.arg, b.op.arg) {
+				existing.stamp.merge(b.stamp)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			t.ops = append(t.ops, b)
+		}
+	}
+}
+
+type otsMsgAttestation struct {
+	msg []byte
+	att otsAttestation
+}
+
+func (t *otsTimestamp) allAttestations() []otsMsgAttestation {
+	var out []otsMsgAttestation
+	for _, a := range t.attestations {
+		out = append(out, otsMsgAttestation{msg: t.msg, att: a})
+	}
+	for _, b := range t.ops {
+		out = append(out, b.stamp.allAttestations()...)
+	}
+	return out
+}
+
+type otsPending struct {
+	node *otsTimestamp
+	uri  string
+}
+
+func (t *otsTimestamp) pending() []otsPending {
+	var out []otsPending
+	for _, a := range t.attestations {
+		if bytes.Equal(a.tag[:], otsTagPending) {
+			if uri, err := a.pendingURI(); err == nil {
+				out = append(out, otsPending{node: t, uri: uri})
+			}
+		}
+	}
+	for _, b := range t.ops {
+		out = append(out, b.stamp.pending()...)
+	}
+	return out
+}
+
+func (t *otsTimestamp) encode(w *bytes.Buffer) {
+	n := len(t.attestations) + len(t.ops)
+	i := 0
+	for _, a := range t.attestations {
+		i++
+		if i < n {
+			w.WriteByte(otsTagFork)
+		}
+		w.WriteByte(otsTagAttestation)
+		w.Write(a.tag[:])
+		writeOTSVarbytes(w, a.payload)
+	}
+	for _, b := range t.ops {
+		i++
+		if i < n {
+			w.WriteByte(otsTagFork)
+		}
+		w.WriteByte(b.op.tag)
+		if b.op.binary() {
+			writeOTSVarbytes(w, b.op.arg)
+		}
+		b.stamp.encode(w)
+	}
+}
+
+func decodeOTSTimestamp(r *bufio.Reader, msg []byte, depth int) (*otsTimestamp, error) {
+	if depth <= 0 {
+		return nil, errorf(ErrCodeAnchor, "grith: OpenTimestamps proof is nested too deeply")
+	}
+	t := &otsTimestamp{msg: msg}
+
+	decodeItem := func(tag byte) error {
+		if tag == otsTagAttestation {
+			var a otsAttestation
+			if _, err := io.ReadFull(r, a.tag[:]); err != nil {
+				return errorf(ErrCodeAnchor, "grith: truncated OpenTimestamps attestation")
+			}
+			payload, err := readOTSVarbytes(r, otsMaxPayload)
+			if err != nil {
+				return err
+			}
+			a.payload = payload
+			t.attestations = append(t.attestations, a)
+			return nil
+		}
+		op := otsOp{tag: tag}
+		if op.binary() {
+			arg, err := readOTSVarbytes(r, otsMaxMsgLength)
+			if err != nil {
+				return err
+			}
+			if len(arg) == 0 {
+				return errorf(ErrCodeAnchor, "grith: empty OpenTimestamps operation argument")
+			}
+			op.arg = arg
+		}
+		result, err := op.apply(msg)
+		if err != nil {
+			return err
+		}
+		child, err := decodeOTSTimestamp(r, result, depth-1)
+		if err != nil {
+			return err
+		}
+		t.ops = append(t.ops, otsBranch{op: op, stamp: child})
+		return nil
+	}
+
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, errorf(ErrCodeAnchor, "grith: truncated OpenTimestamps proof")
+	}
+	for tag == otsTagFork {
+		next, err := r.ReadByte()
+		if err != nil {
+			return nil, errorf(ErrCodeAnchor, "grith: truncated OpenTimestamps proof")
+		}
+		if err := decodeItem(next); err != nil {
+			return nil, err
+		}
+		if tag, err = r.ReadByte(); err != nil {
+			return nil, errorf(ErrCodeAnchor, "grith: truncated OpenTimestamps proof")
+		}
+	}
+	if err := decodeItem(tag); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// encodeOTSFile serializes a detached timestamp for a SHA-256 digest.
+func encodeOTSFile(root *otsTimestamp) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(otsHeaderMagic)
+	writeOTSVaruint(&buf, otsMajorVersion)
+	buf.WriteByte(otsOpSHA256)
+	buf.Write(root.msg)
+	root.encode(&buf)
+	return buf.Bytes()
+}
+
+// decodeOTSFile parses a detached timestamp and checks it is for digest.
+func decodeOTSFile(digest, data []byte) (*otsTimestamp, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	magic := make([]byte, len(otsHeaderMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != otsHeaderMagic {
+		return nil, errorf(ErrCodeAnchor, "grith: not an OpenTimestamps proof")
+	}
+	version, err := readOTSVaruint(r)
+	if err != nil || version != otsMajorVersion {
+		return nil, errorf(ErrCodeAnchor, "grith: unsupported OpenTimestamps proof version")
+	}
+	if op, err := r.ReadByte(); err != nil || op != otsOpSHA256 {
+		return nil, errorf(ErrCodeAnchor, "grith: OpenTimestamps proof is not for a SHA-256 digest")
+	}
+	fileDigest := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, fileDigest); err != nil {
+		return nil, errorf(ErrCodeAnchor, "grith: truncated OpenTimestamps proof")
+	}
+	if !bytes.Equal(fileDigest, digest) {
+		return nil, errorf(ErrCodeAnchor, "grith: OpenTimestamps proof is for a different digest")
+	}
+	root, err := decodeOTSTimestamp(r, fileDigest, otsMaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return nil, errorf(ErrCodeAnchor, "grith: trailing data in OpenTimestamps proof")
+	}
+	return root, nil
+}
+
+func readOTSVaruint(r *bufio.Reader) (uint64, error) {
+	var value uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, errorf(ErrCodeAnchor, "grith: truncated OpenTimestamps varuint")
+		}
+		value |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, errorf(ErrCodeAnchor, "grith: OpenTimestamps varuint overflows")
+}
+
+func readOTSVarbytes(r *bufio.Reader, max int) ([]byte, error) {
+	n, err := readOTSVaruint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(max) {
+		return nil, errorf(ErrCodeAnchor, "grith: OpenTimestamps field of %d bytes exceeds %d", n, max)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, errorf(ErrCodeAnchor, "grith: truncated OpenTimestamps field")
+	}
+	return b, nil
+}
+
+func writeOTSVaruint(w *bytes.Buffer, v uint64) {
+	for v >= 0x80 {
+		w.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	w.WriteByte(byte(v))
+}
+
+func writeOTSVarbytes(w *bytes.Buffer, b []byte) {
+	writeOTSVaruint(w, uint64(len(b)))
+	w.Write(b)
+}
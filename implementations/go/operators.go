@@ -0,0 +1,160 @@
+package grith
+
+import "crypto/ed25519"
+
+// OperatorSet is a group of operator keys jointly controlling an
+// organizational identity: creating, evolving, and re-signing it takes
+// signatures from Threshold of the Keys. The identity's OperatorPublicKey
+// is the set's first key.
+type OperatorSet struct {
+	Keys      []string `json:"keys"`
+	Threshold int      `json:"threshold"`
+}
+
+// OperatorSignature is one operator's signature in a threshold-signed
+// identity or lineage entry.
+type OperatorSignature struct {
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+// validateOperatorSet checks that set names distinct Ed25519 keys and a
+// threshold between one and the number of keys.
+func validateOperatorSet(set *OperatorSet) error {
+	if len(set.Keys) == 0 {
+		return errorf(ErrCodeMissingField, "grith: operator set requires at least one key")
+	}
+	if set.Threshold < 1 || set.Threshold > len(set.Keys) {
+		return errorf(ErrCodeInvalidInput, "grith: operator threshold %d must be between 1 and %d", set.Threshold, len(set.Keys))
+	}
+	seen := make(map[string]bool, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := FromHex(k)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return errorf(ErrCodeInvalidInput, "grith: operator key %q is not a hex Ed25519 key", k)
+		}
+		if seen[k] {
+			return errorf(ErrCodeInvalidInput, "grith: operator key %s is listed twice", shortID(k))
+		}
+		seen[k] = true
+	}
+	return nil
+}
+
+func copyOperatorSet(set *OperatorSet) *OperatorSet {
+	if set == nil {
+		return nil
+	}
+	return &OperatorSet{Keys: append([]string(nil), set.Keys...), Threshold: set.Threshold}
+}
+
+func sameOperatorSet(a, b *OperatorSet) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Threshold != b.Threshold || len(a.Keys) != len(b.Keys) {
+		return false
+	}
+	for i := range a.Keys {
+		if a.Keys[i] != b.Keys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// signAsOperators signs payload with kp alone when set is nil, and
+// otherwise with every key pair in kp and kps that belongs to set, which
+// must reach its threshold.
+func signAsOperators(payload []byte, kp *KeyPair, kps []*KeyPair, set *OperatorSet) (string, []OperatorSignature, error) {
+	if set == nil {
+		if kp == nil {
+			return "", nil, errorf(ErrCodeMissingField, "grith: operatorKeyPair is required")
+		}
+		sig, err := Sign(payload, kp.PrivateKey)
+		if err != nil {
+			return "", nil, errorf(ErrCodeCrypto, "grith: failed to sign: %w", err)
+		}
+		return ToHex(sig), nil, nil
+	}
+
+	members := make(map[string]bool, len(set.Keys))
+	for _, k := range set.Keys {
+		members[k] = true
+	}
+	var sigs []OperatorSignature
+	for _, signer := range append([]*KeyPair{kp}, kps...) {
+		if signer == nil || !members[signer.PublicKeyHex] {
+			continue
+		}
+		members[signer.PublicKeyHex] = false
+		sig, err := Sign(payload, signer.PrivateKey)
+		if err != nil {
+			return "", nil, errorf(ErrCodeCrypto, "grith: failed to sign: %w", err)
+		}
+		sigs = append(sigs, OperatorSignature{PublicKey: signer.PublicKeyHex, Signature: ToHex(sig)})
+	}
+	if len(sigs) < set.Threshold {
+		return "", nil, errorf(ErrCodeInvalidInput, "grith: %s of the operator set's %d required", plural(len(sigs), "signature", "signatures"), set.Threshold)
+	}
+	return "", sigs, nil
+}
+
+// verifyOperatorSignatures reports whether sigs include valid signatures
+// over payload from at least set.Threshold distinct keys of set.
+func verifyOperatorSignatures(payload []byte, sigs []OperatorSignature, set *OperatorSet) bool {
+	members := make(map[string]bool, len(set.Keys))
+	for _, k := range set.Keys {
+		members[k] = true
+	}
+	valid := 0
+	for _, s := range sigs {
+		if !members[s.PublicKey] {
+			continue
+		}
+		pub, err := FromHex(s.PublicKey)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			continue
+		}
+		sig, err := FromHex(s.Signature)
+		if err != nil || !Verify(payload, sig, ed25519.PublicKey(pub)) {
+			continue
+		}
+		members[s.PublicKey] = false
+		valid++
+	}
+	return valid >= set.Threshold
+}
+
+// verifyOperatorLineage checks the operator sets recorded in identity's
+// lineage. An entry that introduces a set must be signed by a threshold
+// of it if it creates the identity, or of the previous set if there was
+// one; every later entry must be signed by a threshold of the set in
+// force. The last set recorded must be the identity's current set. A
+// compacted lineage starts from the set its summary records.
+func verifyOperatorLineage(identity *AgentIdentity) bool {
+	var current *OperatorSet
+	if s := identity.Lineage[0].Summary; s != nil {
+		current = s.Operators
+	}
+	for i := range identity.Lineage {
+		entry := &identity.Lineage[i]
+		signers := current
+		if signers == nil && i == 0 {
+			signers = entry.Operators
+		}
+		if entry.Operators != nil && validateOperatorSet(entry.Operators) != nil {
+			return false
+		}
+		if signers != nil {
+			payload, err := lineageSigningPayload(entry)
+			if err != nil || !verifyOperatorSignatures([]byte(payload), entry.Signatures, signers) {
+				return false
+			}
+		}
+		if entry.Operators != nil {
+			current = entry.Operators
+		}
+	}
+	return sameOperatorSet(current, identity.Operators)
+}
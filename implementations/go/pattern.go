@@ -0,0 +1,143 @@
+package grith
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// PatternKind selects the syntax of a pattern compiled by CompilePattern.
+type PatternKind int
+
+const (
+	// ActionPattern is a dot-separated action pattern, as matched by
+	// MatchAction.
+	ActionPattern PatternKind = iota
+	// ResourcePattern is a slash-separated resource pattern, as matched
+	// by MatchResource.
+	ResourcePattern
+)
+
+// maxCachedPatterns bounds the cache of compiled patterns. Patterns come
+// from policies, so a working set beyond it is unusual; past it, patterns
+// are compiled on each use rather than cached.
+const maxCachedPatterns = 8192
+
+// Pattern is a compiled action or resource pattern. Compiling splits the
+// pattern into segments once, so matching it against many targets does
+// not. A Pattern is immutable and safe for concurrent use.
+type Pattern struct {
+	source   string
+	kind     PatternKind
+	sep      byte
+	norm     string   // the pattern with resource slashes trimmed
+	segments []string // norm split on sep
+	spec     int
+}
+
+// CompilePattern compiles pattern for matching actions or resources.
+// Compiled patterns are cached, so compiling the same pattern again is
+// cheap; MatchAction and MatchResource use the same cache.
+func CompilePattern(pattern string, kind PatternKind) (*Pattern, error) {
+	if kind != ActionPattern && kind != ResourcePattern {
+		return nil, errorf(ErrCodeInvalidInput, "grith: unknown pattern kind %d", kind)
+	}
+	return cachedPattern(pattern, kind), nil
+}
+
+// String returns the pattern as written.
+func (p *Pattern) String() string {
+	return p.source
+}
+
+// Kind returns the kind the pattern was compiled as.
+func (p *Pattern) Kind() PatternKind {
+	return p.kind
+}
+
+// Match reports whether target matches the pattern, with the semantics
+// of MatchAction or MatchResource according to its kind.
+func (p *Pattern) Match(target string) bool {
+	return p.match(target, nil)
+}
+
+// match implements Match, charging its work against b if it is not nil.
+func (p *Pattern) match(target string, b *evalBudget) bool {
+	if p.kind == ResourcePattern {
+		target = strings.Trim(target, "/")
+		switch {
+		case p.norm == "" && target == "":
+			return true
+		case p.norm == "**":
+			return true
+		case p.norm == "*" && !strings.Contains(target, "/"):
+			return true
+		}
+	}
+	// Short targets are split into a stack buffer.
+	var buf [16]string
+	return matchSegments(p.segments, 0, splitSegments(buf[:0], target, p.sep), 0, b, 0)
+}
+
+// splitSegments appends the sep-separated segments of s to dst, as
+// strings.Split would return them.
+func splitSegments(dst []string, s string, sep byte) []string {
+	for {
+		i := strings.IndexByte(s, sep)
+		if i < 0 {
+			return append(dst, s)
+		}
+		dst = append(dst, s[:i])
+		s = s[i+1:]
+	}
+}
+
+func compilePattern(pattern string, kind PatternKind) *Pattern {
+	p := &Pattern{source: pattern, kind: kind, sep: '.', norm: pattern}
+	if kind == ResourcePattern {
+		p.sep = '/'
+		p.norm = strings.Trim(pattern, "/")
+	}
+	p.segments = splitSegments(nil, p.norm, p.sep)
+	// An empty resource pattern scores nothing; an empty action pattern
+	// is a literal segment.
+	if kind == ActionPattern || p.norm != "" {
+		for _, seg := range p.segments {
+			switch seg {
+			case "**":
+			case "*":
+				p.spec++
+			default:
+				p.spec += 2
+			}
+		}
+	}
+	return p
+}
+
+type patternKey struct {
+	kind    PatternKind
+	pattern string
+}
+
+var (
+	patternCache       sync.Map // patternKey -> *Pattern
+	patternCacheLength atomic.Int64
+)
+
+// cachedPattern returns the compiled pattern, from the cache if it is
+// there.
+func cachedPattern(pattern string, kind PatternKind) *Pattern {
+	key := patternKey{kind, pattern}
+	if p, ok := patternCache.Load(key); ok {
+		return p.(*Pattern)
+	}
+	p := compilePattern(pattern, kind)
+	if patternCacheLength.Load() < maxCachedPatterns {
+		if cached, loaded := patternCache.LoadOrStore(key, p); loaded {
+			return cached.(*Pattern)
+		}
+		patternCacheLength.Add(1)
+	}
+	return p
+}
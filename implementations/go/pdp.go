@@ -0,0 +1,263 @@
+package grith
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// PDP endpoint names, as passed to PDPHandlerOptions.Authorize.
+const (
+	PDPDecide = "decide"
+	PDPVerify = "verify"
+)
+
+// PDPDecideRequest is the body of a POST to /v1/decide.
+type PDPDecideRequest struct {
+	CovenantID string                 `json:"covenantId"`
+	Action     string                 `json:"action"`
+	Resource   string                 `json:"resource"`
+	Context    map[string]interface{} `json:"context,omitempty"`
+}
+
+// PDPDecision is the response to a /v1/decide request.
+type PDPDecision struct {
+	Permitted bool   `json:"permitted"`
+	Reason    string `json:"reason"`
+	// DecidedBy is the covenant that denied the action, or the requested
+	// covenant if it was permitted.
+	DecidedBy string `json:"decidedBy"`
+	// Rule is the deciding CCL statement, if any.
+	Rule        string          `json:"rule,omitempty"`
+	RateLimit   *PDPRateLimit   `json:"rateLimit,omitempty"`
+	Obligations []PDPObligation `json:"obligations,omitempty"`
+	// LogIndex is the index of the action's log entry, if the covenant's
+	// enforcer keeps a log.
+	LogIndex *int64 `json:"logIndex,omitempty"`
+}
+
+// PDPRateLimit reports the tightest limit an action counts against.
+type PDPRateLimit struct {
+	Exceeded  bool `json:"exceeded"`
+	Remaining int  `json:"remaining"`
+	Limit     int  `json:"limit"`
+}
+
+// PDPObligation is an obligation triggered by a decided action.
+type PDPObligation struct {
+	CovenantID string `json:"covenantId"`
+	Rule       string `json:"rule"`
+	Action     string `json:"action"`
+	Resource   string `json:"resource"`
+	// Deadline is when the obligation falls due, if it has a window.
+	Deadline string `json:"deadline,omitempty"`
+}
+
+// PDPVerifyRequest is the body of a POST to /v1/verify: either a
+// document, or the ID of a document in the handler's store.
+type PDPVerifyRequest struct {
+	Document   *CovenantDocument `json:"document,omitempty"`
+	CovenantID string            `json:"covenantId,omitempty"`
+}
+
+// PDPHandlerOptions configure NewPDPHandler.
+type PDPHandlerOptions struct {
+	// Enforcers maps covenant IDs to the enforcers that decide for them.
+	Enforcers map[string]*Enforcer
+	// Store, if set, holds covenants without an entry in Enforcers. On
+	// first use, each gets an enforcer without an action log, whose
+	// ancestors are loaded from the store through the covenant's chain.
+	// It also holds the covenants verified by ID. Covenants are enforced
+	// as stored, so the store should only accept verified documents, as
+	// stores opened with StoreOptions.VerifyOnPut do.
+	Store Store
+	// Verify are the options /v1/verify verifies documents with.
+	Verify *VerifyOptions
+	// Authorize, if set, is called before every request with the endpoint
+	// (PDPDecide or PDPVerify) and the covenant ID, empty when verifying
+	// a document given in full. An error refuses the request with 403
+	// Forbidden.
+	Authorize func(r *http.Request, endpoint, covenantID string) error
+}
+
+// pdpHandler serves the policy decision point API.
+type pdpHandler struct {
+	opts PDPHandlerOptions
+
+	mu        sync.Mutex
+	enforcers map[string]*Enforcer
+}
+
+// NewPDPHandler returns a policy decision point, serving covenant
+// decisions over HTTP so agents in any language can enforce covenants,
+// e.g. over localhost. It serves two endpoints, both taking and returning
+// JSON:
+//
+//   - POST /v1/decide takes a PDPDecideRequest, checks the action with the
+//     covenant's Enforcer, so limits and obligations are tracked across
+//     requests, and returns a PDPDecision
+//   - POST /v1/verify takes a PDPVerifyRequest and returns the
+//     VerificationResult of the document
+//
+// Errors are returned as {"error", "code"} with a 4xx or 5xx status.
+func NewPDPHandler(opts *PDPHandlerOptions) http.Handler {
+	h := &pdpHandler{enforcers: make(map[string]*Enforcer)}
+	if opts != nil {
+		h.opts = *opts
+	}
+	for id, e := range h.opts.Enforcers {
+		h.enforcers[id] = e
+	}
+	return h
+}
+
+func (h *pdpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var handle func(w http.ResponseWriter, r *http.Request)
+	switch r.URL.Path {
+	case "/v1/decide":
+		handle = h.decide
+	case "/v1/verify":
+		handle = h.verify
+	default:
+		writeLogError(w, http.StatusNotFound, errorf(ErrCodeNotFound, "not found"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeLogError(w, http.StatusMethodNotAllowed, errorf(ErrCodeInvalidInput, "method not allowed"))
+		return
+	}
+	handle(w, r)
+}
+
+// authorize applies the Authorize hook, writing the refusal if it fails.
+func (h *pdpHandler) authorize(w http.ResponseWriter, r *http.Request, endpoint, covenantID string) bool {
+	if h.opts.Authorize == nil {
+		return true
+	}
+	if err := h.opts.Authorize(r, endpoint, covenantID); err != nil {
+		writeStoreError(w, errorf(ErrCodeUnauthorized, "%s refused: %w", endpoint, err))
+		return false
+	}
+	return true
+}
+
+// readPDPRequest decodes a request body of at most limit bytes into v.
+func readPDPRequest(w http.ResponseWriter, r *http.Request, v interface{}, limit int64) bool {
+	if err := json.NewDecoder(io.LimitReader(r.Body, limit)).Decode(v); err != nil {
+		writeStoreError(w, errorf(ErrCodeInvalidJSON, "invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func (h *pdpHandler) decide(w http.ResponseWriter, r *http.Request) {
+	var req PDPDecideRequest
+	if !readPDPRequest(w, r, &req, MaxDocumentSize) {
+		return
+	}
+	if req.CovenantID == "" || req.Action == "" {
+		writeStoreError(w, errorf(ErrCodeInvalidInput, "covenantId and action are required"))
+		return
+	}
+	if !h.authorize(w, r, PDPDecide, req.CovenantID) {
+		return
+	}
+	e, err := h.enforcer(r.Context(), req.CovenantID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	d, err := e.Check(r.Context(), req.Action, req.Resource, req.Context)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeLogResult(w)(pdpDecision(d), nil)
+}
+
+// enforcer returns the enforcer of a covenant, creating it from the store
+// on first use.
+func (h *pdpHandler) enforcer(ctx context.Context, id string) (*Enforcer, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e, ok := h.enforcers[id]; ok {
+		return e, nil
+	}
+	if h.opts.Store == nil {
+		return nil, errorf(ErrCodeNotFound, "covenant not found: %s", id)
+	}
+	doc, err := h.opts.Store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, errorf(ErrCodeNotFound, "covenant not found: %s", id)
+	}
+	ancestors, err := ResolveChain(ctx, h.opts.Store, doc)
+	if err != nil {
+		return nil, err
+	}
+	e, err := NewEnforcer(&EnforcerOptions{Covenant: doc, Ancestors: ancestors})
+	if err != nil {
+		return nil, err
+	}
+	h.enforcers[id] = e
+	return e, nil
+}
+
+// pdpDecision converts an enforcement decision to its JSON form.
+func pdpDecision(d *EnforcementDecision) *PDPDecision {
+	out := &PDPDecision{Permitted: d.Permitted, Reason: d.Reason, DecidedBy: d.CovenantID}
+	if d.MatchedRule != nil {
+		out.Rule = serializeStatement(*d.MatchedRule)
+	}
+	if d.RateLimit != nil {
+		out.RateLimit = &PDPRateLimit{Exceeded: d.RateLimit.Exceeded, Remaining: d.RateLimit.Remaining, Limit: d.RateLimit.Limit}
+	}
+	for _, ob := range d.Obligations {
+		o := PDPObligation{CovenantID: ob.CovenantID, Rule: ob.Rule, Action: ob.Action, Resource: ob.Resource}
+		if !ob.Deadline.IsZero() {
+			o.Deadline = ob.Deadline.UTC().Format("2006-01-02T15:04:05.000Z")
+		}
+		out.Obligations = append(out.Obligations, o)
+	}
+	if d.Entry != nil {
+		index := d.Entry.Index
+		out.LogIndex = &index
+	}
+	return out
+}
+
+func (h *pdpHandler) verify(w http.ResponseWriter, r *http.Request) {
+	var req PDPVerifyRequest
+	if !readPDPRequest(w, r, &req, 2*MaxDocumentSize) {
+		return
+	}
+	if (req.Document == nil) == (req.CovenantID == "") {
+		writeStoreError(w, errorf(ErrCodeInvalidInput, "exactly one of document and covenantId is required"))
+		return
+	}
+	if !h.authorize(w, r, PDPVerify, req.CovenantID) {
+		return
+	}
+	doc := req.Document
+	if doc == nil {
+		if h.opts.Store == nil {
+			writeStoreError(w, errorf(ErrCodeNotFound, "covenant not found: %s", req.CovenantID))
+			return
+		}
+		var err error
+		if doc, err = h.opts.Store.Get(req.CovenantID); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if doc == nil {
+			writeStoreError(w, errorf(ErrCodeNotFound, "covenant not found: %s", req.CovenantID))
+			return
+		}
+	}
+	result, err := VerifyCovenantWithOptions(doc, h.opts.Verify)
+	writeStoreResult(w, result, err)
+}
@@ -0,0 +1,235 @@
+package grith
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PolicyAgentOptions configure NewPolicyAgent.
+type PolicyAgentOptions struct {
+	// Path, if set, is a file holding the covenant to enforce as JSON.
+	// Operators amend the policy by replacing the file.
+	Path string
+	// Store holds the covenant's ancestors and, without Path, the
+	// covenant itself, chosen by Select. One of Path and Store is
+	// required.
+	Store Store
+	// Select chooses the covenant to enforce from the documents in Store.
+	// Defaults to the most recently created one.
+	Select func(docs []*CovenantDocument) *CovenantDocument
+	// Verify are the options candidate covenants and their ancestors must
+	// verify with.
+	Verify *VerifyOptions
+	// Enforcer configures each Enforcer the agent creates; its Covenant,
+	// Ancestors, and Log are set by the agent.
+	Enforcer EnforcerOptions
+	// Log, if set, returns the action log of each newly enforced covenant.
+	Log func(doc *CovenantDocument) (ActionRecorder, error)
+	// Interval is the polling interval. Defaults to five seconds.
+	Interval time.Duration
+	// OnSwap, if set, is called after each swap with the IDs of the
+	// previous covenant, empty for the first, and the new one.
+	OnSwap func(oldID, newID string)
+	// OnError, if set, is called with each failed reload. The active
+	// policy is kept.
+	OnError func(err error)
+}
+
+// PolicyAgent is an embedded policy agent: it enforces the covenant in a
+// file or Store and, when it is amended, verifies the new covenant and
+// atomically swaps in an Enforcer for it, without restarting the agent.
+// Checks in flight complete under the policy they started with. Rate
+// limit windows and pending obligations belong to a covenant and start
+// afresh with each new one, but a kill switch suspension carries over
+// until Enforcer.Reset lifts it. It is safe for concurrent use.
+type PolicyAgent struct {
+	opts   PolicyAgentOptions
+	active atomic.Pointer[Enforcer]
+
+	mu   sync.Mutex // serializes reloads and guards stop and done
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewPolicyAgent creates a PolicyAgent and loads its initial policy,
+// failing if there is no valid covenant to enforce. The agent does not
+// poll until Start is called; Reload may be used to run a single pass.
+func NewPolicyAgent(opts *PolicyAgentOptions) (*PolicyAgent, error) {
+	if opts == nil || opts.Path == "" && opts.Store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: policy agent requires a path or a store")
+	}
+	a := &PolicyAgent{opts: *opts}
+	if a.opts.Interval <= 0 {
+		a.opts.Interval = 5 * time.Second
+	}
+	if a.opts.Select == nil {
+		a.opts.Select = newestCovenant
+	}
+	if _, err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// newestCovenant returns the most recently created document, breaking
+// ties by ID.
+func newestCovenant(docs []*CovenantDocument) *CovenantDocument {
+	var newest *CovenantDocument
+	for _, doc := range docs {
+		if newest == nil || doc.CreatedAt > newest.CreatedAt || doc.CreatedAt == newest.CreatedAt && doc.ID > newest.ID {
+			newest = doc
+		}
+	}
+	return newest
+}
+
+// Enforcer returns the active Enforcer.
+func (a *PolicyAgent) Enforcer() *Enforcer {
+	return a.active.Load()
+}
+
+// CovenantID returns the ID of the active covenant.
+func (a *PolicyAgent) CovenantID() string {
+	return a.active.Load().covenant.ID
+}
+
+// Check checks an action with the active Enforcer. See Enforcer.Check.
+func (a *PolicyAgent) Check(ctx context.Context, action, resource string, evalContext map[string]interface{}) (*EnforcementDecision, error) {
+	return a.active.Load().Check(ctx, action, resource, evalContext)
+}
+
+// Reload loads the current covenant and, if it differs from the active
+// one, verifies it and its ancestors and swaps in a new Enforcer. It
+// reports whether the policy changed. On error the active policy is kept.
+func (a *PolicyAgent) Reload() (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.reload()
+}
+
+func (a *PolicyAgent) reload() (bool, error) {
+	doc, err := a.load()
+	if err != nil {
+		return false, err
+	}
+	current := a.active.Load()
+	if current != nil && current.covenant.ID == doc.ID {
+		return false, nil
+	}
+
+	var ancestors []*CovenantDocument
+	if doc.Chain != nil {
+		if a.opts.Store == nil {
+			return false, errorf(ErrCodeInvalidChain, "grith: policy agent needs a store for the ancestors of covenant %s", shortID(doc.ID))
+		}
+		if ancestors, err = storeAncestors(a.opts.Store, doc); err != nil {
+			return false, err
+		}
+	}
+	for _, d := range append([]*CovenantDocument{doc}, ancestors...) {
+		result, err := VerifyCovenantWithOptions(d, a.opts.Verify)
+		if err != nil {
+			return false, err
+		}
+		if !result.Valid {
+			return false, errorf(ErrCodeInvalidInput, "grith: covenant %s failed verification: %s", shortID(d.ID), failedCheckNames(result.Checks))
+		}
+	}
+
+	opts := a.opts.Enforcer
+	opts.Covenant, opts.Ancestors, opts.Log = doc, ancestors, nil
+	if a.opts.Log != nil {
+		if opts.Log, err = a.opts.Log(doc); err != nil {
+			return false, err
+		}
+	}
+	e, err := NewEnforcer(&opts)
+	if err != nil {
+		return false, err
+	}
+	// The suspension is carried over again after the swap, in case a
+	// check in flight on the old enforcer tripped it in between.
+	e.inheritSuspension(current)
+	a.active.Store(e)
+	e.inheritSuspension(current)
+	if a.opts.OnSwap != nil {
+		oldID := ""
+		if current != nil {
+			oldID = current.covenant.ID
+		}
+		a.opts.OnSwap(oldID, doc.ID)
+	}
+	return true, nil
+}
+
+// load reads the covenant to enforce from the file or store.
+func (a *PolicyAgent) load() (*CovenantDocument, error) {
+	if a.opts.Path != "" {
+		data, err := os.ReadFile(a.opts.Path)
+		if err != nil {
+			return nil, errorf(ErrCodeStorage, "grith: policy agent: failed to read %s: %w", a.opts.Path, err)
+		}
+		return DeserializeCovenant(string(data))
+	}
+	docs, err := a.opts.Store.List()
+	if err != nil {
+		return nil, err
+	}
+	// Select sees the documents in a stable order.
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	doc := a.opts.Select(docs)
+	if doc == nil {
+		return nil, errorf(ErrCodeNotFound, "grith: policy agent: no covenant to enforce")
+	}
+	return doc, nil
+}
+
+// Start begins polling for amended covenants in a background goroutine.
+// Calling Start on a running agent has no effect.
+func (a *PolicyAgent) Start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stop != nil {
+		return
+	}
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go a.run(a.stop, a.done)
+}
+
+// Stop halts polling and waits for the background goroutine to exit.
+func (a *PolicyAgent) Stop() {
+	a.mu.Lock()
+	stop, done := a.stop, a.done
+	a.stop, a.done = nil, nil
+	a.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (a *PolicyAgent) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(a.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := a.Reload(); err != nil {
+				logError(slog.LevelError, "policy reload failed", err)
+				if a.opts.OnError != nil {
+					a.opts.OnError(err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PolicyBundleFormat identifies the policy bundle file format.
+const PolicyBundleFormat = "grith-policy-bundle/1"
+
+// PolicyBundle is a signed, self-contained policy set: every covenant a
+// fleet runs under, with a manifest of their IDs, roles, and chain
+// topology. Its ID is the SHA-256 of its canonical form, so a deployment
+// can pin the whole set by one hash. VerifyPolicyBundle checks it
+// offline.
+type PolicyBundle struct {
+	Format   string         `json:"format"`
+	ID       string         `json:"id"`
+	Manifest PolicyManifest `json:"manifest"`
+	// Covenants are ordered parents first, as listed in the manifest.
+	Covenants       []*CovenantDocument `json:"covenants"`
+	SignerPublicKey string              `json:"signerPublicKey"`
+	Signature       string              `json:"signature"`
+}
+
+// PolicyManifest describes the covenants of a policy bundle.
+type PolicyManifest struct {
+	Name      string                `json:"name,omitempty"`
+	Version   string                `json:"version,omitempty"`
+	CreatedAt string                `json:"createdAt"`
+	Covenants []PolicyManifestEntry `json:"covenants"`
+}
+
+// PolicyManifestEntry describes one covenant of a policy bundle. Depth is
+// zero for a root and one more than its parent's for a delegated
+// covenant.
+type PolicyManifestEntry struct {
+	ID          string `json:"id"`
+	Role        string `json:"role,omitempty"`
+	Issuer      string `json:"issuer"`
+	Beneficiary string `json:"beneficiary"`
+	ParentID    string `json:"parentId,omitempty"`
+	Depth       int    `json:"depth"`
+}
+
+// PolicyBundleOptions are the inputs to BuildPolicyBundle.
+type PolicyBundleOptions struct {
+	// Name and Version label the policy set, for example "fleet-prod"
+	// and "2026.10.1".
+	Name    string
+	Version string
+	// Covenants are the covenants of the set. The parent of every
+	// delegated covenant must be among them.
+	Covenants []*CovenantDocument
+	// Roles assigns roles, such as "root" or "build-agent", to covenants
+	// by ID.
+	Roles map[string]string
+	// Signer signs the bundle, typically with the fleet operator's key.
+	Signer *KeyPair
+}
+
+// PolicyBundleVerifyOptions configure VerifyPolicyBundle. At least one
+// of TrustedSigners and PinnedID is required: a bundle signature only
+// shows that the bundle is intact, since anyone can sign one with their
+// own key.
+type PolicyBundleVerifyOptions struct {
+	// Covenant configures verification of each bundled covenant.
+	Covenant *VerifyOptions
+	// TrustedSigners, if set, adds a trusted_signer check requiring the
+	// bundle to be signed by one of these hex public keys.
+	TrustedSigners []string
+	// PinnedID, if set, adds a pinned check requiring the bundle to have
+	// this ID.
+	PinnedID string
+}
+
+// PolicyBundleVerificationResult is the outcome of VerifyPolicyBundle.
+type PolicyBundleVerificationResult struct {
+	Valid    bool                `json:"valid"`
+	Checks   []VerificationCheck `json:"checks"`
+	Warnings []VerificationCheck `json:"warnings,omitempty"`
+	// Covenants are the full results of verifying the bundled covenants,
+	// in bundle order.
+	Covenants []*VerificationResult `json:"covenants"`
+	Bundle    *PolicyBundle         `json:"-"`
+}
+
+// BuildPolicyBundle assembles and signs a policy bundle and serializes it
+// as JSON. The covenants are checked for a consistent chain topology but
+// not verified; use VerifyPolicyBundle for that.
+func BuildPolicyBundle(opts *PolicyBundleOptions) ([]byte, error) {
+	if opts == nil || len(opts.Covenants) == 0 {
+		return nil, errorf(ErrCodeMissingField, "grith: policy bundle covenants are required")
+	}
+	kp := opts.Signer
+	if kp == nil || len(kp.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: privateKey must be %d bytes", ed25519.PrivateKeySize)
+	}
+
+	byID := make(map[string]*CovenantDocument, len(opts.Covenants))
+	for i, doc := range opts.Covenants {
+		if doc == nil || doc.ID == "" {
+			return nil, errorf(ErrCodeMissingField, "grith: policy bundle covenant %d has no ID", i)
+		}
+		if byID[doc.ID] != nil {
+			return nil, errorf(ErrCodeInvalidInput, "grith: covenant %s is in the policy bundle twice", shortID(doc.ID))
+		}
+		byID[doc.ID] = doc
+	}
+	for id := range opts.Roles {
+		if byID[id] == nil {
+			return nil, errorf(ErrCodeInvalidInput, "grith: role assigned to covenant %s, which is not in the policy bundle", shortID(id))
+		}
+	}
+	depths := make(map[string]int, len(opts.Covenants))
+	for _, doc := range opts.Covenants {
+		depth, err := policyBundleDepth(doc, byID)
+		if err != nil {
+			return nil, err
+		}
+		depths[doc.ID] = depth
+	}
+
+	covenants := slices.Clone(opts.Covenants)
+	sort.SliceStable(covenants, func(i, j int) bool { return depths[covenants[i].ID] < depths[covenants[j].ID] })
+	bundle := &PolicyBundle{
+		Format: PolicyBundleFormat,
+		Manifest: PolicyManifest{
+			Name:      opts.Name,
+			Version:   opts.Version,
+			CreatedAt: Timestamp(),
+			Covenants: make([]PolicyManifestEntry, len(covenants)),
+		},
+		Covenants:       covenants,
+		SignerPublicKey: kp.PublicKeyHex,
+	}
+	for i, doc := range covenants {
+		bundle.Manifest.Covenants[i] = policyManifestEntry(doc, opts.Roles[doc.ID])
+	}
+
+	payload, err := policyBundlePayload(bundle)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := Sign(payload, kp.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign policy bundle: %w", err)
+	}
+	bundle.ID = SHA256Hex(payload)
+	bundle.Signature = ToHex(sig)
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "grith: failed to serialize policy bundle: %w", err)
+	}
+	return data, nil
+}
+
+// policyBundleDepth returns the depth of doc in the bundle's topology,
+// checking that its parent is in the bundle and that its chain depth is
+// one more than its parent's. Depths are strictly increasing from the
+// roots, so a consistent topology has no cycles.
+func policyBundleDepth(doc *CovenantDocument, byID map[string]*CovenantDocument) (int, error) {
+	if doc.Chain == nil {
+		return 0, nil
+	}
+	parent := byID[doc.Chain.ParentID]
+	if parent == nil {
+		return 0, errorf(ErrCodeInvalidChain, "grith: parent %s of covenant %s is not in the policy bundle", shortID(doc.Chain.ParentID), shortID(doc.ID))
+	}
+	want := 1
+	if parent.Chain != nil {
+		want = parent.Chain.Depth + 1
+	}
+	if doc.Chain.Depth != want {
+		return 0, errorf(ErrCodeInvalidChain, "grith: covenant %s has chain depth %d, want %d", shortID(doc.ID), doc.Chain.Depth, want)
+	}
+	return want, nil
+}
+
+func policyManifestEntry(doc *CovenantDocument, role string) PolicyManifestEntry {
+	e := PolicyManifestEntry{ID: doc.ID, Role: role, Issuer: doc.Issuer.ID, Beneficiary: doc.Beneficiary.ID}
+	if doc.Chain != nil {
+		e.ParentID = doc.Chain.ParentID
+		e.Depth = doc.Chain.Depth
+	}
+	return e
+}
+
+// policyBundlePayload returns the canonical form of a bundle: its JSON
+// object without the id and signature fields. The ID is its hash and the
+// signature is over it.
+func policyBundlePayload(b *PolicyBundle) ([]byte, error) {
+	m, err := objectToMap(b)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to convert to map: %w", err)
+	}
+	delete(m, "id")
+	delete(m, "signature")
+	canonical, err := CanonicalizeJSON(m)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to canonicalize: %w", err)
+	}
+	return []byte(canonical), nil
+}
+
+// ParsePolicyBundle decodes a policy bundle without verifying it.
+func ParsePolicyBundle(data []byte) (*PolicyBundle, error) {
+	var bundle PolicyBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "grith: invalid policy bundle JSON: %w", err)
+	}
+	if bundle.Format != PolicyBundleFormat {
+		return nil, errorf(ErrCodeUnsupportedVersion, "grith: unsupported policy bundle format: %q", bundle.Format)
+	}
+	if len(bundle.Covenants) == 0 {
+		return nil, errorf(ErrCodeMissingField, "grith: policy bundle has no covenants")
+	}
+	for i, doc := range bundle.Covenants {
+		if doc == nil {
+			return nil, errorf(ErrCodeMissingField, "grith: policy bundle covenant %d is null", i)
+		}
+	}
+	return &bundle, nil
+}
+
+// VerifyPolicyBundle decodes and verifies a policy bundle offline. An
+// error is returned only if opts sets neither TrustedSigners nor
+// PinnedID, or data is not a policy bundle; verification failures are
+// reported in the result's checks:
+//
+//   - bundle_id        - the ID is the hash of the bundle's canonical form
+//   - bundle_signature - the signature is valid for the signer key
+//   - trusted_signer   - the signer is in opts.TrustedSigners (if set)
+//   - pinned           - the ID is opts.PinnedID (if set)
+//   - manifest         - the manifest lists exactly the bundled covenants,
+//     with their parties and chain references
+//   - covenants        - every covenant passes verification
+//   - chain            - every delegated covenant's parent is in the bundle
+//     at the depth above it, and the covenant only narrows its parent
+func VerifyPolicyBundle(data []byte, opts *PolicyBundleVerifyOptions) (*PolicyBundleVerificationResult, error) {
+	if opts == nil || (len(opts.TrustedSigners) == 0 && opts.PinnedID == "") {
+		return nil, errorf(ErrCodeMissingField, "grith: policy bundle verification requires trusted signers or a pinned ID")
+	}
+	bundle, err := ParsePolicyBundle(data)
+	if err != nil {
+		return nil, err
+	}
+	covOpts := &VerifyOptions{}
+	if opts.Covenant != nil {
+		covOpts = opts.Covenant
+	}
+
+	result := &PolicyBundleVerificationResult{Bundle: bundle}
+	payload, perr := policyBundlePayload(bundle)
+	result.Checks = append(result.Checks, policyBundleIDCheck(bundle, payload, perr))
+	result.Checks = append(result.Checks, policyBundleSignatureCheck(bundle, payload, perr))
+	if len(opts.TrustedSigners) > 0 {
+		check := VerificationCheck{Name: "trusted_signer", Code: CheckPolicyBundleSigner, Passed: true, Message: "Bundle signer is trusted"}
+		if !slices.Contains(opts.TrustedSigners, bundle.SignerPublicKey) {
+			check.Passed = false
+			check.Message = fmt.Sprintf("Bundle signer %s is not trusted", shortID(bundle.SignerPublicKey))
+		}
+		result.Checks = append(result.Checks, check)
+	}
+	if opts.PinnedID != "" {
+		check := VerificationCheck{Name: "pinned", Code: CheckPolicyBundlePinned, Passed: true, Message: "Bundle ID matches the pinned ID"}
+		if bundle.ID != opts.PinnedID {
+			check.Passed = false
+			check.Message = fmt.Sprintf("Bundle ID %s does not match the pinned ID %s", shortID(bundle.ID), shortID(opts.PinnedID))
+		}
+		result.Checks = append(result.Checks, check)
+	}
+	result.Checks = append(result.Checks, policyManifestCheck(bundle))
+
+	var failed []string
+	for _, doc := range bundle.Covenants {
+		r, err := VerifyCovenantWithOptions(doc, covOpts)
+		if err != nil {
+			return nil, err
+		}
+		result.Covenants = append(result.Covenants, r)
+		if !r.Valid {
+			failed = append(failed, fmt.Sprintf("%s (%s)", shortID(doc.ID), failedCheckNames(r.Checks)))
+		}
+	}
+	check := VerificationCheck{Name: "covenants", Code: CheckPolicyBundleCovenants, Passed: len(failed) == 0, Message: fmt.Sprintf("All %d covenant(s) are valid", len(bundle.Covenants))}
+	if len(failed) > 0 {
+		check.Message = fmt.Sprintf("Covenants failed verification: %s", strings.Join(failed, "; "))
+	}
+	result.Checks = append(result.Checks, check)
+	result.Checks = append(result.Checks, policyBundleChainCheck(bundle, covOpts.ConstraintResolver))
+
+	result.Valid, result.Warnings = aggregateChecks(result.Checks)
+	return result, nil
+}
+
+func policyBundleIDCheck(b *PolicyBundle, payload []byte, err error) VerificationCheck {
+	check := VerificationCheck{Name: "bundle_id", Code: CheckPolicyBundleID}
+	switch {
+	case err != nil:
+		check.Message = fmt.Sprintf("Cannot canonicalize bundle: %v", err)
+	case SHA256Hex(payload) != b.ID:
+		check.Message = "Bundle ID does not match its content"
+	default:
+		check.Passed = true
+		check.Message = "Bundle ID matches its content"
+	}
+	return check
+}
+
+func policyBundleSignatureCheck(b *PolicyBundle, payload []byte, err error) VerificationCheck {
+	check := VerificationCheck{Name: "bundle_signature", Code: CheckPolicyBundleSignature}
+	if err != nil {
+		check.Message = fmt.Sprintf("Cannot canonicalize bundle: %v", err)
+		return check
+	}
+	pub, err := FromHex(b.SignerPublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		check.Message = "Bundle signer key is invalid"
+		return check
+	}
+	sig, err := FromHex(b.Signature)
+	if err != nil || !Verify(payload, sig, ed25519.PublicKey(pub)) {
+		check.Message = "Bundle signature is invalid"
+		return check
+	}
+	check.Passed = true
+	check.Message = "Bundle signature is valid"
+	return check
+}
+
+func policyManifestCheck(b *PolicyBundle) VerificationCheck {
+	check := VerificationCheck{Name: "manifest", Code: CheckPolicyBundleManifest}
+	entries := b.Manifest.Covenants
+	if len(entries) != len(b.Covenants) {
+		check.Message = fmt.Sprintf("Manifest lists %d covenant(s), bundle has %d", len(entries), len(b.Covenants))
+		return check
+	}
+	seen := make(map[string]bool, len(entries))
+	for i, doc := range b.Covenants {
+		e := entries[i]
+		if seen[doc.ID] {
+			check.Message = fmt.Sprintf("Covenant %s is in the bundle twice", shortID(doc.ID))
+			return check
+		}
+		seen[doc.ID] = true
+		want := policyManifestEntry(doc, e.Role)
+		if e != want {
+			check.Message = fmt.Sprintf("Manifest entry %d does not describe covenant %s", i, shortID(doc.ID))
+			return check
+		}
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("Manifest lists the %d bundled covenant(s)", len(entries))
+	return check
+}
+
+func policyBundleChainCheck(b *PolicyBundle, resolver ConstraintResolver) VerificationCheck {
+	check := VerificationCheck{Name: "chain", Code: CheckPolicyBundleChain}
+	byID := make(map[string]*CovenantDocument, len(b.Covenants))
+	for _, doc := range b.Covenants {
+		byID[doc.ID] = doc
+	}
+	delegated := 0
+	for _, doc := range b.Covenants {
+		if _, err := policyBundleDepth(doc, byID); err != nil {
+			check.Message = err.Error()
+			return check
+		}
+		if doc.Chain == nil {
+			continue
+		}
+		delegated++
+		parent := byID[doc.Chain.ParentID]
+		parentCCL, err := parsedCovenantConstraints(parent, resolver)
+		if err != nil {
+			check.Message = fmt.Sprintf("Cannot check covenant %s against its parent: %v", shortID(doc.ID), err)
+			return check
+		}
+		childCCL, err := parsedCovenantConstraints(doc, resolver)
+		if err != nil {
+			check.Message = fmt.Sprintf("Cannot check covenant %s against its parent: %v", shortID(doc.ID), err)
+			return check
+		}
+		if r := ValidateNarrowing(parentCCL, childCCL); !r.Valid {
+			check.Message = fmt.Sprintf("Covenant %s broadens its parent: %s", shortID(doc.ID), r.Violations[0].Message)
+			return check
+		}
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("%d delegated covenant(s) narrow their parents", delegated)
+	return check
+}
@@ -0,0 +1,113 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"fmt"
+)
+
+// Pre-rotation, as in KERI: an identity commits to the hash of its next
+// operator key before it needs it, and the next rotation must reveal a
+// key matching the commitment. A compromised operator key can then sign
+// evolutions, but can neither rotate the identity to a key of its own
+// nor replace the commitment, and the operator recovers by rotating to
+// the committed key, which was never exposed.
+
+// ComputeKeyCommitment returns the pre-rotation commitment to a hex
+// Ed25519 public key: the hex SHA-256 hash of the raw key.
+func ComputeKeyCommitment(publicKeyHex string) (string, error) {
+	pub, err := FromHex(publicKeyHex)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return "", errorf(ErrCodeInvalidInput, "grith: key commitment requires a hex Ed25519 public key")
+	}
+	return SHA256Hex(pub), nil
+}
+
+// RotateOperatorKeyOptions are the options for RotateOperatorKeyWithOptions.
+type RotateOperatorKeyOptions struct {
+	OldKeyPair *KeyPair
+	// NewKeyPair must match the identity's key commitment, if it has one.
+	NewKeyPair *KeyPair
+	// NextKeyCommitment, if set, commits the identity to the key of the
+	// rotation after this one.
+	NextKeyCommitment string
+}
+
+// RotateOperatorKeyWithOptions rotates the operator key as
+// RotateOperatorKey does, and records a commitment to the next key.
+func RotateOperatorKeyWithOptions(current *AgentIdentity, opts *RotateOperatorKeyOptions) (*AgentIdentity, error) {
+	if opts == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: rotation options are required")
+	}
+	return rotateOperatorKey(current, opts.OldKeyPair, opts.NewKeyPair, opts.NextKeyCommitment)
+}
+
+// validateKeyCommitment checks that commitment is a SHA-256 hex digest
+// and that it is not made for an organizational identity, whose keys
+// change with its operator set rather than by rotation.
+func validateKeyCommitment(commitment string, operators *OperatorSet) error {
+	if !isHexDigest(commitment) {
+		return errorf(ErrCodeInvalidInput, "grith: key commitment must be a SHA-256 hex digest")
+	}
+	if operators != nil {
+		return errorf(ErrCodeInvalidInput, "grith: organizational identities cannot commit to a next operator key")
+	}
+	return nil
+}
+
+// keyCommitmentAfter returns the key commitment in force after entries,
+// a lineage or a prefix of one.
+func keyCommitmentAfter(entries []LineageEntry) string {
+	commitment := ""
+	for _, e := range entries {
+		switch {
+		case e.Summary != nil:
+			commitment = e.Summary.NextKeyCommitment
+		case e.ChangeType == ChangeOperatorKeyRotation || e.ChangeType == ChangeOperatorKeyRecovery || e.NextKeyCommitment != "":
+			commitment = e.NextKeyCommitment
+		}
+	}
+	return commitment
+}
+
+// checkKeyCommitments describes the first pre-rotation problem in
+// identity's lineage, or returns "" if there is none. Each rotation must
+// reveal the key committed to before it, if any; a commitment may
+// otherwise only be made when none is in force; operators and recovery
+// keys may not change by other means while one is, though a recovery
+// overrides it; and the identity carries the commitment its lineage ends
+// with.
+func checkKeyCommitments(identity *AgentIdentity) string {
+	commitment := ""
+	for i := range identity.Lineage {
+		e := &identity.Lineage[i]
+		switch {
+		case e.Summary != nil:
+			commitment = e.Summary.NextKeyCommitment
+		case e.ChangeType == ChangeOperatorKeyRotation:
+			if commitment != "" {
+				if c, err := ComputeKeyCommitment(e.NewOperatorKey); err != nil || c != commitment {
+					return fmt.Sprintf("Operator key rotation at lineage entry %d does not reveal the committed key", i)
+				}
+			}
+			commitment = e.NextKeyCommitment
+		case e.ChangeType == ChangeOperatorKeyRecovery:
+			commitment = e.NextKeyCommitment
+		case commitment != "" && (e.ChangeType == "operator_transfer" || e.Operators != nil || e.Recovery != nil):
+			return fmt.Sprintf("Lineage entry %d changes operators or recovery keys despite a key commitment", i)
+		case commitment != "" && e.NextKeyCommitment != "":
+			return fmt.Sprintf("Lineage entry %d replaces a key commitment without a rotation", i)
+		case e.NextKeyCommitment != "":
+			commitment = e.NextKeyCommitment
+		}
+		if e.NextKeyCommitment != "" && !isHexDigest(e.NextKeyCommitment) {
+			return fmt.Sprintf("Lineage entry %d has a malformed key commitment", i)
+		}
+	}
+	if commitment != identity.NextKeyCommitment {
+		return "Identity does not carry its lineage's key commitment"
+	}
+	if commitment != "" && identity.Operators != nil {
+		return "Organizational identity has a key commitment"
+	}
+	return ""
+}
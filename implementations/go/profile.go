@@ -0,0 +1,180 @@
+package grith
+
+import (
+	"slices"
+	"sync"
+)
+
+// Built-in verification profile names.
+const (
+	// ProfileFullAudit runs every check and treats warnings as failures.
+	ProfileFullAudit = "full-audit"
+	// ProfileIngest skips the checks that are expensive or redundant when
+	// accepting documents into a store: countersignatures, transparency
+	// receipts and anchor proofs.
+	ProfileIngest = "ingest"
+	// ProfileOffline skips checks that need external services (anchor
+	// proofs and nonce registries) and downgrades did_binding to a warning,
+	// since did:web parties cannot be resolved without a network.
+	ProfileOffline = "offline"
+)
+
+// protectedChecks are the checks no profile may skip or change the
+// severity of. id_match, signature_valid, and ccl_parses establish that a
+// document is what its issuer signed; not_expired, active, and
+// version_supported that it is in force and understood. Relaxing any of
+// them would let tampered, lapsed, or unreadable documents verify as
+// valid.
+var protectedChecks = []string{
+	"id_match", "signature_valid", "ccl_parses",
+	"not_expired", "active", "version_supported",
+}
+
+// VerificationProfile selects which checks a verification runs and how
+// strictly their outcomes are judged. Select one by name with
+// VerifyOptions.Profile. A profile can relax optional checks but never
+// the protected ones (id_match, signature_valid, ccl_parses, not_expired,
+// active, and version_supported), so a document valid under any profile
+// is signed, in force, and of a supported version.
+type VerificationProfile struct {
+	Name string
+	// Skip lists checks that are not run. Skipped checks are omitted from
+	// the result. The protected checks cannot be skipped.
+	Skip []string
+	// Severities overrides the severity of named checks, e.g. to report a
+	// check as a warning instead of invalidating the document. The
+	// protected checks cannot be overridden.
+	Severities map[string]CheckSeverity
+	// Strict treats warnings as failures: every check with a warning
+	// severity is reported as a failed fatal check.
+	Strict bool
+}
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]*VerificationProfile{
+		ProfileFullAudit: {Name: ProfileFullAudit, Strict: true},
+		ProfileIngest: {
+			Name: ProfileIngest,
+			Skip: []string{"countersignatures", "transparency", "anchored"},
+		},
+		ProfileOffline: {
+			Name:       ProfileOffline,
+			Skip:       []string{"anchored", "nonce_unique"},
+			Severities: map[string]CheckSeverity{"did_binding": SeverityWarning},
+		},
+	}
+)
+
+// RegisterProfile makes a verification profile available by name.
+// Built-in profiles cannot be replaced.
+func RegisterProfile(p VerificationProfile) error {
+	if p.Name == "" {
+		return errorf(ErrCodeMissingField, "grith: verification profile requires a name")
+	}
+	for _, name := range p.Skip {
+		if !isCheckName(name) {
+			return errorf(ErrCodeInvalidInput, "grith: profile %q skips invalid check name %q", p.Name, name)
+		}
+		if slices.Contains(protectedChecks, name) {
+			return errorf(ErrCodeInvalidInput, "grith: profile %q cannot skip protected check %q", p.Name, name)
+		}
+	}
+	for name, sev := range p.Severities {
+		if !isCheckName(name) {
+			return errorf(ErrCodeInvalidInput, "grith: profile %q sets severity of invalid check name %q", p.Name, name)
+		}
+		if slices.Contains(protectedChecks, name) {
+			return errorf(ErrCodeInvalidInput, "grith: profile %q cannot set the severity of protected check %q", p.Name, name)
+		}
+		switch sev {
+		case SeverityFatal, SeverityWarning, SeverityInfo:
+		default:
+			return errorf(ErrCodeInvalidInput, "grith: profile %q uses unknown severity %q", p.Name, sev)
+		}
+	}
+	switch p.Name {
+	case ProfileFullAudit, ProfileIngest, ProfileOffline:
+		return errorf(ErrCodeInvalidInput, "grith: profile name %q is reserved for a built-in profile", p.Name)
+	}
+
+	cp := p.clone()
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	if _, ok := profiles[p.Name]; ok {
+		return errorf(ErrCodeInvalidInput, "grith: profile %q is already registered", p.Name)
+	}
+	profiles[p.Name] = &cp
+	return nil
+}
+
+// LookupProfile returns the named verification profile.
+func LookupProfile(name string) (VerificationProfile, bool) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	p, ok := profiles[name]
+	if !ok {
+		return VerificationProfile{}, false
+	}
+	return p.clone(), true
+}
+
+func (p *VerificationProfile) clone() VerificationProfile {
+	c := *p
+	c.Skip = append([]string(nil), p.Skip...)
+	c.Severities = make(map[string]CheckSeverity, len(p.Severities))
+	for name, sev := range p.Severities {
+		c.Severities[name] = sev
+	}
+	return c
+}
+
+// resolveProfile returns the profile selected by name, or nil for "".
+func resolveProfile(name string) (*VerificationProfile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	profilesMu.RLock()
+	p, ok := profiles[name]
+	profilesMu.RUnlock()
+	if !ok {
+		return nil, errorf(ErrCodeInvalidInput, "grith: unknown verification profile %q", name)
+	}
+	return p, nil
+}
+
+// skips reports whether the profile skips the named check. A nil profile
+// runs everything.
+func (p *VerificationProfile) skips(name string) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Skip {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// apply drops skipped checks and adjusts severities.
+func (p *VerificationProfile) apply(checks []VerificationCheck) []VerificationCheck {
+	if p == nil {
+		return checks
+	}
+	out := checks[:0]
+	for _, c := range checks {
+		if p.skips(c.Name) {
+			continue
+		}
+		if sev, ok := p.Severities[c.Name]; ok {
+			c.Severity = sev
+		}
+		if p.Strict && c.Severity == SeverityWarning {
+			c.Severity = SeverityFatal
+			c.Passed = false
+		}
+		out = append(out, c)
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package grith
+
+import "crypto/ed25519"
+
+// ActionReceipt is a compact, signed statement by an agent that an action
+// was recorded in its covenant's log at a given index. The agent hands it
+// to a counterparty when it acts; later, the counterparty checks it
+// against a checkpoint with VerifyReceiptInclusion to confirm the action
+// is covered by the log the agent publishes.
+type ActionReceipt struct {
+	CovenantID      string        `json:"covenantId"`
+	Index           int64         `json:"index"`
+	EntryHash       string        `json:"entryHash"`
+	Action          string        `json:"action"`
+	Resource        string        `json:"resource"`
+	Outcome         ActionOutcome `json:"outcome"`
+	Timestamp       string        `json:"timestamp"`
+	SignerPublicKey string        `json:"signerPublicKey"`
+	Signature       string        `json:"signature"`
+}
+
+// LogInclusionProof is a Merkle audit path showing that the entry at
+// Index is among the first Size entries of a covenant's action log.
+type LogInclusionProof struct {
+	CovenantID string   `json:"covenantId"`
+	Index      int64    `json:"index"`
+	Size       int64    `json:"size"`
+	Hashes     []string `json:"hashes"`
+}
+
+// IssueActionReceipt signs a receipt for a log entry. The entry must be
+// intact and signed by agentKP.
+func IssueActionReceipt(entry *ActionLogEntry, agentKP *KeyPair) (*ActionReceipt, error) {
+	if entry == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: log entry is required")
+	}
+	if agentKP == nil || len(agentKP.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: privateKey must be %d bytes", ed25519.PrivateKeySize)
+	}
+	if err := VerifyActionLogSegment([]ActionLogEntry{*entry}, agentKP.PublicKey, entry.PreviousHash); err != nil {
+		return nil, err
+	}
+	r := &ActionReceipt{
+		CovenantID:      entry.CovenantID,
+		Index:           entry.Index,
+		EntryHash:       entry.Hash,
+		Action:          entry.Action,
+		Resource:        entry.Resource,
+		Outcome:         entry.Outcome,
+		Timestamp:       entry.Timestamp,
+		SignerPublicKey: agentKP.PublicKeyHex,
+	}
+	payload, err := signedPayload(r)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := Sign(payload, agentKP.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign action receipt: %w", err)
+	}
+	r.Signature = ToHex(sig)
+	return r, nil
+}
+
+// VerifyActionReceipt checks r's signature against its signer key. It
+// does not show that the action was logged; see VerifyReceiptInclusion.
+func VerifyActionReceipt(r *ActionReceipt) error {
+	if r == nil {
+		return errorf(ErrCodeMissingField, "grith: action receipt is required")
+	}
+	pub, err := FromHex(r.SignerPublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errorf(ErrCodeActionLog, "grith: receipt signer key is invalid")
+	}
+	if !verifyLogSignature(r, r.Signature, ed25519.PublicKey(pub)) {
+		return errorf(ErrCodeActionLog, "grith: receipt for entry %d has an invalid signature", r.Index)
+	}
+	return nil
+}
+
+// VerifyReceiptInclusion checks that the receipted entry is in the log
+// committed to by cp: the receipt and checkpoint are validly signed by
+// the same key for the same covenant, and proof places the entry hash at
+// the receipt's index under the checkpoint's root.
+func VerifyReceiptInclusion(r *ActionReceipt, cp *LogCheckpoint, proof *LogInclusionProof) error {
+	if r == nil || cp == nil || proof == nil {
+		return errorf(ErrCodeMissingField, "grith: inclusion check requires a receipt, a checkpoint, and a proof")
+	}
+	if r.CovenantID != cp.CovenantID || proof.CovenantID != cp.CovenantID {
+		return errorf(ErrCodeActionLog, "grith: receipt, checkpoint, and proof belong to different covenants")
+	}
+	if r.SignerPublicKey != cp.SignerPublicKey {
+		return errorf(ErrCodeActionLog, "grith: receipt and checkpoint are signed by different keys")
+	}
+	if proof.Index != r.Index || proof.Size != cp.Size {
+		return errorf(ErrCodeActionLog, "grith: proof covers entry %d of %d, receipt is for entry %d of a checkpoint at %d", proof.Index, proof.Size, r.Index, cp.Size)
+	}
+	if err := VerifyActionReceipt(r); err != nil {
+		return err
+	}
+	if err := VerifyLogCheckpoint(cp); err != nil {
+		return err
+	}
+	if !VerifyMerkleInclusion(MerkleLeafHash([]byte(r.EntryHash)), r.Index, cp.Size, proof.Hashes, cp.Root) {
+		return errorf(ErrCodeActionLog, "grith: entry %d is not in the log at size %d", r.Index, cp.Size)
+	}
+	return nil
+}
+
+// InclusionProof proves that the entry at index is among the log's first
+// size entries, for checking a receipt against a checkpoint at size.
+func (l *ActionLog) InclusionProof(index, size int64) (*LogInclusionProof, error) {
+	entries := l.Entries()
+	if index < 0 || index >= size || size > int64(len(entries)) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: inclusion proof of entry %d at size %d out of range for log of size %d", index, size, len(entries))
+	}
+	hashes, err := MerkleInclusionProof(actionLogLeaves(entries[:size]), int(index))
+	if err != nil {
+		return nil, err
+	}
+	return &LogInclusionProof{
+		CovenantID: l.doc.ID,
+		Index:      index,
+		Size:       size,
+		Hashes:     hashes,
+	}, nil
+}
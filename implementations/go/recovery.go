@@ -0,0 +1,181 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"fmt"
+)
+
+// ChangeOperatorKeyRecovery is the lineage change type recorded by
+// RecoverOperatorKey.
+const ChangeOperatorKeyRecovery = "operator_key_recovery"
+
+// RecoverOperatorKeyOptions are the options for RecoverOperatorKey.
+type RecoverOperatorKeyOptions struct {
+	// RecoveryKeyPairs sign for the identity's recovery set; a threshold
+	// of it is required.
+	RecoveryKeyPairs []*KeyPair
+	// NewKeyPair becomes the operator key.
+	NewKeyPair *KeyPair
+	// Description defaults to "Operator key recovered".
+	Description string
+	// NextKeyCommitment, if set, commits the identity to the key of its
+	// next rotation.
+	NextKeyCommitment string
+}
+
+// RecoverOperatorKey replaces the operator key of an identity whose key
+// was lost. The recovery's lineage entry is signed by a threshold of the
+// identity's recovery keys and by the new key, but not by the lost one,
+// so its carry-forward is the policy's heavily discounted
+// OperatorKeyRecovery rate. Recovery overrides a key commitment, which
+// it ends unless opts.NextKeyCommitment makes a new one.
+func RecoverOperatorKey(current *AgentIdentity, opts *RecoverOperatorKeyOptions) (*AgentIdentity, error) {
+	if current == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: current identity is required")
+	}
+	if opts == nil || opts.NewKeyPair == nil || len(opts.RecoveryKeyPairs) == 0 {
+		return nil, errorf(ErrCodeMissingField, "grith: recovery key pairs and a new key pair are required")
+	}
+	if current.Recovery == nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: identity %s has no recovery keys", shortID(current.ID))
+	}
+	if opts.NewKeyPair.PublicKeyHex == current.OperatorPublicKey {
+		return nil, errorf(ErrCodeInvalidInput, "grith: new operator key must differ from the old one")
+	}
+	if opts.NextKeyCommitment != "" {
+		if err := validateKeyCommitment(opts.NextKeyCommitment, nil); err != nil {
+			return nil, err
+		}
+	}
+	description := opts.Description
+	if description == "" {
+		description = "Operator key recovered"
+	}
+
+	now := Timestamp()
+	newIdentity := *current
+	newIdentity.ID = ""
+	newIdentity.OperatorPublicKey = opts.NewKeyPair.PublicKeyHex
+	newIdentity.NextKeyCommitment = opts.NextKeyCommitment
+	newIdentity.Lineage = append([]LineageEntry(nil), current.Lineage...)
+	newIdentity.Version = current.Version + 1
+	newIdentity.UpdatedAt = now
+	newIdentity.Signature = ""
+	idHash, err := computeIdentityHash(&newIdentity)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute identity hash: %w", err)
+	}
+
+	policy, policyHash := identityPolicy(current)
+	parentHash := current.Lineage[len(current.Lineage)-1].IdentityHash
+	entry := LineageEntry{
+		IdentityHash:           idHash,
+		ChangeType:             ChangeOperatorKeyRecovery,
+		Description:            description,
+		Timestamp:              now,
+		ParentHash:             &parentHash,
+		ReputationCarryForward: policy.OperatorKeyRecovery,
+		PreviousOperatorKey:    current.OperatorPublicKey,
+		NewOperatorKey:         opts.NewKeyPair.PublicKeyHex,
+		PolicyHash:             policyHash,
+		NextKeyCommitment:      opts.NextKeyCommitment,
+	}
+	lineagePayload, err := lineageSigningPayload(&entry)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute lineage signing payload: %w", err)
+	}
+	_, entry.Signatures, err = signAsOperators([]byte(lineagePayload), nil, opts.RecoveryKeyPairs, current.Recovery)
+	if err != nil {
+		return nil, err
+	}
+	newSig, err := Sign([]byte(lineagePayload), opts.NewKeyPair.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign lineage entry: %w", err)
+	}
+	entry.NewKeySignature = ToHex(newSig)
+	newIdentity.Lineage = append(newIdentity.Lineage, entry)
+
+	if newIdentity.ID, err = computeIdentityHash(&newIdentity); err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to recompute identity hash: %w", err)
+	}
+	payload, err := identitySigningPayload(&newIdentity)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to compute identity signing payload: %w", err)
+	}
+	sig, err := Sign([]byte(payload), opts.NewKeyPair.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign identity: %w", err)
+	}
+	newIdentity.Signature = ToHex(sig)
+	return &newIdentity, nil
+}
+
+// validateRecoverySet checks a recovery set, which only single-operator
+// identities may declare.
+func validateRecoverySet(set *OperatorSet, operators *OperatorSet) error {
+	if err := validateOperatorSet(set); err != nil {
+		return err
+	}
+	if operators != nil {
+		return errorf(ErrCodeInvalidInput, "grith: organizational identities cannot have recovery keys")
+	}
+	return nil
+}
+
+// recoverySetAfter returns the recovery set in force after entries, a
+// lineage or a prefix of one.
+func recoverySetAfter(entries []LineageEntry) *OperatorSet {
+	var set *OperatorSet
+	for _, e := range entries {
+		switch {
+		case e.Summary != nil:
+			set = e.Summary.Recovery
+		case e.Recovery != nil:
+			set = e.Recovery
+		}
+	}
+	return set
+}
+
+// checkRecovery describes the first recovery problem in identity's
+// lineage, or returns "" if there is none. Each recovery must be signed
+// by a threshold of the recovery set in force and by its new key, and the
+// identity carries the recovery set its lineage ends with.
+func checkRecovery(identity *AgentIdentity) string {
+	var set *OperatorSet
+	for i := range identity.Lineage {
+		e := &identity.Lineage[i]
+		if e.Summary != nil {
+			set = e.Summary.Recovery
+		}
+		if e.ChangeType == ChangeOperatorKeyRecovery && (set == nil || !verifyRecoveryEntry(e, set)) {
+			return fmt.Sprintf("Operator key recovery at lineage entry %d is not signed by the recovery keys", i)
+		}
+		if e.Recovery != nil {
+			if validateOperatorSet(e.Recovery) != nil {
+				return fmt.Sprintf("Lineage entry %d declares an invalid recovery set", i)
+			}
+			set = e.Recovery
+		}
+	}
+	if !sameOperatorSet(set, identity.Recovery) {
+		return "Identity does not carry its lineage's recovery keys"
+	}
+	if set != nil && identity.Operators != nil {
+		return "Organizational identity has recovery keys"
+	}
+	return ""
+}
+
+func verifyRecoveryEntry(e *LineageEntry, set *OperatorSet) bool {
+	payload, err := lineageSigningPayload(e)
+	if err != nil || !verifyOperatorSignatures([]byte(payload), e.Signatures, set) {
+		return false
+	}
+	pub, err := FromHex(e.NewOperatorKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := FromHex(e.NewKeySignature)
+	return err == nil && Verify([]byte(payload), sig, ed25519.PublicKey(pub))
+}
@@ -0,0 +1,502 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// IdentityStore is the interface for agent identity storage, shared by
+// registries, enforcers, and auditors. Identities are keyed by their ID,
+// which changes with every evolution, so each version is stored
+// separately.
+type IdentityStore interface {
+	// Put stores an identity, replacing any existing identity with the
+	// same ID.
+	Put(identity *AgentIdentity) error
+
+	// Get retrieves an identity by its ID. Returns nil if not found.
+	Get(id string) (*AgentIdentity, error)
+
+	// Delete removes an identity by ID. Returns an error if the identity
+	// does not exist.
+	Delete(id string) error
+
+	// List returns all stored identities.
+	List() ([]*AgentIdentity, error)
+
+	// Query returns the stored identities matching q, ordered by ID.
+	Query(q *IdentityQuery) ([]*AgentIdentity, error)
+
+	// Has checks whether an identity with the given ID exists.
+	Has(id string) bool
+
+	// Count returns the number of identities in the store.
+	Count() int
+}
+
+// IdentityQuery selects stored identities. Empty fields match everything.
+type IdentityQuery struct {
+	// OperatorKey matches identities whose operator key, or one of whose
+	// operator set's keys, is this hex public key.
+	OperatorKey   string
+	ModelProvider string
+	ModelID       string
+	// Capabilities must all be held.
+	Capabilities []string
+}
+
+// Matches reports whether identity satisfies q.
+func (q *IdentityQuery) Matches(identity *AgentIdentity) bool {
+	if q == nil {
+		return true
+	}
+	if q.OperatorKey != "" && identity.OperatorPublicKey != q.OperatorKey {
+		if identity.Operators == nil || !slices.Contains(identity.Operators.Keys, q.OperatorKey) {
+			return false
+		}
+	}
+	if q.ModelProvider != "" && identity.Model.Provider != q.ModelProvider {
+		return false
+	}
+	if q.ModelID != "" && identity.Model.ModelID != q.ModelID {
+		return false
+	}
+	for _, c := range q.Capabilities {
+		if !slices.Contains(identity.Capabilities, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// MemoryIdentityStore is an in-memory IdentityStore. It is safe for
+// concurrent use.
+type MemoryIdentityStore struct {
+	mu   sync.RWMutex
+	data map[string]*AgentIdentity
+}
+
+// NewMemoryIdentityStore creates a new, empty MemoryIdentityStore.
+func NewMemoryIdentityStore() *MemoryIdentityStore {
+	return &MemoryIdentityStore{data: make(map[string]*AgentIdentity)}
+}
+
+// Put stores a deep copy of identity.
+func (s *MemoryIdentityStore) Put(identity *AgentIdentity) error {
+	if identity == nil || identity.ID == "" {
+		return errorf(ErrCodeInvalidInput, "grith: identityStore.Put: identity with an ID is required")
+	}
+	copied, err := deepCopyIdentity(identity)
+	if err != nil {
+		return errorf(ErrCodeSerialization, "grith: identityStore.Put: failed to copy identity: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[identity.ID] = copied
+	return nil
+}
+
+// Get returns a deep copy of the identity with the given ID, or nil.
+func (s *MemoryIdentityStore) Get(id string) (*AgentIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	identity, ok := s.data[id]
+	if !ok {
+		return nil, nil
+	}
+	copied, err := deepCopyIdentity(identity)
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "grith: identityStore.Get: failed to copy identity: %w", err)
+	}
+	return copied, nil
+}
+
+// Delete removes the identity with the given ID.
+func (s *MemoryIdentityStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[id]; !ok {
+		return errorf(ErrCodeNotFound, "grith: identityStore.Delete: identity not found: %s", id)
+	}
+	delete(s.data, id)
+	return nil
+}
+
+// List returns deep copies of all stored identities.
+func (s *MemoryIdentityStore) List() ([]*AgentIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*AgentIdentity, 0, len(s.data))
+	for _, identity := range s.data {
+		copied, err := deepCopyIdentity(identity)
+		if err != nil {
+			return nil, errorf(ErrCodeSerialization, "grith: identityStore.List: failed to copy identity: %w", err)
+		}
+		result = append(result, copied)
+	}
+	return result, nil
+}
+
+// Query returns deep copies of the identities matching q, ordered by ID.
+func (s *MemoryIdentityStore) Query(q *IdentityQuery) ([]*AgentIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []*AgentIdentity
+	for _, identity := range s.data {
+		if !q.Matches(identity) {
+			continue
+		}
+		copied, err := deepCopyIdentity(identity)
+		if err != nil {
+			return nil, errorf(ErrCodeSerialization, "grith: identityStore.Query: failed to copy identity: %w", err)
+		}
+		result = append(result, copied)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// Has reports whether an identity with the given ID is stored.
+func (s *MemoryIdentityStore) Has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.data[id]
+	return ok
+}
+
+// Count returns the number of stored identities.
+func (s *MemoryIdentityStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+func deepCopyIdentity(identity *AgentIdentity) (*AgentIdentity, error) {
+	b, err := json.Marshal(identity)
+	if err != nil {
+		return nil, err
+	}
+	var copied AgentIdentity
+	if err := json.Unmarshal(b, &copied); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+// IdentityRegistry indexes verified agent identities across their
+// evolutions. All versions of an agent share the first entry of their
+// lineage; the registry only accepts a new version that extends the
+// latest one it holds, and only accepts a change of operator key made by
+// RotateOperatorKey, by RecoverOperatorKey, or by an operator set change
+// authorized by the key or set it replaces. It is safe for concurrent use.
+type IdentityRegistry struct {
+	mu    sync.RWMutex
+	store IdentityStore
+	// roots maps every registered identity ID to its agent's root, the
+	// hash of its creation lineage entry.
+	roots map[string]string
+	// versions holds each agent's registered versions, oldest first.
+	versions map[string][]*AgentIdentity
+	// lineage maps the hash of every registered lineage entry to its
+	// agent's root, to resolve fork links.
+	lineage map[string]string
+}
+
+// NewIdentityRegistry returns a registry over store, indexing the
+// identities it already holds. Stored identities that fail verification,
+// or that Register would have refused, are skipped.
+func NewIdentityRegistry(store IdentityStore) (*IdentityRegistry, error) {
+	if store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: identity store is required")
+	}
+	r := &IdentityRegistry{
+		store:    store,
+		roots:    make(map[string]string),
+		versions: make(map[string][]*AgentIdentity),
+		lineage:  make(map[string]string),
+	}
+	stored, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(stored, func(i, j int) bool { return lineageLength(stored[i]) < lineageLength(stored[j]) })
+	for _, identity := range stored {
+		if result, err := VerifyIdentity(identity); err != nil || !result.Valid {
+			continue
+		}
+		if versions := r.versions[lineageRoot(identity)]; len(versions) > 0 && checkSuccessor(versions[len(versions)-1], identity) != nil {
+			continue
+		}
+		r.index(identity)
+	}
+	return r, nil
+}
+
+// Register verifies identity and adds it to the registry. A version
+// already registered is accepted again without change.
+func (r *IdentityRegistry) Register(identity *AgentIdentity) error {
+	if identity == nil {
+		return errorf(ErrCodeMissingField, "grith: identity is required")
+	}
+	result, err := VerifyIdentity(identity)
+	if err != nil {
+		return err
+	}
+	if !result.Valid {
+		return errorf(ErrCodeInvalidInput, "grith: identity %s failed verification: %s", shortID(identity.ID), failedCheckNames(result.Checks))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.roots[identity.ID]; ok {
+		return nil
+	}
+	root := lineageRoot(identity)
+	if versions := r.versions[root]; len(versions) > 0 {
+		if err := checkSuccessor(versions[len(versions)-1], identity); err != nil {
+			return err
+		}
+	}
+	copied, err := deepCopyIdentity(identity)
+	if err != nil {
+		return errorf(ErrCodeSerialization, "grith: failed to copy identity: %w", err)
+	}
+	if err := r.store.Put(copied); err != nil {
+		return err
+	}
+	r.index(copied)
+	return nil
+}
+
+// checkSuccessor checks that next extends latest's lineage and that any
+// change of operator key between them is a chain of key rotations,
+// recoveries, or operator set changes, each authorized by the key or set
+// it replaces or, for a recovery, by the recovery keys.
+func checkSuccessor(latest, next *AgentIdentity) error {
+	if lineageLength(next) <= lineageLength(latest) {
+		return errorf(ErrCodeInvalidInput, "grith: identity %s is not newer than registered version %s", shortID(next.ID), shortID(latest.ID))
+	}
+	start, err := matchLineage(latest, next)
+	if err != nil {
+		return err
+	}
+	// VerifyIdentity has checked that set changes are signed by the set
+	// they replace; a first set must be signed by the single key.
+	key, set := latest.OperatorPublicKey, latest.Operators
+	for i := range next.Lineage[start:] {
+		e := &next.Lineage[start+i]
+		switch {
+		case e.Operators != nil:
+			if set == nil && !lineageSignedBy(e, key) {
+				return errorf(ErrCodeInvalidInput, "grith: identity %s adopts an operator set not signed by its operator key", shortID(next.ID))
+			}
+			key, set = e.Operators.Keys[0], e.Operators
+		case (e.ChangeType == ChangeOperatorKeyRotation || e.ChangeType == ChangeOperatorKeyRecovery) && e.PreviousOperatorKey == key:
+			key = e.NewOperatorKey
+		}
+	}
+	if key != next.OperatorPublicKey {
+		return errorf(ErrCodeInvalidInput, "grith: identity %s changes operator key without a key rotation", shortID(next.ID))
+	}
+	return nil
+}
+
+// matchLineage checks that next's lineage carries every entry of
+// latest's and returns the index in next.Lineage of the first entry
+// after them. A compaction in next may replace a prefix of latest's
+// entries with a summary, which must commit to exactly those entries; a
+// compaction of entries the registry has not seen is refused, since the
+// operator changes among them cannot be checked.
+func matchLineage(latest, next *AgentIdentity) (int, error) {
+	from, shift := 0, 0
+	if s := compactionSummary(next); s != nil && next.Lineage[0].IdentityHash != latest.Lineage[0].IdentityHash {
+		if s.Count > len(latest.Lineage) {
+			return 0, errorf(ErrCodeInvalidInput, "grith: identity %s compacts lineage entries that registered version %s does not have", shortID(next.ID), shortID(latest.ID))
+		}
+		leaves, err := lineageLeafHashes(latest.Lineage[:s.Count])
+		if err != nil {
+			return 0, err
+		}
+		if root, err := MerkleRoot(leaves); err != nil || root != s.MerkleRoot || !summaryKeysMatch(s, latest.Lineage[:s.Count]) {
+			return 0, errorf(ErrCodeInvalidInput, "grith: identity %s compacts a lineage that differs from registered version %s", shortID(next.ID), shortID(latest.ID))
+		}
+		from, shift = s.Count, s.Count-1
+	}
+	for i := from; i < len(latest.Lineage); i++ {
+		e := &latest.Lineage[i]
+		if j := i - shift; j >= len(next.Lineage) || next.Lineage[j].IdentityHash != e.IdentityHash || next.Lineage[j].Signature != e.Signature {
+			return 0, errorf(ErrCodeInvalidInput, "grith: identity %s forks from registered version %s at lineage entry %d", shortID(next.ID), shortID(latest.ID), i)
+		}
+	}
+	return len(latest.Lineage) - shift, nil
+}
+
+func lineageSignedBy(e *LineageEntry, key string) bool {
+	payload, err := lineageSigningPayload(e)
+	if err != nil {
+		return false
+	}
+	pub, err := FromHex(key)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := FromHex(e.Signature)
+	return err == nil && Verify([]byte(payload), sig, ed25519.PublicKey(pub))
+}
+
+// index records identity as a version of its agent. The caller holds the
+// lock or has sole access.
+func (r *IdentityRegistry) index(identity *AgentIdentity) {
+	root := lineageRoot(identity)
+	r.roots[identity.ID] = root
+	r.versions[root] = append(r.versions[root], identity)
+	for _, e := range identity.Lineage {
+		r.lineage[e.IdentityHash] = root
+	}
+}
+
+// Resolve returns the latest registered version of the agent that
+// identity id belongs to; id may name any of its versions. Returns nil if
+// the ID is not registered.
+func (r *IdentityRegistry) Resolve(id string) (*AgentIdentity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	root, ok := r.roots[id]
+	if !ok {
+		return nil, nil
+	}
+	versions := r.versions[root]
+	return deepCopyIdentity(versions[len(versions)-1])
+}
+
+// ResolveByOperator returns the latest version of every registered agent
+// currently held under the hex operator key, ordered by ID.
+func (r *IdentityRegistry) ResolveByOperator(publicKey string) ([]*AgentIdentity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []*AgentIdentity
+	for _, versions := range r.versions {
+		latest := versions[len(versions)-1]
+		if latest.OperatorPublicKey != publicKey {
+			continue
+		}
+		copied, err := deepCopyIdentity(latest)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, copied)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// History returns every registered version of the agent that identity id
+// belongs to, oldest first. Returns nil if the ID is not registered.
+func (r *IdentityRegistry) History(id string) ([]*AgentIdentity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	root, ok := r.roots[id]
+	if !ok {
+		return nil, nil
+	}
+	versions := r.versions[root]
+	result := make([]*AgentIdentity, 0, len(versions))
+	for _, v := range versions {
+		copied, err := deepCopyIdentity(v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, copied)
+	}
+	return result, nil
+}
+
+// checkIssuerIdentity resolves the issuer's Party.ID in registry and
+// requires the latest version of that identity to be held under the
+// issuer's key and, given revocations, not to be revoked.
+func checkIssuerIdentity(doc *CovenantDocument, registry *IdentityRegistry, resolver DIDResolver, revocations []IdentityRevocation, now time.Time) VerificationCheck {
+	check := VerificationCheck{Name: "issuer_identity", Code: CheckIssuerIdentity}
+	identity, err := registry.Resolve(doc.Issuer.ID)
+	if err != nil {
+		check.Message = fmt.Sprintf("Identity registry error: %v", err)
+		return check
+	}
+	if identity == nil {
+		check.Message = fmt.Sprintf("Issuer %s is not a registered identity", shortID(doc.Issuer.ID))
+		return check
+	}
+	key, err := resolvePartyKey(doc.Issuer, resolver)
+	if err != nil {
+		check.Message = fmt.Sprintf("Cannot resolve issuer key: %v", err)
+		return check
+	}
+	if identity.OperatorPublicKey != ToHex(key) {
+		check.Message = fmt.Sprintf("Issuer identity %s is held under a different operator key", shortID(identity.ID))
+		return check
+	}
+	if rev := revocationFor(identity, revocations, now); rev != nil {
+		check.Message = fmt.Sprintf("Issuer identity was revoked (%s) effective %s", rev.Reason, rev.EffectiveAt)
+		return check
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("Issuer is registered identity %s (version %d)", shortID(identity.ID), identity.Version)
+	return check
+}
+
+// ForkParent returns the latest registered version of the agent that the
+// agent identity id belongs to was forked from, after checking the fork
+// with VerifyFork. Returns nil if id is not registered, is not a fork, or
+// its parent is not registered.
+func (r *IdentityRegistry) ForkParent(id string) (*AgentIdentity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	root, ok := r.roots[id]
+	if !ok {
+		return nil, nil
+	}
+	versions := r.versions[root]
+	link := ForkOf(versions[0])
+	if link == nil {
+		return nil, nil
+	}
+	parentRoot, ok := r.lineage[link.ParentLineageHash]
+	if !ok {
+		return nil, nil
+	}
+	parents := r.versions[parentRoot]
+	parent := parents[len(parents)-1]
+	if err := VerifyFork(versions[len(versions)-1], parent); err != nil {
+		return nil, err
+	}
+	return deepCopyIdentity(parent)
+}
+
+// Forks returns the latest version of every registered agent forked from
+// the agent that identity id belongs to, ordered by ID.
+func (r *IdentityRegistry) Forks(id string) ([]*AgentIdentity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	root, ok := r.roots[id]
+	if !ok {
+		return nil, nil
+	}
+	var result []*AgentIdentity
+	for _, versions := range r.versions {
+		link := ForkOf(versions[0])
+		if link == nil || r.lineage[link.ParentLineageHash] != root {
+			continue
+		}
+		copied, err := deepCopyIdentity(versions[len(versions)-1])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, copied)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
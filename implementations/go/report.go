@@ -0,0 +1,228 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+)
+
+// ComplianceReportFormat identifies the signed compliance report format.
+const ComplianceReportFormat = "grith-compliance-report/1"
+
+// ReportPeriod is the stretch of an action log a compliance report covers.
+type ReportPeriod struct {
+	FirstIndex int64  `json:"firstIndex"`
+	LastIndex  int64  `json:"lastIndex"`
+	Start      string `json:"start"`
+	End        string `json:"end"`
+}
+
+// SignedComplianceReport is an archivable record of a compliance audit:
+// which log was examined, which checks ran, and what they found, signed by
+// the verifier who produced it. Checkpoints commit to the exact log that
+// was audited, so the report can later be matched against the log itself.
+type SignedComplianceReport struct {
+	Format      string `json:"format"`
+	ID          string `json:"id"`
+	CovenantID  string `json:"covenantId"`
+	GeneratedAt string `json:"generatedAt"`
+	// Period is nil for an empty log.
+	Period *ReportPeriod `json:"period,omitempty"`
+	// Compliant is true when no fatal check failed.
+	Compliant         bool                `json:"compliant"`
+	Checks            []VerificationCheck `json:"checks"`
+	Compliance        ComplianceReport    `json:"compliance"`
+	Checkpoints       []LogCheckpoint     `json:"checkpoints"`
+	VerifierPublicKey string              `json:"verifierPublicKey"`
+	Signature         string              `json:"signature"`
+}
+
+// ComplianceReportOptions configure GenerateComplianceReportWithOptions.
+type ComplianceReportOptions struct {
+	// Covenant configures verification of the covenant. Its Now field is
+	// ignored: time checks are evaluated at the last logged action.
+	Covenant *VerifyOptions
+	// Replay configures the compliance replay.
+	Replay *ReplayOptions
+}
+
+// GenerateComplianceReport audits log against covenant and returns a
+// report signed by verifierKP.
+func GenerateComplianceReport(covenant *CovenantDocument, log *ActionLog, verifierKP *KeyPair) (*SignedComplianceReport, error) {
+	return GenerateComplianceReportWithOptions(covenant, log, verifierKP, nil)
+}
+
+// GenerateComplianceReportWithOptions audits log against covenant and
+// returns a report signed by verifierKP. The report runs three checks:
+//
+//   - covenant   - the covenant passes verification, evaluated at the last logged action
+//   - action_log - entries chain, are signed by the beneficiary, and fall
+//     within the covenant's validity period
+//   - compliance - replaying the log finds no violations
+//
+// and references a checkpoint over the audited log. Failed checks are
+// recorded in the report; an error is returned only if the report cannot
+// be produced.
+func GenerateComplianceReportWithOptions(covenant *CovenantDocument, log *ActionLog, verifierKP *KeyPair, opts *ComplianceReportOptions) (*SignedComplianceReport, error) {
+	if covenant == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: covenant is required")
+	}
+	if log == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: action log is required")
+	}
+	if verifierKP == nil || len(verifierKP.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: privateKey must be %d bytes", ed25519.PrivateKeySize)
+	}
+	if log.doc.ID != covenant.ID {
+		return nil, errorf(ErrCodeInvalidInput, "grith: action log belongs to covenant %s", shortID(log.doc.ID))
+	}
+	if opts == nil {
+		opts = &ComplianceReportOptions{}
+	}
+
+	entries := log.Entries()
+	report := &SignedComplianceReport{
+		Format:            ComplianceReportFormat,
+		CovenantID:        covenant.ID,
+		GeneratedAt:       Timestamp(),
+		Checkpoints:       []LogCheckpoint{},
+		VerifierPublicKey: verifierKP.PublicKeyHex,
+	}
+	if len(entries) > 0 {
+		first, last := entries[0], entries[len(entries)-1]
+		report.Period = &ReportPeriod{FirstIndex: first.Index, LastIndex: last.Index, Start: first.Timestamp, End: last.Timestamp}
+		cp, err := CreateLogCheckpoint(entries, log.agent)
+		if err != nil {
+			return nil, err
+		}
+		report.Checkpoints = append(report.Checkpoints, *cp)
+	}
+
+	bundle := &AccountabilityBundle{
+		Covenant:     covenant,
+		PreviousHash: ActionLogGenesisHash,
+		Entries:      entries,
+		ExportedAt:   report.GeneratedAt,
+	}
+	var resolver DIDResolver
+	covOpts := VerifyOptions{}
+	if opts.Covenant != nil {
+		covOpts = *opts.Covenant
+		resolver = opts.Covenant.DIDResolver
+	}
+	covOpts.Now = bundleEvaluationTime(bundle)
+	covResult, err := VerifyCovenantWithOptions(covenant, &covOpts)
+	if err != nil {
+		return nil, err
+	}
+	report.Compliance = ReplayComplianceWithOptions(covenant, entries, opts.Replay)
+	report.Checks = []VerificationCheck{
+		bundleCovenantCheck(covResult),
+		bundleLogCheck(bundle, resolver),
+		complianceCheck(&report.Compliance),
+	}
+	report.Compliant, _ = aggregateChecks(report.Checks)
+
+	payload, err := complianceReportPayload(report)
+	if err != nil {
+		return nil, err
+	}
+	report.ID = SHA256Hex(payload)
+	sig, err := Sign(payload, verifierKP.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign compliance report: %w", err)
+	}
+	report.Signature = ToHex(sig)
+	return report, nil
+}
+
+func complianceCheck(r *ComplianceReport) VerificationCheck {
+	check := VerificationCheck{Name: "compliance", Code: CheckCompliance, Passed: r.Compliant}
+	switch {
+	case r.Error != "":
+		check.Message = fmt.Sprintf("Compliance replay failed: %s", r.Error)
+	case !r.Compliant:
+		check.Message = fmt.Sprintf("Replay found %s", plural(len(r.Violations), "violation", "violations"))
+	default:
+		check.Message = fmt.Sprintf("%s replayed without violations", plural(r.Entries, "log entry", "log entries"))
+	}
+	return check
+}
+
+// complianceReportPayload is the canonical form of r that its ID hashes
+// and its signature covers.
+func complianceReportPayload(r *SignedComplianceReport) ([]byte, error) {
+	m, err := objectToMap(r)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to convert compliance report to map: %w", err)
+	}
+	delete(m, "id")
+	delete(m, "signature")
+	canonical, err := CanonicalizeJSON(m)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to canonicalize compliance report: %w", err)
+	}
+	return []byte(canonical), nil
+}
+
+// VerifyComplianceReport checks that r is intact: its ID matches its
+// contents, the verifier's signature is valid, and its checkpoints are
+// signed and belong to the covenant. It does not re-run the audit; to
+// trust the findings, also check that r.VerifierPublicKey is a verifier
+// you trust.
+func VerifyComplianceReport(r *SignedComplianceReport) error {
+	if r == nil {
+		return errorf(ErrCodeMissingField, "grith: compliance report is required")
+	}
+	if r.Format != ComplianceReportFormat {
+		return errorf(ErrCodeUnsupportedVersion, "grith: unsupported compliance report format: %q", r.Format)
+	}
+	payload, err := complianceReportPayload(r)
+	if err != nil {
+		return err
+	}
+	if r.ID != SHA256Hex(payload) {
+		return errorf(ErrCodeInvalidInput, "grith: compliance report ID does not match its contents")
+	}
+	pub, err := FromHex(r.VerifierPublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errorf(ErrCodeInvalidInput, "grith: compliance report verifier key is invalid")
+	}
+	sig, err := FromHex(r.Signature)
+	if err != nil || !Verify(payload, sig, ed25519.PublicKey(pub)) {
+		return errorf(ErrCodeCrypto, "grith: compliance report signature is invalid")
+	}
+	for i := range r.Checkpoints {
+		cp := &r.Checkpoints[i]
+		if cp.CovenantID != r.CovenantID {
+			return errorf(ErrCodeInvalidInput, "grith: checkpoint at size %d belongs to covenant %s", cp.Size, shortID(cp.CovenantID))
+		}
+		if err := VerifyLogCheckpoint(cp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SerializeComplianceReport returns the canonical JSON form of r, suitable
+// for archiving.
+func SerializeComplianceReport(r *SignedComplianceReport) (string, error) {
+	m, err := objectToMap(r)
+	if err != nil {
+		return "", errorf(ErrCodeSerialization, "grith: failed to serialize compliance report: %w", err)
+	}
+	return CanonicalizeJSON(m)
+}
+
+// ParseComplianceReport decodes a compliance report and verifies it with
+// VerifyComplianceReport.
+func ParseComplianceReport(data []byte) (*SignedComplianceReport, error) {
+	var r SignedComplianceReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "grith: invalid compliance report JSON: %w", err)
+	}
+	if err := VerifyComplianceReport(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
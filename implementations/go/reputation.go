@@ -0,0 +1,372 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReputationEventType classifies a reputation event.
+type ReputationEventType string
+
+const (
+	// ReputationCompliance records a compliance audit the agent passed.
+	ReputationCompliance ReputationEventType = "compliance_report"
+	// ReputationViolation records a breach of a covenant.
+	ReputationViolation ReputationEventType = "violation"
+	// ReputationAttestation records any other statement about the agent,
+	// such as a counterparty's review.
+	ReputationAttestation ReputationEventType = "attestation"
+)
+
+// ReputationEvent is a signed statement that adds Delta to an agent's
+// reputation. It names the identity version it was earned by, so events
+// follow the agent through later evolutions at their carry-forward rates.
+type ReputationEvent struct {
+	ID         string              `json:"id"`
+	Type       ReputationEventType `json:"type"`
+	IdentityID string              `json:"identityId"`
+	// LineageHash is the identity hash of the version's latest lineage
+	// entry, which every later version of the identity carries.
+	LineageHash string  `json:"lineageHash"`
+	Delta       float64 `json:"delta"`
+	// Evidence identifies the artifact backing the event, e.g. the ID of
+	// a signed compliance report.
+	Evidence        string `json:"evidence,omitempty"`
+	Description     string `json:"description,omitempty"`
+	Timestamp       string `json:"timestamp"`
+	IssuerPublicKey string `json:"issuerPublicKey"`
+	Signature       string `json:"signature"`
+}
+
+// ReputationEventOptions are the options for IssueReputationEvent.
+type ReputationEventOptions struct {
+	Type        ReputationEventType
+	Delta       float64
+	Evidence    string
+	Description string
+	// Timestamp defaults to the current time.
+	Timestamp time.Time
+}
+
+// ReputationPolicy configures how a Reputation weighs events.
+type ReputationPolicy struct {
+	// HalfLife is the age at which an event counts for half its delta.
+	// Zero disables decay.
+	HalfLife time.Duration
+	// Issuers, if set, are the hex public keys whose events are accepted.
+	Issuers []string
+}
+
+// ReputationEvidence is one event's contribution to a score.
+type ReputationEvidence struct {
+	Event        ReputationEvent `json:"event"`
+	Decay        float64         `json:"decay"`
+	CarryForward float64         `json:"carryForward"`
+	Contribution float64         `json:"contribution"`
+}
+
+// ReputationScore is an agent's reputation at a point in time with the
+// events it was computed from. Anyone holding the identity can check it
+// with VerifyReputationScore.
+type ReputationScore struct {
+	IdentityID string               `json:"identityId"`
+	Score      float64              `json:"score"`
+	ComputedAt string               `json:"computedAt"`
+	HalfLife   string               `json:"halfLife,omitempty"`
+	Evidence   []ReputationEvidence `json:"evidence"`
+}
+
+// IssueReputationEvent signs an event about identity's current version.
+func IssueReputationEvent(identity *AgentIdentity, kp *KeyPair, opts *ReputationEventOptions) (*ReputationEvent, error) {
+	if identity == nil || len(identity.Lineage) == 0 {
+		return nil, errorf(ErrCodeMissingField, "grith: identity with a lineage is required")
+	}
+	if opts == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: reputation event options are required")
+	}
+	if kp == nil || len(kp.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: privateKey must be %d bytes", ed25519.PrivateKeySize)
+	}
+	if err := checkReputationEventType(opts.Type); err != nil {
+		return nil, err
+	}
+	if math.IsNaN(opts.Delta) || math.IsInf(opts.Delta, 0) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: reputation delta must be finite")
+	}
+	ts := Timestamp()
+	if !opts.Timestamp.IsZero() {
+		ts = opts.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	e := &ReputationEvent{
+		Type:            opts.Type,
+		IdentityID:      identity.ID,
+		LineageHash:     identity.Lineage[len(identity.Lineage)-1].IdentityHash,
+		Delta:           opts.Delta,
+		Evidence:        opts.Evidence,
+		Description:     opts.Description,
+		Timestamp:       ts,
+		IssuerPublicKey: kp.PublicKeyHex,
+	}
+	payload, err := reputationEventPayload(e)
+	if err != nil {
+		return nil, err
+	}
+	e.ID = SHA256Hex(payload)
+	sig, err := Sign(payload, kp.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign reputation event: %w", err)
+	}
+	e.Signature = ToHex(sig)
+	return e, nil
+}
+
+// ReputationEventFromReport turns a verified compliance report on a
+// covenant the identity acted under into a reputation event: +1 for a
+// compliant log, or -1 per violation found.
+func ReputationEventFromReport(identity *AgentIdentity, report *SignedComplianceReport, kp *KeyPair) (*ReputationEvent, error) {
+	if err := VerifyComplianceReport(report); err != nil {
+		return nil, err
+	}
+	at, err := parseTimestamp(report.GeneratedAt)
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: compliance report has an invalid generation time")
+	}
+	opts := &ReputationEventOptions{
+		Type:        ReputationCompliance,
+		Delta:       1,
+		Evidence:    report.ID,
+		Description: "Compliant with covenant " + shortID(report.CovenantID),
+		Timestamp:   at,
+	}
+	if !report.Compliant {
+		violations := len(report.Compliance.Violations) + report.Compliance.Omitted
+		if violations == 0 {
+			violations = 1
+		}
+		opts.Type = ReputationViolation
+		opts.Delta = -float64(violations)
+		opts.Description = plural(violations, "violation", "violations") + " of covenant " + shortID(report.CovenantID)
+	}
+	return IssueReputationEvent(identity, kp, opts)
+}
+
+func checkReputationEventType(t ReputationEventType) error {
+	switch t {
+	case ReputationCompliance, ReputationViolation, ReputationAttestation:
+		return nil
+	case "":
+		return errorf(ErrCodeMissingField, "grith: reputation event type is required")
+	}
+	return errorf(ErrCodeInvalidInput, "grith: unknown reputation event type %q", t)
+}
+
+func reputationEventPayload(e *ReputationEvent) ([]byte, error) {
+	m, err := objectToMap(e)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to convert reputation event to map: %w", err)
+	}
+	delete(m, "id")
+	delete(m, "signature")
+	canonical, err := CanonicalizeJSON(m)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to canonicalize reputation event: %w", err)
+	}
+	return []byte(canonical), nil
+}
+
+// VerifyReputationEvent checks an event's ID and signature.
+func VerifyReputationEvent(e *ReputationEvent) error {
+	if e == nil {
+		return errorf(ErrCodeMissingField, "grith: reputation event is required")
+	}
+	if err := checkReputationEventType(e.Type); err != nil {
+		return err
+	}
+	if _, err := parseTimestamp(e.Timestamp); err != nil {
+		return errorf(ErrCodeInvalidInput, "grith: reputation event has an invalid timestamp")
+	}
+	payload, err := reputationEventPayload(e)
+	if err != nil {
+		return err
+	}
+	if e.ID != SHA256Hex(payload) {
+		return errorf(ErrCodeInvalidInput, "grith: reputation event ID does not match its contents")
+	}
+	pub, err := FromHex(e.IssuerPublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errorf(ErrCodeInvalidInput, "grith: reputation event issuer key is invalid")
+	}
+	sig, err := FromHex(e.Signature)
+	if err != nil || !Verify(payload, sig, ed25519.PublicKey(pub)) {
+		return errorf(ErrCodeCrypto, "grith: reputation event %s has an invalid signature", shortID(e.ID))
+	}
+	return nil
+}
+
+// Reputation accumulates verified reputation events and scores agents
+// from them. It is safe for concurrent use.
+type Reputation struct {
+	mu     sync.RWMutex
+	policy ReputationPolicy
+	events []ReputationEvent
+	seen   map[string]bool
+}
+
+// NewReputation creates an empty Reputation applying policy.
+func NewReputation(policy *ReputationPolicy) *Reputation {
+	r := &Reputation{seen: make(map[string]bool)}
+	if policy != nil {
+		r.policy = *policy
+		r.policy.Issuers = append([]string(nil), policy.Issuers...)
+	}
+	return r
+}
+
+// Record verifies e and adds it. Recording the same event twice has no
+// effect.
+func (r *Reputation) Record(e *ReputationEvent) error {
+	if err := VerifyReputationEvent(e); err != nil {
+		return err
+	}
+	if len(r.policy.Issuers) > 0 {
+		trusted := false
+		for _, k := range r.policy.Issuers {
+			if k == e.IssuerPublicKey {
+				trusted = true
+				break
+			}
+		}
+		if !trusted {
+			return errorf(ErrCodeInvalidInput, "grith: reputation event %s is from an untrusted issuer", shortID(e.ID))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.seen[e.ID] {
+		r.seen[e.ID] = true
+		r.events = append(r.events, *e)
+	}
+	return nil
+}
+
+// Score computes identity's reputation at the given time (the current
+// time if zero) from the recorded events about it or its earlier
+// versions. Events recorded after that time are left out.
+func (r *Reputation) Score(identity *AgentIdentity, at time.Time) (*ReputationScore, error) {
+	if identity == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: identity is required")
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	r.mu.RLock()
+	events := append([]ReputationEvent(nil), r.events...)
+	r.mu.RUnlock()
+	return computeReputation(identity, events, r.policy.HalfLife, at), nil
+}
+
+// computeReputation sums each event's delta, decayed by its age and
+// multiplied by the carry-forward rates of every lineage entry after the
+// version it names. Events about other identities are ignored.
+func computeReputation(identity *AgentIdentity, events []ReputationEvent, halfLife time.Duration, at time.Time) *ReputationScore {
+	score := &ReputationScore{
+		IdentityID: identity.ID,
+		ComputedAt: at.UTC().Format("2006-01-02T15:04:05.000Z"),
+		Evidence:   []ReputationEvidence{},
+	}
+	if halfLife > 0 {
+		score.HalfLife = halfLife.String()
+	}
+	at, _ = parseTimestamp(score.ComputedAt)
+
+	position := make(map[string]int, len(identity.Lineage))
+	for i, e := range identity.Lineage {
+		position[e.IdentityHash] = i
+	}
+	for _, e := range events {
+		i, ok := position[e.LineageHash]
+		if !ok {
+			continue
+		}
+		ts, err := parseTimestamp(e.Timestamp)
+		if err != nil || ts.After(at) {
+			continue
+		}
+		carry := 1.0
+		for _, later := range identity.Lineage[i+1:] {
+			carry *= later.ReputationCarryForward
+		}
+		decay := 1.0
+		if halfLife > 0 {
+			decay = math.Pow(0.5, float64(at.Sub(ts))/float64(halfLife))
+		}
+		contribution := e.Delta * decay * carry
+		score.Evidence = append(score.Evidence, ReputationEvidence{
+			Event:        e,
+			Decay:        decay,
+			CarryForward: carry,
+			Contribution: contribution,
+		})
+	}
+	sort.SliceStable(score.Evidence, func(i, j int) bool {
+		a, b := score.Evidence[i].Event, score.Evidence[j].Event
+		if a.Timestamp != b.Timestamp {
+			return a.Timestamp < b.Timestamp
+		}
+		return a.ID < b.ID
+	})
+	for _, ev := range score.Evidence {
+		score.Score += ev.Contribution
+	}
+	return score
+}
+
+// VerifyReputationScore checks that score is identity's reputation as
+// computed from its evidence: every event is validly signed and applies
+// to the identity, and the decay, carry-forward, and total are correct.
+// It does not show that events were left out; a verifier wanting that
+// assurance must trust the party that computed the score.
+func VerifyReputationScore(identity *AgentIdentity, score *ReputationScore) error {
+	if identity == nil || score == nil {
+		return errorf(ErrCodeMissingField, "grith: identity and score are required")
+	}
+	if score.IdentityID != identity.ID {
+		return errorf(ErrCodeInvalidInput, "grith: score is for identity %s, not %s", shortID(score.IdentityID), shortID(identity.ID))
+	}
+	at, err := parseTimestamp(score.ComputedAt)
+	if err != nil {
+		return errorf(ErrCodeInvalidInput, "grith: score has an invalid computation time")
+	}
+	var halfLife time.Duration
+	if score.HalfLife != "" {
+		if halfLife, err = time.ParseDuration(score.HalfLife); err != nil || halfLife <= 0 {
+			return errorf(ErrCodeInvalidInput, "grith: score has an invalid half-life %q", score.HalfLife)
+		}
+	}
+	events := make([]ReputationEvent, len(score.Evidence))
+	for i := range score.Evidence {
+		if err := VerifyReputationEvent(&score.Evidence[i].Event); err != nil {
+			return err
+		}
+		events[i] = score.Evidence[i].Event
+	}
+	want := computeReputation(identity, events, halfLife, at)
+	if len(want.Evidence) != len(score.Evidence) {
+		return errorf(ErrCodeInvalidInput, "grith: score includes %s that do not apply to the identity", plural(len(score.Evidence)-len(want.Evidence), "event", "events"))
+	}
+	const epsilon = 1e-9
+	for i, ev := range want.Evidence {
+		got := score.Evidence[i]
+		if got.Event.ID != ev.Event.ID || math.Abs(got.Decay-ev.Decay) > epsilon ||
+			math.Abs(got.CarryForward-ev.CarryForward) > epsilon || math.Abs(got.Contribution-ev.Contribution) > epsilon {
+			return errorf(ErrCodeInvalidInput, "grith: score evidence for event %s is incorrect", shortID(ev.Event.ID))
+		}
+	}
+	if math.Abs(score.Score-want.Score) > epsilon*math.Max(1, math.Abs(want.Score)) {
+		return errorf(ErrCodeInvalidInput, "grith: score %g does not match its evidence (%g)", score.Score, want.Score)
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// RevocationReason says why an identity was revoked.
+type RevocationReason string
+
+const (
+	// RevocationKeyCompromise revokes an operator key: every identity
+	// currently held under it, and every covenant it issues, is no longer
+	// trusted from the effective time on.
+	RevocationKeyCompromise RevocationReason = "key_compromise"
+	// RevocationDecommissioned retires an agent: the revoked identity and
+	// any later evolution of it are no longer trusted.
+	RevocationDecommissioned RevocationReason = "decommissioned"
+)
+
+// IdentityRevocation is a signed declaration that an agent identity is no
+// longer to be trusted. It is signed by the identity's operator key.
+type IdentityRevocation struct {
+	IdentityID string `json:"identityId"`
+	// LineageHash is the identity hash of the revoked version's latest
+	// lineage entry, which every later version of the identity carries.
+	LineageHash string `json:"lineageHash"`
+	// AgentRoot is the hash of the agent's creation entry, which lets a
+	// decommissioning reach versions whose lineage compaction pruned
+	// LineageHash.
+	AgentRoot         string           `json:"agentRoot,omitempty"`
+	OperatorPublicKey string           `json:"operatorPublicKey"`
+	Reason            RevocationReason `json:"reason"`
+	Description       string           `json:"description,omitempty"`
+	RevokedAt         string           `json:"revokedAt"`
+	// EffectiveAt is when the identity stopped being trustworthy. For a
+	// key compromise it may be earlier than RevokedAt.
+	EffectiveAt string `json:"effectiveAt"`
+	Signature   string `json:"signature"`
+}
+
+// RevokeIdentityOptions are the options for RevokeIdentity.
+type RevokeIdentityOptions struct {
+	Reason      RevocationReason
+	Description string
+	// EffectiveAt defaults to the time of revocation.
+	EffectiveAt time.Time
+}
+
+// IdentityVerifyOptions configure VerifyIdentityWithOptions.
+type IdentityVerifyOptions struct {
+	// Revocations known to the verifier. Invalid revocations are ignored.
+	Revocations []IdentityRevocation
+	// Now is the instant at which revocations are evaluated. Defaults to
+	// the current time.
+	Now time.Time
+	// AttestationVerifiers, if set, add a tee_attestation check: an
+	// identity deployed on RuntimeTEE must carry an attestation that one
+	// of them verifies.
+	AttestationVerifiers []AttestationVerifier
+	// MaxAge, if positive, adds a not_expired check: the identity version
+	// must have been issued within MaxAge of Now, so that operators
+	// re-issue identities periodically.
+	MaxAge time.Duration
+	// ModelVerifiers, if set, add a model_attestation check: the
+	// identity's model attestation must be verified by the verifier for
+	// its provider.
+	ModelVerifiers []ModelAttestationVerifier
+}
+
+// RevokeIdentity signs a revocation of identity with its operator key.
+func RevokeIdentity(identity *AgentIdentity, kp *KeyPair, opts *RevokeIdentityOptions) (*IdentityRevocation, error) {
+	if identity == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: identity is required")
+	}
+	if opts == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: revocation options are required")
+	}
+	if kp == nil || len(kp.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: privateKey must be %d bytes", ed25519.PrivateKeySize)
+	}
+	if kp.PublicKeyHex != identity.OperatorPublicKey {
+		return nil, errorf(ErrCodeInvalidInput, "grith: only the operator key can revoke an identity")
+	}
+	switch opts.Reason {
+	case RevocationKeyCompromise, RevocationDecommissioned:
+	case "":
+		return nil, errorf(ErrCodeMissingField, "grith: revocation reason is required")
+	default:
+		return nil, errorf(ErrCodeInvalidInput, "grith: unknown revocation reason %q", opts.Reason)
+	}
+	if len(identity.Lineage) == 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: identity has no lineage")
+	}
+
+	now := Timestamp()
+	effective := now
+	if !opts.EffectiveAt.IsZero() {
+		effective = opts.EffectiveAt.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	r := &IdentityRevocation{
+		IdentityID:        identity.ID,
+		LineageHash:       identity.Lineage[len(identity.Lineage)-1].IdentityHash,
+		AgentRoot:         lineageRoot(identity),
+		OperatorPublicKey: kp.PublicKeyHex,
+		Reason:            opts.Reason,
+		Description:       opts.Description,
+		RevokedAt:         now,
+		EffectiveAt:       effective,
+	}
+	payload, err := signedPayload(r)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := Sign(payload, kp.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to sign revocation: %w", err)
+	}
+	r.Signature = ToHex(sig)
+	return r, nil
+}
+
+// VerifyIdentityRevocation checks a revocation's signature and fields. It
+// does not say which identities the revocation applies to.
+func VerifyIdentityRevocation(r *IdentityRevocation) error {
+	if r == nil {
+		return errorf(ErrCodeMissingField, "grith: revocation is required")
+	}
+	switch r.Reason {
+	case RevocationKeyCompromise, RevocationDecommissioned:
+	default:
+		return errorf(ErrCodeInvalidInput, "grith: unknown revocation reason %q", r.Reason)
+	}
+	if _, err := parseTimestamp(r.EffectiveAt); err != nil {
+		return errorf(ErrCodeInvalidInput, "grith: revocation has an invalid effective time")
+	}
+	pub, err := FromHex(r.OperatorPublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errorf(ErrCodeInvalidInput, "grith: revocation signer key is invalid")
+	}
+	if !verifyLogSignature(r, r.Signature, ed25519.PublicKey(pub)) {
+		return errorf(ErrCodeCrypto, "grith: revocation of %s has an invalid signature", shortID(r.IdentityID))
+	}
+	return nil
+}
+
+// revocationFor returns the first valid revocation in revocations that is
+// effective at now and applies to identity. A key compromise applies to
+// identities currently held under the revoked key; a decommissioning
+// applies to the revoked version and its descendants, provided it was
+// signed by a key the identity's lineage links to its current key. A
+// decommissioning made before a compaction also applies to the compacted
+// identity, whose lineage may no longer show the revoked version.
+func revocationFor(identity *AgentIdentity, revocations []IdentityRevocation, now time.Time) *IdentityRevocation {
+	for i := range revocations {
+		r := &revocations[i]
+		if !revocationEffective(r, now) {
+			continue
+		}
+		switch r.Reason {
+		case RevocationKeyCompromise:
+			if r.OperatorPublicKey == identity.OperatorPublicKey {
+				return r
+			}
+		case RevocationDecommissioned:
+			if identityHasKey(identity, r.OperatorPublicKey) && (identityHasLineage(identity, r.LineageHash) || prunedBefore(identity, r)) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// revokedKey returns the first valid key compromise revocation of key in
+// revocations that is effective at now.
+func revokedKey(key string, revocations []IdentityRevocation, now time.Time) *IdentityRevocation {
+	for i := range revocations {
+		r := &revocations[i]
+		if r.Reason == RevocationKeyCompromise && r.OperatorPublicKey == key && revocationEffective(r, now) {
+			return r
+		}
+	}
+	return nil
+}
+
+func revocationEffective(r *IdentityRevocation, now time.Time) bool {
+	if VerifyIdentityRevocation(r) != nil {
+		return false
+	}
+	effective, _ := parseTimestamp(r.EffectiveAt)
+	return !now.Before(effective)
+}
+
+// identityHasKey reports whether key is the identity's operator key or
+// one it rotated from.
+func identityHasKey(identity *AgentIdentity, key string) bool {
+	if key == identity.OperatorPublicKey {
+		return true
+	}
+	if s := compactionSummary(identity); s != nil && (key == s.OperatorKey || slices.Contains(s.RotatedKeys, key)) {
+		return true
+	}
+	for _, e := range identity.Lineage {
+		if (e.ChangeType == ChangeOperatorKeyRotation || e.ChangeType == ChangeOperatorKeyRecovery) && (e.PreviousOperatorKey == key || e.NewOperatorKey == key) {
+			return true
+		}
+	}
+	return false
+}
+
+func identityHasLineage(identity *AgentIdentity, hash string) bool {
+	for _, e := range identity.Lineage {
+		if e.IdentityHash == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// prunedBefore reports whether r revokes a version of identity's agent
+// that a compaction made after the revocation may have pruned.
+func prunedBefore(identity *AgentIdentity, r *IdentityRevocation) bool {
+	if r.AgentRoot == "" || compactionSummary(identity) == nil || r.AgentRoot != lineageRoot(identity) {
+		return false
+	}
+	compactedAt, err1 := parseTimestamp(identity.Lineage[0].Timestamp)
+	revokedAt, err2 := parseTimestamp(r.RevokedAt)
+	return err1 == nil && err2 == nil && !compactedAt.Before(revokedAt)
+}
+
+// VerifyIdentityWithOptions runs VerifyIdentity's checks and a
+// not_revoked check that none of opts.Revocations applies to the
+// identity, followed by the optional checks opts enables.
+func VerifyIdentityWithOptions(identity *AgentIdentity, opts *IdentityVerifyOptions) (*IdentityVerificationResult, error) {
+	if identity == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: identity is required")
+	}
+	if opts == nil {
+		opts = &IdentityVerifyOptions{}
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	result, err := VerifyIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
+	checks := append(result.Checks, identityRevocationCheck(identity, opts.Revocations, now))
+	if opts.MaxAge > 0 {
+		checks = append(checks, identityExpiryCheck(identity, opts.MaxAge, now))
+	}
+	if len(opts.AttestationVerifiers) > 0 {
+		checks = append(checks, teeAttestationCheck(identity, opts.AttestationVerifiers, now))
+	}
+	if len(opts.ModelVerifiers) > 0 {
+		checks = append(checks, modelAttestationCheck(identity, opts.ModelVerifiers))
+	}
+	valid, _ := aggregateChecks(checks)
+	return &IdentityVerificationResult{Valid: valid, Checks: checks, Identity: identity}, nil
+}
+
+func identityExpiryCheck(identity *AgentIdentity, maxAge time.Duration, now time.Time) VerificationCheck {
+	check := VerificationCheck{Name: "not_expired", Code: CheckNotExpired}
+	updated, err := parseTimestamp(identity.UpdatedAt)
+	if err != nil {
+		check.Message = fmt.Sprintf("Invalid updatedAt timestamp: %v", err)
+		return check
+	}
+	if now.Sub(updated) > maxAge {
+		check.Message = fmt.Sprintf("Identity version from %s is older than %s", identity.UpdatedAt, maxAge)
+		return check
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("Identity version from %s is current", identity.UpdatedAt)
+	return check
+}
+
+func identityRevocationCheck(identity *AgentIdentity, revocations []IdentityRevocation, now time.Time) VerificationCheck {
+	check := VerificationCheck{Name: "not_revoked", Code: CheckNotRevoked}
+	if r := revocationFor(identity, revocations, now); r != nil {
+		check.Message = fmt.Sprintf("Identity was revoked (%s) effective %s", r.Reason, r.EffectiveAt)
+		return check
+	}
+	check.Passed = true
+	check.Message = "Identity has not been revoked"
+	return check
+}
+
+// checkIssuerNotRevoked fails when the issuer's key has been revoked as
+// compromised.
+func checkIssuerNotRevoked(doc *CovenantDocument, revocations []IdentityRevocation, resolver DIDResolver, now time.Time) VerificationCheck {
+	check := VerificationCheck{Name: "not_revoked", Code: CheckNotRevoked}
+	key, err := resolvePartyKey(doc.Issuer, resolver)
+	if err != nil {
+		check.Message = fmt.Sprintf("Cannot resolve issuer key: %v", err)
+		return check
+	}
+	if r := revokedKey(ToHex(key), revocations, now); r != nil {
+		check.Message = fmt.Sprintf("Issuer key was revoked as compromised effective %s", r.EffectiveAt)
+		return check
+	}
+	check.Passed = true
+	check.Message = "Issuer key has not been revoked"
+	return check
+}
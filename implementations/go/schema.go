@@ -0,0 +1,317 @@
+package grith
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateMetadata validates covenant metadata against a JSON Schema.
+//
+// A practical subset of JSON Schema (draft 2020-12) is supported: type,
+// enum, const, properties, required, additionalProperties, items,
+// minItems, maxItems, uniqueItems, minLength, maxLength, pattern,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, allOf, anyOf,
+// oneOf, and not. Other keywords are ignored. A nil schema accepts any
+// metadata.
+//
+// Violations are reported together as a single error with code
+// ErrCodeSchemaViolation.
+func ValidateMetadata(schema, metadata map[string]interface{}) error {
+	if schema == nil {
+		return nil
+	}
+	// Normalize through JSON so Go values compare like decoded documents
+	var instance interface{} = map[string]interface{}{}
+	if metadata != nil {
+		instance = normalizeJSON(metadata)
+	}
+	schemaValue, ok := normalizeJSON(schema).(map[string]interface{})
+	if !ok {
+		return errorf(ErrCodeInvalidInput, "grith: metadata schema must be a JSON object")
+	}
+
+	var violations []string
+	if err := validateSchema(schemaValue, instance, "$", &violations); err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return errorf(ErrCodeSchemaViolation, "grith: metadata does not match schema: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// validateSchema appends a violation for every way instance fails schema.
+// It returns an error only if the schema itself is malformed.
+func validateSchema(schema map[string]interface{}, instance interface{}, path string, violations *[]string) error {
+	fail := func(format string, args ...interface{}) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok {
+		var types []string
+		switch tv := t.(type) {
+		case string:
+			types = []string{tv}
+		case []interface{}:
+			for _, item := range tv {
+				s, ok := item.(string)
+				if !ok {
+					return errorf(ErrCodeInvalidInput, "grith: invalid schema at %s: type must be a string or array of strings", path)
+				}
+				types = append(types, s)
+			}
+		default:
+			return errorf(ErrCodeInvalidInput, "grith: invalid schema at %s: type must be a string or array of strings", path)
+		}
+		matched := false
+		for _, typ := range types {
+			if schemaTypeMatches(typ, instance) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("expected type %s, got %s", strings.Join(types, " or "), schemaTypeOf(instance))
+			// Further keywords assume the declared type
+			return nil
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, v := range enum {
+			if jsonEqual(v, instance) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value is not one of the allowed values")
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, instance) {
+		fail("value does not match const")
+	}
+
+	switch v := instance.(type) {
+	case map[string]interface{}:
+		if err := validateSchemaObject(schema, v, path, violations); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := validateSchemaArray(schema, v, path, violations); err != nil {
+			return err
+		}
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if min, ok := schemaNumber(schema, "minLength"); ok && n < min {
+			fail("string shorter than %v", min)
+		}
+		if max, ok := schemaNumber(schema, "maxLength"); ok && n > max {
+			fail("string longer than %v", max)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return errorf(ErrCodeInvalidInput, "grith: invalid schema at %s: bad pattern: %w", path, err)
+			}
+			if !re.MatchString(v) {
+				fail("string does not match pattern %q", p)
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(schema, "minimum"); ok && v < min {
+			fail("%v is less than minimum %v", v, min)
+		}
+		if max, ok := schemaNumber(schema, "maximum"); ok && v > max {
+			fail("%v is greater than maximum %v", v, max)
+		}
+		if min, ok := schemaNumber(schema, "exclusiveMinimum"); ok && v <= min {
+			fail("%v is not greater than %v", v, min)
+		}
+		if max, ok := schemaNumber(schema, "exclusiveMaximum"); ok && v >= max {
+			fail("%v is not less than %v", v, max)
+		}
+	}
+
+	return validateSchemaCombinators(schema, instance, path, violations)
+}
+
+func validateSchemaObject(schema, obj map[string]interface{}, path string, violations *[]string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, present := obj[name]; !present {
+				*violations = append(*violations, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		childPath := path + "." + k
+		if sub, ok := props[k]; ok {
+			if err := validateSubschema(sub, obj[k], childPath, violations); err != nil {
+				return err
+			}
+			continue
+		}
+		switch ap := schema["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				*violations = append(*violations, fmt.Sprintf("%s: additional property %q is not allowed", path, k))
+			}
+		case map[string]interface{}:
+			if err := validateSchema(ap, obj[k], childPath, violations); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateSchemaArray(schema map[string]interface{}, arr []interface{}, path string, violations *[]string) error {
+	n := float64(len(arr))
+	if min, ok := schemaNumber(schema, "minItems"); ok && n < min {
+		*violations = append(*violations, fmt.Sprintf("%s: fewer than %v items", path, min))
+	}
+	if max, ok := schemaNumber(schema, "maxItems"); ok && n > max {
+		*violations = append(*violations, fmt.Sprintf("%s: more than %v items", path, max))
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					*violations = append(*violations, fmt.Sprintf("%s: items %d and %d are equal", path, i, j))
+				}
+			}
+		}
+	}
+	if items, ok := schema["items"]; ok {
+		for i, item := range arr {
+			if err := validateSubschema(items, item, fmt.Sprintf("%s[%d]", path, i), violations); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateSchemaCombinators(schema map[string]interface{}, instance interface{}, path string, violations *[]string) error {
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if err := validateSubschema(sub, instance, path, violations); err != nil {
+				return err
+			}
+		}
+	}
+	countMatches := func(subs []interface{}) (int, error) {
+		matches := 0
+		for _, sub := range subs {
+			var scratch []string
+			if err := validateSubschema(sub, instance, path, &scratch); err != nil {
+				return 0, err
+			}
+			if len(scratch) == 0 {
+				matches++
+			}
+		}
+		return matches, nil
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		n, err := countMatches(anyOf)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			*violations = append(*violations, path+": value does not match any of anyOf")
+		}
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		n, err := countMatches(one)
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			*violations = append(*violations, fmt.Sprintf("%s: value matches %d of oneOf, want exactly 1", path, n))
+		}
+	}
+	if not, ok := schema["not"]; ok {
+		n, err := countMatches([]interface{}{not})
+		if err != nil {
+			return err
+		}
+		if n == 1 {
+			*violations = append(*violations, path+": value must not match schema in not")
+		}
+	}
+	return nil
+}
+
+// validateSubschema validates against a nested schema, which may be a
+// boolean (true accepts everything, false rejects everything).
+func validateSubschema(sub, instance interface{}, path string, violations *[]string) error {
+	switch s := sub.(type) {
+	case bool:
+		if !s {
+			*violations = append(*violations, path+": no value is allowed")
+		}
+		return nil
+	case map[string]interface{}:
+		return validateSchema(s, instance, path, violations)
+	}
+	return errorf(ErrCodeInvalidInput, "grith: invalid schema at %s: subschema must be an object or boolean", path)
+}
+
+func schemaTypeMatches(typ string, v interface{}) bool {
+	switch typ {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	}
+	return schemaTypeOf(v) == typ
+}
+
+func schemaTypeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	f, ok := schema[key].(float64)
+	return f, ok
+}
+
+// jsonEqual compares two decoded JSON values structurally.
+func jsonEqual(a, b interface{}) bool {
+	ab, err1 := json.Marshal(a)
+	bb, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(ab) == string(bb)
+}
@@ -0,0 +1,187 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// SnapshotVersion is the snapshot format version written by
+// ExportSnapshot.
+const SnapshotVersion = 1
+
+// SnapshotManifest lists the documents of a store snapshot by ID and
+// hash. A signed manifest commits its signer to every document.
+type SnapshotManifest struct {
+	Version   int             `json:"version"`
+	CreatedAt string          `json:"createdAt"`
+	Documents []SnapshotEntry `json:"documents"`
+	// SignerPublicKey and Signature are set if the snapshot is signed.
+	SignerPublicKey string `json:"signerPublicKey,omitempty"`
+	Signature       string `json:"signature,omitempty"`
+}
+
+// SnapshotEntry identifies one document of a snapshot: its ID and the
+// SHA-256 hash of its canonical JSON.
+type SnapshotEntry struct {
+	ID   string `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// snapshotArchive is the serialized form of a snapshot.
+type snapshotArchive struct {
+	Manifest  SnapshotManifest    `json:"manifest"`
+	Documents []*CovenantDocument `json:"documents"`
+}
+
+// ExportSnapshotOptions are the options for ExportSnapshot.
+type ExportSnapshotOptions struct {
+	// KeyPair, if set, signs the manifest.
+	KeyPair *KeyPair
+}
+
+// ImportSnapshotOptions are the options for ImportSnapshot.
+type ImportSnapshotOptions struct {
+	// SignerPublicKey, if set, requires the snapshot to be signed by this
+	// hex public key.
+	SignerPublicKey string
+}
+
+// ExportSnapshot writes every document in store to w as a single JSON
+// archive, ordered by ID, with a manifest of their hashes. Documents are
+// recorded under their own IDs. A PagedStore is read a page at a time.
+func ExportSnapshot(w io.Writer, store Store, opts *ExportSnapshotOptions) (*SnapshotManifest, error) {
+	if store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: snapshot export requires a store")
+	}
+	docs, err := snapshotDocuments(store)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	archive := snapshotArchive{
+		Manifest:  SnapshotManifest{Version: SnapshotVersion, CreatedAt: Timestamp(), Documents: make([]SnapshotEntry, len(docs))},
+		Documents: docs,
+	}
+	for i, doc := range docs {
+		if i > 0 && doc.ID == docs[i-1].ID {
+			return nil, errorf(ErrCodeInvalidInput, "grith: store holds document %s more than once", shortID(doc.ID))
+		}
+		hash, err := SHA256Object(doc)
+		if err != nil {
+			return nil, errorf(ErrCodeCanonicalization, "grith: failed to hash document: %w", err)
+		}
+		archive.Manifest.Documents[i] = SnapshotEntry{ID: doc.ID, Hash: hash}
+	}
+	if opts != nil && opts.KeyPair != nil {
+		archive.Manifest.SignerPublicKey = opts.KeyPair.PublicKeyHex
+		payload, err := signedPayload(&archive.Manifest)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := Sign(payload, opts.KeyPair.PrivateKey)
+		if err != nil {
+			return nil, errorf(ErrCodeCrypto, "grith: failed to sign snapshot manifest: %w", err)
+		}
+		archive.Manifest.Signature = ToHex(sig)
+	}
+	if err := json.NewEncoder(w).Encode(&archive); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to write snapshot: %w", err)
+	}
+	return &archive.Manifest, nil
+}
+
+// snapshotDocuments reads every document in store.
+func snapshotDocuments(store Store) ([]*CovenantDocument, error) {
+	paged, ok := store.(PagedStore)
+	if !ok {
+		return store.List()
+	}
+	var docs []*CovenantDocument
+	cursor := ""
+	for {
+		page, next, err := paged.ListPage(cursor, 500)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, page...)
+		if next == "" {
+			return docs, nil
+		}
+		cursor = next
+	}
+}
+
+// ImportSnapshot reads a snapshot written by ExportSnapshot and stores its
+// documents in store under their IDs, replacing documents with the same
+// IDs. The whole snapshot is checked against its manifest, and its
+// signature if it has one, before anything is stored.
+func ImportSnapshot(r io.Reader, store Store, opts *ImportSnapshotOptions) (*SnapshotManifest, error) {
+	if store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: snapshot import requires a store")
+	}
+	var archive snapshotArchive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "grith: failed to read snapshot: %w", err)
+	}
+	if err := verifySnapshot(&archive, opts); err != nil {
+		return nil, err
+	}
+	for _, doc := range archive.Documents {
+		if err := store.Put(doc.ID, doc); err != nil {
+			return nil, err
+		}
+	}
+	return &archive.Manifest, nil
+}
+
+func verifySnapshot(archive *snapshotArchive, opts *ImportSnapshotOptions) error {
+	m := &archive.Manifest
+	if m.Version != SnapshotVersion {
+		return errorf(ErrCodeUnsupportedVersion, "grith: unsupported snapshot version %d", m.Version)
+	}
+	if len(m.Documents) != len(archive.Documents) {
+		return errorf(ErrCodeInvalidInput, "grith: snapshot manifest lists %s, archive holds %d",
+			plural(len(m.Documents), "document", "documents"), len(archive.Documents))
+	}
+	seen := make(map[string]bool, len(m.Documents))
+	for i, doc := range archive.Documents {
+		entry := m.Documents[i]
+		if doc == nil || doc.ID != entry.ID || entry.ID == "" {
+			return errorf(ErrCodeInvalidInput, "grith: snapshot document %d does not match its manifest entry", i)
+		}
+		if seen[entry.ID] {
+			return errorf(ErrCodeInvalidInput, "grith: snapshot lists document %s more than once", shortID(entry.ID))
+		}
+		seen[entry.ID] = true
+		hash, err := SHA256Object(doc)
+		if err != nil || hash != entry.Hash {
+			return errorf(ErrCodeInvalidInput, "grith: snapshot document %s does not match its hash", shortID(entry.ID))
+		}
+	}
+
+	var want string
+	if opts != nil {
+		want = opts.SignerPublicKey
+	}
+	if m.Signature == "" && m.SignerPublicKey == "" {
+		if want != "" {
+			return errorf(ErrCodeCrypto, "grith: snapshot is not signed")
+		}
+		return nil
+	}
+	if want != "" && m.SignerPublicKey != want {
+		return errorf(ErrCodeCrypto, "grith: snapshot is signed by another key")
+	}
+	pub, err := FromHex(m.SignerPublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errorf(ErrCodeCrypto, "grith: snapshot signer key is invalid")
+	}
+	sig, err := FromHex(m.Signature)
+	payload, perr := signedPayload(m)
+	if err != nil || perr != nil || !Verify(payload, sig, ed25519.PublicKey(pub)) {
+		return errorf(ErrCodeCrypto, "grith: snapshot signature is invalid")
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package grith
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// SQLStore is a Store over a database/sql database, written for SQLite
+// (any driver, such as modernc.org/sqlite or mattn/go-sqlite3) and
+// limited to SQL that PostgreSQL also accepts apart from its placeholder
+// syntax. Documents are stored as JSON beside indexed issuer,
+// beneficiary, expiry, and chain parent columns, and each Put and Delete
+// runs in a transaction.
+type SQLStore struct {
+	db    *sql.DB
+	codec documentCodec
+	put   putCheck
+}
+
+// sqlMigrations are applied in order by NewSQLStore, each in its own
+// transaction, and the schema version is the number applied. Each is a
+// list of single statements, since not every driver executes several at
+// once. Append new migrations; never edit old ones.
+var sqlMigrations = [][]string{
+	{
+		`CREATE TABLE grith_covenants (
+			id TEXT PRIMARY KEY,
+			issuer TEXT NOT NULL,
+			beneficiary TEXT NOT NULL,
+			expires_at TEXT,
+			chain_parent TEXT,
+			document TEXT NOT NULL
+		)`,
+		`CREATE INDEX grith_covenants_issuer ON grith_covenants (issuer)`,
+		`CREATE INDEX grith_covenants_beneficiary ON grith_covenants (beneficiary)`,
+		`CREATE INDEX grith_covenants_expires_at ON grith_covenants (expires_at)`,
+		`CREATE INDEX grith_covenants_chain_parent ON grith_covenants (chain_parent)`,
+	},
+}
+
+// NewSQLStore returns a store over db, migrating its schema to the
+// current version. The caller opens db with its driver and closes it.
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	return NewSQLStoreWithOptions(db, nil)
+}
+
+// NewSQLStoreWithOptions returns a store over db as NewSQLStore does,
+// with the given encryption and verification options.
+func NewSQLStoreWithOptions(db *sql.DB, opts *StoreOptions) (*SQLStore, error) {
+	if db == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: SQL store requires a database")
+	}
+	s := &SQLStore{db: db, codec: newDocumentCodec(opts), put: newPutCheck(opts)}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SchemaVersion returns the number of migrations applied to the database.
+func (s *SQLStore) SchemaVersion() (int, error) {
+	var version int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM grith_schema_migrations`).Scan(&version); err != nil {
+		return 0, errorf(ErrCodeStorage, "grith: failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+func (s *SQLStore) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS grith_schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return errorf(ErrCodeStorage, "grith: failed to create migrations table: %w", err)
+	}
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(sqlMigrations) {
+		return errorf(ErrCodeStorage, "grith: database schema version %d is newer than this library's %d", version, len(sqlMigrations))
+	}
+	for i := version; i < len(sqlMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return errorf(ErrCodeStorage, "grith: failed to begin migration: %w", err)
+		}
+		for _, stmt := range sqlMigrations[i] {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return errorf(ErrCodeStorage, "grith: schema migration %d failed: %w", i+1, err)
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO grith_schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return errorf(ErrCodeStorage, "grith: failed to record schema migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return errorf(ErrCodeStorage, "grith: failed to commit schema migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// sqlCovenantRow returns the indexed column values of doc: issuer and
+// beneficiary IDs, the expiry normalized so that it orders as text, and
+// the chain parent ID. Absent values are nil.
+func sqlCovenantRow(doc *CovenantDocument) (issuer, beneficiary string, expiresAt, chainParent interface{}) {
+	if doc.ExpiresAt != "" {
+		expiresAt = doc.ExpiresAt
+		if t, err := parseTimestamp(doc.ExpiresAt); err == nil {
+			expiresAt = t.UTC().Format("2006-01-02T15:04:05.000Z")
+		}
+	}
+	if doc.Chain != nil && doc.Chain.ParentID != "" {
+		chainParent = doc.Chain.ParentID
+	}
+	return doc.Issuer.ID, doc.Beneficiary.ID, expiresAt, chainParent
+}
+
+// Put stores doc under id, replacing any existing document.
+func (s *SQLStore) Put(id string, doc *CovenantDocument) error {
+	if id == "" {
+		return errorf(ErrCodeInvalidInput, "grith: sqlStore.Put: id must be a non-empty string")
+	}
+	if doc == nil {
+		return errorf(ErrCodeMissingField, "grith: sqlStore.Put: document is required")
+	}
+	if err := s.put.check(id, doc); err != nil {
+		return err
+	}
+	return s.inTx("Put", func(tx *sql.Tx) error {
+		return s.putRow(tx, id, doc)
+	})
+}
+
+// putRow upserts doc's row in tx.
+func (s *SQLStore) putRow(tx *sql.Tx, id string, doc *CovenantDocument) error {
+	data, err := s.codec.encode(id, doc)
+	if err != nil {
+		return err
+	}
+	issuer, beneficiary, expiresAt, chainParent := sqlCovenantRow(doc)
+	_, err = tx.Exec(`INSERT INTO grith_covenants (id, issuer, beneficiary, expires_at, chain_parent, document)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET issuer = excluded.issuer, beneficiary = excluded.beneficiary,
+			expires_at = excluded.expires_at, chain_parent = excluded.chain_parent, document = excluded.document`,
+		id, issuer, beneficiary, expiresAt, chainParent, string(data))
+	return err
+}
+
+// Get returns the document stored under id, or nil if there is none.
+func (s *SQLStore) Get(id string) (*CovenantDocument, error) {
+	if id == "" {
+		return nil, errorf(ErrCodeInvalidInput, "grith: sqlStore.Get: id must be a non-empty string")
+	}
+	var data string
+	err := s.db.QueryRow(`SELECT document FROM grith_covenants WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: sqlStore.Get: %w", err)
+	}
+	return s.codec.decode(id, []byte(data))
+}
+
+// Delete removes the document stored under id.
+func (s *SQLStore) Delete(id string) error {
+	if id == "" {
+		return errorf(ErrCodeInvalidInput, "grith: sqlStore.Delete: id must be a non-empty string")
+	}
+	return s.inTx("Delete", func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM grith_covenants WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return errorf(ErrCodeNotFound, "grith: sqlStore.Delete: document not found: %s", id)
+		}
+		return nil
+	})
+}
+
+// List returns every stored document, ordered by ID.
+func (s *SQLStore) List() ([]*CovenantDocument, error) {
+	return s.query(`SELECT id, document FROM grith_covenants ORDER BY id`)
+}
+
+// ListPage returns up to limit documents following cursor, ordered by
+// ID, and the cursor of the next page, using the primary key.
+func (s *SQLStore) ListPage(cursor string, limit int) ([]*CovenantDocument, string, error) {
+	after, err := decodePageCursor(cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := s.db.Query(`SELECT id, document FROM grith_covenants WHERE id > ? ORDER BY id LIMIT ?`, after, limit+1)
+	if err != nil {
+		return nil, "", errorf(ErrCodeStorage, "grith: sqlStore.ListPage: %w", err)
+	}
+	defer rows.Close()
+	var result []*CovenantDocument
+	var last string
+	next := ""
+	for rows.Next() {
+		if len(result) == limit {
+			next = encodePageCursor(last)
+			break
+		}
+		var data string
+		if err := rows.Scan(&last, &data); err != nil {
+			return nil, "", errorf(ErrCodeStorage, "grith: sqlStore.ListPage: failed to read row: %w", err)
+		}
+		doc, err := s.codec.decode(last, []byte(data))
+		if err != nil {
+			return nil, "", err
+		}
+		result = append(result, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", errorf(ErrCodeStorage, "grith: sqlStore.ListPage: %w", err)
+	}
+	return result, next, nil
+}
+
+// Has reports whether a document is stored under id. Database errors
+// report false.
+func (s *SQLStore) Has(id string) bool {
+	var one int
+	return s.db.QueryRow(`SELECT 1 FROM grith_covenants WHERE id = ?`, id).Scan(&one) == nil
+}
+
+// Count returns the number of stored documents. Database errors count
+// as zero.
+func (s *SQLStore) Count() int {
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM grith_covenants`).Scan(&n); err != nil {
+		return 0
+	}
+	return n
+}
+
+// FindByIssuer returns the documents issued by the party with the given
+// ID, using the issuer index.
+func (s *SQLStore) FindByIssuer(issuerID string) ([]*CovenantDocument, error) {
+	return s.find(`issuer = ?`, issuedBy(issuerID), issuerID)
+}
+
+// FindByBeneficiary returns the documents issued to the party with the
+// given ID, using the beneficiary index.
+func (s *SQLStore) FindByBeneficiary(beneficiaryID string) ([]*CovenantDocument, error) {
+	return s.find(`beneficiary = ?`, issuedTo(beneficiaryID), beneficiaryID)
+}
+
+// FindExpiringBefore returns the documents that expire before t, using
+// the expiry index. The column and t are both truncated to milliseconds,
+// so the index selects expiries up to and including t's millisecond and
+// the exact comparison is made in Go.
+func (s *SQLStore) FindExpiringBefore(t time.Time) ([]*CovenantDocument, error) {
+	return s.find(`expires_at <= ?`, expiringBefore(t), t.UTC().Format("2006-01-02T15:04:05.000Z"))
+}
+
+// FindChildrenOf returns the documents chained to the given parent,
+// using the chain parent index.
+func (s *SQLStore) FindChildrenOf(parentID string) ([]*CovenantDocument, error) {
+	return s.find(`chain_parent = ?`, childOf(parentID), parentID)
+}
+
+// FindByMetadata returns the documents whose metadata maps key to value.
+// The database selects documents with the key using SQLite's
+// json_type, and their values are compared as canonical JSON. Encrypted
+// documents are all read and matched.
+func (s *SQLStore) FindByMetadata(key string, value interface{}) ([]*CovenantDocument, error) {
+	match, err := withMetadata(key, value)
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: sqlStore.FindByMetadata: value is not JSON: %w", err)
+	}
+	if strings.ContainsAny(key, `"\`) || s.codec.keys != nil {
+		return s.find(`1 = 1`, match)
+	}
+	return s.find(`json_type(document, ?) IS NOT NULL`, match, `$.metadata."`+key+`"`)
+}
+
+// find returns the documents selected by where that also match, ordered
+// by ID. Matching again in Go keeps results exact where the indexed
+// columns are not, such as expiries stored in another format.
+func (s *SQLStore) find(where string, match covenantMatcher, args ...interface{}) ([]*CovenantDocument, error) {
+	docs, err := s.query(`SELECT id, document FROM grith_covenants WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	result := docs[:0]
+	for _, doc := range docs {
+		if match(doc) {
+			result = append(result, doc)
+		}
+	}
+	return result, nil
+}
+
+// query returns the documents selected by a query whose columns are id
+// and document.
+func (s *SQLStore) query(query string, args ...interface{}) ([]*CovenantDocument, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: sqlStore: query failed: %w", err)
+	}
+	defer rows.Close()
+	var result []*CovenantDocument
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, errorf(ErrCodeStorage, "grith: sqlStore: failed to read row: %w", err)
+		}
+		doc, err := s.codec.decode(id, []byte(data))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: sqlStore: query failed: %w", err)
+	}
+	return result, nil
+}
+
+// inTx runs fn in a transaction, committing if it succeeds.
+func (s *SQLStore) inTx(op string, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errorf(ErrCodeStorage, "grith: sqlStore.%s: failed to begin transaction: %w", op, err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		var gerr *Error
+		if errors.As(err, &gerr) {
+			return err
+		}
+		return errorf(ErrCodeStorage, "grith: sqlStore.%s: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return errorf(ErrCodeStorage, "grith: sqlStore.%s: failed to commit: %w", op, err)
+	}
+	return nil
+}
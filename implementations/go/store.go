@@ -1,9 +1,10 @@
 package grith
 
 import (
-	"encoding/json"
-	"fmt"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Store is the interface for covenant document storage.
@@ -30,38 +31,81 @@ type Store interface {
 }
 
 // MemoryStore is an in-memory implementation of the Store interface
-// backed by a map. It is safe for concurrent use.
+// backed by a map. It indexes documents by issuer, beneficiary, chain
+// parent, and expiry, so its queries copy only the documents they
+// return. It is safe for concurrent use.
 type MemoryStore struct {
-	mu   sync.RWMutex
-	data map[string]*CovenantDocument
+	mu    sync.RWMutex
+	data  map[string]*CovenantDocument
+	index memoryStoreIndex
+	put   putCheck
+}
+
+// memoryStoreIndex holds a MemoryStore's secondary indexes: document IDs
+// by issuer, beneficiary, and chain parent, and the IDs of documents with
+// an expiry ordered by it.
+type memoryStoreIndex struct {
+	byIssuer      map[string]map[string]struct{}
+	byBeneficiary map[string]map[string]struct{}
+	byParent      map[string]map[string]struct{}
+	expiries      []memoryExpiry
+}
+
+type memoryExpiry struct {
+	at time.Time
+	id string
+}
+
+func newMemoryStoreIndex() memoryStoreIndex {
+	return memoryStoreIndex{
+		byIssuer:      make(map[string]map[string]struct{}),
+		byBeneficiary: make(map[string]map[string]struct{}),
+		byParent:      make(map[string]map[string]struct{}),
+	}
 }
 
 // NewMemoryStore creates a new, empty MemoryStore.
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		data: make(map[string]*CovenantDocument),
+		data:  make(map[string]*CovenantDocument),
+		index: newMemoryStoreIndex(),
 	}
 }
 
+// NewMemoryStoreWithOptions creates a new, empty MemoryStore with the
+// given verification options. Documents in memory are not encrypted, so
+// opts.Encryption is refused.
+func NewMemoryStoreWithOptions(opts *StoreOptions) (*MemoryStore, error) {
+	if opts != nil && opts.Encryption != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: memory store does not support encryption")
+	}
+	s := NewMemoryStore()
+	s.put = newPutCheck(opts)
+	return s, nil
+}
+
 // Put stores a covenant document. The document is deep-copied so the
 // caller's reference is not retained.
 func (s *MemoryStore) Put(id string, doc *CovenantDocument) error {
 	if id == "" {
-		return fmt.Errorf("grith: store.Put: id must be a non-empty string")
+		return errorf(ErrCodeInvalidInput, "grith: store.Put: id must be a non-empty string")
 	}
 	if doc == nil {
-		return fmt.Errorf("grith: store.Put: document is required")
+		return errorf(ErrCodeMissingField, "grith: store.Put: document is required")
 	}
-
-	// Deep copy via JSON round-trip
-	copied, err := deepCopyDocument(doc)
-	if err != nil {
-		return fmt.Errorf("grith: store.Put: failed to copy document: %w", err)
+	if err := s.put.check(id, doc); err != nil {
+		return err
 	}
 
+	copied := doc.Clone()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if old, ok := s.data[id]; ok {
+		s.index.remove(id, old)
+	}
 	s.data[id] = copied
+	s.index.add(id, copied)
 	return nil
 }
 
@@ -69,7 +113,7 @@ func (s *MemoryStore) Put(id string, doc *CovenantDocument) error {
 // so callers cannot mutate the stored data. Returns nil if not found.
 func (s *MemoryStore) Get(id string) (*CovenantDocument, error) {
 	if id == "" {
-		return nil, fmt.Errorf("grith: store.Get: id must be a non-empty string")
+		return nil, errorf(ErrCodeInvalidInput, "grith: store.Get: id must be a non-empty string")
 	}
 
 	s.mu.RLock()
@@ -80,28 +124,26 @@ func (s *MemoryStore) Get(id string) (*CovenantDocument, error) {
 		return nil, nil
 	}
 
-	copied, err := deepCopyDocument(doc)
-	if err != nil {
-		return nil, fmt.Errorf("grith: store.Get: failed to copy document: %w", err)
-	}
-	return copied, nil
+	return doc.Clone(), nil
 }
 
 // Delete removes a document by ID. Returns an error if the document
 // does not exist.
 func (s *MemoryStore) Delete(id string) error {
 	if id == "" {
-		return fmt.Errorf("grith: store.Delete: id must be a non-empty string")
+		return errorf(ErrCodeInvalidInput, "grith: store.Delete: id must be a non-empty string")
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, ok := s.data[id]; !ok {
-		return fmt.Errorf("grith: store.Delete: document not found: %s", id)
+	doc, ok := s.data[id]
+	if !ok {
+		return errorf(ErrCodeNotFound, "grith: store.Delete: document not found: %s", id)
 	}
 
 	delete(s.data, id)
+	s.index.remove(id, doc)
 	return nil
 }
 
@@ -112,15 +154,28 @@ func (s *MemoryStore) List() ([]*CovenantDocument, error) {
 
 	result := make([]*CovenantDocument, 0, len(s.data))
 	for _, doc := range s.data {
-		copied, err := deepCopyDocument(doc)
-		if err != nil {
-			return nil, fmt.Errorf("grith: store.List: failed to copy document: %w", err)
-		}
-		result = append(result, copied)
+		result = append(result, doc.Clone())
 	}
 	return result, nil
 }
 
+// ListPage returns deep copies of up to limit documents following
+// cursor, ordered by ID, and the cursor of the next page.
+func (s *MemoryStore) ListPage(cursor string, limit int) ([]*CovenantDocument, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.data))
+	for id := range s.data {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	page, next, err := pageOf(ids, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.collect(page), next, nil
+}
+
 // Has checks whether a document with the given ID exists in the store.
 func (s *MemoryStore) Has(id string) bool {
 	s.mu.RLock()
@@ -136,23 +191,144 @@ func (s *MemoryStore) Count() int {
 	return len(s.data)
 }
 
-// Clear removes all documents from the store.
-func (s *MemoryStore) Clear() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data = make(map[string]*CovenantDocument)
+// FindByIssuer returns the documents issued by the party with the given ID.
+func (s *MemoryStore) FindByIssuer(issuerID string) ([]*CovenantDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collect(setKeys(s.index.byIssuer[issuerID])), nil
+}
+
+// FindByBeneficiary returns the documents issued to the party with the
+// given ID.
+func (s *MemoryStore) FindByBeneficiary(beneficiaryID string) ([]*CovenantDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collect(setKeys(s.index.byBeneficiary[beneficiaryID])), nil
+}
+
+// FindExpiringBefore returns the documents that expire before t.
+func (s *MemoryStore) FindExpiringBefore(t time.Time) ([]*CovenantDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	expiries := s.index.expiries
+	n := sort.Search(len(expiries), func(i int) bool { return !expiries[i].at.Before(t) })
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = expiries[i].id
+	}
+	sort.Strings(ids)
+	return s.collect(ids), nil
 }
 
-// deepCopyDocument creates a deep copy of a CovenantDocument via JSON
-// round-trip serialization.
-func deepCopyDocument(doc *CovenantDocument) (*CovenantDocument, error) {
-	b, err := json.Marshal(doc)
+// FindChildrenOf returns the documents chained to the given parent.
+func (s *MemoryStore) FindChildrenOf(parentID string) ([]*CovenantDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collect(setKeys(s.index.byParent[parentID])), nil
+}
+
+// FindByMetadata returns the documents whose metadata maps key to value.
+func (s *MemoryStore) FindByMetadata(key string, value interface{}) ([]*CovenantDocument, error) {
+	match, err := withMetadata(key, value)
 	if err != nil {
-		return nil, err
+		return nil, errorf(ErrCodeInvalidInput, "grith: store.FindByMetadata: value is not JSON: %w", err)
+	}
+	return s.find(match)
+}
+
+// find returns deep copies of the matching documents, ordered by ID.
+func (s *MemoryStore) find(match covenantMatcher) ([]*CovenantDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return matchDocuments(s.data, match, (*CovenantDocument).Clone), nil
+}
+
+// collect returns deep copies of the documents with the given IDs, in
+// order. The caller holds the lock.
+func (s *MemoryStore) collect(ids []string) []*CovenantDocument {
+	result := make([]*CovenantDocument, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, s.data[id].Clone())
+	}
+	return result
+}
+
+// add indexes doc under id.
+func (x *memoryStoreIndex) add(id string, doc *CovenantDocument) {
+	addToSet(x.byIssuer, doc.Issuer.ID, id)
+	addToSet(x.byBeneficiary, doc.Beneficiary.ID, id)
+	if doc.Chain != nil && doc.Chain.ParentID != "" {
+		addToSet(x.byParent, doc.Chain.ParentID, id)
+	}
+	if at, ok := documentExpiry(doc); ok {
+		e := memoryExpiry{at: at, id: id}
+		i := sort.Search(len(x.expiries), func(i int) bool { return !x.expiries[i].less(e) })
+		x.expiries = slices.Insert(x.expiries, i, e)
+	}
+}
+
+// remove drops the index entries of doc, stored under id.
+func (x *memoryStoreIndex) remove(id string, doc *CovenantDocument) {
+	removeFromSet(x.byIssuer, doc.Issuer.ID, id)
+	removeFromSet(x.byBeneficiary, doc.Beneficiary.ID, id)
+	if doc.Chain != nil && doc.Chain.ParentID != "" {
+		removeFromSet(x.byParent, doc.Chain.ParentID, id)
+	}
+	if at, ok := documentExpiry(doc); ok {
+		e := memoryExpiry{at: at, id: id}
+		i := sort.Search(len(x.expiries), func(i int) bool { return !x.expiries[i].less(e) })
+		if i < len(x.expiries) && x.expiries[i] == e {
+			x.expiries = slices.Delete(x.expiries, i, i+1)
+		}
+	}
+}
+
+func (e memoryExpiry) less(other memoryExpiry) bool {
+	if !e.at.Equal(other.at) {
+		return e.at.Before(other.at)
+	}
+	return e.id < other.id
+}
+
+// documentExpiry returns doc's expiry, if it has a parseable one.
+func documentExpiry(doc *CovenantDocument) (time.Time, bool) {
+	if doc.ExpiresAt == "" {
+		return time.Time{}, false
 	}
-	var copied CovenantDocument
-	if err := json.Unmarshal(b, &copied); err != nil {
-		return nil, err
+	at, err := parseTimestamp(doc.ExpiresAt)
+	return at, err == nil
+}
+
+func addToSet(sets map[string]map[string]struct{}, key, id string) {
+	set, ok := sets[key]
+	if !ok {
+		set = make(map[string]struct{})
+		sets[key] = set
+	}
+	set[id] = struct{}{}
+}
+
+func removeFromSet(sets map[string]map[string]struct{}, key, id string) {
+	delete(sets[key], id)
+	if len(sets[key]) == 0 {
+		delete(sets, key)
 	}
-	return &copied, nil
+}
+
+// setKeys returns the members of set, sorted.
+func setKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Clear removes all documents from the store.
+func (s *MemoryStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = make(map[string]*CovenantDocument)
+	s.index = newMemoryStoreIndex()
 }
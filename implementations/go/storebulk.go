@@ -0,0 +1,193 @@
+package grith
+
+import (
+	"sort"
+	"strings"
+)
+
+// BulkStore is a Store that stores and retrieves many documents in one
+// call: in one transaction on a local store, or one request on a remote
+// one. MemoryStore, FileStore, SQLStore, KVCovenantStore, RemoteStore,
+// and GRPCStoreClient implement it.
+type BulkStore interface {
+	Store
+
+	// PutMany stores docs, keyed by the IDs to store them under. The
+	// built-in local stores store all of them or, on error, none.
+	PutMany(docs map[string]*CovenantDocument) error
+
+	// GetMany retrieves the documents with the given IDs, keyed by ID.
+	// IDs with no document are absent from the result.
+	GetMany(ids []string) (map[string]*CovenantDocument, error)
+}
+
+// PutMany stores docs, keyed by ID, in store, with a single call if it is
+// a BulkStore and one Put per document otherwise.
+func PutMany(store Store, docs map[string]*CovenantDocument) error {
+	if bulk, ok := store.(BulkStore); ok {
+		return bulk.PutMany(docs)
+	}
+	for _, id := range sortedDocumentIDs(docs) {
+		if err := store.Put(id, docs[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMany retrieves the documents with the given IDs from store, with a
+// single call if it is a BulkStore and one Get per ID otherwise. IDs with
+// no document are absent from the result.
+func GetMany(store Store, ids []string) (map[string]*CovenantDocument, error) {
+	if bulk, ok := store.(BulkStore); ok {
+		return bulk.GetMany(ids)
+	}
+	result := make(map[string]*CovenantDocument, len(ids))
+	for _, id := range ids {
+		doc, err := store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			result[id] = doc
+		}
+	}
+	return result, nil
+}
+
+func sortedDocumentIDs(docs map[string]*CovenantDocument) []string {
+	ids := make([]string, 0, len(docs))
+	for id := range docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// putManyInBatch stores docs in a single transaction of store.
+func putManyInBatch(store BatchStore, docs map[string]*CovenantDocument) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	return store.Batch(func(tx Tx) error {
+		for _, id := range sortedDocumentIDs(docs) {
+			if err := tx.Put(id, docs[id]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PutMany stores docs atomically. See BulkStore.
+func (s *MemoryStore) PutMany(docs map[string]*CovenantDocument) error {
+	return putManyInBatch(s, docs)
+}
+
+// GetMany returns deep copies of the documents with the given IDs. See
+// BulkStore.
+func (s *MemoryStore) GetMany(ids []string) (map[string]*CovenantDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]*CovenantDocument, len(ids))
+	for _, id := range ids {
+		if doc, ok := s.data[id]; ok {
+			result[id] = doc.Clone()
+		}
+	}
+	return result, nil
+}
+
+// PutMany stores docs atomically, with one index write. See BulkStore.
+func (s *FileStore) PutMany(docs map[string]*CovenantDocument) error {
+	return putManyInBatch(s, docs)
+}
+
+// GetMany returns the documents with the given IDs. See BulkStore.
+func (s *FileStore) GetMany(ids []string) (map[string]*CovenantDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]*CovenantDocument, len(ids))
+	for _, id := range ids {
+		hash, ok := s.index[id]
+		if !ok {
+			continue
+		}
+		doc, err := s.read(id, hash)
+		if err != nil {
+			return nil, err
+		}
+		result[id] = doc
+	}
+	return result, nil
+}
+
+// PutMany stores docs atomically, as a single log record. See BulkStore.
+func (s *KVCovenantStore) PutMany(docs map[string]*CovenantDocument) error {
+	return putManyInBatch(s, docs)
+}
+
+// GetMany returns the documents with the given IDs. See BulkStore.
+func (s *KVCovenantStore) GetMany(ids []string) (map[string]*CovenantDocument, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	result := make(map[string]*CovenantDocument, len(ids))
+	for _, id := range ids {
+		data, ok := s.kv.buckets[kvBucketCovenants][id]
+		if !ok {
+			continue
+		}
+		doc, err := s.codec.decode(id, data)
+		if err != nil {
+			return nil, err
+		}
+		result[id] = doc
+	}
+	return result, nil
+}
+
+// PutMany stores docs in one transaction. See BulkStore.
+func (s *SQLStore) PutMany(docs map[string]*CovenantDocument) error {
+	return putManyInBatch(s, docs)
+}
+
+// sqlGetManyChunk bounds the IDs of one SQLStore.GetMany query, below
+// SQLite's default limit on bound parameters.
+const sqlGetManyChunk = 500
+
+// GetMany returns the documents with the given IDs, querying them by
+// primary key in chunks. See BulkStore.
+func (s *SQLStore) GetMany(ids []string) (map[string]*CovenantDocument, error) {
+	result := make(map[string]*CovenantDocument, len(ids))
+	for start := 0; start < len(ids); start += sqlGetManyChunk {
+		chunk := ids[start:min(start+sqlGetManyChunk, len(ids))]
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ")
+		rows, err := s.db.Query(`SELECT id, document FROM grith_covenants WHERE id IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, errorf(ErrCodeStorage, "grith: sqlStore.GetMany: %w", err)
+		}
+		for rows.Next() {
+			var id, data string
+			if err := rows.Scan(&id, &data); err != nil {
+				rows.Close()
+				return nil, errorf(ErrCodeStorage, "grith: sqlStore.GetMany: failed to read row: %w", err)
+			}
+			doc, err := s.codec.decode(id, []byte(data))
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			result[id] = doc
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, errorf(ErrCodeStorage, "grith: sqlStore.GetMany: %w", err)
+		}
+	}
+	return result, nil
+}
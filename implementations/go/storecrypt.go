@@ -0,0 +1,195 @@
+package grith
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+)
+
+// KeyProvider supplies the AES-256 keys that encrypt stored covenant
+// documents. Keys are named by ID, so a provider can rotate to a new
+// current key while still decrypting documents written under old ones.
+type KeyProvider interface {
+	// CurrentKey returns the ID and 32-byte key to encrypt with.
+	CurrentKey() (keyID string, key []byte, err error)
+
+	// Key returns the key with the given ID.
+	Key(keyID string) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider over a fixed set of keys.
+type StaticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeyProvider returns a provider encrypting with keys[currentID]
+// and decrypting with any of keys, each of which must be 32 bytes.
+func NewStaticKeyProvider(currentID string, keys map[string][]byte) (*StaticKeyProvider, error) {
+	if _, ok := keys[currentID]; !ok {
+		return nil, errorf(ErrCodeMissingField, "grith: key provider has no key %q", currentID)
+	}
+	copied := make(map[string][]byte, len(keys))
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, errorf(ErrCodeInvalidInput, "grith: key %q must be 32 bytes, got %d", id, len(key))
+		}
+		copied[id] = append([]byte(nil), key...)
+	}
+	return &StaticKeyProvider{current: currentID, keys: copied}, nil
+}
+
+// CurrentKey returns the current key.
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.current, p.keys[p.current], nil
+}
+
+// Key returns the key with the given ID.
+func (p *StaticKeyProvider) Key(keyID string) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, errorf(ErrCodeNotFound, "grith: unknown encryption key %q", keyID)
+	}
+	return key, nil
+}
+
+// StoreOptions configure the covenant stores created by their WithOptions
+// constructors.
+type StoreOptions struct {
+	// Encryption, if set, encrypts every stored covenant document with
+	// AES-256-GCM under the provider's current key, with the document's
+	// ID as associated data, so a ciphertext cannot be moved to another
+	// ID. A store with encryption refuses to read unencrypted documents.
+	// Columns and keys a store indexes documents by, such as party IDs,
+	// are not encrypted.
+	Encryption KeyProvider
+
+	// VerifyOnPut makes Put reject a document whose ID is not the ID it
+	// is stored under or does not match its contents, or which fails
+	// VerifyCovenantWithOptions with the Verify options, so that a store
+	// cannot hold a document under the wrong ID.
+	VerifyOnPut bool
+	Verify      *VerifyOptions
+}
+
+// encryptedAlgorithm names the cipher of an encryptedDocument.
+const encryptedAlgorithm = "A256GCM"
+
+// encryptedDocument is the stored form of an encrypted covenant document.
+type encryptedDocument struct {
+	Encrypted  string `json:"encrypted"`
+	KeyID      string `json:"keyId"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// documentCodec serializes the documents of a persistent store,
+// encrypting them if it has a key provider.
+type documentCodec struct {
+	keys KeyProvider
+}
+
+func newDocumentCodec(opts *StoreOptions) documentCodec {
+	if opts == nil {
+		return documentCodec{}
+	}
+	return documentCodec{keys: opts.Encryption}
+}
+
+// documentAAD returns the associated data binding a ciphertext to the ID
+// it is stored under.
+func documentAAD(id string) []byte {
+	return []byte("grith/store/covenant/" + id)
+}
+
+func documentAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: invalid encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to initialize AES-GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// encode returns the stored form of doc under id.
+func (c documentCodec) encode(id string, doc *CovenantDocument) ([]byte, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "grith: failed to serialize document: %w", err)
+	}
+	if c.keys == nil {
+		return data, nil
+	}
+	keyID, key, err := c.keys.CurrentKey()
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to get encryption key: %w", err)
+	}
+	aead, err := documentAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to generate nonce: %w", err)
+	}
+	return json.Marshal(encryptedDocument{
+		Encrypted:  encryptedAlgorithm,
+		KeyID:      keyID,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, data, documentAAD(id))),
+	})
+}
+
+// decode returns the document stored under id as data.
+func (c documentCodec) decode(id string, data []byte) (*CovenantDocument, error) {
+	var envelope encryptedDocument
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: stored document %s is corrupt: %w", id, err)
+	}
+	switch {
+	case envelope.Encrypted == "" && c.keys != nil:
+		return nil, errorf(ErrCodeStorage, "grith: stored document %s is not encrypted", id)
+	case envelope.Encrypted != "" && c.keys == nil:
+		return nil, errorf(ErrCodeCrypto, "grith: stored document %s is encrypted and the store has no key provider", id)
+	case envelope.Encrypted != "":
+		plaintext, err := c.decrypt(id, &envelope)
+		if err != nil {
+			return nil, err
+		}
+		data = plaintext
+	}
+	var doc CovenantDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: stored document %s is corrupt: %w", id, err)
+	}
+	return &doc, nil
+}
+
+func (c documentCodec) decrypt(id string, envelope *encryptedDocument) ([]byte, error) {
+	if envelope.Encrypted != encryptedAlgorithm {
+		return nil, errorf(ErrCodeCrypto, "grith: stored document %s uses unsupported encryption %q", id, envelope.Encrypted)
+	}
+	key, err := c.keys.Key(envelope.KeyID)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: no key %q for stored document %s: %w", envelope.KeyID, id, err)
+	}
+	aead, err := documentAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, nerr := base64.StdEncoding.DecodeString(envelope.Nonce)
+	ciphertext, cerr := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if nerr != nil || cerr != nil || len(nonce) != aead.NonceSize() {
+		return nil, errorf(ErrCodeStorage, "grith: stored document %s is corrupt", id)
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, documentAAD(id))
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: stored document %s failed authentication", id)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,732 @@
+package grith
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ----------------------------------------------------------------------------
+// HTTP client
+// ----------------------------------------------------------------------------
+
+// remoteStorePageSize is the page size RemoteStore.List reads with, and
+// maxStorePageSize the largest page NewStoreHandler serves.
+// maxBulkRequestSize bounds the body of a bulk request; RemoteStore
+// splits bulk puts to stay within it.
+const (
+	remoteStorePageSize = 100
+	maxStorePageSize    = 1000
+	maxBulkRequestSize  = 8 << 20
+)
+
+// RemoteStoreOptions configure a RemoteStore.
+type RemoteStoreOptions struct {
+	// HTTPClient is used for registry requests. Defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// Authenticate, if set, is called on every request before it is sent,
+	// to add credentials such as an Authorization header.
+	Authenticate func(req *http.Request) error
+}
+
+// RemoteStore is a PagedStore and BulkStore backed by a remote covenant
+// registry speaking the JSON API served by NewStoreHandler:
+//
+//	GET    /covenants?cursor=...&limit=N -> {"documents": [...], "next": "..."}
+//	GET    /covenants/{id}               -> CovenantDocument, with an ETag
+//	HEAD   /covenants/{id}               -> 200 or 404
+//	PUT    /covenants/{id}                  CovenantDocument, returns its ETag
+//	DELETE /covenants/{id}
+//	GET    /count                        -> {"count": N}
+//	POST   /bulk/put                        {"documents": {id: CovenantDocument}}
+//	POST   /bulk/get  {"ids": [...]}     -> {"documents": {id: CovenantDocument}}
+//
+// A document's ETag is the quoted SHA-256 hash of its canonical JSON.
+// Has and Count cannot report errors, so a failed request reports false
+// and zero. It is safe for concurrent use.
+type RemoteStore struct {
+	baseURL string
+	opts    RemoteStoreOptions
+}
+
+// NewRemoteStore creates a client for the registry at baseURL.
+func NewRemoteStore(baseURL string, opts *RemoteStoreOptions) (*RemoteStore, error) {
+	if _, err := url.Parse(baseURL); err != nil || baseURL == "" {
+		return nil, errorf(ErrCodeInvalidInput, "grith: invalid store URL: %q", baseURL)
+	}
+	s := &RemoteStore{baseURL: strings.TrimRight(baseURL, "/")}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.HTTPClient == nil {
+		s.opts.HTTPClient = http.DefaultClient
+	}
+	return s, nil
+}
+
+// storePage is the JSON form of a page of documents.
+type storePage struct {
+	Documents []*CovenantDocument `json:"documents"`
+	Next      string              `json:"next,omitempty"`
+}
+
+// Put stores doc under id, which the registry requires to be its ID.
+func (s *RemoteStore) Put(id string, doc *CovenantDocument) error {
+	_, err := s.PutIfMatch(id, doc, "")
+	return err
+}
+
+// PutIfMatch stores doc under id only if the registry's document has the
+// given ETag, and returns the new ETag. An ETag of "*" requires a document
+// to exist and "" stores unconditionally. A failed precondition is an
+// ErrCodeConflict error.
+func (s *RemoteStore) PutIfMatch(id string, doc *CovenantDocument, etag string) (string, error) {
+	if doc == nil {
+		return "", errorf(ErrCodeMissingField, "grith: remoteStore.Put: document is nil")
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return "", errorf(ErrCodeSerialization, "grith: remoteStore.Put: failed to serialize document: %w", err)
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	if etag != "" {
+		header.Set("If-Match", etag)
+	}
+	resp, _, err := s.do(http.MethodPut, storeDocumentPath(id), header, body, 0)
+	if err != nil {
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// Get retrieves a document by ID. Returns nil if not found.
+func (s *RemoteStore) Get(id string) (*CovenantDocument, error) {
+	doc, _, err := s.GetWithETag(id)
+	return doc, err
+}
+
+// GetWithETag retrieves a document by ID along with its ETag, for use with
+// PutIfMatch. Returns nil if not found.
+func (s *RemoteStore) GetWithETag(id string) (*CovenantDocument, string, error) {
+	resp, data, err := s.do(http.MethodGet, storeDocumentPath(id), nil, nil, MaxDocumentSize)
+	if CodeOf(err) == ErrCodeNotFound {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	var doc CovenantDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, "", errorf(ErrCodeInvalidJSON, "grith: invalid store response: %w", err)
+	}
+	return &doc, resp.Header.Get("ETag"), nil
+}
+
+// Delete removes a document by ID.
+func (s *RemoteStore) Delete(id string) error {
+	_, _, err := s.do(http.MethodDelete, storeDocumentPath(id), nil, nil, 0)
+	return err
+}
+
+// List returns every document in the registry, reading it a page at a
+// time.
+func (s *RemoteStore) List() ([]*CovenantDocument, error) {
+	var docs []*CovenantDocument
+	cursor := ""
+	for {
+		page, next, err := s.ListPage(cursor, remoteStorePageSize)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, page...)
+		if next == "" {
+			return docs, nil
+		}
+		cursor = next
+	}
+}
+
+// ListPage returns a page of documents. See PagedStore.
+func (s *RemoteStore) ListPage(cursor string, limit int) ([]*CovenantDocument, string, error) {
+	if limit < 1 {
+		return nil, "", errorf(ErrCodeInvalidInput, "grith: page limit must be positive, got %d", limit)
+	}
+	limit = min(limit, maxStorePageSize)
+	q := url.Values{"limit": {strconv.Itoa(limit)}}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	_, data, err := s.do(http.MethodGet, "/covenants?"+q.Encode(), nil, nil, int64(limit+1)*MaxDocumentSize)
+	if err != nil {
+		return nil, "", err
+	}
+	var page storePage
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, "", errorf(ErrCodeInvalidJSON, "grith: invalid store response: %w", err)
+	}
+	return page.Documents, page.Next, nil
+}
+
+// Has reports whether the registry holds a document with the given ID.
+func (s *RemoteStore) Has(id string) bool {
+	_, _, err := s.do(http.MethodHead, storeDocumentPath(id), nil, nil, 0)
+	return err == nil
+}
+
+// Count returns the number of documents in the registry.
+func (s *RemoteStore) Count() int {
+	_, data, err := s.do(http.MethodGet, "/count", nil, nil, 4096)
+	if err != nil {
+		return 0
+	}
+	var resp struct {
+		Count int `json:"count"`
+	}
+	if json.Unmarshal(data, &resp) != nil {
+		return 0
+	}
+	return resp.Count
+}
+
+// bulkDocuments is the JSON form of a bulk request or response.
+type bulkDocuments struct {
+	IDs       []string                     `json:"ids,omitempty"`
+	Documents map[string]*CovenantDocument `json:"documents,omitempty"`
+}
+
+// PutMany stores docs with one request per maxStorePageSize documents or
+// maxBulkRequestSize bytes, each request stored as a whole if the
+// registry's store is a BulkStore. See BulkStore.
+func (s *RemoteStore) PutMany(docs map[string]*CovenantDocument) error {
+	const prefix, suffix = `{"documents":{`, "}}"
+	body := []byte(prefix)
+	n := 0
+	send := func() error {
+		if n == 0 {
+			return nil
+		}
+		_, _, err := s.do(http.MethodPost, "/bulk/put", http.Header{"Content-Type": {"application/json"}}, append(body, suffix...), 0)
+		body, n = body[:len(prefix)], 0
+		return err
+	}
+	for _, id := range sortedDocumentIDs(docs) {
+		if docs[id] == nil {
+			return errorf(ErrCodeMissingField, "grith: remoteStore.PutMany: document %s is nil", id)
+		}
+		key, _ := json.Marshal(id)
+		data, err := json.Marshal(docs[id])
+		if err != nil {
+			return errorf(ErrCodeSerialization, "grith: remoteStore.PutMany: failed to serialize documents: %w", err)
+		}
+		if n == maxStorePageSize || len(body)+len(key)+len(data)+len(suffix)+2 > maxBulkRequestSize {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		if n > 0 {
+			body = append(body, ',')
+		}
+		body = append(append(append(body, key...), ':'), data...)
+		n++
+	}
+	return send()
+}
+
+// GetMany retrieves documents with one request per maxStorePageSize IDs.
+// See BulkStore.
+func (s *RemoteStore) GetMany(ids []string) (map[string]*CovenantDocument, error) {
+	result := make(map[string]*CovenantDocument, len(ids))
+	for start := 0; start < len(ids); start += maxStorePageSize {
+		chunk := ids[start:min(start+maxStorePageSize, len(ids))]
+		body, _ := json.Marshal(&bulkDocuments{IDs: chunk})
+		_, data, err := s.do(http.MethodPost, "/bulk/get", http.Header{"Content-Type": {"application/json"}}, body, int64(len(chunk)+1)*MaxDocumentSize)
+		if err != nil {
+			return nil, err
+		}
+		var resp bulkDocuments
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, errorf(ErrCodeInvalidJSON, "grith: invalid store response: %w", err)
+		}
+		for id, doc := range resp.Documents {
+			result[id] = doc
+		}
+	}
+	return result, nil
+}
+
+func storeDocumentPath(id string) string {
+	return "/covenants/" + url.PathEscape(id)
+}
+
+// do sends a request and returns the response with up to limit bytes of
+// its body, or the registry's error.
+func (s *RemoteStore) do(method, path string, header http.Header, body []byte, limit int64) (*http.Response, []byte, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, s.baseURL+path, r)
+	if err != nil {
+		return nil, nil, errorf(ErrCodeInvalidInput, "grith: failed to build store request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if s.opts.Authenticate != nil {
+		if err := s.opts.Authenticate(req); err != nil {
+			return nil, nil, errorf(ErrCodeUnauthorized, "grith: failed to authenticate store request: %w", err)
+		}
+	}
+	resp, err := s.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, errorf(ErrCodeStorage, "grith: store request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e logErrorBody
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			code := e.Code
+			if code == "" {
+				code = ErrCodeStorage
+			}
+			return nil, nil, errorf(code, "grith: remote store: %s", e.Error)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, nil, errorf(ErrCodeNotFound, "grith: remote store: not found")
+		}
+		return nil, nil, errorf(ErrCodeStorage, "grith: remote store returned HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, nil, errorf(ErrCodeStorage, "grith: failed to read store response: %w", err)
+	}
+	return resp, data, nil
+}
+
+// ----------------------------------------------------------------------------
+// HTTP handler
+// ----------------------------------------------------------------------------
+
+// StoreHandlerOptions configure NewStoreHandler.
+type StoreHandlerOptions struct {
+	// Authorize, if set, is called before every operation with its
+	// StoreOp name and document ID, empty for List and Count. A bulk
+	// request is authorized with an empty ID before its body is read,
+	// then for each ID in it. An error refuses the request with 403
+	// Forbidden.
+	Authorize func(r *http.Request, op, id string) error
+}
+
+// storeHandler serves a Store over the API used by RemoteStore.
+type storeHandler struct {
+	store Store
+	opts  StoreHandlerOptions
+	// mu serializes writes, so a conditional Put or Delete sees the
+	// document it replaces.
+	mu sync.Mutex
+}
+
+// NewStoreHandler serves store over the JSON API used by RemoteStore.
+// Documents are content-addressed: a Put is refused unless the document's
+// ID is the ID in its URL and matches its contents. Document responses
+// carry an ETag, GET honours If-None-Match, and PUT honours If-Match and
+// If-None-Match.
+func NewStoreHandler(store Store, opts *StoreHandlerOptions) http.Handler {
+	h := &storeHandler{store: store}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+func (h *storeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/count" && r.Method == http.MethodGet:
+		if h.authorize(w, r, StoreOpCount, "") {
+			writeLogResult(w)(map[string]int{"count": h.store.Count()}, nil)
+		}
+	case r.URL.Path == "/bulk/put" && r.Method == http.MethodPost:
+		if h.authorize(w, r, StoreOpPut, "") {
+			h.putMany(w, r)
+		}
+	case r.URL.Path == "/bulk/get" && r.Method == http.MethodPost:
+		if h.authorize(w, r, StoreOpGet, "") {
+			h.getMany(w, r)
+		}
+	case r.URL.Path == "/covenants" && r.Method == http.MethodGet:
+		if h.authorize(w, r, StoreOpList, "") {
+			h.list(w, r)
+		}
+	case strings.HasPrefix(r.URL.Path, "/covenants/"):
+		id := strings.TrimPrefix(r.URL.Path, "/covenants/")
+		if id == "" {
+			writeStoreError(w, errorf(ErrCodeNotFound, "no such document"))
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if h.authorize(w, r, StoreOpGet, id) {
+				h.get(w, r, id)
+			}
+		case http.MethodHead:
+			if h.authorize(w, r, StoreOpHas, id) {
+				if !h.store.Has(id) {
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}
+		case http.MethodPut:
+			if h.authorize(w, r, StoreOpPut, id) {
+				h.put(w, r, id)
+			}
+		case http.MethodDelete:
+			if h.authorize(w, r, StoreOpDelete, id) {
+				h.mu.Lock()
+				err := h.store.Delete(id)
+				h.mu.Unlock()
+				writeLogResult(w)(struct{}{}, err)
+			}
+		default:
+			writeLogError(w, http.StatusMethodNotAllowed, errorf(ErrCodeInvalidInput, "method not allowed"))
+		}
+	default:
+		writeLogError(w, http.StatusNotFound, errorf(ErrCodeNotFound, "not found"))
+	}
+}
+
+// authorize applies the Authorize hook, writing the refusal if it fails.
+func (h *storeHandler) authorize(w http.ResponseWriter, r *http.Request, op, id string) bool {
+	if err := h.authorized(r, op, id); err != nil {
+		writeStoreError(w, err)
+		return false
+	}
+	return true
+}
+
+// authorized applies the Authorize hook.
+func (h *storeHandler) authorized(r *http.Request, op, id string) error {
+	if h.opts.Authorize == nil {
+		return nil
+	}
+	if err := h.opts.Authorize(r, op, id); err != nil {
+		return errorf(ErrCodeUnauthorized, "%s refused: %w", op, err)
+	}
+	return nil
+}
+
+func (h *storeHandler) list(w http.ResponseWriter, r *http.Request) {
+	limit := maxStorePageSize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			writeStoreError(w, errorf(ErrCodeInvalidInput, "invalid limit"))
+			return
+		}
+		limit = min(n, maxStorePageSize)
+	}
+	cursor := r.URL.Query().Get("cursor")
+	var page storePage
+	var err error
+	if paged, ok := h.store.(PagedStore); ok {
+		page.Documents, page.Next, err = paged.ListPage(cursor, limit)
+	} else {
+		page.Documents, page.Next, err = listStorePage(h.store, cursor, limit)
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if page.Documents == nil {
+		page.Documents = []*CovenantDocument{}
+	}
+	writeLogResult(w)(&page, nil)
+}
+
+// listStorePage pages through a store that is not a PagedStore by listing
+// all of it.
+func listStorePage(store Store, cursor string, limit int) ([]*CovenantDocument, string, error) {
+	docs, err := store.List()
+	if err != nil {
+		return nil, "", err
+	}
+	byID := make(map[string]*CovenantDocument, len(docs))
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		byID[doc.ID] = doc
+		ids = append(ids, doc.ID)
+	}
+	sort.Strings(ids)
+	ids, next, err := pageOf(ids, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	page := make([]*CovenantDocument, len(ids))
+	for i, id := range ids {
+		page[i] = byID[id]
+	}
+	return page, next, nil
+}
+
+func (h *storeHandler) get(w http.ResponseWriter, r *http.Request, id string) {
+	doc, err := h.store.Get(id)
+	if err == nil && doc == nil {
+		err = errorf(ErrCodeNotFound, "no document %s", shortID(id))
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	etag, err := documentETag(doc)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeLogResult(w)(doc, nil)
+}
+
+func (h *storeHandler) put(w http.ResponseWriter, r *http.Request, id string) {
+	var doc CovenantDocument
+	if err := json.NewDecoder(io.LimitReader(r.Body, MaxDocumentSize)).Decode(&doc); err != nil {
+		writeStoreError(w, errorf(ErrCodeInvalidJSON, "invalid document: %w", err))
+		return
+	}
+	if err := checkContentAddress(id, &doc); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	etag, err := documentETag(&doc)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if ifMatch != "" || ifNoneMatch != "" {
+		current := ""
+		existing, err := h.store.Get(id)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if existing != nil {
+			if current, err = documentETag(existing); err != nil {
+				writeStoreError(w, err)
+				return
+			}
+		}
+		if (ifMatch != "" && (current == "" || !etagMatches(ifMatch, current))) ||
+			(ifNoneMatch != "" && current != "" && etagMatches(ifNoneMatch, current)) {
+			writeStoreError(w, errorf(ErrCodeConflict, "document %s does not match the precondition", shortID(id)))
+			return
+		}
+	}
+	if err := h.store.Put(id, &doc); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	writeLogResult(w)(struct{}{}, nil)
+}
+
+// readBulk decodes a bulk request of at most maxStorePageSize entries
+// and maxBulkRequestSize bytes one entry at a time, passing each ID to
+// checkID and each document to checkDoc as it is read, so a request is
+// refused at its first bad entry without reading the rest. A field whose
+// check is nil is skipped.
+func readBulk(w http.ResponseWriter, r *http.Request, checkID func(id string) error, checkDoc func(id string, doc *CovenantDocument) error) (*bulkDocuments, bool) {
+	req, err := decodeBulk(io.LimitReader(r.Body, maxBulkRequestSize), checkID, checkDoc)
+	if err != nil {
+		writeStoreError(w, err)
+		return nil, false
+	}
+	return req, true
+}
+
+func decodeBulk(body io.Reader, checkID func(id string) error, checkDoc func(id string, doc *CovenantDocument) error) (*bulkDocuments, error) {
+	dec := json.NewDecoder(body)
+	invalid := func(err error) error {
+		return errorf(ErrCodeInvalidJSON, "invalid request body: %w", err)
+	}
+	delim := func(want json.Delim) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return invalid(err)
+		}
+		if tok != want {
+			return invalid(fmt.Errorf("expected %v, got %v", want, tok))
+		}
+		return nil
+	}
+	tooMany := errorf(ErrCodeInvalidInput, "bulk requests are limited to %d entries", maxStorePageSize)
+
+	var req bulkDocuments
+	if err := delim('{'); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, invalid(err)
+		}
+		switch {
+		case tok == "ids" && checkID != nil:
+			if err := delim('['); err != nil {
+				return nil, err
+			}
+			for dec.More() {
+				var id string
+				if err := dec.Decode(&id); err != nil {
+					return nil, invalid(err)
+				}
+				if len(req.IDs) == maxStorePageSize {
+					return nil, tooMany
+				}
+				if err := checkID(id); err != nil {
+					return nil, err
+				}
+				req.IDs = append(req.IDs, id)
+			}
+			if err := delim(']'); err != nil {
+				return nil, err
+			}
+		case tok == "documents" && checkDoc != nil:
+			if err := delim('{'); err != nil {
+				return nil, err
+			}
+			req.Documents = make(map[string]*CovenantDocument)
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, invalid(err)
+				}
+				id, _ := key.(string)
+				var doc *CovenantDocument
+				if err := dec.Decode(&doc); err != nil {
+					return nil, invalid(err)
+				}
+				if len(req.Documents) == maxStorePageSize {
+					return nil, tooMany
+				}
+				if err := checkDoc(id, doc); err != nil {
+					return nil, err
+				}
+				req.Documents[id] = doc
+			}
+			if err := delim('}'); err != nil {
+				return nil, err
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, invalid(err)
+			}
+		}
+	}
+	if err := delim('}'); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (h *storeHandler) putMany(w http.ResponseWriter, r *http.Request) {
+	req, ok := readBulk(w, r, nil, func(id string, doc *CovenantDocument) error {
+		if err := h.authorized(r, StoreOpPut, id); err != nil {
+			return err
+		}
+		if doc == nil {
+			return errorf(ErrCodeMissingField, "document %s is null", shortID(id))
+		}
+		return checkContentAddress(id, doc)
+	})
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	err := PutMany(h.store, req.Documents)
+	h.mu.Unlock()
+	writeStoreResult(w, struct{}{}, err)
+}
+
+func (h *storeHandler) getMany(w http.ResponseWriter, r *http.Request) {
+	req, ok := readBulk(w, r, func(id string) error {
+		return h.authorized(r, StoreOpGet, id)
+	}, nil)
+	if !ok {
+		return
+	}
+	docs, err := GetMany(h.store, req.IDs)
+	writeStoreResult(w, &bulkDocuments{Documents: docs}, err)
+}
+
+// checkContentAddress checks that a document submitted to a registry is
+// addressed by its ID.
+func checkContentAddress(id string, doc *CovenantDocument) error {
+	if doc.ID != id {
+		return errorf(ErrCodeInvalidInput, "document ID %s does not match the ID it is stored under", shortID(doc.ID))
+	}
+	if computed, err := ComputeID(doc); err != nil || computed != id {
+		return errorf(ErrCodeInvalidInput, "document ID %s does not match its contents", shortID(id))
+	}
+	return nil
+}
+
+// documentETag returns the ETag of doc: the quoted hash of its canonical
+// JSON.
+func documentETag(doc *CovenantDocument) (string, error) {
+	hash, err := SHA256Object(doc)
+	if err != nil {
+		return "", errorf(ErrCodeCanonicalization, "failed to hash document: %w", err)
+	}
+	return `"` + hash + `"`, nil
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists
+// etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeStoreResult(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeLogResult(w)(v, nil)
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch CodeOf(err) {
+	case ErrCodeNotFound:
+		status = http.StatusNotFound
+	case ErrCodeInvalidInput, ErrCodeInvalidJSON:
+		status = http.StatusBadRequest
+	case ErrCodeUnauthorized:
+		status = http.StatusForbidden
+	case ErrCodeConflict:
+		status = http.StatusPreconditionFailed
+	}
+	writeLogError(w, status, err)
+}
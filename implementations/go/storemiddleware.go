@@ -0,0 +1,354 @@
+package grith
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Store operation names, as reported by MetricsStore and AuditStore.
+const (
+	StoreOpPut    = "put"
+	StoreOpGet    = "get"
+	StoreOpDelete = "delete"
+	StoreOpList   = "list"
+	StoreOpHas    = "has"
+	StoreOpCount  = "count"
+)
+
+// ----------------------------------------------------------------------------
+// Read-through cache
+// ----------------------------------------------------------------------------
+
+// CachedStore is a Store that keeps up to a fixed number of the documents
+// read through it, evicting the least recently used. Writes go through to
+// the underlying store and update the cache, so it stays consistent
+// provided nothing else writes to that store. It is safe for concurrent
+// use.
+type CachedStore struct {
+	store Store
+	size  int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+	writes  int64      // counts Puts and Deletes, to spot reads they race
+	hits    int64
+	misses  int64
+}
+
+type cacheEntry struct {
+	id  string
+	doc *CovenantDocument
+}
+
+// NewCachedStore returns a cache of up to size documents over store.
+func NewCachedStore(store Store, size int) (*CachedStore, error) {
+	if store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: cached store requires a store")
+	}
+	if size < 1 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: cache size must be positive, got %d", size)
+	}
+	return &CachedStore{store: store, size: size, entries: make(map[string]*list.Element), order: list.New()}, nil
+}
+
+// Put stores doc in the underlying store, then caches it.
+func (s *CachedStore) Put(id string, doc *CovenantDocument) error {
+	if err := s.store.Put(id, doc); err != nil {
+		s.mu.Lock()
+		s.writes++
+		s.evict(id)
+		s.mu.Unlock()
+		return err
+	}
+	copied := doc.Clone()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	s.add(id, copied)
+	return nil
+}
+
+// Get returns a copy of the cached document, reading it from the
+// underlying store on a miss.
+func (s *CachedStore) Get(id string) (*CovenantDocument, error) {
+	s.mu.Lock()
+	if el, ok := s.entries[id]; ok {
+		s.order.MoveToFront(el)
+		s.hits++
+		doc := el.Value.(*cacheEntry).doc
+		s.mu.Unlock()
+		return doc.Clone(), nil
+	}
+	s.misses++
+	writes := s.writes
+	s.mu.Unlock()
+
+	doc, err := s.store.Get(id)
+	if err != nil || doc == nil {
+		return doc, err
+	}
+	copied := doc.Clone()
+	s.mu.Lock()
+	// A write since the read may have made doc stale.
+	if s.writes == writes {
+		s.add(id, copied)
+	}
+	s.mu.Unlock()
+	return doc, nil
+}
+
+// Delete removes the document from the underlying store and the cache.
+func (s *CachedStore) Delete(id string) error {
+	err := s.store.Delete(id)
+	s.mu.Lock()
+	s.writes++
+	s.evict(id)
+	s.mu.Unlock()
+	return err
+}
+
+// List returns every document in the underlying store.
+func (s *CachedStore) List() ([]*CovenantDocument, error) {
+	return s.store.List()
+}
+
+// Has reports whether the document is cached or in the underlying store.
+func (s *CachedStore) Has(id string) bool {
+	s.mu.Lock()
+	_, ok := s.entries[id]
+	s.mu.Unlock()
+	return ok || s.store.Has(id)
+}
+
+// Count returns the number of documents in the underlying store.
+func (s *CachedStore) Count() int {
+	return s.store.Count()
+}
+
+// Stats returns the number of Get calls answered from the cache and the
+// number that read the underlying store.
+func (s *CachedStore) Stats() (hits, misses int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits, s.misses
+}
+
+// add caches doc under id, evicting the least recently used document if
+// the cache is full. The caller holds the lock.
+func (s *CachedStore) add(id string, doc *CovenantDocument) {
+	if el, ok := s.entries[id]; ok {
+		el.Value.(*cacheEntry).doc = doc
+		s.order.MoveToFront(el)
+		return
+	}
+	s.entries[id] = s.order.PushFront(&cacheEntry{id: id, doc: doc})
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*cacheEntry).id)
+	}
+}
+
+// evict drops id from the cache. The caller holds the lock.
+func (s *CachedStore) evict(id string) {
+	if el, ok := s.entries[id]; ok {
+		s.order.Remove(el)
+		delete(s.entries, id)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Metrics
+// ----------------------------------------------------------------------------
+
+// StoreOpStats are the counts and latencies of one store operation.
+type StoreOpStats struct {
+	Count  int64
+	Errors int64
+	Total  time.Duration
+	Max    time.Duration
+}
+
+// Mean returns the mean latency of the operation.
+func (s StoreOpStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// MetricsStore is a Store that counts and times the operations it passes
+// to another store, and reports them to the Metrics installed with
+// SetMetrics. It is safe for concurrent use.
+type MetricsStore struct {
+	store Store
+	now   func() time.Time
+
+	mu    sync.Mutex
+	stats map[string]StoreOpStats
+}
+
+// NewMetricsStore returns a store recording metrics for store.
+func NewMetricsStore(store Store) (*MetricsStore, error) {
+	if store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: metrics store requires a store")
+	}
+	return &MetricsStore{store: store, now: time.Now, stats: make(map[string]StoreOpStats)}, nil
+}
+
+// Metrics returns the statistics of each operation performed so far,
+// keyed by StoreOp name.
+func (s *MetricsStore) Metrics() map[string]StoreOpStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make(map[string]StoreOpStats, len(s.stats))
+	for op, st := range s.stats {
+		result[op] = st
+	}
+	return result
+}
+
+// observe records one operation that began at start.
+func (s *MetricsStore) observe(op string, start time.Time, err error) {
+	elapsed := s.now().Sub(start)
+	if m := currentMetrics(); m != nil {
+		m.ObserveStoreOperation(op, elapsed, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats[op]
+	st.Count++
+	if err != nil {
+		st.Errors++
+	}
+	st.Total += elapsed
+	st.Max = max(st.Max, elapsed)
+	s.stats[op] = st
+}
+
+// Put stores doc in the underlying store.
+func (s *MetricsStore) Put(id string, doc *CovenantDocument) error {
+	start := s.now()
+	err := s.store.Put(id, doc)
+	s.observe(StoreOpPut, start, err)
+	return err
+}
+
+// Get reads a document from the underlying store.
+func (s *MetricsStore) Get(id string) (*CovenantDocument, error) {
+	start := s.now()
+	doc, err := s.store.Get(id)
+	s.observe(StoreOpGet, start, err)
+	return doc, err
+}
+
+// Delete removes a document from the underlying store.
+func (s *MetricsStore) Delete(id string) error {
+	start := s.now()
+	err := s.store.Delete(id)
+	s.observe(StoreOpDelete, start, err)
+	return err
+}
+
+// List returns every document in the underlying store.
+func (s *MetricsStore) List() ([]*CovenantDocument, error) {
+	start := s.now()
+	docs, err := s.store.List()
+	s.observe(StoreOpList, start, err)
+	return docs, err
+}
+
+// Has reports whether the underlying store holds a document.
+func (s *MetricsStore) Has(id string) bool {
+	start := s.now()
+	ok := s.store.Has(id)
+	s.observe(StoreOpHas, start, nil)
+	return ok
+}
+
+// Count returns the number of documents in the underlying store.
+func (s *MetricsStore) Count() int {
+	start := s.now()
+	n := s.store.Count()
+	s.observe(StoreOpCount, start, nil)
+	return n
+}
+
+// ----------------------------------------------------------------------------
+// Audit
+// ----------------------------------------------------------------------------
+
+// StoreAccess records one operation on an AuditStore.
+type StoreAccess struct {
+	Op string
+	// ID is the document ID, empty for List and Count.
+	ID string
+	At time.Time
+	// Err is the operation's error, if it failed.
+	Err error
+}
+
+// AuditStore is a Store that reports every operation passed to another
+// store, after it completes, to a record function, which must be safe for
+// concurrent use if the store is used concurrently.
+type AuditStore struct {
+	store  Store
+	record func(StoreAccess)
+	now    func() time.Time
+}
+
+// NewAuditStore returns a store reporting every access to store to record.
+func NewAuditStore(store Store, record func(StoreAccess)) (*AuditStore, error) {
+	if store == nil || record == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: audit store requires a store and a record function")
+	}
+	return &AuditStore{store: store, record: record, now: time.Now}, nil
+}
+
+func (s *AuditStore) audit(op, id string, err error) {
+	s.record(StoreAccess{Op: op, ID: id, At: s.now().UTC(), Err: err})
+}
+
+// Put stores doc in the underlying store.
+func (s *AuditStore) Put(id string, doc *CovenantDocument) error {
+	err := s.store.Put(id, doc)
+	s.audit(StoreOpPut, id, err)
+	return err
+}
+
+// Get reads a document from the underlying store.
+func (s *AuditStore) Get(id string) (*CovenantDocument, error) {
+	doc, err := s.store.Get(id)
+	s.audit(StoreOpGet, id, err)
+	return doc, err
+}
+
+// Delete removes a document from the underlying store.
+func (s *AuditStore) Delete(id string) error {
+	err := s.store.Delete(id)
+	s.audit(StoreOpDelete, id, err)
+	return err
+}
+
+// List returns every document in the underlying store.
+func (s *AuditStore) List() ([]*CovenantDocument, error) {
+	docs, err := s.store.List()
+	s.audit(StoreOpList, "", err)
+	return docs, err
+}
+
+// Has reports whether the underlying store holds a document.
+func (s *AuditStore) Has(id string) bool {
+	ok := s.store.Has(id)
+	s.audit(StoreOpHas, id, nil)
+	return ok
+}
+
+// Count returns the number of documents in the underlying store.
+func (s *AuditStore) Count() int {
+	n := s.store.Count()
+	s.audit(StoreOpCount, "", nil)
+	return n
+}
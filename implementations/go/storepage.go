@@ -0,0 +1,61 @@
+package grith
+
+import (
+	"encoding/base64"
+	"sort"
+)
+
+// PagedStore is a Store that lists its documents a page at a time, so a
+// long-running registry need not hold every document at once. Pages are
+// ordered by ID, and a cursor resumes after the last ID of its page, so
+// paging is stable while documents are added and removed: none is
+// returned twice, and every document stored throughout is returned.
+// MemoryStore, FileStore, SQLStore, and KVCovenantStore implement it.
+type PagedStore interface {
+	Store
+
+	// ListPage returns up to limit documents following cursor, which is
+	// "" for the first page, and the cursor of the next page, which is ""
+	// after the last.
+	ListPage(cursor string, limit int) ([]*CovenantDocument, string, error)
+}
+
+// encodePageCursor returns the opaque cursor resuming after id.
+func encodePageCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// decodePageCursor returns the ID a cursor resumes after, and checks the
+// page limit.
+func decodePageCursor(cursor string, limit int) (string, error) {
+	if limit < 1 {
+		return "", errorf(ErrCodeInvalidInput, "grith: page limit must be positive, got %d", limit)
+	}
+	after, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || (cursor != "" && len(after) == 0) {
+		return "", errorf(ErrCodeInvalidInput, "grith: invalid page cursor")
+	}
+	return string(after), nil
+}
+
+// pageOf returns the IDs of the page following cursor among ids, which
+// are sorted, and the next page's cursor.
+func pageOf(ids []string, cursor string, limit int) ([]string, string, error) {
+	after, err := decodePageCursor(cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	start := 0
+	if cursor != "" {
+		start = sort.SearchStrings(ids, after)
+		if start < len(ids) && ids[start] == after {
+			start++
+		}
+	}
+	end := min(start+limit, len(ids))
+	next := ""
+	if end < len(ids) {
+		next = encodePageCursor(ids[end-1])
+	}
+	return ids[start:end], next, nil
+}
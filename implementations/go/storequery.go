@@ -0,0 +1,90 @@
+package grith
+
+import (
+	"sort"
+	"time"
+)
+
+// QueryableStore is a Store that selects documents by issuer,
+// beneficiary, expiry, chain parent, and metadata, without the caller
+// listing and filtering every document. Results are ordered by ID.
+// MemoryStore, FileStore, SQLStore, and KVCovenantStore implement it.
+type QueryableStore interface {
+	Store
+
+	// FindByIssuer returns the documents whose issuer has the given
+	// party ID.
+	FindByIssuer(issuerID string) ([]*CovenantDocument, error)
+
+	// FindByBeneficiary returns the documents whose beneficiary has the
+	// given party ID.
+	FindByBeneficiary(beneficiaryID string) ([]*CovenantDocument, error)
+
+	// FindExpiringBefore returns the documents that expire before t.
+	// Documents without an expiry never match.
+	FindExpiringBefore(t time.Time) ([]*CovenantDocument, error)
+
+	// FindChildrenOf returns the documents chained to the parent with the
+	// given ID.
+	FindChildrenOf(parentID string) ([]*CovenantDocument, error)
+
+	// FindByMetadata returns the documents whose metadata maps key to a
+	// value equal to value as JSON.
+	FindByMetadata(key string, value interface{}) ([]*CovenantDocument, error)
+}
+
+// covenantMatcher selects documents for a QueryableStore.
+type covenantMatcher func(doc *CovenantDocument) bool
+
+func issuedBy(issuerID string) covenantMatcher {
+	return func(doc *CovenantDocument) bool { return doc.Issuer.ID == issuerID }
+}
+
+func issuedTo(beneficiaryID string) covenantMatcher {
+	return func(doc *CovenantDocument) bool { return doc.Beneficiary.ID == beneficiaryID }
+}
+
+func expiringBefore(t time.Time) covenantMatcher {
+	return func(doc *CovenantDocument) bool {
+		expires, ok := documentExpiry(doc)
+		return ok && expires.Before(t)
+	}
+}
+
+func childOf(parentID string) covenantMatcher {
+	return func(doc *CovenantDocument) bool { return doc.Chain != nil && doc.Chain.ParentID == parentID }
+}
+
+// withMetadata matches documents whose metadata value for key has the
+// same canonical JSON as value, so that 1 matches 1.0.
+func withMetadata(key string, value interface{}) (covenantMatcher, error) {
+	want, err := CanonicalizeJSON(value)
+	if err != nil {
+		return nil, err
+	}
+	return func(doc *CovenantDocument) bool {
+		got, ok := doc.Metadata[key]
+		if !ok {
+			return false
+		}
+		canonical, err := CanonicalizeJSON(got)
+		return err == nil && canonical == want
+	}, nil
+}
+
+// matchDocuments returns the documents in docs, keyed by ID, that match,
+// ordered by ID. Each is passed through copyDoc before it is returned.
+func matchDocuments(docs map[string]*CovenantDocument, match covenantMatcher, copyDoc func(*CovenantDocument) *CovenantDocument) []*CovenantDocument {
+	ids := make([]string, 0)
+	for id, doc := range docs {
+		if match(doc) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	result := make([]*CovenantDocument, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, copyDoc(docs[id]))
+	}
+	return result
+}
@@ -0,0 +1,186 @@
+package grith
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CovenantState is the lifecycle state of a covenant at some time.
+type CovenantState string
+
+const (
+	// CovenantPending is a covenant whose activatesAt has not passed.
+	CovenantPending CovenantState = "pending"
+	// CovenantActive is a covenant in force.
+	CovenantActive CovenantState = "active"
+	// CovenantInGrace is a covenant past its expiresAt but within its
+	// grace period.
+	CovenantInGrace CovenantState = "grace"
+	// CovenantExpired is a covenant past its expiresAt and grace period.
+	CovenantExpired CovenantState = "expired"
+)
+
+// StateAt returns the lifecycle state of the covenant at t. Unparseable
+// timestamps are ignored.
+func (doc *CovenantDocument) StateAt(t time.Time) CovenantState {
+	if doc.ActivatesAt != "" {
+		if at, err := parseTimestamp(doc.ActivatesAt); err == nil && t.Before(at) {
+			return CovenantPending
+		}
+	}
+	if expires, ok := documentExpiry(doc); ok && !t.Before(expires) {
+		if t.Before(expires.Add(doc.GracePeriodDuration())) {
+			return CovenantInGrace
+		}
+		return CovenantExpired
+	}
+	return CovenantActive
+}
+
+// StoreStats describe the contents and footprint of a covenant store.
+type StoreStats struct {
+	// Documents is the number of stored documents.
+	Documents int
+	// ByState counts the documents in each lifecycle state at At.
+	ByState map[CovenantState]int
+	// SizeOnDisk is the size of the store's files in bytes.
+	SizeOnDisk int64
+	// Reclaimable estimates the bytes Compact would free.
+	Reclaimable int64
+	// Indexes maps each of the store's indexes to its number of keys.
+	Indexes map[string]int
+	At      time.Time
+}
+
+// MaintainedStore is a persistent Store that reports statistics and can
+// be compacted, for operators monitoring and maintaining long-lived
+// registries. FileStore, SQLStore, and KVCovenantStore implement it.
+type MaintainedStore interface {
+	Store
+
+	// Stats reads every document to count them by state.
+	Stats() (*StoreStats, error)
+
+	// Compact frees the space of superseded and deleted documents.
+	Compact() error
+}
+
+func newStoreStats() *StoreStats {
+	return &StoreStats{ByState: make(map[CovenantState]int), Indexes: make(map[string]int), At: time.Now().UTC()}
+}
+
+// count adds doc to the statistics.
+func (st *StoreStats) count(doc *CovenantDocument) {
+	st.Documents++
+	st.ByState[doc.StateAt(st.At)]++
+}
+
+// Stats returns the store's statistics. Its only index is the ID index,
+// and unreferenced objects and temporary files are reclaimable.
+func (s *FileStore) Stats() (*StoreStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := newStoreStats()
+	referenced := make(map[string]bool, len(s.index))
+	for id, hash := range s.index {
+		doc, err := s.read(id, hash)
+		if err != nil {
+			return nil, err
+		}
+		st.count(doc)
+		referenced[hash+".json"] = true
+	}
+	st.Indexes["id"] = len(s.index)
+	for _, dir := range []string{s.dir, filepath.Join(s.dir, "objects")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, errorf(ErrCodeStorage, "grith: fileStore.Stats: failed to read store directory: %w", err)
+		}
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil || e.IsDir() {
+				continue
+			}
+			st.SizeOnDisk += info.Size()
+			if strings.HasPrefix(e.Name(), ".tmp-") || (dir != s.dir && !referenced[e.Name()]) {
+				st.Reclaimable += info.Size()
+			}
+		}
+	}
+	return st, nil
+}
+
+// Compact removes unreferenced objects and temporary files, as opening
+// the store does.
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.collectGarbage()
+}
+
+// Stats returns the statistics of the store's covenants. SizeOnDisk and
+// Reclaimable are those of the whole KVStore file.
+func (s *KVCovenantStore) Stats() (*StoreStats, error) {
+	s.kv.mu.RLock()
+	defer s.kv.mu.RUnlock()
+	st := newStoreStats()
+	for id, data := range s.kv.buckets[kvBucketCovenants] {
+		doc, err := s.codec.decode(id, data)
+		if err != nil {
+			return nil, err
+		}
+		st.count(doc)
+	}
+	st.Indexes["id"] = len(s.kv.buckets[kvBucketCovenants])
+	st.SizeOnDisk = s.kv.size
+	st.Reclaimable = max(s.kv.size-s.kv.live, 0)
+	return st, nil
+}
+
+// Compact rewrites the KVStore file. See KVStore.Compact.
+func (s *KVCovenantStore) Compact() error {
+	return s.kv.Compact()
+}
+
+// Stats returns the store's statistics. The size of the database comes
+// from SQLite's page counts, and free pages are reclaimable.
+func (s *SQLStore) Stats() (*StoreStats, error) {
+	st := newStoreStats()
+	docs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		st.count(doc)
+	}
+	var issuers, beneficiaries, expiries, parents int
+	err = s.db.QueryRow(`SELECT COUNT(DISTINCT issuer), COUNT(DISTINCT beneficiary), COUNT(DISTINCT expires_at),
+		COUNT(DISTINCT chain_parent) FROM grith_covenants`).Scan(&issuers, &beneficiaries, &expiries, &parents)
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: sqlStore.Stats: %w", err)
+	}
+	st.Indexes = map[string]int{"id": len(docs), "issuer": issuers, "beneficiary": beneficiaries, "expires_at": expiries, "chain_parent": parents}
+	var pages, freePages, pageSize int64
+	for _, p := range []struct {
+		pragma string
+		v      *int64
+	}{{"page_count", &pages}, {"freelist_count", &freePages}, {"page_size", &pageSize}} {
+		if err := s.db.QueryRow(`PRAGMA ` + p.pragma).Scan(p.v); err != nil {
+			return nil, errorf(ErrCodeStorage, "grith: sqlStore.Stats: failed to read %s: %w", p.pragma, err)
+		}
+	}
+	st.SizeOnDisk = pages * pageSize
+	st.Reclaimable = freePages * pageSize
+	return st, nil
+}
+
+// Compact rebuilds the database with VACUUM, returning free pages to the
+// file system.
+func (s *SQLStore) Compact() error {
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return errorf(ErrCodeStorage, "grith: sqlStore.Compact: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package grith
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Tx is the view of a BatchStore inside a transaction. Reads see the
+// transaction's own writes.
+type Tx interface {
+	Put(id string, doc *CovenantDocument) error
+	Get(id string) (*CovenantDocument, error)
+	Delete(id string) error
+	Has(id string) bool
+}
+
+// BatchStore is a Store that can apply several writes atomically, so that
+// a chain update, such as storing a parent and its child and deleting the
+// predecessor they replace, is stored or rejected as a whole. MemoryStore,
+// FileStore, SQLStore, and KVCovenantStore implement it.
+type BatchStore interface {
+	Store
+
+	// Batch runs fn in a transaction and applies its writes if fn returns
+	// nil. If fn, or applying the writes, fails, none are applied and the
+	// error is returned. The store is locked while fn runs, so fn must
+	// use only tx, which is invalid once fn returns.
+	Batch(fn func(tx Tx) error) error
+}
+
+// stagedTx is a Tx that stages writes over a read function, to be applied
+// by its store once the transaction succeeds.
+type stagedTx struct {
+	name   string // the store's name in errors, such as "fileStore"
+	check  putCheck
+	read   func(id string) (*CovenantDocument, error)
+	writes map[string]*CovenantDocument // a nil document is a delete
+	order  []string
+	closed bool
+}
+
+func newStagedTx(name string, check putCheck, read func(id string) (*CovenantDocument, error)) *stagedTx {
+	return &stagedTx{name: name, check: check, read: read, writes: make(map[string]*CovenantDocument)}
+}
+
+// run runs fn in the transaction and closes it.
+func (tx *stagedTx) run(fn func(tx Tx) error) error {
+	defer func() { tx.closed = true }()
+	return fn(tx)
+}
+
+// stage records a write of doc, or a delete if doc is nil.
+func (tx *stagedTx) stage(id string, doc *CovenantDocument) {
+	if _, ok := tx.writes[id]; !ok {
+		tx.order = append(tx.order, id)
+	}
+	tx.writes[id] = doc
+}
+
+// each calls fn with every staged write, in the order first staged.
+func (tx *stagedTx) each(fn func(id string, doc *CovenantDocument) error) error {
+	for _, id := range tx.order {
+		if err := fn(id, tx.writes[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *stagedTx) usable(op, id string) error {
+	if tx.closed {
+		return errorf(ErrCodeInvalidInput, "grith: %s.Batch: transaction is closed", tx.name)
+	}
+	if id == "" {
+		return errorf(ErrCodeInvalidInput, "grith: %s.Batch: %s: id must be a non-empty string", tx.name, op)
+	}
+	return nil
+}
+
+// Put stages doc under id, after the store's Put checks.
+func (tx *stagedTx) Put(id string, doc *CovenantDocument) error {
+	if err := tx.usable("Put", id); err != nil {
+		return err
+	}
+	if doc == nil {
+		return errorf(ErrCodeMissingField, "grith: %s.Batch: Put: document is required", tx.name)
+	}
+	if err := tx.check.check(id, doc); err != nil {
+		return err
+	}
+	tx.stage(id, doc.Clone())
+	return nil
+}
+
+// Get returns the document under id as of the transaction's writes.
+func (tx *stagedTx) Get(id string) (*CovenantDocument, error) {
+	if err := tx.usable("Get", id); err != nil {
+		return nil, err
+	}
+	doc, staged := tx.writes[id]
+	if !staged {
+		return tx.read(id)
+	}
+	return doc.Clone(), nil
+}
+
+// Delete stages the removal of the document under id, which must exist.
+func (tx *stagedTx) Delete(id string) error {
+	if err := tx.usable("Delete", id); err != nil {
+		return err
+	}
+	doc, staged := tx.writes[id]
+	if staged && doc == nil || !staged && !tx.Has(id) {
+		return errorf(ErrCodeNotFound, "grith: %s.Batch: document not found: %s", tx.name, id)
+	}
+	if staged {
+		// Deleting a document this transaction stored need not touch the
+		// store unless the store held one before.
+		base, err := tx.read(id)
+		if err != nil {
+			return err
+		}
+		if base == nil {
+			delete(tx.writes, id)
+			for i, staged := range tx.order {
+				if staged == id {
+					tx.order = append(tx.order[:i], tx.order[i+1:]...)
+					break
+				}
+			}
+			return nil
+		}
+	}
+	tx.stage(id, nil)
+	return nil
+}
+
+// Has reports whether a document is under id as of the transaction's
+// writes. Read errors count as absent.
+func (tx *stagedTx) Has(id string) bool {
+	doc, err := tx.Get(id)
+	return err == nil && doc != nil
+}
+
+// Batch applies fn's writes atomically. See BatchStore.
+func (s *MemoryStore) Batch(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := newStagedTx("store", s.put, func(id string) (*CovenantDocument, error) {
+		doc, ok := s.data[id]
+		if !ok {
+			return nil, nil
+		}
+		return doc.Clone(), nil
+	})
+	if err := tx.run(fn); err != nil {
+		return err
+	}
+	// The staged documents are copies owned by the closed transaction.
+	return tx.each(func(id string, doc *CovenantDocument) error {
+		if old, ok := s.data[id]; ok {
+			s.index.remove(id, old)
+			delete(s.data, id)
+		}
+		if doc != nil {
+			s.data[id] = doc
+			s.index.add(id, doc)
+		}
+		return nil
+	})
+}
+
+// Batch applies fn's writes atomically: new documents are written first,
+// and the index, written once, commits them all. See BatchStore.
+func (s *FileStore) Batch(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := newStagedTx("fileStore", s.put, func(id string) (*CovenantDocument, error) {
+		hash, ok := s.index[id]
+		if !ok {
+			return nil, nil
+		}
+		return s.read(id, hash)
+	})
+	if err := tx.run(fn); err != nil {
+		return err
+	}
+
+	index := make(map[string]string, len(s.index))
+	for id, hash := range s.index {
+		index[id] = hash
+	}
+	var written []string
+	err := tx.each(func(id string, doc *CovenantDocument) error {
+		if doc == nil {
+			delete(index, id)
+			return nil
+		}
+		data, err := s.codec.encode(id, doc)
+		if err != nil {
+			return err
+		}
+		hash := SHA256Hex(data)
+		if _, err := os.Stat(s.objectPath(hash)); os.IsNotExist(err) {
+			if err := writeFileAtomic(filepath.Join(s.dir, "objects"), hash+".json", data); err != nil {
+				return errorf(ErrCodeStorage, "grith: fileStore.Batch: failed to write document: %w", err)
+			}
+			written = append(written, hash)
+		}
+		index[id] = hash
+		return nil
+	})
+	old := s.index
+	if err == nil {
+		s.index = index
+		if err = s.writeIndex(); err != nil {
+			s.index = old
+		}
+	}
+	if err != nil {
+		for _, hash := range written {
+			s.release(hash)
+		}
+		return err
+	}
+	for id, hash := range old {
+		if index[id] != hash {
+			s.release(hash)
+		}
+	}
+	return nil
+}
+
+// Batch applies fn's writes atomically, as a single log record. See
+// BatchStore.
+func (s *KVCovenantStore) Batch(fn func(tx Tx) error) error {
+	s.kv.mu.Lock()
+	defer s.kv.mu.Unlock()
+	tx := newStagedTx("kvStore", s.put, func(id string) (*CovenantDocument, error) {
+		data, ok := s.kv.buckets[kvBucketCovenants][id]
+		if !ok {
+			return nil, nil
+		}
+		return s.codec.decode(id, data)
+	})
+	if err := tx.run(fn); err != nil {
+		return err
+	}
+	var ops []kvOp
+	err := tx.each(func(id string, doc *CovenantDocument) error {
+		if doc == nil {
+			ops = append(ops, kvOp{Bucket: kvBucketCovenants, Key: id, Delete: true})
+			return nil
+		}
+		data, err := s.codec.encode(id, doc)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, kvOp{Bucket: kvBucketCovenants, Key: id, Value: data})
+		return nil
+	})
+	if err != nil || len(ops) == 0 {
+		return err
+	}
+	return s.kv.commit(ops)
+}
+
+// Batch applies fn's writes atomically, in one database transaction that
+// fn's reads also run in. See BatchStore.
+func (s *SQLStore) Batch(fn func(tx Tx) error) error {
+	var fnErr error
+	err := s.inTx("Batch", func(sqlTx *sql.Tx) error {
+		tx := newStagedTx("sqlStore", s.put, func(id string) (*CovenantDocument, error) {
+			var data string
+			err := sqlTx.QueryRow(`SELECT document FROM grith_covenants WHERE id = ?`, id).Scan(&data)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, errorf(ErrCodeStorage, "grith: sqlStore.Batch: %w", err)
+			}
+			return s.codec.decode(id, []byte(data))
+		})
+		if fnErr = tx.run(fn); fnErr != nil {
+			return fnErr
+		}
+		return tx.each(func(id string, doc *CovenantDocument) error {
+			if doc == nil {
+				_, err := sqlTx.Exec(`DELETE FROM grith_covenants WHERE id = ?`, id)
+				return err
+			}
+			return s.putRow(sqlTx, id, doc)
+		})
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
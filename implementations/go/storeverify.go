@@ -0,0 +1,40 @@
+package grith
+
+// putCheck enforces StoreOptions.VerifyOnPut.
+type putCheck struct {
+	enabled bool
+	opts    *VerifyOptions
+}
+
+func newPutCheck(opts *StoreOptions) putCheck {
+	if opts == nil {
+		return putCheck{}
+	}
+	return putCheck{enabled: opts.VerifyOnPut, opts: opts.Verify}
+}
+
+// check rejects doc, about to be stored under id, if its ID is not id or
+// not the hash of its contents, or if it fails verification.
+func (c putCheck) check(id string, doc *CovenantDocument) error {
+	if !c.enabled {
+		return nil
+	}
+	if doc.ID != id {
+		return errorf(ErrCodeInvalidInput, "grith: covenant %s cannot be stored under ID %s", shortID(doc.ID), shortID(id))
+	}
+	computed, err := ComputeID(doc)
+	if err != nil {
+		return err
+	}
+	if computed != doc.ID {
+		return errorf(ErrCodeInvalidInput, "grith: covenant ID %s does not match its contents", shortID(doc.ID))
+	}
+	result, err := VerifyCovenantWithOptions(doc, c.opts)
+	if err != nil {
+		return err
+	}
+	if !result.Valid {
+		return errorf(ErrCodeInvalidInput, "grith: covenant %s failed verification: %s", shortID(doc.ID), failedCheckNames(result.Checks))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package grith
+
+import "io"
+
+// DefaultProgressInterval is how many entries VerifyLogStream verifies
+// between progress reports.
+const DefaultProgressInterval = 10000
+
+// StreamVerifyOptions configure VerifyLogStream.
+type StreamVerifyOptions struct {
+	// Covenant is the covenant the log was kept under. Required.
+	Covenant *CovenantDocument
+	// DIDResolver resolves the beneficiary's key when Read.PublicKey is
+	// not set.
+	DIDResolver DIDResolver
+	// Read configures integrity checking. PublicKey defaults to the
+	// covenant beneficiary's key and CovenantID to the covenant's ID.
+	Read ReadJSONLOptions
+	// Replay configures the compliance replay. Set MaxFindings to bound
+	// the size of the report.
+	Replay ReplayOptions
+	// Progress, if set, is called every ProgressInterval entries and once
+	// more when the stream ends.
+	Progress         func(StreamProgress)
+	ProgressInterval int64
+}
+
+// StreamProgress reports how far VerifyLogStream has got.
+type StreamProgress struct {
+	Entries    int64
+	Bytes      int64
+	Violations int
+	Done       bool
+}
+
+// StreamVerifyResult is the outcome of VerifyLogStream.
+type StreamVerifyResult struct {
+	Log        *JSONLReadResult `json:"log"`
+	Compliance ComplianceReport `json:"compliance"`
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// VerifyLogStream verifies a JSON Lines action log in a single pass: each
+// entry's chain link, hash, and signature, the checkpoints in opts.Read,
+// and compliance with the covenant's constraints, as ReadJSONL and
+// ReplayComplianceWithOptions do. Memory use does not grow with the
+// log's length, apart from the findings recorded in the report.
+//
+// A broken chain, bad signature, or checkpoint mismatch stops
+// verification with an error. Compliance violations do not; they are
+// reported in the result.
+func VerifyLogStream(r io.Reader, opts *StreamVerifyOptions) (*StreamVerifyResult, error) {
+	if opts == nil || opts.Covenant == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: streaming verification requires a covenant")
+	}
+	doc := opts.Covenant
+	readOpts := opts.Read
+	if readOpts.PublicKey == nil {
+		key, err := resolvePartyKey(doc.Beneficiary, opts.DIDResolver)
+		if err != nil {
+			return nil, err
+		}
+		readOpts.PublicKey = key
+	}
+	if readOpts.CovenantID == "" {
+		readOpts.CovenantID = doc.ID
+	}
+	if readOpts.CovenantID != doc.ID {
+		return nil, errorf(ErrCodeInvalidInput, "grith: log covenant %s does not match the covenant", shortID(readOpts.CovenantID))
+	}
+
+	replayOpts := opts.Replay
+	rp := newReplay(doc, &replayOpts)
+	if rp.err != nil {
+		return nil, rp.err
+	}
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	cr := &countingReader{r: r}
+	progress := func(done bool) {
+		if opts.Progress != nil {
+			opts.Progress(StreamProgress{
+				Entries:    int64(rp.report.Entries),
+				Bytes:      cr.n,
+				Violations: len(rp.report.Violations) + rp.report.Omitted,
+				Done:       done,
+			})
+		}
+	}
+
+	logResult, err := ReadJSONL(cr, &readOpts, func(e ActionLogEntry) error {
+		rp.step(&e)
+		if int64(rp.report.Entries)%interval == 0 {
+			progress(false)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	rp.finish()
+	progress(true)
+	return &StreamVerifyResult{Log: logResult, Compliance: *rp.report}, nil
+}
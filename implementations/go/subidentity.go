@@ -0,0 +1,207 @@
+package grith
+
+import "sort"
+
+// ChangeDerived is the lineage change type of a sub-identity's creation.
+const ChangeDerived = "derived"
+
+// ParentBinding ties a sub-identity to the identity that derived it. The
+// parent's operators sign it, naming the child's operator key and the
+// capabilities the child may claim, so a worker's actions are attributable
+// to the orchestrator that spawned it.
+type ParentBinding struct {
+	ParentID string `json:"parentId"`
+	// ParentLineageHash is the identity hash of the parent version's
+	// latest lineage entry, which every later parent version carries.
+	ParentLineageHash string `json:"parentLineageHash"`
+	ParentOperatorKey string `json:"parentOperatorKey"`
+	// ParentOperators is set when the parent is an organizational
+	// identity; the binding then carries threshold Signatures.
+	ParentOperators *OperatorSet `json:"parentOperators,omitempty"`
+	// ParentCapabilities is the parent's capability manifest, which
+	// bounds the child's capabilities through all of its evolutions.
+	ParentCapabilities []string            `json:"parentCapabilities"`
+	ParentManifestHash string              `json:"parentManifestHash"`
+	ChildOperatorKey   string              `json:"childOperatorKey"`
+	Timestamp          string              `json:"timestamp"`
+	Signature          string              `json:"signature,omitempty"`
+	Signatures         []OperatorSignature `json:"signatures,omitempty"`
+}
+
+// SubIdentityOptions are the options for DeriveSubIdentity.
+type SubIdentityOptions struct {
+	// ParentKeyPair signs the binding for a single-operator parent;
+	// ParentKeyPairs sign it for an organizational one.
+	ParentKeyPair  *KeyPair
+	ParentKeyPairs []*KeyPair
+	// OperatorKeyPair is the sub-identity's own operator key.
+	OperatorKeyPair *KeyPair
+	// Capabilities must be a subset of the parent's.
+	Capabilities []string
+	// Model and Deployment default to the parent's. The sub-identity
+	// also inherits the parent's evolution policy.
+	Model      *ModelAttestation
+	Deployment *DeploymentContext
+}
+
+// DeriveSubIdentity creates a child identity, operated under its own key,
+// whose capabilities are a subset of parent's and whose binding to parent
+// is signed by parent's operators.
+func DeriveSubIdentity(parent *AgentIdentity, opts *SubIdentityOptions) (*AgentIdentity, error) {
+	if parent == nil || len(parent.Lineage) == 0 {
+		return nil, errorf(ErrCodeMissingField, "grith: parent identity with a lineage is required")
+	}
+	if opts == nil || opts.OperatorKeyPair == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: sub-identity requires an operator key pair")
+	}
+	if opts.Capabilities == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: capabilities array is required")
+	}
+	if result, err := VerifyIdentity(parent); err != nil || !result.Valid {
+		return nil, errorf(ErrCodeInvalidInput, "grith: parent identity %s failed verification", shortID(parent.ID))
+	}
+	if opts.ParentKeyPair != nil && parent.Operators == nil && opts.ParentKeyPair.PublicKeyHex != parent.OperatorPublicKey {
+		return nil, errorf(ErrCodeInvalidInput, "grith: parent key pair is not the parent's operator key")
+	}
+	if err := checkCapabilitySubset(opts.Capabilities, parent.Capabilities); err != nil {
+		return nil, err
+	}
+
+	binding := &ParentBinding{
+		ParentID:           parent.ID,
+		ParentLineageHash:  parent.Lineage[len(parent.Lineage)-1].IdentityHash,
+		ParentOperatorKey:  parent.OperatorPublicKey,
+		ParentOperators:    copyOperatorSet(parent.Operators),
+		ParentCapabilities: append([]string(nil), parent.Capabilities...),
+		ParentManifestHash: parent.CapabilityManifestHash,
+		ChildOperatorKey:   opts.OperatorKeyPair.PublicKeyHex,
+		Timestamp:          Timestamp(),
+	}
+	payload, err := parentBindingPayload(binding)
+	if err != nil {
+		return nil, err
+	}
+	binding.Signature, binding.Signatures, err = signAsOperators(payload, opts.ParentKeyPair, opts.ParentKeyPairs, parent.Operators)
+	if err != nil {
+		return nil, err
+	}
+
+	create := &CreateIdentityOptions{
+		OperatorKeyPair:    opts.OperatorKeyPair,
+		OperatorIdentifier: parent.OperatorIdentifier,
+		Model:              parent.Model,
+		Capabilities:       opts.Capabilities,
+		Deployment:         parent.Deployment,
+		EvolutionPolicy:    parent.EvolutionPolicy,
+	}
+	if opts.Model != nil {
+		create.Model = *opts.Model
+	}
+	if opts.Deployment != nil {
+		create.Deployment = *opts.Deployment
+	}
+	return createIdentity(create, binding, nil)
+}
+
+func parentBindingPayload(b *ParentBinding) ([]byte, error) {
+	m, err := objectToMap(b)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to convert parent binding to map: %w", err)
+	}
+	delete(m, "signature")
+	delete(m, "signatures")
+	canonical, err := CanonicalizeJSON(m)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to canonicalize parent binding: %w", err)
+	}
+	return []byte(canonical), nil
+}
+
+// checkCapabilitySubset fails unless every capability is granted.
+func checkCapabilitySubset(capabilities, granted []string) error {
+	allowed := make(map[string]bool, len(granted))
+	for _, c := range granted {
+		allowed[c] = true
+	}
+	var excess []string
+	for _, c := range capabilities {
+		if !allowed[c] {
+			excess = append(excess, c)
+		}
+	}
+	if len(excess) > 0 {
+		sort.Strings(excess)
+		return errorf(ErrCodeInvalidInput, "grith: capabilities %s are not held by the parent identity", joinEnglish(excess))
+	}
+	return nil
+}
+
+// verifyParentBinding checks identity's parent binding: it is signed by
+// the parent's operators, names a key the identity's lineage links to
+// its current key, and grants every capability the identity claims.
+func verifyParentBinding(identity *AgentIdentity) error {
+	b := identity.Parent
+	if ComputeCapabilityManifestHash(b.ParentCapabilities) != b.ParentManifestHash {
+		return errorf(ErrCodeInvalidInput, "grith: parent binding manifest hash does not match its capabilities")
+	}
+	if err := checkCapabilitySubset(identity.Capabilities, b.ParentCapabilities); err != nil {
+		return err
+	}
+	if !identityHasKey(identity, b.ChildOperatorKey) {
+		return errorf(ErrCodeInvalidInput, "grith: parent binding names a different operator key")
+	}
+	payload, err := parentBindingPayload(b)
+	if err != nil {
+		return err
+	}
+	set, sigs := b.ParentOperators, b.Signatures
+	if set == nil {
+		set = &OperatorSet{Keys: []string{b.ParentOperatorKey}, Threshold: 1}
+		sigs = []OperatorSignature{{PublicKey: b.ParentOperatorKey, Signature: b.Signature}}
+	} else if validateOperatorSet(set) != nil || set.Keys[0] != b.ParentOperatorKey {
+		return errorf(ErrCodeInvalidInput, "grith: parent binding has an invalid operator set")
+	}
+	if !verifyOperatorSignatures(payload, sigs, set) {
+		return errorf(ErrCodeCrypto, "grith: parent binding is not signed by the parent's operators")
+	}
+	return nil
+}
+
+// VerifySubIdentity verifies child and checks that it was derived from
+// parent or an earlier version of it, under an operator key or set the
+// parent still holds or held at the time.
+func VerifySubIdentity(child, parent *AgentIdentity) error {
+	if child == nil || parent == nil {
+		return errorf(ErrCodeMissingField, "grith: child and parent identities are required")
+	}
+	if child.Parent == nil {
+		return errorf(ErrCodeInvalidInput, "grith: identity %s is not a sub-identity", shortID(child.ID))
+	}
+	if result, err := VerifyIdentity(child); err != nil || !result.Valid {
+		return errorf(ErrCodeInvalidInput, "grith: sub-identity %s failed verification", shortID(child.ID))
+	}
+	if result, err := VerifyIdentity(parent); err != nil || !result.Valid {
+		return errorf(ErrCodeInvalidInput, "grith: parent identity %s failed verification", shortID(parent.ID))
+	}
+	if !identityHasLineage(parent, child.Parent.ParentLineageHash) {
+		return errorf(ErrCodeInvalidInput, "grith: identity %s was not derived from %s", shortID(child.ID), shortID(parent.ID))
+	}
+	if !identityHasKey(parent, child.Parent.ParentOperatorKey) && !parentHadOperatorKey(parent, child.Parent.ParentOperatorKey) {
+		return errorf(ErrCodeInvalidInput, "grith: identity %s was bound by a key that %s never held", shortID(child.ID), shortID(parent.ID))
+	}
+	return nil
+}
+
+// parentHadOperatorKey reports whether key was the primary key of an
+// operator set in identity's lineage.
+func parentHadOperatorKey(identity *AgentIdentity, key string) bool {
+	if s := compactionSummary(identity); s != nil && s.Operators != nil && s.Operators.Keys[0] == key {
+		return true
+	}
+	for _, e := range identity.Lineage {
+		if e.Operators != nil && len(e.Operators.Keys) > 0 && e.Operators.Keys[0] == key {
+			return true
+		}
+	}
+	return false
+}
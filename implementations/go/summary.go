@@ -0,0 +1,254 @@
+package grith
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CovenantSummary is a plain-English description of a covenant, intended
+// for approvers who should not have to read CCL before countersigning.
+// Each field holds one sentence per item, in document order.
+type CovenantSummary struct {
+	// Headline is a one-sentence overview, e.g.
+	// "alice grants bob 2 permissions, 1 restriction, and 1 rate limit."
+	Headline    string   `json:"headline"`
+	Parties     []string `json:"parties"`
+	Validity    []string `json:"validity"`
+	Permits     []string `json:"permits"`
+	Denies      []string `json:"denies"`
+	Limits      []string `json:"limits"`
+	Obligations []string `json:"obligations"`
+	// Notes covers delegation, countersignatures, extensions, and any
+	// reason the constraints could not be summarized.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Summarize describes doc in plain English. Constraints stored by
+// reference are not fetched; the summary notes that they must be
+// reviewed separately. Summarize never fails: problems with the document
+// are reported in Notes.
+func Summarize(doc *CovenantDocument) CovenantSummary {
+	s := CovenantSummary{
+		Parties: []string{
+			fmt.Sprintf("Issuer: %s (key %s)", doc.Issuer.ID, summarizeKey(doc.Issuer.PublicKey)),
+			fmt.Sprintf("Beneficiary: %s (key %s)", doc.Beneficiary.ID, summarizeKey(doc.Beneficiary.PublicKey)),
+		},
+		Validity: summarizeValidity(doc),
+	}
+
+	switch {
+	case doc.ConstraintsRef != nil:
+		ref := doc.ConstraintsRef.Hash
+		if doc.ConstraintsRef.URI != "" {
+			ref = doc.ConstraintsRef.URI
+		}
+		s.Notes = append(s.Notes, fmt.Sprintf("Constraints are stored by reference (%s) and must be reviewed separately.", ref))
+	default:
+		ccl, err := parsedConstraints(doc.Constraints)
+		if err != nil {
+			s.Notes = append(s.Notes, fmt.Sprintf("Constraints could not be parsed and must be reviewed as written: %v", err))
+			break
+		}
+		for _, stmt := range ccl.Permits {
+			s.Permits = append(s.Permits, "May "+summarizeRule(stmt)+".")
+		}
+		for _, stmt := range ccl.Denies {
+			s.Denies = append(s.Denies, "May not "+summarizeRule(stmt)+".")
+		}
+		for _, stmt := range ccl.Limits {
+			s.Limits = append(s.Limits, summarizeLimit(stmt))
+		}
+		for _, stmt := range ccl.Obligations {
+			s.Obligations = append(s.Obligations, "Must "+summarizeRule(stmt)+".")
+		}
+		s.Notes = append(s.Notes, "Anything not explicitly permitted is denied; where rules overlap, the most specific wins and a denial beats a permission of equal specificity.")
+	}
+
+	if doc.Chain != nil {
+		s.Notes = append(s.Notes, fmt.Sprintf("Delegated from covenant %s (%s, depth %d); the parent's constraints also apply.", shortID(doc.Chain.ParentID), doc.Chain.Relation, doc.Chain.Depth))
+	}
+	if n := len(doc.Countersignatures); n > 0 {
+		s.Notes = append(s.Notes, fmt.Sprintf("Countersigned by %s.", plural(n, "party", "parties")))
+	}
+	var critical []string
+	for name, ext := range doc.Extensions {
+		if ext.Critical {
+			critical = append(critical, name)
+		}
+	}
+	if len(critical) > 0 {
+		sort.Strings(critical)
+		s.Notes = append(s.Notes, fmt.Sprintf("Carries critical extensions that verifiers must understand: %s.", strings.Join(critical, ", ")))
+	}
+
+	s.Headline = summarizeHeadline(doc, &s)
+	return s
+}
+
+// String renders the summary as plain text with one section per
+// non-empty field.
+func (s CovenantSummary) String() string {
+	var b strings.Builder
+	b.WriteString(s.Headline)
+	b.WriteString("\n")
+	sections := []struct {
+		title string
+		items []string
+	}{
+		{"Parties", s.Parties},
+		{"Validity", s.Validity},
+		{"Permitted", s.Permits},
+		{"Forbidden", s.Denies},
+		{"Rate limits", s.Limits},
+		{"Obligations", s.Obligations},
+		{"Notes", s.Notes},
+	}
+	for _, sec := range sections {
+		if len(sec.items) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", sec.title)
+		for _, item := range sec.items {
+			fmt.Fprintf(&b, "  - %s\n", item)
+		}
+	}
+	return b.String()
+}
+
+func summarizeHeadline(doc *CovenantDocument, s *CovenantSummary) string {
+	var parts []string
+	if n := len(s.Permits); n > 0 {
+		parts = append(parts, plural(n, "permission", "permissions"))
+	}
+	if n := len(s.Denies); n > 0 {
+		parts = append(parts, plural(n, "restriction", "restrictions"))
+	}
+	if n := len(s.Limits); n > 0 {
+		parts = append(parts, plural(n, "rate limit", "rate limits"))
+	}
+	if n := len(s.Obligations); n > 0 {
+		parts = append(parts, plural(n, "obligation", "obligations"))
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("%s issues a covenant to %s.", doc.Issuer.ID, doc.Beneficiary.ID)
+	}
+	return fmt.Sprintf("%s grants %s %s.", doc.Issuer.ID, doc.Beneficiary.ID, joinEnglish(parts))
+}
+
+func summarizeValidity(doc *CovenantDocument) []string {
+	var out []string
+	if doc.ActivatesAt != "" {
+		out = append(out, "Takes effect "+summarizeTime(doc.ActivatesAt)+".")
+	} else {
+		out = append(out, "Takes effect when signed ("+summarizeTime(doc.CreatedAt)+").")
+	}
+	if doc.ExpiresAt != "" {
+		line := "Expires " + summarizeTime(doc.ExpiresAt)
+		if doc.GracePeriod > 0 {
+			line += ", with a grace period of " + doc.GracePeriodDuration().String()
+		}
+		out = append(out, line+".")
+	} else {
+		out = append(out, "Does not expire.")
+	}
+	return out
+}
+
+func summarizeTime(ts string) string {
+	t, err := parseTimestamp(ts)
+	if err != nil {
+		return ts
+	}
+	return "on " + t.UTC().Format("2 January 2006 at 15:04 UTC")
+}
+
+func summarizeKey(key string) string {
+	if IsDID(key) {
+		return key
+	}
+	if len(key) > 16 {
+		return key[:16] + "..."
+	}
+	return key
+}
+
+func summarizeRule(stmt Statement) string {
+	return summarizeAction(stmt.Action) + " on " + summarizeResource(stmt.Resource) + summarizeCondition(stmt.Condition)
+}
+
+func summarizeAction(action string) string {
+	switch {
+	case action == "*" || action == "**":
+		return "perform any action"
+	case strings.HasSuffix(action, ".**") || strings.HasSuffix(action, ".*"):
+		return fmt.Sprintf("perform any %q action", strings.TrimRight(action, ".*"))
+	}
+	return fmt.Sprintf("perform %q", action)
+}
+
+func summarizeResource(resource string) string {
+	switch {
+	case resource == "*" || resource == "**" || resource == "/**":
+		return "any resource"
+	case strings.HasSuffix(resource, "/**"):
+		return "anything under " + strings.TrimSuffix(resource, "/**")
+	case strings.HasSuffix(resource, "/*"):
+		return "anything directly in " + strings.TrimSuffix(resource, "/*")
+	}
+	return resource
+}
+
+func summarizeCondition(cond *Condition) string {
+	if cond == nil {
+		return ""
+	}
+	ops := map[string]string{
+		"=":  "is",
+		"!=": "is not",
+		"<":  "is less than",
+		">":  "is greater than",
+		"<=": "is at most",
+		">=": "is at least",
+	}
+	op, ok := ops[cond.Operator]
+	if !ok {
+		op = cond.Operator
+	}
+	return fmt.Sprintf(", only when %s %s %s", cond.Field, op, cond.Value)
+}
+
+func summarizeLimit(stmt Statement) string {
+	value, unit := bestTimeUnit(stmt.Period)
+	period := strconv.FormatFloat(value, 'f', -1, 64) + " " + unit
+	if value == 1 {
+		period = strings.TrimSuffix(unit, "s")
+	}
+	count := strconv.FormatFloat(stmt.Limit, 'f', -1, 64)
+	times := "times"
+	if stmt.Limit == 1 {
+		times = "time"
+	}
+	return fmt.Sprintf("May %s at most %s %s per %s.", summarizeAction(stmt.Action), count, times, period)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return strconv.Itoa(n) + " " + many
+}
+
+// joinEnglish joins items as "a", "a and b", or "a, b, and c".
+func joinEnglish(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	case 2:
+		return items[0] + " and " + items[1]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + ", and " + items[len(items)-1]
+}
@@ -0,0 +1,278 @@
+package grith
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// AttestationVerifier verifies one TEE attestation format, so that an
+// identity deployed on RuntimeTEE proves its runtime claim rather than
+// asserting it.
+type AttestationVerifier interface {
+	// Type names the format, e.g. "aws-nitro". It is matched against
+	// DeploymentContext.TEEAttestationType to select the verifier.
+	Type() string
+	// Verify checks attestation against the format's trust roots at now
+	// and requires it to carry binding as its user data.
+	Verify(attestation, binding []byte, now time.Time) (*TEEAttestationReport, error)
+}
+
+// TEEAttestationReport is the outcome of verifying a TEE attestation.
+type TEEAttestationReport struct {
+	Type string
+	// ModuleID identifies the attested enclave instance.
+	ModuleID string
+	// Measurements are the attested code measurements as hex strings,
+	// keyed by register name (e.g. "PCR0").
+	Measurements map[string]string
+	// Timestamp is when the TEE produced the attestation.
+	Timestamp time.Time
+}
+
+// VerifyDeploymentAttestation verifies the TEE attestation of identity's
+// deployment with the verifier for its TEEAttestationType. The
+// attestation must bind the identity's raw 32-byte operator public key
+// as its user data, so it cannot be lifted onto another identity.
+func VerifyDeploymentAttestation(identity *AgentIdentity, verifiers []AttestationVerifier, now time.Time) (*TEEAttestationReport, error) {
+	if identity == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: identity is required")
+	}
+	d := identity.Deployment
+	if d.TEEAttestation == "" {
+		return nil, errorf(ErrCodeMissingField, "grith: deployment has no TEE attestation")
+	}
+	var verifier AttestationVerifier
+	for _, v := range verifiers {
+		if v.Type() == d.TEEAttestationType {
+			verifier = v
+			break
+		}
+	}
+	if verifier == nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: no verifier for TEE attestation type %q", d.TEEAttestationType)
+	}
+	attestation, err := base64.StdEncoding.DecodeString(d.TEEAttestation)
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: TEE attestation is not valid base64: %w", err)
+	}
+	binding, err := FromHex(identity.OperatorPublicKey)
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: invalid operator public key: %w", err)
+	}
+	return verifier.Verify(attestation, binding, now)
+}
+
+func teeAttestationCheck(identity *AgentIdentity, verifiers []AttestationVerifier, now time.Time) VerificationCheck {
+	check := VerificationCheck{Name: "tee_attestation", Code: CheckTEEAttestation}
+	if identity.Deployment.Runtime != RuntimeTEE {
+		check.Passed = true
+		check.Message = fmt.Sprintf("Deployment runtime %q makes no TEE claim", identity.Deployment.Runtime)
+		return check
+	}
+	report, err := VerifyDeploymentAttestation(identity, verifiers, now)
+	if err != nil {
+		check.Message = fmt.Sprintf("TEE attestation is invalid: %v", err)
+		return check
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("Runtime attested by %s module %s at %s", report.Type, report.ModuleID, report.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z"))
+	return check
+}
+
+// TEETypeAWSNitro is the attestation type of AWS Nitro Enclaves.
+const TEETypeAWSNitro = "aws-nitro"
+
+// NitroVerifierOptions configure a NitroAttestationVerifier.
+type NitroVerifierOptions struct {
+	// Roots holds the trusted root certificates, normally the AWS Nitro
+	// Enclaves root published by AWS. Required.
+	Roots *x509.CertPool
+	// PCRs, if set, are the expected hex platform configuration register
+	// values by index, in either case; each must match the attested value.
+	PCRs map[int]string
+	// MaxAge, if positive, rejects attestations older than this.
+	MaxAge time.Duration
+}
+
+// NitroAttestationVerifier verifies AWS Nitro Enclaves attestation
+// documents: COSE_Sign1 structures signed with ECDSA P-384 by a
+// certificate that chains to a trusted root.
+type NitroAttestationVerifier struct {
+	opts NitroVerifierOptions
+	pcrs map[int][]byte
+}
+
+// NewNitroAttestationVerifier creates a verifier for AWS Nitro Enclaves
+// attestation documents.
+func NewNitroAttestationVerifier(opts *NitroVerifierOptions) (*NitroAttestationVerifier, error) {
+	if opts == nil || opts.Roots == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: Nitro attestation verifier requires trusted roots")
+	}
+	o := *opts
+	o.PCRs = make(map[int]string, len(opts.PCRs))
+	pcrs := make(map[int][]byte, len(opts.PCRs))
+	for i, v := range opts.PCRs {
+		b, err := FromHex(v)
+		if err != nil {
+			return nil, errorf(ErrCodeInvalidInput, "grith: expected PCR%d is not hex", i)
+		}
+		o.PCRs[i], pcrs[i] = v, b
+	}
+	return &NitroAttestationVerifier{opts: o, pcrs: pcrs}, nil
+}
+
+// Type returns TEETypeAWSNitro.
+func (v *NitroAttestationVerifier) Type() string { return TEETypeAWSNitro }
+
+// coseAlgES384 is the COSE algorithm identifier for ECDSA with SHA-384.
+const coseAlgES384 = -35
+
+// Verify checks a Nitro attestation document's signature, certificate
+// chain, expected PCRs, age, and user data.
+func (v *NitroAttestationVerifier) Verify(attestation, binding []byte, now time.Time) (*TEEAttestationReport, error) {
+	decoded, err := cborDecode(attestation)
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: malformed Nitro attestation: %w", err)
+	}
+	sign1, ok := decoded.([]interface{})
+	if !ok || len(sign1) != 4 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: Nitro attestation is not a COSE_Sign1 structure")
+	}
+	protected, _ := sign1[0].([]byte)
+	payload, _ := sign1[2].([]byte)
+	signature, _ := sign1[3].([]byte)
+	if protected == nil || payload == nil || len(signature) != 96 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: Nitro attestation is not a COSE_Sign1 structure")
+	}
+	header, err := cborDecode(protected)
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: malformed COSE protected header: %w", err)
+	}
+	if h, ok := header.(map[interface{}]interface{}); !ok || h[uint64(1)] != int64(coseAlgES384) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: Nitro attestation is not signed with ES384")
+	}
+
+	doc, err := parseNitroDocument(payload)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(doc.certificate)
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: invalid Nitro attestation certificate: %w", err)
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range doc.cabundle {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errorf(ErrCodeInvalidInput, "grith: invalid Nitro CA bundle certificate: %w", err)
+		}
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         v.opts.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: Nitro attestation certificate does not chain to a trusted root: %w", err)
+	}
+
+	pub, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P384() {
+		return nil, errorf(ErrCodeCrypto, "grith: Nitro attestation certificate does not hold a P-384 key")
+	}
+	sigStructure, err := cborEncode([]interface{}{"Signature1", protected, []byte{}, payload})
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "grith: failed to encode COSE signature structure: %w", err)
+	}
+	digest := sha512.Sum384(sigStructure)
+	r, s := new(big.Int).SetBytes(signature[:48]), new(big.Int).SetBytes(signature[48:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		return nil, errorf(ErrCodeCrypto, "grith: Nitro attestation signature is invalid")
+	}
+
+	for i, want := range v.pcrs {
+		got, ok := doc.pcrs[i]
+		if !ok || !bytes.Equal(got, want) {
+			return nil, errorf(ErrCodeInvalidInput, "grith: attested PCR%d does not match the expected measurement", i)
+		}
+	}
+	if v.opts.MaxAge > 0 && now.Sub(doc.timestamp) > v.opts.MaxAge {
+		return nil, errorf(ErrCodeInvalidInput, "grith: Nitro attestation from %s is older than %s", doc.timestamp.UTC().Format(time.RFC3339), v.opts.MaxAge)
+	}
+	if !bytes.Equal(doc.userData, binding) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: Nitro attestation user data does not bind the operator key")
+	}
+
+	report := &TEEAttestationReport{
+		Type:         TEETypeAWSNitro,
+		ModuleID:     doc.moduleID,
+		Measurements: make(map[string]string, len(doc.pcrs)),
+		Timestamp:    doc.timestamp,
+	}
+	for i, value := range doc.pcrs {
+		report.Measurements[fmt.Sprintf("PCR%d", i)] = ToHex(value)
+	}
+	return report, nil
+}
+
+// nitroDocument is the payload of a Nitro attestation document.
+type nitroDocument struct {
+	moduleID    string
+	timestamp   time.Time
+	pcrs        map[int][]byte
+	certificate []byte
+	cabundle    [][]byte
+	userData    []byte
+}
+
+func parseNitroDocument(payload []byte) (*nitroDocument, error) {
+	decoded, err := cborDecode(payload)
+	if err != nil {
+		return nil, errorf(ErrCodeInvalidInput, "grith: malformed Nitro attestation document: %w", err)
+	}
+	m, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, errorf(ErrCodeInvalidInput, "grith: Nitro attestation document is not a map")
+	}
+	doc := &nitroDocument{pcrs: make(map[int][]byte)}
+	doc.moduleID, _ = m["module_id"].(string)
+	ms, _ := m["timestamp"].(uint64)
+	doc.certificate, _ = m["certificate"].([]byte)
+	if doc.moduleID == "" || ms == 0 || doc.certificate == nil || m["digest"] != "SHA384" {
+		return nil, errorf(ErrCodeInvalidInput, "grith: Nitro attestation document is missing required fields")
+	}
+	doc.timestamp = time.UnixMilli(int64(ms)).UTC()
+
+	pcrs, ok := m["pcrs"].(map[interface{}]interface{})
+	if !ok || len(pcrs) == 0 {
+		return nil, errorf(ErrCodeInvalidInput, "grith: Nitro attestation document has no PCRs")
+	}
+	for k, val := range pcrs {
+		i, ok1 := k.(uint64)
+		b, ok2 := val.([]byte)
+		if !ok1 || !ok2 || i > 31 {
+			return nil, errorf(ErrCodeInvalidInput, "grith: Nitro attestation document has a malformed PCR")
+		}
+		doc.pcrs[int(i)] = b
+	}
+	bundle, _ := m["cabundle"].([]interface{})
+	for _, c := range bundle {
+		der, ok := c.([]byte)
+		if !ok {
+			return nil, errorf(ErrCodeInvalidInput, "grith: Nitro attestation CA bundle is malformed")
+		}
+		doc.cabundle = append(doc.cabundle, der)
+	}
+	if ud, ok := m["user_data"].([]byte); ok {
+		doc.userData = ud
+	}
+	return doc, nil
+}
@@ -0,0 +1,225 @@
+package grith
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ToolCall is a function or tool call proposed by a language model.
+type ToolCall struct {
+	Name string `json:"name"`
+	// Arguments is the call's arguments as a JSON object.
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// ToolMapping describes how calls to one tool are evaluated.
+type ToolMapping struct {
+	// Action is the CCL action of a call. Defaults to the tool's name.
+	Action string
+	// Resource is the CCL resource of a call: a template in which each
+	// {name} is replaced by the call's top-level argument name, which must
+	// be a string, number, or boolean. A resource starting with "/" is then
+	// cleaned, so ".." segments cannot escape a permitted prefix.
+	Resource string
+	// Context lists the arguments copied into the evaluation context under
+	// their own names. If nil, every argument is.
+	Context []string
+	// Transform, if set, rewrites the arguments of a permitted call, for
+	// example to clamp a limit or drop a field. A call whose arguments it
+	// changes is returned with the ToolTransform verdict.
+	Transform func(args map[string]interface{}) (map[string]interface{}, error)
+}
+
+// ToolVerdict is the outcome of gating a tool call.
+type ToolVerdict string
+
+const (
+	// ToolAllow means the call may run as proposed.
+	ToolAllow ToolVerdict = "allow"
+	// ToolDeny means the call must not run.
+	ToolDeny ToolVerdict = "deny"
+	// ToolTransform means the call may run with the decision's rewritten
+	// arguments only.
+	ToolTransform ToolVerdict = "transform"
+)
+
+// ToolDecision is the outcome of ToolGate.Check.
+type ToolDecision struct {
+	Verdict ToolVerdict
+	// Call is the call to execute: the proposed call, or with
+	// ToolTransform, the call with rewritten arguments.
+	Call     ToolCall
+	Action   string
+	Resource string
+	Reason   string
+	// Enforcement is the enforcer's decision, or nil if the call was
+	// denied before reaching it.
+	Enforcement *EnforcementDecision
+}
+
+// ToolGateOptions configure NewToolGate.
+type ToolGateOptions struct {
+	// Enforcer evaluates, counts, and logs mapped calls. Required.
+	Enforcer *Enforcer
+	// Tools maps tool names to their mappings. Calls to other tools are
+	// denied.
+	Tools map[string]ToolMapping
+}
+
+// ToolGate sits between a language model's tool-call output and their
+// execution: it maps each proposed call to a CCL action, resource, and
+// context, checks it with an Enforcer, and returns whether to run it. It
+// is safe for concurrent use.
+type ToolGate struct {
+	enforcer *Enforcer
+	tools    map[string]ToolMapping
+}
+
+// NewToolGate creates a ToolGate.
+func NewToolGate(opts *ToolGateOptions) (*ToolGate, error) {
+	if opts == nil || opts.Enforcer == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: tool gate requires an enforcer")
+	}
+	tools := make(map[string]ToolMapping, len(opts.Tools))
+	for name, m := range opts.Tools {
+		if name == "" {
+			return nil, errorf(ErrCodeInvalidInput, "grith: tool gate: tool name must be a non-empty string")
+		}
+		if m.Action == "" {
+			m.Action = name
+		}
+		if _, err := expandToolResource(m.Resource, nil, true); err != nil {
+			return nil, errorf(ErrCodeInvalidInput, "grith: tool gate: tool %s: %v", name, err)
+		}
+		tools[name] = m
+	}
+	return &ToolGate{enforcer: opts.Enforcer, tools: tools}, nil
+}
+
+// Check gates a proposed tool call. Calls to unmapped tools, calls whose
+// arguments are not a JSON object or do not fill the resource template,
+// and calls the enforcer denies are denied; the others are allowed, or
+// transformed if the tool's Transform changes their arguments.
+//
+// An error means the call could not be checked, as for Enforcer.Check,
+// and it must not run.
+func (g *ToolGate) Check(ctx context.Context, call ToolCall) (*ToolDecision, error) {
+	deny := func(format string, args ...interface{}) *ToolDecision {
+		return &ToolDecision{Verdict: ToolDeny, Call: call, Reason: fmt.Sprintf(format, args...)}
+	}
+	m, ok := g.tools[call.Name]
+	if !ok {
+		return deny("Tool %q is not mapped", call.Name), nil
+	}
+	var args map[string]interface{}
+	if len(bytes.TrimSpace(call.Arguments)) > 0 {
+		if err := json.Unmarshal(call.Arguments, &args); err != nil || args == nil {
+			return deny("Arguments of %s are not a JSON object", call.Name), nil
+		}
+	}
+	resource, err := expandToolResource(m.Resource, args, false)
+	if err != nil {
+		return deny("Cannot map %s to a resource: %v", call.Name, err), nil
+	}
+	evalContext := make(map[string]interface{})
+	if m.Context == nil {
+		for k, v := range args {
+			evalContext[k] = v
+		}
+	}
+	for _, k := range m.Context {
+		if v, ok := args[k]; ok {
+			evalContext[k] = v
+		}
+	}
+
+	enforcement, err := g.enforcer.Check(ctx, m.Action, resource, evalContext)
+	if err != nil {
+		return nil, err
+	}
+	d := &ToolDecision{Verdict: ToolAllow, Call: call, Action: m.Action, Resource: resource, Reason: enforcement.Reason, Enforcement: enforcement}
+	if !enforcement.Permitted {
+		d.Verdict = ToolDeny
+		return d, nil
+	}
+	if m.Transform == nil {
+		return d, nil
+	}
+	original, err := json.Marshal(args)
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "grith: tool gate: %w", err)
+	}
+	rewritten, err := m.Transform(args)
+	if err != nil {
+		d.Verdict = ToolDeny
+		d.Reason = fmt.Sprintf("Cannot transform %s: %v", call.Name, err)
+		return d, nil
+	}
+	data, err := json.Marshal(rewritten)
+	if err != nil {
+		d.Verdict = ToolDeny
+		d.Reason = fmt.Sprintf("Cannot serialize transformed arguments of %s: %v", call.Name, err)
+		return d, nil
+	}
+	if !bytes.Equal(data, original) {
+		d.Verdict = ToolTransform
+		d.Call = ToolCall{Name: call.Name, Arguments: data}
+	}
+	return d, nil
+}
+
+// expandToolResource fills the {name} placeholders of template from args.
+// With check set, it only validates the template.
+func expandToolResource(template string, args map[string]interface{}, check bool) (string, error) {
+	var b strings.Builder
+	rest := template
+	for {
+		open := strings.IndexByte(rest, '{')
+		literal := rest
+		if open >= 0 {
+			literal = rest[:open]
+		}
+		if strings.IndexByte(literal, '}') >= 0 {
+			return "", fmt.Errorf("unbalanced } in resource template %q", template)
+		}
+		if open < 0 {
+			b.WriteString(rest)
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unbalanced { in resource template %q", template)
+		}
+		name := rest[open+1 : open+end]
+		if name == "" || strings.IndexByte(name, '{') >= 0 {
+			return "", fmt.Errorf("invalid placeholder in resource template %q", template)
+		}
+		b.WriteString(literal)
+		rest = rest[open+end+1:]
+		if check {
+			continue
+		}
+		switch v := args[name].(type) {
+		case string:
+			b.WriteString(v)
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			b.WriteString(strconv.FormatBool(v))
+		case nil:
+			return "", fmt.Errorf("argument %s is missing", name)
+		default:
+			return "", fmt.Errorf("argument %s is not a string, number, or boolean", name)
+		}
+	}
+	resource := b.String()
+	if strings.HasPrefix(resource, "/") {
+		resource = path.Clean(resource)
+	}
+	return resource, nil
+}
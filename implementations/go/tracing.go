@@ -0,0 +1,224 @@
+package grith
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// Tracer starts spans for the traced operations of the package once
+// installed with SetTracer. It mirrors the shape of an OpenTelemetry
+// trace.Tracer, so an adapter over one is a few lines, while the core
+// stays free of tracing dependencies. Spans are children of the span in
+// the context passed to the traced operation, so covenant decisions
+// appear in the distributed trace of the request that made them.
+type Tracer interface {
+	// Start starts a span named name as a child of any span in ctx and
+	// returns a context carrying it.
+	Start(ctx context.Context, name string, attrs ...TraceAttribute) (context.Context, Span)
+}
+
+// Span is an operation in a trace, as started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...TraceAttribute)
+	// RecordError records err and marks the span as failed.
+	RecordError(err error)
+	End()
+}
+
+// TraceAttribute is a span attribute. Value is a string, bool, or int64.
+type TraceAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span names of the traced operations.
+const (
+	SpanBuildCovenant  = "grith.BuildCovenant"
+	SpanVerifyCovenant = "grith.VerifyCovenant"
+	SpanResolveChain   = "grith.ResolveChain"
+	SpanEvaluate       = "grith.Evaluate"
+	SpanEnforcerCheck  = "grith.Enforcer.Check"
+	SpanLogAppend      = "grith.Log.Append"
+	// SpanStorePrefix is followed by the StoreOp name of a TracingStore
+	// operation, as in "grith.Store.get".
+	SpanStorePrefix = "grith.Store."
+)
+
+// tracerHolder lets an atomic.Pointer hold a Tracer interface.
+type tracerHolder struct{ t Tracer }
+
+var installedTracer atomic.Pointer[tracerHolder]
+
+// SetTracer installs t to trace the package's operations; nil stops
+// tracing. Without a tracer installed, tracing costs one atomic load per
+// operation.
+func SetTracer(t Tracer) {
+	if t == nil {
+		installedTracer.Store(nil)
+		return
+	}
+	installedTracer.Store(&tracerHolder{t: t})
+}
+
+// noopSpan is the span of untraced operations.
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...TraceAttribute) {}
+func (noopSpan) RecordError(error)               {}
+func (noopSpan) End()                            {}
+
+// startSpan starts a span with the installed Tracer, or a no-op span.
+func startSpan(ctx context.Context, name string, attrs ...TraceAttribute) (context.Context, Span) {
+	if h := installedTracer.Load(); h != nil {
+		return h.t.Start(ctx, name, attrs...)
+	}
+	return ctx, noopSpan{}
+}
+
+// endSpan records a non-nil err on span and ends it.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// BuildCovenantContext is BuildCovenant traced as a child of the span in
+// ctx.
+func BuildCovenantContext(ctx context.Context, opts *CovenantBuilderOptions) (*CovenantDocument, error) {
+	_, span := startSpan(ctx, SpanBuildCovenant)
+	doc, err := buildCovenant(opts, "", "")
+	logError(slog.LevelDebug, "covenant build failed", err)
+	if doc != nil {
+		span.SetAttributes(TraceAttribute{"grith.covenant_id", doc.ID})
+	}
+	endSpan(span, err)
+	return doc, err
+}
+
+// VerifyCovenantContext is VerifyCovenantWithOptions traced as a child of
+// the span in ctx. The span records the validity and the failed checks.
+func VerifyCovenantContext(ctx context.Context, doc *CovenantDocument, opts *VerifyOptions) (*VerificationResult, error) {
+	_, span := startSpan(ctx, SpanVerifyCovenant)
+	if doc != nil {
+		span.SetAttributes(TraceAttribute{"grith.covenant_id", doc.ID})
+	}
+	// The canonical form is computed once and shared by the ID,
+	// signature, and countersignature checks.
+	canonical, canonErr := CanonicalForm(doc)
+	result, err := verifyCovenant(doc, canonical, canonErr, opts)
+	if result != nil {
+		span.SetAttributes(TraceAttribute{"grith.valid", result.Valid})
+		if failed := failedCheckNames(result.Checks); len(failed) > 0 {
+			span.SetAttributes(TraceAttribute{"grith.failed_checks", failed})
+		}
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+// ResolveChain loads the ancestors of doc from store, from its parent to
+// the root, traced as a child of the span in ctx.
+func ResolveChain(ctx context.Context, store Store, doc *CovenantDocument) ([]*CovenantDocument, error) {
+	if store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: resolving a chain requires a store")
+	}
+	if doc == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: resolving a chain requires a covenant")
+	}
+	_, span := startSpan(ctx, SpanResolveChain, TraceAttribute{"grith.covenant_id", doc.ID})
+	ancestors, err := storeAncestors(store, doc)
+	span.SetAttributes(TraceAttribute{"grith.chain_depth", int64(len(ancestors))})
+	endSpan(span, err)
+	return ancestors, err
+}
+
+// ----------------------------------------------------------------------------
+// Store
+// ----------------------------------------------------------------------------
+
+// TracingStore is a Store that traces the operations it passes to another
+// store. Store methods take no context, so spans are children of the
+// context the TracingStore was bound to with WithContext; bind a copy
+// per request. It is safe for concurrent use.
+type TracingStore struct {
+	store Store
+	ctx   context.Context
+}
+
+// NewTracingStore returns a store tracing the operations of store, bound
+// to the background context.
+func NewTracingStore(store Store) (*TracingStore, error) {
+	if store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: tracing store requires a store")
+	}
+	return &TracingStore{store: store, ctx: context.Background()}, nil
+}
+
+// WithContext returns a copy of the store whose spans are children of the
+// span in ctx.
+func (s *TracingStore) WithContext(ctx context.Context) *TracingStore {
+	return &TracingStore{store: s.store, ctx: ctx}
+}
+
+func (s *TracingStore) start(op, id string) Span {
+	if id == "" {
+		_, span := startSpan(s.ctx, SpanStorePrefix+op)
+		return span
+	}
+	_, span := startSpan(s.ctx, SpanStorePrefix+op, TraceAttribute{"grith.covenant_id", id})
+	return span
+}
+
+// Put stores doc in the underlying store.
+func (s *TracingStore) Put(id string, doc *CovenantDocument) error {
+	span := s.start(StoreOpPut, id)
+	err := s.store.Put(id, doc)
+	endSpan(span, err)
+	return err
+}
+
+// Get reads a document from the underlying store.
+func (s *TracingStore) Get(id string) (*CovenantDocument, error) {
+	span := s.start(StoreOpGet, id)
+	doc, err := s.store.Get(id)
+	span.SetAttributes(TraceAttribute{"grith.found", doc != nil})
+	endSpan(span, err)
+	return doc, err
+}
+
+// Delete removes a document from the underlying store.
+func (s *TracingStore) Delete(id string) error {
+	span := s.start(StoreOpDelete, id)
+	err := s.store.Delete(id)
+	endSpan(span, err)
+	return err
+}
+
+// List returns every document in the underlying store.
+func (s *TracingStore) List() ([]*CovenantDocument, error) {
+	span := s.start(StoreOpList, "")
+	docs, err := s.store.List()
+	span.SetAttributes(TraceAttribute{"grith.documents", int64(len(docs))})
+	endSpan(span, err)
+	return docs, err
+}
+
+// Has reports whether the underlying store holds a document.
+func (s *TracingStore) Has(id string) bool {
+	span := s.start(StoreOpHas, id)
+	ok := s.store.Has(id)
+	span.SetAttributes(TraceAttribute{"grith.found", ok})
+	span.End()
+	return ok
+}
+
+// Count returns the number of documents in the underlying store.
+func (s *TracingStore) Count() int {
+	span := s.start(StoreOpCount, "")
+	n := s.store.Count()
+	span.SetAttributes(TraceAttribute{"grith.documents", int64(n)})
+	span.End()
+	return n
+}
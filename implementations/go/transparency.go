@@ -0,0 +1,570 @@
+package grith
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// InclusionPromise is a transparency log's signed commitment to include a
+// covenant ID, analogous to a Certificate Transparency SCT.
+type InclusionPromise struct {
+	LogID      string `json:"logId"`
+	CovenantID string `json:"covenantId"`
+	Timestamp  string `json:"timestamp"`
+	Signature  string `json:"signature"`
+}
+
+// SignedTreeHead is a transparency log's signed statement of its Merkle
+// tree size and root hash at a point in time.
+type SignedTreeHead struct {
+	LogID     string `json:"logId"`
+	TreeSize  int64  `json:"treeSize"`
+	RootHash  string `json:"rootHash"`
+	Timestamp string `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+// InclusionProof is a Merkle audit path for a covenant ID in a tree of
+// a given size.
+type InclusionProof struct {
+	LeafIndex int64    `json:"leafIndex"`
+	TreeSize  int64    `json:"treeSize"`
+	Hashes    []string `json:"hashes"`
+}
+
+// TransparencyReceipt is the evidence embedded in a covenant that it was
+// logged: the log's promise and, once merged, an inclusion proof against
+// a signed tree head. Receipts are not part of the canonical form.
+type TransparencyReceipt struct {
+	Promise  InclusionPromise `json:"promise"`
+	Proof    *InclusionProof  `json:"proof,omitempty"`
+	TreeHead *SignedTreeHead  `json:"treeHead,omitempty"`
+}
+
+// TransparencyLog is an append-only, publicly auditable log of covenant
+// IDs.
+type TransparencyLog interface {
+	// Submit adds a covenant ID to the log and returns a signed promise
+	// to include it. Submitting the same ID again returns a promise for
+	// the existing entry.
+	Submit(covenantID string) (*InclusionPromise, error)
+	// TreeHead returns the log's latest signed tree head.
+	TreeHead() (*SignedTreeHead, error)
+	// InclusionProof proves that covenantID is included in the tree of
+	// the given size.
+	InclusionProof(covenantID string, treeSize int64) (*InclusionProof, error)
+	// ConsistencyProof proves that the tree of size first is a prefix of
+	// the tree of size second.
+	ConsistencyProof(first, second int64) ([]string, error)
+}
+
+// TrustedLog describes a transparency log accepted during verification.
+type TrustedLog struct {
+	// PublicKey is the hex-encoded Ed25519 public key of the log.
+	PublicKey string
+	// Checkpoint, if set, is a tree head previously observed from this
+	// log. Receipts are checked for consistency with it when Log is set.
+	Checkpoint *SignedTreeHead
+	// Log, if set, is used to fetch consistency proofs between Checkpoint
+	// and the tree heads embedded in receipts.
+	Log TransparencyLog
+}
+
+// TransparencyLogID returns the ID of the log with the given hex-encoded
+// public key: the SHA-256 of the raw key bytes.
+func TransparencyLogID(publicKeyHex string) (string, error) {
+	key, err := FromHex(publicKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return SHA256Hex(key), nil
+}
+
+// transparencyLeafHash is the Merkle leaf hash of a covenant ID.
+func transparencyLeafHash(covenantID string) string {
+	return MerkleLeafHash([]byte(covenantID))
+}
+
+// signedPayload returns the canonical JSON of v without its signature.
+func signedPayload(v interface{}) ([]byte, error) {
+	m, err := objectToMap(v)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to convert to map: %w", err)
+	}
+	delete(m, "signature")
+	canonical, err := CanonicalizeJSON(m)
+	if err != nil {
+		return nil, errorf(ErrCodeCanonicalization, "grith: failed to canonicalize: %w", err)
+	}
+	return []byte(canonical), nil
+}
+
+// verifyLogSignature checks a promise or tree head signature against a
+// log public key.
+func verifyLogSignature(v interface{}, signature string, publicKey ed25519.PublicKey) bool {
+	payload, err := signedPayload(v)
+	if err != nil {
+		return false
+	}
+	sig, err := FromHex(signature)
+	if err != nil {
+		return false
+	}
+	return Verify(payload, sig, publicKey)
+}
+
+// ----------------------------------------------------------------------------
+// In-memory log
+// ----------------------------------------------------------------------------
+
+// MemoryTransparencyLog is an in-memory TransparencyLog that merges
+// submissions immediately. It is intended for tests and for embedding a
+// log in a larger service. It is safe for concurrent use.
+type MemoryTransparencyLog struct {
+	mu     sync.RWMutex
+	kp     *KeyPair
+	logID  string
+	leaves []string
+	index  map[string]int64
+}
+
+// NewMemoryTransparencyLog creates an empty log signing with kp.
+func NewMemoryTransparencyLog(kp *KeyPair) (*MemoryTransparencyLog, error) {
+	if kp == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: transparency log requires a key pair")
+	}
+	return &MemoryTransparencyLog{
+		kp:    kp,
+		logID: SHA256Hex(kp.PublicKey),
+		index: make(map[string]int64),
+	}, nil
+}
+
+// LogID returns the log's ID.
+func (l *MemoryTransparencyLog) LogID() string {
+	return l.logID
+}
+
+// Submit adds a covenant ID to the log. See TransparencyLog.
+func (l *MemoryTransparencyLog) Submit(covenantID string) (*InclusionPromise, error) {
+	if !isHexDigest(covenantID) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: covenant ID must be a 64-char hex SHA-256 digest")
+	}
+	l.mu.Lock()
+	if _, ok := l.index[covenantID]; !ok {
+		l.index[covenantID] = int64(len(l.leaves))
+		l.leaves = append(l.leaves, transparencyLeafHash(covenantID))
+	}
+	l.mu.Unlock()
+
+	promise := &InclusionPromise{LogID: l.logID, CovenantID: covenantID, Timestamp: Timestamp()}
+	sig, err := l.sign(promise)
+	if err != nil {
+		return nil, err
+	}
+	promise.Signature = sig
+	return promise, nil
+}
+
+// TreeHead returns the current signed tree head. See TransparencyLog.
+func (l *MemoryTransparencyLog) TreeHead() (*SignedTreeHead, error) {
+	l.mu.RLock()
+	root, err := MerkleRoot(l.leaves)
+	size := int64(len(l.leaves))
+	l.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	head := &SignedTreeHead{LogID: l.logID, TreeSize: size, RootHash: root, Timestamp: Timestamp()}
+	sig, err := l.sign(head)
+	if err != nil {
+		return nil, err
+	}
+	head.Signature = sig
+	return head, nil
+}
+
+// InclusionProof returns an audit path. See TransparencyLog.
+func (l *MemoryTransparencyLog) InclusionProof(covenantID string, treeSize int64) (*InclusionProof, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	idx, ok := l.index[covenantID]
+	if !ok {
+		return nil, errorf(ErrCodeNotFound, "grith: covenant %s is not in the log", covenantID)
+	}
+	if treeSize <= idx || treeSize > int64(len(l.leaves)) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: tree size %d does not include leaf %d", treeSize, idx)
+	}
+	hashes, err := MerkleInclusionProof(l.leaves[:treeSize], int(idx))
+	if err != nil {
+		return nil, err
+	}
+	return &InclusionProof{LeafIndex: idx, TreeSize: treeSize, Hashes: hashes}, nil
+}
+
+// ConsistencyProof returns a consistency proof. See TransparencyLog.
+func (l *MemoryTransparencyLog) ConsistencyProof(first, second int64) ([]string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if first < 1 || first > second || second > int64(len(l.leaves)) {
+		return nil, errorf(ErrCodeInvalidInput, "grith: invalid consistency range %d..%d for tree of size %d", first, second, len(l.leaves))
+	}
+	return MerkleConsistencyProof(l.leaves[:second], int(first))
+}
+
+func (l *MemoryTransparencyLog) sign(v interface{}) (string, error) {
+	payload, err := signedPayload(v)
+	if err != nil {
+		return "", err
+	}
+	sig, err := Sign(payload, l.kp.PrivateKey)
+	if err != nil {
+		return "", errorf(ErrCodeCrypto, "grith: failed to sign log entry: %w", err)
+	}
+	return ToHex(sig), nil
+}
+
+// ----------------------------------------------------------------------------
+// HTTP client and handler
+// ----------------------------------------------------------------------------
+
+// TransparencyLogClient is a TransparencyLog backed by a remote log
+// speaking the JSON API served by NewTransparencyLogHandler:
+//
+//	POST /submit            {"covenantId": "..."} -> InclusionPromise
+//	GET  /tree-head                              -> SignedTreeHead
+//	GET  /inclusion?covenantId=...&treeSize=N    -> InclusionProof
+//	GET  /consistency?first=N&second=M           -> {"hashes": [...]}
+type TransparencyLogClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewTransparencyLogClient creates a client for the log at baseURL. A nil
+// httpClient uses http.DefaultClient.
+func NewTransparencyLogClient(baseURL string, httpClient *http.Client) (*TransparencyLogClient, error) {
+	if _, err := url.Parse(baseURL); err != nil || baseURL == "" {
+		return nil, errorf(ErrCodeInvalidInput, "grith: invalid transparency log URL: %q", baseURL)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &TransparencyLogClient{baseURL: strings.TrimRight(baseURL, "/"), client: httpClient}, nil
+}
+
+// Submit submits a covenant ID. See TransparencyLog.
+func (c *TransparencyLogClient) Submit(covenantID string) (*InclusionPromise, error) {
+	body, _ := json.Marshal(map[string]string{"covenantId": covenantID})
+	var promise InclusionPromise
+	if err := c.do(http.MethodPost, "/submit", bytes.NewReader(body), &promise); err != nil {
+		return nil, err
+	}
+	return &promise, nil
+}
+
+// TreeHead fetches the latest signed tree head. See TransparencyLog.
+func (c *TransparencyLogClient) TreeHead() (*SignedTreeHead, error) {
+	var head SignedTreeHead
+	if err := c.do(http.MethodGet, "/tree-head", nil, &head); err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+// InclusionProof fetches an audit path. See TransparencyLog.
+func (c *TransparencyLogClient) InclusionProof(covenantID string, treeSize int64) (*InclusionProof, error) {
+	q := url.Values{"covenantId": {covenantID}, "treeSize": {strconv.FormatInt(treeSize, 10)}}
+	var proof InclusionProof
+	if err := c.do(http.MethodGet, "/inclusion?"+q.Encode(), nil, &proof); err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+// ConsistencyProof fetches a consistency proof. See TransparencyLog.
+func (c *TransparencyLogClient) ConsistencyProof(first, second int64) ([]string, error) {
+	q := url.Values{"first": {strconv.FormatInt(first, 10)}, "second": {strconv.FormatInt(second, 10)}}
+	var resp struct {
+		Hashes []string `json:"hashes"`
+	}
+	if err := c.do(http.MethodGet, "/consistency?"+q.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Hashes, nil
+}
+
+// logErrorBody is the JSON error response of the log API.
+type logErrorBody struct {
+	Error string    `json:"error"`
+	Code  ErrorCode `json:"code,omitempty"`
+}
+
+func (c *TransparencyLogClient) do(method, path string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return errorf(ErrCodeInvalidInput, "grith: failed to build log request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errorf(ErrCodeTransparency, "grith: transparency log request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxDocumentSize))
+	if err != nil {
+		return errorf(ErrCodeTransparency, "grith: failed to read transparency log response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e logErrorBody
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			code := e.Code
+			if code == "" {
+				code = ErrCodeTransparency
+			}
+			return errorf(code, "grith: transparency log: %s", e.Error)
+		}
+		return errorf(ErrCodeTransparency, "grith: transparency log returned HTTP %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return errorf(ErrCodeInvalidJSON, "grith: invalid transparency log response: %w", err)
+	}
+	return nil
+}
+
+// NewTransparencyLogHandler serves log over the JSON API used by
+// TransparencyLogClient.
+func NewTransparencyLogHandler(log TransparencyLog) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeLogError(w, http.StatusMethodNotAllowed, errorf(ErrCodeInvalidInput, "method not allowed"))
+			return
+		}
+		var req struct {
+			CovenantID string `json:"covenantId"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+			writeLogError(w, http.StatusBadRequest, errorf(ErrCodeInvalidJSON, "invalid request body"))
+			return
+		}
+		writeLogResult(w)(log.Submit(req.CovenantID))
+	})
+	mux.HandleFunc("/tree-head", func(w http.ResponseWriter, r *http.Request) {
+		writeLogResult(w)(log.TreeHead())
+	})
+	mux.HandleFunc("/inclusion", func(w http.ResponseWriter, r *http.Request) {
+		size, err := strconv.ParseInt(r.URL.Query().Get("treeSize"), 10, 64)
+		if err != nil {
+			writeLogError(w, http.StatusBadRequest, errorf(ErrCodeInvalidInput, "invalid treeSize"))
+			return
+		}
+		writeLogResult(w)(log.InclusionProof(r.URL.Query().Get("covenantId"), size))
+	})
+	mux.HandleFunc("/consistency", func(w http.ResponseWriter, r *http.Request) {
+		first, err1 := strconv.ParseInt(r.URL.Query().Get("first"), 10, 64)
+		second, err2 := strconv.ParseInt(r.URL.Query().Get("second"), 10, 64)
+		if err1 != nil || err2 != nil {
+			writeLogError(w, http.StatusBadRequest, errorf(ErrCodeInvalidInput, "invalid tree sizes"))
+			return
+		}
+		hashes, err := log.ConsistencyProof(first, second)
+		if err != nil {
+			writeLogResult(w)(nil, err)
+			return
+		}
+		writeLogResult(w)(map[string][]string{"hashes": hashes}, nil)
+	})
+	return mux
+}
+
+func writeLogResult(w http.ResponseWriter) func(v interface{}, err error) {
+	return func(v interface{}, err error) {
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch CodeOf(err) {
+			case ErrCodeNotFound:
+				status = http.StatusNotFound
+			case ErrCodeInvalidInput, ErrCodeInvalidJSON:
+				status = http.StatusBadRequest
+			}
+			writeLogError(w, status, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
+
+func writeLogError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(logErrorBody{Error: strings.TrimPrefix(err.Error(), "grith: "), Code: CodeOf(err)})
+}
+
+// ----------------------------------------------------------------------------
+// Document integration
+// ----------------------------------------------------------------------------
+
+// SubmitToTransparencyLog submits doc's ID to log and returns a copy of
+// doc with the log's inclusion promise attached as a new receipt.
+func SubmitToTransparencyLog(doc *CovenantDocument, log TransparencyLog) (*CovenantDocument, error) {
+	promise, err := log.Submit(doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if promise.CovenantID != doc.ID {
+		return nil, errorf(ErrCodeTransparency, "grith: log promised covenant %s, submitted %s", promise.CovenantID, doc.ID)
+	}
+	newDoc := *doc
+	newDoc.Transparency = append(append([]TransparencyReceipt(nil), doc.Transparency...), TransparencyReceipt{Promise: *promise})
+	return &newDoc, nil
+}
+
+// UpdateTransparencyProofs fetches the latest tree head from log and
+// returns a copy of doc whose receipts from that log carry an inclusion
+// proof against it.
+func UpdateTransparencyProofs(doc *CovenantDocument, log TransparencyLog) (*CovenantDocument, error) {
+	head, err := log.TreeHead()
+	if err != nil {
+		return nil, err
+	}
+	newDoc := *doc
+	newDoc.Transparency = append([]TransparencyReceipt(nil), doc.Transparency...)
+	updated := false
+	for i := range newDoc.Transparency {
+		if newDoc.Transparency[i].Promise.LogID != head.LogID {
+			continue
+		}
+		proof, err := log.InclusionProof(doc.ID, head.TreeSize)
+		if err != nil {
+			return nil, err
+		}
+		newDoc.Transparency[i].Proof = proof
+		newDoc.Transparency[i].TreeHead = head
+		updated = true
+	}
+	if !updated {
+		return nil, errorf(ErrCodeNotFound, "grith: document has no receipt from log %s", head.LogID)
+	}
+	return &newDoc, nil
+}
+
+// checkTransparency verifies the document's receipts against the trusted
+// logs. It passes when every receipt from a trusted log is valid and at
+// least one such receipt exists; receipts from other logs are ignored.
+func checkTransparency(doc *CovenantDocument, logs []TrustedLog) VerificationCheck {
+	check := VerificationCheck{Name: "transparency", Code: CheckTransparency}
+
+	trusted := make(map[string]TrustedLog, len(logs))
+	keys := make(map[string]ed25519.PublicKey, len(logs))
+	for _, tl := range logs {
+		key, err := FromHex(tl.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			continue
+		}
+		id := SHA256Hex(key)
+		trusted[id] = tl
+		keys[id] = ed25519.PublicKey(key)
+	}
+
+	verified := 0
+	var failures []string
+	for _, r := range doc.Transparency {
+		tl, ok := trusted[r.Promise.LogID]
+		if !ok {
+			continue
+		}
+		if err := verifyReceipt(doc.ID, r, tl, keys[r.Promise.LogID]); err != nil {
+			failures = append(failures, fmt.Sprintf("log %s: %v", shortID(r.Promise.LogID), err))
+			continue
+		}
+		verified++
+	}
+
+	switch {
+	case len(failures) > 0:
+		check.Message = "Invalid transparency receipt(s): " + strings.Join(failures, "; ")
+	case verified == 0:
+		check.Message = "No receipt from a trusted transparency log"
+	default:
+		check.Passed = true
+		check.Message = fmt.Sprintf("%d transparency receipt(s) verified", verified)
+	}
+	return check
+}
+
+func verifyReceipt(covenantID string, r TransparencyReceipt, tl TrustedLog, key ed25519.PublicKey) error {
+	if r.Promise.CovenantID != covenantID {
+		return fmt.Errorf("promise is for covenant %s", r.Promise.CovenantID)
+	}
+	if !verifyLogSignature(&r.Promise, r.Promise.Signature, key) {
+		return fmt.Errorf("invalid promise signature")
+	}
+	if r.Proof == nil && r.TreeHead == nil {
+		return nil
+	}
+	if r.Proof == nil || r.TreeHead == nil {
+		return fmt.Errorf("inclusion proof and tree head must be present together")
+	}
+
+	head := r.TreeHead
+	if head.LogID != r.Promise.LogID || !verifyLogSignature(head, head.Signature, key) {
+		return fmt.Errorf("invalid tree head signature")
+	}
+	if r.Proof.TreeSize != head.TreeSize {
+		return fmt.Errorf("proof tree size %d does not match tree head size %d", r.Proof.TreeSize, head.TreeSize)
+	}
+	if !VerifyMerkleInclusion(transparencyLeafHash(covenantID), r.Proof.LeafIndex, r.Proof.TreeSize, r.Proof.Hashes, head.RootHash) {
+		return fmt.Errorf("inclusion proof does not match tree head")
+	}
+
+	cp := tl.Checkpoint
+	if cp == nil {
+		return nil
+	}
+	if cp.LogID != head.LogID || !verifyLogSignature(cp, cp.Signature, key) {
+		return fmt.Errorf("invalid checkpoint signature")
+	}
+	if cp.TreeSize == head.TreeSize {
+		if cp.RootHash != head.RootHash {
+			return fmt.Errorf("tree head conflicts with checkpoint of the same size")
+		}
+		return nil
+	}
+	older, newer := cp, head
+	if head.TreeSize < cp.TreeSize {
+		older, newer = head, cp
+	}
+	// Everything is consistent with an empty tree
+	if older.TreeSize == 0 || tl.Log == nil {
+		return nil
+	}
+	proof, err := tl.Log.ConsistencyProof(older.TreeSize, newer.TreeSize)
+	if err != nil {
+		return fmt.Errorf("failed to fetch consistency proof: %v", err)
+	}
+	if !VerifyMerkleConsistency(older.TreeSize, newer.TreeSize, older.RootHash, newer.RootHash, proof) {
+		return fmt.Errorf("tree head is not consistent with checkpoint")
+	}
+	return nil
+}
+
+// shortID abbreviates a hex identifier for messages.
+func shortID(id string) string {
+	if len(id) > 16 {
+		return id[:16]
+	}
+	return id
+}
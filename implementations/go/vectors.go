@@ -0,0 +1,969 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TestVector is a single cross-implementation conformance fixture. The
+// format is shared with the TypeScript implementation's
+// test-vectors/canonical-vectors.json.
+type TestVector struct {
+	Category    string                 `json:"category"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Input       map[string]interface{} `json:"input"`
+	Expected    map[string]interface{} `json:"expected"`
+}
+
+// TestVectorMeta describes a test vector file.
+type TestVectorMeta struct {
+	GeneratedAt     string         `json:"generated_at"`
+	ProtocolVersion string         `json:"protocol_version"`
+	Generator       string         `json:"generator"`
+	Description     string         `json:"description"`
+	TotalVectors    int            `json:"total_vectors"`
+	Categories      []string       `json:"categories"`
+	CategoryCounts  map[string]int `json:"category_counts"`
+}
+
+// TestVectorSet is a complete test vector file: metadata plus vectors
+// grouped by category.
+type TestVectorSet struct {
+	Meta    TestVectorMeta          `json:"_meta"`
+	Vectors map[string][]TestVector `json:"vectors"`
+}
+
+// TestVectorResult is the outcome of checking one vector against this
+// implementation.
+type TestVectorResult struct {
+	Category string
+	Name     string
+	Passed   bool
+	Skipped  bool
+	Message  string
+}
+
+// Fixed inputs for deterministic vector generation. These MUST NOT change:
+// they match the seeds used by the TypeScript generator.
+const (
+	vectorIssuerSeed      = "0000000000000000000000000000000000000000000000000000000000000001"
+	vectorBeneficiarySeed = "0000000000000000000000000000000000000000000000000000000000000002"
+	vectorAuditorSeed     = "0000000000000000000000000000000000000000000000000000000000000003"
+	vectorTimestamp       = "2026-01-01T00:00:00.000Z"
+	vectorNowMs           = int64(1767225600000) // vectorTimestamp in epoch ms
+)
+
+// vectorCategories lists categories in their canonical file order.
+var vectorCategories = []string{"crypto", "ccl", "covenant", "identity", "chain"}
+
+// LoadTestVectors reads a test vector file from path.
+func LoadTestVectors(path string) (*TestVectorSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errorf(ErrCodeStorage, "grith: failed to open test vectors: %w", err)
+	}
+	defer f.Close()
+	return ReadTestVectors(f)
+}
+
+// ReadTestVectors decodes a test vector file from r.
+func ReadTestVectors(r io.Reader) (*TestVectorSet, error) {
+	var set TestVectorSet
+	if err := json.NewDecoder(r).Decode(&set); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "grith: invalid test vector file: %w", err)
+	}
+	if set.Vectors == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: test vector file has no vectors")
+	}
+	return &set, nil
+}
+
+// WriteTestVectors encodes a test vector file to w as indented JSON.
+func WriteTestVectors(w io.Writer, set *TestVectorSet) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(set); err != nil {
+		return errorf(ErrCodeSerialization, "grith: failed to write test vectors: %w", err)
+	}
+	return nil
+}
+
+// GenerateTestVectors produces a deterministic set of conformance vectors
+// from fixed keys, nonces, and timestamps. Running it twice yields
+// byte-identical output.
+func GenerateTestVectors() (*TestVectorSet, error) {
+	g := &vectorGenerator{set: &TestVectorSet{Vectors: make(map[string][]TestVector)}}
+	steps := []func() error{g.crypto, g.ccl, g.covenant, g.identity, g.chain}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+
+	counts := make(map[string]int, len(g.set.Vectors))
+	total := 0
+	for cat, vs := range g.set.Vectors {
+		counts[cat] = len(vs)
+		total += len(vs)
+	}
+	g.set.Meta = TestVectorMeta{
+		GeneratedAt:     vectorTimestamp,
+		ProtocolVersion: ProtocolVersion,
+		Generator:       "grith-go",
+		Description:     "Canonical test vectors for the Grith protocol. Any conformant implementation MUST produce identical results for these inputs.",
+		TotalVectors:    total,
+		Categories:      append([]string(nil), vectorCategories...),
+		CategoryCounts:  counts,
+	}
+	return g.set, nil
+}
+
+// RunTestVectors checks every vector in set against this implementation.
+// Vectors whose expectations depend on values not captured in the file
+// (such as wall-clock identity timestamps) are only checked on their
+// deterministic fields. Unrecognized vectors are reported as skipped.
+func RunTestVectors(set *TestVectorSet) []TestVectorResult {
+	r := &vectorRunner{documents: make(map[string]*CovenantDocument)}
+	var results []TestVectorResult
+	for _, cat := range orderedCategories(set) {
+		for _, v := range set.Vectors[cat] {
+			res := TestVectorResult{Category: cat, Name: v.Name}
+			err := r.check(cat, v)
+			switch {
+			case err == errVectorSkipped:
+				res.Skipped = true
+				res.Message = "unsupported vector"
+			case err != nil:
+				res.Message = err.Error()
+			default:
+				res.Passed = true
+			}
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+// orderedCategories returns categories in metadata order followed by any
+// remaining categories sorted by name.
+func orderedCategories(set *TestVectorSet) []string {
+	seen := make(map[string]bool)
+	var cats []string
+	for _, c := range set.Meta.Categories {
+		if _, ok := set.Vectors[c]; ok && !seen[c] {
+			seen[c] = true
+			cats = append(cats, c)
+		}
+	}
+	var rest []string
+	for c := range set.Vectors {
+		if !seen[c] {
+			rest = append(rest, c)
+		}
+	}
+	sort.Strings(rest)
+	return append(cats, rest...)
+}
+
+// ----------------------------------------------------------------------------
+// Generation
+// ----------------------------------------------------------------------------
+
+type vectorGenerator struct {
+	set *TestVectorSet
+}
+
+func (g *vectorGenerator) add(category, name, description string, input, expected map[string]interface{}) {
+	g.set.Vectors[category] = append(g.set.Vectors[category], TestVector{
+		Category:    category,
+		Name:        name,
+		Description: description,
+		Input:       input,
+		Expected:    expected,
+	})
+}
+
+func (g *vectorGenerator) crypto() error {
+	for _, msg := range []string{"", "hello", "The quick brown fox jumps over the lazy dog", `{"action":"read","resource":"/data"}`} {
+		name := "sha256-empty"
+		if msg != "" {
+			name = "sha256-" + vectorSlug(msg, 20)
+		}
+		g.add("crypto", name, fmt.Sprintf("SHA-256 hash of %q", msg),
+			map[string]interface{}{"message": msg},
+			map[string]interface{}{"hash": SHA256String(msg)})
+	}
+
+	objects := []map[string]interface{}{
+		{"b": 2, "a": 1},
+		{"z": "last", "a": "first", "m": "middle"},
+		{"nested": map[string]interface{}{"b": 2, "a": 1}, "top": "value"},
+		{"unicode": "é", "ascii": "e"},
+		{"numbers": []interface{}{3, 1, 2}, "sorted": false},
+	}
+	for i, obj := range objects {
+		canonical, err := CanonicalizeJSON(obj)
+		if err != nil {
+			return err
+		}
+		g.add("crypto", fmt.Sprintf("jcs-canonicalize-%d", i), fmt.Sprintf("JCS (RFC 8785) canonicalization of test object %d", i),
+			map[string]interface{}{"object": obj},
+			map[string]interface{}{"canonical": canonical})
+	}
+
+	kp, err := keyPairFromSeedHex(vectorIssuerSeed)
+	if err != nil {
+		return err
+	}
+	for _, msg := range []string{"hello world", "The Grith Protocol", `{"action":"read","resource":"/data"}`} {
+		sig, err := Sign([]byte(msg), kp.PrivateKey)
+		if err != nil {
+			return err
+		}
+		g.add("crypto", "ed25519-sign-"+vectorSlug(msg, 20), fmt.Sprintf("Ed25519 sign/verify of %q", msg),
+			map[string]interface{}{"message": msg, "publicKey": kp.PublicKeyHex, "privateKey": vectorIssuerSeed},
+			map[string]interface{}{"signature": ToHex(sig), "valid": Verify([]byte(msg), sig, kp.PublicKey)})
+	}
+	return nil
+}
+
+func (g *vectorGenerator) ccl() error {
+	evals := []struct {
+		name, source, action, resource string
+		context                        map[string]interface{}
+	}{
+		{"simple-permit", "permit read on '/data/**'", "read", "/data/users", nil},
+		{"simple-deny", "deny delete on '/system/**'", "delete", "/system/config", nil},
+		{"deny-wins", "permit read on '/data/**'\ndeny read on '/data/secret'", "read", "/data/secret", nil},
+		{"default-deny", "permit read on '/data/**'", "write", "/data/users", nil},
+		{"condition-match", "permit read on '/data/**' when role = 'admin'", "read", "/data/users", map[string]interface{}{"role": "admin"}},
+		{"condition-no-match", "permit read on '/data/**' when role = 'admin'", "read", "/data/users", map[string]interface{}{"role": "user"}},
+		{"wildcard-action", "permit ** on '/public/**'", "anything.deep.nested", "/public/page", nil},
+		{"rate-limit-only", "limit api.call 100 per 1 hours", "api.call", "/api/endpoint", nil},
+		{"multiple-rules", "permit read on '/data/**'\npermit write on '/data/public/**'\ndeny write on '/data/private/**'", "write", "/data/public/file.txt", nil},
+		{"require-statement", "require audit on '/sensitive/**'", "audit", "/sensitive/data", nil},
+	}
+	for _, e := range evals {
+		doc, err := Parse(e.source)
+		if err != nil {
+			return err
+		}
+		ctx := e.context
+		if ctx == nil {
+			ctx = map[string]interface{}{}
+		}
+		result := Evaluate(doc, e.action, e.resource, ctx)
+		var matched interface{}
+		if result.MatchedRule != nil {
+			matched = map[string]interface{}{"type": string(result.MatchedRule.Type), "action": result.MatchedRule.Action, "resource": result.MatchedRule.Resource}
+		}
+		g.add("ccl", "evaluate-"+e.name, "CCL evaluation: "+e.name,
+			map[string]interface{}{"source": e.source, "action": e.action, "resource": e.resource, "context": ctx},
+			map[string]interface{}{"permitted": result.Permitted, "reason": result.Reason, "matchedRule": matched})
+	}
+
+	actions := [][2]string{
+		{"read", "read"}, {"read", "write"}, {"*", "read"}, {"**", "api.call.nested"},
+		{"api.*", "api.call"}, {"api.*", "api.call.nested"}, {"api.**", "api.call.nested"},
+	}
+	for _, a := range actions {
+		g.add("ccl", fmt.Sprintf("action-match-%s-vs-%s", a[0], a[1]), fmt.Sprintf("Action matching: %q vs %q", a[0], a[1]),
+			map[string]interface{}{"pattern": a[0], "action": a[1]},
+			map[string]interface{}{"matches": MatchAction(a[0], a[1])})
+	}
+
+	resources := [][2]string{
+		{"/data", "/data"}, {"/data", "/data/sub"}, {"/data/**", "/data/sub/deep"},
+		{"/data/*", "/data/sub"}, {"/data/*", "/data/sub/deep"}, {"**", "/anything/at/all"},
+	}
+	for _, r := range resources {
+		g.add("ccl", fmt.Sprintf("resource-match-%s-vs-%s", strings.NewReplacer("/", "-", "*", "star").Replace(r[0]), strings.ReplaceAll(r[1], "/", "-")), fmt.Sprintf("Resource matching: %q vs %q", r[0], r[1]),
+			map[string]interface{}{"pattern": r[0], "resource": r[1]},
+			map[string]interface{}{"matches": MatchResource(r[0], r[1])})
+	}
+
+	limitSource := "limit api.call 100 per 1 hours"
+	limitDoc, err := Parse(limitSource)
+	if err != nil {
+		return err
+	}
+	limits := []struct {
+		name  string
+		count int
+		start int64
+	}{
+		{"under-limit", 50, vectorNowMs - 1000},
+		{"at-limit", 100, vectorNowMs - 1000},
+		{"over-limit", 150, vectorNowMs - 1000},
+		{"period-expired", 150, vectorNowMs - 3_600_001},
+	}
+	for _, l := range limits {
+		res := CheckRateLimit(limitDoc, "api.call", l.count, l.start, vectorNowMs)
+		g.add("ccl", "rate-limit-"+l.name, "Rate limiting: "+l.name,
+			map[string]interface{}{"source": limitSource, "action": "api.call", "currentCount": l.count, "periodStartMs": l.start, "nowMs": vectorNowMs},
+			map[string]interface{}{"exceeded": res.Exceeded, "remaining": res.Remaining})
+	}
+
+	for _, src := range []string{
+		"permit read on '/data/**'",
+		"deny delete on '/system/**'",
+		"permit read on '/data/**' when role = 'admin'",
+		"limit api.call 100 per 1 hours",
+		"require audit on '/sensitive/**'",
+	} {
+		doc, err := Parse(src)
+		if err != nil {
+			return err
+		}
+		g.add("ccl", "serialize-"+vectorSlug(src, 30), fmt.Sprintf("CCL serialize round-trip: %q", src),
+			map[string]interface{}{"source": src},
+			map[string]interface{}{"serialized": Serialize(doc)})
+	}
+	return nil
+}
+
+func (g *vectorGenerator) covenant() error {
+	issuerKP, err := keyPairFromSeedHex(vectorIssuerSeed)
+	if err != nil {
+		return err
+	}
+	beneficiaryKP, err := keyPairFromSeedHex(vectorBeneficiarySeed)
+	if err != nil {
+		return err
+	}
+	auditorKP, err := keyPairFromSeedHex(vectorAuditorSeed)
+	if err != nil {
+		return err
+	}
+
+	issuer := Party{ID: "test-issuer", PublicKey: issuerKP.PublicKeyHex, Role: "issuer"}
+	beneficiary := Party{ID: "test-beneficiary", PublicKey: beneficiaryKP.PublicKeyHex, Role: "beneficiary"}
+	constraints := "permit read on '/data/**'\ndeny delete on '/system/**'"
+	nonce := SHA256String("grith-test-vector-nonce")
+
+	doc, err := buildCovenant(&CovenantBuilderOptions{
+		Issuer:      issuer,
+		Beneficiary: beneficiary,
+		Constraints: constraints,
+		PrivateKey:  issuerKP.PrivateKey,
+	}, nonce, vectorTimestamp)
+	if err != nil {
+		return err
+	}
+	canonical, err := CanonicalForm(doc)
+	if err != nil {
+		return err
+	}
+	g.add("covenant", "build-basic", "Build a basic covenant document and capture intermediate values",
+		map[string]interface{}{
+			"issuer":           map[string]interface{}{"id": issuer.ID, "publicKey": issuer.PublicKey, "role": issuer.Role},
+			"beneficiary":      map[string]interface{}{"id": beneficiary.ID, "publicKey": beneficiary.PublicKey, "role": beneficiary.Role},
+			"constraints":      constraints,
+			"signerPrivateKey": vectorIssuerSeed,
+		},
+		map[string]interface{}{
+			"version": doc.Version, "id": doc.ID, "canonical_form": canonical,
+			"canonical_hash_matches_id": SHA256String(canonical) == doc.ID,
+			"nonce":                     doc.Nonce, "nonce_length": len(doc.Nonce), "signature": doc.Signature, "createdAt": doc.CreatedAt,
+		})
+
+	if err := g.verifyVector("verify-valid", "Verify a valid covenant document -- all 11 checks should pass", doc, ""); err != nil {
+		return err
+	}
+
+	tamperedSig := *doc
+	first := "0"
+	if strings.HasPrefix(doc.Signature, "0") {
+		first = "1"
+	}
+	tamperedSig.Signature = first + doc.Signature[1:]
+	if err := g.verifyVector("verify-tampered-signature", "Verify a covenant with tampered signature (should fail)", &tamperedSig, "first character of signature modified"); err != nil {
+		return err
+	}
+
+	tamperedCCL := *doc
+	tamperedCCL.Constraints = "permit ** on '**'"
+	if err := g.verifyVector("verify-tampered-constraints", "Verify a covenant with tampered constraints (should fail)", &tamperedCCL, "constraints modified after signing"); err != nil {
+		return err
+	}
+
+	signed, err := countersign(doc, canonical, auditorKP, "auditor")
+	if err != nil {
+		return err
+	}
+	// The countersignature covers only the canonical form, so pinning its
+	// timestamp keeps the output deterministic without invalidating it.
+	signed.Countersignatures[0].Timestamp = vectorTimestamp
+	cs := signed.Countersignatures[0]
+	g.add("covenant", "countersign", "Countersign a covenant document with an auditor",
+		map[string]interface{}{"document_id": doc.ID, "signerPublicKey": auditorKP.PublicKeyHex, "signerPrivateKey": vectorAuditorSeed, "signerRole": "auditor"},
+		map[string]interface{}{
+			"countersignature_count": len(signed.Countersignatures), "countersigner_role": cs.SignerRole,
+			"countersigner_publicKey": cs.SignerPublicKey, "countersignature_signature": cs.Signature,
+		})
+	return g.verifyVector("verify-countersigned", "Verify a countersigned covenant document", signed, "")
+}
+
+func (g *vectorGenerator) verifyVector(name, description string, doc *CovenantDocument, tamper string) error {
+	result, err := VerifyCovenant(doc)
+	if err != nil {
+		return err
+	}
+	docMap, err := objectToMap(doc)
+	if err != nil {
+		return err
+	}
+	input := map[string]interface{}{"document": docMap}
+	if tamper != "" {
+		input["tamper"] = tamper
+	}
+	expected := map[string]interface{}{"valid": result.Valid}
+	if result.Valid {
+		checks := make([]interface{}, len(result.Checks))
+		for i, c := range result.Checks {
+			checks[i] = map[string]interface{}{"name": c.Name, "passed": c.Passed}
+		}
+		expected["checks"] = checks
+	} else {
+		var failed []interface{}
+		for _, c := range result.Checks {
+			if !c.Passed {
+				failed = append(failed, c.Name)
+			}
+		}
+		expected["failed_checks"] = failed
+	}
+	g.add("covenant", name, description, input, expected)
+	return nil
+}
+
+func (g *vectorGenerator) identity() error {
+	kp, err := keyPairFromSeedHex(vectorIssuerSeed)
+	if err != nil {
+		return err
+	}
+	identity, err := CreateIdentity(&CreateIdentityOptions{
+		OperatorKeyPair:    kp,
+		OperatorIdentifier: "test-operator",
+		Model:              ModelAttestation{Provider: "anthropic", ModelID: "claude-3"},
+		Capabilities:       []string{"read", "write", "api.call"},
+		Deployment:         DeploymentContext{Runtime: RuntimeContainer},
+	})
+	if err != nil {
+		return err
+	}
+	// Identity IDs and signatures depend on wall-clock timestamps, so only
+	// deterministic fields are captured.
+	g.add("identity", "create-basic", "Create a basic agent identity",
+		map[string]interface{}{
+			"operatorPublicKey": kp.PublicKeyHex, "operatorPrivateKey": vectorIssuerSeed, "operatorIdentifier": "test-operator",
+			"model": map[string]interface{}{"provider": "anthropic", "modelId": "claude-3"}, "capabilities": []interface{}{"read", "write", "api.call"},
+			"deployment": map[string]interface{}{"runtime": "container"},
+		},
+		map[string]interface{}{
+			"has_id": identity.ID != "", "model_provider": identity.Model.Provider, "model_modelId": identity.Model.ModelID,
+			"capabilities_sorted": stringsToInterfaces(identity.Capabilities), "capabilities_count": len(identity.Capabilities),
+			"capabilityManifestHash": identity.CapabilityManifestHash, "lineage_length": len(identity.Lineage),
+			"lineage_first_changeType": identity.Lineage[0].ChangeType, "lineage_first_reputationCarryForward": identity.Lineage[0].ReputationCarryForward,
+			"version": identity.Version,
+		})
+
+	evolved, err := EvolveIdentity(identity, &EvolveIdentityOptions{
+		OperatorKeyPair: kp,
+		ChangeType:      "model_update",
+		Description:     "Upgraded to claude-4",
+		Model:           &ModelAttestation{Provider: "anthropic", ModelID: "claude-4"},
+	})
+	if err != nil {
+		return err
+	}
+	g.add("identity", "evolve-model-update", "Evolve an identity with a model update",
+		map[string]interface{}{
+			"operatorPublicKey": kp.PublicKeyHex, "operatorPrivateKey": vectorIssuerSeed, "changeType": "model_update",
+			"description": "Upgraded to claude-4", "updates": map[string]interface{}{"model": map[string]interface{}{"provider": "anthropic", "modelId": "claude-4"}},
+		},
+		map[string]interface{}{
+			"new_id_differs": evolved.ID != identity.ID, "model_provider": evolved.Model.Provider, "lineage_length": len(evolved.Lineage),
+			"latest_changeType":             evolved.Lineage[len(evolved.Lineage)-1].ChangeType,
+			"latest_reputationCarryForward": evolved.Lineage[len(evolved.Lineage)-1].ReputationCarryForward, "version": evolved.Version,
+		})
+
+	caps := []string{"read", "write", "api.call", "admin"}
+	expanded, err := EvolveIdentity(identity, &EvolveIdentityOptions{
+		OperatorKeyPair: kp,
+		ChangeType:      "capability_change",
+		Description:     "Added admin capability",
+		Capabilities:    caps,
+	})
+	if err != nil {
+		return err
+	}
+	g.add("identity", "evolve-capability-change", "Evolve an identity with a capability expansion",
+		map[string]interface{}{"changeType": "capability_change", "updates": map[string]interface{}{"capabilities": stringsToInterfaces(caps)}},
+		map[string]interface{}{
+			"capabilities_sorted": stringsToInterfaces(expanded.Capabilities), "capabilities_count": len(expanded.Capabilities),
+			"capabilityManifestHash": expanded.CapabilityManifestHash, "lineage_length": len(expanded.Lineage),
+			"latest_reputationCarryForward": expanded.Lineage[len(expanded.Lineage)-1].ReputationCarryForward,
+		})
+	return nil
+}
+
+func (g *vectorGenerator) chain() error {
+	cases := []struct {
+		name, description, parent, child string
+	}{
+		{"valid-narrowing", "Child narrows parent permissions (valid delegation)", "permit read on '/data/**'\npermit write on '/data/**'", "permit read on '/data/public/**'"},
+		{"invalid-broadening", "Child broadens parent permissions (invalid -- permits what parent denies)", "permit read on '/data/**'\ndeny write on '/data/private/**'", "permit write on '/data/private/**'"},
+		{"outside-parent-scope", "Child permits outside parent scope (invalid)", "permit read on '/data/**'\npermit write on '/data/**'", "permit read on '/admin/**'"},
+	}
+	for _, c := range cases {
+		parent, err := Parse(c.parent)
+		if err != nil {
+			return err
+		}
+		child, err := Parse(c.child)
+		if err != nil {
+			return err
+		}
+		result := ValidateNarrowing(parent, child)
+		expected := map[string]interface{}{"valid": result.Valid, "violations_count": len(result.Violations)}
+		if len(result.Violations) > 0 {
+			reasons := make([]interface{}, len(result.Violations))
+			for i, v := range result.Violations {
+				reasons[i] = v.Message
+			}
+			expected["violation_reasons"] = reasons
+		}
+		g.add("chain", c.name, c.description,
+			map[string]interface{}{"parentConstraints": c.parent, "childConstraints": c.child},
+			expected)
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Checking
+// ----------------------------------------------------------------------------
+
+// errVectorSkipped marks a vector the runner does not know how to check.
+var errVectorSkipped = errors.New("grith: unsupported test vector")
+
+type vectorRunner struct {
+	documents map[string]*CovenantDocument
+	identity  *AgentIdentity
+}
+
+func (r *vectorRunner) check(category string, v TestVector) error {
+	in, exp := v.Input, v.Expected
+	switch category {
+	case "crypto":
+		return r.checkCrypto(in, exp)
+	case "ccl":
+		return r.checkCCL(in, exp)
+	case "covenant":
+		return r.checkCovenant(in, exp)
+	case "identity":
+		return r.checkIdentity(in, exp)
+	case "chain":
+		return r.checkChain(in, exp)
+	}
+	return errVectorSkipped
+}
+
+func (r *vectorRunner) checkCrypto(in, exp map[string]interface{}) error {
+	switch {
+	case has(in, "object"):
+		canonical, err := CanonicalizeJSON(in["object"])
+		if err != nil {
+			return err
+		}
+		return expectEqual(exp, "canonical", canonical)
+	case has(in, "privateKey"):
+		kp, err := keyPairFromSeedHex(vecString(in, "privateKey"))
+		if err != nil {
+			return err
+		}
+		if err := expectEqual(in, "publicKey", kp.PublicKeyHex); err != nil {
+			return err
+		}
+		msg := []byte(vecString(in, "message"))
+		sig, err := Sign(msg, kp.PrivateKey)
+		if err != nil {
+			return err
+		}
+		if err := expectEqual(exp, "signature", ToHex(sig)); err != nil {
+			return err
+		}
+		return expectEqual(exp, "valid", Verify(msg, sig, kp.PublicKey))
+	case has(exp, "hash"):
+		return expectEqual(exp, "hash", SHA256String(vecString(in, "message")))
+	}
+	return errVectorSkipped
+}
+
+func (r *vectorRunner) checkCCL(in, exp map[string]interface{}) error {
+	switch {
+	case has(in, "currentCount"):
+		doc, err := Parse(vecString(in, "source"))
+		if err != nil {
+			return err
+		}
+		res := CheckRateLimit(doc, vecString(in, "action"), int(vecFloat(in, "currentCount")), int64(vecFloat(in, "periodStartMs")), int64(vecFloat(in, "nowMs")))
+		if err := expectEqual(exp, "exceeded", res.Exceeded); err != nil {
+			return err
+		}
+		return expectEqual(exp, "remaining", res.Remaining)
+	case has(in, "source") && has(in, "action"):
+		doc, err := Parse(vecString(in, "source"))
+		if err != nil {
+			return err
+		}
+		ctx, _ := in["context"].(map[string]interface{})
+		res := Evaluate(doc, vecString(in, "action"), vecString(in, "resource"), ctx)
+		if err := expectEqual(exp, "permitted", res.Permitted); err != nil {
+			return err
+		}
+		if err := expectEqual(exp, "reason", res.Reason); err != nil {
+			return err
+		}
+		if rule, ok := exp["matchedRule"].(map[string]interface{}); ok {
+			if res.MatchedRule == nil {
+				return fmt.Errorf("matchedRule: expected %v, got none", rule)
+			}
+			return expectEqual(rule, "type", string(res.MatchedRule.Type))
+		}
+		if has(exp, "matchedRule") && exp["matchedRule"] == nil && res.MatchedRule != nil {
+			return fmt.Errorf("matchedRule: expected none, got %s", res.MatchedRule.Type)
+		}
+		return nil
+	case has(in, "pattern") && has(in, "action"):
+		return expectEqual(exp, "matches", MatchAction(vecString(in, "pattern"), vecString(in, "action")))
+	case has(in, "pattern") && has(in, "resource"):
+		return expectEqual(exp, "matches", MatchResource(vecString(in, "pattern"), vecString(in, "resource")))
+	case has(in, "source") && has(exp, "serialized"):
+		doc, err := Parse(vecString(in, "source"))
+		if err != nil {
+			return err
+		}
+		return expectEqual(exp, "serialized", Serialize(doc))
+	}
+	return errVectorSkipped
+}
+
+func (r *vectorRunner) checkCovenant(in, exp map[string]interface{}) error {
+	switch {
+	case has(in, "document"):
+		doc, err := vecDocument(in["document"])
+		if err != nil {
+			return err
+		}
+		result, err := VerifyCovenant(doc)
+		if err != nil {
+			return err
+		}
+		if result.Valid {
+			r.documents[doc.ID] = doc
+		}
+		if err := expectEqual(exp, "valid", result.Valid); err != nil {
+			return err
+		}
+		if checks, ok := exp["checks"].([]interface{}); ok {
+			for _, c := range checks {
+				cm, _ := c.(map[string]interface{})
+				name := vecString(cm, "name")
+				found := false
+				for _, got := range result.Checks {
+					if got.Name != name {
+						continue
+					}
+					found = true
+					if err := expectEqual(cm, "passed", got.Passed); err != nil {
+						return fmt.Errorf("check %s: %w", name, err)
+					}
+				}
+				if !found {
+					return fmt.Errorf("check %s: missing", name)
+				}
+			}
+		}
+		var failed []interface{}
+		for _, c := range result.Checks {
+			if !c.Passed {
+				failed = append(failed, c.Name)
+			}
+		}
+		return expectEqual(exp, "failed_checks", failed)
+	case has(in, "issuer") && has(exp, "nonce"):
+		kp, err := keyPairFromSeedHex(vecString(in, "signerPrivateKey"))
+		if err != nil {
+			return err
+		}
+		issuer, beneficiary := vecParty(in["issuer"]), vecParty(in["beneficiary"])
+		doc, err := buildCovenant(&CovenantBuilderOptions{
+			Issuer:      issuer,
+			Beneficiary: beneficiary,
+			Constraints: vecString(in, "constraints"),
+			PrivateKey:  kp.PrivateKey,
+		}, vecString(exp, "nonce"), vecString(exp, "createdAt"))
+		if err != nil {
+			return err
+		}
+		canonical, err := CanonicalForm(doc)
+		if err != nil {
+			return err
+		}
+		r.documents[doc.ID] = doc
+		for key, got := range map[string]interface{}{
+			"version": doc.Version, "canonical_form": canonical, "id": doc.ID, "signature": doc.Signature,
+		} {
+			if err := expectEqual(exp, key, got); err != nil {
+				return err
+			}
+		}
+		return nil
+	case has(in, "document_id"):
+		doc, ok := r.documents[vecString(in, "document_id")]
+		if !ok {
+			return errVectorSkipped
+		}
+		kp, err := keyPairFromSeedHex(vecString(in, "signerPrivateKey"))
+		if err != nil {
+			return err
+		}
+		signed, err := CountersignCovenant(doc, kp, vecString(in, "signerRole"))
+		if err != nil {
+			return err
+		}
+		cs := signed.Countersignatures[len(signed.Countersignatures)-1]
+		for key, got := range map[string]interface{}{
+			"countersignature_count": len(signed.Countersignatures), "countersigner_role": cs.SignerRole,
+			"countersigner_publicKey": cs.SignerPublicKey, "countersignature_signature": cs.Signature,
+		} {
+			if err := expectEqual(exp, key, got); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errVectorSkipped
+}
+
+func (r *vectorRunner) checkIdentity(in, exp map[string]interface{}) error {
+	var identity *AgentIdentity
+	var err error
+	switch {
+	case has(in, "model") && has(in, "capabilities"):
+		kp, kerr := keyPairFromSeedHex(vecString(in, "operatorPrivateKey"))
+		if kerr != nil {
+			return kerr
+		}
+		model, _ := in["model"].(map[string]interface{})
+		deployment, _ := in["deployment"].(map[string]interface{})
+		identity, err = CreateIdentity(&CreateIdentityOptions{
+			OperatorKeyPair:    kp,
+			OperatorIdentifier: vecString(in, "operatorIdentifier"),
+			Model:              ModelAttestation{Provider: vecString(model, "provider"), ModelID: vecString(model, "modelId")},
+			Capabilities:       vecStrings(in, "capabilities"),
+			Deployment:         DeploymentContext{Runtime: RuntimeType(vecString(deployment, "runtime"))},
+		})
+		if err != nil {
+			return err
+		}
+		r.identity = identity
+		if err := expectEqual(exp, "has_id", identity.ID != ""); err != nil {
+			return err
+		}
+	case has(in, "changeType"):
+		if r.identity == nil {
+			return errVectorSkipped
+		}
+		kp, kerr := keyPairFromSeedHex(vectorIssuerSeed)
+		if kerr != nil {
+			return kerr
+		}
+		if has(in, "operatorPrivateKey") {
+			if kp, kerr = keyPairFromSeedHex(vecString(in, "operatorPrivateKey")); kerr != nil {
+				return kerr
+			}
+		}
+		opts := &EvolveIdentityOptions{OperatorKeyPair: kp, ChangeType: vecString(in, "changeType"), Description: vecString(in, "description")}
+		if opts.Description == "" {
+			opts.Description = opts.ChangeType
+		}
+		updates, _ := in["updates"].(map[string]interface{})
+		if model, ok := updates["model"].(map[string]interface{}); ok {
+			opts.Model = &ModelAttestation{Provider: vecString(model, "provider"), ModelID: vecString(model, "modelId")}
+		}
+		if has(updates, "capabilities") {
+			opts.Capabilities = vecStrings(updates, "capabilities")
+		}
+		identity, err = EvolveIdentity(r.identity, opts)
+		if err != nil {
+			return err
+		}
+		if err := expectEqual(exp, "new_id_differs", identity.ID != r.identity.ID); err != nil {
+			return err
+		}
+	default:
+		return errVectorSkipped
+	}
+
+	first, latest := identity.Lineage[0], identity.Lineage[len(identity.Lineage)-1]
+	for key, got := range map[string]interface{}{
+		"model_provider":                       identity.Model.Provider,
+		"model_modelId":                        identity.Model.ModelID,
+		"capabilities_sorted":                  stringsToInterfaces(identity.Capabilities),
+		"capabilities_count":                   len(identity.Capabilities),
+		"capabilityManifestHash":               identity.CapabilityManifestHash,
+		"lineage_length":                       len(identity.Lineage),
+		"lineage_first_changeType":             first.ChangeType,
+		"lineage_first_reputationCarryForward": first.ReputationCarryForward,
+		"latest_changeType":                    latest.ChangeType,
+		"latest_reputationCarryForward":        latest.ReputationCarryForward,
+		"version":                              identity.Version,
+	} {
+		if err := expectEqual(exp, key, got); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *vectorRunner) checkChain(in, exp map[string]interface{}) error {
+	if !has(in, "parentConstraints") || !has(in, "childConstraints") {
+		return errVectorSkipped
+	}
+	parent, err := Parse(vecString(in, "parentConstraints"))
+	if err != nil {
+		return err
+	}
+	child, err := Parse(vecString(in, "childConstraints"))
+	if err != nil {
+		return err
+	}
+	result := ValidateNarrowing(parent, child)
+	if err := expectEqual(exp, "valid", result.Valid); err != nil {
+		return err
+	}
+	if err := expectEqual(exp, "violations_count", len(result.Violations)); err != nil {
+		return err
+	}
+	reasons := make([]interface{}, len(result.Violations))
+	for i, v := range result.Violations {
+		reasons[i] = v.Message
+	}
+	return expectEqual(exp, "violation_reasons", reasons)
+}
+
+// ----------------------------------------------------------------------------
+// Helpers
+// ----------------------------------------------------------------------------
+
+// keyPairFromSeedHex derives an Ed25519 key pair from a hex-encoded
+// 32-byte seed, the private key format used by the test vectors.
+func keyPairFromSeedHex(seedHex string) (*KeyPair, error) {
+	seed, err := FromHex(seedHex)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: seed must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return KeyPairFromPrivateKey(ed25519.NewKeyFromSeed(seed))
+}
+
+// expectEqual compares got with expected[key] after normalizing both
+// through JSON. A key absent from expected always matches.
+func expectEqual(expected map[string]interface{}, key string, got interface{}) error {
+	want, ok := expected[key]
+	if !ok {
+		return nil
+	}
+	if !reflect.DeepEqual(normalizeJSON(want), normalizeJSON(got)) {
+		return fmt.Errorf("%s: expected %v, got %v", key, want, got)
+	}
+	return nil
+}
+
+func normalizeJSON(v interface{}) interface{} {
+	out, err := jsonValue(v)
+	if err != nil {
+		return v
+	}
+	return out
+}
+
+func has(m map[string]interface{}, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+func vecString(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func vecFloat(m map[string]interface{}, key string) float64 {
+	f, _ := toFloat(m[key])
+	return f
+}
+
+func vecStrings(m map[string]interface{}, key string) []string {
+	items, _ := m[key].([]interface{})
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func vecParty(v interface{}) Party {
+	m, _ := v.(map[string]interface{})
+	return Party{ID: vecString(m, "id"), PublicKey: vecString(m, "publicKey"), Role: vecString(m, "role")}
+}
+
+func vecDocument(v interface{}) (*CovenantDocument, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc CovenantDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "grith: invalid document in test vector: %w", err)
+	}
+	return &doc, nil
+}
+
+func stringsToInterfaces(ss []string) []interface{} {
+	out := make([]interface{}, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
+
+// vectorSlug derives a vector name fragment from the first n bytes of
+// free text, matching the TypeScript generator's naming.
+func vectorSlug(s string, n int) string {
+	if len(s) > n {
+		s = s[:n]
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			b[i] = '-'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,189 @@
+package grith
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Migration upgrades (or downgrades) a covenant document between two
+// protocol versions. Migrate receives a private copy of the document and
+// may modify it in place; it need not set Version, ID, or Signature.
+type Migration struct {
+	From        string
+	To          string
+	Description string
+	Migrate     func(doc *CovenantDocument) error
+}
+
+// versionHandler holds the per-major-version rules used by
+// DeserializeCovenant and VerifyCovenant.
+type versionHandler struct {
+	// validate performs structural validation of a decoded document.
+	validate func(doc *CovenantDocument) error
+}
+
+// versionHandlers maps a protocol major version to its handler. Minor
+// revisions within a major version are backward-compatible and share a
+// handler.
+var versionHandlers = map[int]versionHandler{
+	1: {validate: validateV1Document},
+}
+
+var (
+	migrationsMu sync.RWMutex
+	migrations   []Migration
+)
+
+// RegisterMigration adds a migration step used by MigrateDocument.
+// Migrations between minor revisions of the same major version are
+// implicit and need not be registered.
+func RegisterMigration(m Migration) error {
+	if m.Migrate == nil {
+		return errorf(ErrCodeMissingField, "grith: migration requires a Migrate function")
+	}
+	if _, _, err := parseProtocolVersion(m.From); err != nil {
+		return err
+	}
+	if _, _, err := parseProtocolVersion(m.To); err != nil {
+		return err
+	}
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	migrations = append(migrations, m)
+	return nil
+}
+
+// IsSupportedVersion reports whether documents of the given protocol
+// version can be deserialized and verified. Any minor revision of a
+// supported major version is accepted.
+func IsSupportedVersion(version string) bool {
+	_, ok := handlerFor(version)
+	return ok
+}
+
+// MigrateDocument returns a copy of doc converted to targetVersion by
+// applying registered migrations along the shortest path. Moving between
+// minor revisions of the same major version only rewrites the version
+// field. The original document is not modified.
+//
+// Changing the version changes the canonical form, so the migrated
+// document has a recomputed ID, no signature, and no countersignatures;
+// the issuer must re-sign it with ResignCovenant.
+func MigrateDocument(doc *CovenantDocument, targetVersion string) (*CovenantDocument, error) {
+	if doc == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: document is required")
+	}
+	if !IsSupportedVersion(targetVersion) {
+		return nil, errorf(ErrCodeUnsupportedVersion, "grith: unsupported target protocol version: %s", targetVersion)
+	}
+	if doc.Version == targetVersion {
+		return doc.Clone(), nil
+	}
+
+	path, err := migrationPath(doc.Version, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	migrated := doc.Clone()
+	for _, m := range path {
+		if err := m.Migrate(migrated); err != nil {
+			return nil, errorf(ErrCodeInvalidInput, "grith: migration %s -> %s failed: %w", m.From, m.To, err)
+		}
+		migrated.Version = m.To
+	}
+
+	migrated.Signature = ""
+	migrated.Countersignatures = nil
+	migrated.Transparency = nil
+	migrated.Anchors = nil
+	id, err := ComputeID(migrated)
+	if err != nil {
+		return nil, err
+	}
+	migrated.ID = id
+	return migrated, nil
+}
+
+// migrationPath finds the shortest sequence of migrations from one
+// version to another. Steps between minor revisions of the same major
+// version are synthesized.
+func migrationPath(from, to string) ([]Migration, error) {
+	if _, _, err := parseProtocolVersion(from); err != nil {
+		return nil, err
+	}
+	toMajor, _, err := parseProtocolVersion(to)
+	if err != nil {
+		return nil, err
+	}
+
+	migrationsMu.RLock()
+	registered := append([]Migration(nil), migrations...)
+	migrationsMu.RUnlock()
+
+	// Breadth-first search over registered migrations until a version of
+	// the target major version is reached
+	type node struct {
+		version string
+		path    []Migration
+	}
+	queue := []node{{version: from}}
+	visited := map[string]bool{from: true}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		if major, _, _ := parseProtocolVersion(cur.version); major == toMajor {
+			if cur.version == to {
+				return cur.path, nil
+			}
+			return append(cur.path, minorMigration(cur.version, to)), nil
+		}
+
+		for _, m := range registered {
+			if m.From != cur.version || visited[m.To] {
+				continue
+			}
+			visited[m.To] = true
+			path := append(append([]Migration(nil), cur.path...), m)
+			queue = append(queue, node{version: m.To, path: path})
+		}
+	}
+	return nil, errorf(ErrCodeUnsupportedVersion, "grith: no migration path from version %s to %s", from, to)
+}
+
+// minorMigration is the implicit step between minor revisions of one
+// major version, which share a wire format.
+func minorMigration(from, to string) Migration {
+	return Migration{
+		From:        from,
+		To:          to,
+		Description: "Update version field",
+		Migrate:     func(*CovenantDocument) error { return nil },
+	}
+}
+
+// handlerFor returns the handler for a document version.
+func handlerFor(version string) (versionHandler, bool) {
+	major, _, err := parseProtocolVersion(version)
+	if err != nil {
+		return versionHandler{}, false
+	}
+	h, ok := versionHandlers[major]
+	return h, ok
+}
+
+// parseProtocolVersion splits a "major.minor" version string.
+func parseProtocolVersion(version string) (major, minor int, err error) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 2 {
+		return 0, 0, errorf(ErrCodeUnsupportedVersion, "grith: invalid protocol version: %q", version)
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || major < 0 || minor < 0 {
+		return 0, 0, errorf(ErrCodeUnsupportedVersion, "grith: invalid protocol version: %q", version)
+	}
+	return major, minor, nil
+}
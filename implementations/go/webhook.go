@@ -0,0 +1,460 @@
+package grith
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebhookEventType identifies a lifecycle event pushed by a
+// WebhookDispatcher.
+type WebhookEventType string
+
+const (
+	// WebhookCovenantCreated fires when a WebhookStore stores a covenant
+	// it did not hold.
+	WebhookCovenantCreated WebhookEventType = "covenant.created"
+	// WebhookCovenantCountersigned fires once for every countersignature
+	// a WebhookStore Put adds to a stored covenant.
+	WebhookCovenantCountersigned WebhookEventType = "covenant.countersigned"
+	// WebhookCovenantRevoked fires when a WebhookStore deletes a
+	// covenant: withdrawing it from the store revokes it for every
+	// enforcer and agent loading from that store.
+	WebhookCovenantRevoked WebhookEventType = "covenant.revoked"
+	// WebhookCovenantExpired fires when an ExpiryMonitor sees a covenant
+	// lapse.
+	WebhookCovenantExpired WebhookEventType = "covenant.expired"
+	// WebhookCovenantSuspended fires when an Enforcer's kill switch
+	// suspends a covenant.
+	WebhookCovenantSuspended WebhookEventType = "covenant.suspended"
+	// WebhookViolation fires for every violation an Enforcer detects.
+	WebhookViolation WebhookEventType = "violation"
+)
+
+// Webhook request headers. The signature is the hex Ed25519 signature of
+// the request body by the dispatcher's signer, whose hex public key is
+// sent alongside it; receivers must check the key against the one they
+// expect.
+const (
+	WebhookIDHeader        = "Grith-Webhook-Id"
+	WebhookSignatureHeader = "Grith-Signature"
+	WebhookSignerHeader    = "Grith-Signer"
+)
+
+// WebhookEvent is the JSON body of a webhook request. Only the fields of
+// its Type are set.
+type WebhookEvent struct {
+	// ID is unique to the event and stays the same across retries, so
+	// receivers can drop duplicate deliveries.
+	ID         string           `json:"id"`
+	Type       WebhookEventType `json:"type"`
+	CovenantID string           `json:"covenantId"`
+	// Timestamp is when the event was raised. Receivers should reject
+	// stale events to bound replays.
+	Timestamp        string            `json:"timestamp"`
+	Covenant         *CovenantDocument `json:"covenant,omitempty"`
+	Countersignature *Countersignature `json:"countersignature,omitempty"`
+	Violation        *Violation        `json:"violation,omitempty"`
+	Suspension       *SuspensionRecord `json:"suspension,omitempty"`
+}
+
+// WebhookEndpoint is a URL events are posted to.
+type WebhookEndpoint struct {
+	URL string
+	// Events, if set, are the event types sent to the endpoint; otherwise
+	// it receives every event.
+	Events []WebhookEventType
+}
+
+// wants reports whether the endpoint subscribes to events of type typ.
+func (ep WebhookEndpoint) wants(typ WebhookEventType) bool {
+	if len(ep.Events) == 0 {
+		return true
+	}
+	for _, t := range ep.Events {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is the outcome of delivering an event to an endpoint.
+type WebhookDelivery struct {
+	Endpoint string
+	Event    WebhookEvent
+	// Attempts is the number of requests made; zero if the event was
+	// dropped because the queue was full.
+	Attempts int
+	// StatusCode is the status of the last response, or zero if none was
+	// received.
+	StatusCode int
+	// Err is nil if the event was delivered.
+	Err error
+}
+
+// WebhookDispatcherOptions configure a WebhookDispatcher.
+type WebhookDispatcherOptions struct {
+	// Endpoints receive the events. Required.
+	Endpoints []WebhookEndpoint
+	// Signer signs every request body. Required.
+	Signer *KeyPair
+	// HTTPClient sends the requests. Defaults to a client with a 10
+	// second timeout.
+	HTTPClient *http.Client
+	// MaxAttempts is the number of requests made for an event before an
+	// endpoint is given up on. Defaults to 5.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every
+	// later one. Defaults to one second.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries. Defaults to one minute.
+	MaxBackoff time.Duration
+	// QueueSize is the number of events Notify holds for delivery.
+	// Defaults to 256.
+	QueueSize int
+	// OnDelivery, if set, is invoked synchronously with the outcome of
+	// every delivery, successful or not.
+	OnDelivery func(WebhookDelivery)
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// WebhookDispatcher pushes signed lifecycle events to HTTP endpoints,
+// retrying failed requests with exponential backoff. A request fails on a
+// network error, a 408 or 429 status, or a 5xx status; any other non-2xx
+// status is final. Events come from a WebhookStore, from Enforcers and
+// ExpiryMonitors configured with the dispatcher, or from Notify. It is
+// safe for concurrent use.
+type WebhookDispatcher struct {
+	opts  WebhookDispatcherOptions
+	queue chan WebhookEvent
+
+	mu     sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+// NewWebhookDispatcher creates a WebhookDispatcher. Events are queued
+// until Start is called; Deliver sends an event synchronously.
+func NewWebhookDispatcher(opts *WebhookDispatcherOptions) (*WebhookDispatcher, error) {
+	if opts == nil || len(opts.Endpoints) == 0 {
+		return nil, errorf(ErrCodeMissingField, "grith: webhook dispatcher requires endpoints")
+	}
+	if opts.Signer == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: webhook dispatcher requires a signer")
+	}
+	for _, ep := range opts.Endpoints {
+		if ep.URL == "" {
+			return nil, errorf(ErrCodeInvalidInput, "grith: webhook endpoint URL must be non-empty")
+		}
+	}
+	o := *opts
+	o.Endpoints = append([]WebhookEndpoint(nil), opts.Endpoints...)
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Minute
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 256
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return &WebhookDispatcher{opts: o, queue: make(chan WebhookEvent, o.QueueSize)}, nil
+}
+
+// stamp fills in the ID and timestamp of ev if they are unset.
+func (d *WebhookDispatcher) stamp(ev WebhookEvent) (WebhookEvent, error) {
+	if ev.ID == "" {
+		nonce, err := GenerateNonce()
+		if err != nil {
+			return ev, err
+		}
+		ev.ID = ToHex(nonce)
+	}
+	if ev.Timestamp == "" {
+		ev.Timestamp = d.opts.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	return ev, nil
+}
+
+// Notify queues ev for delivery by the background goroutine. If the queue
+// is full, the event is dropped, reported to OnDelivery, and an
+// ErrCodeWebhook error returned.
+func (d *WebhookDispatcher) Notify(ev WebhookEvent) error {
+	ev, err := d.stamp(ev)
+	if err != nil {
+		return err
+	}
+	select {
+	case d.queue <- ev:
+		return nil
+	default:
+	}
+	err = errorf(ErrCodeWebhook, "grith: webhook queue is full, dropped %s event %s", ev.Type, ev.ID)
+	if d.opts.OnDelivery != nil {
+		for _, ep := range d.opts.Endpoints {
+			if ep.wants(ev.Type) {
+				d.opts.OnDelivery(WebhookDelivery{Endpoint: ep.URL, Event: ev, Err: err})
+			}
+		}
+	}
+	return err
+}
+
+// Deliver sends ev to every endpoint subscribed to its type, one after
+// another, retrying each until it succeeds, its attempts run out, or ctx
+// is done, and returns the outcomes.
+func (d *WebhookDispatcher) Deliver(ctx context.Context, ev WebhookEvent) ([]WebhookDelivery, error) {
+	ev, err := d.stamp(ev)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return nil, errorf(ErrCodeSerialization, "grith: failed to serialize webhook event: %w", err)
+	}
+	sig, err := Sign(body, d.opts.Signer.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []WebhookDelivery
+	for _, ep := range d.opts.Endpoints {
+		if !ep.wants(ev.Type) {
+			continue
+		}
+		delivery := d.deliver(ctx, ep.URL, ev, body, ToHex(sig))
+		logError(slog.LevelWarn, "webhook delivery failed", delivery.Err, slog.String("endpoint", ep.URL), slog.String("event", string(ev.Type)), slog.String("id", ev.ID), slog.Int("attempts", delivery.Attempts))
+		if d.opts.OnDelivery != nil {
+			d.opts.OnDelivery(delivery)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// deliver posts the signed body to url until it is accepted.
+func (d *WebhookDispatcher) deliver(ctx context.Context, url string, ev WebhookEvent, body []byte, sig string) WebhookDelivery {
+	delivery := WebhookDelivery{Endpoint: url, Event: ev}
+	backoff := d.opts.Backoff
+	for {
+		delivery.Attempts++
+		status, retry, err := d.post(ctx, url, ev.ID, body, sig)
+		delivery.StatusCode, delivery.Err = status, err
+		if err == nil || !retry || delivery.Attempts == d.opts.MaxAttempts {
+			return delivery
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			delivery.Err = errorf(ErrCodeWebhook, "grith: webhook delivery to %s abandoned: %w", url, ctx.Err())
+			return delivery
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > d.opts.MaxBackoff {
+			backoff = d.opts.MaxBackoff
+		}
+	}
+}
+
+// post makes one request and reports whether a failure is worth retrying.
+func (d *WebhookDispatcher) post(ctx context.Context, url, id string, body []byte, sig string) (status int, retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, errorf(ErrCodeWebhook, "grith: invalid webhook request to %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, id)
+	req.Header.Set(WebhookSignatureHeader, sig)
+	req.Header.Set(WebhookSignerHeader, d.opts.Signer.PublicKeyHex)
+	resp, err := d.opts.HTTPClient.Do(req)
+	if err != nil {
+		return 0, true, errorf(ErrCodeWebhook, "grith: webhook request to %s failed: %w", url, err)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return resp.StatusCode, retry, errorf(ErrCodeWebhook, "grith: webhook endpoint %s returned %s", url, resp.Status)
+}
+
+// Start begins delivering queued events in a background goroutine.
+// Calling Start on a running dispatcher has no effect.
+func (d *WebhookDispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.stop, d.done, d.cancel = make(chan struct{}), make(chan struct{}), cancel
+	go d.run(ctx, d.stop, d.done)
+}
+
+// Stop halts delivery and waits for the background goroutine to exit. A
+// delivery in progress is abandoned and reported to OnDelivery; events
+// still queued are delivered if the dispatcher is started again.
+func (d *WebhookDispatcher) Stop() {
+	d.mu.Lock()
+	stop, done, cancel := d.stop, d.done, d.cancel
+	d.stop, d.done, d.cancel = nil, nil, nil
+	d.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	cancel()
+	<-done
+}
+
+func (d *WebhookDispatcher) run(ctx context.Context, stop, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-stop:
+			return
+		case ev := <-d.queue:
+			// Failures have been reported to OnDelivery
+			_, _ = d.Deliver(ctx, ev)
+		}
+	}
+}
+
+// violation queues a violation event.
+func (d *WebhookDispatcher) violation(v Violation) {
+	_ = d.Notify(WebhookEvent{Type: WebhookViolation, CovenantID: v.CovenantID, Violation: &v})
+}
+
+// suspension queues a kill switch suspension event.
+func (d *WebhookDispatcher) suspension(r *SuspensionRecord) {
+	_ = d.Notify(WebhookEvent{Type: WebhookCovenantSuspended, CovenantID: r.CovenantID, Suspension: r})
+}
+
+// expiry queues an expiry event; other ExpiryMonitor events are not sent.
+func (d *WebhookDispatcher) expiry(ev ExpiryEvent) {
+	if ev.Type != ExpiryEventExpired {
+		return
+	}
+	var doc *CovenantDocument
+	if ev.Document != nil {
+		doc = ev.Document.Clone()
+	}
+	_ = d.Notify(WebhookEvent{Type: WebhookCovenantExpired, CovenantID: ev.DocumentID, Covenant: doc})
+}
+
+// VerifyWebhook checks the signature of a webhook request body against
+// the expected signer and returns the event it carries. signature is the
+// value of the WebhookSignatureHeader header.
+func VerifyWebhook(body []byte, signature string, publicKey ed25519.PublicKey) (*WebhookEvent, error) {
+	sig, err := FromHex(signature)
+	if err != nil || !Verify(body, sig, publicKey) {
+		return nil, errorf(ErrCodeCrypto, "grith: invalid webhook signature")
+	}
+	var ev WebhookEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return nil, errorf(ErrCodeInvalidJSON, "grith: invalid webhook event: %w", err)
+	}
+	return &ev, nil
+}
+
+// ----------------------------------------------------------------------------
+// Store
+// ----------------------------------------------------------------------------
+
+// WebhookStore is a Store that raises created, countersigned, and revoked
+// events on a WebhookDispatcher for the writes made through it. Events
+// are raised after the write succeeds. A Put compares the document with
+// the one it replaces, so concurrent Puts of the same ID may misreport
+// which countersignatures each added.
+type WebhookStore struct {
+	store    Store
+	webhooks *WebhookDispatcher
+}
+
+// NewWebhookStore returns a store raising events for writes to store on
+// webhooks.
+func NewWebhookStore(store Store, webhooks *WebhookDispatcher) (*WebhookStore, error) {
+	if store == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: webhook store requires a store")
+	}
+	if webhooks == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: webhook store requires a webhook dispatcher")
+	}
+	return &WebhookStore{store: store, webhooks: webhooks}, nil
+}
+
+// Put stores doc, raising a created event if the store did not hold it
+// and a countersigned event for each countersignature it adds.
+func (s *WebhookStore) Put(id string, doc *CovenantDocument) error {
+	var old *CovenantDocument
+	if id != "" {
+		var err error
+		if old, err = s.store.Get(id); err != nil {
+			return err
+		}
+	}
+	if err := s.store.Put(id, doc); err != nil {
+		return err
+	}
+	if old == nil {
+		_ = s.webhooks.Notify(WebhookEvent{Type: WebhookCovenantCreated, CovenantID: doc.ID, Covenant: doc.Clone()})
+		return nil
+	}
+	for i := len(old.Countersignatures); i < len(doc.Countersignatures); i++ {
+		cs := doc.Countersignatures[i]
+		_ = s.webhooks.Notify(WebhookEvent{Type: WebhookCovenantCountersigned, CovenantID: doc.ID, Covenant: doc.Clone(), Countersignature: &cs})
+	}
+	return nil
+}
+
+// Get returns the document from the underlying store.
+func (s *WebhookStore) Get(id string) (*CovenantDocument, error) {
+	return s.store.Get(id)
+}
+
+// Delete removes the document, raising a revoked event.
+func (s *WebhookStore) Delete(id string) error {
+	doc, err := s.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Delete(id); err != nil {
+		return err
+	}
+	_ = s.webhooks.Notify(WebhookEvent{Type: WebhookCovenantRevoked, CovenantID: id, Covenant: doc})
+	return nil
+}
+
+// List returns every document in the underlying store.
+func (s *WebhookStore) List() ([]*CovenantDocument, error) {
+	return s.store.List()
+}
+
+// Has reports whether the underlying store holds the document.
+func (s *WebhookStore) Has(id string) bool {
+	return s.store.Has(id)
+}
+
+// Count returns the number of documents in the underlying store.
+func (s *WebhookStore) Count() int {
+	return s.store.Count()
+}
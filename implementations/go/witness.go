@@ -0,0 +1,126 @@
+package grith
+
+import (
+	"crypto/ed25519"
+	"fmt"
+)
+
+// CheckpointCosignature is a witness's signature over a log checkpoint,
+// attesting that the witness saw the log at that size and head. A log
+// owner cannot silently truncate or fork a log past a checkpoint that
+// independent witnesses have cosigned.
+type CheckpointCosignature struct {
+	WitnessPublicKey string `json:"witnessPublicKey"`
+	// Role describes the witness, e.g. "auditor" or "issuer".
+	Role      string `json:"role,omitempty"`
+	Timestamp string `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+// WitnessPolicy requires checkpoints to be cosigned by at least Quorum of
+// the trusted Witnesses.
+type WitnessPolicy struct {
+	// Witnesses are the hex-encoded Ed25519 public keys of trusted
+	// witnesses.
+	Witnesses []string
+	Quorum    int
+}
+
+// CosignCheckpoint adds kp's cosignature to cp after checking the
+// checkpoint's own signature. It returns a new checkpoint; cp is not
+// modified. A witness should only cosign a checkpoint it has confirmed to
+// be consistent with the last one it cosigned, e.g. with
+// VerifyLogConsistency.
+func CosignCheckpoint(cp *LogCheckpoint, kp *KeyPair, role string) (*LogCheckpoint, error) {
+	if cp == nil {
+		return nil, errorf(ErrCodeMissingField, "grith: checkpoint is required")
+	}
+	if kp == nil || len(kp.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errorf(ErrCodeInvalidPrivateKey, "grith: privateKey must be %d bytes", ed25519.PrivateKeySize)
+	}
+	if err := VerifyLogCheckpoint(cp); err != nil {
+		return nil, err
+	}
+	payload, err := checkpointSigningPayload(cp)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := Sign([]byte(payload), kp.PrivateKey)
+	if err != nil {
+		return nil, errorf(ErrCodeCrypto, "grith: failed to cosign checkpoint: %w", err)
+	}
+
+	out := *cp
+	out.Cosignatures = nil
+	for _, c := range cp.Cosignatures {
+		if c.WitnessPublicKey != kp.PublicKeyHex {
+			out.Cosignatures = append(out.Cosignatures, c)
+		}
+	}
+	out.Cosignatures = append(out.Cosignatures, CheckpointCosignature{
+		WitnessPublicKey: kp.PublicKeyHex,
+		Role:             role,
+		Timestamp:        Timestamp(),
+		Signature:        ToHex(sig),
+	})
+	return &out, nil
+}
+
+// VerifyCheckpointWitnesses checks that cp carries valid cosignatures from
+// at least policy.Quorum distinct trusted witnesses. Cosignatures from
+// untrusted keys are ignored. It does not check the checkpoint's own
+// signature; see VerifyLogCheckpoint.
+func VerifyCheckpointWitnesses(cp *LogCheckpoint, policy *WitnessPolicy) error {
+	if policy == nil || policy.Quorum <= 0 {
+		return nil
+	}
+	if policy.Quorum > len(policy.Witnesses) {
+		return errorf(ErrCodeInvalidInput, "grith: witness quorum %d exceeds the %d trusted witnesses", policy.Quorum, len(policy.Witnesses))
+	}
+	payload, err := checkpointSigningPayload(cp)
+	if err != nil {
+		return err
+	}
+	trusted := make(map[string]bool, len(policy.Witnesses))
+	for _, w := range policy.Witnesses {
+		trusted[w] = true
+	}
+	seen := make(map[string]bool)
+	for _, c := range cp.Cosignatures {
+		if !trusted[c.WitnessPublicKey] || seen[c.WitnessPublicKey] {
+			continue
+		}
+		pub, err := FromHex(c.WitnessPublicKey)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			continue
+		}
+		sig, err := FromHex(c.Signature)
+		if err != nil || !Verify([]byte(payload), sig, ed25519.PublicKey(pub)) {
+			continue
+		}
+		seen[c.WitnessPublicKey] = true
+	}
+	if len(seen) < policy.Quorum {
+		return errorf(ErrCodeActionLog, "grith: checkpoint at size %d has %d of %d required witness cosignatures", cp.Size, len(seen), policy.Quorum)
+	}
+	return nil
+}
+
+// bundleWitnessCheck requires every checkpoint in the bundle, and at least
+// one, to meet the witness policy.
+func bundleWitnessCheck(b *AccountabilityBundle, policy *WitnessPolicy) VerificationCheck {
+	check := VerificationCheck{Name: "witnesses", Code: CheckBundleWitnesses}
+	if len(b.Checkpoints) == 0 {
+		check.Message = "Bundle has no checkpoints for witnesses to cosign"
+		return check
+	}
+	for i := range b.Checkpoints {
+		if err := VerifyCheckpointWitnesses(&b.Checkpoints[i], policy); err != nil {
+			check.Message = err.Error()
+			return check
+		}
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("%d checkpoint(s) meet the witness quorum of %d", len(b.Checkpoints), policy.Quorum)
+	return check
+}